@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/spf13/cobra"
+)
+
+func appendCmd() *cobra.Command {
+	var file string
+
+	cmd := &cobra.Command{
+		Use:   "append [id] [text]",
+		Short: "Add time-stamped text to the end of an entry",
+		Long: `Add time-stamped text to the end of an entry, for notes taken a bit at a
+time. The text comes from the arguments, a file (--file) or stdin ("-").
+
+When the addition is large relative to the entry, the entry is classified
+and embedded again; new tags are added, existing ones kept.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			if jsonOutput {
+				defer humanToStderr()()
+			}
+			text, err := readInput(args[1:], file)
+			if err != nil {
+				return err
+			}
+			if text == "" {
+				return fmt.Errorf("nothing to append")
+			}
+
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			id, err := resolveEntryID(ctx, s, args[0])
+			if err != nil {
+				return err
+			}
+			before, err := s.GetEntry(ctx, id)
+			if err != nil {
+				return err
+			}
+			entry, err := s.AppendToEntry(ctx, id, text)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Appended to %s (revision %d)\n", short(id), entry.Revision)
+			linkWikiLinks(ctx, s, id, entry.Content)
+
+			if domain.SubstantialAppend(before.Content, text) {
+				classifyEntry(ctx, s, id, entry.Content)
+				embedEntry(ctx, s, id, entry.Content)
+			}
+			if jsonOutput {
+				return printEntryAs(ctx, s, "json", id)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", "", "read the text from a file")
+	return cmd
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pbaille/kb/internal/ask"
+	"github.com/pbaille/kb/internal/classifier"
+	"github.com/pbaille/kb/internal/embedding"
+	"github.com/spf13/cobra"
+)
+
+func askCmd() *cobra.Command {
+	var sources int
+
+	cmd := &cobra.Command{
+		Use:   "ask [question]",
+		Short: "Answer a question from the knowledge base",
+		Long: `Answer a question from your entries, e.g.
+
+  kb ask "what did I save about Go's memory model?"
+
+The entries closest to the question by embedding are retrieved and the LLM
+answers from them alone, citing the entries it used by ID. Entries without
+embeddings are not considered (kb embed computes missing ones).`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			embSvc, err := embedding.New()
+			if err != nil {
+				return err
+			}
+			clf, err := classifier.New()
+			if err != nil {
+				return err
+			}
+
+			result, err := ask.Ask(ctx, s, embSvc, clf, strings.Join(args, " "), sources)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				return printJSON(result)
+			}
+
+			fmt.Println(result.Text)
+			if len(result.Citations) == 0 {
+				return nil
+			}
+			fmt.Println("\nSources:")
+			titles := make(map[string]string, len(result.Sources))
+			for _, src := range result.Sources {
+				titles[src.ID] = src.Title
+			}
+			for _, id := range result.Citations {
+				fmt.Printf("  %s  %s\n", short(id), truncate(titles[id], 60))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVarP(&sources, "sources", "k", ask.DefaultSources, "number of entries to retrieve")
+	return cmd
+}
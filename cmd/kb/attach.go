@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pbaille/kb/internal/blobs"
+	"github.com/spf13/cobra"
+)
+
+// maxAttachmentText bounds how much attachment text is sent to the classifier
+const maxAttachmentText = 10 * 1024
+
+func attachCmd() *cobra.Command {
+	var noClassify bool
+
+	cmd := &cobra.Command{
+		Use:   "attach [id] [file]",
+		Short: "Attach a file to an entry",
+		Long: `Attach a file to an entry.
+
+Files are stored by content hash next to the database (e.g. ~/.kb/blobs).
+Text files are also classified so their topics show up in the entry's tags.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			id, err := resolveEntryID(ctx, s, args[0])
+			if err != nil {
+				return err
+			}
+			entry, err := s.GetEntry(ctx, id)
+			if err != nil {
+				return err
+			}
+
+			data, err := os.ReadFile(args[1])
+			if err != nil {
+				return fmt.Errorf("read file: %w", err)
+			}
+
+			sum, size, err := blobs.ForDir(s.Dir()).Put(bytes.NewReader(data))
+			if err != nil {
+				return err
+			}
+
+			filename := filepath.Base(args[1])
+			mimeType := blobs.DetectMIME(filename, data)
+			if _, err := s.AddAttachment(ctx, entry.ID, sum, filename, mimeType, size); err != nil {
+				return err
+			}
+
+			fmt.Printf("Attached %s (%s, %d bytes) to %s\n", filename, mimeType, size, short(entry.ID))
+
+			if noClassify || !blobs.IsText(mimeType) {
+				return nil
+			}
+
+			text := string(data)
+			if len(text) > maxAttachmentText {
+				text = text[:maxAttachmentText]
+			}
+
+			classifyEntry(ctx, s, entry.ID, entry.Content+"\n\n"+text)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&noClassify, "no-classify", false, "skip classifying text attachments")
+	return cmd
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/pbaille/kb/internal/telegram"
+	"github.com/spf13/cobra"
+)
+
+func botCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bot",
+		Short: "Run chat bots capturing to the knowledge base",
+	}
+	cmd.AddCommand(telegramBotCmd())
+	return cmd
+}
+
+func telegramBotCmd() *cobra.Command {
+	var token, apiURL string
+	var allow []string
+
+	cmd := &cobra.Command{
+		Use:   "telegram",
+		Short: "Run a Telegram bot saving the messages sent to it",
+		Long: `Run a Telegram bot saving the messages sent to it, until interrupted.
+
+A message holding a single URL is fetched and saved like kb add <URL>;
+any other text is saved as a note. Entries are tagged and embedded as
+with kb add, given the ANTHROPIC_API_KEY and VOYAGE_API_KEY environment
+variables. Commands query the knowledge base:
+
+  /search <text>   entries containing a text
+  /recent          the latest entries
+  /random [tag]    an entry picked at random, under a tag if given
+  /show <id>       an entry in full
+
+Create the bot with @BotFather and pass its token with --token (default
+TELEGRAM_BOT_TOKEN). The bot only answers the users given with --allow,
+by user ID or username; others are told their user ID, to add.
+
+  kb bot telegram --token 123:ABC --allow 987654321
+  kb --notebook inbox bot telegram --allow @me`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if token == "" {
+				token = os.Getenv("TELEGRAM_BOT_TOKEN")
+			}
+			if token == "" {
+				return fmt.Errorf("no bot token: pass --token or set TELEGRAM_BOT_TOKEN")
+			}
+			if len(allow) == 0 {
+				fmt.Fprintln(os.Stderr, "No --allow users: the bot only tells users their ID")
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			bot := telegram.New(telegram.NewClient(token, apiURL), s, allow, nil)
+			return bot.Run(ctx)
+		},
+	}
+
+	cmd.Flags().StringVar(&token, "token", "", "bot token from @BotFather (default TELEGRAM_BOT_TOKEN)")
+	cmd.Flags().StringSliceVar(&allow, "allow", nil, "user IDs or usernames the bot answers (repeatable)")
+	cmd.Flags().StringVar(&apiURL, "api-url", telegram.DefaultAPIURL, "Bot API server, for a self-hosted one")
+	return cmd
+}
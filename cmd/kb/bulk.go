@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/pbaille/kb/internal/store"
+	"github.com/spf13/cobra"
+)
+
+// contentHashPattern matches a content hash, as opposed to an ID prefix
+var contentHashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+func bulkCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bulk",
+		Short: "Apply changes to many entries at once",
+	}
+
+	var mapPath string
+	var dryRun bool
+	tag := &cobra.Command{
+		Use:   "tag",
+		Short: "Tag entries from a CSV mapping",
+		Long: `Apply externally curated labels from a CSV file whose rows are
+
+  entry,tag[,parent]
+
+where entry is an entry ID, an ID prefix, or the SHA-256 of the entry's
+content in hex (sha256sum of the exact text). A tag that doesn't exist
+yet is created under parent. A header row naming the columns and lines
+starting with # are skipped.
+
+Every row is validated first; if any is invalid, the problems are listed
+and nothing is applied. Valid mappings are applied in one transaction, as
+human labels like kb tag add.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			if mapPath == "" {
+				return fmt.Errorf("--map is required")
+			}
+			var r io.Reader = os.Stdin
+			if mapPath != "-" {
+				f, err := os.Open(mapPath)
+				if err != nil {
+					return fmt.Errorf("open mapping: %w", err)
+				}
+				defer f.Close()
+				r = f
+			}
+
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			tags, err := s.ListTags(ctx)
+			if err != nil {
+				return err
+			}
+			tagNames := make(map[string]string, len(tags))
+			for _, t := range tags {
+				tagNames[t.ID] = t.Name
+			}
+			// The parent of each tag, existing or as first given in the mapping
+			parents := make(map[string]string, len(tags))
+			for _, t := range tags {
+				if t.ParentID != nil {
+					parents[t.Name] = tagNames[*t.ParentID]
+				} else {
+					parents[t.Name] = ""
+				}
+			}
+
+			var hashes map[string]string
+			var assignments []store.TagAssignment
+			var problems []string
+			entries := make(map[string]bool)
+
+			cr := csv.NewReader(r)
+			cr.FieldsPerRecord = -1
+			cr.Comment = '#'
+			cr.TrimLeadingSpace = true
+			for {
+				row, err := cr.Read()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					return fmt.Errorf("read mapping: %w", err)
+				}
+				line, _ := cr.FieldPos(0)
+				for i := range row {
+					row[i] = strings.TrimSpace(row[i])
+				}
+				if len(assignments) == 0 && len(problems) == 0 && len(row) >= 2 && strings.EqualFold(row[1], "tag") {
+					continue
+				}
+
+				problem := func(format string, a ...interface{}) {
+					problems = append(problems, fmt.Sprintf("line %d: ", line)+fmt.Sprintf(format, a...))
+				}
+				if len(row) < 2 || len(row) > 3 {
+					problem("want entry,tag[,parent], got %d fields", len(row))
+					continue
+				}
+				ref, name, parent := row[0], row[1], ""
+				if len(row) == 3 {
+					parent = row[2]
+				}
+				if ref == "" || name == "" {
+					problem("entry and tag are required")
+					continue
+				}
+				if parent == name {
+					problem("tag %s can't be its own parent", name)
+					continue
+				}
+
+				var id string
+				if contentHashPattern.MatchString(ref) {
+					if hashes == nil {
+						if hashes, err = s.ContentHashes(ctx); err != nil {
+							return err
+						}
+					}
+					if id = hashes[ref]; id == "" {
+						problem("no entry has content hash %s", short(ref))
+						continue
+					}
+				} else if id, err = s.ResolveID(ctx, ref); err != nil {
+					var ambiguous *store.AmbiguousIDError
+					if !errors.Is(err, store.ErrEntryNotFound) && !errors.As(err, &ambiguous) {
+						return err
+					}
+					problem("%s: %v", ref, err)
+					continue
+				}
+
+				if existing, ok := parents[name]; ok {
+					if parent != "" && parent != existing {
+						if existing == "" {
+							problem("tag %s has no parent, not %s", name, parent)
+						} else {
+							problem("tag %s is under %s, not %s", name, existing, parent)
+						}
+						continue
+					}
+				} else {
+					parents[name] = parent
+				}
+				if parent != "" {
+					if _, ok := parents[parent]; !ok {
+						parents[parent] = ""
+					}
+				}
+
+				assignments = append(assignments, store.TagAssignment{EntryID: id, Tag: name, Parent: parent})
+				entries[id] = true
+			}
+
+			if len(problems) > 0 {
+				for _, p := range problems {
+					fmt.Fprintln(os.Stderr, p)
+				}
+				return fmt.Errorf("%d invalid rows, nothing applied", len(problems))
+			}
+			if len(assignments) == 0 {
+				fmt.Println("Nothing to apply.")
+				return nil
+			}
+			if dryRun {
+				fmt.Printf("%d tag assignments on %d entries are valid (dry run, nothing applied)\n", len(assignments), len(entries))
+				return nil
+			}
+
+			linked, err := s.BulkTag(ctx, assignments)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Tagged %d entries: %d new links, %d already present\n",
+				len(entries), linked, len(assignments)-linked)
+			return nil
+		},
+	}
+	tag.Flags().StringVar(&mapPath, "map", "", "CSV mapping of entries to tags (- for stdin)")
+	tag.Flags().BoolVar(&dryRun, "dry-run", false, "only validate the mapping")
+	cmd.AddCommand(tag)
+
+	return cmd
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/store"
+	"github.com/spf13/cobra"
+)
+
+func collectionCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "collection",
+		Short: "Curate ordered lists of entries, like reading lists",
+		Long: `Curate ordered lists of entries, e.g. a reading list or a course outline.
+
+Unlike tags, collections are only ever filled by hand, and keep their
+entries in the order given. An entry can be in several collections.
+
+  kb collection create go-course --description "Go, from zero"
+  kb collection add go-course <id> <id> <id>
+  kb collection add go-course <id> --at 1
+  kb collection reorder go-course <id> --to 3
+  kb export --collection go-course --format epub`,
+	}
+
+	var description string
+	create := &cobra.Command{
+		Use:   "create [name]",
+		Short: "Create an empty collection",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			if err := s.CreateCollection(ctx, &domain.Collection{Name: args[0], Description: description}); err != nil {
+				return err
+			}
+			fmt.Printf("Created collection %s\n", args[0])
+			return nil
+		},
+	}
+	create.Flags().StringVar(&description, "description", "", "what the collection is for")
+	cmd.AddCommand(create)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List collections with their number of entries",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			collections, err := s.ListCollections(ctx)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				return printJSON(collections)
+			}
+			if len(collections) == 0 {
+				fmt.Println("No collections yet. Use 'kb collection create' to start one.")
+				return nil
+			}
+			for _, c := range collections {
+				fmt.Printf("%-20s %3d entries", c.Name, c.Entries)
+				if c.Description != "" {
+					fmt.Printf("  %s", truncate(c.Description, 50))
+				}
+				fmt.Println()
+			}
+			return nil
+		},
+	})
+
+	var format string
+	show := &cobra.Command{
+		Use:   "show [name]",
+		Short: "List the entries of a collection in order",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			format, err := entryFormat(format)
+			if err != nil {
+				return err
+			}
+
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			c, err := s.GetCollection(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			entries, err := s.CollectionEntries(ctx, c.Name)
+			if err != nil {
+				return err
+			}
+			if format != "" {
+				return printEntriesAs(ctx, s, format, entries)
+			}
+
+			fmt.Println(c.Name)
+			if c.Description != "" {
+				fmt.Printf("  %s\n", c.Description)
+			}
+			if len(entries) == 0 {
+				fmt.Println("  No entries yet. Use 'kb collection add' to add some.")
+				return nil
+			}
+			for i, e := range entries {
+				fmt.Printf("%3d. %s  %s\n", i+1, short(e.ID), truncate(e.DisplayTitle(), 60))
+			}
+			return nil
+		},
+	}
+	show.Flags().StringVar(&format, "format", "text", "output format: text, json, yaml, markdown or org")
+	cmd.AddCommand(show)
+
+	var at int
+	add := &cobra.Command{
+		Use:   "add [name] [id...]",
+		Short: "Add entries to a collection, at the end by default",
+		Long: `Add entries to a collection, in the order given, at the end or from the
+position given by --at (1 for the top). Entries already in the
+collection move there.`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return placeInCollection(cmd.Context(), args[0], args[1:], at, false)
+		},
+	}
+	add.Flags().IntVar(&at, "at", 0, "position to add the entries at, from 1 (default: the end)")
+	cmd.AddCommand(add)
+
+	var to int
+	reorder := &cobra.Command{
+		Use:   "reorder [name] [id...]",
+		Short: "Move entries of a collection to another position",
+		Long: `Move entries of a collection, in the order given, to the position
+given by --to (1 for the top), or to the end without it.`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return placeInCollection(cmd.Context(), args[0], args[1:], to, true)
+		},
+	}
+	reorder.Flags().IntVar(&to, "to", 0, "position to move the entries to, from 1 (default: the end)")
+	cmd.AddCommand(reorder)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "rm [name] [id...]",
+		Short: "Take entries out of a collection",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			ids, err := resolveEntryIDs(ctx, s, args[1:])
+			if err != nil {
+				return err
+			}
+			if err := s.RemoveFromCollection(ctx, args[0], ids); err != nil {
+				return err
+			}
+			fmt.Printf("Removed %d entries from %s\n", len(ids), args[0])
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "delete [name]",
+		Short: "Delete a collection; its entries are kept",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			if err := s.DeleteCollection(ctx, args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("Deleted collection %s\n", args[0])
+			return nil
+		},
+	})
+
+	return cmd
+}
+
+// placeInCollection adds entries to a collection, or moves those in it,
+// from a position (0 for the end)
+func placeInCollection(ctx context.Context, name string, args []string, position int, move bool) error {
+	s, err := getStore(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	ids, err := resolveEntryIDs(ctx, s, args)
+	if err != nil {
+		return err
+	}
+	if move {
+		err = s.ReorderCollection(ctx, name, ids, position)
+	} else {
+		err = s.AddToCollection(ctx, name, ids, position)
+	}
+	if err != nil {
+		return err
+	}
+
+	c, err := s.GetCollection(ctx, name)
+	if err != nil {
+		return err
+	}
+	verb := "Added"
+	if move {
+		verb = "Moved"
+	}
+	fmt.Printf("%s %d entries in %s (%d entries)\n", verb, len(ids), c.Name, c.Entries)
+	return nil
+}
+
+// resolveEntryIDs resolves ID prefixes, in order
+func resolveEntryIDs(ctx context.Context, s *store.Store, prefixes []string) ([]string, error) {
+	ids := make([]string, len(prefixes))
+	for i, prefix := range prefixes {
+		id, err := resolveEntryID(ctx, s, prefix)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/pbaille/kb/internal/classifier"
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/embedding"
+	"github.com/pbaille/kb/internal/worddiff"
+	"github.com/spf13/cobra"
+)
+
+func diffEntriesCmd() *cobra.Command {
+	var explain bool
+
+	cmd := &cobra.Command{
+		Use:   "diff-entries [id1] [id2]",
+		Short: "Compare two entries word by word",
+		Long: `Show a word-level diff between two entries, to decide whether
+near-duplicates should be merged. Removed words are shown as [-...-] and
+added ones as {+...+}, going from the first entry to the second.
+
+With --explain, the LLM also summarizes what each entry says that the
+other doesn't.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			var entries [2]*domain.Entry
+			for i, arg := range args {
+				id, err := resolveEntryID(ctx, s, arg)
+				if err != nil {
+					return err
+				}
+				if entries[i], err = s.GetEntry(ctx, id); err != nil {
+					return err
+				}
+			}
+			a, b := entries[0], entries[1]
+			if a.ID == b.ID {
+				return fmt.Errorf("both IDs name entry %s", short(a.ID))
+			}
+
+			fmt.Printf("--- %s  %s\n", short(a.ID), truncate(a.DisplayTitle(), 60))
+			fmt.Printf("+++ %s  %s\n", short(b.ID), truncate(b.DisplayTitle(), 60))
+
+			chunks := worddiff.Diff(a.Content, b.Content)
+			removed, added := worddiff.Stats(chunks)
+			summary := fmt.Sprintf("%d words removed, %d added", removed, added)
+			if va, _ := s.GetEmbedding(ctx, a.ID); va != nil {
+				if vb, _ := s.GetEmbedding(ctx, b.ID); vb != nil {
+					summary += fmt.Sprintf(", similarity %.2f", embedding.CosineSimilarity(va, vb))
+				}
+			}
+			fmt.Printf("%s\n\n", summary)
+
+			if removed == 0 && added == 0 {
+				fmt.Println("Contents are identical.")
+			} else {
+				fmt.Println(worddiff.Plain(chunks))
+			}
+
+			if explain {
+				clf, err := classifier.New()
+				if err != nil {
+					return err
+				}
+				explanation, err := clf.ExplainDifference(ctx, a.Content, b.Content)
+				if err != nil {
+					return fmt.Errorf("explain difference: %w", err)
+				}
+				fmt.Printf("\nWhat's different:\n%s\n", explanation)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&explain, "explain", false, "ask the LLM to summarize what's different")
+	return cmd
+}
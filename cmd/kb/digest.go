@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pbaille/kb/internal/digest"
+	"github.com/pbaille/kb/internal/rules"
+	"github.com/spf13/cobra"
+)
+
+func digestCmd() *cobra.Command {
+	var since, format string
+	var send bool
+
+	cmd := &cobra.Command{
+		Use:   "digest",
+		Short: "Summarize what was added over a period",
+		Long: `Summarize the entries added over a period, grouped by tag, with the older
+entries the new ones are closest to by embedding, followed by the other
+sections of the weekly report (kb report status shows which are on).
+
+  kb digest                  # the last 7 days, as Markdown
+  kb digest --since 30d --format html > month.html
+  kb digest --send           # email it and post it to the webhook
+
+--send delivers it like the weekly report: by email when KB_SMTP_* is
+configured and to KB_NOTIFY_WEBHOOK when set.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			period, err := rules.ParseDelay(since)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				format = "json"
+			}
+
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			d, err := digest.Build(ctx, s, time.Now().Add(-period))
+			if err != nil {
+				return err
+			}
+			if send {
+				if err := deliverDigest(ctx, d); err != nil {
+					return err
+				}
+				fmt.Println("Digest sent.")
+				return nil
+			}
+
+			switch format {
+			case "json":
+				return printJSON(d)
+			case "markdown", "md":
+				body, err := d.RenderMarkdown()
+				if err != nil {
+					return err
+				}
+				fmt.Print(body)
+			case "html":
+				body, err := d.RenderHTML()
+				if err != nil {
+					return err
+				}
+				fmt.Print(body)
+			default:
+				return fmt.Errorf("unknown format %q (use markdown, html or json)", format)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&since, "since", "7d", "period to summarize, e.g. 7d, 2w, 12h")
+	cmd.Flags().StringVar(&format, "format", "markdown", "output format: markdown, html or json")
+	cmd.Flags().BoolVar(&send, "send", false, "send the digest by email and to the webhook instead of printing it")
+	return cmd
+}
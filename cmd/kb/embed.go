@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/embedding"
+	"github.com/pbaille/kb/internal/pipeline"
+	"github.com/pbaille/kb/internal/store"
+	"github.com/spf13/cobra"
+)
+
+func embedCmd() *cobra.Command {
+	var missing bool
+	var batchSize, workers int
+
+	cmd := &cobra.Command{
+		Use:   "embed",
+		Short: "Compute embeddings for entries",
+		Long: `Compute the embeddings semantic search and related entries use.
+
+Entries longer than a few paragraphs are also embedded by passage, so a
+search matches a passage the embedding of the whole entry dilutes; --missing
+embeds the passages of long entries that have none yet too.
+
+Texts are sent --batch-size at a time, with up to --workers requests
+running at once.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			if !missing {
+				return fmt.Errorf("nothing to do: use --missing to embed entries lacking an embedding")
+			}
+			if batchSize < 1 || batchSize > embedding.MaxBatchSize {
+				return fmt.Errorf("batch size must be between 1 and %d", embedding.MaxBatchSize)
+			}
+
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			embSvc, err := embedding.New()
+			if err != nil {
+				return err
+			}
+
+			entries, err := s.ListEntriesWithoutEmbedding(ctx)
+			if err != nil {
+				return err
+			}
+			// Long entries are embedded by passage too, those embedded
+			// below as well as those embedded before passages were
+			unchunked, err := s.ListEntriesWithoutChunks(ctx)
+			if err != nil {
+				return err
+			}
+			var long []domain.Entry
+			for _, e := range unchunked {
+				if len(embedding.Chunk(e.Content)) > 0 {
+					long = append(long, e)
+				}
+			}
+			if len(entries) == 0 && len(long) == 0 {
+				fmt.Println("All entries have embeddings.")
+				return nil
+			}
+
+			total := len(entries) + len(long)
+			p := pipeline.New(ctx, s, embSvc, pipeline.Options{
+				BatchSize: batchSize,
+				Workers:   workers,
+				Progress: func(saved int) {
+					if saved%batchSize == 0 || saved == total {
+						fmt.Printf("Embedded %d/%d entries\n", saved, total)
+					}
+				},
+			})
+			for _, e := range entries {
+				p.Add(e.ID, e.Content)
+			}
+			for _, e := range long {
+				p.AddPassages(e.ID, e.Content)
+			}
+			if _, err := p.Wait(); err != nil {
+				return err
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&missing, "missing", false, "embed all entries without an embedding")
+	cmd.Flags().IntVar(&batchSize, "batch-size", embedding.MaxBatchSize, "texts per API request")
+	cmd.Flags().IntVar(&workers, "workers", pipeline.DefaultOptions().Workers, "API requests running at once")
+	return cmd
+}
+
+// embedEntry computes and saves an entry's embedding, and those of its
+// passages, when an embedding service is configured
+func embedEntry(ctx context.Context, s *store.Store, entryID, content string) {
+	embSvc, err := embedding.New()
+	if err != nil {
+		return
+	}
+	if _, err := pipeline.Embed(ctx, s, embSvc, entryID, content); err != nil {
+		fmt.Printf("(embedding skipped: %v)\n", err)
+	}
+}
+
+// newEmbedPipeline returns a pipeline embedding the entries added to it in
+// batches, or nil when no embedding service is configured
+func newEmbedPipeline(ctx context.Context, s *store.Store) *pipeline.Pipeline {
+	embSvc, err := embedding.New()
+	if err != nil {
+		return nil
+	}
+	return pipeline.New(ctx, s, embSvc, pipeline.DefaultOptions())
+}
+
+// waitEmbeddings waits for a pipeline from newEmbedPipeline to save the
+// embeddings of its entries
+func waitEmbeddings(p *pipeline.Pipeline) {
+	if p == nil {
+		return
+	}
+	if _, err := p.Wait(); err != nil {
+		fmt.Printf("(embeddings skipped: %v; kb embed --missing computes them)\n", err)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pbaille/kb/internal/export"
+	"github.com/spf13/cobra"
+)
+
+func exportCmd() *cobra.Command {
+	var format, tag, collection, output, manifest string
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export entries under a tag or in a collection as an EPUB, PDF, Markdown or Org document",
+		Long: `Compile the entries under a tag into a document for offline reading.
+
+Each tag in the hierarchy becomes a chapter, ordered depth-first with a
+table of contents, and entries are listed oldest first. Markdown and Org
+documents render entries like kb show --format does.
+
+With --collection, a collection is exported instead, as a single chapter
+listing its entries in the collection's order.
+
+With --manifest, the targets a YAML file declares are exported in one
+run instead, each from its notebook (the current one by default) and
+any of its tags, to epub, pdf, markdown, org, json, yaml, anki (a text
+file Anki imports as notes) or backup (a copy of the whole database):
+
+  targets:
+    - name: site
+      format: markdown
+      notebook: work
+      tags: [go, databases]
+      output: site/index.md
+    - name: backup
+      format: backup
+      encrypt: true   # passphrase from KB_BACKUP_PASSPHRASE, or passphrase_env
+    - name: deck
+      format: anki
+      tags: [spanish]
+      maturity: evergreen
+
+Outputs are relative to the manifest. Entries of encrypted notebooks are
+left out unless a target sets include_encrypted, and locked ones always
+are; exclude_tags and scope narrow a target further. An encrypted backup
+encrypts entry content only, like kb init --encrypted: titles, URLs,
+tags, links and embeddings stay in clear text.
+
+Use "kb export feedback" to export the classification feedback dataset.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			if manifest != "" {
+				return runManifest(ctx, manifest)
+			}
+			if (tag == "") == (collection == "") {
+				return fmt.Errorf("pass one of --tag or --collection")
+			}
+
+			var write func(f *os.File, doc *export.Document) error
+			switch format {
+			case "epub":
+				write = func(f *os.File, doc *export.Document) error { return export.WriteEPUB(f, doc) }
+			case "pdf":
+				write = func(f *os.File, doc *export.Document) error { return export.WritePDF(f, doc) }
+			case "markdown":
+				write = func(f *os.File, doc *export.Document) error { return export.WriteMarkdown(f, doc) }
+			case "org":
+				write = func(f *os.File, doc *export.Document) error { return export.WriteOrg(f, doc) }
+			default:
+				return fmt.Errorf("unknown format %q (use epub, pdf, markdown or org)", format)
+			}
+
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			var doc *export.Document
+			if collection != "" {
+				doc, err = export.BuildCollectionDocument(ctx, s, collection)
+			} else {
+				doc, err = export.BuildTagDocument(ctx, s, tag)
+			}
+			if err != nil {
+				return err
+			}
+
+			if output == "" {
+				ext := format
+				if format == "markdown" {
+					ext = "md"
+				}
+				output = strings.ReplaceAll(doc.Title, "/", "-") + "." + ext
+			}
+			f, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("create output: %w", err)
+			}
+			defer f.Close()
+
+			if err := write(f, doc); err != nil {
+				return err
+			}
+
+			fmt.Printf("Exported %d entries in %d sections to %s\n", doc.EntryCount(), len(doc.Sections), output)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", "epub", "output format: epub, pdf, markdown or org")
+	cmd.Flags().StringVar(&tag, "tag", "", "tag to export, by name or path (a/b/c), including its children")
+	cmd.Flags().StringVar(&collection, "collection", "", "collection to export, in its order")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "output file (default: <tag or collection>.<extension>)")
+	cmd.Flags().StringVar(&manifest, "manifest", "", "YAML file declaring export targets to run together")
+	cmd.AddCommand(exportFeedbackCmd())
+	return cmd
+}
+
+// runManifest runs the targets of a manifest, reporting each
+func runManifest(ctx context.Context, path string) error {
+	m, err := export.LoadManifest(path)
+	if err != nil {
+		return err
+	}
+	s, err := getStore(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	failed := 0
+	for _, r := range m.Run(ctx, s) {
+		if r.Err != nil {
+			failed++
+			fmt.Printf("%-16s failed: %v\n", r.Target, r.Err)
+			continue
+		}
+		line := fmt.Sprintf("%-16s %d entries to %s", r.Target, r.Entries, r.Output)
+		if r.Hidden > 0 {
+			line += fmt.Sprintf(" (%d encrypted or locked left out)", r.Hidden)
+		}
+		fmt.Println(line)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d targets failed", failed, len(m.Targets))
+	}
+	return nil
+}
+
+func exportFeedbackCmd() *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "feedback",
+		Short: "Export reviewed entries and their tags as a labeled dataset",
+		Long: `Export the classification feedback dataset as JSON lines.
+
+Each line holds an entry the user has viewed or corrected, with the tags
+kept on it (accepted) and the automatic tags the user removed (rejected).
+The dataset suits fine-tuning or few-shot examples, and "kb import
+feedback" seeds another knowledge base with it.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			dataset, err := s.FeedbackDataset(ctx)
+			if err != nil {
+				return err
+			}
+
+			var w io.Writer = os.Stdout
+			if output != "" {
+				f, err := os.Create(output)
+				if err != nil {
+					return fmt.Errorf("create output: %w", err)
+				}
+				defer f.Close()
+				w = f
+			}
+
+			enc := json.NewEncoder(w)
+			for _, ex := range dataset {
+				if err := enc.Encode(ex); err != nil {
+					return fmt.Errorf("write example: %w", err)
+				}
+			}
+
+			if output != "" {
+				fmt.Printf("Exported %d labeled entries to %s\n", len(dataset), output)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "output file (default: stdout)")
+	return cmd
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/feeds"
+	"github.com/pbaille/kb/internal/fetcher"
+	"github.com/pbaille/kb/internal/journal"
+	"github.com/pbaille/kb/internal/pipeline"
+	"github.com/pbaille/kb/internal/store"
+	"github.com/spf13/cobra"
+)
+
+// feedPollInterval is how often the server polls subscribed feeds
+const feedPollInterval = time.Hour
+
+func feedCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "feed",
+		Short: "Subscribe to RSS and Atom feeds",
+		Long: `Subscribe to RSS and Atom feeds.
+
+New items are saved as entries (the linked article, or the item content
+when it can't be fetched), then classified and embedded like any added
+URL. The server polls feeds hourly; "kb feed sync" polls them now.`,
+	}
+
+	var backfill int
+	add := &cobra.Command{
+		Use:   "add [url]",
+		Short: "Subscribe to a feed (or a site advertising one)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			parsed, err := feeds.Fetch(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			feed, err := s.AddFeed(ctx, parsed.URL, parsed.Title)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Subscribed to %s (%s)\n", feed.Name(), short(feed.ID))
+
+			// Only the newest items are ingested; older ones count as seen.
+			// Items are listed newest first.
+			for i, item := range parsed.Items {
+				if i >= backfill {
+					if err := s.AddFeedItem(ctx, feed.ID, item.GUID, ""); err != nil {
+						return err
+					}
+				}
+			}
+
+			j, ctx, closeJournal, err := pipeline.OpenJournal(ctx, s, "feeds", slog.Default())
+			if err != nil {
+				return err
+			}
+			defer closeJournal()
+			added, err := syncFeed(ctx, s, j, feed, parsed)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Added %d entries\n", added)
+			return nil
+		},
+	}
+	add.Flags().IntVar(&backfill, "backfill", 10, "number of existing items to ingest")
+	cmd.AddCommand(add)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List feed subscriptions",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			list, err := s.ListFeeds(ctx)
+			if err != nil {
+				return err
+			}
+			if len(list) == 0 {
+				fmt.Println("No feeds. Subscribe with: kb feed add <url>")
+				return nil
+			}
+
+			for _, f := range list {
+				polled := "never"
+				if f.LastPolledAt != nil {
+					polled = f.LastPolledAt.Format("2006-01-02 15:04")
+				}
+				fmt.Printf("%s  %s\n", short(f.ID), f.Name())
+				fmt.Printf("          %s (polled %s)\n", f.URL, polled)
+				if f.LastError != "" {
+					fmt.Printf("          error: %s\n", f.LastError)
+				}
+			}
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "rm [id or url]",
+		Short: "Unsubscribe from a feed (its entries are kept)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			if err := s.DeleteFeed(ctx, args[0]); err != nil {
+				return err
+			}
+			fmt.Println("Unsubscribed")
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "sync",
+		Short: "Poll all feeds now and ingest new items",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			return syncFeeds(ctx, s)
+		},
+	})
+
+	return cmd
+}
+
+// syncFeeds polls every subscribed feed, reporting all failures at the
+// end. Items are journaled as they're captured, and those a previous sync
+// left unfinished are completed first.
+func syncFeeds(ctx context.Context, s *store.Store) error {
+	j, ctx, closeJournal, err := pipeline.OpenJournal(ctx, s, "feeds", slog.Default())
+	if err != nil {
+		return err
+	}
+	defer closeJournal()
+
+	list, err := s.ListFeeds(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for i := range list {
+		feed := &list[i]
+		parsed, err := feeds.Fetch(ctx, feed.URL)
+		if err != nil {
+			if err := s.RecordFeedPoll(ctx, feed.ID, "", time.Now(), err); err != nil {
+				return err
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", feed.Name(), err))
+			continue
+		}
+
+		added, err := syncFeed(ctx, s, j, feed, parsed)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %d new entries\n", feed.Name(), added)
+	}
+	return errors.Join(errs...)
+}
+
+// syncFeed ingests the feed items not seen before, oldest first,
+// journaling them in j (when not nil)
+func syncFeed(ctx context.Context, s *store.Store, j *journal.Journal, feed *domain.Feed, parsed *feeds.Feed) (int, error) {
+	added := 0
+	for i := len(parsed.Items) - 1; i >= 0; i-- {
+		item := parsed.Items[i]
+		seen, err := s.HasFeedItem(ctx, feed.ID, item.GUID)
+		if err != nil {
+			return added, err
+		}
+		if seen {
+			continue
+		}
+
+		via := parsed.Title
+		if via == "" {
+			via = feed.Name()
+		}
+		entryID, isNew, err := ingestFeedItem(ctx, s, j, via, item)
+		if err != nil {
+			return added, err
+		}
+		if err := s.AddFeedItem(ctx, feed.ID, item.GUID, entryID); err != nil {
+			return added, err
+		}
+		if isNew {
+			added++
+		}
+	}
+
+	return added, s.RecordFeedPoll(ctx, feed.ID, parsed.Title, time.Now(), nil)
+}
+
+// ingestFeedItem saves a feed item as an entry, classified and embedded.
+// An item linking to an already saved URL is recorded as a sighting of that
+// entry instead. Items without any text are skipped (empty entry ID).
+func ingestFeedItem(ctx context.Context, s *store.Store, j *journal.Journal, via string, item feeds.Item) (string, bool, error) {
+	if item.Link != "" {
+		existing, err := s.FindEntryByURL(ctx, item.Link)
+		if err != nil {
+			return "", false, err
+		}
+		if existing != nil {
+			_, err := s.AddSourceOccurrence(ctx, existing.ID, via, item.Link)
+			return existing.ID, false, err
+		}
+	}
+
+	now := time.Now()
+	source := domain.Source{
+		Type:      domain.SourceURL,
+		URL:       item.Link,
+		Title:     item.Title,
+		Author:    item.Author,
+		FetchedAt: &now,
+	}
+
+	template, err := s.CaptureTemplate(ctx)
+	if err != nil {
+		return "", false, err
+	}
+
+	// Prefer the full article over the feed's excerpt
+	var capture *domain.URLCapture
+	if item.Link != "" {
+		if page, err := fetcher.Fetch(ctx, item.Link); err == nil && page.Text != "" {
+			capture = page.Capture()
+			if source.Title == "" {
+				source.Title = page.Title
+			}
+			if source.Author == "" {
+				source.Author = page.Author
+			}
+		} else if err != nil {
+			fmt.Printf("(%s: %v, using feed content)\n", item.Link, err)
+		}
+	}
+	if capture == nil {
+		text := fetcher.HTMLText(item.Content)
+		if text == "" {
+			return "", false, nil
+		}
+		capture = &domain.URLCapture{URL: source.URL, Author: source.Author, Text: text}
+	}
+	content := capture.Render(template)
+
+	c := journal.Capture{Content: content, Source: source}
+	if item.Link != "" {
+		c.Via, c.URL = via, item.Link
+	}
+	res, err := pipeline.Ingest(ctx, s, j, c, pipeline.ProcessOptions{})
+	if err != nil {
+		return "", false, err
+	}
+
+	fmt.Printf("Added entry: %s %s\n", short(res.Entry.ID), truncate(res.Entry.DisplayTitle(), 60))
+	if res.Classification != nil {
+		printTags(res.Classification.Tags)
+	}
+	for _, problem := range res.Problems {
+		fmt.Printf("  warning: %s\n", problem)
+	}
+	return res.Entry.ID, true, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pbaille/kb/internal/export"
+	"github.com/pbaille/kb/internal/store"
+	"github.com/spf13/cobra"
+)
+
+func graphCmd() *cobra.Command {
+	var format, output string
+	var minSimilarity float64
+
+	cmd := &cobra.Command{
+		Use:   "graph",
+		Short: "Export the graph of entries and tags",
+		Long: `Export the network of entries and tags: entries connected to their tags,
+tags to their parents, entries to the entries they link to, and entries to
+the ones whose embeddings are at least --min-similarity alike.
+
+DOT renders with Graphviz (kb graph | dot -Tsvg > kb.svg); JSON has the
+nodes and edges D3 and Cytoscape take.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			g, err := s.Graph(ctx, minSimilarity)
+			if err != nil {
+				return err
+			}
+
+			var w io.Writer = os.Stdout
+			if output != "" {
+				f, err := os.Create(output)
+				if err != nil {
+					return fmt.Errorf("create output: %w", err)
+				}
+				defer f.Close()
+				w = f
+			}
+			if err := export.WriteGraph(w, format, g); err != nil {
+				return err
+			}
+			if output != "" {
+				fmt.Printf("Exported %d nodes and %d edges to %s\n", len(g.Nodes), len(g.Edges), output)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", "dot", "output format: "+strings.Join(export.GraphFormats, ", "))
+	cmd.Flags().StringVarP(&output, "output", "o", "", "output file (default: stdout)")
+	cmd.Flags().Float64Var(&minSimilarity, "min-similarity", store.DefaultGraphSimilarity, "similarity from which entries are connected (0 for none)")
+	return cmd
+}
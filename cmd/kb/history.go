@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/worddiff"
+	"github.com/spf13/cobra"
+)
+
+func historyCmd() *cobra.Command {
+	var diff bool
+
+	cmd := &cobra.Command{
+		Use:   "history [id] [revision]",
+		Short: "List an entry's past versions, or show one",
+		Long: `List an entry's versions, newest first: every edit, append, merge or
+revert makes a new revision and keeps the one it replaced.
+
+With a revision, that version's content is printed; with --diff, what
+changed in that revision is shown instead, as a word diff from the
+previous one. kb revert brings a past version back.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			id, err := resolveEntryID(ctx, s, args[0])
+			if err != nil {
+				return err
+			}
+			versions, err := s.ListEntryVersions(ctx, id)
+			if err != nil {
+				return err
+			}
+
+			if len(args) == 1 {
+				if jsonOutput {
+					return printJSON(versions)
+				}
+				for i, v := range versions {
+					line := fmt.Sprintf("%4d  %s  %5d words  %s", v.Revision, v.CreatedAt.Local().Format("2006-01-02 15:04"),
+						len(strings.Fields(v.Content)), truncate(versionTitle(v), 50))
+					if i == 0 {
+						line += "  (current)"
+					}
+					fmt.Println(line)
+				}
+				if len(versions) == 1 {
+					fmt.Println("No past versions.")
+				}
+				return nil
+			}
+
+			revision, err := strconv.Atoi(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid revision: %s", args[1])
+			}
+			i := versionIndex(versions, revision)
+			if i < 0 {
+				return fmt.Errorf("%s has no version at revision %d", short(id), revision)
+			}
+			v := versions[i]
+			if v.Locked {
+				return fmt.Errorf("version is encrypted; set KB_PASSPHRASE to read it")
+			}
+			if jsonOutput {
+				return printJSON(v)
+			}
+
+			if !diff {
+				fmt.Println(v.Content)
+				return nil
+			}
+			if i == len(versions)-1 {
+				fmt.Printf("Revision %d is the oldest kept; no diff.\n", revision)
+				return nil
+			}
+			prev := versions[i+1]
+			if prev.Locked {
+				return fmt.Errorf("version is encrypted; set KB_PASSPHRASE to read it")
+			}
+			chunks := worddiff.Diff(prev.Content, v.Content)
+			removed, added := worddiff.Stats(chunks)
+			fmt.Printf("Revision %d → %d: %d words removed, %d added\n", prev.Revision, v.Revision, removed, added)
+			if prev.Title != v.Title {
+				fmt.Printf("Title: %q → %q\n", prev.Title, v.Title)
+			}
+			fmt.Printf("\n%s\n", worddiff.Plain(chunks))
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&diff, "diff", false, "show what changed in the revision")
+	return cmd
+}
+
+func revertCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "revert [id] [revision]",
+		Short: "Bring back an entry's content and title at a past revision",
+		Long: `Bring back an entry's content and title at a past revision, listed
+by kb history. The revert is a new revision: the replaced version is
+kept, so reverting can be undone too.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			if jsonOutput {
+				defer humanToStderr()()
+			}
+			revision, err := strconv.Atoi(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid revision: %s", args[1])
+			}
+
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			id, err := resolveEntryID(ctx, s, args[0])
+			if err != nil {
+				return err
+			}
+			entry, err := s.RevertEntry(ctx, id, revision)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Reverted %s to revision %d (now revision %d)\n", short(id), revision, entry.Revision)
+			embedEntry(ctx, s, id, entry.Content)
+
+			if jsonOutput {
+				return printEntryAs(ctx, s, "json", id)
+			}
+			return nil
+		},
+	}
+}
+
+// versionIndex returns the index of the version at a revision, -1 if
+// there is none
+func versionIndex(versions []domain.EntryVersion, revision int) int {
+	for i, v := range versions {
+		if v.Revision == revision {
+			return i
+		}
+	}
+	return -1
+}
+
+// versionTitle is a version's title, or the start of its content
+func versionTitle(v domain.EntryVersion) string {
+	switch {
+	case v.Locked:
+		return "(encrypted)"
+	case v.Title != "":
+		return v.Title
+	}
+	return v.Content
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pbaille/kb/internal/bookmarks"
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/fetcher"
+	"github.com/pbaille/kb/internal/obsidian"
+	"github.com/pbaille/kb/internal/query"
+	"github.com/pbaille/kb/internal/store"
+	"github.com/spf13/cobra"
+)
+
+func importCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Import data into the knowledge base",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "feedback [file | -]",
+		Short: "Seed entries and tag feedback from a labeled dataset",
+		Long: `Import a dataset written by "kb export feedback".
+
+Entries already present (same URL or content) get the labels merged in
+instead of being duplicated. Tag calibration is recomputed afterwards, so
+the imported corrections shape the classifier's confidences right away.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			var r io.Reader = os.Stdin
+			if args[0] != "-" {
+				f, err := os.Open(args[0])
+				if err != nil {
+					return fmt.Errorf("open dataset: %w", err)
+				}
+				defer f.Close()
+				r = f
+			}
+
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			emb := newEmbedPipeline(ctx, s)
+			var created, merged int
+			dec := json.NewDecoder(bufio.NewReader(r))
+			for line := 1; ; line++ {
+				var ex domain.LabeledEntry
+				if err := dec.Decode(&ex); err == io.EOF {
+					break
+				} else if err != nil {
+					return fmt.Errorf("example %d: %w", line, err)
+				}
+				if ex.Content == "" {
+					return fmt.Errorf("example %d: no content", line)
+				}
+
+				id, isNew, err := s.ImportLabeledEntry(ctx, ex)
+				if err != nil {
+					return fmt.Errorf("example %d: %w", line, err)
+				}
+				if isNew {
+					created++
+					if emb != nil {
+						emb.Add(id, ex.Content)
+					}
+				} else {
+					merged++
+				}
+			}
+
+			waitEmbeddings(emb)
+
+			n, err := s.RecomputeTagCalibration(ctx)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Imported %d entries (%d merged into existing ones), %d tags calibrated\n", created, merged, n)
+			return nil
+		},
+	})
+
+	cmd.AddCommand(importObsidianCmd())
+	cmd.AddCommand(importBookmarksCmd("pocket", "Pocket export (HTML or CSV)", bookmarks.ParsePocket))
+	cmd.AddCommand(importBookmarksCmd("instapaper", "Instapaper CSV export", bookmarks.ParseInstapaper))
+	cmd.AddCommand(importBookmarksCmd("raindrop", "Raindrop.io CSV export", bookmarks.ParseRaindrop))
+	cmd.AddCommand(importBookmarksCmd("bookmarks", "bookmarks file (Chrome or Firefox JSON, or HTML)", bookmarks.ParseBrowser))
+	cmd.AddCommand(importHistoryCmd())
+	return cmd
+}
+
+// importHistoryCmd imports the pages of a browser history like bookmarks,
+// those visited often or lately enough
+func importHistoryCmd() *cobra.Command {
+	var minVisits int
+	var since string
+	cmd := importBookmarksCmd("history", "browser history (Chrome's History or Firefox's places.sqlite)", func(r io.Reader) ([]bookmarks.Bookmark, error) {
+		opts := bookmarks.HistoryOptions{MinVisits: minVisits}
+		if since != "" {
+			var err error
+			if opts.Since, err = query.ParseDate(since, time.Now(), false); err != nil {
+				return nil, fmt.Errorf("--since: %w", err)
+			}
+		}
+		return bookmarks.ParseHistory(r, opts)
+	})
+	cmd.Short = "Import the pages of a browser history"
+	cmd.Long = `Import the pages of a browser history, Chrome's History file or Firefox's
+places.sqlite (in the browser profile), as URL entries backdated to their
+first visit. Only pages visited at least --min-visits times are imported,
+and with --since only those visited since a day, or in the last 30d.
+
+Without --fetch, entries only hold the page title; with it, each page is
+fetched and its text extracted like kb add does, waiting --delay between
+pages. Pages already saved are left as they are, so a history can be
+imported again.
+
+Close the browser first: visits it hasn't written to the file yet are
+missed.`
+	cmd.Flags().IntVar(&minVisits, "min-visits", 2, "only import pages visited at least this many times")
+	cmd.Flags().StringVar(&since, "since", "", "only import pages visited on or after a day, or in the last 30d")
+	return cmd
+}
+
+func importObsidianCmd() *cobra.Command {
+	var noFolders bool
+
+	cmd := &cobra.Command{
+		Use:   "obsidian [vault]",
+		Short: "Import the notes of an Obsidian vault, with their tags and links",
+		Long: `Import the Markdown notes of an Obsidian vault, one entry per note.
+
+Tags from the frontmatter and #tags in the text become kb tags, nested
+ones (#project/kb) as a tag under its parent; the folders a note is in
+tag it too, as a hierarchy, unless --no-folders is given. [[Wiki-links]]
+between notes become links between their entries. Hidden directories,
+such as .obsidian, are skipped.
+
+Notes already imported (same file or content) get the tags and links
+merged in instead of being duplicated, so a vault can be imported again.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			vault, err := filepath.Abs(args[0])
+			if err != nil {
+				return err
+			}
+			notes, err := obsidian.ReadVault(vault)
+			if err != nil {
+				return err
+			}
+
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			emb := newEmbedPipeline(ctx, s)
+			ids := make([]string, len(notes))
+			var created, merged, empty int
+			for i, note := range notes {
+				if note.Content == "" {
+					empty++
+					continue
+				}
+				tags := note.Tags
+				if !noFolders && len(note.Folders) > 0 {
+					tags = append(tags, strings.ToLower(strings.Join(note.Folders, "/")))
+				}
+				var labels []domain.TagLabel
+				for _, tag := range tags {
+					label, err := tagPath(ctx, s, tag)
+					if err != nil {
+						return err
+					}
+					labels = append(labels, label)
+				}
+
+				id, isNew, err := s.ImportLabeledEntry(ctx, domain.LabeledEntry{
+					Content:  note.Content,
+					Source:   domain.Source{Type: domain.SourceFile, URL: "file://" + filepath.Join(vault, filepath.FromSlash(note.Path)), Title: note.Title},
+					Accepted: labels,
+				})
+				if err != nil {
+					return fmt.Errorf("%s: %w", note.Path, err)
+				}
+				ids[i] = id
+				if isNew {
+					created++
+					if emb != nil {
+						emb.Add(id, note.Content)
+					}
+				} else {
+					merged++
+				}
+			}
+
+			waitEmbeddings(emb)
+
+			resolver := obsidian.NewResolver(notes, ids)
+			links, unresolved := 0, 0
+			for i, note := range notes {
+				if ids[i] == "" {
+					continue
+				}
+				for _, target := range note.Links {
+					to, ok := resolver.Resolve(target)
+					if !ok || to == "" {
+						unresolved++
+						continue
+					}
+					if to == ids[i] {
+						continue
+					}
+					if err := s.LinkEntries(ctx, ids[i], to); err != nil {
+						return err
+					}
+					links++
+				}
+			}
+
+			if _, err := s.RecomputeTagCalibration(ctx); err != nil {
+				return err
+			}
+
+			fmt.Printf("Imported %d notes (%d merged into existing entries), %d wiki-links resolved\n", created, merged, links)
+			if empty > 0 {
+				fmt.Printf("%d empty notes skipped\n", empty)
+			}
+			if unresolved > 0 {
+				fmt.Printf("%d links to missing notes skipped\n", unresolved)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&noFolders, "no-folders", false, "don't tag notes with the folders they're in")
+	return cmd
+}
+
+func importBookmarksCmd(service, export string, parse func(io.Reader) ([]bookmarks.Bookmark, error)) *cobra.Command {
+	var fetch bool
+	var delay time.Duration
+
+	cmd := &cobra.Command{
+		Use:   service + " [file]",
+		Short: "Import the links of a " + export,
+		Long: `Import the links of a ` + export + ` as URL entries, backdated to
+when they were saved and tagged with their tags (and folders), nested
+ones as a tag under its parent. Notes, excerpts and highlights are kept
+in the entry's sections.
+
+Without --fetch, entries only hold what the export has; with it, each
+page is fetched and its text extracted like kb add does, waiting --delay
+between pages. Pages that fail to fetch are saved without their text.
+
+Links already saved get the tags merged in instead of being duplicated,
+so an export can be imported again.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			marks, err := parse(f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			template, err := s.CaptureTemplate(ctx)
+			if err != nil {
+				return err
+			}
+
+			// Pages are embedded in batches while the next ones are fetched
+			emb := newEmbedPipeline(ctx, s)
+			var created, merged, failed int
+			var lastFetch time.Time
+			for i, b := range marks {
+				var labels []domain.TagLabel
+				for _, tag := range b.Tags {
+					label, err := tagPath(ctx, s, tag)
+					if err != nil {
+						return err
+					}
+					labels = append(labels, label)
+				}
+
+				source := domain.Source{Type: domain.SourceURL, URL: b.URL, Title: b.Title}
+				existing, err := s.FindEntryByURL(ctx, b.URL)
+				if err != nil {
+					return err
+				}
+				if existing != nil {
+					source.URL = existing.Source.URL
+				}
+
+				capture := &domain.URLCapture{URL: source.URL, Description: b.Excerpt, Note: b.Note, Highlights: b.Highlights}
+				if existing == nil && fetch {
+					// Rate limit the sites we fetch from
+					if wait := delay - time.Since(lastFetch); wait > 0 {
+						select {
+						case <-time.After(wait):
+						case <-ctx.Done():
+							return ctx.Err()
+						}
+					}
+					fmt.Printf("[%d/%d] Fetching %s\n", i+1, len(marks), b.URL)
+					page, err := fetcher.Fetch(ctx, b.URL)
+					lastFetch = time.Now()
+					if err != nil {
+						fmt.Printf("(%v, saved without its text)\n", err)
+						failed++
+					} else {
+						capture.Author, capture.PublishedAt, capture.Text = page.Author, page.PublishedAt, page.Text
+						if capture.Description == "" {
+							capture.Description = page.Description
+						}
+						if source.Title == "" {
+							source.Title = page.Title
+						}
+						fetchedAt := lastFetch
+						source.Author, source.FetchedAt = page.Author, &fetchedAt
+					}
+				}
+				content := capture.Render(template)
+				if content == "" {
+					content = b.URL
+				}
+
+				id, isNew, err := s.ImportLabeledEntry(ctx, domain.LabeledEntry{Content: content, Source: source, Accepted: labels})
+				if err != nil {
+					return fmt.Errorf("%s: %w", b.URL, err)
+				}
+				if !isNew {
+					merged++
+					continue
+				}
+				created++
+				if !b.SavedAt.IsZero() {
+					if err := s.SetEntryCreatedAt(ctx, id, b.SavedAt); err != nil {
+						return err
+					}
+				}
+				if _, err := s.AddSourceOccurrence(ctx, id, service, b.URL); err != nil {
+					return err
+				}
+				if emb != nil {
+					emb.Add(id, content)
+				}
+			}
+			waitEmbeddings(emb)
+
+			if _, err := s.RecomputeTagCalibration(ctx); err != nil {
+				return err
+			}
+
+			fmt.Printf("Imported %d links (%d merged into existing entries)\n", created, merged)
+			if failed > 0 {
+				fmt.Printf("%d pages couldn't be fetched\n", failed)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&fetch, "fetch", false, "fetch each page and extract its text")
+	cmd.Flags().DurationVar(&delay, "delay", time.Second, "with --fetch, time to wait between pages")
+	return cmd
+}
+
+// tagPath returns the label of a nested tag (a/b/c), creating its
+// ancestors as a chain of parents
+func tagPath(ctx context.Context, s *store.Store, tag string) (domain.TagLabel, error) {
+	segments := strings.Split(tag, "/")
+	var parentID *string
+	for _, name := range segments[:len(segments)-1] {
+		t, err := s.GetOrCreateTag(ctx, name, parentID)
+		if err != nil {
+			return domain.TagLabel{}, err
+		}
+		parentID = &t.ID
+	}
+	label := domain.TagLabel{Name: segments[len(segments)-1], Origin: domain.OriginHuman}
+	if len(segments) > 1 {
+		label.Parent = segments[len(segments)-2]
+	}
+	return label, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/pbaille/kb/internal/store"
+	"github.com/spf13/cobra"
+)
+
+func initCmd() *cobra.Command {
+	var encrypted bool
+
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "Create the database, optionally encrypted",
+		Long: `Create the database, or bring an existing one's schema up to date.
+
+With --encrypted, the database gets a key derived from a passphrase and
+the content of its entries, including past versions, is stored
+encrypted; existing entries are encrypted right away. Titles, URLs,
+tags, embeddings and attachments are not encrypted.
+
+Every command then needs the passphrase: from KB_PASSPHRASE, from the
+output of KB_PASSPHRASE_COMMAND (a keyring lookup such as
+"secret-tool lookup service kb" or "security find-generic-password -s kb
+-w"), or typed at a prompt. Encrypted notebooks using the same
+passphrase are unlocked with it.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			var passphrase string
+			if encrypted {
+				var err error
+				if passphrase, err = newPassphrase(); err != nil {
+					return err
+				}
+			}
+
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			if !encrypted {
+				version, err := s.SchemaVersion(ctx)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Database %s is at schema version %d\n", s.Path(), version)
+				return nil
+			}
+			n, err := s.EncryptDatabase(ctx, passphrase)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Database %s is encrypted", s.Path())
+			if n > 0 {
+				fmt.Printf(" (%d existing entries encrypted)", n)
+			}
+			fmt.Println()
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&encrypted, "encrypted", false, "encrypt entry content with a key derived from a passphrase")
+	return cmd
+}
+
+// unlockStore unlocks an encrypted database, and the encrypted notebooks
+// sharing the passphrase. The passphrase comes from storedPassphrase or,
+// for an encrypted database at a terminal, a prompt.
+func unlockStore(ctx context.Context, s *store.Store) error {
+	passphrase, err := storedPassphrase()
+	if err != nil {
+		return err
+	}
+	if s.Encrypted() {
+		if passphrase == "" {
+			if !isTerminal(os.Stdin) {
+				return fmt.Errorf("database is encrypted: set KB_PASSPHRASE or KB_PASSPHRASE_COMMAND")
+			}
+			fmt.Fprint(os.Stderr, "Passphrase: ")
+			typed, err := term.ReadPassword(os.Stdin.Fd())
+			fmt.Fprintln(os.Stderr)
+			if err != nil {
+				return fmt.Errorf("read passphrase: %w", err)
+			}
+			passphrase = string(typed)
+		}
+		if err := s.UnlockDatabase(ctx, passphrase); err != nil {
+			return err
+		}
+	}
+	if passphrase == "" {
+		return nil
+	}
+	_, err = s.UnlockNotebooks(ctx, passphrase)
+	return err
+}
+
+// storedPassphrase returns KB_PASSPHRASE, else the output of
+// KB_PASSPHRASE_COMMAND, else ""
+func storedPassphrase() (string, error) {
+	if passphrase := os.Getenv("KB_PASSPHRASE"); passphrase != "" {
+		return passphrase, nil
+	}
+	command := os.Getenv("KB_PASSPHRASE_COMMAND")
+	if command == "" {
+		return "", nil
+	}
+	out, err := exec.Command("sh", "-c", command).Output()
+	if err != nil {
+		return "", fmt.Errorf("run KB_PASSPHRASE_COMMAND: %w", err)
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pbaille/kb/internal/mailer"
+	"github.com/pbaille/kb/internal/notify"
+	"github.com/pbaille/kb/internal/scheduler"
+	"github.com/pbaille/kb/internal/store"
+	"github.com/spf13/cobra"
+)
+
+// The cache-prune job evicts cached API results unused for cacheMaxAge,
+// and the least recently used beyond cacheMaxEntries of each kind
+const (
+	cacheMaxAge     = 90 * 24 * time.Hour
+	cacheMaxEntries = 20000
+)
+
+// newScheduler builds the scheduler with every periodic job registered
+func newScheduler(s *store.Store) *scheduler.Scheduler {
+	sc := scheduler.New(s)
+
+	sc.Register(scheduler.Job{
+		Name:      "db-optimize",
+		Interval:  24 * time.Hour,
+		Jitter:    time.Hour,
+		Run:       s.Optimize,
+		Exclusive: true,
+	})
+
+	sc.Register(scheduler.Job{
+		Name:     "tag-calibration",
+		Interval: 24 * time.Hour,
+		Jitter:   time.Hour,
+		Run: func(ctx context.Context) error {
+			_, err := s.RecomputeTagCalibration(ctx)
+			return err
+		},
+	})
+
+	sc.Register(scheduler.Job{
+		Name:     "scratch-expiry",
+		Interval: 6 * time.Hour,
+		Jitter:   30 * time.Minute,
+		Run: func(ctx context.Context) error {
+			_, err := s.DeleteExpiredEntries(ctx)
+			return err
+		},
+	})
+
+	sc.Register(scheduler.Job{
+		Name:     "trash-purge",
+		Interval: 24 * time.Hour,
+		Jitter:   time.Hour,
+		Run: func(ctx context.Context) error {
+			_, err := s.PurgeTrash(ctx, trashRetention)
+			return err
+		},
+	})
+
+	sc.Register(scheduler.Job{
+		Name:     "cache-prune",
+		Interval: 24 * time.Hour,
+		Jitter:   time.Hour,
+		Run: func(ctx context.Context) error {
+			_, err := s.PruneCache(ctx, cacheMaxAge, cacheMaxEntries)
+			return err
+		},
+	})
+
+	sc.Register(scheduler.Job{
+		Name:     "feed-poll",
+		Interval: feedPollInterval,
+		Jitter:   10 * time.Minute,
+		Run:      func(ctx context.Context) error { return syncFeeds(ctx, s) },
+	})
+
+	if cfg, err := notify.FromEnv(); err == nil {
+		sc.Register(scheduler.Job{
+			Name:     "reminders",
+			Interval: reminderCheckInterval,
+			Run:      func(ctx context.Context) error { return notifyReminders(ctx, s, cfg) },
+		})
+	}
+
+	_, mailErr := mailer.FromEnv()
+	if _, hasHook := digestWebhook(); mailErr == nil || hasHook {
+		sc.Register(scheduler.Job{
+			Name:     "weekly-report",
+			Interval: reportPeriod,
+			Jitter:   time.Hour,
+			Run:      func(ctx context.Context) error { return sendReport(ctx, s) },
+		})
+	}
+
+	return sc
+}
+
+func jobsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "jobs",
+		Short: "Inspect and run scheduled jobs",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "schedule",
+		Short: "Show last and next run times of scheduled jobs",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			schedules, err := newScheduler(s).Schedules(ctx)
+			if err != nil {
+				return err
+			}
+
+			for _, sch := range schedules {
+				last := "never"
+				if sch.State.LastRunAt != nil {
+					last = sch.State.LastRunAt.Format("2006-01-02 15:04")
+				}
+				next := "now"
+				if !sch.NextRun.IsZero() {
+					next = sch.NextRun.Format("2006-01-02 15:04")
+				}
+				fmt.Printf("%-20s last: %-16s  next: %s\n", sch.Job, last, next)
+				if sch.State.LastError != "" {
+					fmt.Printf("%-20s error: %s\n", "", sch.State.LastError)
+				}
+				if sch.State.LockOwner != "" {
+					fmt.Printf("%-20s locked by %s\n", "", sch.State.LockOwner)
+				}
+			}
+
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "leases",
+		Short: "Show leases currently held by running daemons",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			leases, err := s.ListLeases(ctx)
+			if err != nil {
+				return err
+			}
+
+			if len(leases) == 0 {
+				fmt.Println("No leases held.")
+				return nil
+			}
+
+			for _, l := range leases {
+				fmt.Printf("%-20s %s (since %s, expires %s)\n", l.Name, l.Owner,
+					l.AcquiredAt.Format("15:04:05"), l.ExpiresAt.Format("15:04:05"))
+			}
+
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "run [name]",
+		Short: "Run a scheduled job now",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			sc := newScheduler(s)
+			for _, job := range sc.Jobs() {
+				if job.Name != args[0] {
+					continue
+				}
+				ran, err := sc.RunJob(ctx, job)
+				if err != nil {
+					return err
+				}
+				if !ran {
+					fmt.Printf("%s is locked by another instance\n", job.Name)
+					return nil
+				}
+				fmt.Printf("Ran %s\n", job.Name)
+				return nil
+			}
+
+			return fmt.Errorf("unknown job: %s", args[0])
+		},
+	})
+
+	return cmd
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/store"
+	"github.com/spf13/cobra"
+)
+
+func linkCmd() *cobra.Command {
+	var kind string
+
+	cmd := &cobra.Command{
+		Use:   "link [id] [other-id]",
+		Short: "Link an entry to another",
+		Long: `Link an entry to another. The link says how the first entry relates to
+the second: it relates to it (the default), contradicts it or expands on
+it. kb show lists an entry's links, and the entries linking to it as
+backlinks.
+
+Linking two linked entries again replaces their link.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			if err := domain.CheckLinkKind(kind); err != nil {
+				return err
+			}
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			ids, err := resolveEntryIDs(ctx, s, args)
+			if err != nil {
+				return err
+			}
+			if err := s.SetEntryLink(ctx, ids[0], ids[1], kind); err != nil {
+				return err
+			}
+			fmt.Printf("%s %s %s\n", short(ids[0]), domain.LinkVerb(kind, false), short(ids[1]))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&kind, "kind", domain.LinkRelates, "kind of link: "+strings.Join(domain.LinkKinds, ", "))
+	return cmd
+}
+
+func unlinkCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "unlink [id] [other-id]",
+		Short: "Remove the link between two entries",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			ids, err := resolveEntryIDs(ctx, s, args)
+			if err != nil {
+				return err
+			}
+			if err := s.UnlinkEntries(ctx, ids[0], ids[1]); err != nil {
+				return err
+			}
+			fmt.Printf("Unlinked %s and %s\n", short(ids[0]), short(ids[1]))
+			return nil
+		},
+	}
+}
+
+func wikilinksCmd() *cobra.Command {
+	var stub bool
+
+	cmd := &cobra.Command{
+		Use:   "wikilinks",
+		Short: "List [[wiki-links]] no entry matches",
+		Long: `List the [[wiki-links]] in entry contents that no entry matches, with the
+entries using them. A wiki-link matches the entry it names by title, by
+first line (or first Markdown heading) or by ID prefix, and links to it
+when the entry is added or edited.
+
+With --stub, create an entry titled after each target and link the entries
+using it.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			links, err := s.UnresolvedWikiLinks(ctx)
+			if err != nil {
+				return err
+			}
+			if jsonOutput && !stub {
+				return printJSON(links)
+			}
+			if len(links) == 0 {
+				fmt.Println("No unresolved links")
+				return nil
+			}
+			for _, l := range links {
+				ids := make([]string, len(l.Entries))
+				for i, id := range l.Entries {
+					ids[i] = short(id)
+				}
+				if !stub {
+					fmt.Printf("[[%s]]  %s\n", l.Target, strings.Join(ids, ", "))
+					continue
+				}
+
+				entry, err := s.AddEntryWithSource(ctx, "# "+l.Target+"\n", domain.Source{Type: domain.SourceNote, Title: l.Target})
+				if err != nil {
+					return err
+				}
+				for _, id := range l.Entries {
+					linking, err := s.GetEntry(ctx, id)
+					if err != nil {
+						return err
+					}
+					if _, err := s.LinkWikiLinks(ctx, id, linking.Content); err != nil {
+						return err
+					}
+				}
+				fmt.Printf("Created %s for [[%s]], linked from %s\n", short(entry.ID), l.Target, strings.Join(ids, ", "))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&stub, "stub", false, "create an entry for each unresolved link")
+	return cmd
+}
+
+// linkWikiLinks links an entry to the entries its [[wiki-links]] name and
+// reports the ones none matches
+func linkWikiLinks(ctx context.Context, s *store.Store, id, content string) {
+	unresolved, err := s.LinkWikiLinks(ctx, id, content)
+	if err != nil {
+		fmt.Printf("(wiki-links skipped: %v)\n", err)
+		return
+	}
+	if len(unresolved) == 0 {
+		return
+	}
+	targets := make([]string, len(unresolved))
+	for i, t := range unresolved {
+		targets[i] = "[[" + t + "]]"
+	}
+	fmt.Printf("Unresolved links: %s (kb wikilinks --stub creates them)\n", strings.Join(targets, " "))
+}
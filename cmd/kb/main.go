@@ -1,185 +1,578 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/pbaille/kb/internal/api"
+	"github.com/pbaille/kb/internal/cache"
 	"github.com/pbaille/kb/internal/classifier"
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/export"
 	"github.com/pbaille/kb/internal/fetcher"
+	"github.com/pbaille/kb/internal/pipeline"
+	"github.com/pbaille/kb/internal/query"
+	"github.com/pbaille/kb/internal/rules"
 	"github.com/pbaille/kb/internal/store"
+	"github.com/pbaille/kb/internal/usage"
 	"github.com/spf13/cobra"
 )
 
 var dbPath string
 
+// slowQuery is the duration above which store statements are logged
+var slowQuery time.Duration
+
+// notebookName is the notebook commands work in, set with --notebook;
+// notebookSet is whether the flag was given
+var (
+	notebookName string
+	notebookSet  bool
+)
+
+// shortIDLen is how much of an ID to show, set once the store is open
+var shortIDLen = store.DefaultShortIDLength
+
 func main() {
-	// Default database location
+	// Default database location, or a postgres:// URL
 	home, _ := os.UserHomeDir()
 	defaultDB := filepath.Join(home, ".kb", "kb.db")
+	if v := os.Getenv("KB_DB"); v != "" {
+		defaultDB = v
+	}
 
 	rootCmd := &cobra.Command{
 		Use:   "kb",
 		Short: "Knowledge base with automatic tagging",
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			notebookSet = cmd.Flags().Changed("notebook")
+		},
 	}
 
-	rootCmd.PersistentFlags().StringVar(&dbPath, "db", defaultDB, "database path")
+	rootCmd.PersistentFlags().StringVar(&dbPath, "db", defaultDB, "database path, or postgres:// URL; KB_DB sets the default")
+	rootCmd.PersistentFlags().BoolVar(&jsonOutput, "json", false, "print JSON instead of text (add, list, show, tags, search)")
+	rootCmd.PersistentFlags().StringVar(&notebookName, "notebook", "", "notebook to work in, overriding 'kb notebook use' (\"\" for the whole database)")
+	rootCmd.PersistentFlags().DurationVar(&slowQuery, "slow-query", 0, "log database statements slower than this to stderr (0 logs none)")
 
+	rootCmd.AddCommand(initCmd())
 	rootCmd.AddCommand(addCmd())
 	rootCmd.AddCommand(listCmd())
 	rootCmd.AddCommand(showCmd())
+	rootCmd.AddCommand(randomCmd())
 	rootCmd.AddCommand(tagsCmd())
 	rootCmd.AddCommand(searchCmd())
 	rootCmd.AddCommand(serveCmd())
-
-	if err := rootCmd.Execute(); err != nil {
+	rootCmd.AddCommand(jobsCmd())
+	rootCmd.AddCommand(reviewCmd())
+	rootCmd.AddCommand(embedCmd())
+	rootCmd.AddCommand(reclassifyCmd())
+	rootCmd.AddCommand(reportCmd())
+	rootCmd.AddCommand(migrateCmd())
+	rootCmd.AddCommand(attachCmd())
+	rootCmd.AddCommand(exportCmd())
+	rootCmd.AddCommand(importCmd())
+	rootCmd.AddCommand(rulesCmd())
+	rootCmd.AddCommand(pretagCmd())
+	rootCmd.AddCommand(tagCmd())
+	rootCmd.AddCommand(statsCmd())
+	rootCmd.AddCommand(feedCmd())
+	rootCmd.AddCommand(tokenCmd())
+	rootCmd.AddCommand(userCmd())
+	rootCmd.AddCommand(scratchCmd())
+	rootCmd.AddCommand(keepCmd())
+	rootCmd.AddCommand(promoteCmd())
+	rootCmd.AddCommand(queryCmd())
+	rootCmd.AddCommand(tuiCmd())
+	rootCmd.AddCommand(diffEntriesCmd())
+	rootCmd.AddCommand(bulkCmd())
+	rootCmd.AddCommand(workflowCmd())
+	rootCmd.AddCommand(appendCmd())
+	rootCmd.AddCommand(templateCmd())
+	rootCmd.AddCommand(mergeCmd())
+	rootCmd.AddCommand(notebookCmd())
+	rootCmd.AddCommand(archiveCmd())
+	rootCmd.AddCommand(pinCmd())
+	rootCmd.AddCommand(unpinCmd())
+	rootCmd.AddCommand(readCmd())
+	rootCmd.AddCommand(deleteCmd())
+	rootCmd.AddCommand(restoreCmd())
+	rootCmd.AddCommand(trashCmd())
+	rootCmd.AddCommand(historyCmd())
+	rootCmd.AddCommand(revertCmd())
+	rootCmd.AddCommand(syncCmd())
+	rootCmd.AddCommand(collectionCmd())
+	rootCmd.AddCommand(linkCmd())
+	rootCmd.AddCommand(unlinkCmd())
+	rootCmd.AddCommand(wikilinksCmd())
+	rootCmd.AddCommand(graphCmd())
+	rootCmd.AddCommand(remindCmd())
+	rootCmd.AddCommand(dueCmd())
+	rootCmd.AddCommand(shareCmd())
+	rootCmd.AddCommand(mcpCmd())
+	rootCmd.AddCommand(askCmd())
+	rootCmd.AddCommand(digestCmd())
+	rootCmd.AddCommand(botCmd())
+
+	err := rootCmd.Execute()
+	// Webhooks fired by rules finish sending before kb exits
+	rules.WaitWebhooks()
+	if err != nil {
 		os.Exit(1)
 	}
 }
 
-func getStore() (*store.Store, error) {
+func getStore(ctx context.Context) (*store.Store, error) {
+	opts := store.DefaultStoreOptions()
+	opts.SlowQuery = slowQuery
 	// Ensure directory exists
 	dir := filepath.Dir(dbPath)
+	if store.IsPostgres(dbPath) {
+		dir = os.Getenv("KB_DATA_DIR")
+		if dir == "" {
+			home, _ := os.UserHomeDir()
+			dir = filepath.Join(home, ".kb")
+		}
+		opts.DataDir = dir
+	}
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return nil, fmt.Errorf("create db dir: %w", err)
 	}
-	return store.New(dbPath)
+	s, err := store.Open(dbPath, opts)
+	if err != nil {
+		return nil, err
+	}
+	usage.SetSink(s)
+	cache.SetStore(s)
+	if err := unlockStore(ctx, s); err != nil {
+		s.Close()
+		return nil, err
+	}
+	if shortIDLen, err = s.ShortIDLength(ctx); err != nil {
+		s.Close()
+		return nil, err
+	}
+	if err := useNotebook(ctx, s); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// indexVectors builds the store's vector index in the background, for
+// commands serving semantic search until interrupted
+func indexVectors(ctx context.Context, s *store.Store) {
+	go func() {
+		if err := s.IndexVectors(ctx); err != nil && ctx.Err() == nil {
+			slog.Warn("index vectors", "err", err)
+		}
+	}()
+}
+
+// useNotebook makes the store work in the notebook given with --notebook,
+// else the one chosen with 'kb notebook use'
+func useNotebook(ctx context.Context, s *store.Store) error {
+	name := notebookName
+	if !notebookSet {
+		current, err := s.CurrentNotebook(ctx)
+		if err != nil {
+			return err
+		}
+		name = current
+	}
+	if name == "" {
+		return nil
+	}
+	if _, err := s.GetNotebook(ctx, name); err != nil {
+		return err
+	}
+	s.SetNotebook(name)
+	return nil
+}
+
+// short abbreviates an ID for display
+func short(id string) string {
+	return domain.ShortID(id, shortIDLen)
 }
 
 func addCmd() *cobra.Command {
-	var noClassify bool
+	var noClassify, noRelated bool
+	var file, via, note string
+	var highlights []string
+	opts := fetcher.DefaultOptions()
 
 	cmd := &cobra.Command{
-		Use:   "add [content or URL]",
-		Short: "Add a new entry (supports URLs)",
-		Args:  cobra.MinimumNArgs(1),
-		RunE: func(cmd *cobra.Command, args []string) error {
-			input := strings.Join(args, " ")
+		Use:   "add [content or URL | -]",
+		Short: "Add a new entry (supports URLs, stdin and files)",
+		Long: `Add a new entry (supports URLs, stdin and files).
 
-			// Check if input is a URL
-			var content string
-			if fetcher.IsURL(input) {
-				fmt.Printf("Fetching URL: %s\n", input)
-				text, err := fetcher.Fetch(input)
-				if err != nil {
-					return fmt.Errorf("fetch URL: %w", err)
-				}
-				// Store URL + extracted text
-				content = fmt.Sprintf("[Source: %s]\n\n%s", input, text)
-				fmt.Printf("Extracted %d chars of text\n", len(text))
-			} else {
-				content = input
-			}
+Use "-" to read the content from stdin (e.g. git log | kb add -), or
+--file to ingest a file's content. Newlines are preserved.
 
-			s, err := getStore()
-			if err != nil {
-				return err
-			}
-			defer s.Close()
+Image files (screenshots, photos of whiteboards or book pages) are read
+with the vision model: the extracted text becomes the entry content and
+the image is kept as an attachment.
 
-			entry, err := s.AddEntry(content)
-			if err != nil {
-				return err
-			}
+PDF links and files are ingested as text, up to --max-pages pages and
+--max-chars characters.
 
-			fmt.Printf("Added entry: %s\n", entry.ID[:8])
-			fmt.Printf("Content: %s\n", truncate(entry.Content, 80))
+YouTube links are saved as the video's transcript, with the video title
+and channel as title and author.
 
-			// Classification
-			if noClassify {
-				fmt.Println("(skipped classification)")
-				return nil
+A fetched URL is laid out in sections: source details, your --note, the
+--highlight passages and the full text, as set by "kb template".
+
+A URL that was already saved (compared after dropping tracking parameters
+and other noise) isn't fetched again: the sighting is recorded on the
+existing entry, with --via naming where it was found.
+
+The entries most related to the new one are listed afterwards; at a
+terminal you can link the new entry to them.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if file != "" && len(args) > 0 {
+				return fmt.Errorf("--file cannot be combined with content arguments")
+			}
+			if file == "" && len(args) == 0 {
+				return fmt.Errorf("requires content, \"-\" for stdin, or --file")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			if jsonOutput {
+				defer humanToStderr()()
 			}
 
-			clf, err := classifier.New()
-			if err != nil {
-				fmt.Printf("(classification skipped: %v)\n", err)
-				return nil
+			var image *imageInput
+			var doc *fetcher.FetchResult
+			if file != "" {
+				var err error
+				if image, err = readImage(file); err != nil {
+					return err
+				}
+				if image == nil {
+					if doc, err = readPDF(file, opts); err != nil {
+						return err
+					}
+				}
 			}
 
-			// Get existing tags for context
-			existingTags, _ := s.ListTags()
-			tagNames := make([]string, len(existingTags))
-			for i, t := range existingTags {
-				tagNames[i] = t.Name
+			var input string
+			if doc != nil {
+				printExtracted(doc)
+				input = doc.Text
+			} else if image != nil {
+				text, err := image.transcribe(ctx)
+				if err != nil {
+					return fmt.Errorf("extract text: %w", err)
+				}
+				input = text
+			} else {
+				var err error
+				if input, err = readInput(args, file); err != nil {
+					return err
+				}
+			}
+			if input == "" {
+				return fmt.Errorf("no content to add")
 			}
 
-			fmt.Print("Classifying... ")
-			result, err := clf.Classify(content, tagNames)
+			source := domain.Source{Type: domain.SourceNote}
+			switch {
+			case image != nil:
+				source = domain.Source{Type: domain.SourceFile, Title: image.filename}
+			case doc != nil:
+				title := doc.Title
+				if title == "" {
+					title = filepath.Base(file)
+				}
+				source = domain.Source{Type: domain.SourceFile, Title: title, Author: doc.Author}
+			case file != "":
+				source = domain.Source{Type: domain.SourceFile, Title: filepath.Base(file)}
+			}
+
+			s, err := getStore(ctx)
 			if err != nil {
-				fmt.Printf("failed: %v\n", err)
-				return nil
+				return err
 			}
+			defer s.Close()
 
-			fmt.Printf("done\n")
+			// Check if input is a URL (single line only)
+			var content string
+			isURL := image == nil && fetcher.IsURL(input) && !strings.ContainsAny(input, " \n")
+			if isURL {
+				// The same article linked from several places is kept once
+				existing, err := s.FindEntryByURL(ctx, input)
+				if err != nil {
+					return err
+				}
+				if existing != nil {
+					if _, err := s.AddSourceOccurrence(ctx, existing.ID, via, input); err != nil {
+						return err
+					}
+					fmt.Printf("Already saved as %s (seen %d times)\n", short(existing.ID), len(existing.SeenVia)+1)
+					if jsonOutput {
+						return printEntryAs(ctx, s, "json", existing.ID)
+					}
+					return nil
+				}
 
-			// Create/link tags
-			for _, suggestion := range result.Tags {
-				var parentID *string
+				fmt.Printf("Fetching URL: %s\n", input)
+				page, err := fetcher.FetchWithOptions(ctx, input, opts)
+				if err != nil {
+					return fmt.Errorf("fetch URL: %w", err)
+				}
 
-				// Handle parent tag if specified
-				if suggestion.Parent != "" {
-					parentTag, err := s.GetOrCreateTag(suggestion.Parent, nil)
+				// The page may declare a canonical URL we've already saved
+				if canonical := fetcher.CanonicalURL(page.CanonicalURL); canonical != fetcher.CanonicalURL(input) {
+					existing, err := s.FindEntryByURL(ctx, canonical)
 					if err != nil {
-						fmt.Printf("  warning: couldn't create parent tag %s: %v\n", suggestion.Parent, err)
-					} else {
-						parentID = &parentTag.ID
+						return err
+					}
+					if existing != nil {
+						if _, err := s.AddSourceOccurrence(ctx, existing.ID, via, input); err != nil {
+							return err
+						}
+						fmt.Printf("Already saved as %s (seen %d times)\n", short(existing.ID), len(existing.SeenVia)+1)
+						if jsonOutput {
+							return printEntryAs(ctx, s, "json", existing.ID)
+						}
+						return nil
 					}
 				}
 
-				tag, err := s.GetOrCreateTag(suggestion.Name, parentID)
+				template, err := s.CaptureTemplate(ctx)
 				if err != nil {
-					fmt.Printf("  warning: couldn't create tag %s: %v\n", suggestion.Name, err)
-					continue
+					return err
 				}
+				now := time.Now()
+				capture := page.Capture()
+				capture.Note, capture.Highlights = note, highlights
+				content = capture.Render(template)
+				source = domain.Source{
+					Type:         domain.SourceURL,
+					URL:          input,
+					CanonicalURL: page.CanonicalURL,
+					Title:        page.Title,
+					Author:       page.Author,
+					FetchedAt:    &now,
+				}
+				printExtracted(page)
+			} else {
+				content = input
+			}
 
-				if err := s.LinkEntryTag(entry.ID, tag.ID, suggestion.Confidence); err != nil {
-					fmt.Printf("  warning: couldn't link tag %s: %v\n", suggestion.Name, err)
-					continue
+			entry, err := s.AddEntryWithSource(ctx, content, source)
+			if err != nil {
+				return err
+			}
+			if isURL {
+				if _, err := s.AddSourceOccurrence(ctx, entry.ID, via, input); err != nil {
+					return err
 				}
+			}
 
-				if suggestion.Parent != "" {
-					fmt.Printf("  + %s (under %s)\n", suggestion.Name, suggestion.Parent)
-				} else {
-					fmt.Printf("  + %s\n", suggestion.Name)
+			fmt.Printf("Added entry: %s\n", short(entry.ID))
+			fmt.Printf("Content: %s\n", truncate(entry.Content, 80))
+			linkWikiLinks(ctx, s, entry.ID, entry.Content)
+
+			if image != nil {
+				if err := image.attach(ctx, s, entry.ID); err != nil {
+					return fmt.Errorf("attach image: %w", err)
 				}
+				fmt.Printf("Attached %s\n", image.filename)
+			}
+
+			// Classification
+			if noClassify {
+				fmt.Println("(skipped classification)")
+			} else {
+				classifyEntry(ctx, s, entry.ID, content)
 			}
 
+			applyRules(ctx, s, entry.ID)
+
+			if !noRelated {
+				// Content piped on stdin leaves nothing to answer with
+				ask := isTerminal(os.Stdin) && !(len(args) == 1 && args[0] == "-") && !jsonOutput
+				showRelated(ctx, s, entry.ID, content, ask)
+			}
+			if jsonOutput {
+				return printEntryAs(ctx, s, "json", entry.ID)
+			}
 			return nil
 		},
 	}
 
 	cmd.Flags().BoolVar(&noClassify, "no-classify", false, "skip automatic classification")
+	cmd.Flags().BoolVar(&noRelated, "no-related", false, "don't look for related entries")
+	cmd.Flags().StringVarP(&file, "file", "f", "", "read content from a file")
+	cmd.Flags().StringVar(&via, "via", "kb add", "where a URL was found (e.g. a newsletter name)")
+	cmd.Flags().StringVar(&note, "note", "", "your note on a URL, kept in its own section")
+	cmd.Flags().StringArrayVar(&highlights, "highlight", nil, "a passage of a URL to keep as a highlight (repeatable)")
+	cmd.Flags().IntVar(&opts.MaxPages, "max-pages", opts.MaxPages, "maximum PDF pages to extract (0 for all)")
+	cmd.Flags().IntVar(&opts.MaxChars, "max-chars", opts.MaxChars, "maximum characters of text to keep")
 	return cmd
 }
 
+// readInput returns entry content from a file, stdin ("-") or the joined args
+func readInput(args []string, file string) (string, error) {
+	switch {
+	case file != "":
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("read file: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	case len(args) == 1 && args[0] == "-":
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("read stdin: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	default:
+		return strings.TrimSpace(strings.Join(args, " ")), nil
+	}
+}
+
+// classifyEntry runs the pre-taggers and the classifier on content and
+// links the resulting tags to an entry, reporting (but not failing on)
+// classifier errors
+func classifyEntry(ctx context.Context, s *store.Store, entryID, content string) {
+	fmt.Print("Classifying... ")
+	c, err := pipeline.Classify(ctx, s, entryID, content)
+	if err != nil {
+		fmt.Printf("failed: %v\n", err)
+	} else {
+		fmt.Printf("done\n")
+	}
+	if c == nil {
+		return
+	}
+	printTags(c.Tags)
+	for _, warning := range c.Warnings {
+		fmt.Printf("  warning: %s\n", warning)
+	}
+	if c.Title != "" {
+		fmt.Printf("Title: %s\n", c.Title)
+	}
+}
+
+// applyTags creates suggested tags (and their parents) and links them to an entry
+func applyTags(ctx context.Context, s *store.Store, entryID string, suggestions []classifier.TagSuggestion) {
+	linked, warnings := pipeline.ApplyTags(ctx, s, entryID, suggestions)
+	for _, warning := range warnings {
+		fmt.Printf("  warning: %s\n", warning)
+	}
+	printTags(linked)
+}
+
+// printTags lists tags linked by classification
+func printTags(tags []classifier.TagSuggestion) {
+	for _, t := range tags {
+		if t.Parent != "" {
+			fmt.Printf("  + %s (under %s)\n", t.Name, t.Parent)
+		} else {
+			fmt.Printf("  + %s\n", t.Name)
+		}
+	}
+}
+
 func listCmd() *cobra.Command {
 	var limit int
+	var maturity, format, scope, since, until, sortBy string
+	var reverse, unread bool
 
 	cmd := &cobra.Command{
 		Use:   "list",
 		Short: "List recent entries",
+		Long: `List entries, newest first, below the pinned ones (see kb pin).
+
+--since and --until take a day, 2024-06-01, both inclusive, or how long
+ago, 30d, 2w or 12h. --sort viewed lists the most recently viewed first,
+entries never viewed last; --sort random shuffles them.
+
+  kb list --since 2024-06-01 --until 2024-06-30
+  kb list --sort viewed --reverse -n 10
+  kb list --unread                  (the reading queue, see kb read)`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			s, err := getStore()
+			ctx := cmd.Context()
+			format, err := entryFormat(format)
+			if err != nil {
+				return err
+			}
+			if err := store.CheckScope(scope); err != nil {
+				return err
+			}
+			if maturity != "" {
+				if err := checkMaturity(maturity); err != nil {
+					return err
+				}
+			}
+			opts := domain.ListOptions{Scope: scope, Maturity: maturity, Sort: sortBy, Reverse: reverse, Limit: limit}
+			if unread {
+				opts.Unread = &unread
+			}
+			now := time.Now()
+			if since != "" {
+				if opts.Since, err = query.ParseDate(since, now, false); err != nil {
+					return fmt.Errorf("--since: %w", err)
+				}
+			}
+			if until != "" {
+				if opts.Until, err = query.ParseDate(until, now, true); err != nil {
+					return fmt.Errorf("--until: %w", err)
+				}
+			}
+
+			s, err := getStore(ctx)
 			if err != nil {
 				return err
 			}
 			defer s.Close()
 
-			entries, err := s.ListEntries(limit, 0)
+			entries, err := s.ListEntriesSorted(ctx, opts)
 			if err != nil {
 				return err
 			}
+			if format != "" {
+				return printEntriesAs(ctx, s, format, entries)
+			}
+
+			// Pinned entries head the whole list of active entries
+			var pinned []domain.Entry
+			if scope == domain.ScopeActive && !opts.Filtered() {
+				if pinned, err = s.PinnedEntries(ctx); err != nil {
+					return err
+				}
+			}
+			if len(pinned) > 0 {
+				fmt.Println("Pinned:")
+				for _, e := range pinned {
+					fmt.Printf("%s  %s%s\n", short(e.ID), truncate(e.DisplayTitle(), 60), scratchMark(&e))
+				}
+				fmt.Println()
+			}
 
 			if len(entries) == 0 {
+				if opts.Filtered() {
+					fmt.Println("No matching entries.")
+					return nil
+				}
 				fmt.Println("No entries yet. Use 'kb add' to create one.")
 				return nil
 			}
 
 			for _, e := range entries {
-				fmt.Printf("%s  %s\n", e.ID[:8], truncate(e.Content, 60))
+				fmt.Printf("%s  %s%s\n", short(e.ID), truncate(e.DisplayTitle(), 60), scratchMark(&e))
 			}
 
 			return nil
@@ -187,130 +580,283 @@ func listCmd() *cobra.Command {
 	}
 
 	cmd.Flags().IntVarP(&limit, "limit", "n", 20, "number of entries to show")
+	cmd.Flags().StringVar(&maturity, "maturity", "", "only show fleeting, literature or evergreen entries")
+	cmd.Flags().StringVar(&format, "format", "text", "output format: text, json, yaml, markdown or org")
+	cmd.Flags().StringVar(&scope, "scope", domain.ScopeActive, "entries to list: active, archived, trash or all")
+	cmd.Flags().StringVar(&since, "since", "", "only show entries created on or after a day, or in the last 30d")
+	cmd.Flags().StringVar(&until, "until", "", "only show entries created on or before a day, or before 30d ago")
+	cmd.Flags().StringVar(&sortBy, "sort", domain.SortCreated, "order: created, viewed or random")
+	cmd.Flags().BoolVar(&reverse, "reverse", false, "oldest or least recently viewed first")
+	cmd.Flags().BoolVar(&unread, "unread", false, "only show entries waiting to be read")
 	return cmd
 }
 
 func showCmd() *cobra.Command {
-	return &cobra.Command{
+	var format string
+
+	cmd := &cobra.Command{
 		Use:   "show [id]",
 		Short: "Show entry details",
-		Args:  cobra.ExactArgs(1),
+		Long: `Show entry details.
+
+With --format, the entry is printed as JSON, YAML, Markdown or Org, e.g.
+kb show <id> --format markdown | glow`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			s, err := getStore()
+			ctx := cmd.Context()
+			format, err := entryFormat(format)
 			if err != nil {
 				return err
 			}
-			defer s.Close()
 
-			// Find entry by prefix
-			entries, err := s.ListEntries(100, 0)
+			s, err := getStore(ctx)
 			if err != nil {
 				return err
 			}
+			defer s.Close()
 
-			var found *string
-			for _, e := range entries {
-				if strings.HasPrefix(e.ID, args[0]) {
-					found = &e.ID
-					break
-				}
+			id, err := resolveEntryID(ctx, s, args[0])
+			if err != nil {
+				return err
 			}
 
-			if found == nil {
-				return fmt.Errorf("entry not found: %s", args[0])
+			entry, err := s.GetEntry(ctx, id)
+			if err != nil {
+				return err
 			}
 
-			entry, err := s.GetEntry(*found)
+			if format != "" {
+				err = export.WriteEntry(os.Stdout, format, entry)
+			} else {
+				printEntry(entry)
+			}
 			if err != nil {
 				return err
 			}
 
-			fmt.Printf("ID:      %s\n", entry.ID)
-			fmt.Printf("Created: %s\n", entry.CreatedAt.Format("2006-01-02 15:04:05"))
-			fmt.Printf("Content:\n%s\n", entry.Content)
+			return s.MarkViewed(ctx, entry.ID)
+		},
+	}
 
-			if len(entry.Tags) > 0 {
-				fmt.Printf("\nTags:\n")
-				for _, t := range entry.Tags {
-					fmt.Printf("  - %s\n", t.Name)
-				}
+	cmd.Flags().StringVar(&format, "format", "text", "output format: text, json, yaml, markdown or org")
+	return cmd
+}
+
+// resolveEntryID finds the full ID of an entry from an ID prefix
+func resolveEntryID(ctx context.Context, s *store.Store, prefix string) (string, error) {
+	id, err := s.ResolveID(ctx, prefix)
+	if errors.Is(err, store.ErrEntryNotFound) {
+		return "", fmt.Errorf("entry not found: %s", prefix)
+	}
+	return id, err
+}
+
+func printEntry(entry *domain.Entry) {
+	fmt.Printf("ID:      %s\n", entry.ID)
+	fmt.Printf("Created: %s\n", entry.CreatedAt.Format("2006-01-02 15:04:05"))
+	if entry.LastViewedAt != nil {
+		fmt.Printf("Viewed:  %s\n", entry.LastViewedAt.Format("2006-01-02 15:04:05"))
+	}
+	if entry.PinnedAt != nil {
+		fmt.Printf("Pinned:  %s\n", entry.PinnedAt.Format("2006-01-02 15:04:05"))
+	}
+	if entry.UnreadSince != nil {
+		fmt.Printf("Unread:  since %s\n", entry.UnreadSince.Format("2006-01-02 15:04:05"))
+	}
+	if entry.ArchivedAt != nil {
+		fmt.Printf("Archived: %s\n", entry.ArchivedAt.Format("2006-01-02 15:04:05"))
+	}
+	if entry.DeletedAt != nil {
+		fmt.Printf("Deleted: %s (in the trash)\n", entry.DeletedAt.Format("2006-01-02 15:04:05"))
+	}
+	if entry.Source.Title != "" {
+		fmt.Printf("Title:   %s\n", entry.Source.Title)
+	}
+	if entry.Source.Author != "" {
+		fmt.Printf("Author:  %s\n", entry.Source.Author)
+	}
+	fmt.Printf("Source:  %s\n", entry.Source.Type)
+	fmt.Printf("Stage:   %s\n", entry.Maturity)
+	if entry.Notebook != "" {
+		fmt.Printf("Notebook: %s\n", entry.Notebook)
+	}
+	for _, w := range entry.Workflows {
+		fmt.Printf("%-8s %s\n", w.Workflow+":", w.State)
+	}
+	if entry.Source.URL != "" {
+		fmt.Printf("URL:     %s\n", entry.Source.URL)
+	}
+	if r := entry.Reminder; r != nil {
+		fmt.Printf("Remind:  %s", r.RemindAt.Local().Format("2006-01-02 15:04"))
+		if r.Note != "" {
+			fmt.Printf(" (%s)", r.Note)
+		}
+		fmt.Println()
+	}
+	if entry.Locked {
+		fmt.Printf("Content: (encrypted; set KB_PASSPHRASE to read it)\n")
+	} else if len(entry.Sections) == 0 {
+		fmt.Printf("Content:\n%s\n", entry.Content)
+	}
+	for _, section := range entry.Sections {
+		if section.Heading != "" {
+			fmt.Printf("\n%s:\n", section.Heading)
+		}
+		fmt.Println(section.Text)
+	}
+
+	if len(entry.Tags) > 0 {
+		fmt.Printf("\nTags:\n")
+		for _, t := range entry.Tags {
+			fmt.Printf("  - %s\n", t.Path)
+		}
+	}
+
+	if len(entry.Attachments) > 0 {
+		fmt.Printf("\nAttachments:\n")
+		for _, a := range entry.Attachments {
+			fmt.Printf("  - %s (%s, %d bytes)\n", a.Filename, a.MIMEType, a.Size)
+		}
+	}
+
+	if len(entry.Links) > 0 {
+		fmt.Printf("\nLinks:\n")
+		for _, l := range entry.Links {
+			fmt.Printf("  - %s %s  %s\n", domain.LinkVerb(l.Kind, false), short(l.EntryID), truncate(l.Title, 60))
+		}
+	}
+
+	if len(entry.Backlinks) > 0 {
+		fmt.Printf("\nBacklinks:\n")
+		for _, l := range entry.Backlinks {
+			fmt.Printf("  - %s %s  %s\n", domain.LinkVerb(l.Kind, true), short(l.EntryID), truncate(l.Title, 60))
+		}
+	}
+
+	if len(entry.Merged) > 0 {
+		fmt.Printf("\nMerged:\n")
+		for _, m := range entry.Merged {
+			line := fmt.Sprintf("  - %s  created %s", short(m.ID), m.CreatedAt.Format("2006-01-02"))
+			if m.Title != "" {
+				line += "  " + truncate(m.Title, 60)
 			}
+			fmt.Println(line)
+		}
+	}
 
-			return nil
-		},
+	if len(entry.SeenVia) > 0 {
+		fmt.Printf("\nSeen via:\n")
+		for _, o := range entry.SeenVia {
+			fmt.Printf("  - %s  %s (%s)\n", o.SeenAt.Format("2006-01-02"), o.Via, o.URL)
+		}
 	}
 }
 
 func tagsCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "tags",
 		Short: "List all tags",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			s, err := getStore()
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
 			if err != nil {
 				return err
 			}
 			defer s.Close()
 
-			tags, err := s.ListTags()
+			tags, err := s.ListTags(ctx)
 			if err != nil {
 				return err
 			}
+			if jsonOutput {
+				if tags == nil {
+					tags = []domain.Tag{}
+				}
+				return printJSON(tags)
+			}
 
 			if len(tags) == 0 {
 				fmt.Println("No tags yet. Tags emerge from entry classification.")
 				return nil
 			}
 
-			// Build hierarchy map
-			children := make(map[string][]string)
-			roots := []string{}
-			tagMap := make(map[string]string) // id -> name
-
-			for _, t := range tags {
-				tagMap[t.ID] = t.Name
-				if t.ParentID == nil {
-					roots = append(roots, t.ID)
-				} else {
-					children[*t.ParentID] = append(children[*t.ParentID], t.ID)
-				}
-			}
+			roots, children, cyclic := domain.TagTree(tags)
 
 			// Print tree
-			var printTree func(id string, indent int)
-			printTree = func(id string, indent int) {
+			var printTree func(t domain.Tag, indent int)
+			printTree = func(t domain.Tag, indent int) {
 				prefix := strings.Repeat("  ", indent)
-				fmt.Printf("%s%s\n", prefix, tagMap[id])
-				for _, childID := range children[id] {
-					printTree(childID, indent+1)
+				if t.Description != "" {
+					fmt.Printf("%s%s  %s\n", prefix, t.Name, t.Description)
+				} else {
+					fmt.Printf("%s%s\n", prefix, t.Name)
+				}
+				if indent == domain.MaxTagDepth {
+					return
+				}
+				for _, child := range children[t.ID] {
+					printTree(child, indent+1)
 				}
 			}
 
-			for _, rootID := range roots {
-				printTree(rootID, 0)
+			for _, root := range roots {
+				printTree(root, 0)
 			}
 
+			if len(cyclic) > 0 {
+				names := make([]string, len(cyclic))
+				for i, t := range cyclic {
+					names[i] = t.Name
+				}
+				fmt.Printf("\nIn a parent cycle, fix with kb tags audit: %s\n", strings.Join(names, ", "))
+			}
 			return nil
 		},
 	}
+
+	cmd.AddCommand(tagsAuditCmd())
+	return cmd
 }
 
 func searchCmd() *cobra.Command {
-	return &cobra.Command{
+	var scratch bool
+	var scope string
+
+	cmd := &cobra.Command{
 		Use:   "search [query]",
 		Short: "Search entries",
-		Args:  cobra.ExactArgs(1),
+		Long: `Search entries, newest first. Entries must contain all the words and
+"quoted phrases" of the query, in their content or title; terms combine
+with OR, NOT (or a leading -) and parentheses, and filter by field:
+
+  tag:golang          tagged golang or a tag under it (name, alias or path)
+  before:2024-06-01   created before that day
+  after:2024-06-01    created after that day; after:30d in the last 30 days
+  source:url          captured from a URL (or note, file, clip, email)
+  source:example.com  captured from a URL containing the text
+
+  kb search 'golang (channels OR "worker pool") -tutorial'
+  kb search 'tag:reading after:2w source:url'
+  kb search -- '-draft meeting'     (-- before a query starting with -)`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			s, err := getStore()
+			ctx := cmd.Context()
+			if err := store.CheckScope(scope); err != nil {
+				return err
+			}
+			s, err := getStore(ctx)
 			if err != nil {
 				return err
 			}
 			defer s.Close()
 
-			entries, err := s.SearchEntries(args[0])
+			entries, err := s.SearchEntries(ctx, args[0], scope, scratch)
 			if err != nil {
 				return err
 			}
+			if jsonOutput {
+				return printEntriesAs(ctx, s, "json", entries)
+			}
 
 			if len(entries) == 0 {
 				fmt.Println("No matching entries found.")
@@ -318,12 +864,16 @@ func searchCmd() *cobra.Command {
 			}
 
 			for _, e := range entries {
-				fmt.Printf("%s  %s\n", e.ID[:8], truncate(e.Content, 60))
+				fmt.Printf("%s  %s%s\n", short(e.ID), truncate(e.DisplayTitle(), 60), scratchMark(&e))
 			}
 
 			return nil
 		},
 	}
+
+	cmd.Flags().BoolVar(&scratch, "scratch", false, "include scratch entries")
+	cmd.Flags().StringVar(&scope, "scope", domain.ScopeActive, "entries to search: active, archived, trash or all")
+	return cmd
 }
 
 func truncate(s string, max int) string {
@@ -336,23 +886,109 @@ func truncate(s string, max int) string {
 }
 
 func serveCmd() *cobra.Command {
-	var addr string
+	opts := api.DefaultOptions()
+	var logFormat string
 
 	cmd := &cobra.Command{
 		Use:   "serve",
 		Short: "Start the REST API server",
+		Long: `Start the REST API server and the background job scheduler. The web
+UI is served at /, if it was built (go generate ./web) before kb.
+
+HTTPS is served with --cert and --key, or with certificates obtained from
+Let's Encrypt for the --autocert domains (listen on :443 for that).
+SIGINT or SIGTERM stop the server gracefully: in-flight requests and any
+running job finish before the database is closed.
+
+Every request must carry an API token (see kb token). For local use
+without one, --no-auth opens the API on a loopback --addr such as
+127.0.0.1:8080, until the first token is created.
+
+Requests are logged to stderr, and Prometheus metrics are served at
+/metrics, including database statement timings and errors per store
+method. With --slow-query, statements slower than the threshold are
+logged too.
+
+Every route is also served under /nb/{notebook}/, working in that
+notebook and its sub-notebooks: /nb/work/entries lists and adds
+entries in work. Without a prefix, the server works in the --notebook
+given, else in the whole database.
+
+Captures received by the API are written to journal.jsonl next to the
+database before being processed; captures a crash or failure left
+unfinished are completed at the next start.
+
+When --max-processing captures are already being classified, POST
+/entries stores new ones and answers 202 with a job to poll at
+/jobs/{id}, processing them in the background.
+
+Analytics (/stats, /stats/timeseries, /tags/quality, /tags/activity)
+read a snapshot of the database, copied next to it and shared until it
+is older than --snapshot-max-age, so their long reads never hold up
+captures and edits. Their results can lag that much behind.
+
+Semantic search (related entries, /ask) searches an index of the
+embeddings built in the background at startup; until it's ready, it
+compares the query to every embedding.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			s, err := getStore()
+			switch logFormat {
+			case "text":
+				opts.Logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+			case "json":
+				opts.Logger = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+			default:
+				return fmt.Errorf("unknown log format %q (want text or json)", logFormat)
+			}
+			// Slow store statements are logged with the requests
+			slog.SetDefault(opts.Logger)
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			s, err := getStore(ctx)
 			if err != nil {
 				return err
 			}
-			// Note: don't defer s.Close() as server runs indefinitely
+			defer s.Close()
+			// The server covers the whole database unless given --notebook;
+			// other notebooks are served under /nb/{name}/
+			if !notebookSet {
+				s.SetNotebook("")
+			}
+			indexVectors(ctx, s)
+
+			if len(opts.AutocertDomains) > 0 && opts.AutocertCache == "" {
+				opts.AutocertCache = filepath.Join(s.Dir(), "autocert")
+			}
+
+			jobsDone := make(chan struct{})
+			go func() {
+				newScheduler(s).Run(ctx)
+				close(jobsDone)
+			}()
+
+			server := api.NewWithOptions(s, opts)
+			err = server.Run(ctx)
 
-			server := api.New(s, addr)
-			return server.Run()
+			// Let a running job finish before the store is closed
+			stop()
+			<-jobsDone
+			return err
 		},
 	}
 
-	cmd.Flags().StringVarP(&addr, "addr", "a", ":8080", "server address")
+	cmd.Flags().StringVarP(&opts.Addr, "addr", "a", opts.Addr, "server address")
+	cmd.Flags().StringSliceVar(&opts.AllowedOrigins, "cors-origin", opts.AllowedOrigins, "browser origins allowed to call the API (repeatable, * for any)")
+	cmd.Flags().StringVar(&opts.CertFile, "cert", "", "TLS certificate file")
+	cmd.Flags().StringVar(&opts.KeyFile, "key", "", "TLS private key file")
+	cmd.Flags().StringSliceVar(&opts.AutocertDomains, "autocert", nil, "domain to get a Let's Encrypt certificate for (repeatable)")
+	cmd.Flags().StringVar(&opts.AutocertCache, "autocert-cache", "", "directory caching certificates (default: autocert/ next to the database)")
+	cmd.Flags().DurationVar(&opts.ReadTimeout, "read-timeout", opts.ReadTimeout, "maximum time to read a request")
+	cmd.Flags().DurationVar(&opts.WriteTimeout, "write-timeout", opts.WriteTimeout, "maximum time to write a response")
+	cmd.Flags().IntVar(&opts.MaxProcessing, "max-processing", opts.MaxProcessing, "captures processed at once before new ones are queued (202)")
+	cmd.Flags().IntVar(&opts.MaxQueued, "max-queued", opts.MaxQueued, "queued captures before new ones are refused (503)")
+	cmd.Flags().DurationVar(&opts.SnapshotMaxAge, "snapshot-max-age", opts.SnapshotMaxAge, "how stale the database snapshot analytics read can get (0 reads the live database)")
+	cmd.Flags().BoolVar(&opts.NoAuth, "no-auth", false, "serve requests without a token, on a loopback address and until a token is created")
+	cmd.Flags().StringVar(&logFormat, "log-format", "text", "request log format: text or json")
 	return cmd
 }
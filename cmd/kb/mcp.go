@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+
+	"github.com/pbaille/kb/internal/mcp"
+	"github.com/spf13/cobra"
+)
+
+func mcpCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "mcp",
+		Short: "Serve the knowledge base to MCP clients over stdio",
+		Long: `Serve the knowledge base as Model Context Protocol tools over stdin and
+stdout, for Claude Desktop and other MCP clients to read and write it:
+search, add_entry, get_entry, list_tags and find_similar.
+
+Clients start kb mcp themselves. For Claude Desktop, add to
+claude_desktop_config.json:
+
+  {"mcpServers": {"kb": {"command": "kb", "args": ["mcp"]}}}
+
+add --db or --notebook to the args to serve another database or only a
+notebook. Entries are tagged and embedded as with kb add, given the
+ANTHROPIC_API_KEY and VOYAGE_API_KEY environment variables.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+			indexVectors(ctx, s)
+
+			return mcp.New(s).Serve(ctx, os.Stdin, os.Stdout)
+		},
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/spf13/cobra"
+)
+
+func mergeCmd() *cobra.Command {
+	var link, yes bool
+
+	cmd := &cobra.Command{
+		Use:   "merge [id] [id...]",
+		Short: "Merge duplicate entries into the first one",
+		Long: `Merge duplicate entries into the first one.
+
+The other entries' contents are added after the first's, their tags,
+attachments, sightings, reviews, links and workflow states move over, and
+they are deleted. Their creation dates stay in the merged entry's history,
+and their URLs keep finding it.
+
+With --link, nothing is deleted: the entries are linked to the first one
+and all get the union of their tags.`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			if jsonOutput {
+				defer humanToStderr()()
+			}
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			var ids []string
+			for _, arg := range args {
+				id, err := resolveEntryID(ctx, s, arg)
+				if err != nil {
+					return err
+				}
+				if slices.Contains(ids, id) {
+					return fmt.Errorf("entry %s appears twice", short(id))
+				}
+				ids = append(ids, id)
+			}
+
+			if link {
+				entry, err := s.LinkDuplicates(ctx, ids[0], ids[1:])
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Linked %d entries to %s\n", len(ids)-1, short(entry.ID))
+			} else {
+				if !yes {
+					for _, id := range ids[1:] {
+						e, err := s.GetEntry(ctx, id)
+						if err != nil {
+							return err
+						}
+						fmt.Printf("  %s  %s\n", short(id), truncate(e.DisplayTitle(), 60))
+					}
+					reader := bufio.NewReader(os.Stdin)
+					if !confirm(reader, fmt.Sprintf("Merge these into %s and delete them?", short(ids[0]))) {
+						return nil
+					}
+				}
+				entry, err := s.MergeEntries(ctx, ids[0], ids[1:])
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Merged %d entries into %s (revision %d)\n", len(ids)-1, short(entry.ID), entry.Revision)
+				embedEntry(ctx, s, entry.ID, entry.Content)
+			}
+
+			if jsonOutput {
+				return printEntryAs(ctx, s, "json", ids[0])
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&link, "link", false, "link the entries instead of merging them")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "don't ask for confirmation")
+	return cmd
+}
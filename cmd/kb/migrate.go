@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func migrateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Inspect database schema migrations",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "Show the schema version and applied migrations",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			// Opening the store applies any pending migrations
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			version, err := s.SchemaVersion(ctx)
+			if err != nil {
+				return err
+			}
+			migrations, err := s.MigrationStatus(ctx)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Schema version: %d\n\n", version)
+			for _, m := range migrations {
+				applied := "pending"
+				if m.AppliedAt != nil {
+					applied = m.AppliedAt.Format("2006-01-02 15:04:05")
+				}
+				fmt.Printf("%04d  %-30s %s\n", m.Version, m.Name, applied)
+			}
+			return nil
+		},
+	})
+
+	return cmd
+}
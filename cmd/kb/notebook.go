@@ -0,0 +1,309 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/spf13/cobra"
+)
+
+func notebookCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "notebook",
+		Short: "Group entries in nested notebooks, optionally encrypted",
+		Long: `Group entries in nested notebooks, optionally encrypted.
+
+A notebook created with --encrypt has its own key, derived from a
+passphrase: the content of its entries, and of entries in its
+sub-notebooks, is stored encrypted while the rest of the database stays
+plaintext. Titles, source URLs, tags and embeddings are not encrypted:
+titles are only hidden while the notebook is locked, and the rest shows.
+Encrypted content is only matched by text searches once unlocked.
+
+Encrypted notebooks are unlocked with the passphrase in KB_PASSPHRASE
+or KB_PASSPHRASE_COMMAND; without it, their entries show no content and
+can't be written to. kb init --encrypted encrypts the whole database.
+
+Commands can work in one notebook, keeping separate knowledge bases in
+one database: kb notebook use picks the notebook every command works in
+until cleared, and --notebook overrides it for one command. Lists,
+searches, reviews and entry counts then only cover the entries of that
+notebook and its sub-notebooks, and new entries are added to it.
+
+  kb notebook create work
+  kb notebook create hr --parent work --encrypt
+  kb --notebook hr add "..."
+  kb notebook use work
+  kb notebook move <id> work`,
+	}
+
+	var parent string
+	var encrypt bool
+	create := &cobra.Command{
+		Use:   "create [name]",
+		Short: "Create a notebook",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			var passphrase string
+			if encrypt {
+				var err error
+				if passphrase, err = newPassphrase(); err != nil {
+					return err
+				}
+			}
+
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			nb := &domain.Notebook{Name: args[0], Parent: parent}
+			if err := s.AddNotebook(ctx, nb, passphrase); err != nil {
+				return err
+			}
+			switch {
+			case encrypt:
+				fmt.Printf("Created encrypted notebook %s\n", nb.Name)
+			case parent != "":
+				fmt.Printf("Created notebook %s in %s\n", nb.Name, parent)
+			default:
+				fmt.Printf("Created notebook %s\n", nb.Name)
+			}
+			return nil
+		},
+	}
+	create.Flags().StringVar(&parent, "parent", "", "notebook to create it in")
+	create.Flags().BoolVar(&encrypt, "encrypt", false, "give the notebook its own key (asks for a passphrase unless KB_PASSPHRASE is set)")
+	cmd.AddCommand(create)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List notebooks as a tree",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			notebooks, err := s.ListNotebooks(ctx)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				return printJSON(notebooks)
+			}
+			if len(notebooks) == 0 {
+				fmt.Println("No notebooks yet. Use 'kb notebook create' to add one.")
+				return nil
+			}
+			printNotebooks(notebooks, s.Notebook(ctx), "", 0)
+			return nil
+		},
+	})
+
+	var clear bool
+	use := &cobra.Command{
+		Use:   "use [name]",
+		Short: "Pick the notebook commands work in, or show it",
+		Long: `Pick the notebook commands work in, until cleared with --clear;
+--notebook overrides it for one command. Without a name, the current
+notebook is shown.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			switch {
+			case clear:
+				if err := s.UseNotebook(ctx, ""); err != nil {
+					return err
+				}
+				fmt.Println("Commands now work in the whole database")
+			case len(args) == 1:
+				if err := s.UseNotebook(ctx, args[0]); err != nil {
+					return err
+				}
+				fmt.Printf("Commands now work in notebook %s\n", args[0])
+			default:
+				current, err := s.CurrentNotebook(ctx)
+				if err != nil {
+					return err
+				}
+				if current == "" {
+					fmt.Println("No current notebook: commands work in the whole database")
+				} else {
+					fmt.Println(current)
+				}
+			}
+			return nil
+		},
+	}
+	use.Flags().BoolVar(&clear, "clear", false, "work in the whole database again")
+	cmd.AddCommand(use)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "rm [name]",
+		Short: "Delete an empty notebook",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			if err := s.DeleteNotebook(ctx, args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("Deleted notebook %s\n", args[0])
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "move [id] [notebook]",
+		Short: "Move an entry to a notebook, or out of its notebook without one",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			id, err := resolveEntryID(ctx, s, args[0])
+			if err != nil {
+				return err
+			}
+			notebook := ""
+			if len(args) > 1 {
+				notebook = args[1]
+			}
+			if _, err := s.SetEntryNotebook(ctx, id, notebook); err != nil {
+				return err
+			}
+			if notebook == "" {
+				fmt.Printf("%s is in no notebook\n", short(id))
+			} else {
+				fmt.Printf("Moved %s to %s\n", short(id), notebook)
+			}
+			return nil
+		},
+	})
+
+	var limit int
+	var format string
+	entries := &cobra.Command{
+		Use:   "entries [name]",
+		Short: "List the entries of a notebook and its sub-notebooks",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			format, err := entryFormat(format)
+			if err != nil {
+				return err
+			}
+
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			if _, err := s.GetNotebook(ctx, args[0]); err != nil {
+				return err
+			}
+			list, err := s.FilterEntries(ctx, domain.EntryFilter{Notebook: args[0], Limit: limit})
+			if err != nil {
+				return err
+			}
+			if format != "" {
+				return printEntriesAs(ctx, s, format, list)
+			}
+			if len(list) == 0 {
+				fmt.Printf("No entries in %s.\n", args[0])
+				return nil
+			}
+			for _, e := range list {
+				fmt.Printf("%s  %s\n", short(e.ID), truncate(e.DisplayTitle(), 60))
+			}
+			return nil
+		},
+	}
+	entries.Flags().IntVarP(&limit, "limit", "n", 20, "number of entries to show")
+	entries.Flags().StringVar(&format, "format", "text", "output format: text, json, yaml, markdown or org")
+	cmd.AddCommand(entries)
+
+	return cmd
+}
+
+// printNotebooks prints the notebooks under parent, indented by depth,
+// marking the current one
+func printNotebooks(notebooks []domain.Notebook, current, parent string, depth int) {
+	for _, nb := range notebooks {
+		if nb.Parent != parent {
+			continue
+		}
+		var marks []string
+		if nb.Encrypted {
+			marks = append(marks, "encrypted")
+		} else if nb.KeyFrom != "" {
+			marks = append(marks, "encrypted by "+nb.KeyFrom)
+		}
+		if nb.Locked {
+			marks = append(marks, "locked")
+		}
+		if nb.Name == current {
+			marks = append(marks, "current")
+		}
+		line := fmt.Sprintf("%s%s (%d)", strings.Repeat("  ", depth), nb.Name, nb.Entries)
+		if len(marks) > 0 {
+			line += "  [" + strings.Join(marks, ", ") + "]"
+		}
+		fmt.Println(line)
+		printNotebooks(notebooks, current, nb.Name, depth+1)
+	}
+}
+
+// newPassphrase returns the stored passphrase, or asks for one twice
+func newPassphrase() (string, error) {
+	if passphrase, err := storedPassphrase(); passphrase != "" || err != nil {
+		return passphrase, err
+	}
+	if !isTerminal(os.Stdin) {
+		return "", fmt.Errorf("set KB_PASSPHRASE or run at a terminal to enter a passphrase")
+	}
+
+	fmt.Print("Passphrase: ")
+	first, err := term.ReadPassword(os.Stdin.Fd())
+	fmt.Println()
+	if err != nil {
+		return "", fmt.Errorf("read passphrase: %w", err)
+	}
+	if len(first) == 0 {
+		return "", fmt.Errorf("empty passphrase")
+	}
+	fmt.Print("Again: ")
+	second, err := term.ReadPassword(os.Stdin.Fd())
+	fmt.Println()
+	if err != nil {
+		return "", fmt.Errorf("read passphrase: %w", err)
+	}
+	if string(first) != string(second) {
+		return "", fmt.Errorf("passphrases don't match")
+	}
+	return string(first), nil
+}
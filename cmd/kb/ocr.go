@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pbaille/kb/internal/blobs"
+	"github.com/pbaille/kb/internal/classifier"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// imageInput is an image file whose transcribed text becomes the entry content
+type imageInput struct {
+	filename string
+	mimeType string
+	data     []byte
+}
+
+// readImage returns the file as an image input, or nil if it isn't an image
+func readImage(file string) (*imageInput, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+	mimeType := blobs.DetectMIME(file, data)
+	if !blobs.IsImage(mimeType) {
+		return nil, nil
+	}
+	return &imageInput{filename: filepath.Base(file), mimeType: mimeType, data: data}, nil
+}
+
+// transcribe extracts the image's text with the vision model
+func (img *imageInput) transcribe(ctx context.Context) (string, error) {
+	clf, err := classifier.New()
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("Reading text from %s... ", img.filename)
+	text, err := clf.ExtractText(ctx, img.data, img.mimeType)
+	if err != nil {
+		fmt.Println("failed")
+		return "", err
+	}
+	fmt.Printf("done (%d chars)\n", len(text))
+	return text, nil
+}
+
+// attach stores the original image as an attachment of the entry
+func (img *imageInput) attach(ctx context.Context, s *store.Store, entryID string) error {
+	sum, size, err := blobs.ForDir(s.Dir()).Put(bytes.NewReader(img.data))
+	if err != nil {
+		return err
+	}
+	_, err = s.AddAttachment(ctx, entryID, sum, img.filename, img.mimeType, size)
+	return err
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/export"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// jsonOutput is set by --json: add, list, show, tags and search then
+// print JSON on stdout instead of text
+var jsonOutput bool
+
+// jsonStdout is where JSON results go, even while humanToStderr is active
+var jsonStdout = os.Stdout
+
+// printJSON writes v to stdout as indented JSON
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(jsonStdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// entryFormat checks a --format value, returning "" for plain text; --json
+// stands for --format json
+func entryFormat(format string) (string, error) {
+	if format == "" || format == "text" {
+		if jsonOutput {
+			return "json", nil
+		}
+		return "", nil
+	}
+	if !slices.Contains(export.EntryFormats, format) {
+		return "", fmt.Errorf("unknown format %q (use text, %s)", format, strings.Join(export.EntryFormats, ", "))
+	}
+	return format, nil
+}
+
+// printEntryAs prints an entry, with its tags, attachments and links, in
+// one of export.EntryFormats
+func printEntryAs(ctx context.Context, s *store.Store, format, id string) error {
+	entry, err := s.GetEntry(ctx, id)
+	if err != nil {
+		return err
+	}
+	return export.WriteEntry(jsonStdout, format, entry)
+}
+
+// printEntriesAs prints entries, with their tags, in one of
+// export.EntryFormats
+func printEntriesAs(ctx context.Context, s *store.Store, format string, entries []domain.Entry) error {
+	for i := range entries {
+		tags, err := s.GetEntryTags(ctx, entries[i].ID)
+		if err != nil {
+			return err
+		}
+		entries[i].Tags = tags
+	}
+	return export.WriteEntries(jsonStdout, format, entries)
+}
+
+// humanToStderr sends what a command prints along the way to stderr,
+// keeping stdout for its JSON result, until the returned func is called
+func humanToStderr() func() {
+	stdout := os.Stdout
+	jsonStdout, os.Stdout = stdout, os.Stderr
+	return func() { os.Stdout = stdout }
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pbaille/kb/internal/fetcher"
+)
+
+// readPDF extracts the text of a PDF file, or returns nil if it isn't a PDF
+func readPDF(file string, opts fetcher.Options) (*fetcher.FetchResult, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+	if !fetcher.IsPDF(data) {
+		return nil, nil
+	}
+	doc, err := fetcher.ExtractPDF(data, opts)
+	if err != nil {
+		return nil, fmt.Errorf("extract pdf: %w", err)
+	}
+	return doc, nil
+}
+
+// printExtracted reports how much text was taken from a page or document
+func printExtracted(r *fetcher.FetchResult) {
+	if r.Title != "" {
+		fmt.Printf("Title: %s\n", r.Title)
+	}
+	if r.Pages > 0 {
+		fmt.Printf("Extracted %d chars of text from %d pages\n", len(r.Text), r.Pages)
+	} else {
+		fmt.Printf("Extracted %d chars of text\n", len(r.Text))
+	}
+	if r.Truncated {
+		fmt.Println("(truncated: raise --max-pages or --max-chars to keep more)")
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func pinCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "pin [id...]",
+		Short: "Pin entries above the others in lists",
+		Long: `Pin entries, such as reference notes, to keep them at hand: kb list and
+the API's entry list show them first, the most recently pinned on top,
+until kb unpin.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			for _, arg := range args {
+				id, err := resolveEntryID(ctx, s, arg)
+				if err != nil {
+					return err
+				}
+				if err := s.PinEntry(ctx, id); err != nil {
+					return fmt.Errorf("%s: %w", short(id), err)
+				}
+				fmt.Printf("Pinned %s\n", short(id))
+			}
+			return nil
+		},
+	}
+}
+
+func unpinCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "unpin [id...]",
+		Short: "Unpin entries",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			for _, arg := range args {
+				id, err := resolveEntryID(ctx, s, arg)
+				if err != nil {
+					return err
+				}
+				if err := s.UnpinEntry(ctx, id); err != nil {
+					return fmt.Errorf("%s: %w", short(id), err)
+				}
+				fmt.Printf("Unpinned %s\n", short(id))
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/pbaille/kb/internal/classifier"
+	"github.com/spf13/cobra"
+)
+
+func pretagCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "pretag",
+		Short: "Manage regex and keyword taggers applied before the LLM",
+		Long: `Manage regex and keyword taggers applied before the LLM.
+
+Pre-taggers tag matching content deterministically. By default the LLM
+still classifies the entry and its suggestions are added; with --skip-llm
+a match is considered enough and the LLM call is saved. Examples:
+
+  kb pretag add TODO task --keyword
+  kb pretag add '(?m)^` + "```" + `go$' golang --parent programming --skip-llm`,
+	}
+
+	var parent string
+	var keyword, skipLLM bool
+	add := &cobra.Command{
+		Use:   "add [pattern] [tag]",
+		Short: "Add a pre-tagger",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			pattern := args[0]
+			if keyword {
+				pattern = classifier.KeywordPattern(pattern)
+			}
+			if _, err := classifier.CompilePattern(pattern); err != nil {
+				return err
+			}
+
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			p, err := s.AddPreTagger(ctx, pattern, args[1], parent, skipLLM)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Added pre-tagger %s: /%s/ -> %s\n", short(p.ID), p.Pattern, p.Tag)
+			return nil
+		},
+	}
+	add.Flags().BoolVar(&keyword, "keyword", false, "treat the pattern as a case-insensitive whole word")
+	add.Flags().StringVar(&parent, "parent", "", "parent of the tag")
+	add.Flags().BoolVar(&skipLLM, "skip-llm", false, "don't call the LLM when this pre-tagger matches")
+	cmd.AddCommand(add)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List pre-taggers",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			taggers, err := s.ListPreTaggers(ctx)
+			if err != nil {
+				return err
+			}
+			if len(taggers) == 0 {
+				fmt.Println("No pre-taggers yet. Use 'kb pretag add' to create one.")
+				return nil
+			}
+
+			for _, p := range taggers {
+				tag := p.Tag
+				if p.Parent != "" {
+					tag += " (under " + p.Parent + ")"
+				}
+				skip := ""
+				if p.SkipLLM {
+					skip = "  [skip llm]"
+				}
+				fmt.Printf("%s  /%s/ -> %s%s\n", short(p.ID), p.Pattern, tag, skip)
+			}
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "rm [id]",
+		Short: "Delete a pre-tagger",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			if err := s.DeletePreTagger(ctx, args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("Deleted pre-tagger %s\n", args[0])
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "test [content]",
+		Short: "Show which tags the pre-taggers would apply to content",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			content, err := readInput(args, "")
+			if err != nil {
+				return err
+			}
+
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			taggers, err := s.ListPreTaggers(ctx)
+			if err != nil {
+				return err
+			}
+
+			tags, skipLLM := classifier.PreTag(content, taggers)
+			if len(tags) == 0 {
+				fmt.Println("No pre-tagger matched.")
+				return nil
+			}
+			for _, t := range tags {
+				fmt.Printf("  + %s\n", t.Name)
+			}
+			if skipLLM {
+				fmt.Println("(LLM classification would be skipped)")
+			}
+			return nil
+		},
+	})
+
+	return cmd
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pbaille/kb/internal/classifier"
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/embedding"
+	"github.com/pbaille/kb/internal/store"
+	"github.com/spf13/cobra"
+)
+
+// reviewCandidates is how many related entries a promotion review considers
+const reviewCandidates = 8
+
+func promoteCmd() *cobra.Command {
+	var to string
+	var review bool
+
+	cmd := &cobra.Command{
+		Use:   "promote [id]",
+		Short: "Move an entry to the next maturity level",
+		Long: `Move an entry along fleeting → literature → evergreen. Without --to the
+entry moves one step. An evergreen note can be moved back to literature
+for rework.
+
+With --review, the note and related entries are first sent to the LLM,
+which suggests a title, edits and links to make it stand on its own.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			id, err := resolveEntryID(ctx, s, args[0])
+			if err != nil {
+				return err
+			}
+			entry, err := s.GetEntry(ctx, id)
+			if err != nil {
+				return err
+			}
+
+			if to == "" {
+				i := slices.Index(domain.MaturityLevels, entry.Maturity)
+				if i < 0 || i == len(domain.MaturityLevels)-1 {
+					return fmt.Errorf("entry is already %s", entry.Maturity)
+				}
+				to = domain.MaturityLevels[i+1]
+			}
+			if err := checkMaturity(to); err != nil {
+				return err
+			}
+			// Checked before the review, which costs an API call
+			if !domain.CanTransition(entry.Maturity, to) {
+				return fmt.Errorf("cannot move a %s note to %s", entry.Maturity, to)
+			}
+
+			if review {
+				if err := printPromotionReview(ctx, s, entry, to); err != nil {
+					return err
+				}
+			}
+
+			if err := s.SetMaturity(ctx, id, to); err != nil {
+				return err
+			}
+			fmt.Printf("%s: %s → %s\n", short(id), entry.Maturity, to)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&to, "to", "", "target maturity (fleeting, literature, evergreen)")
+	cmd.Flags().BoolVar(&review, "review", false, "ask the LLM for edits and links before promoting")
+	return cmd
+}
+
+// checkMaturity rejects unknown maturity levels given on the command line
+func checkMaturity(level string) error {
+	if !slices.Contains(domain.MaturityLevels, level) {
+		return fmt.Errorf("unknown maturity %q (want %s)", level, strings.Join(domain.MaturityLevels, ", "))
+	}
+	return nil
+}
+
+// printPromotionReview shows the LLM's suggested refinements of an entry
+func printPromotionReview(ctx context.Context, s *store.Store, entry *domain.Entry, to string) error {
+	clf, err := classifier.New()
+	if err != nil {
+		return err
+	}
+	related, err := relatedEntries(ctx, s, entry, reviewCandidates)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Reviewing...")
+	review, err := clf.ReviewPromotion(ctx, entry.Content, to, related)
+	if err != nil {
+		return fmt.Errorf("review: %w", err)
+	}
+
+	if review.Title != "" {
+		fmt.Printf("\nSuggested title: %s\n", review.Title)
+	}
+	if len(review.Edits) > 0 {
+		fmt.Println("\nSuggested edits:")
+		for _, edit := range review.Edits {
+			fmt.Printf("  - %s\n", edit)
+		}
+	} else {
+		fmt.Println("\nNo edits suggested.")
+	}
+	if len(review.Links) > 0 {
+		titles := make(map[string]string, len(related))
+		for _, e := range related {
+			titles[e.ID] = e.DisplayTitle()
+		}
+		fmt.Println("\nWorth linking:")
+		for _, l := range review.Links {
+			fmt.Printf("  %s  %s\n      %s\n", short(l.ID), truncate(titles[l.ID], 60), l.Reason)
+		}
+	}
+	fmt.Println()
+	return nil
+}
+
+// relatedEntries returns entries close to the given one, by embedding when
+// available and by shared tags
+func relatedEntries(ctx context.Context, s *store.Store, entry *domain.Entry, limit int) ([]domain.Entry, error) {
+	var related []domain.Entry
+	seen := map[string]bool{entry.ID: true}
+
+	if embSvc, err := embedding.New(); err == nil {
+		if vector, err := embSvc.Embed(ctx, entry.Content); err == nil {
+			similar, err := s.FindSimilar(ctx, vector, limit, entry.ID)
+			if err != nil {
+				return nil, err
+			}
+			for _, sim := range similar {
+				seen[sim.Entry.ID] = true
+				related = append(related, sim.Entry)
+			}
+		}
+	}
+
+	byTags, err := s.FindSimilarByTags(ctx, entry.ID, limit)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range byTags {
+		if len(related) >= limit {
+			break
+		}
+		if !seen[e.ID] {
+			seen[e.ID] = true
+			related = append(related, e)
+		}
+	}
+	return related, nil
+}
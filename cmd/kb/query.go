@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pbaille/kb/internal/classifier"
+	"github.com/spf13/cobra"
+)
+
+func queryCmd() *cobra.Command {
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "query [question]",
+		Short: "Find entries with a natural-language question",
+		Long: `Find entries by describing them, e.g.
+
+  kb query "entries tagged golang created last month without reviews"
+
+The LLM translates the question into a filter on tags, dates, source,
+maturity and review state, which is printed and then run locally.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			question := strings.Join(args, " ")
+
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			clf, err := classifier.New()
+			if err != nil {
+				return err
+			}
+
+			tags, err := s.ListTags(ctx)
+			if err != nil {
+				return err
+			}
+			names := make([]string, len(tags))
+			known := make(map[string]bool, len(tags))
+			for i, t := range tags {
+				names[i] = t.Name
+				known[t.Name] = true
+			}
+
+			filter, err := clf.TranslateQuery(ctx, question, names, time.Now())
+			if err != nil {
+				return fmt.Errorf("translate query: %w", err)
+			}
+
+			data, _ := json.Marshal(filter)
+			fmt.Printf("Query: %s\n", data)
+			for _, tag := range append(filter.Tags, filter.ExcludeTags...) {
+				if !known[tag] {
+					fmt.Printf("(no tag named %q)\n", tag)
+				}
+			}
+			if dryRun {
+				return nil
+			}
+
+			entries, err := s.FilterEntries(ctx, *filter)
+			if err != nil {
+				return err
+			}
+			fmt.Println()
+			if len(entries) == 0 {
+				fmt.Println("No matching entries.")
+				return nil
+			}
+			for _, e := range entries {
+				fmt.Printf("%s  %s  %s%s\n", short(e.ID), e.CreatedAt.Format("2006-01-02"), truncate(e.DisplayTitle(), 60), scratchMark(&e))
+			}
+			fmt.Printf("\n%d entries\n", len(entries))
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "only show the generated query")
+	return cmd
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pbaille/kb/internal/export"
+	"github.com/spf13/cobra"
+)
+
+func randomCmd() *cobra.Command {
+	var tag, format string
+	var stale bool
+
+	cmd := &cobra.Command{
+		Use:   "random",
+		Short: "Show an entry picked at random",
+		Long: `Show an active entry picked at random, to rediscover forgotten notes.
+
+With --stale, entries are picked in proportion to how long they've gone
+unseen: a note last viewed a year ago comes up far more often than one
+read yesterday. Shown entries count as viewed.
+
+  kb random
+  kb random --tag reading --stale`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			format, err := entryFormat(format)
+			if err != nil {
+				return err
+			}
+
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			if tag != "" {
+				if _, err := s.GetTagByName(ctx, tag); err != nil {
+					return err
+				}
+			}
+			entry, err := s.RandomEntry(ctx, tag, stale)
+			if err != nil {
+				return err
+			}
+			if entry == nil {
+				if tag != "" {
+					fmt.Printf("No entries under %s.\n", tag)
+					return nil
+				}
+				fmt.Println("No entries yet. Use 'kb add' to create one.")
+				return nil
+			}
+
+			if format != "" {
+				err = export.WriteEntry(os.Stdout, format, entry)
+			} else {
+				printEntry(entry)
+			}
+			if err != nil {
+				return err
+			}
+			return s.MarkViewed(ctx, entry.ID)
+		},
+	}
+
+	cmd.Flags().StringVar(&tag, "tag", "", "pick under a tag and its sub-tags (name, alias or path)")
+	cmd.Flags().BoolVar(&stale, "stale", false, "favor entries unseen for longest")
+	cmd.Flags().StringVar(&format, "format", "text", "output format: text, json, yaml, markdown or org")
+	return cmd
+}
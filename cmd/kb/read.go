@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func readCmd() *cobra.Command {
+	var unread bool
+
+	cmd := &cobra.Command{
+		Use:   "read [id...]",
+		Short: "Mark entries read, taking them out of the reading queue",
+		Long: `Mark entries read. Entries captured from URLs start unread, queued
+for later reading; kb list --unread lists the queue, and --unread here
+puts an entry back in it.
+
+  kb list --unread --reverse
+  kb read 3f2a9c1e`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			for _, arg := range args {
+				id, err := resolveEntryID(ctx, s, arg)
+				if err != nil {
+					return err
+				}
+				if unread {
+					err = s.MarkUnread(ctx, id)
+				} else {
+					err = s.MarkRead(ctx, id)
+				}
+				if err != nil {
+					return fmt.Errorf("%s: %w", short(id), err)
+				}
+				if unread {
+					fmt.Printf("Marked %s unread\n", short(id))
+				} else {
+					fmt.Printf("Marked %s read\n", short(id))
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&unread, "unread", false, "mark unread instead, queuing for later reading")
+	return cmd
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pbaille/kb/internal/cache"
+	"github.com/pbaille/kb/internal/classifier"
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/store"
+	"github.com/spf13/cobra"
+)
+
+// taxonomySamples bounds how many entries are shown to the LLM when proposing a taxonomy
+const taxonomySamples = 50
+
+func reclassifyCmd() *cobra.Command {
+	var all, cleanSlate, yes bool
+	var tagFilter, entryID string
+
+	cmd := &cobra.Command{
+		Use:   "reclassify",
+		Short: "Re-run classification to rebuild tags",
+		Long: `Re-run classification for the selected entries, replacing their tags.
+
+With --clean-slate, classification runs in two phases: first a consolidated
+taxonomy is proposed from the current tags and a sample of entries, then
+every selected entry is classified using only that taxonomy, and existing
+tags it places elsewhere are moved. Nothing is written until the proposal
+and the assignments are confirmed; they're then applied all at once.
+Tags the entries no longer use are deleted, unless other entries or tags
+still use them.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			selected := 0
+			for _, set := range []bool{all, tagFilter != "", entryID != ""} {
+				if set {
+					selected++
+				}
+			}
+			if selected != 1 {
+				return fmt.Errorf("specify exactly one of --all, --tag or --entry")
+			}
+
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			var entries []domain.Entry
+			switch {
+			case all:
+				entries, err = s.ListEntries(ctx, domain.ScopeActive, -1, 0)
+			case tagFilter != "":
+				entries, err = s.GetEntriesByTag(ctx, tagFilter, true)
+			default:
+				var id string
+				id, err = resolveEntryID(ctx, s, entryID)
+				if err == nil {
+					var e *domain.Entry
+					e, err = s.GetEntry(ctx, id)
+					if e != nil {
+						entries = []domain.Entry{*e}
+					}
+				}
+			}
+			if err != nil {
+				return err
+			}
+
+			if len(entries) == 0 {
+				fmt.Println("No entries selected.")
+				return nil
+			}
+
+			clf, err := classifier.New()
+			if err != nil {
+				return err
+			}
+			// Reclassifying means asking again, not reusing past answers
+			ctx = cache.Refresh(ctx)
+
+			reader := bufio.NewReader(os.Stdin)
+
+			var taxonomy []classifier.TagSuggestion
+			if cleanSlate {
+				taxonomy, err = proposeTaxonomy(ctx, s, clf, entries)
+				if err != nil {
+					return err
+				}
+				printTaxonomy(taxonomy)
+				if !yes && !confirm(reader, "Use this taxonomy?") {
+					fmt.Println("Aborted.")
+					return nil
+				}
+			}
+
+			tagNames, err := s.ClassifierTags(ctx)
+			if err != nil {
+				return err
+			}
+			taggers, err := s.ListPreTaggers(ctx)
+			if err != nil {
+				return err
+			}
+			factors, err := s.CalibrationFactors(ctx)
+			if err != nil {
+				return err
+			}
+
+			// Classify everything before writing anything
+			results := make(map[string][]classifier.TagSuggestion, len(entries))
+			for i, e := range entries {
+				fmt.Printf("[%d/%d] %s  %s\n", i+1, len(entries), short(e.ID), truncate(e.Content, 50))
+
+				var result *classifier.ClassifyResult
+				if cleanSlate {
+					result, err = clf.ClassifyStrict(ctx, e.Content, taxonomy)
+				} else {
+					result, err = classifier.ClassifyWithPreTags(ctx, clf, e.Content, tagNames, taggers)
+					if result != nil {
+						result.Tags = classifier.Calibrate(result.Tags, factors)
+					}
+				}
+				if err != nil {
+					fmt.Printf("  failed: %v (keeping current tags)\n", err)
+					continue
+				}
+
+				names := make([]string, len(result.Tags))
+				for j, t := range result.Tags {
+					names[j] = t.Name
+				}
+				fmt.Printf("  -> %s\n", strings.Join(names, ", "))
+				results[e.ID] = result.Tags
+			}
+
+			if len(results) == 0 {
+				fmt.Println("No entries were classified.")
+				return nil
+			}
+
+			if !yes && !confirm(reader, fmt.Sprintf("Replace tags on %d entries?", len(results))) {
+				fmt.Println("Aborted.")
+				return nil
+			}
+
+			r := store.Reclassification{
+				Taxonomy: tagPlacements(taxonomy),
+				Tags:     make(map[string][]store.TagPlacement, len(results)),
+			}
+			for id, tags := range results {
+				r.Tags[id] = tagPlacements(tags)
+			}
+			retired, err := s.Reclassify(ctx, r)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Reclassified %d entries, retired %d tags\n", len(results), len(retired))
+			for _, name := range retired {
+				fmt.Printf("  - %s\n", name)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&all, "all", false, "reclassify every entry")
+	cmd.Flags().StringVar(&tagFilter, "tag", "", "reclassify entries under this tag, by name or path (a/b/c)")
+	cmd.Flags().StringVar(&entryID, "entry", "", "reclassify a single entry (ID prefix)")
+	cmd.Flags().BoolVar(&cleanSlate, "clean-slate", false, "propose a consolidated taxonomy first, then assign from it")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "don't ask for confirmation")
+	return cmd
+}
+
+// proposeTaxonomy runs the first clean-slate phase
+func proposeTaxonomy(ctx context.Context, s *store.Store, clf *classifier.Classifier, entries []domain.Entry) ([]classifier.TagSuggestion, error) {
+	counts, err := s.TagCounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Spread samples evenly over the selection
+	step := max(1, len(entries)/taxonomySamples)
+	var samples []string
+	for i := 0; i < len(entries) && len(samples) < taxonomySamples; i += step {
+		samples = append(samples, truncate(entries[i].Content, 300))
+	}
+
+	fmt.Print("Proposing taxonomy... ")
+	taxonomy, err := clf.ProposeTaxonomy(ctx, counts, samples)
+	if err != nil {
+		fmt.Println("failed")
+		return nil, err
+	}
+	fmt.Println("done")
+	return taxonomy, nil
+}
+
+func printTaxonomy(taxonomy []classifier.TagSuggestion) {
+	children := make(map[string][]string)
+	var roots []string
+	for _, t := range taxonomy {
+		if t.Parent == "" {
+			roots = append(roots, t.Name)
+		} else {
+			children[t.Parent] = append(children[t.Parent], t.Name)
+		}
+	}
+
+	fmt.Println("\nProposed taxonomy:")
+	var printTree func(name string, indent int)
+	printTree = func(name string, indent int) {
+		fmt.Printf("  %s%s\n", strings.Repeat("  ", indent), name)
+		// The classifier may propose parents going round
+		if indent == domain.MaxTagDepth {
+			return
+		}
+		for _, child := range children[name] {
+			printTree(child, indent+1)
+		}
+	}
+	for _, root := range roots {
+		printTree(root, 0)
+	}
+	fmt.Println()
+}
+
+// tagAssignments converts classifier suggestions for the store
+func tagPlacements(suggestions []classifier.TagSuggestion) []store.TagPlacement {
+	if suggestions == nil {
+		return nil
+	}
+	placements := make([]store.TagPlacement, len(suggestions))
+	for i, t := range suggestions {
+		placements[i] = store.TagPlacement{Name: t.Name, Parent: t.Parent, Confidence: t.Confidence}
+	}
+	return placements
+}
+
+// confirm asks a yes/no question on stdin, defaulting to no
+func confirm(reader *bufio.Reader, question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	line, _ := reader.ReadString('\n')
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/embedding"
+	"github.com/pbaille/kb/internal/pipeline"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// relatedOnAdd is how many related entries are shown after adding one
+const relatedOnAdd = 3
+
+// showRelated embeds a new entry and prints the existing entries closest
+// to it, by embedding or else by shared tags. When ask is set, the user
+// picks which of them to link the new entry to.
+func showRelated(ctx context.Context, s *store.Store, entryID, content string, ask bool) {
+	var related []domain.Entry
+	var scores []float64
+
+	if embSvc, err := embedding.New(); err == nil {
+		vector, err := pipeline.Embed(ctx, s, embSvc, entryID, content)
+		if err != nil {
+			fmt.Printf("(embedding skipped: %v)\n", err)
+		} else {
+			similar, _ := s.FindSimilar(ctx, vector, relatedOnAdd, entryID)
+			for _, sim := range similar {
+				related = append(related, sim.Entry)
+				scores = append(scores, sim.Similarity)
+			}
+		}
+	}
+	if len(related) == 0 {
+		related, _ = s.FindSimilarByTags(ctx, entryID, relatedOnAdd)
+		scores = nil
+	}
+	if len(related) == 0 {
+		return
+	}
+
+	fmt.Println("\nRelated:")
+	for i, e := range related {
+		score := ""
+		if scores != nil {
+			score = fmt.Sprintf(" (%.0f%%)", scores[i]*100)
+		}
+		fmt.Printf("  [%d] %s  %s%s\n", i+1, short(e.ID), truncate(e.DisplayTitle(), 60), score)
+	}
+	if !ask {
+		return
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Printf("Link to: [1-%d, a]ll, Enter to skip: ", len(related))
+	line, _ := reader.ReadString('\n')
+	for _, i := range parsePicks(line, len(related)) {
+		if err := s.LinkEntries(ctx, entryID, related[i].ID); err != nil {
+			fmt.Printf("(link skipped: %v)\n", err)
+			continue
+		}
+		fmt.Printf("Linked to %s\n", short(related[i].ID))
+	}
+}
+
+// parsePicks reads a selection like "1 3", "1,2" or "a" into indexes
+// below n, ignoring anything out of range
+func parsePicks(line string, n int) []int {
+	line = strings.ToLower(strings.TrimSpace(line))
+	if line == "a" || line == "all" {
+		picks := make([]int, n)
+		for i := range picks {
+			picks[i] = i
+		}
+		return picks
+	}
+
+	var picks []int
+	seen := make(map[int]bool)
+	for _, field := range strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if i, err := strconv.Atoi(field); err == nil && i >= 1 && i <= n && !seen[i] {
+			seen[i] = true
+			picks = append(picks, i-1)
+		}
+	}
+	return picks
+}
+
+// isTerminal reports whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(f.Fd())
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/notify"
+	"github.com/pbaille/kb/internal/rules"
+	"github.com/pbaille/kb/internal/store"
+	"github.com/spf13/cobra"
+)
+
+// reminderCheckInterval is how often kb serve looks for reminders come due
+const reminderCheckInterval = time.Minute
+
+// notifyReminders sends a notification for each reminder come due since
+// the last check
+func notifyReminders(ctx context.Context, s *store.Store, cfg *notify.Config) error {
+	reminders, err := s.UnnotifiedReminders(ctx)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, r := range reminders {
+		body := r.Note
+		if body == "" {
+			body = truncate(r.Entry.Content, 200)
+		}
+		err := cfg.Send(ctx, notify.Notification{
+			Event: "reminder",
+			Title: "kb: " + r.Entry.DisplayTitle(),
+			Body:  body,
+			Data:  r,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("notify %s: %w", short(r.EntryID), err))
+			continue
+		}
+		if err := s.MarkReminderNotified(ctx, r.EntryID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func remindCmd() *cobra.Command {
+	var note string
+	var clear bool
+
+	cmd := &cobra.Command{
+		Use:   "remind [id] [when]",
+		Short: "Set a reminder to follow up on an entry",
+		Long: `Set a reminder to follow up on an entry, replacing the one it has. When
+is a delay ("in 3 days", "2 weeks", "12h"), a day ("tomorrow", "next week",
+"friday", "2026-11-02"), or either at a time of day ("tomorrow at 8am",
+"at 14:30"). Reminders set for a day are due at 9:00.
+
+kb due lists the reminders due. kb serve sends a notification when one
+comes due, to the URL in KB_NOTIFY_WEBHOOK (POSTed as JSON) and, with
+KB_NOTIFY_DESKTOP set, as a desktop notification. A reminder stays due
+until cleared with --clear. Examples:
+
+  kb remind 3f2a "in 3 days"
+  kb remind 3f2a friday at 2pm --note "reply to the author"
+  kb remind 3f2a --clear`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			when := strings.Join(args[1:], " ")
+			if !clear && when == "" {
+				return fmt.Errorf("when to be reminded is required (e.g. \"in 3 days\")")
+			}
+			if clear && when != "" {
+				return fmt.Errorf("--clear takes no time")
+			}
+
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			id, err := resolveEntryID(ctx, s, args[0])
+			if err != nil {
+				return err
+			}
+			if clear {
+				if err := s.ClearReminder(ctx, id); err != nil {
+					if errors.Is(err, store.ErrReminderNotFound) {
+						return fmt.Errorf("%s has no reminder", short(id))
+					}
+					return err
+				}
+				fmt.Printf("Cleared the reminder on %s\n", short(id))
+				return nil
+			}
+
+			at, err := domain.ParseRemindTime(when, time.Now())
+			if err != nil {
+				return err
+			}
+			r, err := s.SetReminder(ctx, id, at, note)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				return printJSON(r)
+			}
+			fmt.Printf("Reminder on %s set for %s\n", short(id), at.Format("Mon 2006-01-02 15:04"))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&note, "note", "", "what to follow up on")
+	cmd.Flags().BoolVar(&clear, "clear", false, "remove the entry's reminder")
+	return cmd
+}
+
+func dueCmd() *cobra.Command {
+	var within string
+
+	cmd := &cobra.Command{
+		Use:   "due",
+		Short: "List entries with reminders due",
+		Long: `List entries with reminders due, soonest first. With --within, reminders
+coming due in that time are listed too. Clear a reminder once followed up
+on with kb remind [id] --clear.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			now := time.Now()
+			until := now
+			if within != "" {
+				d, err := rules.ParseDelay(within)
+				if err != nil {
+					return err
+				}
+				until = now.Add(d)
+			}
+
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			reminders, err := s.ListReminders(ctx, until)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				if reminders == nil {
+					reminders = []domain.Reminder{}
+				}
+				return printJSON(reminders)
+			}
+			if len(reminders) == 0 {
+				fmt.Println("No reminders due")
+				return nil
+			}
+			for _, r := range reminders {
+				mark := " "
+				if !r.RemindAt.After(now) {
+					mark = "!"
+				}
+				fmt.Printf("%s %s  %s  %s\n", mark, short(r.EntryID), r.RemindAt.Local().Format("2006-01-02 15:04"), truncate(r.Entry.DisplayTitle(), 60))
+				if r.Note != "" {
+					fmt.Printf("    %s\n", r.Note)
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&within, "within", "", "also list reminders coming due within this delay (e.g. 7d)")
+	return cmd
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pbaille/kb/internal/digest"
+	"github.com/pbaille/kb/internal/mailer"
+	"github.com/pbaille/kb/internal/notify"
+	"github.com/pbaille/kb/internal/store"
+	"github.com/spf13/cobra"
+)
+
+// reportPeriod is the period covered by the weekly email report
+const reportPeriod = 7 * 24 * time.Hour
+
+// sendReport builds the digest for the last period and sends it
+func sendReport(ctx context.Context, s *store.Store) error {
+	d, err := digest.Build(ctx, s, time.Now().Add(-reportPeriod))
+	if err != nil {
+		return err
+	}
+	if d.Empty() {
+		return nil
+	}
+	return deliverDigest(ctx, d)
+}
+
+// digestWebhook returns the notification webhook digests are posted to,
+// if one is configured
+func digestWebhook() (*notify.Config, bool) {
+	cfg, err := notify.FromEnv()
+	if err != nil || cfg.WebhookURL == "" {
+		return nil, false
+	}
+	// A digest is too long for a desktop notification
+	return &notify.Config{WebhookURL: cfg.WebhookURL}, true
+}
+
+// deliverDigest emails a digest as HTML and posts it as Markdown to the
+// notification webhook, whichever are configured
+func deliverDigest(ctx context.Context, d *digest.Digest) error {
+	mail, mailErr := mailer.FromEnv()
+	hook, hasHook := digestWebhook()
+	if mailErr != nil && !hasHook {
+		return fmt.Errorf("nowhere to send the digest: configure KB_SMTP_* or KB_NOTIFY_WEBHOOK (%v)", mailErr)
+	}
+
+	var errs []error
+	if mailErr == nil {
+		body, err := d.RenderHTML()
+		if err == nil {
+			err = mail.SendHTML(d.Subject(), body)
+		}
+		errs = append(errs, err)
+	}
+	if hasHook {
+		body, err := d.RenderMarkdown()
+		if err == nil {
+			err = hook.Send(ctx, notify.Notification{Event: "digest", Title: d.Subject(), Body: body, Data: d})
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func reportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "report",
+		Short: "Manage the weekly email report",
+		Long: `Manage the weekly email report.
+
+The report is sent by 'kb serve' once a week when SMTP is configured via
+KB_SMTP_HOST, KB_SMTP_PORT, KB_SMTP_USER, KB_SMTP_PASSWORD, KB_SMTP_FROM
+and KB_SMTP_TO (comma-separated recipients). It is also posted as Markdown
+to KB_NOTIFY_WEBHOOK when set. kb digest shows it for any period.`,
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "preview",
+		Short: "Print the report HTML without sending it",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			d, err := digest.Build(ctx, s, time.Now().Add(-reportPeriod))
+			if err != nil {
+				return err
+			}
+			body, err := d.RenderHTML()
+			if err != nil {
+				return err
+			}
+			fmt.Println(body)
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "send",
+		Short: "Send the report now",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			if err := sendReport(ctx, s); err != nil {
+				return err
+			}
+			fmt.Println("Report sent.")
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "Show which report sections are active",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			for _, section := range digest.Sections {
+				paused, err := digest.IsPaused(ctx, s, section)
+				if err != nil {
+					return err
+				}
+				state := "active"
+				if paused {
+					state = "paused"
+				}
+				fmt.Printf("%-12s %s\n", section, state)
+			}
+			return nil
+		},
+	})
+
+	cmd.AddCommand(sectionToggleCmd("pause", true))
+	cmd.AddCommand(sectionToggleCmd("resume", false))
+
+	return cmd
+}
+
+// sectionToggleCmd builds the pause/resume subcommands
+func sectionToggleCmd(name string, pause bool) *cobra.Command {
+	return &cobra.Command{
+		Use:   name + " [section|all]",
+		Short: fmt.Sprintf("%s a report section (%s)", name, strings.Join(digest.Sections, ", ")),
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			sections := []string{args[0]}
+			if args[0] == "all" {
+				sections = digest.Sections
+			} else if !slices.Contains(digest.Sections, args[0]) {
+				return fmt.Errorf("unknown section: %s", args[0])
+			}
+
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			for _, section := range sections {
+				if pause {
+					err = s.SetSetting(ctx, digest.PauseKey(section), time.Now().Format(time.RFC3339))
+				} else {
+					err = s.DeleteSetting(ctx, digest.PauseKey(section))
+				}
+				if err != nil {
+					return err
+				}
+			}
+
+			fmt.Printf("%sd: %v\n", name, sections)
+			return nil
+		},
+	}
+}
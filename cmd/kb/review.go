@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/srs"
+	"github.com/spf13/cobra"
+)
+
+func reviewCmd() *cobra.Command {
+	var limit int
+	var stale bool
+	var tag string
+
+	cmd := &cobra.Command{
+		Use:   "review",
+		Short: "Review due entries with spaced repetition",
+		Long: `Review due entries with spaced repetition (SM-2).
+
+Each entry is shown and graded from 0 (forgot) to 5 (perfect recall);
+the grade decides when the entry comes due again. With --stale, simply
+resurface the least recently viewed entries without grading, optionally
+under one tag (see neglected tags in 'kb stats').`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			if tag != "" && !stale {
+				return fmt.Errorf("--tag only applies with --stale")
+			}
+
+			var entries []domain.Entry
+			if tag != "" {
+				entries, err = s.StaleEntriesUnderTag(ctx, tag, limit)
+			} else if stale {
+				entries, err = s.GetSuggestions(ctx, limit)
+			} else {
+				entries, err = s.DueReviews(ctx, limit)
+			}
+			if err != nil {
+				return err
+			}
+
+			if len(entries) == 0 {
+				fmt.Println("Nothing to review.")
+				return nil
+			}
+
+			reader := bufio.NewReader(os.Stdin)
+			for i, e := range entries {
+				entry, err := s.GetEntry(ctx, e.ID)
+				if err != nil {
+					return err
+				}
+
+				fmt.Printf("\n[%d/%d]\n", i+1, len(entries))
+				printEntry(entry)
+
+				if err := s.MarkViewed(ctx, entry.ID); err != nil {
+					return err
+				}
+
+				if stale {
+					if i == len(entries)-1 {
+						break
+					}
+					fmt.Print("\n[enter] next, [q] quit: ")
+					line, err := reader.ReadString('\n')
+					if err != nil || strings.TrimSpace(line) == "q" {
+						break
+					}
+					continue
+				}
+
+				grade, ok := readGrade(reader)
+				if !ok {
+					break
+				}
+				review, err := s.GradeReview(ctx, entry.ID, grade)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Next review in %d day(s)\n", review.IntervalDays)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVarP(&limit, "limit", "n", 20, "number of entries to review")
+	cmd.Flags().BoolVar(&stale, "stale", false, "resurface least recently viewed entries without grading")
+	cmd.Flags().StringVar(&tag, "tag", "", "with --stale, only entries under this tag, by name or path (a/b/c)")
+	return cmd
+}
+
+// readGrade prompts for an SM-2 grade until a valid one is entered.
+// It returns false when the user quits or input ends.
+func readGrade(reader *bufio.Reader) (int, bool) {
+	for {
+		fmt.Printf("\nGrade 0-%d (0 forgot, %d perfect), [q] quit: ", srs.MaxGrade, srs.MaxGrade)
+		line, err := reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "q" || (err != nil && line == "") {
+			return 0, false
+		}
+		grade, convErr := strconv.Atoi(line)
+		if convErr == nil && grade >= 0 && grade <= srs.MaxGrade {
+			return grade, true
+		}
+		if err != nil {
+			return 0, false
+		}
+		fmt.Println("Invalid grade.")
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pbaille/kb/internal/rules"
+	"github.com/pbaille/kb/internal/store"
+	"github.com/spf13/cobra"
+)
+
+// applyRules runs automation rules on a newly ingested entry and reports
+// what they did; rule errors don't fail the ingestion
+func applyRules(ctx context.Context, s *store.Store, entryID string) {
+	results, err := rules.New(s).Apply(ctx, entryID)
+	if err != nil {
+		fmt.Printf("(rules failed: %v)\n", err)
+		return
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Printf("  rule %s: %s failed: %v\n", r.Rule, r.Action, r.Err)
+		} else {
+			fmt.Printf("  rule %s: %s\n", r.Rule, r.Action)
+		}
+	}
+}
+
+func rulesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rules",
+		Short: "Manage automation rules run when entries are added",
+		Long: `Manage automation rules run when entries are added.
+
+A rule has one condition and one or more actions, written kind:argument.
+
+Conditions:
+  tag:<name>         the entry has the tag (after classification)
+  domain:<host>      the source URL is on the domain or a subdomain
+  source:<type>      the source type (note, url, file, clip)
+  contains:<text>    the content contains the text
+
+Actions:
+  tag:<name>         add a tag
+  remind:<delay>     remind of the entry (kb due) after 30d, 2w, 12h...,
+                     unless it has a reminder due sooner
+  webhook:<url>      POST the entry as JSON to the URL, in the background
+
+Each rule fires at most once per entry. Examples:
+
+  kb rules add invoices --when tag:invoice --then remind:30d --then webhook:https://example.com/hook
+  kb rules add papers --when domain:arxiv.org --then tag:paper
+
+Rules can also be kept in a YAML file, loaded with kb rules load:
+
+  - name: invoices
+    when: tag:invoice
+    then: [remind:30d, webhook:https://example.com/hook]
+  - name: papers
+    when: domain:arxiv.org
+    then: [tag:paper]
+    disabled: true`,
+	}
+
+	var when string
+	var then []string
+	add := &cobra.Command{
+		Use:   "add [name]",
+		Short: "Add a rule",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			if _, _, err := rules.ParseCondition(when); err != nil {
+				return err
+			}
+			if len(then) == 0 {
+				return fmt.Errorf("at least one --then action is required")
+			}
+			for _, action := range then {
+				if _, _, err := rules.ParseAction(action); err != nil {
+					return err
+				}
+			}
+
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			r, err := s.AddRule(ctx, args[0], when, then)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Added rule %s (%s)\n", r.Name, short(r.ID))
+			return nil
+		},
+	}
+	add.Flags().StringVar(&when, "when", "", "condition, e.g. tag:invoice or domain:arxiv.org")
+	add.Flags().StringArrayVar(&then, "then", nil, "action, e.g. tag:paper, remind:30d or webhook:<url> (repeatable)")
+	cmd.AddCommand(add)
+
+	var prune bool
+	load := &cobra.Command{
+		Use:   "load [file]",
+		Short: "Add or update rules from a YAML file",
+		Long: `Add the rules of a YAML file (see kb rules --help), updating those of
+the same name. With --prune, rules not in the file are deleted, making
+the file the whole set of rules.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return err
+			}
+			loaded, err := rules.ParseFile(data)
+			if err != nil {
+				return fmt.Errorf("%s: %w", args[0], err)
+			}
+
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			added, updated, deleted, err := s.SaveRules(ctx, loaded, prune)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Loaded %d rules: %d added, %d updated", len(loaded), added, updated)
+			if prune {
+				fmt.Printf(", %d deleted", deleted)
+			}
+			fmt.Println()
+			return nil
+		},
+	}
+	load.Flags().BoolVar(&prune, "prune", false, "delete the rules not in the file")
+	cmd.AddCommand(load)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List rules",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			all, err := s.ListRules(ctx)
+			if err != nil {
+				return err
+			}
+			if len(all) == 0 {
+				fmt.Println("No rules yet. Use 'kb rules add' to create one.")
+				return nil
+			}
+
+			for _, r := range all {
+				status := ""
+				if !r.Enabled {
+					status = " (disabled)"
+				}
+				fmt.Printf("%s  %s%s\n  when %s\n  then %s\n", short(r.ID), r.Name, status, r.Condition, strings.Join(r.Actions, ", "))
+			}
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "rm [name or id]",
+		Short: "Delete a rule",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			if err := s.DeleteRule(ctx, args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("Deleted rule %s\n", args[0])
+			return nil
+		},
+	})
+
+	for _, enabled := range []bool{true, false} {
+		use, short := "enable", "Enable a rule"
+		if !enabled {
+			use, short = "disable", "Disable a rule without deleting it"
+		}
+		cmd.AddCommand(&cobra.Command{
+			Use:   use + " [name or id]",
+			Short: short,
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				ctx := cmd.Context()
+				s, err := getStore(ctx)
+				if err != nil {
+					return err
+				}
+				defer s.Close()
+
+				if err := s.SetRuleEnabled(ctx, args[0], enabled); err != nil {
+					return err
+				}
+				fmt.Printf("Rule %s %sd\n", args[0], use)
+				return nil
+			},
+		})
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "run [entry id]",
+		Short: "Run rules on an existing entry",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			id, err := resolveEntryID(ctx, s, args[0])
+			if err != nil {
+				return err
+			}
+			applyRules(ctx, s, id)
+			return nil
+		},
+	})
+
+	return cmd
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/spf13/cobra"
+)
+
+func scratchCmd() *cobra.Command {
+	var days int
+	var list bool
+
+	cmd := &cobra.Command{
+		Use:   "scratch [content | -]",
+		Short: "Jot down a temporary thought that expires unless kept",
+		Long: `Jot down a temporary thought.
+
+Scratch entries aren't classified, are left out of search (unless
+--scratch) and suggestions, and move to the trash after --days days
+unless promoted with "kb keep". Restoring one from the trash keeps it.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			if list {
+				entries, err := s.ListScratchEntries(ctx)
+				if err != nil {
+					return err
+				}
+				if len(entries) == 0 {
+					fmt.Println("No scratch entries.")
+					return nil
+				}
+				for _, e := range entries {
+					fmt.Printf("%s  %s%s\n", short(e.ID), truncate(e.DisplayTitle(), 60), scratchMark(&e))
+				}
+				return nil
+			}
+
+			if len(args) == 0 {
+				return fmt.Errorf("requires content, or \"-\" for stdin")
+			}
+			if days < 1 {
+				return fmt.Errorf("--days must be at least 1")
+			}
+			content, err := readInput(args, "")
+			if err != nil {
+				return err
+			}
+			if content == "" {
+				return fmt.Errorf("no content to add")
+			}
+
+			entry, err := s.AddScratchEntry(ctx, content, time.Duration(days)*24*time.Hour)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Scratched %s, expires %s (kb keep %s to keep it)\n",
+				short(entry.ID), entry.ExpiresAt.Local().Format("2006-01-02"), short(entry.ID))
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&days, "days", 7, "days before the entry expires")
+	cmd.Flags().BoolVar(&list, "list", false, "list scratch entries")
+	return cmd
+}
+
+func keepCmd() *cobra.Command {
+	var noClassify bool
+
+	cmd := &cobra.Command{
+		Use:   "keep [id]",
+		Short: "Promote a scratch entry to a permanent one",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			id, err := resolveEntryID(ctx, s, args[0])
+			if err != nil {
+				return err
+			}
+			if err := s.KeepEntry(ctx, id); err != nil {
+				return err
+			}
+			fmt.Printf("Kept %s\n", short(id))
+
+			// It now gets what any added entry gets
+			entry, err := s.GetEntry(ctx, id)
+			if err != nil {
+				return err
+			}
+			if !noClassify {
+				classifyEntry(ctx, s, id, entry.Content)
+			}
+			applyRules(ctx, s, id)
+			embedEntry(ctx, s, id, entry.Content)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&noClassify, "no-classify", false, "skip automatic classification")
+	return cmd
+}
+
+// scratchMark tells how long a scratch entry has left, for listings
+func scratchMark(e *domain.Entry) string {
+	if e.ExpiresAt == nil {
+		return ""
+	}
+	left := int(math.Ceil(time.Until(*e.ExpiresAt).Hours() / 24))
+	if left < 1 {
+		return "  (scratch, expiring)"
+	}
+	return fmt.Sprintf("  (scratch, %dd left)", left)
+}
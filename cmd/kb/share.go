@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/rules"
+	"github.com/spf13/cobra"
+)
+
+// shareBaseURL returns where kb serve is reached from outside, to build
+// links with: KB_PUBLIC_URL, or the default local address
+func shareBaseURL() string {
+	if v := os.Getenv("KB_PUBLIC_URL"); v != "" {
+		return strings.TrimSuffix(v, "/")
+	}
+	return "http://localhost:8080"
+}
+
+func shareCmd() *cobra.Command {
+	var tag, expires, baseURL string
+
+	cmd := &cobra.Command{
+		Use:   "share [id]",
+		Short: "Share an entry, or a tag's entries, as a read-only link",
+		Long: `Create a public read-only link to an entry, or with --tag to the entries of
+a tag and its sub-tags. kb serve renders it as a web page to anyone with
+the link, no token needed: links are signed, so they can't be guessed.
+With --expires, the link stops working after that time.
+
+Links point at --url, by default KB_PUBLIC_URL or http://localhost:8080:
+set it to where kb serve is reached from outside. Examples:
+
+  kb share 3f2a
+  kb share 3f2a --expires 7d
+  kb share --tag recipes
+  kb share list
+  kb share revoke <id>`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			if (len(args) == 1) == (tag != "") {
+				return fmt.Errorf("give an entry ID or --tag")
+			}
+			var expiresAt *time.Time
+			if expires != "" {
+				d, err := rules.ParseDelay(expires)
+				if err != nil {
+					return err
+				}
+				at := time.Now().Add(d)
+				expiresAt = &at
+			}
+
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			var share *domain.Share
+			if tag != "" {
+				share, err = s.ShareTag(ctx, tag, expiresAt)
+			} else {
+				var id string
+				if id, err = resolveEntryID(ctx, s, args[0]); err != nil {
+					return err
+				}
+				share, err = s.ShareEntry(ctx, id, expiresAt)
+			}
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				return printJSON(share)
+			}
+			fmt.Println(baseURL + "/s/" + share.Token)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&tag, "tag", "", "share the entries of this tag instead, by name or path (a/b/c)")
+	cmd.Flags().StringVar(&expires, "expires", "", "how long the link stays valid (e.g. 7d, 12h)")
+	cmd.PersistentFlags().StringVar(&baseURL, "url", shareBaseURL(), "address kb serve is reached at")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List shared links",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			shares, err := s.ListShares(ctx)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				return printJSON(shares)
+			}
+			if len(shares) == 0 {
+				fmt.Println("Nothing shared. Share an entry with: kb share <id>")
+				return nil
+			}
+			for _, sh := range shares {
+				what := "entry " + short(sh.EntryID)
+				if sh.Tag != "" {
+					what = "tag " + sh.Tag
+				}
+				status := ""
+				if sh.ExpiresAt != nil {
+					status = "  expires " + sh.ExpiresAt.Local().Format("2006-01-02 15:04")
+					if sh.ExpiresAt.Before(time.Now()) {
+						status = "  (expired)"
+					}
+				}
+				fmt.Printf("%s  %-24s created %s%s\n  %s/s/%s\n",
+					sh.ID, what, sh.CreatedAt.Format("2006-01-02"), status, baseURL, sh.Token)
+			}
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "revoke [id or link]",
+		Short: "Revoke a link",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			// Accept the whole link too
+			ref := args[0]
+			if i := strings.LastIndex(ref, "/s/"); i >= 0 {
+				ref = ref[i+len("/s/"):]
+			}
+			if err := s.DeleteShare(ctx, ref); err != nil {
+				return err
+			}
+			fmt.Println("Revoked")
+			return nil
+		},
+	})
+
+	return cmd
+}
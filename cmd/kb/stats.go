@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/store"
+	"github.com/spf13/cobra"
+)
+
+// unreliablePrecision flags tags whose automatic assignments are often removed
+const unreliablePrecision = 0.6
+
+// neglectedMinEntries is how many entries a tag needs before going unviewed
+// makes it a neglected area
+const neglectedMinEntries = 3
+
+func statsCmd() *cobra.Command {
+	var tagsQuality, recompute, tagActivity, dbTimings, storage, compact bool
+	var weeks, top int
+
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Show knowledge base statistics",
+		Long: `Show knowledge base statistics: entries, embedding and classification
+coverage, database size, entries per tag (totals include child tags),
+entries added per week, maturity, workflows and the most and least viewed
+entries. With --json, the same as GET /stats.
+
+With --db-timings, the statistics and the latest entries are read and the time
+their database statements took is shown per store method, to see how
+the database copes as it grows. The server exports the same timings,
+with error counts, at /metrics; --slow-query logs the slowest
+statements.
+
+With --storage, the space taken is broken down: database content, past
+versions, embeddings, attachments and the trash, with the largest
+entries (--top of them). Soft quotas set in KB_QUOTA_DB and
+KB_QUOTA_ATTACHMENTS (e.g. 500MB, 2GiB) add a warning with ways to make
+room when exceeded; --compact first reclaims the database's free space.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			if storage {
+				return printStorage(ctx, s, top, compact)
+			}
+			if dbTimings {
+				return printDBTimings(ctx, s, weeks, top)
+			}
+
+			monthAgo := time.Now().AddDate(0, 0, -30)
+			if tagActivity {
+				activity, err := s.TagActivity(ctx, monthAgo)
+				if err != nil {
+					return err
+				}
+				if len(activity) == 0 {
+					fmt.Println("No tagged entries yet.")
+					return nil
+				}
+				fmt.Printf("%-24s %7s %9s  %s\n", "TAG", "ENTRIES", "VIEWS/30D", "LAST VIEWED")
+				for _, a := range activity {
+					fmt.Printf("%-24s %7d %9d  %s\n", truncate(a.Tag, 24), a.Entries, a.Views, lastViewed(a.LastViewedAt))
+				}
+				return nil
+			}
+
+			if !tagsQuality {
+				return printStats(ctx, s, weeks, top)
+			}
+
+			if recompute {
+				if _, err := s.RecomputeTagCalibration(ctx); err != nil {
+					return err
+				}
+			}
+
+			quality, err := s.TagQuality(ctx)
+			if err != nil {
+				return err
+			}
+			if len(quality) == 0 {
+				fmt.Println("No tag feedback yet. Correct tags with 'kb tag add/rm', then run with --recompute.")
+				return nil
+			}
+
+			fmt.Printf("%-24s %6s %8s %6s %10s\n", "TAG", "KEPT", "REMOVED", "ADDED", "PRECISION")
+			for _, q := range quality {
+				flag := ""
+				if q.Kept+q.Removed >= store.MinCalibrationSamples && q.Precision < unreliablePrecision {
+					flag = "  unreliable"
+				}
+				fmt.Printf("%-24s %6d %8d %6d %9.0f%%%s\n", truncate(q.Tag, 24), q.Kept, q.Removed, q.Added, q.Precision*100, flag)
+			}
+			fmt.Printf("\nComputed %s. Precision is smoothed; tags need %d kept/removed samples before it scales confidences.\n",
+				quality[0].UpdatedAt.Format("2006-01-02 15:04"), store.MinCalibrationSamples)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&tagsQuality, "tags-quality", false, "show per-tag precision of automatic tagging")
+	cmd.Flags().BoolVar(&recompute, "recompute", false, "recompute tag precision before showing it")
+	cmd.Flags().IntVar(&weeks, "weeks", 8, "number of weeks of additions to show")
+	cmd.Flags().IntVar(&top, "top", 5, "number of most and least viewed entries to show")
+	cmd.Flags().BoolVar(&tagActivity, "tag-activity", false, "show entries, recent views and last view per tag")
+	cmd.Flags().BoolVar(&storage, "storage", false, "show the space taken by content, versions, embeddings, attachments and the largest entries")
+	cmd.Flags().BoolVar(&compact, "compact", false, "with --storage, reclaim the database's free space first")
+	cmd.Flags().BoolVar(&dbTimings, "db-timings", false, "show database statement timings per store method")
+	return cmd
+}
+
+// printStats prints the default statistics overview
+func printStats(ctx context.Context, s *store.Store, weeks, top int) error {
+	st, err := s.Stats(ctx, weeks, top)
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		return printJSON(st)
+	}
+
+	if st.Notebook != "" {
+		fmt.Printf("Notebook:    %s\n", st.Notebook)
+	}
+	fmt.Printf("Entries:     %d", st.Entries)
+	if st.Scratch > 0 {
+		fmt.Printf(" (+%d scratch)", st.Scratch)
+	}
+	if st.Archived > 0 {
+		fmt.Printf(", %d archived", st.Archived)
+	}
+	if st.Trash > 0 {
+		fmt.Printf(", %d in the trash", st.Trash)
+	}
+	fmt.Printf("\nEmbedded:    %d (%.0f%%)\n", st.Embedded, st.Coverage(st.Embedded)*100)
+	fmt.Printf("Classified:  %d (%.0f%%)\n", st.Classified, st.Coverage(st.Classified)*100)
+	fmt.Printf("Tags:        %d\n", len(st.Tags))
+	fmt.Printf("Database:    %s\n", formatBytes(st.DBSize))
+
+	if len(st.Tags) > 0 {
+		fmt.Printf("\n%-28s %7s %7s\n", "TAG", "ENTRIES", "TOTAL")
+		for _, t := range st.Tags {
+			name := strings.Repeat("  ", t.Depth) + t.Tag
+			fmt.Printf("%-28s %7d %7d\n", truncate(name, 28), t.Entries, t.Total)
+		}
+	}
+
+	if len(st.EntriesPerWeek) > 0 {
+		fmt.Println("\nAdded per week:")
+		printBars(st.EntriesPerWeek)
+	}
+
+	fmt.Println("\nMaturity:")
+	for _, level := range domain.MaturityLevels {
+		fmt.Printf("  %-11s %d\n", level, st.Maturity[level])
+	}
+	printWorkflowCounts(st.Workflows)
+
+	printViewed("Most viewed:", st.MostViewed)
+	printViewed("Least viewed:", st.LeastViewed)
+
+	monthAgo := time.Now().AddDate(0, 0, -30)
+	neglected, err := s.NeglectedTags(ctx, monthAgo, neglectedMinEntries, 5)
+	if err != nil {
+		return err
+	}
+	if len(neglected) > 0 {
+		fmt.Println("\nNeglected (no views in 30 days):")
+		for _, a := range neglected {
+			fmt.Printf("  %-24s %d entries, last viewed %s\n", truncate(a.Tag, 24), a.Entries, lastViewed(a.LastViewedAt))
+		}
+		fmt.Println("  Revisit one with 'kb review --stale --tag <tag>'.")
+	}
+
+	if len(st.Cache) > 0 {
+		fmt.Println("\nAPI cache:")
+		for _, c := range st.Cache {
+			fmt.Printf("  %-15s %d cached, %d hits (%.0f%% of lookups)\n", c.Kind, c.Entries, c.Hits, c.HitRate()*100)
+		}
+	}
+	return nil
+}
+
+// printDBTimings reads the statistics and the latest entries, then prints
+// the time their statements took per store method
+func printDBTimings(ctx context.Context, s *store.Store, weeks, top int) error {
+	st, err := s.Stats(ctx, weeks, top)
+	if err != nil {
+		return err
+	}
+	if _, err := s.ListEntries(ctx, "", 20, 0); err != nil {
+		return err
+	}
+	if _, err := s.ListTags(ctx); err != nil {
+		return err
+	}
+	queries := store.QueryStats()
+	if jsonOutput {
+		return printJSON(map[string]interface{}{"db_size": st.DBSize, "entries": st.Entries, "queries": queries})
+	}
+
+	fmt.Printf("Database %s: %s, %d entries\n\n", s.Path(), formatBytes(st.DBSize), st.Entries)
+	fmt.Printf("%-28s %7s %7s %10s %10s %10s\n", "METHOD", "QUERIES", "ERRORS", "TOTAL", "AVERAGE", "MAX")
+	for _, q := range queries {
+		fmt.Printf("%-28s %7d %7d %10s %10s %10s\n", truncate(q.Method, 28), q.Calls, q.Errors,
+			formatDuration(q.Total), formatDuration(q.Total/time.Duration(max(q.Calls, 1))), formatDuration(q.Max))
+	}
+	return nil
+}
+
+// formatDuration renders a statement duration in milliseconds
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("%.2fms", float64(d.Microseconds())/1000)
+}
+
+func printBars(points []domain.TimePoint) {
+	most := 0
+	for _, p := range points {
+		most = max(most, p.Count)
+	}
+	for _, p := range points {
+		bar := strings.Repeat("█", (p.Count*30+most-1)/max(most, 1))
+		fmt.Printf("  %-10s %4d  %s\n", p.Bucket, p.Count, bar)
+	}
+}
+
+func printViewed(title string, entries []store.ViewedEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	fmt.Printf("\n%s\n", title)
+	for _, v := range entries {
+		fmt.Printf("  %s  %4d views  %s\n", short(v.Entry.ID), v.Views, truncate(v.Entry.DisplayTitle(), 50))
+	}
+}
+
+// formatBytes renders a size with a binary unit
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func lastViewed(t *time.Time) string {
+	if t == nil {
+		return "never"
+	}
+	return t.Format("2006-01-02")
+}
+
+// printWorkflowCounts shows each workflow as a pipeline with a bar per state
+func printWorkflowCounts(counts []domain.WorkflowCount) {
+	most := 0
+	for _, c := range counts {
+		most = max(most, c.Entries)
+	}
+	workflow := ""
+	for _, c := range counts {
+		if c.Workflow != workflow {
+			workflow = c.Workflow
+			fmt.Printf("\nWorkflow %s:\n", workflow)
+		}
+		bar := ""
+		if most > 0 {
+			bar = strings.Repeat("█", (c.Entries*20+most-1)/most)
+		}
+		fmt.Println(strings.TrimRight(fmt.Sprintf("  %-11s %4d  %s", truncate(c.State, 11), c.Entries, bar), " "))
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pbaille/kb/internal/blobs"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// Soft quotas, sizes such as 500MB or 2GiB: exceeding one only warns
+const (
+	dbQuotaEnv          = "KB_QUOTA_DB"
+	attachmentsQuotaEnv = "KB_QUOTA_ATTACHMENTS"
+)
+
+// storageReport is what kb stats --storage prints
+type storageReport struct {
+	*store.Storage
+	// BlobFiles and BlobSize are the attachment files on disk, those no
+	// entry refers to anymore included
+	BlobFiles int      `json:"blob_files"`
+	BlobSize  int64    `json:"blob_size"`
+	Warnings  []string `json:"warnings,omitempty"`
+}
+
+// printStorage reports what the database and attachments take, warning
+// when they exceed their soft quota
+func printStorage(ctx context.Context, s *store.Store, top int, compact bool) error {
+	if jsonOutput {
+		defer humanToStderr()()
+	}
+	if compact {
+		before, err := s.Size(ctx)
+		if err != nil {
+			return err
+		}
+		if err := s.Compact(ctx); err != nil {
+			return err
+		}
+		after, err := s.Size(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Compacted the database: %s → %s\n\n", formatBytes(before), formatBytes(after))
+	}
+
+	st, err := s.Storage(ctx, top)
+	if err != nil {
+		return err
+	}
+	report := storageReport{Storage: st}
+	if report.BlobFiles, report.BlobSize, err = blobs.ForDir(s.Dir()).Usage(); err != nil {
+		return err
+	}
+	if report.Warnings, err = quotaWarnings(report); err != nil {
+		return err
+	}
+	if jsonOutput {
+		return printJSON(report)
+	}
+
+	fmt.Printf("Database:     %s", formatBytes(st.DBSize))
+	if st.FreeSize > 0 {
+		fmt.Printf(" (%s free)", formatBytes(st.FreeSize))
+	}
+	fmt.Printf("\n  Content:    %s\n", formatBytes(st.ContentSize))
+	fmt.Printf("  Versions:   %s\n", formatBytes(st.VersionsSize))
+	fmt.Printf("  Embeddings: %s\n", formatBytes(st.EmbeddingsSize))
+	fmt.Printf("Attachments:  %s in %d files", formatBytes(report.BlobSize), report.BlobFiles)
+	if st.AttachmentsSize < report.BlobSize {
+		fmt.Printf(" (%s attached to entries)", formatBytes(st.AttachmentsSize))
+	}
+	fmt.Println()
+	if st.Trash > 0 {
+		fmt.Printf("Trash:        %d entries, %s\n", st.Trash, formatBytes(st.TrashSize))
+	}
+
+	if len(st.Largest) > 0 {
+		fmt.Printf("\n%-10s %10s %10s %10s %11s  %s\n", "ENTRY", "TOTAL", "CONTENT", "VERSIONS", "ATTACHMENTS", "TITLE")
+		for _, es := range st.Largest {
+			title := es.Entry.DisplayTitle()
+			if es.Entry.DeletedAt != nil {
+				title = "(trash) " + title
+			}
+			fmt.Printf("%-10s %10s %10s %10s %11s  %s\n", short(es.Entry.ID), formatBytes(es.Total()),
+				formatBytes(es.ContentSize), formatBytes(es.VersionsSize), formatBytes(es.AttachmentsSize), truncate(title, 40))
+		}
+	}
+
+	for _, w := range report.Warnings {
+		fmt.Printf("\nWarning: %s\n", w)
+	}
+	return nil
+}
+
+// quotaWarnings returns a warning, with what to do about it, for each soft
+// quota exceeded
+func quotaWarnings(r storageReport) ([]string, error) {
+	var warnings []string
+	if quota, err := quotaFromEnv(dbQuotaEnv); err != nil {
+		return nil, err
+	} else if quota > 0 && r.DBSize > quota {
+		var advice []string
+		if r.Trash > 0 {
+			advice = append(advice, fmt.Sprintf("empty the trash with 'kb trash purge' (%d entries, %s)", r.Trash, formatBytes(r.TrashSize)))
+		}
+		advice = append(advice, "keep old entries outside the database with 'kb export', then 'kb delete' them and purge the trash")
+		if r.FreeSize > 0 {
+			advice = append(advice, fmt.Sprintf("reclaim %s of free space with 'kb stats --storage --compact'", formatBytes(r.FreeSize)))
+		}
+		warnings = append(warnings, fmt.Sprintf("the database takes %s, over its soft quota of %s (%s). To make room:\n  - %s",
+			formatBytes(r.DBSize), formatBytes(quota), dbQuotaEnv, strings.Join(advice, "\n  - ")))
+	}
+	if quota, err := quotaFromEnv(attachmentsQuotaEnv); err != nil {
+		return nil, err
+	} else if quota > 0 && r.BlobSize > quota {
+		warnings = append(warnings, fmt.Sprintf("attachments take %s, over their soft quota of %s (%s). Compress large images and PDFs before attaching them, or delete the entries holding the largest ones.",
+			formatBytes(r.BlobSize), formatBytes(quota), attachmentsQuotaEnv))
+	}
+	return warnings, nil
+}
+
+// quotaFromEnv reads a size from an environment variable, 0 when unset
+func quotaFromEnv(name string) (int64, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0, nil
+	}
+	size, err := parseSize(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	return size, nil
+}
+
+// parseSize reads a size in bytes with an optional unit: KB, MB, GB (powers
+// of 1000), KiB, MiB, GiB (powers of 1024), or K, M, G taken as binary
+func parseSize(v string) (int64, error) {
+	units := []struct {
+		suffix string
+		factor int64
+	}{
+		{"kib", 1 << 10}, {"mib", 1 << 20}, {"gib", 1 << 30}, {"tib", 1 << 40},
+		{"kb", 1e3}, {"mb", 1e6}, {"gb", 1e9}, {"tb", 1e12},
+		{"k", 1 << 10}, {"m", 1 << 20}, {"g", 1 << 30}, {"t", 1 << 40},
+		{"b", 1},
+	}
+	s := strings.ToLower(strings.TrimSpace(v))
+	factor := int64(1)
+	for _, u := range units {
+		if rest, ok := strings.CutSuffix(s, u.suffix); ok {
+			s, factor = strings.TrimSpace(rest), u.factor
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (e.g. 500MB or 2GiB)", v)
+	}
+	return int64(n * float64(factor)), nil
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pbaille/kb/internal/api"
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/gitsync"
+	"github.com/pbaille/kb/internal/store"
+	"github.com/spf13/cobra"
+)
+
+// remoteSetting holds the server kb sync uses without --remote
+const remoteSetting = "sync.remote"
+
+func syncCmd() *cobra.Command {
+	var remote, token, gitDir string
+	var conflicts, rebuild bool
+
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Sync entries with a remote kb server or a git repository",
+		Long: `Sync this database with a kb server (kb serve) shared between machines:
+changes made on the server since the last sync are pulled, then local
+changes pushed. The remote is remembered, so later syncs need no
+--remote. The token (--token or KB_REMOTE_TOKEN) needs write scope.
+
+Entries are synced with their source, maturity, notebook, archive and
+trash state, and tags, with how sure the classifier was of them; purged
+entries are purged on the other side too. Tags (their names, parents,
+descriptions and colors) and links between entries sync on their own,
+so renaming, moving or deleting a tag propagates. Views, past versions,
+reviews, workflows and embeddings stay local, and entries encrypted by
+the database or a notebook aren't synced.
+
+An entry changed on both sides between two syncs keeps the latest
+change; the version that lost is logged, and listed by --conflicts.
+Tags and links keep the latest change without logging.
+
+With --git, the database is mirrored instead to a git repository
+(created if needed) as one Markdown file per entry, under entries/, with
+its tags, source and timestamps in a YAML frontmatter, and YAML files
+for tags, under tags/, and links, under links/. Each sync
+commits what changed; files edited, added or removed in the repository
+since the last sync, by hand or by pulling another machine's commits,
+are brought into the database first. Pushing and pulling the repository
+is left to git. Syncing a new database with a repository rebuilds it
+from the files; --rebuild reads every file again.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			if conflicts {
+				return printSyncConflicts(ctx, s)
+			}
+			if gitDir != "" {
+				return syncGit(ctx, s, gitDir, rebuild)
+			}
+			if rebuild {
+				return fmt.Errorf("--rebuild needs --git")
+			}
+
+			if remote == "" {
+				if remote, err = s.GetSetting(ctx, remoteSetting); err != nil {
+					return err
+				}
+				if remote == "" {
+					return fmt.Errorf("no remote: pass --remote URL")
+				}
+			}
+			remote = strings.TrimRight(remote, "/")
+			if token == "" {
+				token = os.Getenv("KB_REMOTE_TOKEN")
+			}
+			r := &syncRemote{url: remote, token: token, client: &http.Client{Timeout: time.Minute}}
+
+			pulled, pushed, err := syncWith(ctx, s, r)
+			if err != nil {
+				return err
+			}
+			if err := s.SetSetting(ctx, remoteSetting, remote); err != nil {
+				return err
+			}
+
+			fmt.Printf("Pulled %d changes, pushed %d to %s\n", len(pulled.Applied), len(pushed.Applied), remote)
+			if pulled.Conflicts > 0 {
+				fmt.Printf("%d conflicts resolved here (kb sync --conflicts)\n", pulled.Conflicts)
+			}
+			if pushed.Conflicts > 0 {
+				fmt.Printf("%d conflicts resolved on the remote (GET %s/sync/conflicts)\n", pushed.Conflicts, remote)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&remote, "remote", "", "URL of the kb server to sync with")
+	cmd.Flags().StringVar(&token, "token", "", "API token for the remote (default KB_REMOTE_TOKEN)")
+	cmd.Flags().BoolVar(&conflicts, "conflicts", false, "list conflicts resolved by past syncs")
+	cmd.Flags().StringVar(&gitDir, "git", "", "git repository to mirror the database to, as Markdown files")
+	cmd.Flags().BoolVar(&rebuild, "rebuild", false, "with --git, read every file of the repository again")
+	return cmd
+}
+
+// syncWith pulls a remote's changes, then pushes local ones, moving the
+// cursors kept for it after each page
+func syncWith(ctx context.Context, s *store.Store, r *syncRemote) (pulled, pushed *store.SyncResult, err error) {
+	device, err := s.DeviceID(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	pulledSeq, err := s.SyncCursor(ctx, r.url, "pulled")
+	if err != nil {
+		return nil, nil, err
+	}
+	pushedSeq, err := s.SyncCursor(ctx, r.url, "pushed")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pulled = &store.SyncResult{}
+	for {
+		page, err := r.changes(ctx, pulledSeq, device)
+		if err != nil {
+			return nil, nil, err
+		}
+		result, err := s.ApplySyncChanges(ctx, r.url, pushedSeq, page.Changes)
+		if err != nil {
+			return nil, nil, err
+		}
+		embedSynced(ctx, s, page.Changes, result.Applied)
+		pulled.Applied = append(pulled.Applied, result.Applied...)
+		pulled.Conflicts += result.Conflicts
+
+		pulledSeq = page.Cursor
+		if err := s.SetSyncCursor(ctx, r.url, "pulled", pulledSeq); err != nil {
+			return nil, nil, err
+		}
+		if !page.More {
+			break
+		}
+	}
+
+	pushed = &store.SyncResult{}
+	for {
+		changes, cursor, more, err := s.SyncChanges(ctx, pushedSeq, r.url, 500)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(changes) > 0 {
+			result, err := r.push(ctx, api.SyncPushRequest{Device: device, Pulled: pulledSeq, Changes: changes})
+			if err != nil {
+				return nil, nil, err
+			}
+			pushed.Applied = append(pushed.Applied, result.Applied...)
+			pushed.Conflicts += result.Conflicts
+		}
+
+		pushedSeq = cursor
+		if err := s.SetSyncCursor(ctx, r.url, "pushed", pushedSeq); err != nil {
+			return nil, nil, err
+		}
+		if !more {
+			break
+		}
+	}
+	return pulled, pushed, nil
+}
+
+// syncGit brings the entry files changed in a repository since the last
+// sync into the database, then writes and commits the local changes
+func syncGit(ctx context.Context, s *store.Store, dir string, rebuild bool) error {
+	repo, err := gitsync.Open(dir)
+	if err != nil {
+		return err
+	}
+	peer := "git:" + repo.Dir()
+	commitSetting := "sync." + peer + ".commit"
+
+	pushedSeq, err := s.SyncCursor(ctx, peer, "pushed")
+	if err != nil {
+		return err
+	}
+	commit, err := s.GetSetting(ctx, commitSetting)
+	if err != nil {
+		return err
+	}
+
+	changes, err := repo.Changes(commit)
+	if err != nil {
+		return err
+	}
+	if rebuild && commit != "" {
+		all, err := repo.Changes("")
+		if err != nil {
+			return err
+		}
+		changed := make(map[string]bool, len(changes))
+		for _, c := range changes {
+			changed[c.ID] = true
+		}
+		for _, c := range all {
+			if !changed[c.ID] {
+				changes = append(changes, c)
+			}
+		}
+	}
+	pulled, err := s.ApplySyncChanges(ctx, peer, pushedSeq, changes)
+	if err != nil {
+		return err
+	}
+	embedSynced(ctx, s, changes, pulled.Applied)
+
+	written := 0
+	for {
+		changes, cursor, more, err := s.SyncChanges(ctx, pushedSeq, peer, 500)
+		if err != nil {
+			return err
+		}
+		for _, c := range changes {
+			if err := repo.Write(c); err != nil {
+				return err
+			}
+		}
+		written += len(changes)
+		pushedSeq = cursor
+		if !more {
+			break
+		}
+	}
+
+	message := "kb sync"
+	if written > 0 {
+		message = fmt.Sprintf("kb sync: %d records written", written)
+	}
+	head, err := repo.Commit(message)
+	if err != nil {
+		return err
+	}
+	if err := s.SetSyncCursor(ctx, peer, "pushed", pushedSeq); err != nil {
+		return err
+	}
+	if err := s.SetSetting(ctx, commitSetting, head); err != nil {
+		return err
+	}
+
+	fmt.Printf("Read %d changes from %s, wrote %d", len(pulled.Applied), repo.Dir(), written)
+	if head != "" {
+		fmt.Printf(" (at %s)", head[:min(len(head), 8)])
+	}
+	fmt.Println()
+	if pulled.Conflicts > 0 {
+		fmt.Printf("%d conflicts resolved (kb sync --conflicts)\n", pulled.Conflicts)
+	}
+	return nil
+}
+
+// embedSynced computes the embeddings of the pulled entries applied here
+func embedSynced(ctx context.Context, s *store.Store, changes []domain.SyncChange, applied []string) {
+	ids := make(map[string]bool, len(applied))
+	for _, id := range applied {
+		ids[id] = true
+	}
+	emb := newEmbedPipeline(ctx, s)
+	if emb == nil {
+		return
+	}
+	for _, c := range changes {
+		if ids[c.ID] && c.Entry != nil {
+			emb.Add(c.ID, c.Entry.Content)
+		}
+	}
+	waitEmbeddings(emb)
+}
+
+func printSyncConflicts(ctx context.Context, s *store.Store) error {
+	conflicts, err := s.SyncConflicts(ctx, 50)
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		return printJSON(conflicts)
+	}
+	if len(conflicts) == 0 {
+		fmt.Println("No sync conflicts.")
+		return nil
+	}
+	for _, c := range conflicts {
+		lost := truncate(c.LostTitle, 40)
+		switch {
+		case c.LostDeleted:
+			lost = "(purged)"
+		case lost == "":
+			lost = truncate(strings.Join(strings.Fields(c.LostContent), " "), 40)
+		}
+		fmt.Printf("%s  %s  kept %s (%s), lost %s: %s\n", c.CreatedAt.Local().Format("2006-01-02 15:04"), short(c.EntryID),
+			c.Kept, c.KeptChangedAt.Local().Format("2006-01-02 15:04:05"), c.LostChangedAt.Local().Format("2006-01-02 15:04:05"), lost)
+	}
+	return nil
+}
+
+// syncRemote is the kb server a database syncs with
+type syncRemote struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// changes pulls a page of the remote's changes after a cursor
+func (r *syncRemote) changes(ctx context.Context, after int64, device string) (*api.SyncChangesResponse, error) {
+	q := url.Values{"after": {strconv.FormatInt(after, 10)}, "device": {device}}
+	var page api.SyncChangesResponse
+	if err := r.do(ctx, "GET", "/sync/changes?"+q.Encode(), nil, &page); err != nil {
+		return nil, fmt.Errorf("pull changes: %w", err)
+	}
+	return &page, nil
+}
+
+// push sends local changes to the remote
+func (r *syncRemote) push(ctx context.Context, req api.SyncPushRequest) (*store.SyncResult, error) {
+	var result store.SyncResult
+	if err := r.do(ctx, "POST", "/sync/changes", req, &result); err != nil {
+		return nil, fmt.Errorf("push changes: %w", err)
+	}
+	return &result, nil
+}
+
+func (r *syncRemote) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, r.url+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		if apiErr.Error == "" {
+			apiErr.Error = resp.Status
+		}
+		return fmt.Errorf("%s: %s", r.url, apiErr.Error)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/spf13/cobra"
+)
+
+func tagCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tag",
+		Short: "Correct the tags of an entry",
+		Long: `Correct the tags of an entry.
+
+Corrections are remembered as feedback: removing an automatically assigned
+tag lowers that tag's measured precision, which scales down the confidence
+of future suggestions (see kb stats --tags-quality).
+
+Tag names are normalized: lowercase, words joined by hyphens. Aliases
+give a tag other names, so "golang" tags with "go" (see kb tag alias).
+Wherever a tag is named, it can also be given by its path from one of
+its ancestors: programming/golang/concurrency.`,
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "add [entry id] [tag...]",
+		Short: "Add tags to an entry",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			id, err := resolveEntryID(ctx, s, args[0])
+			if err != nil {
+				return err
+			}
+
+			for _, name := range args[1:] {
+				tag, err := s.GetOrCreateTag(ctx, name, nil)
+				if err != nil {
+					return err
+				}
+				if err := s.TagByHuman(ctx, id, tag.ID); err != nil {
+					return err
+				}
+				fmt.Printf("  + %s\n", tag.Name)
+			}
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "rm [entry id] [tag...]",
+		Short: "Remove tags from an entry",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			id, err := resolveEntryID(ctx, s, args[0])
+			if err != nil {
+				return err
+			}
+
+			for _, name := range args[1:] {
+				tag, err := s.GetTagByName(ctx, name)
+				if err != nil {
+					return err
+				}
+				if err := s.UntagByHuman(ctx, id, tag.ID); err != nil {
+					return fmt.Errorf("%s: %w", name, err)
+				}
+				fmt.Printf("  - %s\n", tag.Name)
+			}
+			return nil
+		},
+	})
+
+	cmd.AddCommand(tagEditCmd())
+	cmd.AddCommand(tagAliasCmd())
+	return cmd
+}
+
+func tagEditCmd() *cobra.Command {
+	var description, color string
+
+	cmd := &cobra.Command{
+		Use:   "edit [tag]",
+		Short: "Describe a tag or give it a color",
+		Long: `Describe a tag or give it a color. The classifier is shown the
+descriptions of the tags, which helps it reuse them for the right
+entries; colors are for interfaces to show tags in.
+
+  kb tag edit go --description "The Go programming language and its tooling"
+  kb tag edit go --color "#00add8"
+  kb tag edit go --color ""   # remove the color`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var descriptionArg, colorArg *string
+			if cmd.Flags().Changed("description") {
+				descriptionArg = &description
+			}
+			if cmd.Flags().Changed("color") {
+				colorArg = &color
+			}
+			if descriptionArg == nil && colorArg == nil {
+				return fmt.Errorf("nothing to change: give --description or --color")
+			}
+
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			tag, err := s.SetTagDetails(ctx, args[0], descriptionArg, colorArg)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				return printJSON(tag)
+			}
+			fmt.Println(tag.Name)
+			if tag.Description != "" {
+				fmt.Printf("  description: %s\n", tag.Description)
+			}
+			if tag.Color != "" {
+				fmt.Printf("  color: %s\n", tag.Color)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&description, "description", "", "what the tag is for (\"\" to remove it)")
+	cmd.Flags().StringVar(&color, "color", "", "color to show the tag in, #rrggbb or #rgb (\"\" to remove it)")
+	return cmd
+}
+
+func tagAliasCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "alias",
+		Short: "Manage other names of tags",
+		Long: `Manage other names of tags. Tagging an entry with an alias, by hand or
+by the classifier, tags it with the alias's tag instead, and filtering by
+an alias filters by the tag. The classifier is shown the aliases of the
+tags so it answers with their names.
+
+A tag already named like the new alias is merged into the tag: its
+entries, sub-tags and feedback move over and it's deleted.
+
+  kb tag alias add go golang go-lang
+  kb tag alias rm go-lang`,
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "add [tag] [alias...]",
+		Short: "Give a tag other names",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			for _, alias := range args[1:] {
+				a, retagged, err := s.AddTagAlias(ctx, args[0], alias)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("%s -> %s", a.Alias, a.Tag)
+				if retagged > 0 {
+					fmt.Printf(" (merged, %d entries retagged)", retagged)
+				}
+				fmt.Println()
+			}
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List tag aliases",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			aliases, err := s.ListTagAliases(ctx)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				if aliases == nil {
+					aliases = []domain.TagAlias{}
+				}
+				return printJSON(aliases)
+			}
+			if len(aliases) == 0 {
+				fmt.Println("No tag aliases yet. Use 'kb tag alias add' to create one.")
+				return nil
+			}
+			for _, a := range aliases {
+				fmt.Printf("%s -> %s\n", a.Alias, a.Tag)
+			}
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "rm [alias...]",
+		Short: "Remove tag aliases",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			for _, alias := range args {
+				if err := s.RemoveTagAlias(ctx, alias); err != nil {
+					return err
+				}
+				fmt.Printf("Removed alias %s\n", alias)
+			}
+			return nil
+		},
+	})
+
+	return cmd
+}
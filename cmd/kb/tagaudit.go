@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/embedding"
+	"github.com/pbaille/kb/internal/store"
+	"github.com/spf13/cobra"
+)
+
+func tagsAuditCmd() *cobra.Command {
+	var minSimilarity float64
+	var report bool
+
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Find duplicate, single-use and misplaced tags",
+		Long: `Find the problems of the tag taxonomy:
+
+  - near-duplicates: names a typo or a plural apart ("recipe", "recipes"),
+    or, with an embedding key, names and descriptions meaning the same
+    ("ml", "machine-learning")
+  - tags on a single entry, likely too specific to be useful
+  - parent links going round in circles (a under b under a)
+  - tags whose parent no longer exists
+
+In a terminal, each fix is offered in turn: merging a duplicate into the
+tag on more entries (its name becomes an alias, see kb tag alias),
+detaching a tag to break a cycle, and giving orphans a new parent.
+
+  kb tags audit
+  kb tags audit --report --json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			var vectors map[string][]float64
+			if embSvc, err := embedding.New(); err != nil {
+				if !jsonOutput {
+					fmt.Printf("(duplicates by meaning skipped: %v)\n\n", err)
+				}
+			} else if vectors, err = tagVectors(ctx, s, embSvc); err != nil {
+				return err
+			}
+
+			audit, err := s.AuditTags(ctx, vectors, minSimilarity)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				return printJSON(audit)
+			}
+			if len(audit.Duplicates)+len(audit.SingleUse)+len(audit.Cycles)+len(audit.Orphans) == 0 {
+				fmt.Println("No problems found.")
+				return nil
+			}
+			if report || !isTerminal(os.Stdin) {
+				printTagAudit(audit)
+				return nil
+			}
+			return fixTags(ctx, s, audit)
+		},
+	}
+
+	cmd.Flags().Float64Var(&minSimilarity, "min-similarity", 0.9, "similarity of the embeddings of tags meaning the same")
+	cmd.Flags().BoolVar(&report, "report", false, "list the problems without offering fixes")
+	return cmd
+}
+
+// tagVectors embeds the names and descriptions of the tags, by tag id
+func tagVectors(ctx context.Context, s *store.Store, embSvc *embedding.Service) (map[string][]float64, error) {
+	tags, err := s.ListTags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	words := strings.NewReplacer("/", " ", "-", " ", "_", " ")
+	texts := make([]string, len(tags))
+	for i, t := range tags {
+		texts[i] = words.Replace(t.Name)
+		if t.Description != "" {
+			texts[i] += ": " + t.Description
+		}
+	}
+
+	vectors := make(map[string][]float64, len(tags))
+	for start := 0; start < len(texts); start += embedding.MaxBatchSize {
+		end := min(start+embedding.MaxBatchSize, len(texts))
+		batch, err := embSvc.EmbedBatch(ctx, texts[start:end])
+		if err != nil {
+			return nil, fmt.Errorf("embed tags: %w", err)
+		}
+		for i, v := range batch {
+			vectors[tags[start+i].ID] = v
+		}
+	}
+	return vectors, nil
+}
+
+func printTagAudit(audit *domain.TagAudit) {
+	if len(audit.Duplicates) > 0 {
+		fmt.Println("Near-duplicates:")
+		for _, d := range audit.Duplicates {
+			fmt.Printf("  %s\n", formatDuplicate(d))
+		}
+		fmt.Println()
+	}
+	if len(audit.Cycles) > 0 {
+		fmt.Println("Cycles:")
+		for _, c := range audit.Cycles {
+			fmt.Printf("  %s\n", formatCycle(c))
+		}
+		fmt.Println()
+	}
+	if len(audit.Orphans) > 0 {
+		fmt.Println("Parent missing:")
+		for _, name := range audit.Orphans {
+			fmt.Printf("  %s\n", name)
+		}
+		fmt.Println()
+	}
+	if len(audit.SingleUse) > 0 {
+		fmt.Printf("On a single entry (%d):\n", len(audit.SingleUse))
+		fmt.Printf("  %s\n", strings.Join(audit.SingleUse, ", "))
+	}
+}
+
+// fixTags walks through the problems found, asking whether to fix each
+func fixTags(ctx context.Context, s *store.Store, audit *domain.TagAudit) error {
+	reader := bufio.NewReader(os.Stdin)
+
+	// merged holds the tags merged into others, whose other pairs are moot
+	merged := make(map[string]bool)
+	for _, d := range audit.Duplicates {
+		if merged[d.Tag] || merged[d.Duplicate] {
+			continue
+		}
+		fmt.Println(formatDuplicate(d))
+		if !confirm(reader, fmt.Sprintf("Merge %s into %s?", d.Duplicate, d.Tag)) {
+			continue
+		}
+		if _, retagged, err := s.AddTagAlias(ctx, d.Tag, d.Duplicate); err != nil {
+			fmt.Printf("(merge skipped: %v)\n", err)
+		} else {
+			merged[d.Duplicate] = true
+			fmt.Printf("Merged %s into %s, %d entries retagged\n", d.Duplicate, d.Tag, retagged)
+		}
+	}
+	// Merges move parent links and entries around: look again
+	if len(merged) > 0 {
+		fresh, err := s.AuditTags(ctx, nil, 1)
+		if err != nil {
+			return err
+		}
+		audit.SingleUse, audit.Cycles, audit.Orphans = fresh.SingleUse, fresh.Cycles, fresh.Orphans
+	}
+
+	for _, c := range audit.Cycles {
+		fmt.Printf("\nCycle: %s\n", formatCycle(c))
+		for i, name := range c {
+			fmt.Printf("  [%d] %s\n", i+1, name)
+		}
+		fmt.Printf("Detach which tag from its parent? [1-%d, Enter to skip]: ", len(c))
+		line, _ := reader.ReadString('\n')
+		i, err := strconv.Atoi(strings.TrimSpace(line))
+		if err != nil || i < 1 || i > len(c) {
+			continue
+		}
+		if _, err := s.SetTagParent(ctx, c[i-1], ""); err != nil {
+			fmt.Printf("(detach skipped: %v)\n", err)
+		} else {
+			fmt.Printf("Detached %s\n", c[i-1])
+		}
+	}
+
+	for _, name := range audit.Orphans {
+		fmt.Printf("\n%s has lost its parent. New parent (Enter for none): ", name)
+		line, _ := reader.ReadString('\n')
+		if _, err := s.SetTagParent(ctx, name, strings.TrimSpace(line)); err != nil {
+			fmt.Printf("(re-parent skipped: %v)\n", err)
+		}
+	}
+
+	if len(audit.SingleUse) > 0 {
+		fmt.Printf("\nOn a single entry (%d), merge them by hand with kb tag alias add:\n", len(audit.SingleUse))
+		fmt.Printf("  %s\n", strings.Join(audit.SingleUse, ", "))
+	}
+	return nil
+}
+
+func formatDuplicate(d domain.TagDuplicate) string {
+	why := "similar names"
+	if d.Reason == domain.DuplicateMeaning {
+		why = fmt.Sprintf("similar meaning, %.0f%%", d.Similarity*100)
+	}
+	return fmt.Sprintf("%s (%d) ~ %s (%d)  %s", d.Duplicate, d.DuplicateEntries, d.Tag, d.TagEntries, why)
+}
+
+// formatCycle shows a loop of tags, each under the next
+func formatCycle(c []string) string {
+	return strings.Join(append(append([]string(nil), c...), c[0]), " -> ")
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/spf13/cobra"
+)
+
+func templateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "template",
+		Short: "Configure how captured URLs are laid out in sections",
+		Long: `Configure how captured URLs are laid out in sections.
+
+A captured URL is stored as Markdown sections, in the template's order:
+
+  metadata     the URL, author, publication date and summary
+  note         your note (kb add --note, or the clipper)
+  highlights   selected passages (kb add --highlight, or a clipped selection)
+  text         the extracted article
+
+Empty sections are left out, and so are kinds missing from the template:
+
+  kb template set metadata=Source note="My take" text=Article
+
+Each heading is marked with its kind, e.g. "## My take {#note}", so
+exports and the web UI can render each section its own way.`,
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "show",
+		Short: "Show the capture template",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			template, err := s.CaptureTemplate(ctx)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				return printJSON(template)
+			}
+			for _, section := range template {
+				fmt.Printf("%-11s %s\n", section.Kind, section.Heading)
+			}
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "set [kind=heading...]",
+		Short: "Set the sections of the capture template, in order",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			var template []domain.TemplateSection
+			for _, arg := range args {
+				kind, heading, ok := strings.Cut(arg, "=")
+				if !ok {
+					return fmt.Errorf("invalid section %q, expected kind=heading", arg)
+				}
+				template = append(template, domain.TemplateSection{Kind: kind, Heading: strings.TrimSpace(heading)})
+			}
+			if err := domain.CheckCaptureTemplate(template); err != nil {
+				return err
+			}
+
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			if err := s.SaveCaptureTemplate(ctx, template); err != nil {
+				return err
+			}
+			fmt.Println("Capture template saved; it applies to URLs captured from now on.")
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "reset",
+		Short: "Restore the default capture template",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			if err := s.SaveCaptureTemplate(ctx, nil); err != nil {
+				return err
+			}
+			fmt.Println("Capture template reset to the default.")
+			return nil
+		},
+	})
+
+	return cmd
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/spf13/cobra"
+)
+
+func tokenCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "token",
+		Short: "Manage API tokens",
+		Long: `Manage bearer tokens for the API server.
+
+Every API request except /health must send one as an Authorization:
+Bearer header (or ?token= for clients that can't set headers); once a
+token was created, kb serve --no-auth no longer opens the API, even after
+it's revoked. Read tokens can only call GET endpoints.
+
+Tokens act as the database owner, or with --user as a user of a shared
+server (see kb user), seeing only that user's entries and tags.`,
+	}
+
+	var name, scope, user string
+	create := &cobra.Command{
+		Use:   "create",
+		Short: "Create a token (shown only once)",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			if name == "" {
+				return fmt.Errorf("--name is required")
+			}
+
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			var userID string
+			if user != "" {
+				u, err := s.GetUser(ctx, user)
+				if err != nil {
+					return err
+				}
+				if u.DisabledAt != nil {
+					return fmt.Errorf("user %s is disabled", u.Name)
+				}
+				userID = u.ID
+			}
+
+			secret, token, err := s.CreateAPIToken(ctx, name, scope, userID)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Created %s token %s (%s)\n", token.Scope, token.Name, short(token.ID))
+			fmt.Println(secret)
+			fmt.Println("Store it now: it can't be shown again.")
+			return nil
+		},
+	}
+	create.Flags().StringVar(&name, "name", "", "what the token is for (e.g. phone, clipper)")
+	create.Flags().StringVar(&scope, "scope", domain.ScopeWrite, "read or write")
+	create.Flags().StringVar(&user, "user", "", "user the token acts as (default the database owner)")
+	cmd.AddCommand(create)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List tokens",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			tokens, err := s.ListAPITokens(ctx)
+			if err != nil {
+				return err
+			}
+			if len(tokens) == 0 {
+				fmt.Println("No tokens: the API is open. Create one with: kb token create --name <name>")
+				return nil
+			}
+			users, err := s.ListUsers(ctx)
+			if err != nil {
+				return err
+			}
+			userNames := make(map[string]string, len(users))
+			for _, u := range users {
+				userNames[u.ID] = u.Name
+			}
+
+			for _, t := range tokens {
+				used := "never used"
+				if t.LastUsedAt != nil {
+					used = "used " + t.LastUsedAt.Format("2006-01-02 15:04")
+				}
+				status := ""
+				if t.UserID != "" {
+					status = "  user " + userNames[t.UserID]
+				}
+				if t.RevokedAt != nil {
+					status += "  (revoked)"
+				}
+				fmt.Printf("%s  %-20s %-5s  created %s, %s%s\n",
+					short(t.ID), t.Name, t.Scope, t.CreatedAt.Format("2006-01-02"), used, status)
+			}
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "revoke [id or name]",
+		Short: "Revoke a token",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			if err := s.RevokeAPIToken(ctx, args[0]); err != nil {
+				return err
+			}
+			fmt.Println("Revoked")
+			return nil
+		},
+	})
+
+	return cmd
+}
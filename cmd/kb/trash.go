@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/spf13/cobra"
+)
+
+// trashRetention is how long entries stay in the trash before the
+// trash-purge job deletes them for good
+const trashRetention = 30 * 24 * time.Hour
+
+func archiveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "archive [id...]",
+		Short: "Archive entries, keeping them out of lists and searches",
+		Long: `Archive entries, keeping them out of lists, searches, suggestions and
+reviews. Archived entries are listed with --scope archived and brought
+back with kb restore.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			for _, arg := range args {
+				id, err := resolveEntryID(ctx, s, arg)
+				if err != nil {
+					return err
+				}
+				if err := s.ArchiveEntry(ctx, id); err != nil {
+					return fmt.Errorf("%s: %w", short(id), err)
+				}
+				fmt.Printf("Archived %s\n", short(id))
+			}
+			return nil
+		},
+	}
+}
+
+func deleteCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete [id...]",
+		Short: "Move entries to the trash",
+		Long: `Move entries to the trash. They stay there, out of sight, until kb
+restore brings them back or they are purged: by kb trash purge, or by the
+trash-purge job after 30 days.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			for _, arg := range args {
+				id, err := resolveEntryID(ctx, s, arg)
+				if err != nil {
+					return err
+				}
+				if err := s.DeleteEntry(ctx, id); err != nil {
+					return fmt.Errorf("%s: %w", short(id), err)
+				}
+				fmt.Printf("Moved %s to the trash\n", short(id))
+			}
+			return nil
+		},
+	}
+}
+
+func restoreCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "restore [id...]",
+		Short: "Bring entries back from the trash or the archive",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			for _, arg := range args {
+				id, err := resolveEntryID(ctx, s, arg)
+				if err != nil {
+					return err
+				}
+				from, err := s.RestoreEntry(ctx, id)
+				if err != nil {
+					return fmt.Errorf("%s: %w", short(id), err)
+				}
+				if from == domain.ScopeTrash {
+					fmt.Printf("Restored %s from the trash\n", short(id))
+				} else {
+					fmt.Printf("Restored %s from the archive\n", short(id))
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func trashCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "trash",
+		Short: "List and empty the trash",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the entries in the trash",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			entries, err := s.ListTrash(ctx)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				return printJSON(entries)
+			}
+			if len(entries) == 0 {
+				fmt.Println("The trash is empty.")
+				return nil
+			}
+			for _, e := range entries {
+				fmt.Printf("%s  %s  %s\n", short(e.ID), e.DeletedAt.Local().Format("2006-01-02"), truncate(e.DisplayTitle(), 60))
+			}
+			return nil
+		},
+	})
+
+	var days int
+	var yes bool
+	purge := &cobra.Command{
+		Use:   "purge",
+		Short: "Delete for good the entries in the trash for more than --days",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			if days < 0 {
+				return fmt.Errorf("--days can't be negative")
+			}
+			if !yes {
+				q := fmt.Sprintf("Delete for good the entries in the trash for more than %d days?", days)
+				if days == 0 {
+					q = "Delete for good every entry in the trash?"
+				}
+				if !confirm(bufio.NewReader(os.Stdin), q) {
+					return nil
+				}
+			}
+
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			n, err := s.PurgeTrash(ctx, time.Duration(days)*24*time.Hour)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Purged %d entries\n", n)
+			return nil
+		},
+	}
+	purge.Flags().IntVar(&days, "days", int(trashRetention/(24*time.Hour)), "only purge entries deleted more than this many days ago (0 for all)")
+	purge.Flags().BoolVarP(&yes, "yes", "y", false, "don't ask for confirmation")
+	cmd.AddCommand(purge)
+
+	return cmd
+}
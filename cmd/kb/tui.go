@@ -0,0 +1,37 @@
+package main
+
+import (
+	"github.com/pbaille/kb/internal/tui"
+	"github.com/spf13/cobra"
+)
+
+func tuiCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "tui",
+		Short: "Browse and edit the knowledge base in a terminal UI",
+		Long: `Browse and edit the knowledge base in a terminal UI.
+
+The tag tree, entry list and selected entry are shown side by side;
+choosing a tag lists the entries under it. Keys:
+
+  tab, h/l     switch pane          j/k, g/G   move, top, bottom
+  enter        open                 /          search as you type
+  a            add an entry         e          edit the entry
+  t            tag: "name" adds, "-name" removes
+  d            delete the entry     r          reload
+  esc          cancel, clear search q          quit
+
+In the editor, ctrl+s saves. New entries are classified like with kb add.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			return tui.Run(ctx, s)
+		},
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/spf13/cobra"
+)
+
+func userCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "user",
+		Short: "Manage the users of a shared server",
+		Long: `Manage the users of a server shared by several people.
+
+Each user has their own entries and tags, and only sees those through the
+API: tokens created with kb token create --user act as them. The database
+owner, using tokens without a user and the CLI, keeps their own entries.
+Admin users can manage users, notebooks and workflows through the API.
+
+Examples:
+  kb user add alice
+  kb user add bob --admin
+  kb user list
+  kb user disable alice`,
+	}
+
+	var admin bool
+	add := &cobra.Command{
+		Use:   "add [name]",
+		Short: "Add a user, with a write token (shown only once)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			user, err := s.AddUser(ctx, args[0], admin)
+			if err != nil {
+				return err
+			}
+			secret, _, err := s.CreateAPIToken(ctx, user.Name, domain.ScopeWrite, user.ID)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Added user %s\n", user.Name)
+			fmt.Println(secret)
+			fmt.Println("Give them this token now: it can't be shown again.")
+			return nil
+		},
+	}
+	add.Flags().BoolVar(&admin, "admin", false, "let the user manage users, notebooks and workflows")
+	cmd.AddCommand(add)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List users",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			users, err := s.ListUsers(ctx)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				return printJSON(users)
+			}
+			if len(users) == 0 {
+				fmt.Println("No users: only the owner uses this database. Add one with: kb user add <name>")
+				return nil
+			}
+			for _, u := range users {
+				status := ""
+				if u.Admin {
+					status = "  admin"
+				}
+				if u.DisabledAt != nil {
+					status += "  (disabled)"
+				}
+				fmt.Printf("%-20s created %s%s\n", u.Name, u.CreatedAt.Format("2006-01-02"), status)
+			}
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "disable [name]",
+		Short: "Disable a user and revoke their tokens, keeping their entries",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			if err := s.DisableUser(ctx, args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("Disabled %s\n", args[0])
+			return nil
+		},
+	})
+
+	return cmd
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/spf13/cobra"
+)
+
+func workflowCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "workflow",
+		Short: "Define pipelines of states and move entries through them",
+		Long: `Define pipelines of states and move entries through them.
+
+A workflow is a named list of states, e.g. idea → drafted → published for
+writing. Entries start a workflow at its first state; by default they then
+move one step forward or back. With --transition, only the listed moves
+are allowed:
+
+  kb workflow add writing idea drafted published
+  kb workflow add reading queued reading done dropped \
+      --transition queued:reading --transition reading:done \
+      --transition reading:dropped --transition dropped:queued
+  kb workflow start <id> writing
+  kb workflow move <id> writing drafted
+
+An entry can be in several workflows, once each. A workflow defined while
+working in a notebook (kb notebook use, --notebook) is for the entries of
+that notebook and its sub-notebooks only, and listed only there and in
+the notebooks around it.
+
+The reading queue (kb read) isn't a workflow: articles join it on their
+own when captured and leave it once read, with no states in between, so
+it stays a mark on the entries rather than a pipeline to define.`,
+	}
+
+	var transitions []string
+	add := &cobra.Command{
+		Use:   "add [name] [state...]",
+		Short: "Define a workflow",
+		Args:  cobra.MinimumNArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			w := &domain.Workflow{Name: args[0], States: args[1:]}
+			for _, t := range transitions {
+				from, to, ok := strings.Cut(t, ":")
+				if !ok {
+					return fmt.Errorf("invalid transition %q, expected from:to", t)
+				}
+				if w.Transitions == nil {
+					w.Transitions = make(map[string][]string)
+				}
+				w.Transitions[from] = append(w.Transitions[from], to)
+			}
+
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			w.Notebook = s.Notebook(ctx)
+			if err := s.AddWorkflow(ctx, w); err != nil {
+				return err
+			}
+			fmt.Printf("Added workflow %s: %s", w.Name, strings.Join(w.States, " → "))
+			if w.Notebook != "" {
+				fmt.Printf(" (notebook %s)", w.Notebook)
+			}
+			fmt.Println()
+			return nil
+		},
+	}
+	add.Flags().StringArrayVar(&transitions, "transition", nil, "allowed move, from:to (repeatable; default: one step forward or back)")
+	cmd.AddCommand(add)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List workflows with the number of entries in each state",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			workflows, err := s.ListWorkflows(ctx)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				return printJSON(workflows)
+			}
+			if len(workflows) == 0 {
+				fmt.Println("No workflows yet. Use 'kb workflow add' to define one.")
+				return nil
+			}
+			counts, err := s.WorkflowCounts(ctx)
+			if err != nil {
+				return err
+			}
+
+			for _, w := range workflows {
+				var states []string
+				for _, c := range counts {
+					if c.Workflow == w.Name {
+						states = append(states, fmt.Sprintf("%s (%d)", c.State, c.Entries))
+					}
+				}
+				name := w.Name
+				if w.Notebook != "" {
+					name += " (notebook " + w.Notebook + ")"
+				}
+				fmt.Printf("%s\n  %s\n", name, strings.Join(states, " → "))
+				for _, from := range w.States {
+					if tos := w.Transitions[from]; len(tos) > 0 {
+						fmt.Printf("  %s → %s\n", from, strings.Join(tos, ", "))
+					}
+				}
+			}
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "rm [name]",
+		Short: "Delete a workflow; entries leave it",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			if err := s.DeleteWorkflow(ctx, args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("Deleted workflow %s\n", args[0])
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "start [id] [workflow]",
+		Short: "Put an entry at the first state of a workflow",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			id, err := resolveEntryID(ctx, s, args[0])
+			if err != nil {
+				return err
+			}
+			w, err := s.GetWorkflow(ctx, args[1])
+			if err != nil {
+				return err
+			}
+			if err := s.SetWorkflowState(ctx, id, w.Name, w.Initial()); err != nil {
+				return err
+			}
+			fmt.Printf("%s: %s %s\n", short(id), w.Name, w.Initial())
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "move [id] [workflow] [state]",
+		Short: "Move an entry to another state of a workflow",
+		Args:  cobra.ExactArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			id, err := resolveEntryID(ctx, s, args[0])
+			if err != nil {
+				return err
+			}
+			entry, err := s.GetEntry(ctx, id)
+			if err != nil {
+				return err
+			}
+			from := ""
+			for _, st := range entry.Workflows {
+				if st.Workflow == args[1] {
+					from = st.State
+				}
+			}
+			if err := s.SetWorkflowState(ctx, id, args[1], args[2]); err != nil {
+				return err
+			}
+			if from == "" {
+				fmt.Printf("%s: %s %s\n", short(id), args[1], args[2])
+			} else {
+				fmt.Printf("%s: %s %s → %s\n", short(id), args[1], from, args[2])
+			}
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "leave [id] [workflow]",
+		Short: "Take an entry out of a workflow",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			id, err := resolveEntryID(ctx, s, args[0])
+			if err != nil {
+				return err
+			}
+			if err := s.LeaveWorkflow(ctx, id, args[1]); err != nil {
+				return err
+			}
+			fmt.Printf("%s left %s\n", short(id), args[1])
+			return nil
+		},
+	})
+
+	var limit int
+	var format string
+	entries := &cobra.Command{
+		Use:   "entries [workflow] [state]",
+		Short: "List the entries in a state of a workflow",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			format, err := entryFormat(format)
+			if err != nil {
+				return err
+			}
+
+			s, err := getStore(ctx)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			w, err := s.GetWorkflow(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			if !slices.Contains(w.States, args[1]) {
+				return fmt.Errorf("%s has no state %s (states: %s)", w.Name, args[1], strings.Join(w.States, ", "))
+			}
+
+			list, err := s.ListEntriesInState(ctx, w.Name, args[1], limit, 0)
+			if err != nil {
+				return err
+			}
+			if format != "" {
+				return printEntriesAs(ctx, s, format, list)
+			}
+			if len(list) == 0 {
+				fmt.Printf("No entries %s in %s.\n", args[1], w.Name)
+				return nil
+			}
+			for _, e := range list {
+				fmt.Printf("%s  %s\n", short(e.ID), truncate(e.DisplayTitle(), 60))
+			}
+			return nil
+		},
+	}
+	entries.Flags().IntVarP(&limit, "limit", "n", 20, "number of entries to show")
+	entries.Flags().StringVar(&format, "format", "text", "output format: text, json, yaml, markdown or org")
+	cmd.AddCommand(entries)
+
+	return cmd
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/pbaille/kb/internal/ask"
+	"github.com/pbaille/kb/internal/classifier"
+	"github.com/pbaille/kb/internal/embedding"
+)
+
+// AskRequest is the request body for asking the knowledge base a question
+type AskRequest struct {
+	Question string `json:"question"`
+	// Sources is how many entries to retrieve, 8 by default
+	Sources int `json:"sources,omitempty"`
+}
+
+// askQuestion answers a question from the entries closest to it, citing
+// the ones the answer relies on
+func (s *Server) askQuestion(w http.ResponseWriter, r *http.Request) {
+	var req AskRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Question) == "" {
+		writeError(w, http.StatusBadRequest, "invalid request body (question is required)")
+		return
+	}
+
+	embSvc, err := embedding.New()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, "asking needs an embedding service: "+err.Error())
+		return
+	}
+	clf, err := classifier.New()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, "asking needs an LLM: "+err.Error())
+		return
+	}
+
+	result, err := ask.Ask(r.Context(), s.store, embSvc, clf, req.Question, req.Sources)
+	if errors.Is(err, ask.ErrNothingEmbedded) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+
+	"github.com/pbaille/kb/internal/blobs"
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/pipeline"
+)
+
+// maxUploadSize bounds attachment uploads (32MB)
+const maxUploadSize = 32 << 20
+
+// maxAttachmentText bounds how much attachment text is sent to the classifier
+const maxAttachmentText = 10 * 1024
+
+// AddAttachmentResponse is the response for uploading an attachment
+type AddAttachmentResponse struct {
+	Attachment *domain.Attachment `json:"attachment"`
+	Tags       []TagWithParent    `json:"tags,omitempty"`
+}
+
+func (s *Server) listAttachments(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+
+	attachments, err := s.store.ListAttachments(ctx, id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"entry_id":    id,
+		"attachments": attachments,
+	})
+}
+
+// addAttachment accepts a multipart upload in the "file" field. Text files
+// are also classified so their topics show up in the entry's tags.
+func (s *Server) addAttachment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	entry, err := s.store.GetEntry(ctx, r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "entry not found")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "multipart field 'file' is required")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "read upload: "+err.Error())
+		return
+	}
+
+	sum, size, err := s.blobs.Put(bytes.NewReader(data))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	filename := filepath.Base(header.Filename)
+	mimeType := blobs.DetectMIME(filename, data)
+	attachment, err := s.store.AddAttachment(ctx, entry.ID, sum, filename, mimeType, size)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	resp := AddAttachmentResponse{Attachment: attachment}
+	if blobs.IsText(mimeType) {
+		text := string(data)
+		if len(text) > maxAttachmentText {
+			text = text[:maxAttachmentText]
+		}
+		if c, _ := pipeline.Classify(ctx, s.store, entry.ID, entry.Content+"\n\n"+text); c != nil {
+			resp.Tags = tagsWithParents(c.Tags)
+		}
+	}
+
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// inlineTypes are the attachment types shown in the browser rather than
+// downloaded
+var inlineTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+func (s *Server) getAttachment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	attachment, err := s.store.GetAttachment(ctx, r.PathValue("id"))
+	if err == nil {
+		// Attachments of other users' entries aren't found either
+		_, err = s.store.ResolveID(ctx, attachment.EntryID)
+	}
+	if err != nil {
+		writeError(w, http.StatusNotFound, "attachment not found")
+		return
+	}
+
+	f, err := s.blobs.Open(attachment.SHA256)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer f.Close()
+
+	// Uploads are served as downloads unless they're images browsers
+	// can't run script in: an HTML or SVG file shown inline would run on
+	// the API's origin
+	disposition := "attachment"
+	if inlineTypes[attachment.MIMEType] {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Type", attachment.MIMEType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("%s; filename=%q", disposition, attachment.Filename))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	http.ServeContent(w, r, attachment.Filename, attachment.CreatedAt, f)
+}
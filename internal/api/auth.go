@@ -0,0 +1,170 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// writeGETs are GET endpoints with side effects, which read-only tokens
+// can't call
+var writeGETs = map[string]bool{
+	"/shortcuts/add": true,
+}
+
+// withAuth requires a bearer token (or ?token= for clients that can't set
+// headers). The API is only open with Options.NoAuth, on a loopback
+// address, and as long as no token was ever issued nor KB_API_TOKEN set:
+// revoking the last token doesn't open it again. Read-only tokens can only
+// read, and the tokens of users only reach their own entries and tags.
+// /health, the web UI's static files, read-only links and CORS preflights
+// are always allowed, but only outside /nb/ prefixes.
+func (s *Server) withAuth(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		open := r.Method == "OPTIONS" || r.URL.Path == "/health" || isUIAsset(r) || isShareLink(r)
+		if open && !inNotebook(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		legacy := os.Getenv("KB_API_TOKEN")
+		if s.opts.NoAuth && legacy == "" {
+			issued, err := s.store.TokensIssued(ctx)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			if !issued {
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		secret := r.URL.Query().Get("token")
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			secret = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if secret == "" {
+			deny(w, r, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		var token *domain.APIToken
+		var err error
+		if legacy != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(legacy)) == 1 {
+			token = &domain.APIToken{Name: "KB_API_TOKEN", Scope: domain.ScopeWrite}
+		} else if token, err = s.store.AuthenticateToken(ctx, secret); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if token == nil {
+			deny(w, r, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		if token.Scope != domain.ScopeWrite && !isRead(r) {
+			deny(w, r, http.StatusForbidden, "token is read-only")
+			return
+		}
+
+		if token.UserID != "" {
+			ctx = store.WithUser(ctx, token.UserID)
+		}
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// adminOnly restricts a handler to the database owner and admin users:
+// users, notebooks, collections, workflows, sync and settings are shared
+// by the whole database
+func (s *Server) adminOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if userID := store.UserID(ctx); userID != "" {
+			u, err := s.store.GetUser(ctx, userID)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			if !u.Admin {
+				deny(w, r, http.StatusForbidden, "admins only")
+				return
+			}
+		}
+		h(w, r)
+	}
+}
+
+// ownEntry answers 404 unless the entries a handler's path names ({id},
+// and {other} for links) belong to the user making the request. IDs can
+// be abbreviated: the handler sees them in full.
+func (s *Server) ownEntry(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, name := range []string{"id", "other"} {
+			id := r.PathValue(name)
+			if id == "" {
+				continue
+			}
+			fullID, err := s.store.ResolveID(r.Context(), id)
+			var ambiguous *store.AmbiguousIDError
+			switch {
+			case errors.Is(err, store.ErrEntryNotFound):
+				writeError(w, http.StatusNotFound, "entry not found: "+id)
+				return
+			case errors.As(err, &ambiguous):
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			case err != nil:
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			r.SetPathValue(name, fullID)
+		}
+		h(w, r)
+	}
+}
+
+// deny answers in plain text on the /shortcuts endpoints, JSON elsewhere
+func deny(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	if strings.HasPrefix(r.URL.Path, "/shortcuts/") {
+		writeText(w, status, msg)
+		return
+	}
+	writeError(w, status, msg)
+}
+
+// isUIAsset matches the web UI page and files, which hold no data
+func isUIAsset(r *http.Request) bool {
+	return r.Method == "GET" && (r.URL.Path == "/" || strings.HasPrefix(r.URL.Path, "/ui/"))
+}
+
+// isShareLink reports whether r opens a read-only link, which carries
+// its own signature
+func isShareLink(r *http.Request) bool {
+	return r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/s/")
+}
+
+// isLoopback reports whether a listen address only accepts local
+// connections; an empty host listens on every interface
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func isRead(r *http.Request) bool {
+	return (r.Method == "GET" || r.Method == "HEAD") && !writeGETs[r.URL.Path]
+}
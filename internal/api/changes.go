@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http"
+	"time"
+)
+
+// changes returns the entries created or changed since a timestamp, the
+// IDs of those removed since, and the server time to pass as `since` on
+// the next call. Clients use it to keep an offline copy.
+func (s *Server) changes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	now := time.Now().UTC()
+
+	// Without a cursor, send the last 30 days
+	since := now.AddDate(0, 0, -30)
+	if v := r.URL.Query().Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "since must be an RFC 3339 timestamp")
+			return
+		}
+		since = t
+	}
+
+	entries, removed, err := s.store.EntryChangesSince(ctx, since)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	for i := range entries {
+		tags, _ := s.store.GetEntryTags(ctx, entries[i].ID)
+		entries[i].Tags = tags
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"entries": entries,
+		"removed": removed,
+		"since":   since,
+		"now":     now.Format(time.RFC3339Nano),
+	})
+}
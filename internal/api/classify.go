@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/pbaille/kb/internal/classifier"
+	"github.com/pbaille/kb/internal/embedding"
+	"github.com/pbaille/kb/internal/pipeline"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// ClassifyRequest is the request body for previewing the tags of a text
+type ClassifyRequest struct {
+	Content string `json:"content"`
+	// Similar is how many of the nearest entries to return, 5 by default
+	Similar int `json:"similar,omitempty"`
+}
+
+// ClassifyResponse is what saving a text would tag it with, and the
+// entries closest to it
+type ClassifyResponse struct {
+	Title   string               `json:"title,omitempty"`
+	Tags    []TagWithParent      `json:"tags"`
+	Similar []store.SimilarEntry `json:"similar,omitempty"`
+}
+
+// classifyText suggests tags for a text and finds the entries closest to
+// it without saving anything, so a client can preview them before the
+// text is added
+func (s *Server) classifyText(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req ClassifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Content) == "" {
+		writeError(w, http.StatusBadRequest, "invalid request body (content is required)")
+		return
+	}
+	if req.Similar <= 0 {
+		req.Similar = 5
+	}
+
+	result, err := pipeline.Suggest(ctx, s.store, req.Content)
+	if result == nil {
+		status := http.StatusBadGateway
+		if _, clfErr := classifier.New(); clfErr != nil {
+			status = http.StatusServiceUnavailable
+		}
+		writeError(w, status, "classify: "+err.Error())
+		return
+	}
+	resp := ClassifyResponse{Title: result.Title, Tags: []TagWithParent{}}
+	for _, t := range result.Tags {
+		resp.Tags = append(resp.Tags, TagWithParent{Name: t.Name, Parent: t.Parent, Confidence: t.Confidence})
+	}
+
+	// Cached, so saving the text next doesn't embed it again
+	if embSvc, err := embedding.New(); err == nil {
+		if vector, err := embSvc.Embed(ctx, req.Content); err == nil {
+			resp.Similar, _ = s.store.FindSimilar(ctx, vector, req.Similar, "")
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/fetcher"
+	"github.com/pbaille/kb/internal/journal"
+)
+
+// clipVia names the web clipper in an entry's source occurrences
+const clipVia = "clipper"
+
+// ClipRequest is sent by the browser extension or bookmarklet
+type ClipRequest struct {
+	URL           string `json:"url"`
+	Title         string `json:"title,omitempty"`
+	SelectionHTML string `json:"selection_html,omitempty"`
+	// Note is the user's own note on the page
+	Note string `json:"note,omitempty"`
+}
+
+// clip saves a web page from the browser. With a selection, only the
+// selected passage is kept, as a highlight (several passages of a page
+// may be clipped); without one, the page is fetched and its article
+// extracted like any URL. Either way the entry is laid out with the
+// capture template. Like the rest of the API, it needs a write token
+// (withAuth); a sighting that couldn't be recorded is listed among the
+// response's problems.
+func (s *Server) clip(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req ClipRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	req.URL = strings.TrimSpace(req.URL)
+	if !fetcher.IsURL(req.URL) {
+		writeError(w, http.StatusBadRequest, "url is required")
+		return
+	}
+
+	now := time.Now()
+	source := domain.Source{
+		Type:      domain.SourceClip,
+		URL:       req.URL,
+		Title:     strings.TrimSpace(req.Title),
+		FetchedAt: &now,
+	}
+
+	template, err := s.store.CaptureTemplate(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	capture := &domain.URLCapture{URL: source.URL}
+	if req.SelectionHTML != "" {
+		selection := fetcher.HTMLText(req.SelectionHTML)
+		if selection == "" {
+			writeError(w, http.StatusBadRequest, "selection has no text")
+			return
+		}
+		capture.Highlights = []string{selection}
+	} else {
+		existing, err := s.seenBefore(ctx, req.URL, clipVia)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if existing != nil {
+			writeJSON(w, http.StatusOK, &AddEntryResponse{Entry: existing, Duplicate: true})
+			return
+		}
+
+		page, err := fetcher.Fetch(ctx, req.URL)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, "fetch URL: "+err.Error())
+			return
+		}
+		capture = page.Capture()
+		source.CanonicalURL = page.CanonicalURL
+		source.Author = page.Author
+		if page.Title != "" {
+			source.Title = page.Title
+		}
+	}
+	capture.Note = strings.TrimSpace(req.Note)
+	content := capture.Render(template)
+
+	resp, err := s.ingest(ctx, journal.Capture{Content: content, Source: source, Via: clipVia, URL: req.URL})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, resp)
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/export"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// CollectionEntriesRequest is the request body for adding entries to a
+// collection or moving them in it. Position counts from 1; 0 is the end.
+type CollectionEntriesRequest struct {
+	IDs      []string `json:"ids"`
+	Position int      `json:"position,omitempty"`
+}
+
+// CollectionResponse is a collection with its entries in order
+type CollectionResponse struct {
+	domain.Collection
+	Items []domain.Entry `json:"items"`
+}
+
+// listCollections returns every collection with its entry count
+func (s *Server) listCollections(w http.ResponseWriter, r *http.Request) {
+	collections, err := s.store.ListCollections(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if collections == nil {
+		collections = []domain.Collection{}
+	}
+	writeJSON(w, http.StatusOK, collections)
+}
+
+// createCollection creates an empty collection
+func (s *Server) createCollection(w http.ResponseWriter, r *http.Request) {
+	var c domain.Collection
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := domain.CheckCollectionName(c.Name); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := s.store.CreateCollection(r.Context(), &c); err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, c)
+}
+
+// getCollection returns a collection with its entries in order
+func (s *Server) getCollection(w http.ResponseWriter, r *http.Request) {
+	s.writeCollection(w, r, http.StatusOK)
+}
+
+// deleteCollection removes a collection; its entries are kept
+func (s *Server) deleteCollection(w http.ResponseWriter, r *http.Request) {
+	if err := s.store.DeleteCollection(r.Context(), r.PathValue("name")); err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted", "name": r.PathValue("name")})
+}
+
+// addToCollection adds entries to a collection, in the order given;
+// entries already in it move to the position
+func (s *Server) addToCollection(w http.ResponseWriter, r *http.Request) {
+	var req CollectionEntriesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.IDs) == 0 {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := s.store.AddToCollection(r.Context(), r.PathValue("name"), req.IDs, req.Position); err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+	s.writeCollection(w, r, http.StatusOK)
+}
+
+// reorderCollection moves entries of a collection, in the order given, to
+// the position
+func (s *Server) reorderCollection(w http.ResponseWriter, r *http.Request) {
+	var req CollectionEntriesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.IDs) == 0 {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := s.store.ReorderCollection(r.Context(), r.PathValue("name"), req.IDs, req.Position); err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+	s.writeCollection(w, r, http.StatusOK)
+}
+
+// removeFromCollection takes an entry out of a collection
+func (s *Server) removeFromCollection(w http.ResponseWriter, r *http.Request) {
+	if err := s.store.RemoveFromCollection(r.Context(), r.PathValue("name"), []string{r.PathValue("id")}); err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+	s.writeCollection(w, r, http.StatusOK)
+}
+
+// exportCollection renders a collection as a single document, in the
+// format given by the format query parameter (markdown by default)
+func (s *Server) exportCollection(w http.ResponseWriter, r *http.Request) {
+	doc, err := export.BuildCollectionDocument(r.Context(), s.store, r.PathValue("name"))
+	if err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "markdown"
+	}
+	var contentType, ext string
+	var write func(w http.ResponseWriter) error
+	switch format {
+	case "epub":
+		contentType, ext = "application/epub+zip", "epub"
+		write = func(w http.ResponseWriter) error { return export.WriteEPUB(w, doc) }
+	case "pdf":
+		contentType, ext = "application/pdf", "pdf"
+		write = func(w http.ResponseWriter) error { return export.WritePDF(w, doc) }
+	case "markdown":
+		contentType, ext = "text/markdown; charset=utf-8", "md"
+		write = func(w http.ResponseWriter) error { return export.WriteMarkdown(w, doc) }
+	case "org":
+		contentType, ext = "text/org; charset=utf-8", "org"
+		write = func(w http.ResponseWriter) error { return export.WriteOrg(w, doc) }
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown format %q (use epub, pdf, markdown or org)", format))
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", doc.Title+"."+ext))
+	write(w)
+}
+
+// writeCollection responds with the collection of the request's path
+func (s *Server) writeCollection(w http.ResponseWriter, r *http.Request, status int) {
+	ctx := r.Context()
+	c, err := s.store.GetCollection(ctx, r.PathValue("name"))
+	if err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+	entries, err := s.store.CollectionEntries(ctx, c.Name)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if entries == nil {
+		entries = []domain.Entry{}
+	}
+	writeJSON(w, status, CollectionResponse{Collection: *c, Items: entries})
+}
+
+// writeCollectionError maps collection errors to status codes
+func writeCollectionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrCollectionNotFound), errors.Is(err, store.ErrEntryNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	default:
+		writeError(w, http.StatusBadRequest, err.Error())
+	}
+}
@@ -0,0 +1,261 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/embedding"
+	"github.com/pbaille/kb/internal/pipeline"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// UpdateEntryRequest is the request body for editing an entry
+type UpdateEntryRequest struct {
+	Content string  `json:"content"`
+	Title   *string `json:"title,omitempty"`
+}
+
+// ConflictResponse is returned with 409 when an entry changed since the
+// revision named in If-Match; Entry is the current version to merge with
+type ConflictResponse struct {
+	Error string        `json:"error"`
+	Entry *domain.Entry `json:"entry"`
+}
+
+// updateEntry edits an entry. Clients send the ETag they read the entry
+// with as If-Match, so concurrent editors of a shared note can't silently
+// overwrite each other: the second save gets a 409 with the current entry.
+func (s *Server) updateEntry(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		writeError(w, http.StatusPreconditionRequired, "If-Match header with the entry's ETag is required")
+		return
+	}
+	revision, err := parseETag(ifMatch)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid If-Match header")
+		return
+	}
+
+	var req UpdateEntryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if strings.TrimSpace(req.Content) == "" {
+		writeError(w, http.StatusBadRequest, "content is required")
+		return
+	}
+
+	current, err := s.store.GetEntry(ctx, id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "entry not found")
+		return
+	}
+	title := current.Source.Title
+	if req.Title != nil {
+		title = *req.Title
+	}
+
+	entry, err := s.store.UpdateEntry(ctx, id, req.Content, title, revision)
+	if errors.Is(err, store.ErrRevisionConflict) {
+		current, _ = s.store.GetEntry(ctx, id)
+		setETag(w, current)
+		writeJSON(w, http.StatusConflict, ConflictResponse{Error: err.Error(), Entry: current})
+		return
+	}
+	if errors.Is(err, store.ErrNotebookLocked) {
+		writeError(w, http.StatusLocked, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Keep links and similarity search in line with the new content
+	if _, err := s.store.LinkWikiLinks(ctx, id, entry.Content); err == nil {
+		if refreshed, err := s.store.GetEntry(ctx, id); err == nil {
+			entry = refreshed
+		}
+	}
+	if embSvc, err := embedding.New(); err == nil {
+		pipeline.Embed(ctx, s.store, embSvc, entry.ID, entry.Content)
+	}
+
+	setETag(w, entry)
+	writeJSON(w, http.StatusOK, entry)
+}
+
+// setETag exposes an entry's revision as its ETag
+func setETag(w http.ResponseWriter, entry *domain.Entry) {
+	if entry != nil {
+		w.Header().Set("ETag", strconv.Quote(strconv.Itoa(entry.Revision)))
+	}
+}
+
+// parseETag reads the revision from an ETag like "3" (quotes and weak
+// prefix optional)
+func parseETag(v string) (int, error) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+	return strconv.Atoi(strings.Trim(v, `"`))
+}
+
+// AppendEntryRequest is the request body for appending to an entry
+type AppendEntryRequest struct {
+	Text string `json:"text"`
+}
+
+// appendEntry adds time-stamped text to the end of an entry. No If-Match
+// is needed: appends don't overwrite anything. A large enough addition
+// gets the entry classified and embedded again, as when it was added.
+func (s *Server) appendEntry(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+
+	var req AppendEntryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	text := strings.TrimSpace(req.Text)
+	if text == "" {
+		writeError(w, http.StatusBadRequest, "text is required")
+		return
+	}
+
+	before, err := s.store.GetEntry(ctx, id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "entry not found")
+		return
+	}
+	entry, err := s.store.AppendToEntry(ctx, id, text)
+	if errors.Is(err, store.ErrNotebookLocked) {
+		writeError(w, http.StatusLocked, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	resp := &AddEntryResponse{Entry: entry}
+	if domain.SubstantialAppend(before.Content, text) {
+		resp = s.process(ctx, entry, entry.Content, false)
+	} else {
+		s.linkWikiLinks(ctx, resp)
+	}
+	setETag(w, resp.Entry)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// MergeRequest is the request body for merging entries into another
+type MergeRequest struct {
+	// IDs are the entries to merge, in the order their contents are added
+	IDs []string `json:"ids"`
+	// Link keeps the entries, linking them and unioning their tags
+	Link bool `json:"link,omitempty"`
+}
+
+// mergeEntries consolidates duplicate entries into the one in the path,
+// then embeds the merged content again
+func (s *Server) mergeEntries(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req MergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if len(req.IDs) == 0 {
+		writeError(w, http.StatusBadRequest, "ids is required")
+		return
+	}
+
+	merge := s.store.MergeEntries
+	if req.Link {
+		merge = s.store.LinkDuplicates
+	}
+	entry, err := merge(ctx, r.PathValue("id"), req.IDs)
+	if err != nil {
+		writeNotebookError(w, err)
+		return
+	}
+
+	resp := &AddEntryResponse{Entry: entry}
+	if !req.Link {
+		resp = s.process(ctx, entry, entry.Content, true)
+	}
+	setETag(w, resp.Entry)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// RevertRequest is the request body for reverting an entry to a past
+// revision
+type RevertRequest struct {
+	Revision int `json:"revision"`
+}
+
+// listVersions returns every version of an entry, newest first, starting
+// with the current one
+func (s *Server) listVersions(w http.ResponseWriter, r *http.Request) {
+	versions, err := s.store.ListEntryVersions(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeVersionError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, versions)
+}
+
+// getVersion returns an entry's version at a revision
+func (s *Server) getVersion(w http.ResponseWriter, r *http.Request) {
+	revision, err := strconv.Atoi(r.PathValue("revision"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid revision")
+		return
+	}
+	v, err := s.store.GetEntryVersion(r.Context(), r.PathValue("id"), revision)
+	if err != nil {
+		writeVersionError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+// revertEntry brings back an entry's content and title at a past
+// revision, as a new revision, then embeds it again
+func (s *Server) revertEntry(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req RevertRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	entry, err := s.store.RevertEntry(ctx, r.PathValue("id"), req.Revision)
+	if err != nil {
+		writeVersionError(w, err)
+		return
+	}
+
+	resp := s.process(ctx, entry, entry.Content, true)
+	setETag(w, resp.Entry)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// writeVersionError maps version errors to status codes
+func writeVersionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrEntryNotFound), errors.Is(err, store.ErrVersionNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, store.ErrNotebookLocked):
+		writeError(w, http.StatusLocked, err.Error())
+	default:
+		writeError(w, http.StatusBadRequest, err.Error())
+	}
+}
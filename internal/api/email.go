@@ -0,0 +1,122 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/fetcher"
+	"github.com/pbaille/kb/internal/journal"
+	"github.com/pbaille/kb/internal/mailer"
+)
+
+// maxEmailSize bounds inbound emails, attachments included
+const maxEmailSize = 32 << 20
+
+// inboundEmail saves an email forwarded to the knowledge base, as posted
+// by Mailgun and SendGrid inbound webhooks: their parsed form fields, or
+// the raw message (Mailgun's body-mime, SendGrid's email, or a
+// message/rfc822 body). The subject becomes the title, and the HTML body
+// is extracted like a web page. As these services can't set headers, the
+// API token goes in the URL: /inbound-email?token=...
+func (s *Server) inboundEmail(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	r.Body = http.MaxBytesReader(w, r.Body, maxEmailSize)
+
+	msg, err := readInboundEmail(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	content := ""
+	if msg.HTML != "" {
+		content = fetcher.ArticleText(msg.HTML)
+	}
+	if content == "" {
+		content = strings.TrimSpace(msg.Text)
+	}
+	if content == "" {
+		// Not worth a retry from the sender
+		writeError(w, http.StatusNotAcceptable, "email has no text")
+		return
+	}
+
+	now := time.Now()
+	source := domain.Source{Type: domain.SourceEmail, Title: msg.Title(), Author: msg.Sender(), FetchedAt: &now}
+	if msg.MessageID != "" {
+		// Message IDs are URLs (RFC 2392), which also catch redeliveries
+		source.URL = "mid:" + msg.MessageID
+		existing, err := s.store.FindEntryByURL(ctx, source.URL)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if existing != nil {
+			writeJSON(w, http.StatusOK, &AddEntryResponse{Entry: existing, Duplicate: true})
+			return
+		}
+	}
+
+	resp, err := s.ingest(ctx, journal.Capture{Content: content, Source: source})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// readInboundEmail reads the email of an inbound webhook request
+func readInboundEmail(r *http.Request) (*mailer.InboundEmail, error) {
+	if ct := r.Header.Get("Content-Type"); strings.HasPrefix(ct, "message/rfc822") {
+		return mailer.ParseMessage(r.Body)
+	}
+	if err := r.ParseMultipartForm(maxEmailSize); err != nil && err != http.ErrNotMultipart {
+		return nil, err
+	}
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+
+	field := func(names ...string) string {
+		for _, name := range names {
+			if v := strings.TrimSpace(r.FormValue(name)); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+	if raw := field("body-mime", "email"); raw != "" {
+		return mailer.ParseMessage(strings.NewReader(raw))
+	}
+
+	msg := &mailer.InboundEmail{
+		From:      mailer.DecodeHeader(field("from", "sender")),
+		Subject:   mailer.DecodeHeader(field("subject")),
+		MessageID: strings.Trim(field("Message-Id", "message-id"), "<> "),
+		HTML:      field("body-html", "html"),
+		Text:      field("body-plain", "text", "stripped-text"),
+	}
+	if msg.MessageID == "" {
+		msg.MessageID = headerField(field("headers"), "Message-Id")
+	}
+	if msg.Subject == "" && msg.Text == "" && msg.HTML == "" {
+		return nil, errNoEmail
+	}
+	return msg, nil
+}
+
+var errNoEmail = errors.New("no email in the request (expected Mailgun or SendGrid inbound fields, or a raw message)")
+
+// headerField finds a header in the raw headers SendGrid posts
+func headerField(headers, name string) string {
+	for _, line := range strings.Split(headers, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(key), name) {
+			return strings.Trim(value, "<> \r")
+		}
+	}
+	return ""
+}
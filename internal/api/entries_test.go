@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+func TestListEntriesSearch(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.token("")
+	ctx := context.Background()
+
+	// golang 0..4, oldest first, among other entries
+	var golang []string
+	for i := 0; i < 5; i++ {
+		e, err := ts.store.AddEntry(ctx, fmt.Sprintf("golang note %d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		golang = append(golang, e.ID)
+		if _, err := ts.store.AddEntry(ctx, fmt.Sprintf("rust note %d", i)); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := ts.store.SetMaturity(ctx, golang[1], domain.MaturityEvergreen); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.store.MarkUnread(ctx, golang[3]); err != nil {
+		t.Fatal(err)
+	}
+	newest := slices.Clone(golang)
+	slices.Reverse(newest)
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"/entries?q=golang", newest},
+		{"/entries?q=golang&limit=2", newest[:2]},
+		{"/entries?q=golang&limit=2&offset=2", newest[2:4]},
+		{"/entries?q=golang&offset=4", newest[4:]},
+		{"/entries?q=golang&offset=9", nil},
+		{"/entries?q=golang&reverse=true&limit=3", golang[:3]},
+		{"/entries?q=golang&maturity=evergreen", []string{golang[1]}},
+		{"/entries?q=golang&unread=true", []string{golang[3]}},
+		{"/entries?q=golang&since=2099-01-01", nil},
+		{"/entries?q=golang&until=2000-01-01", nil},
+		{"/search?q=golang", newest},
+		{"/search?q=golang&limit=2", newest[:2]},
+		{"/search?q=golang&limit=2&offset=1&reverse=true", golang[1:3]},
+		{"/search?q=golang&unread=true", []string{golang[3]}},
+		{"/search?q=golang&maturity=evergreen", []string{golang[1]}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			var resp struct {
+				Entries []domain.Entry `json:"entries"`
+			}
+			if code := ts.do("GET", tt.path, token, nil, &resp); code != http.StatusOK {
+				t.Fatalf("status %d", code)
+			}
+			var got []string
+			for _, e := range resp.Entries {
+				got = append(got, e.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("entries = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	for _, path := range []string{"/entries?q=golang&sort=best", "/entries?q=(golang", "/search?q=golang&sort=best", "/search?q=golang&since=soon"} {
+		if code := ts.do("GET", path, token, nil, nil); code != http.StatusBadRequest {
+			t.Errorf("GET %s = %d, want 400", path, code)
+		}
+	}
+}
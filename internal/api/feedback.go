@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// TagEntryRequest is the request body for adding a tag to an entry
+type TagEntryRequest struct {
+	Name string `json:"name"`
+}
+
+// addEntryTag adds a tag on behalf of the user, recording it as feedback
+func (s *Server) addEntryTag(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+
+	var req TagEntryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	if _, err := s.store.GetEntry(ctx, id); err != nil {
+		writeError(w, http.StatusNotFound, "entry not found")
+		return
+	}
+
+	tag, err := s.store.GetOrCreateTag(ctx, name, nil)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := s.store.TagByHuman(ctx, id, tag.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.writeEntry(ctx, w, id)
+}
+
+// removeEntryTag removes a tag on behalf of the user, recording it as feedback
+func (s *Server) removeEntryTag(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+
+	tag, err := s.store.GetTagByName(ctx, r.PathValue("tag"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err := s.store.UntagByHuman(ctx, id, tag.ID); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	s.writeEntry(ctx, w, id)
+}
+
+func (s *Server) tagQuality(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	st, release, ok := s.analytics(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	quality, err := st.TagQuality(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"tags": quality})
+}
+
+func (s *Server) writeEntry(ctx context.Context, w http.ResponseWriter, id string) {
+	entry, err := s.store.GetEntry(ctx, id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "entry not found")
+		return
+	}
+	setETag(w, entry)
+	writeJSON(w, http.StatusOK, entry)
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/pbaille/kb/internal/export"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// getGraph returns the graph of entries and tags, as JSON nodes and edges
+// or, with format=dot, for Graphviz. min_similarity sets how alike entries
+// must be to be connected, 0 for not at all.
+func (s *Server) getGraph(w http.ResponseWriter, r *http.Request) {
+	minSimilarity := store.DefaultGraphSimilarity
+	if v := r.URL.Query().Get("min_similarity"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid min_similarity")
+			return
+		}
+		minSimilarity = f
+	}
+
+	g, err := s.store.Graph(r.Context(), minSimilarity)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		writeJSON(w, http.StatusOK, g)
+	case "dot":
+		w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+		export.WriteGraph(w, format, g)
+	default:
+		writeError(w, http.StatusBadRequest, "unknown format "+strconv.Quote(format)+" (use json or dot)")
+	}
+}
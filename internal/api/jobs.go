@@ -0,0 +1,255 @@
+package api
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pbaille/kb/internal/journal"
+	"github.com/pbaille/kb/internal/pipeline"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// Job statuses
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// Job is the processing (classification, rules, embedding) of a capture
+// that arrived while the server was busy. The entry is stored before the
+// job is queued; jobs are kept in memory, and those cut short by a
+// restart are finished from the journal.
+type Job struct {
+	ID      string `json:"id"`
+	Status  string `json:"status"`
+	EntryID string `json:"entry_id"`
+	// EstimatedSeconds is how long processing was expected to take, from
+	// when the job was queued
+	EstimatedSeconds int               `json:"estimated_seconds"`
+	Error            string            `json:"error,omitempty"`
+	Result           *AddEntryResponse `json:"result,omitempty"`
+	QueuedAt         time.Time         `json:"queued_at"`
+	StartedAt        *time.Time        `json:"started_at,omitempty"`
+	FinishedAt       *time.Time        `json:"finished_at,omitempty"`
+
+	// user is the ID of the user who made the capture, the only one who
+	// can look the job up ("" for the database owner)
+	user string
+}
+
+// jobRetention is how long finished jobs can be looked up
+const jobRetention = time.Hour
+
+// initialProcessingTime is the processing time assumed until one was
+// measured
+const initialProcessingTime = 5 * time.Second
+
+// processing bounds how many captures are processed at once. Captures
+// arriving while all slots are taken, or while jobs are waiting, are
+// queued instead, up to a soft limit.
+type processing struct {
+	ctx   context.Context
+	slots chan struct{}
+
+	mu        sync.Mutex
+	jobs      map[string]*Job
+	queued    int
+	maxQueued int
+	// average is a moving average of processing times
+	average time.Duration
+}
+
+func newProcessing(ctx context.Context, maxProcessing, maxQueued int) *processing {
+	return &processing{
+		ctx:       ctx,
+		slots:     make(chan struct{}, max(maxProcessing, 1)),
+		jobs:      make(map[string]*Job),
+		maxQueued: maxQueued,
+		average:   initialProcessingTime,
+	}
+}
+
+// tryAcquire takes a processing slot if one is free and no job is
+// waiting for one, returning the function giving it back
+func (p *processing) tryAcquire() (func(), bool) {
+	p.mu.Lock()
+	waiting := p.queued > 0
+	p.mu.Unlock()
+	if waiting {
+		return nil, false
+	}
+	select {
+	case p.slots <- struct{}{}:
+		return p.releaser(time.Now()), true
+	default:
+		return nil, false
+	}
+}
+
+func (p *processing) releaser(start time.Time) func() {
+	return func() {
+		<-p.slots
+		p.mu.Lock()
+		p.average = (p.average*4 + time.Since(start)) / 5
+		p.mu.Unlock()
+	}
+}
+
+// full reports whether the queue has reached its limit
+func (p *processing) full() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.queued >= p.maxQueued
+}
+
+// estimate is how many seconds a capture queued behind ahead others
+// should take to be processed
+func (p *processing) estimate(ahead int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	waves := float64(ahead/cap(p.slots) + 1)
+	return int(math.Ceil(p.average.Seconds() * waves))
+}
+
+// queue runs a job in the background once a slot is free, returning a
+// snapshot of it. run is given the server's context, acting as the user
+// and working in the notebook scope gives.
+func (p *processing) queue(scope context.Context, notebook, entryID string, run func(context.Context) (*AddEntryResponse, error)) Job {
+	estimate := p.estimate(p.waiting())
+
+	p.mu.Lock()
+	p.prune()
+	job := &Job{
+		ID:               uuid.New().String(),
+		Status:           JobQueued,
+		EntryID:          entryID,
+		EstimatedSeconds: estimate,
+		QueuedAt:         time.Now(),
+		user:             store.UserID(scope),
+	}
+	p.jobs[job.ID] = job
+	p.queued++
+	snapshot := *job
+	p.mu.Unlock()
+
+	go func() {
+		select {
+		case p.slots <- struct{}{}:
+		case <-p.ctx.Done():
+			p.finish(job, nil, p.ctx.Err())
+			return
+		}
+		release := p.releaser(time.Now())
+		defer release()
+
+		p.mu.Lock()
+		now := time.Now()
+		job.Status, job.StartedAt = JobRunning, &now
+		p.queued--
+		p.mu.Unlock()
+
+		ctx := store.WithNotebook(store.WithUser(p.ctx, job.user), notebook)
+		resp, err := run(ctx)
+		p.finish(job, resp, err)
+	}()
+	return snapshot
+}
+
+// finish records a job's outcome
+func (p *processing) finish(job *Job, resp *AddEntryResponse, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	if job.StartedAt == nil {
+		p.queued--
+	}
+	job.FinishedAt = &now
+	if err != nil {
+		job.Status, job.Error = JobFailed, err.Error()
+		return
+	}
+	job.Status, job.Result = JobDone, resp
+}
+
+// job returns a snapshot of a job
+func (p *processing) job(id string) (Job, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	job, ok := p.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+func (p *processing) waiting() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.queued
+}
+
+// prune forgets jobs finished more than jobRetention ago; p.mu is held
+func (p *processing) prune() {
+	for id, job := range p.jobs {
+		if job.FinishedAt != nil && time.Since(*job.FinishedAt) > jobRetention {
+			delete(p.jobs, id)
+		}
+	}
+}
+
+// deferCapture stores a capture and queues its processing, answering 202
+// with the job. The capture is journaled unless it goes to an encrypted
+// notebook. With the queue full too, it answers 503.
+func (s *Server) deferCapture(w http.ResponseWriter, r *http.Request, c journal.Capture, journaled bool) {
+	ctx := r.Context()
+	if s.processing.full() {
+		w.Header().Set("Retry-After", strconv.Itoa(s.processing.estimate(s.processing.waiting())))
+		writeError(w, http.StatusServiceUnavailable, "too many captures waiting to be processed, retry later")
+		return
+	}
+
+	c.User = store.UserID(ctx)
+	j := s.journal
+	if !journaled {
+		j = nil
+	} else if err := j.Append(&c); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	entry, problems, err := pipeline.StoreCapture(ctx, s.store, j, c)
+	if err != nil {
+		writeNotebookError(w, err)
+		return
+	}
+	for _, problem := range problems {
+		s.logger().Warn("store capture", "entry", entry.ID, "problem", problem)
+	}
+
+	job := s.processing.queue(ctx, s.store.Notebook(ctx), entry.ID, func(ctx context.Context) (*AddEntryResponse, error) {
+		res, err := pipeline.Complete(ctx, s.store, j, c, entry.ID, pipeline.ProcessOptions{Similar: similarOnCapture})
+		if err != nil {
+			return nil, err
+		}
+		return response(res), nil
+	})
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// getJob returns a deferred capture's processing status, to the user who
+// made the capture only
+func (s *Server) getJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.processing.job(r.PathValue("id"))
+	if !ok || job.user != store.UserID(r.Context()) {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
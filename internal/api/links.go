@@ -0,0 +1,82 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// LinkRequest is the request body for linking an entry to another
+type LinkRequest struct {
+	To string `json:"to"`
+	// Kind is relates (the default), contradicts or expands
+	Kind string `json:"kind,omitempty"`
+}
+
+// addEntryLink links an entry to another, replacing any link between
+// them, and returns the entry
+func (s *Server) addEntryLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+
+	var req LinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.To == "" {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Kind == "" {
+		req.Kind = domain.LinkRelates
+	}
+	if err := domain.CheckLinkKind(req.Kind); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	to, err := s.store.ResolveID(ctx, req.To)
+	var ambiguous *store.AmbiguousIDError
+	switch {
+	case errors.Is(err, store.ErrEntryNotFound):
+		writeError(w, http.StatusNotFound, "entry not found: "+req.To)
+		return
+	case errors.As(err, &ambiguous):
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := s.store.SetEntryLink(ctx, id, to, req.Kind); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.writeEntry(ctx, w, id)
+}
+
+// removeEntryLink removes the link between two entries, in either
+// direction, and returns the entry
+func (s *Server) removeEntryLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+	if err := s.store.UnlinkEntries(ctx, id, r.PathValue("other")); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	s.writeEntry(ctx, w, id)
+}
+
+// unresolvedLinks lists the [[wiki-links]] no entry matches, most linked
+// first
+func (s *Server) unresolvedLinks(w http.ResponseWriter, r *http.Request) {
+	links, err := s.store.UnresolvedWikiLinks(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if links == nil {
+		links = []store.UnresolvedLink{}
+	}
+	writeJSON(w, http.StatusOK, links)
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+func TestEntryLinksByPrefix(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.token("")
+	ctx := context.Background()
+	from, err := ts.store.AddEntry(ctx, "from")
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, err := ts.store.AddEntry(ctx, "to")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var entry domain.Entry
+	code := ts.do("POST", "/entries/"+from.ID[:8]+"/links", token, LinkRequest{To: to.ID[:8]}, &entry)
+	if code != http.StatusOK {
+		t.Fatalf("POST /entries/{prefix}/links = %d, want 200", code)
+	}
+	if entry.ID != from.ID || len(entry.Links) != 1 {
+		t.Fatalf("linked entry = %s with %d links, want %s with 1", entry.ID, len(entry.Links), from.ID)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		body   interface{}
+		want   int
+	}{
+		{"POST", "/entries/" + from.ID[:8] + "/links", LinkRequest{To: "nothing"}, http.StatusNotFound},
+		{"POST", "/entries/nothing/links", LinkRequest{To: to.ID}, http.StatusNotFound},
+		{"DELETE", "/entries/" + from.ID[:8] + "/links/nothing", nil, http.StatusNotFound},
+		{"DELETE", "/entries/" + from.ID[:8] + "/links/" + to.ID[:8], nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if code := ts.do(tt.method, tt.path, token, tt.body, nil); code != tt.want {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.path, code, tt.want)
+		}
+	}
+
+	got, err := ts.store.GetEntry(ctx, from.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Links) != 0 {
+		t.Errorf("links after DELETE = %v, want none", got.Links)
+	}
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// PromoteRequest is the request body for changing an entry's maturity
+type PromoteRequest struct {
+	To string `json:"to"`
+}
+
+// promoteEntry moves an entry to another maturity level
+func (s *Server) promoteEntry(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+
+	var req PromoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if !slices.Contains(domain.MaturityLevels, req.To) {
+		writeError(w, http.StatusBadRequest, "to must be fleeting, literature or evergreen")
+		return
+	}
+
+	current, err := s.store.GetEntry(ctx, id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "entry not found")
+		return
+	}
+	if err := s.store.SetMaturity(ctx, id, req.To); err != nil {
+		// The transition itself is what's wrong, e.g. fleeting → fleeting
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	current.Maturity = req.To
+	writeJSON(w, http.StatusOK, current)
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/fetcher"
+	"github.com/pbaille/kb/internal/journal"
+)
+
+// mobileManifest lets the capture page be installed and used as a share target
+const mobileManifest = `{
+  "name": "kb capture",
+  "short_name": "kb",
+  "start_url": "/m/add",
+  "display": "standalone",
+  "background_color": "#1a1a1f",
+  "theme_color": "#1a1a1f",
+  "share_target": {
+    "action": "/m/add",
+    "method": "GET",
+    "params": {"title": "title", "text": "text", "url": "url"}
+  }
+}`
+
+var mobileTemplate = template.Must(template.New("mobile").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="theme-color" content="#1a1a1f">
+<link rel="manifest" href="/m/manifest.webmanifest">
+<title>kb capture</title>
+<style>
+  body { background: #1a1a1f; color: #eee; font-family: -apple-system, sans-serif; margin: 0; padding: 1rem; }
+  textarea { width: 100%; box-sizing: border-box; min-height: 40vh; font-size: 1.1rem; padding: 0.75rem;
+             background: #26262d; color: #eee; border: 1px solid #444; border-radius: 8px; }
+  button { margin-top: 0.75rem; width: 100%; padding: 0.9rem; font-size: 1.1rem; border: 0; border-radius: 8px;
+           background: #e8a33d; color: #1a1a1f; }
+  .msg { padding: 0.75rem; border-radius: 8px; background: #26262d; margin-bottom: 1rem; }
+  .error { color: #ff8a80; }
+  .tag { display: inline-block; margin: 0.2rem; padding: 0.1rem 0.5rem; border-radius: 999px; background: #3a3a44; }
+</style>
+</head>
+<body>
+{{if .Error}}<div class="msg error">{{.Error}}</div>{{end}}
+{{if .Saved}}<div class="msg">Saved <code>{{.Saved}}</code>{{if .Notice}} ({{.Notice}}){{end}}{{range .Tags}} <span class="tag">{{.}}</span>{{end}}</div>{{end}}
+<form method="POST">
+  <textarea name="content" placeholder="Capture a thought or paste a link" autofocus>{{.Content}}</textarea>
+  <button type="submit">Save</button>
+</form>
+</body>
+</html>
+`))
+
+type mobilePage struct {
+	Content string
+	Saved   string
+	Notice  string
+	Tags    []string
+	Error   string
+}
+
+func (s *Server) mobileManifest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/manifest+json")
+	fmt.Fprint(w, mobileManifest)
+}
+
+// mobileAddForm renders the capture form, prefilled from share-target params
+func (s *Server) mobileAddForm(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	renderMobile(w, http.StatusOK, mobilePage{
+		Content: sharedContent(q.Get("title"), q.Get("text"), q.Get("url")),
+	})
+}
+
+func (s *Server) mobileAdd(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if err := r.ParseForm(); err != nil {
+		renderMobile(w, http.StatusBadRequest, mobilePage{Error: "invalid form"})
+		return
+	}
+
+	content := strings.TrimSpace(r.PostForm.Get("content"))
+	if content == "" {
+		content = sharedContent(r.PostForm.Get("title"), r.PostForm.Get("text"), r.PostForm.Get("url"))
+	}
+	if content == "" {
+		renderMobile(w, http.StatusBadRequest, mobilePage{Error: "nothing to save"})
+		return
+	}
+
+	source := domain.Source{Type: domain.SourceNote}
+
+	// A lone shared link is fetched like `kb add <url>`
+	rawURL := ""
+	if fetcher.IsURL(content) && !strings.ContainsAny(content, " \n") {
+		rawURL = content
+		existing, err := s.seenBefore(ctx, rawURL, "mobile")
+		if err != nil {
+			renderMobile(w, http.StatusInternalServerError, mobilePage{Content: content, Error: err.Error()})
+			return
+		}
+		if existing != nil {
+			page := mobilePage{Saved: domain.ShortID(existing.ID, s.shortIDLength(ctx)), Notice: "already saved"}
+			for _, t := range existing.Tags {
+				page.Tags = append(page.Tags, t.Name)
+			}
+			renderMobile(w, http.StatusOK, page)
+			return
+		}
+
+		page, err := fetcher.Fetch(ctx, content)
+		if err != nil {
+			renderMobile(w, http.StatusBadGateway, mobilePage{Content: content, Error: "fetch URL: " + err.Error()})
+			return
+		}
+		now := time.Now()
+		source = domain.Source{
+			Type:         domain.SourceURL,
+			URL:          rawURL,
+			CanonicalURL: page.CanonicalURL,
+			Title:        page.Title,
+			Author:       page.Author,
+			FetchedAt:    &now,
+		}
+		if source.Title == "" {
+			source.Title = strings.TrimSpace(r.PostForm.Get("title"))
+		}
+		template, err := s.store.CaptureTemplate(ctx)
+		if err != nil {
+			renderMobile(w, http.StatusInternalServerError, mobilePage{Content: content, Error: err.Error()})
+			return
+		}
+		content = page.Capture().Render(template)
+	}
+
+	resp, err := s.ingest(ctx, journal.Capture{Content: content, Source: source, Via: "mobile", URL: rawURL})
+	if err != nil {
+		renderMobile(w, http.StatusInternalServerError, mobilePage{Content: content, Error: err.Error()})
+		return
+	}
+
+	page := mobilePage{Saved: domain.ShortID(resp.Entry.ID, s.shortIDLength(ctx))}
+	for _, t := range resp.Tags {
+		page.Tags = append(page.Tags, t.Name)
+	}
+	renderMobile(w, http.StatusCreated, page)
+}
+
+// sharedContent combines share-target fields into entry content
+func sharedContent(title, text, url string) string {
+	var parts []string
+	for _, p := range []string{title, text, url} {
+		p = strings.TrimSpace(p)
+		// Some platforms put the URL in text as well
+		if p != "" && !(p == url && strings.Contains(text, url)) {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+func renderMobile(w http.ResponseWriter, status int, page mobilePage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	mobileTemplate.Execute(w, page)
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/secret"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// AddNotebookRequest is the request body for creating a notebook; with a
+// passphrase, the notebook gets its own key
+type AddNotebookRequest struct {
+	Name       string `json:"name"`
+	Parent     string `json:"parent,omitempty"`
+	Passphrase string `json:"passphrase,omitempty"`
+}
+
+// UnlockNotebookRequest is the request body for unlocking a notebook
+type UnlockNotebookRequest struct {
+	Passphrase string `json:"passphrase"`
+}
+
+// EntryNotebookRequest is the request body for moving an entry to a
+// notebook; an empty notebook takes it out of its notebook
+type EntryNotebookRequest struct {
+	Notebook string `json:"notebook"`
+}
+
+// listNotebooks returns every notebook
+func (s *Server) listNotebooks(w http.ResponseWriter, r *http.Request) {
+	notebooks, err := s.store.ListNotebooks(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if notebooks == nil {
+		notebooks = []domain.Notebook{}
+	}
+	writeJSON(w, http.StatusOK, notebooks)
+}
+
+// addNotebook creates a notebook
+func (s *Server) addNotebook(w http.ResponseWriter, r *http.Request) {
+	var req AddNotebookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	nb := &domain.Notebook{Name: req.Name, Parent: req.Parent}
+	if err := s.store.AddNotebook(r.Context(), nb, req.Passphrase); err != nil {
+		writeNotebookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, nb)
+}
+
+// deleteNotebook removes an empty notebook
+func (s *Server) deleteNotebook(w http.ResponseWriter, r *http.Request) {
+	if err := s.store.DeleteNotebook(r.Context(), r.PathValue("name")); err != nil {
+		writeNotebookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted", "name": r.PathValue("name")})
+}
+
+// unlockNotebook keeps an encrypted notebook's key in the server until it
+// is locked again or the server stops
+func (s *Server) unlockNotebook(w http.ResponseWriter, r *http.Request) {
+	var req UnlockNotebookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := s.store.UnlockNotebook(r.Context(), r.PathValue("name"), req.Passphrase); err != nil {
+		writeNotebookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "unlocked", "name": r.PathValue("name")})
+}
+
+// lockNotebook forgets an encrypted notebook's key
+func (s *Server) lockNotebook(w http.ResponseWriter, r *http.Request) {
+	s.store.LockNotebook(r.PathValue("name"))
+	writeJSON(w, http.StatusOK, map[string]string{"status": "locked", "name": r.PathValue("name")})
+}
+
+// notebookEntries lists the entries of a notebook and its sub-notebooks
+func (s *Server) notebookEntries(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	nb, err := s.store.GetNotebook(ctx, r.PathValue("name"))
+	if err != nil {
+		writeNotebookError(w, err)
+		return
+	}
+
+	limit := 20
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if n, err := strconv.Atoi(l); err == nil && n > 0 {
+			limit = n
+		}
+	}
+	entries, err := s.store.FilterEntries(ctx, domain.EntryFilter{Notebook: nb.Name, Limit: limit})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"notebook": nb,
+		"entries":  entries,
+		"limit":    limit,
+	})
+}
+
+// setEntryNotebook moves an entry to a notebook
+func (s *Server) setEntryNotebook(w http.ResponseWriter, r *http.Request) {
+	var req EntryNotebookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	entry, err := s.store.SetEntryNotebook(r.Context(), r.PathValue("id"), req.Notebook)
+	if err != nil {
+		writeNotebookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, entry)
+}
+
+// writeNotebookError maps notebook errors to status codes
+func writeNotebookError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotebookNotFound), errors.Is(err, store.ErrEntryNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, store.ErrNotebookLocked), errors.Is(err, store.ErrDatabaseLocked):
+		writeError(w, http.StatusLocked, err.Error())
+	case errors.Is(err, secret.ErrWrongKey):
+		writeError(w, http.StatusForbidden, err.Error())
+	default:
+		writeError(w, http.StatusBadRequest, err.Error())
+	}
+}
+
+// notebookPrefix starts the paths of requests working in a notebook
+const notebookPrefix = "/nb/"
+
+// requestNotebookKey holds the notebook named by a request's /nb/ prefix
+type requestNotebookKey struct{}
+
+// withNotebook serves /nb/{notebook}/... as the route after the prefix,
+// working in that notebook and its sub-notebooks. The notebook is only
+// looked up by checkNotebook, once the request is authenticated, so
+// callers without a token can't tell which notebooks exist.
+func (s *Server) withNotebook(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rest, ok := strings.CutPrefix(r.URL.Path, notebookPrefix)
+		if !ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+		name, path, _ := strings.Cut(rest, "/")
+
+		u := *r.URL
+		u.Path, u.RawPath = "/"+path, ""
+		ctx := store.WithNotebook(r.Context(), name)
+		r = r.WithContext(context.WithValue(ctx, requestNotebookKey{}, name))
+		r.URL = &u
+		h.ServeHTTP(w, r)
+	})
+}
+
+// inNotebook reports whether r was made under a /nb/ prefix
+func inNotebook(r *http.Request) bool {
+	_, ok := r.Context().Value(requestNotebookKey{}).(string)
+	return ok
+}
+
+// checkNotebook answers 404 to requests under the /nb/ prefix of a
+// notebook that doesn't exist
+func (s *Server) checkNotebook(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if name, ok := r.Context().Value(requestNotebookKey{}).(string); ok {
+			if _, err := s.store.GetNotebook(r.Context(), name); err != nil {
+				writeNotebookError(w, err)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
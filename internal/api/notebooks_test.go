@@ -0,0 +1,37 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+func TestNotebookPrefixNeedsAuth(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.token("")
+	if err := ts.store.AddNotebook(context.Background(), &domain.Notebook{Name: "work"}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path  string
+		token string
+		want  int
+	}{
+		// Without a token, existing and missing notebooks look the same
+		{"/nb/work/entries", "", http.StatusUnauthorized},
+		{"/nb/missing/entries", "", http.StatusUnauthorized},
+		{"/nb/missing/health", "", http.StatusUnauthorized},
+		{"/nb/missing/s/x", "", http.StatusUnauthorized},
+		{"/nb/work/entries", token, http.StatusOK},
+		{"/nb/missing/entries", token, http.StatusNotFound},
+		{"/health", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if code := ts.do("GET", tt.path, tt.token, nil, nil); code != tt.want {
+			t.Errorf("GET %s (token %v) = %d, want %d", tt.path, tt.token != "", code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pbaille/kb/internal/metrics"
+)
+
+var (
+	requestsTotal = metrics.NewCounter(
+		"kb_http_requests_total", "HTTP requests served, by route and status",
+		"route", "status",
+	)
+	requestDuration = metrics.NewHistogram(
+		"kb_http_request_duration_seconds", "HTTP request duration, by route",
+		metrics.DefaultBuckets, "route",
+	)
+)
+
+// statusRecorder remembers the status code written to a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// routeKey is the request context key of the *string the mux pattern
+// that matched a request is recorded in
+type routeKey struct{}
+
+// withObservability logs every request and records its metrics. Routes are
+// labelled by their mux pattern, so IDs don't multiply the series.
+func (s *Server) withObservability(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		var route string
+		r = r.WithContext(context.WithValue(r.Context(), routeKey{}, &route))
+		h.ServeHTTP(rec, r)
+		elapsed := time.Since(start)
+
+		if route == "" {
+			route = "unmatched"
+		}
+		requestsTotal.Inc(route, strconv.Itoa(rec.status))
+		requestDuration.Observe(elapsed.Seconds(), route)
+
+		attrs := []interface{}{"method", r.Method, "path", r.URL.Path, "status", rec.status, "duration", elapsed}
+		if notebook := s.store.Notebook(r.Context()); notebook != "" {
+			attrs = append(attrs, "notebook", notebook)
+		}
+		s.logger().Info("request", attrs...)
+	})
+}
+
+// recordRoute records the pattern the mux matched for withObservability.
+// Middleware between them pass the mux copies of the request, on which
+// the mux sets the pattern, so it's read here, on the mux's own request.
+func recordRoute(mux http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r)
+		if route, ok := r.Context().Value(routeKey{}).(*string); ok {
+			*route = r.Pattern
+		}
+	})
+}
+
+// logger is the configured request logger, or slog's default
+func (s *Server) logger() *slog.Logger {
+	if s.opts.Logger != nil {
+		return s.opts.Logger
+	}
+	return slog.Default()
+}
+
+// getMetrics serves the metrics in the Prometheus text format
+func (s *Server) getMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.WriteText(w)
+}
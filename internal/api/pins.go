@@ -0,0 +1,23 @@
+package api
+
+import "net/http"
+
+// pinEntry pins an entry, listing it above the others
+func (s *Server) pinEntry(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := s.store.PinEntry(r.Context(), id); err != nil {
+		writeTrashError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "pinned", "id": id})
+}
+
+// unpinEntry unpins an entry
+func (s *Server) unpinEntry(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := s.store.UnpinEntry(r.Context(), id); err != nil {
+		writeTrashError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "unpinned", "id": id})
+}
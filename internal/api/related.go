@@ -0,0 +1,106 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/embedding"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// relatedEntries returns the entries closest to an entry: by embedding
+// when it has one, else by shared tags (with a zero similarity), with the
+// entries it links to and from
+func (s *Server) relatedEntries(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+	limit := 5
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if n, err := strconv.Atoi(l); err == nil && n > 0 {
+			limit = n
+		}
+	}
+
+	entry, err := s.store.GetEntry(ctx, id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "entry not found")
+		return
+	}
+
+	vector, err := s.store.GetEmbedding(ctx, id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	method := "embedding"
+	related := []store.SimilarEntry{}
+	if vector != nil {
+		if related, err = s.store.FindSimilar(ctx, vector, limit, id); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	} else {
+		method = "tags"
+		entries, err := s.store.FindSimilarByTags(ctx, id, limit)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		for _, e := range entries {
+			related = append(related, store.SimilarEntry{Entry: e})
+		}
+	}
+
+	// Entries linked by hand come along, whatever their similarity
+	links, backlinks := entry.Links, entry.Backlinks
+	if links == nil {
+		links = []domain.EntryLink{}
+	}
+	if backlinks == nil {
+		backlinks = []domain.EntryLink{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"related":   related,
+		"method":    method,
+		"links":     links,
+		"backlinks": backlinks,
+	})
+}
+
+// semanticSearch ranks entries by embedding similarity to the query
+func (s *Server) semanticSearch(w http.ResponseWriter, r *http.Request, query string) {
+	ctx := r.Context()
+	limit := 20
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if n, err := strconv.Atoi(l); err == nil && n > 0 {
+			limit = n
+		}
+	}
+
+	embSvc, err := embedding.New()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, "semantic search needs an embedding service: "+err.Error())
+		return
+	}
+	vector, err := embSvc.Embed(ctx, query)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	similar, err := s.store.FindSimilar(ctx, vector, limit, "")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if similar == nil {
+		similar = []store.SimilarEntry{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"similar": similar,
+		"query":   query,
+		"mode":    "semantic",
+	})
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/rules"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// ReminderRequest is the request body for setting a reminder: when, as
+// kb remind reads it ("in 3 days", "friday at 2pm"), or a time
+type ReminderRequest struct {
+	When     string     `json:"when,omitempty"`
+	RemindAt *time.Time `json:"remind_at,omitempty"`
+	Note     string     `json:"note,omitempty"`
+}
+
+// setReminder sets when to be reminded of an entry, replacing its
+// reminder
+func (s *Server) setReminder(w http.ResponseWriter, r *http.Request) {
+	var req ReminderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.When == "") == (req.RemindAt == nil) {
+		writeError(w, http.StatusBadRequest, "invalid request body (give when or remind_at)")
+		return
+	}
+	at := time.Time{}
+	if req.RemindAt != nil {
+		at = *req.RemindAt
+	} else {
+		var err error
+		if at, err = domain.ParseRemindTime(req.When, time.Now()); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	reminder, err := s.store.SetReminder(r.Context(), r.PathValue("id"), at, req.Note)
+	if errors.Is(err, store.ErrEntryNotFound) {
+		writeError(w, http.StatusNotFound, "entry not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, reminder)
+}
+
+// clearReminder removes an entry's reminder and returns the entry
+func (s *Server) clearReminder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+	err := s.store.ClearReminder(ctx, id)
+	if errors.Is(err, store.ErrReminderNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.writeEntry(ctx, w, id)
+}
+
+// dueReminders lists the reminders due, with their entries, soonest
+// first; within (e.g. 7d) adds those coming due in that time
+func (s *Server) dueReminders(w http.ResponseWriter, r *http.Request) {
+	until := time.Now()
+	if v := r.URL.Query().Get("within"); v != "" {
+		d, err := rules.ParseDelay(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		until = until.Add(d)
+	}
+
+	reminders, err := s.store.ListReminders(r.Context(), until)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if reminders == nil {
+		reminders = []domain.Reminder{}
+	}
+	writeJSON(w, http.StatusOK, reminders)
+}
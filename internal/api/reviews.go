@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/pbaille/kb/internal/srs"
+)
+
+// GradeReviewRequest is the request body for grading a review
+type GradeReviewRequest struct {
+	Grade int `json:"grade"`
+}
+
+func (s *Server) dueReviews(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	limit := 20
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if n, err := strconv.Atoi(l); err == nil && n > 0 {
+			limit = n
+		}
+	}
+
+	entries, err := s.store.DueReviews(ctx, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	for i := range entries {
+		tags, _ := s.store.GetEntryTags(ctx, entries[i].ID)
+		entries[i].Tags = tags
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"entries": entries,
+		"limit":   limit,
+	})
+}
+
+func (s *Server) gradeReview(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+
+	var req GradeReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Grade < 0 || req.Grade > srs.MaxGrade {
+		writeError(w, http.StatusBadRequest, "grade must be between 0 and 5")
+		return
+	}
+
+	if _, err := s.store.GetEntry(ctx, id); err != nil {
+		writeError(w, http.StatusNotFound, "entry not found")
+		return
+	}
+
+	review, err := s.store.GradeReview(ctx, id, req.Grade)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, review)
+}
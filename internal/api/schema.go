@@ -0,0 +1,217 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pbaille/kb/internal/ask"
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// schemaModels are the types documented by GET /schema
+var schemaModels = []interface{}{
+	domain.Entry{},
+	domain.Source{},
+	domain.Tag{},
+	domain.EntryTag{},
+	domain.SourceOccurrence{},
+	domain.Attachment{},
+	domain.Review{},
+	domain.Rule{},
+	domain.PreTagger{},
+	domain.TagQuality{},
+	domain.TagActivity{},
+	domain.LabeledEntry{},
+	domain.Feed{},
+	domain.UISettings{},
+	domain.Workflow{},
+	domain.EntryState{},
+	domain.Section{},
+	domain.MergedEntry{},
+	domain.EntryVersion{},
+	domain.Notebook{},
+	domain.Collection{},
+	domain.User{},
+	domain.Reminder{},
+	domain.Share{},
+	domain.Graph{},
+	domain.GraphNode{},
+	domain.GraphEdge{},
+	domain.SyncChange{},
+	domain.SyncEntry{},
+	domain.SyncConflict{},
+	store.SimilarEntry{},
+	store.SyncResult{},
+	store.UnresolvedLink{},
+	store.Stats{},
+	ask.Answer{},
+	ask.Reference{},
+	AddEntryRequest{},
+	AddEntryResponse{},
+	Job{},
+	UpdateEntryRequest{},
+	AppendEntryRequest{},
+	MergeRequest{},
+	LinkRequest{},
+	ReminderRequest{},
+	ShareRequest{},
+	ShareResponse{},
+	AskRequest{},
+	ClassifyRequest{},
+	ClassifyResponse{},
+	RevertRequest{},
+	AddNotebookRequest{},
+	UnlockNotebookRequest{},
+	EntryNotebookRequest{},
+	AddUserRequest{},
+	AddUserResponse{},
+	ClipRequest{},
+	PromoteRequest{},
+	ConflictResponse{},
+	TagWithParent{},
+	TagNode{},
+	UpdateTagRequest{},
+	WorkflowStats{},
+	WorkflowStateRequest{},
+	CollectionEntriesRequest{},
+	CollectionResponse{},
+	SyncChangesResponse{},
+	SyncPushRequest{},
+}
+
+// schemaEnums lists the allowed values of string fields, by "Type.field"
+var schemaEnums = map[string][]string{
+	"Source.type":             domain.SourceTypes,
+	"TagLabel.origin":         {domain.OriginAuto, domain.OriginHuman},
+	"Entry.maturity":          domain.MaturityLevels,
+	"SyncConflict.kept":       {domain.ConflictKeptLocal, domain.ConflictKeptRemote},
+	"PromoteRequest.to":       domain.MaturityLevels,
+	"UISettings.theme":        domain.UIThemes,
+	"UISettings.default_view": domain.UIViews,
+	"UISettings.columns":      domain.UIColumns,
+	"Section.kind":            domain.SectionKinds,
+	"Job.status":              {JobQueued, JobRunning, JobDone, JobFailed},
+}
+
+// Relation describes how two models reference each other
+type Relation struct {
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Kind        string `json:"kind"` // "many-to-one" or "many-to-many"
+	Description string `json:"description"`
+}
+
+var schemaRelations = []Relation{
+	{"Entry", "Tag", "many-to-many", "entries are tagged through EntryTag, with a confidence"},
+	{"Tag", "Tag", "many-to-one", "parent_id builds the tag hierarchy"},
+	{"Attachment", "Entry", "many-to-one", "entry_id"},
+	{"SourceOccurrence", "Entry", "many-to-one", "entry_id; every place an entry's URL was seen"},
+	{"Review", "Entry", "many-to-one", "entry_id; spaced repetition state"},
+	{"Entry", "Entry", "many-to-many", "links of a kind (relates, contradicts, expands) from one entry to another, listed as backlinks on the other"},
+	{"MergedEntry", "Entry", "many-to-one", "entry_id; entries merged into another, with their original created_at"},
+	{"EntryVersion", "Entry", "many-to-one", "an entry's content and title at each past revision"},
+	{"Entry", "Notebook", "many-to-one", "notebook; entries of encrypted notebooks have their content encrypted"},
+	{"Notebook", "Notebook", "many-to-one", "parent nests notebooks"},
+	{"Entry", "Workflow", "many-to-many", "an entry's state in each workflow it was started in, as EntryState"},
+	{"Collection", "Entry", "many-to-many", "ordered by position; the same entry can be in several collections"},
+	{"Reminder", "Entry", "many-to-one", "entry_id; a follow-up due at remind_at, kept until cleared"},
+	{"Share", "Entry", "many-to-one", "entry_id; a read-only public link to the entry"},
+	{"Share", "Tag", "many-to-one", "tag; a read-only public link to the entries of the tag and its sub-tags"},
+	{"Entry", "User", "many-to-one", "entries and tags belong to the user whose token created them, or to the database owner"},
+}
+
+// getSchema returns the domain and API models as JSON Schema, generated
+// from the Go types, with the relations between them
+func (s *Server) getSchema(w http.ResponseWriter, r *http.Request) {
+	defs := make(map[string]interface{})
+	for _, m := range schemaModels {
+		typeSchema(reflect.TypeOf(m), defs)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"title":       "kb",
+		"$defs":       defs,
+		"x-relations": schemaRelations,
+	})
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// typeSchema returns the schema of t. Named structs are added to defs and
+// referenced.
+func typeSchema(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Struct:
+		ref := map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+		if _, ok := defs[t.Name()]; !ok {
+			defs[t.Name()] = nil // placeholder for recursive types
+			defs[t.Name()] = structSchema(t, defs)
+		}
+		return ref
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), defs)}
+	case t.Kind() == reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), defs)}
+	case t.Kind() == reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	}
+	return map[string]interface{}{}
+}
+
+func structSchema(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	props := make(map[string]interface{})
+	required := []string{}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		prop := typeSchema(f.Type, defs)
+		if values, ok := schemaEnums[t.Name()+"."+name]; ok {
+			// The values of a list field constrain its items
+			if items, ok := prop["items"].(map[string]interface{}); ok {
+				items["enum"] = values
+			} else {
+				prop["enum"] = values
+			}
+		}
+		props[name] = prop
+
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer {
+			required = append(required, name)
+		}
+	}
+
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": props,
+		"required":   required,
+	}
+}
@@ -1,61 +1,365 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/pbaille/kb/internal/blobs"
 	"github.com/pbaille/kb/internal/classifier"
 	"github.com/pbaille/kb/internal/domain"
-	"github.com/pbaille/kb/internal/embedding"
+	"github.com/pbaille/kb/internal/journal"
+	"github.com/pbaille/kb/internal/pipeline"
+	"github.com/pbaille/kb/internal/query"
 	"github.com/pbaille/kb/internal/store"
+	"golang.org/x/crypto/acme/autocert"
 )
 
 // Server handles HTTP requests for the knowledge base API
 type Server struct {
-	store *store.Store
-	addr  string
+	store      *store.Store
+	blobs      *blobs.Store
+	journal    *journal.Journal
+	processing *processing
+	snapshots  *snapshots
+	opts       Options
 }
 
-// New creates a new API server
+// Options configures the API server
+type Options struct {
+	Addr string
+	// AllowedOrigins are the browser origins allowed by CORS; "*" allows any
+	AllowedOrigins []string
+
+	// CertFile and KeyFile serve HTTPS with a certificate from disk
+	CertFile string
+	KeyFile  string
+	// AutocertDomains serve HTTPS with Let's Encrypt certificates for these
+	// domains, cached in AutocertCache. The server must be reachable on
+	// port 443 for the TLS-ALPN challenge.
+	AutocertDomains []string
+	AutocertCache   string
+
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// ShutdownTimeout bounds how long in-flight requests get to finish
+	ShutdownTimeout time.Duration
+
+	// MaxProcessing is how many captures POST /entries classifies and
+	// embeds at once. Beyond that, captures are stored and answered with
+	// 202 and a job, processed in the background; MaxQueued such jobs can
+	// wait before captures get 503.
+	MaxProcessing int
+	MaxQueued     int
+
+	// SnapshotMaxAge is how old the database snapshot analytics requests
+	// read can get before it's taken again; 0 reads the live database
+	SnapshotMaxAge time.Duration
+
+	// NoAuth opens the API to requests without a token, for local use.
+	// It's refused unless Addr is a loopback address, and has no effect
+	// once a token was ever issued or KB_API_TOKEN is set.
+	NoAuth bool
+
+	// Logger receives one line per request; nil uses slog's default
+	Logger *slog.Logger
+}
+
+// DefaultOptions listens on :8080 over plain HTTP and allows any origin.
+// The write timeout leaves room for fetching and classifying a URL.
+func DefaultOptions() Options {
+	return Options{
+		Addr:            ":8080",
+		AllowedOrigins:  []string{"*"},
+		ReadTimeout:     30 * time.Second,
+		WriteTimeout:    2 * time.Minute,
+		IdleTimeout:     2 * time.Minute,
+		ShutdownTimeout: 15 * time.Second,
+		MaxProcessing:   4,
+		MaxQueued:       100,
+		SnapshotMaxAge:  time.Minute,
+	}
+}
+
+// New creates a new API server with default options on addr
 func New(s *store.Store, addr string) *Server {
-	return &Server{store: s, addr: addr}
+	opts := DefaultOptions()
+	opts.Addr = addr
+	return NewWithOptions(s, opts)
+}
+
+// NewWithOptions creates a new API server
+func NewWithOptions(s *store.Store, opts Options) *Server {
+	return &Server{store: s, blobs: blobs.ForDir(s.Dir()), opts: opts}
 }
 
-// Run starts the HTTP server
-func (s *Server) Run() error {
+// Run serves the API until ctx is cancelled, then waits for in-flight
+// requests to finish
+func (s *Server) Run(ctx context.Context) error {
+	if s.opts.NoAuth && !isLoopback(s.opts.Addr) {
+		return fmt.Errorf("--no-auth needs a loopback address (e.g. 127.0.0.1:8080), not %q", s.opts.Addr)
+	}
+
+	j, err := journal.Open(journal.ForDir(s.store.Dir()))
+	if err != nil {
+		return err
+	}
+	defer j.Close()
+	s.journal = j
+	s.processing = newProcessing(ctx, s.opts.MaxProcessing, s.opts.MaxQueued)
+	if err := s.store.RemoveSnapshots(); err != nil {
+		s.logger().Warn("remove snapshots", "err", err)
+	}
+	s.snapshots = &snapshots{store: s.store, maxAge: s.opts.SnapshotMaxAge}
+	defer s.snapshots.close()
+	if err := pipeline.Replay(ctx, s.store, j, s.logger()); err != nil {
+		return err
+	}
+
+	if n, err := s.store.CountActiveTokens(ctx); err == nil && n == 0 && os.Getenv("KB_API_TOKEN") == "" {
+		if issued, err := s.store.TokensIssued(ctx); err == nil && s.opts.NoAuth && !issued {
+			fmt.Println("Warning: --no-auth, the API is open to local clients")
+		} else {
+			fmt.Println("Warning: no active API tokens, every request will be refused (see kb token create)")
+		}
+	}
+	if uiFiles == nil {
+		fmt.Println("Warning: " + uiMissing)
+	}
+
+	srv := &http.Server{
+		Addr:              s.opts.Addr,
+		Handler:           s.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       s.opts.ReadTimeout,
+		WriteTimeout:      s.opts.WriteTimeout,
+		IdleTimeout:       s.opts.IdleTimeout,
+	}
+
+	serve, err := s.listener(srv)
+	if err != nil {
+		return err
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- serve() }()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	fmt.Println("Shutting down...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.opts.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	return nil
+}
+
+// handler routes the API's endpoints through its middleware
+func (s *Server) handler() http.Handler {
 	mux := http.NewServeMux()
 
 	// Entries
 	mux.HandleFunc("GET /entries", s.listEntries)
 	mux.HandleFunc("POST /entries", s.addEntry)
-	mux.HandleFunc("GET /entries/{id}", s.getEntry)
-	mux.HandleFunc("DELETE /entries/{id}", s.deleteEntry)
+	mux.HandleFunc("GET /entries/{id}", s.ownEntry(s.getEntry))
+	mux.HandleFunc("PUT /entries/{id}", s.ownEntry(s.updateEntry))
+	mux.HandleFunc("DELETE /entries/{id}", s.ownEntry(s.deleteEntry))
+	mux.HandleFunc("POST /entries/{id}/append", s.ownEntry(s.appendEntry))
+	mux.HandleFunc("POST /entries/{id}/merge", s.ownEntry(s.mergeEntries))
+	mux.HandleFunc("GET /entries/{id}/versions", s.ownEntry(s.listVersions))
+	mux.HandleFunc("GET /entries/{id}/versions/{revision}", s.ownEntry(s.getVersion))
+	mux.HandleFunc("POST /entries/{id}/revert", s.ownEntry(s.revertEntry))
+	mux.HandleFunc("POST /entries/{id}/archive", s.ownEntry(s.archiveEntry))
+	mux.HandleFunc("POST /entries/{id}/restore", s.ownEntry(s.restoreEntry))
+	mux.HandleFunc("POST /entries/{id}/pin", s.ownEntry(s.pinEntry))
+	mux.HandleFunc("DELETE /entries/{id}/pin", s.ownEntry(s.unpinEntry))
+	mux.HandleFunc("POST /entries/{id}/read", s.ownEntry(s.markRead))
+	mux.HandleFunc("DELETE /entries/{id}/read", s.ownEntry(s.markUnread))
+	mux.HandleFunc("GET /trash", s.listTrash)
+	mux.HandleFunc("DELETE /trash", s.adminOnly(s.purgeTrash))
+	mux.HandleFunc("POST /entries/{id}/promote", s.ownEntry(s.promoteEntry))
+	mux.HandleFunc("GET /entries/{id}/related", s.ownEntry(s.relatedEntries))
+	mux.HandleFunc("POST /entries/{id}/links", s.ownEntry(s.addEntryLink))
+	mux.HandleFunc("DELETE /entries/{id}/links/{other}", s.ownEntry(s.removeEntryLink))
+	mux.HandleFunc("GET /links/unresolved", s.unresolvedLinks)
+	mux.HandleFunc("GET /graph", s.getGraph)
+	mux.HandleFunc("POST /ask", s.askQuestion)
+	mux.HandleFunc("POST /classify", s.classifyText)
+	mux.HandleFunc("GET /jobs/{id}", s.getJob)
+
+	// Notebooks
+	mux.HandleFunc("GET /notebooks", s.adminOnly(s.listNotebooks))
+	mux.HandleFunc("POST /notebooks", s.adminOnly(s.addNotebook))
+	mux.HandleFunc("DELETE /notebooks/{name}", s.adminOnly(s.deleteNotebook))
+	mux.HandleFunc("GET /notebooks/{name}/entries", s.adminOnly(s.notebookEntries))
+	mux.HandleFunc("POST /notebooks/{name}/unlock", s.adminOnly(s.unlockNotebook))
+	mux.HandleFunc("POST /notebooks/{name}/lock", s.adminOnly(s.lockNotebook))
+	mux.HandleFunc("PUT /entries/{id}/notebook", s.adminOnly(s.ownEntry(s.setEntryNotebook)))
+
+	// Workflows
+	mux.HandleFunc("GET /workflows", s.adminOnly(s.listWorkflows))
+	mux.HandleFunc("POST /workflows", s.adminOnly(s.addWorkflow))
+	mux.HandleFunc("DELETE /workflows/{name}", s.adminOnly(s.deleteWorkflow))
+	mux.HandleFunc("GET /workflows/{name}/entries", s.adminOnly(s.workflowEntries))
+	mux.HandleFunc("PUT /entries/{id}/workflows/{name}", s.adminOnly(s.ownEntry(s.setWorkflowState)))
+	mux.HandleFunc("DELETE /entries/{id}/workflows/{name}", s.adminOnly(s.ownEntry(s.leaveWorkflow)))
+
+	// Collections
+	mux.HandleFunc("GET /collections", s.adminOnly(s.listCollections))
+	mux.HandleFunc("POST /collections", s.adminOnly(s.createCollection))
+	mux.HandleFunc("GET /collections/{name}", s.adminOnly(s.getCollection))
+	mux.HandleFunc("DELETE /collections/{name}", s.adminOnly(s.deleteCollection))
+	mux.HandleFunc("POST /collections/{name}/entries", s.adminOnly(s.addToCollection))
+	mux.HandleFunc("PUT /collections/{name}/entries", s.adminOnly(s.reorderCollection))
+	mux.HandleFunc("DELETE /collections/{name}/entries/{id}", s.adminOnly(s.removeFromCollection))
+	mux.HandleFunc("GET /collections/{name}/export", s.adminOnly(s.exportCollection))
+
+	// Users of a shared server
+	mux.HandleFunc("GET /users", s.adminOnly(s.listUsers))
+	mux.HandleFunc("POST /users", s.adminOnly(s.addUser))
+	mux.HandleFunc("DELETE /users/{name}", s.adminOnly(s.disableUser))
+
+	// Changes feed (offline clients)
+	mux.HandleFunc("GET /changes", s.changes)
+
+	// Sync between kb databases
+	mux.HandleFunc("GET /sync/changes", s.adminOnly(s.syncChanges))
+	mux.HandleFunc("POST /sync/changes", s.adminOnly(s.pushSyncChanges))
+	mux.HandleFunc("GET /sync/conflicts", s.adminOnly(s.syncConflicts))
+
+	// Attachments
+	mux.HandleFunc("GET /entries/{id}/attachments", s.ownEntry(s.listAttachments))
+	mux.HandleFunc("POST /entries/{id}/attachments", s.ownEntry(s.addAttachment))
+	mux.HandleFunc("GET /attachments/{id}", s.getAttachment)
 
 	// Tags
 	mux.HandleFunc("GET /tags", s.listTags)
+	mux.HandleFunc("PUT /tags/{name}", s.updateTag)
+	mux.HandleFunc("GET /tags/quality", s.tagQuality)
+	mux.HandleFunc("GET /tags/activity", s.tagActivity)
+	mux.HandleFunc("POST /entries/{id}/tags", s.ownEntry(s.addEntryTag))
+	mux.HandleFunc("DELETE /entries/{id}/tags/{tag}", s.ownEntry(s.removeEntryTag))
 
 	// Search
 	mux.HandleFunc("GET /search", s.searchEntries)
 
 	// Suggestions
 	mux.HandleFunc("GET /suggestions", s.getSuggestions)
-
-	// Health check
+	mux.HandleFunc("GET /random", s.randomEntry)
+
+	// Reviews (spaced repetition)
+	mux.HandleFunc("GET /reviews/due", s.dueReviews)
+	mux.HandleFunc("POST /entries/{id}/review", s.ownEntry(s.gradeReview))
+
+	// Reminders
+	mux.HandleFunc("GET /reminders/due", s.dueReminders)
+	mux.HandleFunc("PUT /entries/{id}/reminder", s.ownEntry(s.setReminder))
+	mux.HandleFunc("DELETE /entries/{id}/reminder", s.ownEntry(s.clearReminder))
+
+	// Read-only links, public under /s/
+	mux.HandleFunc("POST /entries/{id}/share", s.ownEntry(s.shareEntry))
+	mux.HandleFunc("POST /tags/{name}/share", s.shareTag)
+	mux.HandleFunc("GET /shares", s.listShares)
+	mux.HandleFunc("DELETE /shares/{id}", s.deleteShare)
+	mux.HandleFunc("GET /s/{token}", s.viewShare)
+
+	// Stats
+	mux.HandleFunc("GET /stats", s.getStats)
+	mux.HandleFunc("GET /stats/timeseries", s.timeSeries)
+
+	// Mobile quick capture (plain HTML, share target)
+	mux.HandleFunc("GET /m/add", s.mobileAddForm)
+	mux.HandleFunc("POST /m/add", s.mobileAdd)
+	mux.HandleFunc("GET /m/manifest.webmanifest", s.mobileManifest)
+
+	// Web clipper (browser extension, bookmarklet)
+	mux.HandleFunc("POST /clip", s.clip)
+
+	// Inbound email (Mailgun, SendGrid, raw messages)
+	mux.HandleFunc("POST /inbound-email", s.inboundEmail)
+
+	// Automation-friendly endpoints (Apple Shortcuts, Tasker)
+	mux.HandleFunc("GET /shortcuts/schema", s.shortcutsSchema)
+	mux.HandleFunc("GET /shortcuts/add", s.shortcutsAdd)
+	mux.HandleFunc("POST /shortcuts/add", s.shortcutsAdd)
+	mux.HandleFunc("GET /shortcuts/search", s.shortcutsSearch)
+	mux.HandleFunc("GET /shortcuts/suggest", s.shortcutsSuggest)
+
+	// Web UI, calling the API with the token it's given
+	mux.HandleFunc("GET /{$}", s.uiIndex)
+	mux.Handle("GET /ui/", uiHandler())
+	mux.HandleFunc("GET /settings", s.getSettings)
+	mux.HandleFunc("PUT /settings", s.putSettings)
+
+	// Schema of the domain and API models
+	mux.HandleFunc("GET /schema", s.getSchema)
+
+	// Health check and Prometheus metrics
 	mux.HandleFunc("GET /health", s.health)
+	mux.HandleFunc("GET /metrics", s.adminOnly(s.getMetrics))
+
+	return s.withNotebook(s.withObservability(s.withCORS(s.withAuth(s.checkNotebook(recordRoute(mux))))))
+}
+
+// listener configures TLS on srv and returns the function serving it
+func (s *Server) listener(srv *http.Server) (func() error, error) {
+	switch {
+	case len(s.opts.AutocertDomains) > 0:
+		if s.opts.CertFile != "" {
+			return nil, fmt.Errorf("use either a certificate file or autocert, not both")
+		}
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(s.opts.AutocertDomains...),
+			Cache:      autocert.DirCache(s.opts.AutocertCache),
+		}
+		srv.TLSConfig = m.TLSConfig()
+		fmt.Printf("Starting server on %s (HTTPS for %s)\n", srv.Addr, strings.Join(s.opts.AutocertDomains, ", "))
+		return func() error { return ignoreClosed(srv.ListenAndServeTLS("", "")) }, nil
+	case s.opts.CertFile != "" || s.opts.KeyFile != "":
+		if s.opts.CertFile == "" || s.opts.KeyFile == "" {
+			return nil, fmt.Errorf("HTTPS needs both a certificate and a key file")
+		}
+		fmt.Printf("Starting server on %s (HTTPS)\n", srv.Addr)
+		return func() error { return ignoreClosed(srv.ListenAndServeTLS(s.opts.CertFile, s.opts.KeyFile)) }, nil
+	default:
+		fmt.Printf("Starting server on %s\n", srv.Addr)
+		return func() error { return ignoreClosed(srv.ListenAndServe()) }, nil
+	}
+}
 
-	fmt.Printf("Starting server on %s\n", s.addr)
-	return http.ListenAndServe(s.addr, withCORS(mux))
+// ignoreClosed hides the error returned by a server stopped by Shutdown
+func ignoreClosed(err error) error {
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
 }
 
-// withCORS adds CORS headers for frontend development
-func withCORS(h http.Handler) http.Handler {
+// withCORS adds CORS headers for the allowed origins
+func (s *Server) withCORS(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		if origin := s.allowedOrigin(r.Header.Get("Origin")); origin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		w.Header().Add("Vary", "Origin")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -66,14 +370,31 @@ func withCORS(h http.Handler) http.Handler {
 	})
 }
 
+// allowedOrigin returns the Access-Control-Allow-Origin value for a
+// request origin, or "" if it isn't allowed
+func (s *Server) allowedOrigin(origin string) string {
+	for _, allowed := range s.opts.AllowedOrigins {
+		if allowed == "*" {
+			return "*"
+		}
+		if origin != "" && strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
 func (s *Server) health(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
 
 // AddEntryRequest is the request body for adding an entry
 type AddEntryRequest struct {
-	Content    string `json:"content"`
-	NoClassify bool   `json:"no_classify,omitempty"`
+	Content    string         `json:"content"`
+	Source     *domain.Source `json:"source,omitempty"`
+	Via        string         `json:"via,omitempty"`
+	NoClassify bool           `json:"no_classify,omitempty"`
+	Notebook   string         `json:"notebook,omitempty"`
 }
 
 // AddEntryResponse is the response for adding an entry
@@ -81,6 +402,18 @@ type AddEntryResponse struct {
 	Entry   *domain.Entry        `json:"entry"`
 	Tags    []TagWithParent      `json:"tags,omitempty"`
 	Similar []store.SimilarEntry `json:"similar,omitempty"`
+
+	// Duplicate is set when the source URL was already saved; Entry is
+	// then the existing entry, with the new sighting recorded
+	Duplicate bool `json:"duplicate,omitempty"`
+
+	// UnresolvedLinks are the [[wiki-links]] of the content no entry
+	// matches, to create stubs for
+	UnresolvedLinks []string `json:"unresolved_links,omitempty"`
+
+	// Problems describe the steps that failed once the entry was saved,
+	// e.g. its source sighting not being recorded
+	Problems []string `json:"problems,omitempty"`
 }
 
 // TagWithParent includes parent info for API response
@@ -91,6 +424,7 @@ type TagWithParent struct {
 }
 
 func (s *Server) addEntry(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	var req AddEntryRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid request body")
@@ -102,125 +436,227 @@ func (s *Server) addEntry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	entry, err := s.store.AddEntry(req.Content)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
-		return
+	source := domain.Source{Type: domain.SourceNote}
+	if req.Source != nil {
+		source = *req.Source
+	}
+	via := req.Via
+	if via == "" {
+		via = "api"
 	}
 
-	resp := AddEntryResponse{Entry: entry}
+	rawURL := source.URL
+	if rawURL != "" {
+		existing, err := s.seenBefore(ctx, rawURL, via)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if existing != nil {
+			writeJSON(w, http.StatusOK, &AddEntryResponse{Entry: existing, Duplicate: true})
+			return
+		}
+	}
 
-	// Classify unless disabled
-	if !req.NoClassify {
-		clf, err := classifier.New()
-		if err == nil {
-			existingTags, _ := s.store.ListTags()
-			tagNames := make([]string, len(existingTags))
-			for i, t := range existingTags {
-				tagNames[i] = t.Name
-			}
-
-			result, err := clf.Classify(req.Content, tagNames)
-			if err == nil {
-				for _, suggestion := range result.Tags {
-					var parentID *string
-
-					if suggestion.Parent != "" {
-						parentTag, err := s.store.GetOrCreateTag(suggestion.Parent, nil)
-						if err == nil {
-							parentID = &parentTag.ID
-						}
-					}
-
-					tag, err := s.store.GetOrCreateTag(suggestion.Name, parentID)
-					if err != nil {
-						continue
-					}
-
-					s.store.LinkEntryTag(entry.ID, tag.ID, suggestion.Confidence)
-
-					resp.Tags = append(resp.Tags, TagWithParent{
-						Name:       suggestion.Name,
-						Parent:     suggestion.Parent,
-						Confidence: suggestion.Confidence,
-					})
-				}
-
-				// Refresh entry with tags
-				entry, _ = s.store.GetEntry(entry.ID)
-				resp.Entry = entry
-			}
+	if req.Notebook == "" {
+		req.Notebook = s.store.Notebook(ctx)
+	}
+	capture := journal.Capture{Content: req.Content, Source: source, NoClassify: req.NoClassify, Notebook: req.Notebook, Via: via, URL: rawURL}
+	if req.Notebook != "" {
+		nb, err := s.store.GetNotebook(ctx, req.Notebook)
+		if err != nil {
+			writeNotebookError(w, err)
+			return
+		}
+		if nb.Locked {
+			writeError(w, http.StatusLocked, "notebook is locked: "+nb.KeyFrom)
+			return
 		}
 	}
+	journaled, err := pipeline.Journals(ctx, s.store, req.Notebook)
+	if err != nil {
+		writeNotebookError(w, err)
+		return
+	}
 
-	// Compute embedding and find similar entries
-	if embSvc, err := embedding.New(); err == nil {
-		if vector, err := embSvc.Embed(req.Content); err == nil {
-			// Find similar before saving (so we don't match ourselves)
-			similar, _ := s.store.FindSimilar(vector, 5, entry.ID)
-			resp.Similar = similar
+	release, ok := s.processing.tryAcquire()
+	if !ok {
+		s.deferCapture(w, r, capture, journaled)
+		return
+	}
+	defer release()
 
-			// Save embedding for future similarity searches
-			s.store.SaveEmbedding(entry.ID, vector, "voyage-3-lite")
-		}
+	resp, err := s.ingest(ctx, capture)
+	if errors.Is(err, store.ErrNotebookLocked) || errors.Is(err, store.ErrDatabaseLocked) {
+		writeNotebookError(w, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
 
 	writeJSON(w, http.StatusCreated, resp)
 }
 
-func (s *Server) getEntry(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
+// ingest journals a capture, then stores it and processes it (see
+// pipeline.Ingest). A capture whose processing fails or is interrupted is
+// finished when the server next starts.
+func (s *Server) ingest(ctx context.Context, c journal.Capture) (*AddEntryResponse, error) {
+	res, err := pipeline.Ingest(ctx, s.store, s.journal, c, pipeline.ProcessOptions{Similar: similarOnCapture})
+	if err != nil {
+		return nil, err
+	}
+	for _, problem := range res.Problems {
+		s.logger().Warn("capture incomplete", "entry", res.Entry.ID, "via", c.Via, "problem", problem)
+	}
+	return response(res), nil
+}
 
-	// Support prefix matching
-	entries, err := s.store.ListEntries(100, 0)
+// similarOnCapture is how many similar entries capture responses list
+const similarOnCapture = 5
+
+// process classifies a stored entry unless disabled, applies the rules and
+// computes its embedding, returning the entry with its tags and similar
+// entries
+func (s *Server) process(ctx context.Context, entry *domain.Entry, content string, noClassify bool) *AddEntryResponse {
+	return response(pipeline.Process(ctx, s.store, entry, content, pipeline.ProcessOptions{NoClassify: noClassify, Similar: similarOnCapture}))
+}
+
+// response describes a processed capture
+func response(res *pipeline.Result) *AddEntryResponse {
+	resp := &AddEntryResponse{Entry: res.Entry, Similar: res.Similar, UnresolvedLinks: res.UnresolvedLinks, Problems: res.Problems}
+	if res.Classification != nil {
+		resp.Tags = tagsWithParents(res.Classification.Tags)
+	}
+	return resp
+}
+
+// tagsWithParents lists the tags classification suggested
+func tagsWithParents(suggestions []classifier.TagSuggestion) []TagWithParent {
+	var tags []TagWithParent
+	for _, suggestion := range suggestions {
+		tags = append(tags, TagWithParent{
+			Name:       suggestion.Name,
+			Parent:     suggestion.Parent,
+			Confidence: suggestion.Confidence,
+		})
+	}
+	return tags
+}
+
+// linkWikiLinks links the response's entry to the entries its
+// [[wiki-links]] name, noting the ones none matches
+func (s *Server) linkWikiLinks(ctx context.Context, resp *AddEntryResponse) {
+	unresolved, err := s.store.LinkWikiLinks(ctx, resp.Entry.ID, resp.Entry.Content)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	resp.UnresolvedLinks = unresolved
+	if refreshed, err := s.store.GetEntry(ctx, resp.Entry.ID); err == nil {
+		resp.Entry = refreshed
+	}
+}
 
-	var fullID string
-	for _, e := range entries {
-		if strings.HasPrefix(e.ID, id) {
-			fullID = e.ID
-			break
-		}
+// shortIDLength is how long the CLI shows entry IDs. Finding it scans the
+// entries, so a response abbreviating several IDs finds it once.
+func (s *Server) shortIDLength(ctx context.Context) int {
+	n, err := s.store.ShortIDLength(ctx)
+	if err != nil {
+		return store.DefaultShortIDLength
 	}
+	return n
+}
+
+func (s *Server) getEntry(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.PathValue("id")
 
-	if fullID == "" {
+	// Support prefix matching
+	fullID, err := s.store.ResolveID(ctx, id)
+	var ambiguous *store.AmbiguousIDError
+	switch {
+	case errors.Is(err, store.ErrEntryNotFound):
 		writeError(w, http.StatusNotFound, "entry not found")
 		return
+	case errors.As(err, &ambiguous):
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
 
-	entry, err := s.store.GetEntry(fullID)
+	entry, err := s.store.GetEntry(ctx, fullID)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	s.store.MarkViewed(ctx, entry.ID)
+
+	setETag(w, entry)
 	writeJSON(w, http.StatusOK, entry)
 }
 
 func (s *Server) deleteEntry(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	id := r.PathValue("id")
 
-	err := s.store.DeleteEntry(id)
-	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			writeError(w, http.StatusNotFound, "entry not found")
-		} else {
-			writeError(w, http.StatusInternalServerError, err.Error())
+	if r.URL.Query().Get("permanent") == "true" {
+		if err := s.store.PurgeEntry(ctx, id); err != nil {
+			writeTrashError(w, err)
+			return
 		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "purged", "id": id})
 		return
 	}
 
-	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted", "id": id})
+	if err := s.store.DeleteEntry(ctx, id); err != nil {
+		writeTrashError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "trashed", "id": id})
+}
+
+// listOptions reads the since, until, unread, sort and reverse parameters
+// of an entry list
+func listOptions(r *http.Request) (domain.ListOptions, error) {
+	params := r.URL.Query()
+	opts := domain.ListOptions{Sort: params.Get("sort"), Reverse: params.Get("reverse") == "true"}
+	if v := params.Get("unread"); v != "" {
+		unread := v == "true"
+		opts.Unread = &unread
+	}
+	if opts.Sort != "" && !slices.Contains(domain.EntrySorts, opts.Sort) {
+		return opts, fmt.Errorf("unknown sort %q (use %s)", opts.Sort, strings.Join(domain.EntrySorts, ", "))
+	}
+	if m := params.Get("maturity"); m != "" && !slices.Contains(domain.MaturityLevels, m) {
+		return opts, fmt.Errorf("unknown maturity: %s", m)
+	}
+	now := time.Now()
+	var err error
+	if v := params.Get("since"); v != "" {
+		if opts.Since, err = query.ParseDate(v, now, false); err != nil {
+			return opts, fmt.Errorf("since: %w", err)
+		}
+	}
+	if v := params.Get("until"); v != "" {
+		if opts.Until, err = query.ParseDate(v, now, true); err != nil {
+			return opts, fmt.Errorf("until: %w", err)
+		}
+	}
+	return opts, nil
 }
 
 func (s *Server) listEntries(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	limit := 20
 	offset := 0
-	query := r.URL.Query().Get("q")
+	q := r.URL.Query().Get("q")
 	tagFilter := r.URL.Query().Get("tag")
+	maturity := r.URL.Query().Get("maturity")
 
 	if l := r.URL.Query().Get("limit"); l != "" {
 		if n, err := strconv.Atoi(l); err == nil && n > 0 {
@@ -234,16 +670,25 @@ func (s *Server) listEntries(w http.ResponseWriter, r *http.Request) {
 	}
 
 	includeChildren := r.URL.Query().Get("include_children") != "false"
+	scope := r.URL.Query().Get("scope")
+	if err := store.CheckScope(scope); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	var entries []domain.Entry
-	var err error
+	opts, err := listOptions(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	opts.Scope, opts.Maturity, opts.Limit, opts.Offset = scope, maturity, limit, offset
+	opts.Tag, opts.DirectTag = tagFilter, !includeChildren
+	opts.Query, opts.Scratch = q, r.URL.Query().Get("scratch") == "true"
 
-	if query != "" {
-		entries, err = s.store.SearchEntries(query)
-	} else if tagFilter != "" {
-		entries, err = s.store.GetEntriesByTag(tagFilter, includeChildren)
-	} else {
-		entries, err = s.store.ListEntries(limit, offset)
+	entries, err := s.store.ListEntriesSorted(ctx, opts)
+	if errors.Is(err, query.ErrSyntax) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
@@ -252,76 +697,146 @@ func (s *Server) listEntries(w http.ResponseWriter, r *http.Request) {
 
 	// Load tags for each entry
 	for i := range entries {
-		tags, _ := s.store.GetEntryTags(entries[i].ID)
+		tags, _ := s.store.GetEntryTags(ctx, entries[i].ID)
 		entries[i].Tags = tags
 	}
 
-	writeJSON(w, http.StatusOK, map[string]interface{}{
+	response := map[string]interface{}{
 		"entries": entries,
 		"limit":   limit,
 		"offset":  offset,
-		"query":   query,
+		"query":   q,
 		"tag":     tagFilter,
-	})
+	}
+	// The first page of all active entries comes with the pinned ones
+	if tagFilter == "" && offset == 0 && (scope == "" || scope == domain.ScopeActive) && !opts.Filtered() {
+		pinned, err := s.store.PinnedEntries(ctx)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		for i := range pinned {
+			tags, _ := s.store.GetEntryTags(ctx, pinned[i].ID)
+			pinned[i].Tags = tags
+		}
+		if pinned == nil {
+			pinned = []domain.Entry{}
+		}
+		response["pinned"] = pinned
+	}
+	writeJSON(w, http.StatusOK, response)
 }
 
 // TagNode represents a tag with its children for hierarchical display
 type TagNode struct {
-	ID       string    `json:"id"`
-	Name     string    `json:"name"`
-	Children []TagNode `json:"children,omitempty"`
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Color       string    `json:"color,omitempty"`
+	Children    []TagNode `json:"children,omitempty"`
+}
+
+// UpdateTagRequest is the request body for changing the details of a tag;
+// fields left out are unchanged
+type UpdateTagRequest struct {
+	Description *string `json:"description,omitempty"`
+	// Color is "#rrggbb" or "#rgb", "" to remove it
+	Color *string `json:"color,omitempty"`
 }
 
 func (s *Server) listTags(w http.ResponseWriter, r *http.Request) {
-	tags, err := s.store.ListTags()
+	ctx := r.Context()
+	tags, err := s.store.ListTags(ctx)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	// Build hierarchy
-	tagMap := make(map[string]domain.Tag)
-	children := make(map[string][]string)
-	var rootIDs []string
+	roots, children, cyclic := domain.TagTree(tags)
 
-	for _, t := range tags {
-		tagMap[t.ID] = t
-		if t.ParentID == nil {
-			rootIDs = append(rootIDs, t.ID)
-		} else {
-			children[*t.ParentID] = append(children[*t.ParentID], t.ID)
+	var buildNode func(t domain.Tag, depth int) TagNode
+	buildNode = func(t domain.Tag, depth int) TagNode {
+		node := TagNode{ID: t.ID, Name: t.Name, Description: t.Description, Color: t.Color}
+		if depth == domain.MaxTagDepth {
+			return node
 		}
-	}
-
-	var buildNode func(id string) TagNode
-	buildNode = func(id string) TagNode {
-		t := tagMap[id]
-		node := TagNode{ID: t.ID, Name: t.Name}
-		for _, childID := range children[id] {
-			node.Children = append(node.Children, buildNode(childID))
+		for _, child := range children[t.ID] {
+			node.Children = append(node.Children, buildNode(child, depth+1))
 		}
 		return node
 	}
 
 	var tree []TagNode
-	for _, rootID := range rootIDs {
-		tree = append(tree, buildNode(rootID))
+	for _, root := range roots {
+		tree = append(tree, buildNode(root, 0))
+	}
+	// Tags in a parent cycle are left out of the tree
+	cycles := []string{}
+	for _, t := range cyclic {
+		cycles = append(cycles, t.Name)
 	}
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"tags": tree,
-		"flat": tags,
+		"tags":   tree,
+		"flat":   tags,
+		"cycles": cycles,
 	})
 }
 
+func (s *Server) updateTag(w http.ResponseWriter, r *http.Request) {
+	var req UpdateTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	tag, err := s.store.GetTagByName(r.Context(), r.PathValue("name"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	tag, err = s.store.SetTagDetails(r.Context(), tag.Name, req.Description, req.Color)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, tag)
+}
+
 func (s *Server) searchEntries(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query().Get("q")
-	if query == "" {
-		writeError(w, http.StatusBadRequest, "query parameter 'q' is required")
+	ctx := r.Context()
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		writeError(w, http.StatusBadRequest, "q parameter 'q' is required")
+		return
+	}
+	if r.URL.Query().Get("mode") == "semantic" {
+		s.semanticSearch(w, r, q)
 		return
 	}
 
-	entries, err := s.store.SearchEntries(query)
+	scope := r.URL.Query().Get("scope")
+	if err := store.CheckScope(scope); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	opts, err := listOptions(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// Every match unless a limit is given
+	opts.Limit = queryLimit(r, 0)
+	if o, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && o > 0 {
+		opts.Offset = o
+	}
+	opts.Scope, opts.Maturity, opts.Tag = scope, r.URL.Query().Get("maturity"), r.URL.Query().Get("tag")
+	opts.Query, opts.Scratch = q, r.URL.Query().Get("scratch") == "true"
+
+	entries, err := s.store.ListEntriesSorted(ctx, opts)
+	if errors.Is(err, query.ErrSyntax) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -329,11 +844,32 @@ func (s *Server) searchEntries(w http.ResponseWriter, r *http.Request) {
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"entries": entries,
-		"query":   query,
+		"query":   q,
+		"limit":   opts.Limit,
+		"offset":  opts.Offset,
 	})
 }
 
+// randomEntry shows an entry picked at random, under the tag parameter if
+// given, favoring the entries unseen for longest with stale=true
+func (s *Server) randomEntry(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	entry, err := s.store.RandomEntry(ctx, r.URL.Query().Get("tag"), r.URL.Query().Get("stale") == "true")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if entry == nil {
+		writeError(w, http.StatusNotFound, "no entries")
+		return
+	}
+
+	s.store.MarkViewed(ctx, entry.ID)
+	writeJSON(w, http.StatusOK, entry)
+}
+
 func (s *Server) getSuggestions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	limit := 10
 	if l := r.URL.Query().Get("limit"); l != "" {
 		if n, err := strconv.Atoi(l); err == nil && n > 0 {
@@ -347,9 +883,9 @@ func (s *Server) getSuggestions(w http.ResponseWriter, r *http.Request) {
 	var err error
 
 	if entryID != "" {
-		entries, err = s.store.FindSimilarByTags(entryID, limit)
+		entries, err = s.store.FindSimilarByTags(ctx, entryID, limit)
 	} else {
-		entries, err = s.store.GetSuggestions(limit)
+		entries, err = s.store.GetSuggestions(ctx, limit)
 	}
 
 	if err != nil {
@@ -359,7 +895,7 @@ func (s *Server) getSuggestions(w http.ResponseWriter, r *http.Request) {
 
 	// Load tags for each entry
 	for i := range entries {
-		tags, err := s.store.GetEntryTags(entries[i].ID)
+		tags, err := s.store.GetEntryTags(ctx, entries[i].ID)
 		if err == nil {
 			entries[i].Tags = tags
 		}
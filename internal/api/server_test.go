@@ -0,0 +1,79 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// testServer serves the API on a fresh database, closed when the test ends
+type testServer struct {
+	t     *testing.T
+	store *store.Store
+	http  http.Handler
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	s, err := store.Open(filepath.Join(t.TempDir(), "kb.db"), store.StoreOptions{})
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	opts := DefaultOptions()
+	opts.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	return &testServer{t: t, store: s, http: NewWithOptions(s, opts).handler()}
+}
+
+// token issues a write token, for the user named if any, and returns its
+// secret
+func (ts *testServer) token(user string) string {
+	ts.t.Helper()
+	ctx := context.Background()
+	var userID string
+	if user != "" {
+		u, err := ts.store.AddUser(ctx, user, false)
+		if err != nil {
+			ts.t.Fatalf("add user: %v", err)
+		}
+		userID = u.ID
+	}
+	secret, _, err := ts.store.CreateAPIToken(ctx, "test", domain.ScopeWrite, userID)
+	if err != nil {
+		ts.t.Fatalf("create token: %v", err)
+	}
+	return secret
+}
+
+// do sends a request with a token, and a JSON body unless nil, and
+// decodes the JSON response into out unless nil
+func (ts *testServer) do(method, path, token string, body, out interface{}) int {
+	ts.t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			ts.t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	ts.http.ServeHTTP(rec, req)
+	if out != nil && rec.Code < 300 {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			ts.t.Fatalf("%s %s: decode %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// getSettings returns the web UI preferences of the requesting user
+func (s *Server) getSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := s.store.UISettings(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, settings)
+}
+
+// putSettings replaces the web UI preferences of the requesting user;
+// fields left out keep their default
+func (s *Server) putSettings(w http.ResponseWriter, r *http.Request) {
+	settings := domain.DefaultUISettings()
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := checkUISettings(settings); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if settings.Columns == nil {
+		settings.Columns = []string{}
+	}
+
+	if err := s.store.SaveUISettings(r.Context(), settings); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, settings)
+}
+
+func checkUISettings(settings domain.UISettings) error {
+	if !slices.Contains(domain.UIThemes, settings.Theme) {
+		return fmt.Errorf("unknown theme %q", settings.Theme)
+	}
+	if !slices.Contains(domain.UIViews, settings.DefaultView) {
+		return fmt.Errorf("unknown view %q", settings.DefaultView)
+	}
+	for _, c := range settings.Columns {
+		if !slices.Contains(domain.UIColumns, c) {
+			return fmt.Errorf("unknown column %q", c)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+func TestSettingsPerUser(t *testing.T) {
+	ts := newTestServer(t)
+	owner := ts.token("")
+	alice := ts.token("alice")
+	bob := ts.token("bob")
+
+	light := domain.DefaultUISettings()
+	light.Theme = "light"
+	if code := ts.do("PUT", "/settings", alice, light, nil); code != http.StatusOK {
+		t.Fatalf("PUT /settings as a user = %d, want 200", code)
+	}
+	if code := ts.do("PUT", "/settings", alice, map[string]string{"theme": "neon"}, nil); code != http.StatusBadRequest {
+		t.Errorf("PUT /settings with an unknown theme = %d, want 400", code)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		theme string
+	}{
+		{"alice", alice, "light"},
+		{"bob", bob, "dark"},
+		{"owner", owner, "dark"},
+	}
+	for _, tt := range tests {
+		var got domain.UISettings
+		if code := ts.do("GET", "/settings", tt.token, nil, &got); code != http.StatusOK {
+			t.Fatalf("%s: GET /settings = %d", tt.name, code)
+		}
+		if got.Theme != tt.theme {
+			t.Errorf("%s: theme = %s, want %s", tt.name, got.Theme, tt.theme)
+		}
+	}
+}
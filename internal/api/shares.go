@@ -0,0 +1,231 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/rules"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// ShareRequest is the optional request body for sharing: how long the
+// link stays valid (e.g. 7d, 12h); without it, it doesn't expire
+type ShareRequest struct {
+	ExpiresIn string `json:"expires_in,omitempty"`
+}
+
+// ShareResponse is a share with its public link
+type ShareResponse struct {
+	domain.Share
+	URL string `json:"url"`
+}
+
+// shareEntry creates a read-only link to an entry
+func (s *Server) shareEntry(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	expiresAt, ok := readShareRequest(w, r)
+	if !ok {
+		return
+	}
+	id, err := s.store.ResolveID(ctx, r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "entry not found")
+		return
+	}
+	share, err := s.store.ShareEntry(ctx, id, expiresAt)
+	if errors.Is(err, store.ErrEntryNotFound) {
+		writeError(w, http.StatusNotFound, "entry not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, ShareResponse{Share: *share, URL: shareURL(r, share.Token)})
+}
+
+// shareTag creates a read-only link to the entries of a tag
+func (s *Server) shareTag(w http.ResponseWriter, r *http.Request) {
+	expiresAt, ok := readShareRequest(w, r)
+	if !ok {
+		return
+	}
+	share, err := s.store.ShareTag(r.Context(), r.PathValue("name"), expiresAt)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, ShareResponse{Share: *share, URL: shareURL(r, share.Token)})
+}
+
+// readShareRequest reads when a new link expires, answering 400 when the
+// request is invalid. An empty body is a link that doesn't expire.
+func readShareRequest(w http.ResponseWriter, r *http.Request) (*time.Time, bool) {
+	var req ShareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return nil, false
+	}
+	if req.ExpiresIn == "" {
+		return nil, true
+	}
+	d, err := rules.ParseDelay(req.ExpiresIn)
+	if err != nil || d <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid expires_in (e.g. 7d, 12h)")
+		return nil, false
+	}
+	at := time.Now().Add(d)
+	return &at, true
+}
+
+// listShares returns the links shared by the user making the request
+func (s *Server) listShares(w http.ResponseWriter, r *http.Request) {
+	shares, err := s.store.ListShares(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	resp := make([]ShareResponse, len(shares))
+	for i, sh := range shares {
+		resp[i] = ShareResponse{Share: sh, URL: shareURL(r, sh.Token)}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// deleteShare revokes a link
+func (s *Server) deleteShare(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	err := s.store.DeleteShare(r.Context(), id)
+	if errors.Is(err, store.ErrShareNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted", "id": id})
+}
+
+// shareURL returns the public link of a share token on the server r was
+// sent to
+func shareURL(r *http.Request, token string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host + "/s/" + token
+}
+
+var shareTemplate = template.Must(template.New("share").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{.Title}}</title>
+<style>
+  body { max-width: 42rem; margin: 0 auto; padding: 1.5rem 1rem; font-family: Georgia, serif; line-height: 1.6;
+         color: #222; background: #fdfdfb; }
+  h1 { font-size: 1.6rem; line-height: 1.3; margin-bottom: 0.25rem; }
+  h2 { font-size: 1.25rem; margin: 2.5rem 0 0.25rem; }
+  .meta { color: #777; font-family: -apple-system, sans-serif; font-size: 0.85rem; }
+  .meta a { color: #777; }
+  .tag { display: inline-block; margin-right: 0.3rem; padding: 0 0.45rem; border-radius: 999px; background: #eee; }
+  .content { white-space: pre-wrap; overflow-wrap: break-word; }
+  footer { margin-top: 3rem; color: #aaa; font-family: -apple-system, sans-serif; font-size: 0.8rem; }
+</style>
+</head>
+<body>
+{{if .Missing}}<h1>Nothing here</h1>
+<p>This link doesn't exist or has expired.</p>
+{{else}}<h1>{{.Title}}</h1>
+{{if .Tag}}<div class="meta">{{len .Entries}} entries</div>{{end}}
+{{range .Entries}}{{if $.Tag}}<h2>{{.DisplayTitle}}</h2>{{end}}
+<div class="meta">{{.CreatedAt.Format "January 2, 2006"}}{{if .Source.URL}} · <a href="{{.Source.URL}}" rel="noreferrer">{{.Source.URL}}</a>{{end}}
+{{range .Tags}} <span class="tag">{{.Name}}</span>{{end}}</div>
+<div class="content">{{.Content}}</div>
+{{end}}{{end}}
+<footer>Shared read-only from kb</footer>
+</body>
+</html>
+`))
+
+type sharePage struct {
+	Title   string
+	Tag     string
+	Entries []domain.Entry
+	Missing bool
+}
+
+// viewShare renders a shared entry, or the entries of a shared tag, as a
+// read-only page. It needs no token: the signed link is the credential.
+func (s *Server) viewShare(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.Header().Set("X-Robots-Tag", "noindex")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	// Revoking a link must take effect at once
+	w.Header().Set("Cache-Control", "no-store")
+
+	share, err := s.store.OpenShare(ctx, r.PathValue("token"))
+	if errors.Is(err, store.ErrShareNotFound) {
+		renderShare(w, http.StatusNotFound, sharePage{Title: "Not found", Missing: true})
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	page, err := s.sharedPage(ctx, share)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(page.Entries) == 0 && page.Tag == "" {
+		renderShare(w, http.StatusNotFound, sharePage{Title: "Not found", Missing: true})
+		return
+	}
+	renderShare(w, http.StatusOK, *page)
+}
+
+// sharedPage loads what a share links to, as the user who shared it, in
+// any notebook. Entries in the trash or in locked notebooks are left out,
+// and so are scratch entries from tag pages.
+func (s *Server) sharedPage(ctx context.Context, share *domain.Share) (*sharePage, error) {
+	ctx = store.WithNotebook(store.WithUser(ctx, share.UserID), "")
+	if share.Tag != "" {
+		entries, err := s.store.GetEntriesByTag(ctx, share.Tag, true)
+		if err != nil {
+			return nil, err
+		}
+		page := &sharePage{Title: share.Tag, Tag: share.Tag}
+		for _, e := range entries {
+			if !e.Locked && e.ExpiresAt == nil {
+				page.Entries = append(page.Entries, e)
+			}
+		}
+		return page, nil
+	}
+
+	entry, err := s.store.GetEntry(ctx, share.EntryID)
+	if err != nil || entry.DeletedAt != nil || entry.Locked {
+		return &sharePage{}, nil
+	}
+	return &sharePage{Title: entry.DisplayTitle(), Entries: []domain.Entry{*entry}}, nil
+}
+
+func renderShare(w http.ResponseWriter, status int, page sharePage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	shareTemplate.Execute(w, page)
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTagSharePage(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.token("")
+	ctx := context.Background()
+	tag, err := ts.store.GetOrCreateTag(ctx, "golang", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, err := ts.store.AddEntry(ctx, "kept note")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scratch, err := ts.store.AddScratchEntry(ctx, "scratch note", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{kept.ID, scratch.ID} {
+		if err := ts.store.LinkEntryTag(ctx, id, tag.ID, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var share ShareResponse
+	if code := ts.do("POST", "/tags/golang/share", token, nil, &share); code != http.StatusCreated {
+		t.Fatalf("POST /tags/golang/share = %d, want 201", code)
+	}
+
+	// Share links need no token
+	rec := httptest.NewRecorder()
+	ts.http.ServeHTTP(rec, httptest.NewRequest("GET", "/s/"+share.Token, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /s/{token} = %d, want 200", rec.Code)
+	}
+	page := rec.Body.String()
+	if !strings.Contains(page, "kept note") {
+		t.Errorf("shared page doesn't list the tagged entry")
+	}
+	if strings.Contains(page, "scratch note") {
+		t.Errorf("shared page lists a scratch entry")
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"wrong signature", share.ID + ".AAAA"},
+		{"unsigned", share.ID},
+	}
+	for _, tt := range tests {
+		if code := ts.do("GET", "/s/"+tt.token, "", nil, nil); code != http.StatusNotFound {
+			t.Errorf("GET /s/ with a %s token = %d, want 404", tt.name, code)
+		}
+	}
+
+	if code := ts.do("DELETE", "/shares/"+share.ID, token, nil, nil); code >= 300 {
+		t.Fatalf("DELETE /shares/{id} = %d", code)
+	}
+	if code := ts.do("GET", "/s/"+share.Token, "", nil, nil); code != http.StatusNotFound {
+		t.Errorf("GET /s/ after deleting the share = %d, want 404", code)
+	}
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/journal"
+	"github.com/pbaille/kb/internal/query"
+)
+
+// Endpoints under /shortcuts are designed for Apple Shortcuts and Tasker:
+// parameters come from the query string or a form body, responses are
+// plain text, and the token may be passed as ?token= instead of a header.
+
+// ShortcutEndpoint documents one automation-friendly endpoint
+type ShortcutEndpoint struct {
+	Method      string            `json:"method"`
+	Path        string            `json:"path"`
+	Description string            `json:"description"`
+	Params      map[string]string `json:"params,omitempty"`
+	Returns     string            `json:"returns"`
+}
+
+var shortcutEndpoints = []ShortcutEndpoint{
+	{
+		Method:      "GET|POST",
+		Path:        "/shortcuts/add",
+		Description: "Capture text (URLs are stored as-is) and classify it",
+		Params:      map[string]string{"text": "content to capture"},
+		Returns:     "one line: short ID followed by assigned tags",
+	},
+	{
+		Method:      "GET",
+		Path:        "/shortcuts/search",
+		Description: "Text search over entries",
+		Params:      map[string]string{"q": "search query", "limit": "max results (default 10)"},
+		Returns:     "one entry per line: short ID and truncated content",
+	},
+	{
+		Method:      "GET",
+		Path:        "/shortcuts/suggest",
+		Description: "Least recently viewed entries, for resurfacing",
+		Params:      map[string]string{"limit": "max results (default 5)"},
+		Returns:     "one entry per line: short ID and truncated content",
+	},
+}
+
+func (s *Server) shortcutsSchema(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"auth":      "pass ?token=<token> or an Authorization: Bearer header once API tokens exist (kb token create)",
+		"endpoints": shortcutEndpoints,
+	})
+}
+
+func (s *Server) shortcutsAdd(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	text := strings.TrimSpace(r.FormValue("text"))
+	if text == "" {
+		writeText(w, http.StatusBadRequest, "text is required")
+		return
+	}
+
+	resp, err := s.ingest(ctx, journal.Capture{Content: text, Source: domain.Source{Type: domain.SourceNote}})
+	if err != nil {
+		writeText(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	names := make([]string, len(resp.Tags))
+	for i, t := range resp.Tags {
+		names[i] = t.Name
+	}
+	line := "Saved " + domain.ShortID(resp.Entry.ID, s.shortIDLength(ctx))
+	if len(names) > 0 {
+		line += ": " + strings.Join(names, ", ")
+	}
+	writeText(w, http.StatusCreated, line)
+}
+
+func (s *Server) shortcutsSearch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		writeText(w, http.StatusBadRequest, "q is required")
+		return
+	}
+
+	entries, err := s.store.SearchEntries(ctx, q, domain.ScopeActive, false)
+	if errors.Is(err, query.ErrSyntax) {
+		writeText(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeText(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.writeEntryLines(ctx, w, entries, queryLimit(r, 10))
+}
+
+func (s *Server) shortcutsSuggest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	entries, err := s.store.GetSuggestions(ctx, queryLimit(r, 5))
+	if err != nil {
+		writeText(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.writeEntryLines(ctx, w, entries, len(entries))
+}
+
+func queryLimit(r *http.Request, def int) int {
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+		return n
+	}
+	return def
+}
+
+func (s *Server) writeEntryLines(ctx context.Context, w http.ResponseWriter, entries []domain.Entry, limit int) {
+	if len(entries) == 0 {
+		writeText(w, http.StatusOK, "No entries found.")
+		return
+	}
+
+	n := s.shortIDLength(ctx)
+	var sb strings.Builder
+	for i, e := range entries {
+		if i >= limit {
+			break
+		}
+		content := strings.Join(strings.Fields(e.Content), " ")
+		if r := []rune(content); len(r) > 100 {
+			content = string(r[:97]) + "..."
+		}
+		fmt.Fprintf(&sb, "%s  %s\n", domain.ShortID(e.ID, n), content)
+	}
+	writeText(w, http.StatusOK, strings.TrimSuffix(sb.String(), "\n"))
+}
+
+func writeText(w http.ResponseWriter, status int, text string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintln(w, text)
+}
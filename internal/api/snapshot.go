@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pbaille/kb/internal/store"
+)
+
+// snapshots share a snapshot of the database between analytics requests
+// (statistics, time series, tag quality and activity), so their long
+// reads never run on the live database. A snapshot older than maxAge is
+// replaced by the next request; the old one is closed once its last
+// request is done.
+type snapshots struct {
+	store  *store.Store
+	maxAge time.Duration
+
+	// taking is held while a snapshot is taken, so only one is
+	taking  sync.Mutex
+	mu      sync.Mutex
+	current *snapshot
+}
+
+type snapshot struct {
+	store   *store.Store
+	takenAt time.Time
+	users   int
+	retired bool
+}
+
+// acquire returns a snapshot no older than maxAge, or the live store when
+// maxAge is 0 or it runs on Postgres, and the function releasing it
+func (p *snapshots) acquire(ctx context.Context) (*store.Store, func(), error) {
+	if p.maxAge <= 0 || p.store.Backend() != store.BackendSQLite {
+		return p.store, func() {}, nil
+	}
+	if snap := p.fresh(); snap != nil {
+		return snap.store, p.releaser(snap), nil
+	}
+
+	p.taking.Lock()
+	defer p.taking.Unlock()
+	if snap := p.fresh(); snap != nil {
+		return snap.store, p.releaser(snap), nil
+	}
+	taken, err := p.store.Snapshot(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	snap := &snapshot{store: taken, takenAt: time.Now(), users: 1}
+
+	p.mu.Lock()
+	if p.current != nil {
+		p.retire(p.current)
+	}
+	p.current = snap
+	p.mu.Unlock()
+	return snap.store, p.releaser(snap), nil
+}
+
+// fresh returns the current snapshot, counting a user, if it's recent
+// enough
+func (p *snapshots) fresh() *snapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.current == nil || time.Since(p.current.takenAt) >= p.maxAge {
+		return nil
+	}
+	p.current.users++
+	return p.current
+}
+
+func (p *snapshots) releaser(snap *snapshot) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			snap.users--
+			if snap.retired && snap.users == 0 {
+				snap.store.Close()
+			}
+		})
+	}
+}
+
+// retire closes a snapshot once no request uses it; p.mu is held
+func (p *snapshots) retire(snap *snapshot) {
+	snap.retired = true
+	if snap.users == 0 {
+		snap.store.Close()
+	}
+}
+
+// close retires the current snapshot
+func (p *snapshots) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.current != nil {
+		p.retire(p.current)
+		p.current = nil
+	}
+}
+
+// analytics returns the store analytics requests read, writing a 500 when
+// no snapshot could be taken
+func (s *Server) analytics(w http.ResponseWriter, r *http.Request) (*store.Store, func(), bool) {
+	st, release, err := s.snapshots.acquire(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return nil, nil, false
+	}
+	return st, release, true
+}
@@ -0,0 +1,21 @@
+package api
+
+import (
+	"context"
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// seenBefore returns the entry already saved for a URL, recording the new
+// sighting on it, or nil if the URL is new
+func (s *Server) seenBefore(ctx context.Context, rawURL, via string) (*domain.Entry, error) {
+	existing, err := s.store.FindEntryByURL(ctx, rawURL)
+	if err != nil || existing == nil {
+		return nil, err
+	}
+	o, err := s.store.AddSourceOccurrence(ctx, existing.ID, via, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	existing.SeenVia = append(existing.SeenVia, *o)
+	return existing, nil
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// getStats returns the knowledge base overview shown by kb stats; weeks
+// and top default to 8 and 5. Like the other analytics, it's read from a
+// snapshot of the database.
+func (s *Server) getStats(w http.ResponseWriter, r *http.Request) {
+	weeks, top := 8, 5
+	if v := r.URL.Query().Get("weeks"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			weeks = n
+		}
+	}
+	if v := r.URL.Query().Get("top"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			top = n
+		}
+	}
+
+	st, release, ok := s.analytics(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	stats, err := st.Stats(r.Context(), weeks, top)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// A snapshot is compacted: the size is the live database's
+	if stats.DBSize, err = s.store.Size(r.Context()); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func (s *Server) timeSeries(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	metric := r.URL.Query().Get("metric")
+	if metric == "" {
+		metric = "entries_created"
+	}
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "day"
+	}
+
+	// Default to the last 90 days
+	since, ok := parseSince(w, r, time.Now().AddDate(0, 0, -90))
+	if !ok {
+		return
+	}
+
+	st, release, ok := s.analytics(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	points, err := st.TimeSeries(ctx, metric, interval, since)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"metric":   metric,
+		"interval": interval,
+		"since":    since,
+		"points":   points,
+	})
+}
+
+// tagActivity reports entries, views and the last view per tag; views are
+// counted over the last 30 days unless since is given
+func (s *Server) tagActivity(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	since, ok := parseSince(w, r, time.Now().AddDate(0, 0, -30))
+	if !ok {
+		return
+	}
+
+	st, release, ok := s.analytics(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	activity, err := st.TagActivity(ctx, since)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"since": since, "tags": activity})
+}
+
+// parseSince reads the since query parameter, a date or RFC 3339
+// timestamp, writing a 400 when it is malformed
+func parseSince(w http.ResponseWriter, r *http.Request, def time.Time) (time.Time, bool) {
+	v := r.URL.Query().Get("since")
+	if v == "" {
+		return def, true
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		if t, err = time.Parse("2006-01-02", v); err != nil {
+			writeError(w, http.StatusBadRequest, "since must be a date (YYYY-MM-DD) or RFC 3339 timestamp")
+			return time.Time{}, false
+		}
+	}
+	return t, true
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// syncPageSize is how many changes GET /sync/changes sends by default,
+// and the most it sends at once
+const syncPageSize = 500
+
+// SyncChangesResponse is a page of changes to pull. Cursor is passed as
+// after on the next call.
+type SyncChangesResponse struct {
+	Changes []domain.SyncChange `json:"changes"`
+	Cursor  int64               `json:"cursor"`
+	More    bool                `json:"more"`
+}
+
+// SyncPushRequest is a device's changes to apply. Pulled is the cursor
+// the device last pulled up to: changes made here after it conflict.
+type SyncPushRequest struct {
+	Device  string              `json:"device"`
+	Pulled  int64               `json:"pulled"`
+	Changes []domain.SyncChange `json:"changes"`
+}
+
+// syncChanges returns the changes after a cursor, leaving out those
+// pushed by the requesting device
+func (s *Server) syncChanges(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	after, err := strconv.ParseInt(q.Get("after"), 10, 64)
+	if q.Get("after") != "" && err != nil {
+		writeError(w, http.StatusBadRequest, "after must be a sequence number")
+		return
+	}
+	limit := syncPageSize
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive number")
+			return
+		}
+		limit = min(n, syncPageSize)
+	}
+
+	changes, cursor, more, err := s.store.SyncChanges(r.Context(), after, q.Get("device"), limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if changes == nil {
+		changes = []domain.SyncChange{}
+	}
+	writeJSON(w, http.StatusOK, SyncChangesResponse{Changes: changes, Cursor: cursor, More: more})
+}
+
+// pushSyncChanges applies a device's changes
+func (s *Server) pushSyncChanges(w http.ResponseWriter, r *http.Request) {
+	var req SyncPushRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Device == "" {
+		writeError(w, http.StatusBadRequest, "device is required")
+		return
+	}
+
+	result, err := s.store.ApplySyncChanges(r.Context(), req.Device, req.Pulled, req.Changes)
+	if err != nil {
+		writeNotebookError(w, err)
+		return
+	}
+	if result.Applied == nil {
+		result.Applied = []string{}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// syncConflicts returns the latest conflicts resolved by pushes
+func (s *Server) syncConflicts(w http.ResponseWriter, r *http.Request) {
+	conflicts, err := s.store.SyncConflicts(r.Context(), 100)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if conflicts == nil {
+		conflicts = []domain.SyncConflict{}
+	}
+	writeJSON(w, http.StatusOK, conflicts)
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// archiveEntry archives an entry
+func (s *Server) archiveEntry(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := s.store.ArchiveEntry(r.Context(), id); err != nil {
+		writeTrashError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "archived", "id": id})
+}
+
+// restoreEntry brings an entry back from the trash or the archive
+func (s *Server) restoreEntry(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	from, err := s.store.RestoreEntry(r.Context(), id)
+	if err != nil {
+		writeTrashError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "restored", "id": id, "from": from})
+}
+
+// listTrash returns the entries in the trash, most recently deleted first
+func (s *Server) listTrash(w http.ResponseWriter, r *http.Request) {
+	entries, err := s.store.ListTrash(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if entries == nil {
+		entries = []domain.Entry{}
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// purgeTrash deletes for good the entries in the trash for more than
+// older_than_days days, all of them without it
+func (s *Server) purgeTrash(w http.ResponseWriter, r *http.Request) {
+	days := 0
+	if d := r.URL.Query().Get("older_than_days"); d != "" {
+		n, err := strconv.Atoi(d)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "older_than_days must be a non-negative number")
+			return
+		}
+		days = n
+	}
+	n, err := s.store.PurgeTrash(r.Context(), time.Duration(days)*24*time.Hour)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"purged": n})
+}
+
+// writeTrashError maps archive and trash errors to status codes: an entry
+// already in the requested state is a conflict
+func writeTrashError(w http.ResponseWriter, err error) {
+	if errors.Is(err, store.ErrEntryNotFound) {
+		writeError(w, http.StatusNotFound, "entry not found")
+		return
+	}
+	writeError(w, http.StatusConflict, err.Error())
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/pbaille/kb/web"
+)
+
+// uiFiles is the web UI built from web/, nil if it wasn't
+var uiFiles = web.Dist()
+
+// uiMissing explains how to get a kb that serves the web UI
+const uiMissing = "web UI not built: run go generate ./web (or npm run build in web/), then rebuild kb"
+
+// uiHandler serves the web UI under /ui/
+func uiHandler() http.Handler {
+	if uiFiles == nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, uiMissing, http.StatusNotFound)
+		})
+	}
+	return http.StripPrefix("/ui/", http.FileServerFS(uiFiles))
+}
+
+// uiIndex sends / to the web UI, whose service worker works under /ui/
+func (s *Server) uiIndex(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, "/ui/", http.StatusFound)
+}
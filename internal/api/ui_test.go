@@ -0,0 +1,30 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUIRoutes(t *testing.T) {
+	ts := newTestServer(t)
+
+	// The UI is public: its static files need no token
+	rec := httptest.NewRecorder()
+	ts.http.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/ui/" {
+		t.Fatalf("GET / = %d to %q, want a redirect to /ui/", rec.Code, rec.Header().Get("Location"))
+	}
+
+	rec = httptest.NewRecorder()
+	ts.http.ServeHTTP(rec, httptest.NewRequest("GET", "/ui/", nil))
+	if uiFiles == nil {
+		// A kb built without the UI says how to build it
+		if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "go generate ./web") {
+			t.Errorf("GET /ui/ without a build = %d %q, want 404 with how to build it", rec.Code, rec.Body.String())
+		}
+	} else if rec.Code != http.StatusOK {
+		t.Errorf("GET /ui/ = %d, want 200", rec.Code)
+	}
+}
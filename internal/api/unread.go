@@ -0,0 +1,23 @@
+package api
+
+import "net/http"
+
+// markRead takes an entry out of the reading queue
+func (s *Server) markRead(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := s.store.MarkRead(r.Context(), id); err != nil {
+		writeTrashError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "read", "id": id})
+}
+
+// markUnread puts an entry back in the reading queue
+func (s *Server) markUnread(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := s.store.MarkUnread(r.Context(), id); err != nil {
+		writeTrashError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "unread", "id": id})
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// AddUserRequest is the request body for creating a user
+type AddUserRequest struct {
+	Name  string `json:"name"`
+	Admin bool   `json:"admin,omitempty"`
+}
+
+// AddUserResponse is a new user with a write token acting as them, shown
+// only once
+type AddUserResponse struct {
+	User  *domain.User `json:"user"`
+	Token string       `json:"token"`
+}
+
+// listUsers returns every user, disabled ones included
+func (s *Server) listUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := s.store.ListUsers(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if users == nil {
+		users = []domain.User{}
+	}
+	writeJSON(w, http.StatusOK, users)
+}
+
+// addUser creates a user and their first token
+func (s *Server) addUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req AddUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	user, err := s.store.AddUser(ctx, req.Name, req.Admin)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	secret, _, err := s.store.CreateAPIToken(ctx, user.Name, domain.ScopeWrite, user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, &AddUserResponse{User: user, Token: secret})
+}
+
+// disableUser takes away a user's access; their entries are kept
+func (s *Server) disableUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name := r.PathValue("name")
+	if userID := store.UserID(ctx); userID != "" {
+		if u, err := s.store.GetUser(ctx, name); err == nil && u.ID == userID {
+			writeError(w, http.StatusBadRequest, "can't disable yourself")
+			return
+		}
+	}
+	if err := s.store.DisableUser(ctx, name); err != nil {
+		if errors.Is(err, store.ErrUserNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "disabled", "name": name})
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// WorkflowStats is a workflow with the number of entries in each state
+type WorkflowStats struct {
+	domain.Workflow
+	Counts map[string]int `json:"counts"`
+}
+
+// WorkflowStateRequest is the request body for moving an entry in a workflow
+type WorkflowStateRequest struct {
+	State string `json:"state"`
+}
+
+// listWorkflows returns every workflow with its state counts
+func (s *Server) listWorkflows(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	workflows, err := s.store.ListWorkflows(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	counts, err := s.store.WorkflowCounts(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	result := make([]WorkflowStats, len(workflows))
+	for i, wf := range workflows {
+		result[i] = WorkflowStats{Workflow: wf, Counts: make(map[string]int)}
+		for _, c := range counts {
+			if c.Workflow == wf.Name {
+				result[i].Counts[c.State] = c.Entries
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// addWorkflow defines a workflow
+func (s *Server) addWorkflow(w http.ResponseWriter, r *http.Request) {
+	var wf domain.Workflow
+	if err := json.NewDecoder(r.Body).Decode(&wf); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := wf.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// Workflows defined in a notebook are for its entries
+	if wf.Notebook == "" {
+		wf.Notebook = s.store.Notebook(r.Context())
+	}
+	if err := s.store.AddWorkflow(r.Context(), &wf); errors.Is(err, store.ErrNotebookNotFound) {
+		writeNotebookError(w, err)
+		return
+	} else if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, wf)
+}
+
+// deleteWorkflow removes a workflow; entries leave it
+func (s *Server) deleteWorkflow(w http.ResponseWriter, r *http.Request) {
+	if err := s.store.DeleteWorkflow(r.Context(), r.PathValue("name")); err != nil {
+		writeWorkflowError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted", "name": r.PathValue("name")})
+}
+
+// workflowEntries lists the entries in the state given by the state
+// query parameter, the initial state by default
+func (s *Server) workflowEntries(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	wf, err := s.store.GetWorkflow(ctx, r.PathValue("name"))
+	if err != nil {
+		writeWorkflowError(w, err)
+		return
+	}
+	state := r.URL.Query().Get("state")
+	if state == "" {
+		state = wf.Initial()
+	}
+	if !slices.Contains(wf.States, state) {
+		writeError(w, http.StatusBadRequest, "unknown state: "+state)
+		return
+	}
+
+	limit, offset := 20, 0
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if n, err := strconv.Atoi(l); err == nil && n > 0 {
+			limit = n
+		}
+	}
+	if o := r.URL.Query().Get("offset"); o != "" {
+		if n, err := strconv.Atoi(o); err == nil && n >= 0 {
+			offset = n
+		}
+	}
+
+	entries, err := s.store.ListEntriesInState(ctx, wf.Name, state, limit, offset)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"workflow": wf.Name,
+		"state":    state,
+		"entries":  entries,
+		"limit":    limit,
+		"offset":   offset,
+	})
+}
+
+// setWorkflowState moves an entry to a state of a workflow, entering the
+// workflow at its initial state. Transitions the workflow doesn't allow
+// are a conflict.
+func (s *Server) setWorkflowState(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req WorkflowStateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	id := r.PathValue("id")
+	if err := s.store.SetWorkflowState(ctx, id, r.PathValue("name"), req.State); err != nil {
+		writeWorkflowError(w, err)
+		return
+	}
+	states, err := s.store.EntryWorkflows(ctx, id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, states)
+}
+
+// leaveWorkflow takes an entry out of a workflow
+func (s *Server) leaveWorkflow(w http.ResponseWriter, r *http.Request) {
+	if err := s.store.LeaveWorkflow(r.Context(), r.PathValue("id"), r.PathValue("name")); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "left", "id": r.PathValue("id"), "workflow": r.PathValue("name")})
+}
+
+// writeWorkflowError maps workflow errors to status codes
+func writeWorkflowError(w http.ResponseWriter, err error) {
+	var transition *store.TransitionError
+	switch {
+	case errors.Is(err, store.ErrWorkflowNotFound), errors.Is(err, store.ErrEntryNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.As(err, &transition):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusBadRequest, err.Error())
+	}
+}
@@ -0,0 +1,90 @@
+// Package ask answers questions from the knowledge base: the entries
+// closest to a question by embedding are retrieved, and the LLM answers
+// from them alone, citing the ones it used.
+package ask
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pbaille/kb/internal/classifier"
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/embedding"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// DefaultSources is how many entries are retrieved to answer from
+const DefaultSources = 8
+
+// Reference is an entry retrieved to answer from
+type Reference struct {
+	ID         string  `json:"id"`
+	Title      string  `json:"title"`
+	URL        string  `json:"url,omitempty"`
+	Similarity float64 `json:"similarity"`
+	// Cited is set when the answer relies on the entry
+	Cited bool `json:"cited"`
+}
+
+// Answer is the answer to a question, with the entries it was drawn from
+type Answer struct {
+	Question string `json:"question"`
+	Text     string `json:"answer"`
+	// Citations are the IDs of the entries the answer relies on, most
+	// important first
+	Citations []string `json:"citations"`
+	// Sources are the entries retrieved, most similar first
+	Sources []Reference `json:"sources"`
+}
+
+// ErrNothingEmbedded is returned when no entry can be retrieved to answer
+// from
+var ErrNothingEmbedded = errors.New("no entries are embedded yet (kb embed computes missing embeddings)")
+
+// Ask answers a question from the k entries closest to it, embedded by
+// embSvc, with clf
+func Ask(ctx context.Context, s *store.Store, embSvc *embedding.Service, clf *classifier.Classifier, question string, k int) (*Answer, error) {
+	question = strings.TrimSpace(question)
+	if question == "" {
+		return nil, fmt.Errorf("question is required")
+	}
+	if k <= 0 {
+		k = DefaultSources
+	}
+
+	vector, err := embSvc.Embed(ctx, question)
+	if err != nil {
+		return nil, fmt.Errorf("embed question: %w", err)
+	}
+	similar, err := s.FindSimilar(ctx, vector, k, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(similar) == 0 {
+		return nil, ErrNothingEmbedded
+	}
+
+	entries := make([]domain.Entry, len(similar))
+	result := &Answer{Question: question, Sources: make([]Reference, len(similar))}
+	for i, sim := range similar {
+		entries[i] = sim.Entry
+		result.Sources[i] = Reference{ID: sim.Entry.ID, Title: sim.Entry.DisplayTitle(), URL: sim.Entry.Source.URL, Similarity: sim.Similarity}
+	}
+
+	answer, err := clf.AnswerQuestion(ctx, question, entries)
+	if err != nil {
+		return nil, err
+	}
+	result.Text = answer.Text
+	result.Citations = answer.Citations
+	if result.Citations == nil {
+		result.Citations = []string{}
+	}
+	for i := range result.Sources {
+		result.Sources[i].Cited = slices.Contains(answer.Citations, result.Sources[i].ID)
+	}
+	return result, nil
+}
@@ -0,0 +1,144 @@
+package blobs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Store keeps content-addressed files under a directory, sharded by the
+// first two hex characters of their SHA-256
+type Store struct {
+	dir string
+}
+
+// New creates a blob Store rooted at dir
+func New(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// ForDir returns the blob Store living in a database's directory (see
+// store.Store.Dir)
+func ForDir(dir string) *Store {
+	return New(filepath.Join(dir, "blobs"))
+}
+
+// Put stores content and returns its SHA-256 hex digest and size.
+// Storing identical content twice is a no-op.
+func (s *Store) Put(r io.Reader) (string, int64, error) {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return "", 0, fmt.Errorf("create blob dir: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(s.dir, "upload-*")
+	if err != nil {
+		return "", 0, fmt.Errorf("create temp blob: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("write blob: %w", err)
+	}
+
+	sum := hex.EncodeToString(h.Sum(nil))
+	path := s.Path(sum)
+	if _, err := os.Stat(path); err == nil {
+		return sum, size, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", 0, fmt.Errorf("create blob shard: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", 0, fmt.Errorf("store blob: %w", err)
+	}
+	return sum, size, nil
+}
+
+// Open opens a stored blob for reading
+func (s *Store) Open(sum string) (*os.File, error) {
+	f, err := os.Open(s.Path(sum))
+	if err != nil {
+		return nil, fmt.Errorf("open blob: %w", err)
+	}
+	return f, nil
+}
+
+// Path returns where a blob with the given digest is stored
+func (s *Store) Path(sum string) string {
+	if len(sum) < 2 {
+		return filepath.Join(s.dir, sum)
+	}
+	return filepath.Join(s.dir, sum[:2], sum)
+}
+
+// Usage returns how many blobs are stored and their total size
+func (s *Store) Usage() (int, int64, error) {
+	var files int
+	var size int64
+	err := filepath.WalkDir(s.dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == s.dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files++
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("measure blobs: %w", err)
+	}
+	return files, size, nil
+}
+
+// DetectMIME sniffs the content type, refining generic results with the
+// file extension (e.g. plain text named .md becomes text/markdown)
+func DetectMIME(filename string, head []byte) string {
+	sniffed := http.DetectContentType(head)
+	byExt := mime.TypeByExtension(strings.ToLower(filepath.Ext(filename)))
+	if byExt == "" {
+		return sniffed
+	}
+
+	switch {
+	case sniffed == "application/octet-stream":
+		return byExt
+	case strings.HasPrefix(sniffed, "text/plain") && IsText(byExt):
+		return byExt
+	}
+	return sniffed
+}
+
+// IsText reports whether a MIME type holds readable text
+func IsText(mimeType string) bool {
+	base, _, _ := strings.Cut(mimeType, ";")
+	base = strings.TrimSpace(base)
+	return strings.HasPrefix(base, "text/") ||
+		base == "application/json" ||
+		base == "application/xml" ||
+		base == "application/x-yaml"
+}
+
+// IsImage reports whether a MIME type is an image
+func IsImage(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "image/")
+}
@@ -0,0 +1,218 @@
+package bookmarks
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// Bookmark is a link saved in a read-it-later service
+type Bookmark struct {
+	URL   string
+	Title string
+	// Excerpt is the service's summary of the page
+	Excerpt string
+	// Note is what the user wrote about it
+	Note       string
+	Highlights []string
+	// Tags are lowercased, nested ones as a/b
+	Tags    []string
+	SavedAt time.Time
+}
+
+// ParsePocket reads a Pocket export: the HTML file of the old exporter, or
+// the CSV one (title, url, time_added, tags, status)
+func ParsePocket(r io.Reader) ([]Bookmark, error) {
+	br := bufio.NewReader(r)
+	start, _ := br.Peek(512)
+	if bytes.HasPrefix(bytes.TrimSpace(start), []byte("<")) {
+		return parsePocketHTML(br)
+	}
+
+	records, err := readCSV(br)
+	if err != nil {
+		return nil, err
+	}
+	var out []Bookmark
+	for _, rec := range records {
+		b := Bookmark{URL: rec["url"], Title: rec["title"], Tags: normalizeTags(strings.Split(rec["tags"], "|"))}
+		b.SavedAt = unixTime(rec["time_added"])
+		if b.URL != "" {
+			out = append(out, b)
+		}
+	}
+	return out, nil
+}
+
+// parsePocketHTML reads the links of Pocket's HTML export, each an
+// <a href time_added tags> element
+func parsePocketHTML(r io.Reader) ([]Bookmark, error) {
+	var out []Bookmark
+	z := html.NewTokenizer(r)
+	var current *Bookmark
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return out, nil
+			}
+			return nil, fmt.Errorf("parse Pocket export: %w", z.Err())
+		case html.StartTagToken:
+			t := z.Token()
+			if t.Data != "a" {
+				continue
+			}
+			b := Bookmark{}
+			for _, a := range t.Attr {
+				switch a.Key {
+				case "href":
+					b.URL = a.Val
+				case "time_added":
+					b.SavedAt = unixTime(a.Val)
+				case "tags":
+					b.Tags = normalizeTags(strings.Split(a.Val, ","))
+				}
+			}
+			if b.URL != "" {
+				out = append(out, b)
+				current = &out[len(out)-1]
+			}
+		case html.TextToken:
+			if current != nil {
+				current.Title += string(z.Text())
+			}
+		case html.EndTagToken:
+			if current != nil {
+				current.Title = strings.TrimSpace(current.Title)
+				current = nil
+			}
+		}
+	}
+}
+
+// instapaperFolders are Instapaper's built-in folders, which aren't tags
+var instapaperFolders = map[string]bool{"unread": true, "archive": true, "starred": true}
+
+// ParseInstapaper reads an Instapaper CSV export (URL, Title, Selection,
+// Folder, Timestamp, and Tags in recent ones). Folders the user made
+// become tags.
+func ParseInstapaper(r io.Reader) ([]Bookmark, error) {
+	records, err := readCSV(r)
+	if err != nil {
+		return nil, err
+	}
+	var out []Bookmark
+	for _, rec := range records {
+		b := Bookmark{URL: rec["url"], Title: rec["title"], SavedAt: unixTime(rec["timestamp"])}
+		if sel := strings.TrimSpace(rec["selection"]); sel != "" {
+			b.Highlights = []string{sel}
+		}
+		// Tags are written as a JSON list: ["a","b"]
+		tags := strings.FieldsFunc(rec["tags"], func(r rune) bool { return strings.ContainsRune(`[]",`, r) })
+		if folder := strings.ToLower(strings.TrimSpace(rec["folder"])); folder != "" && !instapaperFolders[folder] {
+			tags = append(tags, folder)
+		}
+		b.Tags = normalizeTags(tags)
+		if b.URL != "" {
+			out = append(out, b)
+		}
+	}
+	return out, nil
+}
+
+// ParseRaindrop reads a Raindrop.io CSV export (id, title, note, excerpt,
+// url, folder, tags, created, highlights, ...). The collection a bookmark
+// is in becomes a tag, except Unsorted.
+func ParseRaindrop(r io.Reader) ([]Bookmark, error) {
+	records, err := readCSV(r)
+	if err != nil {
+		return nil, err
+	}
+	var out []Bookmark
+	for _, rec := range records {
+		b := Bookmark{URL: rec["url"], Title: rec["title"], Excerpt: rec["excerpt"], Note: rec["note"]}
+		if t, err := time.Parse(time.RFC3339, rec["created"]); err == nil {
+			b.SavedAt = t
+		}
+		for _, h := range strings.Split(rec["highlights"], "\n\n") {
+			if h = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(h), "Highlight:")); h != "" {
+				b.Highlights = append(b.Highlights, h)
+			}
+		}
+		tags := strings.Split(rec["tags"], ",")
+		if folder := strings.TrimSpace(rec["folder"]); folder != "" && !strings.EqualFold(folder, "unsorted") {
+			tags = append(tags, folder)
+		}
+		b.Tags = normalizeTags(tags)
+		if b.URL != "" {
+			out = append(out, b)
+		}
+	}
+	return out, nil
+}
+
+// readCSV reads a CSV file with a header row into records keyed by the
+// lowercased column names
+func readCSV(r io.Reader) ([]map[string]string, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("read CSV: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	header := rows[0]
+	for i, name := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+	}
+	records := make([]map[string]string, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		rec := make(map[string]string, len(header))
+		for i, v := range row {
+			if i < len(header) {
+				rec[header[i]] = strings.TrimSpace(v)
+			}
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// unixTime parses seconds since the epoch, the zero time if invalid
+func unixTime(s string) time.Time {
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || n <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(n, 0)
+}
+
+// normalizeTags lowercases tags, turning spaces into dashes, and removes
+// empty ones and duplicates, keeping their order
+func normalizeTags(tags []string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		var segments []string
+		for _, segment := range strings.Split(strings.ToLower(tag), "/") {
+			if segment = strings.Join(strings.Fields(segment), "-"); segment != "" {
+				segments = append(segments, segment)
+			}
+		}
+		tag = strings.Join(segments, "/")
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			out = append(out, tag)
+		}
+	}
+	return out
+}
@@ -0,0 +1,250 @@
+package bookmarks
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// rootFolders are the folders browsers keep bookmarks in, which aren't
+// tags
+var rootFolders = map[string]bool{
+	"bookmarks bar": true, "bookmarks toolbar": true, "bookmarks menu": true,
+	"other bookmarks": true, "mobile bookmarks": true, "favorites bar": true,
+	"bookmarks": true,
+}
+
+// ParseBrowser reads bookmarks exported from a browser: Chrome's Bookmarks
+// JSON file, a Firefox JSON backup, or the HTML file both export. The
+// folders a bookmark is in become a nested tag.
+func ParseBrowser(r io.Reader) ([]Bookmark, error) {
+	br := bufio.NewReader(r)
+	start, _ := br.Peek(512)
+	if !bytes.HasPrefix(bytes.TrimSpace(start), []byte("{")) {
+		return parseNetscape(br)
+	}
+
+	var doc struct {
+		// Chrome
+		Roots map[string]json.RawMessage `json:"roots"`
+		// Firefox
+		Children []json.RawMessage `json:"children"`
+	}
+	data, err := io.ReadAll(br)
+	if err != nil {
+		return nil, fmt.Errorf("read bookmarks: %w", err)
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse bookmarks: %w", err)
+	}
+
+	var out []Bookmark
+	if doc.Roots != nil {
+		for _, key := range []string{"bookmark_bar", "other", "synced"} {
+			if raw, ok := doc.Roots[key]; ok {
+				if err := walkChrome(raw, nil, &out); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return out, nil
+	}
+	for _, raw := range doc.Children {
+		if err := walkFirefox(raw, nil, &out); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// chromeNode is a folder or bookmark of Chrome's Bookmarks file, dated in
+// microseconds since 1601
+type chromeNode struct {
+	Type      string            `json:"type"`
+	Name      string            `json:"name"`
+	URL       string            `json:"url"`
+	DateAdded string            `json:"date_added"`
+	Children  []json.RawMessage `json:"children"`
+}
+
+// chromeEpoch is the Unix epoch in microseconds since 1601
+const chromeEpoch = 11644473600000000
+
+func walkChrome(raw json.RawMessage, folders []string, out *[]Bookmark) error {
+	var n chromeNode
+	if err := json.Unmarshal(raw, &n); err != nil {
+		return fmt.Errorf("parse bookmarks: %w", err)
+	}
+	switch n.Type {
+	case "url":
+		b := Bookmark{URL: n.URL, Title: n.Name, Tags: folderTag(folders)}
+		if us, err := strconv.ParseInt(n.DateAdded, 10, 64); err == nil && us > 0 {
+			b.SavedAt = time.UnixMicro(us - chromeEpoch)
+		}
+		if isWebURL(b.URL) {
+			*out = append(*out, b)
+		}
+	case "folder":
+		for _, child := range n.Children {
+			if err := walkChrome(child, append(folders, n.Name), out); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// firefoxNode is a container or place of a Firefox JSON backup, dated in
+// microseconds since the epoch
+type firefoxNode struct {
+	Type      string            `json:"type"`
+	Title     string            `json:"title"`
+	URI       string            `json:"uri"`
+	Tags      string            `json:"tags"`
+	DateAdded int64             `json:"dateAdded"`
+	Root      string            `json:"root"`
+	Children  []json.RawMessage `json:"children"`
+}
+
+func walkFirefox(raw json.RawMessage, folders []string, out *[]Bookmark) error {
+	var n firefoxNode
+	if err := json.Unmarshal(raw, &n); err != nil {
+		return fmt.Errorf("parse bookmarks: %w", err)
+	}
+	switch n.Type {
+	case "text/x-moz-place":
+		b := Bookmark{URL: n.URI, Title: n.Title, Tags: normalizeTags(append(strings.Split(n.Tags, ","), folderTag(folders)...))}
+		if n.DateAdded > 0 {
+			b.SavedAt = time.UnixMicro(n.DateAdded)
+		}
+		if isWebURL(b.URL) {
+			*out = append(*out, b)
+		}
+	case "text/x-moz-place-container":
+		// The menu, toolbar and other roots hold bookmarks, not topics;
+		// tags live in a root of their own
+		if n.Root == "tagsFolder" {
+			return nil
+		}
+		if n.Root == "" {
+			folders = append(folders, n.Title)
+		}
+		for _, child := range n.Children {
+			if err := walkFirefox(child, folders, out); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseNetscape reads the HTML bookmarks file browsers export: links as
+// <A HREF ADD_DATE TAGS> in <DL> lists, each folder an <H3> followed by
+// the list of its content
+func parseNetscape(r io.Reader) ([]Bookmark, error) {
+	var out []Bookmark
+	var folders []string
+	var heading, pending *string
+	var current *Bookmark
+	z := html.NewTokenizer(r)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return out, nil
+			}
+			return nil, fmt.Errorf("parse bookmarks: %w", z.Err())
+		case html.StartTagToken:
+			t := z.Token()
+			switch t.Data {
+			case "h3":
+				name := ""
+				heading = &name
+				for _, a := range t.Attr {
+					// The toolbar and unfiled folders hold bookmarks, not topics
+					if a.Key == "personal_toolbar_folder" || a.Key == "unfiled_bookmarks_folder" {
+						heading = nil
+					}
+				}
+			case "dl":
+				name := ""
+				if pending != nil && !rootFolders[strings.ToLower(*pending)] {
+					name = *pending
+				}
+				folders = append(folders, name)
+				pending = nil
+			case "a":
+				b := Bookmark{Tags: folderTag(folders)}
+				for _, a := range t.Attr {
+					switch a.Key {
+					case "href":
+						b.URL = a.Val
+					case "add_date":
+						b.SavedAt = unixTime(a.Val)
+					case "tags":
+						b.Tags = normalizeTags(append(strings.Split(a.Val, ","), b.Tags...))
+					}
+				}
+				if isWebURL(b.URL) {
+					out = append(out, b)
+					current = &out[len(out)-1]
+				}
+			}
+		case html.TextToken:
+			if heading != nil {
+				*heading += string(z.Text())
+			} else if current != nil {
+				current.Title += string(z.Text())
+			}
+		case html.EndTagToken:
+			switch z.Token().Data {
+			case "h3":
+				if heading != nil {
+					name := strings.TrimSpace(*heading)
+					pending = &name
+				} else {
+					empty := ""
+					pending = &empty
+				}
+				heading = nil
+			case "dl":
+				if len(folders) > 0 {
+					folders = folders[:len(folders)-1]
+				}
+			case "a":
+				if current != nil {
+					current.Title = strings.TrimSpace(current.Title)
+					current = nil
+				}
+			}
+		}
+	}
+}
+
+// folderTag returns the tag for a folder path, leaving out browser root
+// folders and unnamed ones; none for a bookmark outside folders
+func folderTag(folders []string) []string {
+	var names []string
+	for _, f := range folders {
+		if f = strings.TrimSpace(f); f != "" && !rootFolders[strings.ToLower(f)] {
+			names = append(names, strings.ReplaceAll(f, "/", "-"))
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return normalizeTags([]string{strings.Join(names, "/")})
+}
+
+// isWebURL reports whether a bookmark points to a web page, rather than
+// a bookmarklet, a browser page or a saved search
+func isWebURL(u string) bool {
+	return strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://")
+}
@@ -0,0 +1,112 @@
+package bookmarks
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// HistoryOptions selects the pages of a browser history worth importing
+type HistoryOptions struct {
+	// MinVisits leaves out pages visited fewer times
+	MinVisits int
+	// Since leaves out pages not visited since, when set
+	Since time.Time
+}
+
+// ParseHistory reads the pages of a browser history: Chrome's History
+// file or Firefox's places.sqlite, both SQLite databases. Each page is
+// dated from its first visit. Visits still in the database's write-ahead
+// log, while the browser runs, are missed.
+func ParseHistory(r io.Reader, opts HistoryOptions) ([]Bookmark, error) {
+	// The history is read from a copy: browsers keep theirs locked
+	f, err := os.CreateTemp("", "kb-history-*.sqlite")
+	if err != nil {
+		return nil, fmt.Errorf("copy history: %w", err)
+	}
+	defer os.Remove(f.Name())
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("copy history: %w", err)
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+f.Name()+"?mode=ro")
+	if err != nil {
+		return nil, fmt.Errorf("open history: %w", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	var tables int
+	if err := db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name IN ('moz_places', 'moz_historyvisits')",
+	).Scan(&tables); err != nil {
+		return nil, fmt.Errorf("read history: %w (not a Chrome or Firefox history file?)", err)
+	}
+	if tables == 2 {
+		return readHistory(ctx, db, firefoxHistory, 0, opts)
+	}
+	return readHistory(ctx, db, chromeHistory, chromeEpoch, opts)
+}
+
+// Queries listing the pages of a history with their title and first
+// visit, in microseconds from the browser's epoch, for those visited at
+// least (?) times and last since (?), oldest first
+const (
+	chromeHistory = `
+		SELECT u.url, COALESCE(u.title, ''), COALESCE(MIN(v.visit_time), u.last_visit_time)
+		FROM urls u
+		LEFT JOIN visits v ON v.url = u.id
+		WHERE u.hidden = 0 AND u.visit_count >= ? AND u.last_visit_time >= ?
+		GROUP BY u.id
+		ORDER BY 3`
+	firefoxHistory = `
+		SELECT p.url, COALESCE(p.title, ''), COALESCE(MIN(v.visit_date), p.last_visit_date)
+		FROM moz_places p
+		LEFT JOIN moz_historyvisits v ON v.place_id = p.id
+		WHERE p.hidden = 0 AND p.visit_count >= ? AND p.last_visit_date >= ?
+		GROUP BY p.id
+		ORDER BY 3`
+)
+
+// readHistory runs a history query, whose times count microseconds since
+// an epoch, epoch microseconds before the Unix one
+func readHistory(ctx context.Context, db *sql.DB, query string, epoch int64, opts HistoryOptions) ([]Bookmark, error) {
+	var since int64
+	if !opts.Since.IsZero() {
+		since = opts.Since.UnixMicro() + epoch
+	}
+	rows, err := db.QueryContext(ctx, query, max(opts.MinVisits, 1), since)
+	if err != nil {
+		return nil, fmt.Errorf("read history: %w (not a Chrome or Firefox history file?)", err)
+	}
+	defer rows.Close()
+
+	var out []Bookmark
+	for rows.Next() {
+		var b Bookmark
+		var visited int64
+		if err := rows.Scan(&b.URL, &b.Title, &visited); err != nil {
+			return nil, fmt.Errorf("read history: %w", err)
+		}
+		if !isWebURL(b.URL) {
+			continue
+		}
+		if visited > 0 {
+			b.SavedAt = time.UnixMicro(visited - epoch)
+		}
+		out = append(out, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read history: %w", err)
+	}
+	return out, nil
+}
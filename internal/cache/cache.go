@@ -0,0 +1,82 @@
+// Package cache reuses the results of classification and embedding calls
+// for content already processed. Results are keyed by model and by a hash
+// of the content with whitespace collapsed, so re-adding identical or
+// reformatted text doesn't call the APIs again, and of whatever else the
+// result depends on, like the tags a classification chose from.
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// Result kinds
+const (
+	Classification = "classification"
+	Embedding      = "embedding"
+)
+
+// Store persists cached results
+type Store interface {
+	CacheGet(ctx context.Context, kind, model, hash string) ([]byte, bool, error)
+	CachePut(ctx context.Context, kind, model, hash string, value []byte) error
+}
+
+var store Store
+
+// SetStore sets where results are cached (nil disables caching)
+func SetStore(s Store) {
+	store = s
+}
+
+type refreshKey struct{}
+
+// Refresh returns a context in which cached results are ignored, though
+// fresh ones are still stored; for deliberate reprocessing
+func Refresh(ctx context.Context) context.Context {
+	return context.WithValue(ctx, refreshKey{}, true)
+}
+
+// Hash identifies content regardless of whitespace, along with what else
+// a result for it depends on, in any order
+func Hash(content string, dependsOn ...string) string {
+	h := sha256.New()
+	h.Write([]byte(strings.Join(strings.Fields(content), " ")))
+	sorted := append([]string(nil), dependsOn...)
+	sort.Strings(sorted)
+	for _, d := range sorted {
+		h.Write([]byte{0})
+		h.Write([]byte(d))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Get decodes the cached result of hash (see Hash) into v, reporting
+// whether there was one. Failures count as misses.
+func Get(ctx context.Context, kind, model, hash string, v interface{}) bool {
+	if store == nil || ctx.Value(refreshKey{}) != nil {
+		return false
+	}
+	data, ok, err := store.CacheGet(ctx, kind, model, hash)
+	if err != nil || !ok {
+		return false
+	}
+	return json.Unmarshal(data, v) == nil
+}
+
+// Put caches a result under hash (see Hash); failures are ignored,
+// caching being best effort
+func Put(ctx context.Context, kind, model, hash string, v interface{}) {
+	if store == nil {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	store.CachePut(ctx, kind, model, hash, data)
+}
@@ -2,16 +2,28 @@ package classifier
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"sort"
 	"strings"
+	"time"
+
+	"github.com/pbaille/kb/internal/cache"
+	"github.com/pbaille/kb/internal/metrics"
+	"github.com/pbaille/kb/internal/usage"
 )
 
 const anthropicAPI = "https://api.anthropic.com/v1/messages"
 
+var classifyDuration = metrics.NewHistogram(
+	"kb_classification_duration_seconds", "Time to classify an entry, API call and parsing included",
+	metrics.DefaultBuckets, "outcome",
+)
+
 // TagSuggestion represents a suggested tag with optional parent
 type TagSuggestion struct {
 	Name       string  `json:"name"`
@@ -22,6 +34,8 @@ type TagSuggestion struct {
 // ClassifyResult holds the classification output
 type ClassifyResult struct {
 	Tags []TagSuggestion `json:"tags"`
+	// Title is a short title for the content
+	Title string `json:"title,omitempty"`
 }
 
 // Classifier handles content classification via Anthropic API
@@ -43,19 +57,93 @@ func New() (*Classifier, error) {
 	}, nil
 }
 
-// Classify analyzes content and returns tag suggestions
-func (c *Classifier) Classify(content string, existingTags []string) (*ClassifyResult, error) {
-	prompt := buildPrompt(content, existingTags)
+// Classify analyzes content and returns tag suggestions and a title. Content
+// classified before against the same tags gets the cached suggestions.
+func (c *Classifier) Classify(ctx context.Context, content string, existingTags []string) (result *ClassifyResult, err error) {
+	hash := cache.Hash(content, existingTags...)
+	var cached ClassifyResult
+	if cache.Get(ctx, cache.Classification, c.model, hash, &cached) {
+		return &cached, nil
+	}
+
+	defer func(start time.Time) { classifyDuration.Since(start, metrics.Outcome(err)) }(time.Now())
 
-	resp, err := c.callAPI(prompt)
+	prompt := buildPrompt(content, existingTags, false)
+
+	resp, err := c.callAPI(ctx, prompt)
 	if err != nil {
 		return nil, fmt.Errorf("api call: %w", err)
 	}
 
-	return parseResponse(resp)
+	result, err = parseResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	for i, t := range result.Tags {
+		result.Tags[i].Name = promptTagName(t.Name)
+		result.Tags[i].Parent = promptTagName(t.Parent)
+	}
+	cache.Put(ctx, cache.Classification, c.model, hash, result)
+	return result, nil
 }
 
-func buildPrompt(content string, existingTags []string) string {
+// promptTagName drops the aliases and the description of a tag copied
+// from the prompt along with its name
+func promptTagName(name string) string {
+	name, _, _ = strings.Cut(name, " (")
+	name, _, _ = strings.Cut(name, ": ")
+	return name
+}
+
+// ClassifyStrict is like Classify but only allows tags from the given taxonomy
+func (c *Classifier) ClassifyStrict(ctx context.Context, content string, taxonomy []TagSuggestion) (result *ClassifyResult, err error) {
+	defer func(start time.Time) { classifyDuration.Since(start, metrics.Outcome(err)) }(time.Now())
+
+	names := make([]string, len(taxonomy))
+	allowed := make(map[string]TagSuggestion, len(taxonomy))
+	for i, t := range taxonomy {
+		names[i] = t.Name
+		allowed[t.Name] = t
+	}
+
+	resp, err := c.callAPI(ctx, buildPrompt(content, names, true))
+	if err != nil {
+		return nil, fmt.Errorf("api call: %w", err)
+	}
+
+	result, err = parseResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	// Drop anything outside the taxonomy and use its parents
+	var tags []TagSuggestion
+	for _, t := range result.Tags {
+		if tax, ok := allowed[t.Name]; ok {
+			t.Parent = tax.Parent
+			tags = append(tags, t)
+		}
+	}
+	result.Tags = tags
+	return result, nil
+}
+
+// ProposeTaxonomy asks for a consolidated tag set given the current tags
+// (with usage counts) and a sample of entry contents
+func (c *Classifier) ProposeTaxonomy(ctx context.Context, tagCounts map[string]int, samples []string) ([]TagSuggestion, error) {
+	resp, err := c.callAPI(ctx, buildTaxonomyPrompt(tagCounts, samples))
+	if err != nil {
+		return nil, fmt.Errorf("api call: %w", err)
+	}
+
+	result, err := parseResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	return result.Tags, nil
+}
+
+func buildPrompt(content string, existingTags []string, strict bool) string {
 	var sb strings.Builder
 
 	sb.WriteString("Classify this content and suggest tags. Return JSON only.\n\n")
@@ -64,7 +152,11 @@ func buildPrompt(content string, existingTags []string) string {
 	sb.WriteString("\n\n")
 
 	if len(existingTags) > 0 {
-		sb.WriteString("Existing tags in the system (prefer reusing these when appropriate):\n")
+		if strict {
+			sb.WriteString("Allowed tags (use ONLY these, do not invent new ones):\n")
+		} else {
+			sb.WriteString("Existing tags in the system (prefer reusing these when appropriate; the aliases in parentheses are other names of a tag, and what follows a colon says what it's for):\n")
+		}
 		for _, tag := range existingTags {
 			sb.WriteString("- ")
 			sb.WriteString(tag)
@@ -75,17 +167,20 @@ func buildPrompt(content string, existingTags []string) string {
 
 	sb.WriteString(`Return a JSON object with this structure:
 {
+  "title": "A short title",
   "tags": [
     {"name": "tag-name", "parent": "parent-tag-or-empty", "confidence": 0.9}
   ]
 }
 
 Rules:
+- Give a title of 3-8 words saying what the content is about, in its language, without quotes or a final period
 - Use lowercase, hyphenated tag names (e.g., "machine-learning" not "Machine Learning")
 - Suggest 2-5 relevant tags
 - Use "parent" to build hierarchy (e.g., {"name": "golang", "parent": "programming"})
 - Confidence is 0.0-1.0 based on how certain the classification is
 - Reuse existing tags when they fit; create new ones when needed
+- Never use an alias as a tag: use the name of the tag it belongs to
 - Keep tags general enough to be reusable across entries
 
 Return ONLY the JSON, no other text.`)
@@ -93,15 +188,62 @@ Return ONLY the JSON, no other text.`)
 	return sb.String()
 }
 
+func buildTaxonomyPrompt(tagCounts map[string]int, samples []string) string {
+	var sb strings.Builder
+
+	sb.WriteString("Design a clean, consolidated tag taxonomy for a personal knowledge base. Return JSON only.\n\n")
+
+	if len(tagCounts) > 0 {
+		names := make([]string, 0, len(tagCounts))
+		for name := range tagCounts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		sb.WriteString("Current tags (with number of entries), which have grown messy:\n")
+		for _, name := range names {
+			fmt.Fprintf(&sb, "- %s (%d)\n", name, tagCounts[name])
+		}
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("Sample entries:\n")
+	for _, sample := range samples {
+		sb.WriteString("---\n")
+		sb.WriteString(sample)
+		sb.WriteString("\n")
+	}
+	sb.WriteString("---\n\n")
+
+	sb.WriteString(`Return a JSON object with this structure:
+{
+  "tags": [
+    {"name": "tag-name", "parent": "parent-tag-or-empty", "confidence": 1.0}
+  ]
+}
+
+Rules:
+- Use lowercase, hyphenated tag names
+- Merge synonyms and near-duplicates into one canonical tag
+- Build a shallow hierarchy with "parent"; every parent must itself be listed as a tag
+- Drop tags that are too specific to be reused
+- Aim for a taxonomy that covers the sample entries with as few tags as practical
+
+Return ONLY the JSON, no other text.`)
+
+	return sb.String()
+}
+
 type apiRequest struct {
 	Model     string       `json:"model"`
 	MaxTokens int          `json:"max_tokens"`
 	Messages  []apiMessage `json:"messages"`
 }
 
+// apiMessage content is either a string or a list of content blocks
 type apiMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"`
 }
 
 type apiResponse struct {
@@ -109,18 +251,24 @@ type apiResponse struct {
 		Type string `json:"type"`
 		Text string `json:"text"`
 	} `json:"content"`
+	Usage struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
 	Error *struct {
 		Message string `json:"message"`
 	} `json:"error,omitempty"`
 }
 
-func (c *Classifier) callAPI(prompt string) (string, error) {
+func (c *Classifier) callAPI(ctx context.Context, prompt string) (string, error) {
+	return c.send(ctx, apiMessage{Role: "user", Content: prompt}, 1024)
+}
+
+func (c *Classifier) send(ctx context.Context, msg apiMessage, maxTokens int) (string, error) {
 	reqBody := apiRequest{
 		Model:     c.model,
-		MaxTokens: 1024,
-		Messages: []apiMessage{
-			{Role: "user", Content: prompt},
-		},
+		MaxTokens: maxTokens,
+		Messages:  []apiMessage{msg},
 	}
 
 	jsonBody, err := json.Marshal(reqBody)
@@ -128,7 +276,7 @@ func (c *Classifier) callAPI(prompt string) (string, error) {
 		return "", fmt.Errorf("marshal request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", anthropicAPI, bytes.NewReader(jsonBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", anthropicAPI, bytes.NewReader(jsonBody))
 	if err != nil {
 		return "", fmt.Errorf("create request: %w", err)
 	}
@@ -161,6 +309,13 @@ func (c *Classifier) callAPI(prompt string) (string, error) {
 		return "", fmt.Errorf("api error: %s", apiResp.Error.Message)
 	}
 
+	usage.Record(usage.Event{
+		Service:      "anthropic",
+		Model:        c.model,
+		InputTokens:  apiResp.Usage.InputTokens,
+		OutputTokens: apiResp.Usage.OutputTokens,
+	})
+
 	if len(apiResp.Content) == 0 {
 		return "", fmt.Errorf("empty response")
 	}
@@ -169,12 +324,7 @@ func (c *Classifier) callAPI(prompt string) (string, error) {
 }
 
 func parseResponse(resp string) (*ClassifyResult, error) {
-	// Clean up response - remove markdown code blocks if present
-	resp = strings.TrimSpace(resp)
-	resp = strings.TrimPrefix(resp, "```json")
-	resp = strings.TrimPrefix(resp, "```")
-	resp = strings.TrimSuffix(resp, "```")
-	resp = strings.TrimSpace(resp)
+	resp = trimFences(resp)
 
 	var result ClassifyResult
 	if err := json.Unmarshal([]byte(resp), &result); err != nil {
@@ -183,3 +333,12 @@ func parseResponse(resp string) (*ClassifyResult, error) {
 
 	return &result, nil
 }
+
+// trimFences removes the markdown code block a response may be wrapped in
+func trimFences(resp string) string {
+	resp = strings.TrimSpace(resp)
+	resp = strings.TrimPrefix(resp, "```json")
+	resp = strings.TrimPrefix(resp, "```")
+	resp = strings.TrimSuffix(resp, "```")
+	return strings.TrimSpace(resp)
+}
@@ -0,0 +1,91 @@
+package classifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// maxSourceChars bounds how much of each source entry is sent
+const maxSourceChars = 4000
+
+// Answer is an answer to a question drawn from knowledge base entries
+type Answer struct {
+	Text string `json:"answer"`
+	// Citations are the IDs of the entries the answer relies on
+	Citations []string `json:"citations"`
+}
+
+// AnswerQuestion answers a question from the given entries only, citing
+// them. An answer the sources don't support says so rather than guessing.
+func (c *Classifier) AnswerQuestion(ctx context.Context, question string, sources []domain.Entry) (*Answer, error) {
+	// Sources are labeled with short IDs, which the answer cites inline
+	labels := make(map[string]string, len(sources))
+	for _, e := range sources {
+		labels[domain.ShortID(e.ID, 8)] = e.ID
+	}
+
+	resp, err := c.send(ctx, apiMessage{Role: "user", Content: buildAnswerPrompt(question, sources)}, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("api call: %w", err)
+	}
+
+	resp = trimFences(resp)
+	var answer Answer
+	if err := json.Unmarshal([]byte(resp), &answer); err != nil {
+		return nil, fmt.Errorf("parse json: %w (response: %s)", err, resp)
+	}
+
+	// Only keep citations of the entries we gave, by full ID
+	var cited []string
+	for _, label := range answer.Citations {
+		if id, ok := labels[label]; ok && !slices.Contains(cited, id) {
+			cited = append(cited, id)
+		}
+	}
+	answer.Citations = cited
+	return &answer, nil
+}
+
+func buildAnswerPrompt(question string, sources []domain.Entry) string {
+	var sb strings.Builder
+
+	sb.WriteString("Answer a question using only entries from a personal knowledge base. Return JSON only.\n\n")
+	fmt.Fprintf(&sb, "Question: %s\n\n", question)
+
+	sb.WriteString("Entries, most relevant first:\n")
+	for _, e := range sources {
+		text := e.Content
+		if r := []rune(text); len(r) > maxSourceChars {
+			text = string(r[:maxSourceChars]) + "..."
+		}
+		fmt.Fprintf(&sb, "--- [%s] %s\n", domain.ShortID(e.ID, 8), e.DisplayTitle())
+		if e.Source.URL != "" {
+			fmt.Fprintf(&sb, "URL: %s\n", e.Source.URL)
+		}
+		sb.WriteString(text)
+		sb.WriteString("\n")
+	}
+	sb.WriteString("---\n\n")
+
+	sb.WriteString(`Return a JSON object with this structure:
+{
+  "answer": "the answer, citing entries inline like [3f2a1b4c]",
+  "citations": ["3f2a1b4c"]
+}
+
+Rules:
+- Use only what the entries say; don't add outside knowledge
+- Cite every claim with the bracketed id of the entry it comes from, using the exact ids given
+- List in "citations" every id the answer cites, most important first
+- If the entries don't answer the question, say so briefly and leave "citations" empty
+- Write in the same language as the question; plain text, short paragraphs
+
+Return ONLY the JSON, no other text.`)
+
+	return sb.String()
+}
@@ -0,0 +1,25 @@
+package classifier
+
+// MinConfidence is the calibrated confidence below which a suggested tag
+// isn't applied
+const MinConfidence = 0.3
+
+// Calibrate scales suggestion confidences by each tag's measured precision
+// and drops suggestions that fall below MinConfidence. Tags without a
+// factor are left unchanged.
+func Calibrate(tags []TagSuggestion, factors map[string]float64) []TagSuggestion {
+	if len(factors) == 0 {
+		return tags
+	}
+
+	var kept []TagSuggestion
+	for _, t := range tags {
+		if f, ok := factors[t.Name]; ok {
+			t.Confidence *= f
+		}
+		if t.Confidence >= MinConfidence {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
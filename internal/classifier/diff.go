@@ -0,0 +1,36 @@
+package classifier
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ExplainDifference summarizes what one entry says that the other doesn't,
+// to help decide whether near-duplicates should be merged
+func (c *Classifier) ExplainDifference(ctx context.Context, a, b string) (string, error) {
+	resp, err := c.send(ctx, apiMessage{Role: "user", Content: buildDifferencePrompt(a, b)}, 1024)
+	if err != nil {
+		return "", fmt.Errorf("api call: %w", err)
+	}
+	return strings.TrimSpace(resp), nil
+}
+
+func buildDifferencePrompt(a, b string) string {
+	var sb strings.Builder
+
+	sb.WriteString("Two entries in a personal knowledge base look like near-duplicates. Explain what is different between them.\n\n")
+	sb.WriteString("Entry A:\n---\n")
+	sb.WriteString(a)
+	sb.WriteString("\n---\n\nEntry B:\n---\n")
+	sb.WriteString(b)
+	sb.WriteString("\n---\n\n")
+
+	sb.WriteString(`Rules:
+- List what only A says, then what only B says, as short bullet points; ignore wording and formatting changes
+- End with one line starting with "Merge:" saying whether merging them would lose anything
+- Write in the same language as the entries
+- Plain text only, no preamble`)
+
+	return sb.String()
+}
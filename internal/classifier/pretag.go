@@ -0,0 +1,74 @@
+package classifier
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// KeywordPattern returns a case-insensitive whole-word pattern for a keyword
+func KeywordPattern(keyword string) string {
+	return `(?i)\b` + regexp.QuoteMeta(keyword) + `\b`
+}
+
+// CompilePattern validates a pre-tagger pattern
+func CompilePattern(pattern string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+	return re, nil
+}
+
+// PreTag applies deterministic taggers to content. skipLLM is true when a
+// matching tagger asks for LLM classification to be skipped.
+func PreTag(content string, taggers []domain.PreTagger) (tags []TagSuggestion, skipLLM bool) {
+	seen := make(map[string]bool)
+	for _, t := range taggers {
+		re, err := regexp.Compile(t.Pattern)
+		if err != nil || !re.MatchString(content) {
+			continue
+		}
+		if !seen[t.Tag] {
+			seen[t.Tag] = true
+			tags = append(tags, TagSuggestion{Name: t.Tag, Parent: t.Parent, Confidence: 1.0})
+		}
+		skipLLM = skipLLM || t.SkipLLM
+	}
+	return tags, skipLLM
+}
+
+// ClassifyWithPreTags runs pre-taggers, then the LLM classifier unless a
+// pre-tagger said to skip it or clf is nil. Pre-tags come first and win
+// over LLM suggestions of the same name.
+func ClassifyWithPreTags(ctx context.Context, clf *Classifier, content string, existingTags []string, taggers []domain.PreTagger) (*ClassifyResult, error) {
+	tags, skipLLM := PreTag(content, taggers)
+	if skipLLM || clf == nil {
+		if clf == nil && len(tags) == 0 {
+			return nil, fmt.Errorf("no pre-tagger matched and no classifier available")
+		}
+		return &ClassifyResult{Tags: tags}, nil
+	}
+
+	result, err := clf.Classify(ctx, content, existingTags)
+	if err != nil {
+		// Deterministic tags are still worth keeping
+		if len(tags) > 0 {
+			return &ClassifyResult{Tags: tags}, err
+		}
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(tags))
+	for _, t := range tags {
+		seen[t.Name] = true
+	}
+	for _, t := range result.Tags {
+		if !seen[t.Name] {
+			tags = append(tags, t)
+		}
+	}
+	return &ClassifyResult{Tags: tags, Title: result.Title}, nil
+}
@@ -0,0 +1,99 @@
+package classifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// PromotionReview is the suggested refinement of a note being promoted
+type PromotionReview struct {
+	// Title is a suggested title stating the note's idea
+	Title string `json:"title"`
+	// Edits are concrete suggestions to make the note stand on its own
+	Edits []string `json:"edits"`
+	// Links are related entries worth connecting to
+	Links []LinkSuggestion `json:"links"`
+}
+
+// LinkSuggestion is a related entry with the reason to link it
+type LinkSuggestion struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+// ReviewPromotion asks how a note should be refined before moving to the
+// target maturity, and which of the related entries it should link to
+func (c *Classifier) ReviewPromotion(ctx context.Context, content, target string, related []domain.Entry) (*PromotionReview, error) {
+	resp, err := c.send(ctx, apiMessage{Role: "user", Content: buildPromotionPrompt(content, target, related)}, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("api call: %w", err)
+	}
+
+	resp = trimFences(resp)
+	var review PromotionReview
+	if err := json.Unmarshal([]byte(resp), &review); err != nil {
+		return nil, fmt.Errorf("parse json: %w (response: %s)", err, resp)
+	}
+
+	// Only keep links to the entries we offered
+	offered := make(map[string]bool, len(related))
+	for _, e := range related {
+		offered[e.ID] = true
+	}
+	var links []LinkSuggestion
+	for _, l := range review.Links {
+		if offered[l.ID] {
+			links = append(links, l)
+		}
+	}
+	review.Links = links
+	return &review, nil
+}
+
+func buildPromotionPrompt(content, target string, related []domain.Entry) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "A note in a Zettelkasten-style knowledge base is being promoted to a %s note. Review it. Return JSON only.\n\n", target)
+	switch target {
+	case domain.MaturityLiterature:
+		sb.WriteString("A literature note summarizes a source in the author's own words, with what matters and why.\n\n")
+	case domain.MaturityEvergreen:
+		sb.WriteString("An evergreen note is atomic, concept-oriented, written to be understood on its own, and densely linked.\n\n")
+	}
+
+	sb.WriteString("Note:\n---\n")
+	sb.WriteString(content)
+	sb.WriteString("\n---\n\n")
+
+	if len(related) > 0 {
+		sb.WriteString("Related entries (id: text):\n")
+		for _, e := range related {
+			text := strings.Join(strings.Fields(e.Content), " ")
+			if r := []rune(text); len(r) > 300 {
+				text = string(r[:300]) + "..."
+			}
+			fmt.Fprintf(&sb, "- %s: %s\n", e.ID, text)
+		}
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString(`Return a JSON object with this structure:
+{
+  "title": "a short title stating the note's main idea",
+  "edits": ["a concrete, specific edit to make"],
+  "links": [{"id": "related-entry-id", "reason": "why they connect"}]
+}
+
+Rules:
+- Suggest at most 5 edits, most important first; leave the list empty if the note is ready
+- Only link related entries that genuinely connect to the idea, using their exact id
+- Write in the same language as the note
+
+Return ONLY the JSON, no other text.`)
+
+	return sb.String()
+}
@@ -0,0 +1,69 @@
+package classifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// TranslateQuery turns a natural-language question about the knowledge
+// base into an entry filter. Tags are the existing tag names, so the
+// filter can use them exactly; today anchors relative dates.
+func (c *Classifier) TranslateQuery(ctx context.Context, question string, tags []string, today time.Time) (*domain.EntryFilter, error) {
+	resp, err := c.callAPI(ctx, buildQueryPrompt(question, tags, today))
+	if err != nil {
+		return nil, fmt.Errorf("api call: %w", err)
+	}
+
+	resp = trimFences(resp)
+	var filter domain.EntryFilter
+	if err := json.Unmarshal([]byte(resp), &filter); err != nil {
+		return nil, fmt.Errorf("parse json: %w (response: %s)", err, resp)
+	}
+	return &filter, nil
+}
+
+func buildQueryPrompt(question string, tags []string, today time.Time) string {
+	var sb strings.Builder
+
+	sb.WriteString("Translate this request about a personal knowledge base into a filter over its entries. Return JSON only.\n\n")
+	fmt.Fprintf(&sb, "Request: %s\n\n", question)
+	fmt.Fprintf(&sb, "Today is %s.\n\n", today.Format("Monday 2006-01-02"))
+
+	if len(tags) > 0 {
+		sb.WriteString("Existing tags: ")
+		sb.WriteString(strings.Join(tags, ", "))
+		sb.WriteString("\n\n")
+	}
+
+	fmt.Fprintf(&sb, `Return a JSON object with any of these fields, leaving out the ones the request doesn't constrain:
+{
+  "text": "words to find in the content or title",
+  "tags": ["tags the entries must all have"],
+  "exclude_tags": ["tags the entries must not have"],
+  "source_type": "one of %s",
+  "maturity": "one of %s",
+  "created_after": "YYYY-MM-DD, inclusive",
+  "created_before": "YYYY-MM-DD, exclusive",
+  "viewed": true or false,
+  "reviewed": true or false,
+  "scratch": true to include scratch (expiring) entries,
+  "limit": maximum number of entries
+}
+
+Rules:
+- Use existing tag names exactly; pick the closest one rather than inventing a tag
+- Resolve relative dates ("last month", "this week") into date bounds
+- "viewed" is whether an entry was ever opened; "reviewed" whether it went through spaced repetition review
+- Only use "text" for words the entries should contain, not for words describing the filter
+
+Return ONLY the JSON, no other text.`,
+		strings.Join([]string{domain.SourceNote, domain.SourceURL, domain.SourceFile, domain.SourceClip, domain.SourceEmail}, ", "),
+		strings.Join(domain.MaturityLevels, ", "))
+
+	return sb.String()
+}
@@ -0,0 +1,73 @@
+package classifier
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// MaxImageSize is the largest image the API accepts
+const MaxImageSize = 5 * 1024 * 1024
+
+// visionMediaTypes are the image formats the API can read
+var visionMediaTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// CanExtractText reports whether ExtractText supports an image type
+func CanExtractText(mediaType string) bool {
+	return visionMediaTypes[mediaType]
+}
+
+type imageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+type contentBlock struct {
+	Type   string       `json:"type"`
+	Text   string       `json:"text,omitempty"`
+	Source *imageSource `json:"source,omitempty"`
+}
+
+const ocrPrompt = `Transcribe all text visible in this image (whiteboard, book page, screenshot, etc.).
+
+Rules:
+- Preserve reading order, paragraphs and list structure
+- Don't add commentary, translation or formatting fences
+- If there is little or no text, briefly describe the image in one or two sentences instead
+
+Return ONLY the transcription.`
+
+// ExtractText reads the text in an image using the vision model
+func (c *Classifier) ExtractText(ctx context.Context, image []byte, mediaType string) (string, error) {
+	if !CanExtractText(mediaType) {
+		return "", fmt.Errorf("unsupported image type: %s", mediaType)
+	}
+	if len(image) > MaxImageSize {
+		return "", fmt.Errorf("image too large: %d bytes (max %d)", len(image), MaxImageSize)
+	}
+
+	msg := apiMessage{
+		Role: "user",
+		Content: []contentBlock{
+			{Type: "image", Source: &imageSource{
+				Type:      "base64",
+				MediaType: mediaType,
+				Data:      base64.StdEncoding.EncodeToString(image),
+			}},
+			{Type: "text", Text: ocrPrompt},
+		},
+	}
+
+	text, err := c.send(ctx, msg, 4096)
+	if err != nil {
+		return "", fmt.Errorf("api call: %w", err)
+	}
+	return strings.TrimSpace(text), nil
+}
@@ -0,0 +1,362 @@
+package digest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"sort"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// Sections of the digest, each of which can be paused independently
+const (
+	SectionNew         = "new"
+	SectionConnections = "connections"
+	SectionReviews     = "reviews"
+	SectionSuggestions = "suggestions"
+	SectionCosts       = "costs"
+	SectionMaturity    = "maturity"
+	SectionNeglected   = "neglected"
+)
+
+// Sections lists every digest section in display order
+var Sections = []string{SectionNew, SectionConnections, SectionReviews, SectionSuggestions, SectionNeglected, SectionMaturity, SectionCosts}
+
+// suggestionCount is how many stale entries the digest resurfaces
+const suggestionCount = 5
+
+// New entries are connected to the older entries at least
+// minConnectionSimilarity alike, the connectionCount closest
+const (
+	minConnectionSimilarity = 0.8
+	connectionCount         = 10
+)
+
+// Untagged groups the new entries without tags
+const Untagged = "untagged"
+
+// refineAge is how long a fleeting note sits before the digest asks to
+// refine it
+const refineAge = 14 * 24 * time.Hour
+
+// Neglected areas are tags with at least neglectedMinEntries entries, none
+// viewed within neglectedAge
+const (
+	neglectedAge        = 30 * 24 * time.Hour
+	neglectedMinEntries = 3
+)
+
+// Digest summarizes knowledge base activity over a period
+type Digest struct {
+	Since       time.Time            `json:"since"`
+	Until       time.Time            `json:"until"`
+	Sections    map[string]bool      `json:"sections"`
+	NewEntries  []domain.Entry       `json:"new_entries,omitempty"`
+	ByTag       []TagGroup           `json:"by_tag,omitempty"`
+	Connections []Connection         `json:"connections,omitempty"`
+	DueReviews  int                  `json:"due_reviews"`
+	Suggestions []domain.Entry       `json:"suggestions,omitempty"`
+	Maturity    map[string]int       `json:"maturity,omitempty"`
+	Promoted    map[string]int       `json:"promoted,omitempty"`
+	ToRefine    []domain.Entry       `json:"to_refine,omitempty"`
+	Neglected   []domain.TagActivity `json:"neglected,omitempty"`
+	Usage       []store.ModelUsage   `json:"usage,omitempty"`
+	TotalCost   float64              `json:"total_cost"`
+	// IDLength is how much of entry IDs to show
+	IDLength int `json:"-"`
+}
+
+// TagGroup is the new entries filed under a tag: the one of their tags
+// most new entries share
+type TagGroup struct {
+	Tag     string         `json:"tag"`
+	Entries []domain.Entry `json:"entries"`
+}
+
+// Connection is a new entry close by embedding to an older one
+type Connection struct {
+	Entry      domain.Entry `json:"entry"`
+	Related    domain.Entry `json:"related"`
+	Similarity float64      `json:"similarity"`
+}
+
+// PauseKey is the settings key marking a digest section as paused
+func PauseKey(section string) string {
+	return "digest.paused." + section
+}
+
+// IsPaused reports whether a digest section is paused
+func IsPaused(ctx context.Context, s *store.Store, section string) (bool, error) {
+	v, err := s.GetSetting(ctx, PauseKey(section))
+	return v != "", err
+}
+
+// Build gathers the digest for the period since the given time,
+// skipping paused sections
+func Build(ctx context.Context, s *store.Store, since time.Time) (*Digest, error) {
+	d := &Digest{Since: since, Until: time.Now(), Sections: make(map[string]bool)}
+
+	for _, section := range Sections {
+		paused, err := IsPaused(ctx, s, section)
+		if err != nil {
+			return nil, err
+		}
+		d.Sections[section] = !paused
+	}
+
+	var err error
+	if d.IDLength, err = s.ShortIDLength(ctx); err != nil {
+		return nil, err
+	}
+	if d.Sections[SectionNew] {
+		if d.NewEntries, err = s.ListEntriesSince(ctx, since); err != nil {
+			return nil, err
+		}
+		for i := range d.NewEntries {
+			tags, _ := s.GetEntryTags(ctx, d.NewEntries[i].ID)
+			d.NewEntries[i].Tags = tags
+		}
+		d.ByTag = groupByTag(d.NewEntries)
+	}
+	if d.Sections[SectionConnections] {
+		if d.Connections, err = connect(ctx, s, since); err != nil {
+			return nil, err
+		}
+	}
+	if d.Sections[SectionReviews] {
+		if d.DueReviews, err = s.CountDueReviews(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if d.Sections[SectionSuggestions] {
+		if d.Suggestions, err = s.GetSuggestions(ctx, suggestionCount); err != nil {
+			return nil, err
+		}
+	}
+	if d.Sections[SectionNeglected] {
+		if d.Neglected, err = s.NeglectedTags(ctx, time.Now().Add(-neglectedAge), neglectedMinEntries, suggestionCount); err != nil {
+			return nil, err
+		}
+	}
+	if d.Sections[SectionMaturity] {
+		if d.Maturity, err = s.MaturityCounts(ctx); err != nil {
+			return nil, err
+		}
+		if d.Promoted, err = s.CountPromotionsSince(ctx, since); err != nil {
+			return nil, err
+		}
+		if d.ToRefine, err = s.StaleFleetingEntries(ctx, refineAge, suggestionCount); err != nil {
+			return nil, err
+		}
+	}
+	if d.Sections[SectionCosts] {
+		if d.Usage, err = s.UsageSince(ctx, since); err != nil {
+			return nil, err
+		}
+		for _, u := range d.Usage {
+			d.TotalCost += u.Cost
+		}
+	}
+
+	return d, nil
+}
+
+// groupByTag files each entry under the one of its tags most entries
+// share, biggest groups first, untagged entries last
+func groupByTag(entries []domain.Entry) []TagGroup {
+	counts := make(map[string]int)
+	for _, e := range entries {
+		for _, t := range e.Tags {
+			counts[t.Name]++
+		}
+	}
+
+	var groups []TagGroup
+	index := make(map[string]int)
+	for _, e := range entries {
+		tag := Untagged
+		for _, t := range e.Tags {
+			if tag == Untagged || counts[t.Name] > counts[tag] || (counts[t.Name] == counts[tag] && t.Name < tag) {
+				tag = t.Name
+			}
+		}
+		i, ok := index[tag]
+		if !ok {
+			i = len(groups)
+			index[tag] = i
+			groups = append(groups, TagGroup{Tag: tag})
+		}
+		groups[i].Entries = append(groups[i].Entries, e)
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		if (groups[i].Tag == Untagged) != (groups[j].Tag == Untagged) {
+			return groups[j].Tag == Untagged
+		}
+		if len(groups[i].Entries) != len(groups[j].Entries) {
+			return len(groups[i].Entries) > len(groups[j].Entries)
+		}
+		return groups[i].Tag < groups[j].Tag
+	})
+	return groups
+}
+
+// connect finds, for each entry added since the given time, the closest
+// older entry by embedding, keeping the closest connections
+func connect(ctx context.Context, s *store.Store, since time.Time) ([]Connection, error) {
+	entries, err := s.ListEntriesSince(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+
+	var connections []Connection
+	for _, e := range entries {
+		vector, err := s.GetEmbedding(ctx, e.ID)
+		if err != nil {
+			return nil, err
+		}
+		if vector == nil {
+			continue
+		}
+		// Enough candidates to find an older one past the other new entries
+		similar, err := s.FindSimilar(ctx, vector, len(entries)+1, e.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, sim := range similar {
+			if sim.Similarity < minConnectionSimilarity {
+				break
+			}
+			if sim.Entry.CreatedAt.Before(since) {
+				connections = append(connections, Connection{Entry: e, Related: sim.Entry, Similarity: sim.Similarity})
+				break
+			}
+		}
+	}
+
+	sort.SliceStable(connections, func(i, j int) bool {
+		return connections[i].Similarity > connections[j].Similarity
+	})
+	if len(connections) > connectionCount {
+		connections = connections[:connectionCount]
+	}
+	return connections, nil
+}
+
+// Empty reports whether every section is paused
+func (d *Digest) Empty() bool {
+	for _, on := range d.Sections {
+		if on {
+			return false
+		}
+	}
+	return true
+}
+
+// Subject returns an email subject line for the digest
+func (d *Digest) Subject() string {
+	return fmt.Sprintf("kb digest: %d new entries since %s", len(d.NewEntries), d.Since.Format("Jan 2"))
+}
+
+// RenderHTML renders the digest as an HTML email body
+func (d *Digest) RenderHTML() (string, error) {
+	var buf bytes.Buffer
+	if err := htmlTemplate.Execute(&buf, d); err != nil {
+		return "", fmt.Errorf("render digest: %w", err)
+	}
+	return buf.String(), nil
+}
+
+func truncate(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	return string(r[:max-3]) + "..."
+}
+
+// templateFuncs are the functions of the HTML and Markdown templates
+var templateFuncs = map[string]interface{}{
+	"truncate": truncate,
+	"short":    domain.ShortID,
+	"date":     func(t time.Time) string { return t.Format("Mon Jan 2") },
+	"money":    func(f float64) string { return fmt.Sprintf("$%.4f", f) },
+	"percent":  func(f float64) string { return fmt.Sprintf("%.0f%%", f*100) },
+}
+
+var htmlTemplate = template.Must(template.New("digest").Funcs(templateFuncs).Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: -apple-system, sans-serif; max-width: 640px; margin: auto; color: #222;">
+<h1>Your knowledge base, {{date .Since}} – {{date .Until}}</h1>
+
+{{if index .Sections "new"}}
+<h2>New entries ({{len .NewEntries}})</h2>
+{{if .NewEntries}}{{range .ByTag}}<h3>{{.Tag}} ({{len .Entries}})</h3>
+<ul>
+{{range .Entries}}<li><code>{{short .ID $.IDLength}}</code> {{truncate .DisplayTitle 140}}{{if .Tags}} <em>{{range $i, $t := .Tags}}{{if $i}}, {{end}}{{$t.Name}}{{end}}</em>{{end}}</li>
+{{end}}</ul>
+{{end}}{{else}}<p>Nothing new this period.</p>{{end}}
+<p style="font-size: 12px; color: #888;">Pause this section: <code>kb report pause new</code></p>
+{{end}}
+
+{{if index .Sections "connections"}}
+<h2>Connections</h2>
+{{if .Connections}}<p>New entries close to ones you saved before:</p>
+<ul>
+{{range .Connections}}<li><code>{{short .Entry.ID $.IDLength}}</code> {{truncate .Entry.DisplayTitle 80}} ↔ <code>{{short .Related.ID $.IDLength}}</code> {{truncate .Related.DisplayTitle 80}} ({{percent .Similarity}})</li>
+{{end}}</ul>{{else}}<p>No new entry is close to an older one.</p>{{end}}
+<p style="font-size: 12px; color: #888;">Pause this section: <code>kb report pause connections</code></p>
+{{end}}
+
+{{if index .Sections "reviews"}}
+<h2>Due reviews</h2>
+<p>{{.DueReviews}} entries are due. Run <code>kb review</code> to go through them.</p>
+<p style="font-size: 12px; color: #888;">Pause this section: <code>kb report pause reviews</code></p>
+{{end}}
+
+{{if index .Sections "suggestions"}}
+<h2>Forgotten corners</h2>
+{{if .Suggestions}}<ul>
+{{range .Suggestions}}<li><code>{{short .ID $.IDLength}}</code> {{truncate .Content 140}}</li>
+{{end}}</ul>{{else}}<p>No entries yet.</p>{{end}}
+<p style="font-size: 12px; color: #888;">Pause this section: <code>kb report pause suggestions</code></p>
+{{end}}
+
+{{if index .Sections "neglected"}}
+<h2>Neglected areas</h2>
+{{if .Neglected}}<p>Nothing under these tags was opened in the last month. A good place for your next review session:</p>
+<ul>
+{{range .Neglected}}<li><strong>{{.Tag}}</strong> — {{.Entries}} entries, {{with .LastViewedAt}}last viewed {{date .}}{{else}}never viewed{{end}} (<code>kb review --stale --tag {{.Tag}}</code>)</li>
+{{end}}</ul>{{else}}<p>Every area got some attention lately.</p>{{end}}
+<p style="font-size: 12px; color: #888;">Pause this section: <code>kb report pause neglected</code></p>
+{{end}}
+
+{{if index .Sections "maturity"}}
+<h2>Refining notes</h2>
+<p>{{index .Maturity "fleeting"}} fleeting, {{index .Maturity "literature"}} literature, {{index .Maturity "evergreen"}} evergreen.
+{{with index .Promoted "evergreen"}}{{.}} became evergreen this period.{{end}}</p>
+{{if .ToRefine}}<p>These fleeting notes have been waiting a while. Rework them into literature or evergreen notes with <code>kb promote --review</code>, or let them go:</p>
+<ul>
+{{range .ToRefine}}<li><code>{{short .ID $.IDLength}}</code> {{truncate .Content 140}}</li>
+{{end}}</ul>{{end}}
+<p style="font-size: 12px; color: #888;">Pause this section: <code>kb report pause maturity</code></p>
+{{end}}
+
+{{if index .Sections "costs"}}
+<h2>API costs</h2>
+{{if .Usage}}<table cellpadding="4">
+<tr><th align="left">Model</th><th align="right">Calls</th><th align="right">Tokens in</th><th align="right">Tokens out</th><th align="right">Cost</th></tr>
+{{range .Usage}}<tr><td>{{.Model}}</td><td align="right">{{.Calls}}</td><td align="right">{{.InputTokens}}</td><td align="right">{{.OutputTokens}}</td><td align="right">{{money .Cost}}</td></tr>
+{{end}}<tr><td colspan="4"><strong>Total</strong></td><td align="right"><strong>{{money .TotalCost}}</strong></td></tr>
+</table>{{else}}<p>No API calls this period.</p>{{end}}
+<p style="font-size: 12px; color: #888;">Pause this section: <code>kb report pause costs</code></p>
+{{end}}
+
+<p style="font-size: 12px; color: #888;">Stop these emails entirely: <code>kb report pause all</code></p>
+</body>
+</html>
+`))
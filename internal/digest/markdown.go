@@ -0,0 +1,64 @@
+package digest
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+// RenderMarkdown renders the digest as Markdown, for the terminal, notes
+// and webhooks
+func (d *Digest) RenderMarkdown() (string, error) {
+	var buf bytes.Buffer
+	if err := markdownTemplate.Execute(&buf, d); err != nil {
+		return "", fmt.Errorf("render digest: %w", err)
+	}
+	return buf.String(), nil
+}
+
+var markdownTemplate = template.Must(template.New("digest").Funcs(templateFuncs).Parse(`# Your knowledge base, {{date .Since}} – {{date .Until}}
+{{if index .Sections "new"}}
+## New entries ({{len .NewEntries}})
+{{if .NewEntries}}{{range .ByTag}}
+### {{.Tag}} ({{len .Entries}})
+
+{{range .Entries}}- ` + "`{{short .ID $.IDLength}}`" + ` {{truncate .DisplayTitle 100}}{{if .Source.URL}} <{{.Source.URL}}>{{end}}
+{{end}}{{end}}{{else}}
+Nothing new this period.
+{{end}}{{end}}{{if index .Sections "connections"}}
+## Connections
+{{if .Connections}}
+New entries close to ones you saved before:
+
+{{range .Connections}}- ` + "`{{short .Entry.ID $.IDLength}}`" + ` {{truncate .Entry.DisplayTitle 60}} ↔ ` + "`{{short .Related.ID $.IDLength}}`" + ` {{truncate .Related.DisplayTitle 60}} ({{percent .Similarity}})
+{{end}}{{else}}
+No new entry is close to an older one.
+{{end}}{{end}}{{if index .Sections "reviews"}}
+## Due reviews
+
+{{.DueReviews}} entries are due (` + "`kb review`" + `).
+{{end}}{{if index .Sections "suggestions"}}{{if .Suggestions}}
+## Forgotten corners
+
+{{range .Suggestions}}- ` + "`{{short .ID $.IDLength}}`" + ` {{truncate .DisplayTitle 100}}
+{{end}}{{end}}{{end}}{{if index .Sections "neglected"}}{{if .Neglected}}
+## Neglected areas
+
+{{range .Neglected}}- **{{.Tag}}**: {{.Entries}} entries, {{with .LastViewedAt}}last viewed {{date .}}{{else}}never viewed{{end}}
+{{end}}{{end}}{{end}}{{if index .Sections "maturity"}}
+## Refining notes
+
+{{index .Maturity "fleeting"}} fleeting, {{index .Maturity "literature"}} literature, {{index .Maturity "evergreen"}} evergreen.{{with index .Promoted "evergreen"}} {{.}} became evergreen this period.{{end}}
+{{if .ToRefine}}
+Fleeting notes waiting to be refined:
+
+{{range .ToRefine}}- ` + "`{{short .ID $.IDLength}}`" + ` {{truncate .DisplayTitle 100}}
+{{end}}{{end}}{{end}}{{if index .Sections "costs"}}
+## API costs
+
+{{if .Usage}}| Model | Calls | Tokens in | Tokens out | Cost |
+|---|--:|--:|--:|--:|
+{{range .Usage}}| {{.Model}} | {{.Calls}} | {{.InputTokens}} | {{.OutputTokens}} | {{money .Cost}} |
+{{end}}| **Total** | | | | **{{money .TotalCost}}** |
+{{else}}No API calls this period.
+{{end}}{{end}}`))
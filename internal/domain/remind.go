@@ -0,0 +1,164 @@
+package domain
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reminderHour is the time of day reminders set for a day are due at
+const reminderHour = 9
+
+var (
+	remindDelay = regexp.MustCompile(`^(\d+|an?|one|two|three|four|five|six|seven|eight|nine|ten)\s*(m|mins?|minutes?|h|hrs?|hours?|d|days?|w|wks?|weeks?|mo|months?|y|years?)$`)
+	remindClock = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?\s*(am|pm)?$`)
+)
+
+var numberWords = map[string]int{
+	"a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5,
+	"six": 6, "seven": 7, "eight": 8, "nine": 9, "ten": 10,
+}
+
+// ParseRemindTime reads when to be reminded, relative to now: after a
+// delay ("in 3 days", "2 weeks", "3d", "12h"), on a day ("tomorrow", "next
+// week", "friday", "2026-11-02") or at a time ("at 14:30"). A day can be
+// given a time ("tomorrow at 8am"); it is 9:00 otherwise.
+func ParseRemindTime(s string, now time.Time) (time.Time, error) {
+	spec := strings.Join(strings.Fields(strings.ToLower(s)), " ")
+	when, err := parseRemindTime(spec, now)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid reminder time %q (e.g. in 3 days, tomorrow at 8am, friday, 2026-11-02)", s)
+	}
+	if !when.After(now) {
+		return time.Time{}, fmt.Errorf("%s is in the past", when.Format("2006-01-02 15:04"))
+	}
+	return when, nil
+}
+
+func parseRemindTime(spec string, now time.Time) (time.Time, error) {
+	if spec == "" {
+		return time.Time{}, fmt.Errorf("no time given")
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, spec, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+
+	day, clock, hasClock := strings.Cut(spec, " at ")
+	if rest, ok := strings.CutPrefix(spec, "at "); ok {
+		day, clock, hasClock = "", rest, true
+	}
+	hour, minute := reminderHour, 0
+	if hasClock {
+		var err error
+		if hour, minute, err = parseClock(clock); err != nil {
+			return time.Time{}, err
+		}
+	}
+	at := func(d time.Time) time.Time {
+		return time.Date(d.Year(), d.Month(), d.Day(), hour, minute, 0, 0, now.Location())
+	}
+
+	day = strings.TrimPrefix(day, "in ")
+	if m := remindDelay.FindStringSubmatch(day); m != nil {
+		n, ok := numberWords[m[1]]
+		if !ok {
+			n, _ = strconv.Atoi(m[1])
+		}
+		switch unit := m[2]; {
+		case unit == "mo" || strings.HasPrefix(unit, "month"):
+			return clockAt(now.AddDate(0, n, 0), hasClock, at), nil
+		case strings.HasPrefix(unit, "m"):
+			return now.Add(time.Duration(n) * time.Minute), nil
+		case strings.HasPrefix(unit, "h"):
+			return now.Add(time.Duration(n) * time.Hour), nil
+		case strings.HasPrefix(unit, "d"):
+			return clockAt(now.AddDate(0, 0, n), hasClock, at), nil
+		case strings.HasPrefix(unit, "w"):
+			return clockAt(now.AddDate(0, 0, 7*n), hasClock, at), nil
+		case strings.HasPrefix(unit, "y"):
+			return clockAt(now.AddDate(n, 0, 0), hasClock, at), nil
+		}
+	}
+
+	switch day {
+	case "":
+		// A time alone is the next time the clock shows it
+		if t := at(now); t.After(now) {
+			return t, nil
+		}
+		return at(now.AddDate(0, 0, 1)), nil
+	case "today":
+		return at(now), nil
+	case "tonight":
+		if !hasClock {
+			hour = 20
+		}
+		return at(now), nil
+	case "tomorrow":
+		return at(now.AddDate(0, 0, 1)), nil
+	case "next week":
+		return at(now.AddDate(0, 0, 7)), nil
+	case "next month":
+		return at(now.AddDate(0, 1, 0)), nil
+	case "next year":
+		return at(now.AddDate(1, 0, 0)), nil
+	}
+	for wd := time.Sunday; wd <= time.Saturday; wd++ {
+		name := strings.ToLower(wd.String())
+		if day == name || day == name[:3] || day == "next "+name || day == "on "+name {
+			ahead := (int(wd) - int(now.Weekday()) + 7) % 7
+			if ahead == 0 {
+				ahead = 7
+			}
+			return at(now.AddDate(0, 0, ahead)), nil
+		}
+	}
+	if t, err := time.ParseInLocation("2006-01-02", day, now.Location()); err == nil {
+		return at(t), nil
+	}
+	return time.Time{}, fmt.Errorf("unknown time %q", spec)
+}
+
+// clockAt sets a delayed time to the time of day given, if any
+func clockAt(t time.Time, hasClock bool, at func(time.Time) time.Time) time.Time {
+	if !hasClock {
+		return t
+	}
+	return at(t)
+}
+
+// parseClock reads a time of day: "14:30", "8am", "9:15pm", "noon"
+func parseClock(s string) (hour, minute int, err error) {
+	switch s {
+	case "noon":
+		return 12, 0, nil
+	case "midnight":
+		return 0, 0, nil
+	}
+	m := remindClock.FindStringSubmatch(s)
+	if m == nil {
+		return 0, 0, fmt.Errorf("unknown time of day %q", s)
+	}
+	hour, _ = strconv.Atoi(m[1])
+	if m[2] != "" {
+		minute, _ = strconv.Atoi(m[2])
+	}
+	if hour > 23 || minute > 59 || (m[3] != "" && (hour < 1 || hour > 12)) {
+		return 0, 0, fmt.Errorf("unknown time of day %q", s)
+	}
+	switch m[3] {
+	case "am":
+		if hour == 12 {
+			hour = 0
+		}
+	case "pm":
+		if hour < 12 {
+			hour += 12
+		}
+	}
+	return hour, minute, nil
+}
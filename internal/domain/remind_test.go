@@ -0,0 +1,84 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRemindTime(t *testing.T) {
+	// A Thursday
+	now := time.Date(2026, 10, 15, 10, 0, 0, 0, time.UTC)
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		// Delays keep the time of day, unless given one
+		{"in 3 days", at(10, 18, 10, 0)},
+		{"3d", at(10, 18, 10, 0)},
+		{"2 weeks", at(10, 29, 10, 0)},
+		{"a week", at(10, 22, 10, 0)},
+		{"two months", at(12, 15, 10, 0)},
+		{"12h", at(10, 15, 22, 0)},
+		{"in 30 minutes", at(10, 15, 10, 30)},
+		{"in 3 days at 8am", at(10, 18, 8, 0)},
+		// Days are due at 9:00
+		{"tomorrow", at(10, 16, 9, 0)},
+		{"Tomorrow  at 8am", at(10, 16, 8, 0)},
+		{"tomorrow at 9:15pm", at(10, 16, 21, 15)},
+		{"tomorrow at noon", at(10, 16, 12, 0)},
+		{"tomorrow at 12am", at(10, 16, 0, 0)},
+		{"today at 18:00", at(10, 15, 18, 0)},
+		{"tonight", at(10, 15, 20, 0)},
+		{"tonight at 22:30", at(10, 15, 22, 30)},
+		{"next week", at(10, 22, 9, 0)},
+		{"friday", at(10, 16, 9, 0)},
+		{"next monday", at(10, 19, 9, 0)},
+		{"wed", at(10, 21, 9, 0)},
+		{"on wednesday", at(10, 21, 9, 0)},
+		// The same weekday is next week's
+		{"thursday", at(10, 22, 9, 0)},
+		{"2026-11-02", at(11, 2, 9, 0)},
+		{"2026-11-02 at 7pm", at(11, 2, 19, 0)},
+		{"2026-11-02 14:00", at(11, 2, 14, 0)},
+		// A time alone is the next time the clock shows it
+		{"at 14:30", at(10, 15, 14, 30)},
+		{"at noon", at(10, 15, 12, 0)},
+		{"at 8am", at(10, 16, 8, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseRemindTime(tt.spec, now)
+			if err != nil {
+				t.Fatalf("ParseRemindTime: %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("ParseRemindTime = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRemindTimeErrors(t *testing.T) {
+	now := time.Date(2026, 10, 15, 10, 0, 0, 0, time.UTC)
+	tests := []string{
+		"",
+		"soon",
+		"in a while",
+		"at 25:00",
+		"tomorrow at 13pm",
+		"tomorrow at teatime",
+		// In the past
+		"today",
+		"2026-10-01",
+	}
+	for _, spec := range tests {
+		t.Run(spec, func(t *testing.T) {
+			if got, err := ParseRemindTime(spec, now); err == nil {
+				t.Errorf("ParseRemindTime = %v, want an error", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package domain
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Section kinds of a captured URL
+const (
+	SectionMetadata   = "metadata"
+	SectionNote       = "note"
+	SectionHighlights = "highlights"
+	SectionText       = "text"
+)
+
+// SectionKinds lists the section kinds a capture template can lay out
+var SectionKinds = []string{SectionMetadata, SectionNote, SectionHighlights, SectionText}
+
+// Section is one part of a structured entry's content
+type Section struct {
+	Kind    string `json:"kind"`
+	Heading string `json:"heading"`
+	Text    string `json:"text"`
+}
+
+// TemplateSection places one kind of section in a capture template
+type TemplateSection struct {
+	Kind    string `json:"kind"`
+	Heading string `json:"heading"`
+}
+
+// DefaultCaptureTemplate lays out a captured URL when no template is set
+var DefaultCaptureTemplate = []TemplateSection{
+	{SectionMetadata, "Source"},
+	{SectionNote, "My note"},
+	{SectionHighlights, "Highlights"},
+	{SectionText, "Full text"},
+}
+
+// CheckCaptureTemplate validates a capture template: known kinds, each at
+// most once, with a heading on a single line
+func CheckCaptureTemplate(template []TemplateSection) error {
+	if len(template) == 0 {
+		return fmt.Errorf("a template needs at least one section")
+	}
+	for i, s := range template {
+		if !slices.Contains(SectionKinds, s.Kind) {
+			return fmt.Errorf("unknown section kind %q (use %s)", s.Kind, strings.Join(SectionKinds, ", "))
+		}
+		if strings.TrimSpace(s.Heading) == "" || strings.ContainsAny(s.Heading, "\n{}") {
+			return fmt.Errorf("invalid heading for %s: %q", s.Kind, s.Heading)
+		}
+		for _, prev := range template[:i] {
+			if prev.Kind == s.Kind {
+				return fmt.Errorf("section %s appears twice", s.Kind)
+			}
+		}
+	}
+	return nil
+}
+
+// URLCapture is what was captured from a URL, before it is laid out in
+// sections
+type URLCapture struct {
+	URL         string
+	Author      string
+	PublishedAt *time.Time
+	Description string
+	// Note is what the user wrote about the page
+	Note string
+	// Highlights are passages the user selected
+	Highlights []string
+	// Text is the extracted article
+	Text string
+}
+
+// Render lays out the capture following a template
+func (c *URLCapture) Render(template []TemplateSection) string {
+	var meta []string
+	if c.URL != "" {
+		meta = append(meta, "- URL: <"+c.URL+">")
+	}
+	if c.Author != "" {
+		meta = append(meta, "- Author: "+c.Author)
+	}
+	if c.PublishedAt != nil {
+		meta = append(meta, "- Published: "+c.PublishedAt.Format("2006-01-02"))
+	}
+	if c.Description != "" {
+		meta = append(meta, "- Summary: "+strings.Join(strings.Fields(c.Description), " "))
+	}
+
+	var highlights []string
+	for _, h := range c.Highlights {
+		if h = strings.TrimSpace(h); h != "" {
+			highlights = append(highlights, "> "+strings.ReplaceAll(h, "\n", "\n> "))
+		}
+	}
+
+	content := RenderSections(template, map[string]string{
+		SectionMetadata:   strings.Join(meta, "\n"),
+		SectionNote:       c.Note,
+		SectionHighlights: strings.Join(highlights, "\n\n"),
+		SectionText:       c.Text,
+	})
+	if content == "" {
+		// Nothing the template keeps was captured: keep what was
+		parts := append([]string{c.Note}, c.Highlights...)
+		return strings.TrimSpace(strings.Join(append(parts, c.Text), "\n\n"))
+	}
+	return content
+}
+
+// sectionHeading matches the headings RenderSections writes: Markdown
+// headings carrying the section kind as a {#kind} attribute
+var sectionHeading = regexp.MustCompile(`^## (.+) \{#(` + strings.Join(SectionKinds, "|") + `)\}$`)
+
+// RenderSections lays out captured parts, by kind, as content following a
+// template. Empty parts and kinds left out of the template are skipped.
+// Each section starts with a heading naming its kind, so the content
+// stays plain Markdown yet can be split back with ParseSections.
+func RenderSections(template []TemplateSection, parts map[string]string) string {
+	var sb strings.Builder
+	for _, s := range template {
+		text := strings.TrimSpace(parts[s.Kind])
+		if text == "" {
+			continue
+		}
+		if sb.Len() > 0 {
+			sb.WriteString("\n\n")
+		}
+		fmt.Fprintf(&sb, "## %s {#%s}\n\n%s", s.Heading, s.Kind, text)
+	}
+	return sb.String()
+}
+
+// ParseSections splits content written by RenderSections into its
+// sections. Content without section headings has none; text before the
+// first heading is a note section.
+func ParseSections(content string) []Section {
+	var sections []Section
+	var current *Section
+	var body []string
+
+	flush := func() {
+		text := strings.TrimSpace(strings.Join(body, "\n"))
+		if current != nil {
+			current.Text = text
+			sections = append(sections, *current)
+		} else if text != "" {
+			sections = append(sections, Section{Kind: SectionNote, Text: text})
+		}
+		body = nil
+	}
+
+	found := false
+	for _, line := range strings.Split(content, "\n") {
+		if m := sectionHeading.FindStringSubmatch(strings.TrimRight(line, " \r")); m != nil {
+			found = true
+			flush()
+			current = &Section{Kind: m[2], Heading: m[1]}
+			continue
+		}
+		body = append(body, line)
+	}
+	if !found {
+		return nil
+	}
+	flush()
+	return sections
+}
@@ -1,27 +1,950 @@
 package domain
 
-import "time"
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
 
 // Entry represents a captured piece of content
 type Entry struct {
-	ID           string     `json:"id"`
-	Content      string     `json:"content"`
-	Tags         []Tag      `json:"tags,omitempty"`
-	CreatedAt    time.Time  `json:"created_at"`
-	LastViewedAt *time.Time `json:"last_viewed_at,omitempty"`
+	ID           string             `json:"id"`
+	Content      string             `json:"content"`
+	Source       Source             `json:"source"`
+	Tags         []Tag              `json:"tags,omitempty"`
+	Attachments  []Attachment       `json:"attachments,omitempty"`
+	SeenVia      []SourceOccurrence `json:"seen_via,omitempty"`
+	Links        []EntryLink        `json:"links,omitempty"`
+	Backlinks    []EntryLink        `json:"backlinks,omitempty"`
+	CreatedAt    time.Time          `json:"created_at"`
+	LastViewedAt *time.Time         `json:"last_viewed_at,omitempty"`
+	// Sections are the parts of a structured capture, parsed from the
+	// content; only loaded with single entries
+	Sections []Section `json:"sections,omitempty"`
+	// Workflows are the entry's states in the workflows it was started in;
+	// only loaded with single entries
+	Workflows []EntryState `json:"workflows,omitempty"`
+	// Merged are the entries merged into this one; only loaded with
+	// single entries
+	Merged []MergedEntry `json:"merged,omitempty"`
+	// Notebook is only loaded with single entries
+	Notebook string `json:"notebook,omitempty"`
+	// Reminder is only loaded with single entries
+	Reminder *Reminder `json:"reminder,omitempty"`
+	// Locked is set when the content is encrypted and its notebook's key
+	// isn't unlocked; Content is empty then
+	Locked bool `json:"locked,omitempty"`
+	// ArchivedAt and DeletedAt are set on archived entries and entries in
+	// the trash; only loaded with single entries and trash listings
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
+	// PinnedAt is set on pinned entries; only loaded with single entries
+	// and pinned listings
+	PinnedAt *time.Time `json:"pinned_at,omitempty"`
+	// UnreadSince is set on entries waiting to be read, captured articles
+	// until marked read; only loaded with single entries
+	UnreadSince *time.Time `json:"unread_since,omitempty"`
+	// ExpiresAt is set on scratch entries, deleted then unless kept
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Maturity is how refined the note is: fleeting, literature or evergreen
+	Maturity string `json:"maturity"`
+
+	// Revision is bumped on every edit; it is only loaded with single
+	// entries, for conflict-safe updates
+	Revision  int        `json:"revision,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// Source types
+const (
+	SourceNote  = "note"
+	SourceURL   = "url"
+	SourceFile  = "file"
+	SourceClip  = "clip"
+	SourceEmail = "email"
+)
+
+// SourceTypes lists the source types
+var SourceTypes = []string{SourceNote, SourceURL, SourceFile, SourceClip, SourceEmail}
+
+// Maturity levels, from quick capture to a refined, self-contained note
+const (
+	MaturityFleeting   = "fleeting"
+	MaturityLiterature = "literature"
+	MaturityEvergreen  = "evergreen"
+)
+
+// MaturityLevels lists the maturity levels in promotion order
+var MaturityLevels = []string{MaturityFleeting, MaturityLiterature, MaturityEvergreen}
+
+// DefaultMaturity is the maturity of a new entry from the given source:
+// captured material starts as literature, everything else as fleeting
+func DefaultMaturity(sourceType string) string {
+	switch sourceType {
+	case SourceURL, SourceFile, SourceClip, SourceEmail:
+		return MaturityLiterature
+	}
+	return MaturityFleeting
+}
+
+// CanTransition reports whether an entry may move between two maturity
+// levels. Notes are promoted one or more steps forward; an evergreen note
+// can be demoted back to literature for rework.
+func CanTransition(from, to string) bool {
+	fromIdx := slices.Index(MaturityLevels, from)
+	toIdx := slices.Index(MaturityLevels, to)
+	if fromIdx < 0 || toIdx < 0 {
+		return false
+	}
+	return toIdx > fromIdx || (from == MaturityEvergreen && to == MaturityLiterature)
+}
+
+// AppendedText is the text added to an entry's content by an append: a
+// blank line, then the text stamped with its time
+func AppendedText(text string, at time.Time) string {
+	return "\n\n[" + at.Format("2006-01-02 15:04") + "] " + text
+}
+
+// SubstantialAppend reports whether appending text changes an entry enough
+// to classify and embed it again: by a fifth of its words, or by
+// substantialWords words whatever its length
+func SubstantialAppend(before, text string) bool {
+	added := len(strings.Fields(text))
+	return added*5 >= len(strings.Fields(before)) || added >= substantialWords
+}
+
+const substantialWords = 100
+
+// Source describes where an entry's content came from
+type Source struct {
+	Type string `json:"type"`
+	// URL is the link as captured
+	URL string `json:"url,omitempty"`
+	// CanonicalURL is the URL the page declares as its own, when it
+	// differs from the captured one. The entry is found again by the
+	// captured link or any link to that URL. It's only set when saving an
+	// entry, not read back.
+	CanonicalURL string     `json:"canonical_url,omitempty"`
+	Title        string     `json:"title,omitempty"`
+	Author       string     `json:"author,omitempty"`
+	FetchedAt    *time.Time `json:"fetched_at,omitempty"`
+}
+
+// EntryLink is a link between two entries, as seen from one of them
+type EntryLink struct {
+	EntryID   string    `json:"entry_id"`
+	Title     string    `json:"title"`
+	Kind      string    `json:"kind"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Link kinds, read from the linking entry to the linked one
+const (
+	LinkRelates     = "relates"
+	LinkContradicts = "contradicts"
+	LinkExpands     = "expands"
+)
+
+// LinkKinds lists the kinds of links between entries
+var LinkKinds = []string{LinkRelates, LinkContradicts, LinkExpands}
+
+// CheckLinkKind validates a link kind
+func CheckLinkKind(kind string) error {
+	if !slices.Contains(LinkKinds, kind) {
+		return fmt.Errorf("unknown link kind %q (use %s)", kind, strings.Join(LinkKinds, ", "))
+	}
+	return nil
+}
+
+// LinkVerb describes a link of a kind, from the linking entry or, for a
+// backlink, from the linked one
+func LinkVerb(kind string, backlink bool) string {
+	switch {
+	case kind == LinkContradicts && backlink:
+		return "contradicted by"
+	case kind == LinkContradicts:
+		return "contradicts"
+	case kind == LinkExpands && backlink:
+		return "expanded by"
+	case kind == LinkExpands:
+		return "expands"
+	}
+	return "relates to"
+}
+
+// Notebook groups entries. Notebooks nest; one with its own key keeps the
+// content of its entries, and of its sub-notebooks', encrypted.
+type Notebook struct {
+	Name   string `json:"name"`
+	Parent string `json:"parent,omitempty"`
+	// Encrypted is set on notebooks with their own key
+	Encrypted bool `json:"encrypted"`
+	// KeyFrom is the notebook whose key encrypts this one's entries:
+	// itself or its nearest encrypted ancestor
+	KeyFrom string `json:"key_from,omitempty"`
+	// Locked is set when that key isn't unlocked
+	Locked    bool      `json:"locked,omitempty"`
+	Entries   int       `json:"entries"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+var notebookName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// CheckNotebookName validates a notebook name: letters, digits, '_', '.'
+// and '-', not starting with punctuation
+func CheckNotebookName(name string) error {
+	if !notebookName.MatchString(name) {
+		return fmt.Errorf("invalid notebook name %q (use letters, digits, '_', '.' and '-')", name)
+	}
+	return nil
+}
+
+// CheckUserName validates a user name, which follows the rules of
+// notebook names
+func CheckUserName(name string) error {
+	if !notebookName.MatchString(name) {
+		return fmt.Errorf("invalid user name %q (use letters, digits, '_', '.' and '-')", name)
+	}
+	return nil
+}
+
+// Collection is a curated, ordered list of entries, such as a reading
+// list or a course outline
+type Collection struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Entries     int       `json:"entries"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// CheckCollectionName rejects names unfit for paths and commands, with
+// the rules of notebook names
+func CheckCollectionName(name string) error {
+	if !notebookName.MatchString(name) {
+		return fmt.Errorf("invalid collection name %q (use letters, digits, '_', '.' and '-')", name)
+	}
+	return nil
+}
+
+// MergedEntry is an entry that was merged into another one, with its
+// original creation time
+type MergedEntry struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title,omitempty"`
+	URL       string    `json:"url,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	MergedAt  time.Time `json:"merged_at"`
+}
+
+// MergeSeparator goes between the contents of merged entries
+const MergeSeparator = "\n\n---\n\n"
+
+// EntryVersion is an entry's content and title at a past revision.
+// CreatedAt is when that revision was made.
+type EntryVersion struct {
+	Revision  int       `json:"revision"`
+	Title     string    `json:"title,omitempty"`
+	Content   string    `json:"content"`
+	Locked    bool      `json:"locked,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SourceOccurrence records one place an entry's URL was seen
+type SourceOccurrence struct {
+	ID      string    `json:"id"`
+	EntryID string    `json:"entry_id"`
+	Via     string    `json:"via"`
+	URL     string    `json:"url"`
+	SeenAt  time.Time `json:"seen_at"`
+}
+
+// maxTitleLine is how long a first line can be to stand as a title
+const maxTitleLine = 80
+
+// maxUntitled is how long content can be to go without a title
+const maxUntitled = 280
+
+// NeedsTitle reports whether content is too long to be shown by its first
+// line, unless that is a Markdown heading, so it is worth a title
+func NeedsTitle(content string) bool {
+	content = strings.TrimSpace(content)
+	line, _, _ := strings.Cut(content, "\n")
+	if strings.HasPrefix(line, "# ") {
+		return false
+	}
+	return utf8.RuneCountInString(line) > maxTitleLine || utf8.RuneCountInString(content) > maxUntitled
+}
+
+// DisplayTitle returns the source title, or the first line of content.
+// Content laid out in sections (see RenderSections) shows the first line
+// of its first section other than the metadata, not a section heading.
+// Locked entries show neither.
+func (e *Entry) DisplayTitle() string {
+	if e.Locked {
+		return "(encrypted)"
+	}
+	if e.Source.Title != "" {
+		return e.Source.Title
+	}
+	content := strings.TrimSpace(e.Content)
+	// Sections start with a heading: other content isn't parsed
+	if strings.HasPrefix(content, "## ") {
+		if sections := ParseSections(content); len(sections) > 0 {
+			content = sections[0].Text
+			for _, s := range sections {
+				if s.Kind != SectionMetadata && s.Text != "" {
+					content = s.Text
+					break
+				}
+			}
+		}
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(content), "\n")
+	return line
+}
+
+// ShortID abbreviates an ID to its first n characters, without a dangling
+// separator; IDs already shorter are returned whole
+func ShortID(id string, n int) string {
+	if len(id) <= n {
+		return id
+	}
+	return strings.TrimSuffix(id[:n], "-")
+}
+
+// Reminder is a follow-up on an entry, due at RemindAt. NotifiedAt is set
+// once its notification was sent; it stays due until cleared.
+type Reminder struct {
+	EntryID    string     `json:"entry_id"`
+	RemindAt   time.Time  `json:"remind_at"`
+	Note       string     `json:"note,omitempty"`
+	NotifiedAt *time.Time `json:"notified_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	// Entry is only loaded with listings of reminders
+	Entry *Entry `json:"entry,omitempty"`
 }
 
 // Tag represents a classification label with optional hierarchy
 type Tag struct {
-	ID        string  `json:"id"`
-	Name      string  `json:"name"`
-	ParentID  *string `json:"parent_id,omitempty"`
+	ID       string  `json:"id"`
+	Name     string  `json:"name"`
+	ParentID *string `json:"parent_id,omitempty"`
+	// Description says what the tag is for, for the classifier and readers
+	Description string `json:"description,omitempty"`
+	// Color is a "#rrggbb" or "#rgb" color to show the tag in
+	Color string `json:"color,omitempty"`
+	// Path is the names of the tag's ancestors and its own joined by "/",
+	// "programming/golang/concurrency", loaded with the tags of an entry
+	Path      string    `json:"path,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// MaxTagDepth bounds how deep tag trees are walked, should parent links
+// go round
+const MaxTagDepth = 32
+
+// TagTree arranges tags by parent: roots are the tags without a parent, or
+// whose parent is missing, and children the tags under each, by parent id.
+// Tags caught in a parent cycle can't be reached from a root: they're
+// returned apart, for callers to report.
+func TagTree(tags []Tag) (roots []Tag, children map[string][]Tag, cyclic []Tag) {
+	byID := make(map[string]bool, len(tags))
+	for _, t := range tags {
+		byID[t.ID] = true
+	}
+	children = make(map[string][]Tag)
+	for _, t := range tags {
+		if t.ParentID != nil && byID[*t.ParentID] {
+			children[*t.ParentID] = append(children[*t.ParentID], t)
+		} else {
+			roots = append(roots, t)
+		}
+	}
+
+	reached := make(map[string]bool, len(tags))
+	for next := roots; len(next) > 0; {
+		var below []Tag
+		for _, t := range next {
+			reached[t.ID] = true
+			below = append(below, children[t.ID]...)
+		}
+		next = below
+	}
+	for _, t := range tags {
+		if !reached[t.ID] {
+			cyclic = append(cyclic, t)
+		}
+	}
+	return roots, children, cyclic
+}
+
+// TagAlias is another name of a tag: tagging with it tags with the tag
+type TagAlias struct {
+	Alias     string    `json:"alias"`
+	TagID     string    `json:"tag_id"`
+	Tag       string    `json:"tag"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NormalizeTagName writes a tag name the way tags are named: lowercase,
+// words joined by hyphens ("Machine Learning" and "machine_learning" are
+// "machine-learning")
+func NormalizeTagName(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return unicode.IsSpace(r) || r == '_' || r == '-'
+	})
+	return strings.Join(words, "-")
+}
+
 // EntryTag represents the relationship between an entry and a tag
 type EntryTag struct {
 	EntryID    string  `json:"entry_id"`
 	TagID      string  `json:"tag_id"`
 	Confidence float64 `json:"confidence"`
 }
+
+// JobState is the persisted state of a scheduled job
+type JobState struct {
+	Name          string     `json:"name"`
+	LastRunAt     *time.Time `json:"last_run_at,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	LockOwner     string     `json:"lock_owner,omitempty"`
+	LockExpiresAt *time.Time `json:"lock_expires_at,omitempty"`
+}
+
+// Lease is an advisory lock held by one daemon until it expires
+type Lease struct {
+	Name       string    `json:"name"`
+	Owner      string    `json:"owner"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// Review is the spaced repetition state of an entry
+type Review struct {
+	EntryID        string     `json:"entry_id"`
+	Ease           float64    `json:"ease"`
+	IntervalDays   int        `json:"interval_days"`
+	Repetitions    int        `json:"repetitions"`
+	NextDue        time.Time  `json:"next_due"`
+	LastReviewedAt *time.Time `json:"last_reviewed_at,omitempty"`
+}
+
+// TimePoint is one bucket of a time series
+type TimePoint struct {
+	Bucket string `json:"bucket"`
+	Count  int    `json:"count"`
+}
+
+// Attachment is a file linked to an entry, stored by content hash
+type Attachment struct {
+	ID        string    `json:"id"`
+	EntryID   string    `json:"entry_id"`
+	SHA256    string    `json:"sha256"`
+	Filename  string    `json:"filename"`
+	MIMEType  string    `json:"mime_type"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Rule is an automation: when an entry matches Condition, Actions run
+type Rule struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Condition string    `json:"condition"`
+	Actions   []string  `json:"actions"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PreTagger deterministically tags content matching a regular expression,
+// before (or, with SkipLLM, instead of) LLM classification
+type PreTagger struct {
+	ID        string    `json:"id"`
+	Pattern   string    `json:"pattern"`
+	Tag       string    `json:"tag"`
+	Parent    string    `json:"parent,omitempty"`
+	SkipLLM   bool      `json:"skip_llm"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Tag origins
+const (
+	OriginAuto  = "auto"
+	OriginHuman = "human"
+)
+
+// TagAudit lists the problems of a tag taxonomy (see kb tags audit)
+type TagAudit struct {
+	Duplicates []TagDuplicate `json:"duplicates"`
+	// SingleUse are the tags on one entry only, likely too specific
+	SingleUse []string `json:"single_use"`
+	// Cycles are parent links going round, each from its first tag by name
+	// to the one whose parent it is
+	Cycles [][]string `json:"cycles"`
+	// Orphans are the tags whose parent no longer exists
+	Orphans []string `json:"orphans"`
+}
+
+// Reasons tags are found to be duplicates
+const (
+	DuplicateName    = "name"
+	DuplicateMeaning = "meaning"
+)
+
+// TagDuplicate is a pair of tags likely meaning the same: Duplicate would
+// be merged into Tag, the one on more entries
+type TagDuplicate struct {
+	Tag              string `json:"tag"`
+	Duplicate        string `json:"duplicate"`
+	TagEntries       int    `json:"tag_entries"`
+	DuplicateEntries int    `json:"duplicate_entries"`
+	// Reason is DuplicateName for names a few edits apart, DuplicateMeaning
+	// for names and descriptions with close embeddings
+	Reason     string  `json:"reason"`
+	Similarity float64 `json:"similarity,omitempty"`
+}
+
+// TagQuality is the measured precision of a tag's automatic assignments.
+// Kept counts auto assignments on entries the user has looked at without
+// removing the tag; Added counts entries where the user had to add it.
+type TagQuality struct {
+	Tag       string    `json:"tag"`
+	Kept      int       `json:"kept"`
+	Removed   int       `json:"removed"`
+	Added     int       `json:"added"`
+	Precision float64   `json:"precision"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TagActivity is how much attention a tag's entries get: Views counts
+// views of its entries over a period
+type TagActivity struct {
+	Tag          string     `json:"tag"`
+	Entries      int        `json:"entries"`
+	Views        int        `json:"views"`
+	LastViewedAt *time.Time `json:"last_viewed_at,omitempty"`
+}
+
+// LabeledEntry is one example of the classification feedback dataset: an
+// entry's content with the tags the user kept and the ones they rejected
+type LabeledEntry struct {
+	Content  string     `json:"content"`
+	Source   Source     `json:"source"`
+	Accepted []TagLabel `json:"accepted"`
+	Rejected []TagLabel `json:"rejected,omitempty"`
+}
+
+// TagLabel names a tag of a labeled entry, with its parent to rebuild the
+// hierarchy and, for accepted tags, who assigned it
+type TagLabel struct {
+	Name   string `json:"name"`
+	Parent string `json:"parent,omitempty"`
+	Origin string `json:"origin,omitempty"`
+}
+
+// Feed is an RSS or Atom feed subscription
+type Feed struct {
+	ID           string     `json:"id"`
+	URL          string     `json:"url"`
+	Title        string     `json:"title"`
+	LastPolledAt *time.Time `json:"last_polled_at,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// Name returns the feed title, or its URL when the feed has none
+func (f *Feed) Name() string {
+	if f.Title != "" {
+		return f.Title
+	}
+	return f.URL
+}
+
+// Token scopes
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// APIToken is a bearer token for the API. The token itself is only shown
+// once, when created.
+type APIToken struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scope      string     `json:"scope"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	// UserID is the user the token acts as; tokens without one act as
+	// the database owner
+	UserID string `json:"user_id,omitempty"`
+}
+
+// User is an account of a shared server, seeing only its own entries and
+// tags. Admins also manage users.
+type User struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Admin      bool       `json:"admin"`
+	CreatedAt  time.Time  `json:"created_at"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+}
+
+// Share is a read-only public link to an entry, or to the active entries
+// of a tag and its sub-tags. Its Token, the signed share ID, makes up the
+// link: /s/<token> on kb serve.
+type Share struct {
+	ID        string     `json:"id"`
+	EntryID   string     `json:"entry_id,omitempty"`
+	Tag       string     `json:"tag,omitempty"`
+	Token     string     `json:"token"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// UserID is the user who shared, "" for the database owner
+	UserID string `json:"user_id,omitempty"`
+}
+
+// Entry scopes select entries by whether they are archived or in the
+// trash
+const (
+	// ScopeActive entries are neither archived nor in the trash
+	ScopeActive   = "active"
+	ScopeArchived = "archived"
+	ScopeTrash    = "trash"
+	ScopeAll      = "all"
+)
+
+// Scopes lists the entry scopes
+var Scopes = []string{ScopeActive, ScopeArchived, ScopeTrash, ScopeAll}
+
+// Entry list orders: newest created, most recently viewed (never viewed
+// last) or shuffled
+const (
+	SortCreated = "created"
+	SortViewed  = "viewed"
+	SortRandom  = "random"
+)
+
+// EntrySorts lists the entry list orders
+var EntrySorts = []string{SortCreated, SortViewed, SortRandom}
+
+// ListOptions selects and orders a page of entries; zero fields don't
+// filter
+type ListOptions struct {
+	// Scope is active by default
+	Scope    string
+	Maturity string
+	// Query keeps the entries matching a search query (see package
+	// query); scratch entries only match with Scratch
+	Query   string
+	Scratch bool
+	// Tag keeps the entries carrying a tag, by ID, name or alias, or one
+	// of its descendants unless DirectTag
+	Tag       string
+	DirectTag bool
+	// Since is inclusive, Until exclusive
+	Since, Until time.Time
+	// Unread requires (true) or excludes (false) entries waiting to be
+	// read
+	Unread *bool
+	// Sort is created by default; Reverse puts the oldest or least
+	// recently viewed first
+	Sort    string
+	Reverse bool
+	Limit   int
+	Offset  int
+}
+
+// Filtered reports whether options leave out some of the entries of their
+// scope
+func (o ListOptions) Filtered() bool {
+	return o.Query != "" || o.Maturity != "" || !o.Since.IsZero() || !o.Until.IsZero() || o.Unread != nil
+}
+
+// EntryFilter selects entries by their metadata; empty fields don't filter.
+// Dates are YYYY-MM-DD, in local time.
+type EntryFilter struct {
+	// Text is searched in the content and title
+	Text string `json:"text,omitempty"`
+	// Tags must all be on the entry, directly or through a child tag
+	Tags        []string `json:"tags,omitempty"`
+	ExcludeTags []string `json:"exclude_tags,omitempty"`
+	SourceType  string   `json:"source_type,omitempty"`
+	Maturity    string   `json:"maturity,omitempty"`
+	// CreatedAfter is inclusive, CreatedBefore exclusive
+	CreatedAfter  string `json:"created_after,omitempty"`
+	CreatedBefore string `json:"created_before,omitempty"`
+	// Viewed and Reviewed require (true) or exclude (false) entries that
+	// were ever viewed or reviewed
+	Viewed   *bool `json:"viewed,omitempty"`
+	Reviewed *bool `json:"reviewed,omitempty"`
+	// Notebook restricts to a notebook and its sub-notebooks
+	Notebook string `json:"notebook,omitempty"`
+	// Scope is active by default
+	Scope string `json:"scope,omitempty"`
+	// Scratch includes scratch entries
+	Scratch bool `json:"scratch,omitempty"`
+	Limit   int  `json:"limit,omitempty"`
+}
+
+// UI themes, views and entry list columns
+var (
+	UIThemes  = []string{"dark", "light", "system"}
+	UIViews   = []string{"recent", "suggestions", "due"}
+	UIColumns = []string{"tags", "date", "maturity", "source"}
+)
+
+// UISettings are a user's web UI preferences, kept server-side so they
+// follow the user across devices
+type UISettings struct {
+	Theme string `json:"theme"`
+	// DefaultView is the entry list shown when nothing is searched
+	DefaultView string `json:"default_view"`
+	// Columns are the metadata shown under each entry in lists
+	Columns []string `json:"columns"`
+}
+
+// DefaultUISettings are the preferences of a user who saved none
+func DefaultUISettings() UISettings {
+	return UISettings{Theme: "dark", DefaultView: "recent", Columns: []string{"tags", "date", "maturity"}}
+}
+
+// Workflow is a user-defined pipeline of states entries move through,
+// e.g. idea → drafted → published for a writing workflow
+type Workflow struct {
+	Name   string   `json:"name"`
+	States []string `json:"states"`
+	// Notebook is the notebook whose entries, and those of its
+	// sub-notebooks, can be in the workflow; "" for every entry
+	Notebook string `json:"notebook,omitempty"`
+	// Transitions lists the states reachable from each state. Without
+	// transitions, entries move one step forward or back along States.
+	Transitions map[string][]string `json:"transitions,omitempty"`
+	CreatedAt   time.Time           `json:"created_at"`
+}
+
+// Initial is the state entries start the workflow in
+func (w *Workflow) Initial() string {
+	return w.States[0]
+}
+
+// CanTransition reports whether an entry may move between two states
+func (w *Workflow) CanTransition(from, to string) bool {
+	if w.Transitions != nil {
+		return slices.Contains(w.Transitions[from], to)
+	}
+	fromIdx := slices.Index(w.States, from)
+	toIdx := slices.Index(w.States, to)
+	if fromIdx < 0 || toIdx < 0 {
+		return false
+	}
+	return toIdx == fromIdx+1 || toIdx == fromIdx-1
+}
+
+// Next returns the states an entry may move to from the given one
+func (w *Workflow) Next(from string) []string {
+	var next []string
+	for _, to := range w.States {
+		if w.CanTransition(from, to) {
+			next = append(next, to)
+		}
+	}
+	return next
+}
+
+// Validate checks that the workflow has a name and distinct states, and
+// that its transitions only use those states
+func (w *Workflow) Validate() error {
+	if strings.TrimSpace(w.Name) == "" {
+		return fmt.Errorf("workflow name is required")
+	}
+	if len(w.States) < 2 {
+		return fmt.Errorf("a workflow needs at least two states")
+	}
+	for i, state := range w.States {
+		if strings.TrimSpace(state) == "" {
+			return fmt.Errorf("state names can't be empty")
+		}
+		if slices.Contains(w.States[:i], state) {
+			return fmt.Errorf("duplicate state: %s", state)
+		}
+	}
+	for from, tos := range w.Transitions {
+		if !slices.Contains(w.States, from) {
+			return fmt.Errorf("transition from unknown state: %s", from)
+		}
+		for _, to := range tos {
+			if !slices.Contains(w.States, to) {
+				return fmt.Errorf("transition to unknown state: %s", to)
+			}
+			if to == from {
+				return fmt.Errorf("transition from %s to itself", from)
+			}
+		}
+	}
+	return nil
+}
+
+// EntryState is an entry's current state in a workflow
+type EntryState struct {
+	Workflow  string    `json:"workflow"`
+	State     string    `json:"state"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WorkflowCount is the number of entries in one state of a workflow
+type WorkflowCount struct {
+	Workflow string `json:"workflow"`
+	State    string `json:"state"`
+	Entries  int    `json:"entries"`
+}
+
+// Kinds of records kb sync exchanges
+const (
+	SyncKindEntry = "entry"
+	SyncKindTag   = "tag"
+	SyncKindLink  = "link"
+)
+
+// SyncChange is a record as exchanged by kb sync, an entry, a tag or a
+// link between entries: its state, or a tombstone once it's deleted
+type SyncChange struct {
+	// Seq orders changes on the peer that sent them
+	Seq int64 `json:"seq"`
+	// Kind is SyncKindEntry (the default), SyncKindTag or SyncKindLink
+	Kind string `json:"kind,omitempty"`
+	// ID is the entry's or the tag's ID, or the link's (see SyncLinkID)
+	ID        string     `json:"id"`
+	ChangedAt time.Time  `json:"changed_at"`
+	Deleted   bool       `json:"deleted,omitempty"`
+	Entry     *SyncEntry `json:"entry,omitempty"`
+	Tag       *SyncTag   `json:"tag,omitempty"`
+	Link      *SyncLink  `json:"link,omitempty"`
+}
+
+// SyncEntry is the synced state of an entry, with its tags. Views, past
+// versions, reviews and workflows stay local; links are records of their
+// own.
+type SyncEntry struct {
+	Content    string         `json:"content"`
+	Source     Source         `json:"source"`
+	CreatedAt  time.Time      `json:"created_at"`
+	Maturity   string         `json:"maturity"`
+	Notebook   string         `json:"notebook,omitempty"`
+	ExpiresAt  *time.Time     `json:"expires_at,omitempty"`
+	ArchivedAt *time.Time     `json:"archived_at,omitempty"`
+	DeletedAt  *time.Time     `json:"deleted_at,omitempty"`
+	Tags       []SyncEntryTag `json:"tags,omitempty"`
+}
+
+// SyncEntryTag is a tag of a synced entry. The tag is found by ID, or by
+// name when it has none or its record hasn't been received yet; Parent
+// names its parent, to create it then.
+type SyncEntryTag struct {
+	TagID      string  `json:"tag_id,omitempty"`
+	Name       string  `json:"name"`
+	Parent     string  `json:"parent,omitempty"`
+	Confidence float64 `json:"confidence"`
+	Origin     string  `json:"origin,omitempty"`
+}
+
+// SyncTag is the synced state of a tag. Parent names the parent tag of
+// ID ParentID, to create it if its record hasn't been received yet.
+type SyncTag struct {
+	Name        string    `json:"name"`
+	ParentID    string    `json:"parent_id,omitempty"`
+	Parent      string    `json:"parent,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Color       string    `json:"color,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// SyncLink is the synced state of a link between entries
+type SyncLink struct {
+	FromID    string    `json:"from_id"`
+	ToID      string    `json:"to_id"`
+	Kind      string    `json:"kind"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SyncLinkID is the ID a link between entries syncs under
+func SyncLinkID(fromID, toID string) string {
+	return fromID + "/" + toID
+}
+
+// Which side of a sync conflict was kept
+const (
+	ConflictKeptLocal  = "local"
+	ConflictKeptRemote = "remote"
+)
+
+// SyncConflict records an entry changed on both sides between two syncs:
+// the latest change was kept, and the version that lost is kept here
+type SyncConflict struct {
+	ID            int64     `json:"id"`
+	EntryID       string    `json:"entry_id"`
+	Peer          string    `json:"peer"`
+	Kept          string    `json:"kept"`
+	KeptChangedAt time.Time `json:"kept_changed_at"`
+	LostChangedAt time.Time `json:"lost_changed_at"`
+	LostDeleted   bool      `json:"lost_deleted,omitempty"`
+	LostTitle     string    `json:"lost_title,omitempty"`
+	LostContent   string    `json:"lost_content,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Graph is the network of entries and tags: entries linked to their tags,
+// to the entries they link to and to the entries most like them
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// Kinds of graph nodes
+const (
+	NodeEntry = "entry"
+	NodeTag   = "tag"
+)
+
+// GraphNode is an entry or a tag. Tag IDs are "tag:" and the tag name,
+// so they don't clash with entry IDs.
+type GraphNode struct {
+	ID    string `json:"id"`
+	Kind  string `json:"kind"`
+	Label string `json:"label"`
+}
+
+// Kinds of graph edges besides links, which have their link kind
+const (
+	EdgeTagged  = "tagged"
+	EdgeParent  = "parent"
+	EdgeSimilar = "similar"
+)
+
+// GraphEdge goes from an entry to one of its tags, from a tag to its
+// parent, along a link, or between entries whose embeddings are alike.
+// Weight is the similarity of similar entries, else the tag confidence.
+type GraphEdge struct {
+	Source string  `json:"source"`
+	Target string  `json:"target"`
+	Kind   string  `json:"kind"`
+	Weight float64 `json:"weight,omitempty"`
+}
+
+// TagNodeID is the graph node ID of a tag
+func TagNodeID(name string) string {
+	return "tag:" + name
+}
+
+// Chunk is a passage of a long entry, embedded on its own. Start and End
+// are byte offsets into the entry content.
+type Chunk struct {
+	Start  int       `json:"start"`
+	End    int       `json:"end"`
+	Vector []float64 `json:"-"`
+}
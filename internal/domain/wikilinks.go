@@ -0,0 +1,29 @@
+package domain
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	wikiLink  = regexp.MustCompile(`\[\[([^\]|#^\n]+)(?:[#^][^\]|\n]*)?(?:\|[^\]\n]*)?\]\]`)
+	codeFence = regexp.MustCompile("(?ms)^```.*?^```")
+	codeSpan  = regexp.MustCompile("`[^`\n]*`")
+)
+
+// WikiLinks returns the targets of the [[wiki-links]] in content, in order
+// and once each, leaving out those in code. [[target|label]] and
+// [[target#heading]] link to target.
+func WikiLinks(content string) []string {
+	prose := codeSpan.ReplaceAllString(codeFence.ReplaceAllString(content, ""), "")
+	var targets []string
+	seen := make(map[string]bool)
+	for _, m := range wikiLink.FindAllStringSubmatch(prose, -1) {
+		target := strings.TrimSpace(m[1])
+		if target != "" && !seen[strings.ToLower(target)] {
+			seen[strings.ToLower(target)] = true
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
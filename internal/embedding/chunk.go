@@ -0,0 +1,111 @@
+package embedding
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// Chunk sizes, in bytes: about 400 and 75 tokens
+const (
+	ChunkSize    = 1600
+	ChunkOverlap = 300
+)
+
+// Chunk splits a text longer than ChunkSize into passages of at most
+// ChunkSize, along paragraphs where it can. Passages cut inside a paragraph
+// overlap by about ChunkOverlap, so that a sentence at the cut is whole in
+// one of them, and a short last paragraph starts the next passage too.
+// Shorter texts give no chunks.
+func Chunk(text string) []domain.Chunk {
+	if len(strings.TrimSpace(text)) <= ChunkSize {
+		return nil
+	}
+
+	pieces := paragraphs(text)
+	var chunks []domain.Chunk
+	for i := 0; i < len(pieces); {
+		start, end := pieces[i].Start, pieces[i].End
+		j := i
+		for j+1 < len(pieces) && pieces[j+1].End-start <= ChunkSize {
+			j++
+			end = pieces[j].End
+		}
+		chunks = append(chunks, domain.Chunk{Start: start, End: end})
+		if j == len(pieces)-1 {
+			break
+		}
+		// Carry the last paragraph over when short enough to overlap
+		if j > i && pieces[j].End-pieces[j].Start <= ChunkOverlap {
+			i = j
+		} else {
+			i = j + 1
+		}
+	}
+	return chunks
+}
+
+// paragraphs returns the spans of a text's paragraphs, trimmed; those
+// longer than ChunkSize are cut at spaces into overlapping pieces
+func paragraphs(text string) []domain.Chunk {
+	var spans []domain.Chunk
+	offset := 0
+	for _, para := range strings.SplitAfter(text, "\n\n") {
+		start := offset + len(para) - len(strings.TrimLeftFunc(para, unicode.IsSpace))
+		end := offset + len(strings.TrimRightFunc(para, unicode.IsSpace))
+		offset += len(para)
+		if start >= end {
+			continue
+		}
+		for end-start > ChunkSize {
+			cut := wordBoundary(text, start, start+ChunkSize)
+			spans = append(spans, domain.Chunk{Start: start, End: cut})
+			next := cut
+			if back := cut - ChunkOverlap; back > start {
+				next = wordBoundary(text, start, back)
+			}
+			start = next + len(text[next:end]) - len(strings.TrimLeftFunc(text[next:end], unicode.IsSpace))
+		}
+		spans = append(spans, domain.Chunk{Start: start, End: end})
+	}
+	return spans
+}
+
+// wordBoundary returns the offset of the last space after start and up to
+// limit, or limit moved back to a character boundary when there is none
+func wordBoundary(text string, start, limit int) int {
+	if i := strings.LastIndexAny(text[start:limit], " \n\t"); i > 0 {
+		return start + i
+	}
+	for limit > start+1 && !isRuneStart(text[limit]) {
+		limit--
+	}
+	return limit
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// EmbedChunks embeds the passages of a long text, as Chunk splits it; it
+// returns none for shorter texts
+func (s *Service) EmbedChunks(ctx context.Context, text string) ([]domain.Chunk, error) {
+	chunks := Chunk(text)
+	for start := 0; start < len(chunks); start += MaxBatchSize {
+		batch := chunks[start:min(start+MaxBatchSize, len(chunks))]
+		texts := make([]string, len(batch))
+		for i, c := range batch {
+			texts[i] = text[c.Start:c.End]
+		}
+		vectors, err := s.EmbedBatch(ctx, texts)
+		if err != nil {
+			return nil, err
+		}
+		for i := range batch {
+			batch[i].Vector = vectors[i]
+		}
+	}
+	return chunks, nil
+}
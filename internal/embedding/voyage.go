@@ -2,16 +2,35 @@ package embedding
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
+
+	"github.com/pbaille/kb/internal/cache"
+	"github.com/pbaille/kb/internal/metrics"
+	"github.com/pbaille/kb/internal/usage"
 )
 
 const voyageAPI = "https://api.voyageai.com/v1/embeddings"
 
+// MaxBatchSize is the maximum number of texts Voyage accepts per request
+const MaxBatchSize = 128
+
+// maxRetries bounds retries on rate limiting (HTTP 429)
+const maxRetries = 5
+
+var embedDuration = metrics.NewHistogram(
+	"kb_embedding_duration_seconds", "Time to embed a batch of texts, retries included",
+	metrics.DefaultBuckets, "outcome",
+)
+
 // Service handles embedding generation via Voyage AI
 type Service struct {
 	apiKey string
@@ -31,17 +50,90 @@ func New() (*Service, error) {
 	}, nil
 }
 
+// Model returns the name of the embedding model
+func (s *Service) Model() string {
+	return s.model
+}
+
 // Embed generates an embedding vector for the given text
-func (s *Service) Embed(text string) ([]float64, error) {
-	vectors, err := s.EmbedBatch([]string{text})
+func (s *Service) Embed(ctx context.Context, text string) ([]float64, error) {
+	vectors, err := s.EmbedBatch(ctx, []string{text})
 	if err != nil {
 		return nil, err
 	}
 	return vectors[0], nil
 }
 
-// EmbedBatch generates embeddings for multiple texts
-func (s *Service) EmbedBatch(texts []string) ([][]float64, error) {
+// EmbedBatch generates embeddings for multiple texts. Texts embedded
+// before come from the cache; the others are sent in one request.
+func (s *Service) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	if len(texts) > MaxBatchSize {
+		return nil, fmt.Errorf("batch of %d texts exceeds limit of %d", len(texts), MaxBatchSize)
+	}
+
+	vectors := make([][]float64, len(texts))
+	var missing []int
+	var uncached []string
+	for i, text := range texts {
+		if !cache.Get(ctx, cache.Embedding, s.model, cache.Hash(text), &vectors[i]) {
+			missing = append(missing, i)
+			uncached = append(uncached, text)
+		}
+	}
+	if len(uncached) == 0 {
+		return vectors, nil
+	}
+
+	embedded, err := s.embedRetrying(ctx, uncached)
+	if err != nil {
+		return nil, err
+	}
+	if len(embedded) != len(uncached) {
+		return nil, fmt.Errorf("got %d embeddings for %d texts", len(embedded), len(uncached))
+	}
+	for j, i := range missing {
+		vectors[i] = embedded[j]
+		cache.Put(ctx, cache.Embedding, s.model, cache.Hash(texts[i]), embedded[j])
+	}
+	return vectors, nil
+}
+
+// embedRetrying calls the API, retrying with exponential backoff when rate
+// limited
+func (s *Service) embedRetrying(ctx context.Context, texts []string) ([][]float64, error) {
+	start := time.Now()
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		vectors, err := s.embedBatch(ctx, texts)
+		var rle *RateLimitError
+		if !errors.As(err, &rle) || attempt == maxRetries {
+			embedDuration.Since(start, metrics.Outcome(err))
+			return vectors, err
+		}
+		wait := backoff
+		if rle.RetryAfter > 0 {
+			wait = rle.RetryAfter
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			embedDuration.Since(start, metrics.Outcome(ctx.Err()))
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// RateLimitError is returned when the API rejects a request with HTTP 429
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return "rate limited"
+}
+
+func (s *Service) embedBatch(ctx context.Context, texts []string) ([][]float64, error) {
 	reqBody := embeddingRequest{
 		Input: texts,
 		Model: s.model,
@@ -52,7 +144,7 @@ func (s *Service) EmbedBatch(texts []string) ([][]float64, error) {
 		return nil, fmt.Errorf("marshal request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", voyageAPI, bytes.NewReader(jsonBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", voyageAPI, bytes.NewReader(jsonBody))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -71,6 +163,14 @@ func (s *Service) EmbedBatch(texts []string) ([][]float64, error) {
 		return nil, fmt.Errorf("read response: %w", err)
 	}
 
+	if resp.StatusCode == http.StatusTooManyRequests {
+		rle := &RateLimitError{}
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			rle.RetryAfter = time.Duration(secs) * time.Second
+		}
+		return nil, rle
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("api error (status %d): %s", resp.StatusCode, string(body))
 	}
@@ -80,6 +180,12 @@ func (s *Service) EmbedBatch(texts []string) ([][]float64, error) {
 		return nil, fmt.Errorf("unmarshal response: %w", err)
 	}
 
+	usage.Record(usage.Event{
+		Service:     "voyage",
+		Model:       s.model,
+		InputTokens: apiResp.Usage.TotalTokens,
+	})
+
 	vectors := make([][]float64, len(apiResp.Data))
 	for i, d := range apiResp.Data {
 		vectors[i] = d.Embedding
@@ -117,4 +223,7 @@ type embeddingResponse struct {
 	Data []struct {
 		Embedding []float64 `json:"embedding"`
 	} `json:"data"`
+	Usage struct {
+		TotalTokens int `json:"total_tokens"`
+	} `json:"usage"`
 }
@@ -0,0 +1,41 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// ankiTagChars are the characters Anki tags can't hold
+var ankiTagChars = regexp.MustCompile(`\s+`)
+
+// WriteAnki renders entries as an Anki text import: one note per line,
+// its title on the front and its content, as HTML, on the back, with its
+// tags
+func WriteAnki(w io.Writer, entries []domain.Entry) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "#separator:tab")
+	fmt.Fprintln(bw, "#html:true")
+	fmt.Fprintln(bw, "#tags column:3")
+	for i := range entries {
+		e := &entries[i]
+		tags := make([]string, len(e.Tags))
+		for j, t := range e.Tags {
+			tags[j] = ankiTagChars.ReplaceAllString(t.Name, "_")
+		}
+		fmt.Fprintf(bw, "%s\t%s\t%s\n", ankiField(oneLine(e.DisplayTitle())), ankiField(strings.TrimSpace(e.Content)), strings.Join(tags, " "))
+	}
+	return bw.Flush()
+}
+
+// ankiField escapes text as an HTML field on one line
+func ankiField(text string) string {
+	text = html.EscapeString(text)
+	text = strings.ReplaceAll(text, "\t", " ")
+	return strings.ReplaceAll(text, "\n", "<br>")
+}
@@ -0,0 +1,113 @@
+package export
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// Document is an ordered compilation of entries, ready to render
+type Document struct {
+	Title    string
+	Sections []Section
+}
+
+// Section groups the entries of one tag; Level is its depth in the hierarchy
+type Section struct {
+	Title   string
+	Level   int
+	Entries []domain.Entry
+}
+
+// EntryCount returns the number of entries across all sections
+func (d *Document) EntryCount() int {
+	n := 0
+	for _, s := range d.Sections {
+		n += len(s.Entries)
+	}
+	return n
+}
+
+// BuildTagDocument compiles the entries under a tag (by ID, name, alias or
+// path) into a document with one section per tag, in hierarchy order. An
+// entry tagged with several tags of the subtree appears only in the first
+// section.
+func BuildTagDocument(ctx context.Context, s *store.Store, tagRef string) (*Document, error) {
+	tags, err := s.ListTags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if tag, err := s.GetTagByName(ctx, tagRef); err == nil {
+		tagRef = tag.ID
+	}
+
+	var root *domain.Tag
+	children := make(map[string][]domain.Tag)
+	for i, t := range tags {
+		if t.ID == tagRef || t.Name == tagRef {
+			root = &tags[i]
+		}
+		if t.ParentID != nil {
+			children[*t.ParentID] = append(children[*t.ParentID], t)
+		}
+	}
+	if root == nil {
+		return nil, fmt.Errorf("tag not found: %s", tagRef)
+	}
+
+	doc := &Document{Title: root.Name}
+	seen := make(map[string]bool)
+	visited := make(map[string]bool)
+
+	var walk func(t domain.Tag, level int) error
+	walk = func(t domain.Tag, level int) error {
+		// Guard against parent cycles
+		if visited[t.ID] {
+			return nil
+		}
+		visited[t.ID] = true
+
+		entries, err := s.GetEntriesByTag(ctx, t.ID, false)
+		if err != nil {
+			return err
+		}
+
+		section := Section{Title: t.Name, Level: level}
+		// Oldest first reads more naturally in a document
+		for i := len(entries) - 1; i >= 0; i-- {
+			if !seen[entries[i].ID] {
+				seen[entries[i].ID] = true
+				section.Entries = append(section.Entries, entries[i])
+			}
+		}
+		doc.Sections = append(doc.Sections, section)
+
+		for _, child := range children[t.ID] {
+			if err := walk(child, level+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(*root, 0); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// BuildCollectionDocument compiles the entries of a collection, in its
+// order, into a document with a single section
+func BuildCollectionDocument(ctx context.Context, s *store.Store, name string) (*Document, error) {
+	c, err := s.GetCollection(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.CollectionEntries(ctx, c.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &Document{Title: c.Name, Sections: []Section{{Title: c.Name, Entries: entries}}}, nil
+}
@@ -0,0 +1,166 @@
+package export
+
+import (
+	"archive/zip"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WriteEPUB renders a document as an EPUB 3 book with one chapter per section
+func WriteEPUB(w io.Writer, doc *Document) error {
+	zw := zip.NewWriter(w)
+
+	// The mimetype file must come first and be stored uncompressed
+	mt, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return fmt.Errorf("write epub: %w", err)
+	}
+	io.WriteString(mt, "application/epub+zip")
+
+	files := map[string]string{
+		"META-INF/container.xml": containerXML,
+		"OEBPS/content.opf":      epubPackage(doc),
+		"OEBPS/nav.xhtml":        epubNav(doc),
+	}
+	for i, section := range doc.Sections {
+		files[chapterFile(i)] = epubChapter(section)
+	}
+
+	// Write in a stable order
+	names := []string{"META-INF/container.xml", "OEBPS/content.opf", "OEBPS/nav.xhtml"}
+	for i := range doc.Sections {
+		names = append(names, chapterFile(i))
+	}
+	for _, name := range names {
+		f, err := zw.Create(name)
+		if err != nil {
+			return fmt.Errorf("write epub: %w", err)
+		}
+		if _, err := io.WriteString(f, files[name]); err != nil {
+			return fmt.Errorf("write epub: %w", err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("write epub: %w", err)
+	}
+	return nil
+}
+
+const containerXML = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+func chapterFile(i int) string {
+	return fmt.Sprintf("OEBPS/chapter%03d.xhtml", i+1)
+}
+
+func epubPackage(doc *Document) string {
+	var manifest, spine strings.Builder
+	for i := range doc.Sections {
+		id := fmt.Sprintf("chapter%03d", i+1)
+		fmt.Fprintf(&manifest, "    <item id=\"%s\" href=\"%s.xhtml\" media-type=\"application/xhtml+xml\"/>\n", id, id)
+		fmt.Fprintf(&spine, "    <itemref idref=\"%s\"/>\n", id)
+	}
+
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="bookid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="bookid">urn:uuid:%s</dc:identifier>
+    <dc:title>%s</dc:title>
+    <dc:language>en</dc:language>
+    <meta property="dcterms:modified">%s</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+%s  </manifest>
+  <spine>
+    <itemref idref="nav"/>
+%s  </spine>
+</package>
+`, uuid.New().String(), html.EscapeString(doc.Title), time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		manifest.String(), spine.String())
+}
+
+func epubNav(doc *Document) string {
+	var sb strings.Builder
+	sb.WriteString(xhtmlHeader(doc.Title))
+	fmt.Fprintf(&sb, "<h1>%s</h1>\n<nav epub:type=\"toc\" id=\"toc\">\n<h2>Contents</h2>\n", html.EscapeString(doc.Title))
+
+	// Nested lists following section levels; children open inside their parent's item
+	level := -1
+	for i, section := range doc.Sections {
+		if section.Level > level {
+			for ; level < section.Level; level++ {
+				sb.WriteString("\n<ol>\n")
+			}
+		} else {
+			sb.WriteString("</li>\n")
+			for ; level > section.Level; level-- {
+				sb.WriteString("</ol>\n</li>\n")
+			}
+		}
+		fmt.Fprintf(&sb, "<li><a href=\"chapter%03d.xhtml\">%s</a>", i+1, html.EscapeString(section.Title))
+	}
+	if level >= 0 {
+		sb.WriteString("</li>\n")
+		for ; level > 0; level-- {
+			sb.WriteString("</ol>\n</li>\n")
+		}
+		sb.WriteString("</ol>\n")
+	}
+
+	sb.WriteString("</nav>\n</body>\n</html>\n")
+	return sb.String()
+}
+
+func epubChapter(section Section) string {
+	var sb strings.Builder
+	sb.WriteString(xhtmlHeader(section.Title))
+	heading := min(section.Level+1, 6)
+	fmt.Fprintf(&sb, "<h%d>%s</h%d>\n", heading, html.EscapeString(section.Title), heading)
+
+	if len(section.Entries) == 0 {
+		sb.WriteString("<p><em>No entries.</em></p>\n")
+	}
+	for _, e := range section.Entries {
+		fmt.Fprintf(&sb, "<section>\n<p><small>%s</small></p>\n", e.CreatedAt.Format("January 2, 2006"))
+		for _, para := range paragraphs(e.Content) {
+			fmt.Fprintf(&sb, "<p>%s</p>\n", html.EscapeString(para))
+		}
+		sb.WriteString("<hr/>\n</section>\n")
+	}
+
+	sb.WriteString("</body>\n</html>\n")
+	return sb.String()
+}
+
+func xhtmlHeader(title string) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head><meta charset="UTF-8"/><title>%s</title></head>
+<body>
+`, html.EscapeString(title))
+}
+
+// paragraphs splits content on blank lines, collapsing single newlines
+func paragraphs(content string) []string {
+	var result []string
+	for _, block := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n\n") {
+		block = strings.Join(strings.Fields(block), " ")
+		if block != "" {
+			result = append(result, block)
+		}
+	}
+	return result
+}
@@ -0,0 +1,77 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// GraphFormats are the formats the entry and tag graph renders to
+var GraphFormats = []string{"json", "dot"}
+
+// WriteGraph renders a graph in one of GraphFormats: JSON nodes and edges
+// for D3 or Cytoscape, or a Graphviz digraph
+func WriteGraph(w io.Writer, format string, g *domain.Graph) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(g)
+	case "dot":
+		return writeDOT(w, g)
+	}
+	return fmt.Errorf("unknown format %q (use %s)", format, strings.Join(GraphFormats, ", "))
+}
+
+// dotEdgeStyles are the Graphviz attributes of each kind of edge
+var dotEdgeStyles = map[string]string{
+	domain.EdgeTagged:      `color="gray60"`,
+	domain.EdgeParent:      `color="gray40", arrowhead=empty`,
+	domain.EdgeSimilar:     `style=dashed, dir=none, color="steelblue"`,
+	domain.LinkContradicts: `color="firebrick"`,
+	domain.LinkExpands:     `color="forestgreen"`,
+}
+
+func writeDOT(w io.Writer, g *domain.Graph) error {
+	var b strings.Builder
+	b.WriteString("digraph kb {\n")
+	b.WriteString("  node [fontname=\"Helvetica\", fontsize=10];\n")
+	for _, n := range g.Nodes {
+		shape := "box"
+		if n.Kind == domain.NodeTag {
+			shape = "ellipse, style=filled, fillcolor=\"lightyellow\""
+		}
+		fmt.Fprintf(&b, "  %s [label=%s, shape=%s];\n", strconv.Quote(n.ID), strconv.Quote(dotLabel(n.Label)), shape)
+	}
+	for _, e := range g.Edges {
+		// Links are labeled with their kind, similar edges with how alike
+		// their entries are
+		var attrs []string
+		switch e.Kind {
+		case domain.EdgeTagged, domain.EdgeParent:
+		case domain.EdgeSimilar:
+			attrs = append(attrs, "label="+strconv.Quote(strconv.FormatFloat(e.Weight, 'f', 2, 64)))
+		default:
+			attrs = append(attrs, "label="+strconv.Quote(e.Kind))
+		}
+		if style, ok := dotEdgeStyles[e.Kind]; ok {
+			attrs = append(attrs, style)
+		}
+		fmt.Fprintf(&b, "  %s -> %s [%s];\n", strconv.Quote(e.Source), strconv.Quote(e.Target), strings.Join(attrs, ", "))
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// dotLabel shortens a node label to fit a graph
+func dotLabel(s string) string {
+	if r := []rune(s); len(r) > 40 {
+		return string(r[:37]) + "..."
+	}
+	return s
+}
@@ -0,0 +1,324 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/store"
+	"gopkg.in/yaml.v3"
+)
+
+// ManifestFormats are the formats a manifest target can export to
+var ManifestFormats = []string{"epub", "pdf", "markdown", "org", "json", "yaml", "anki", "backup"}
+
+// Manifest declares export targets run together by kb export --manifest
+type Manifest struct {
+	Targets []Target `yaml:"targets"`
+	// dir is where the manifest lives: relative outputs are resolved
+	// from it
+	dir string
+}
+
+// Target is one export of a manifest: the entries of a notebook (the
+// current one by default) under any of its tags, in one format. Entries
+// of encrypted notebooks are left out unless IncludeEncrypted is set, and
+// locked entries always are. A backup copies the whole database, encrypted
+// with the passphrase in the PassphraseEnv variable if Encrypt is set:
+// like kb init --encrypted, that encrypts the content of entries and their
+// past versions, while titles, URLs, tags, links and embeddings stay in
+// clear text.
+type Target struct {
+	Name             string   `yaml:"name"`
+	Format           string   `yaml:"format"`
+	Output           string   `yaml:"output"`
+	Notebook         string   `yaml:"notebook"`
+	Tags             []string `yaml:"tags"`
+	ExcludeTags      []string `yaml:"exclude_tags"`
+	Maturity         string   `yaml:"maturity"`
+	Scope            string   `yaml:"scope"`
+	IncludeEncrypted bool     `yaml:"include_encrypted"`
+	Encrypt          bool     `yaml:"encrypt"`
+	PassphraseEnv    string   `yaml:"passphrase_env"`
+}
+
+// Result is what running a target did
+type Result struct {
+	Target  string
+	Output  string
+	Entries int
+	// Hidden counts the entries left out as encrypted or locked
+	Hidden int
+	Err    error
+}
+
+// LoadManifest reads and checks a manifest file
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+	var m Manifest
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parse manifest: %w", err)
+	}
+	if len(m.Targets) == 0 {
+		return nil, fmt.Errorf("manifest has no targets")
+	}
+	m.dir = filepath.Dir(path)
+
+	names := make(map[string]bool)
+	for i := range m.Targets {
+		t := &m.Targets[i]
+		if t.Name == "" {
+			t.Name = fmt.Sprintf("target-%d", i+1)
+		}
+		if names[t.Name] {
+			return nil, fmt.Errorf("target %s: duplicate name", t.Name)
+		}
+		names[t.Name] = true
+		if !slices.Contains(ManifestFormats, t.Format) {
+			return nil, fmt.Errorf("target %s: unknown format %q (use %s)", t.Name, t.Format, strings.Join(ManifestFormats, ", "))
+		}
+		if t.Format == "backup" && (t.Notebook != "" || len(t.Tags) > 0 || len(t.ExcludeTags) > 0 || t.Maturity != "" || t.Scope != "") {
+			return nil, fmt.Errorf("target %s: a backup copies the whole database and takes no filters", t.Name)
+		}
+		if t.Encrypt && t.Format != "backup" {
+			return nil, fmt.Errorf("target %s: only backups can be encrypted", t.Name)
+		}
+		if t.Output == "" {
+			t.Output = t.Name + "." + extension(t.Format)
+		}
+		if !filepath.IsAbs(t.Output) {
+			t.Output = filepath.Join(m.dir, t.Output)
+		}
+	}
+	return &m, nil
+}
+
+func extension(format string) string {
+	switch format {
+	case "markdown":
+		return "md"
+	case "anki":
+		return "txt"
+	case "backup":
+		return "db"
+	}
+	return format
+}
+
+// Run runs every target of a manifest, going on after a failed one
+func (m *Manifest) Run(ctx context.Context, s *store.Store) []Result {
+	results := make([]Result, len(m.Targets))
+	for i, t := range m.Targets {
+		results[i] = t.run(ctx, s)
+	}
+	return results
+}
+
+func (t Target) run(ctx context.Context, s *store.Store) Result {
+	r := Result{Target: t.Name, Output: t.Output}
+	if err := os.MkdirAll(filepath.Dir(t.Output), 0o755); err != nil {
+		r.Err = fmt.Errorf("create output directory: %w", err)
+		return r
+	}
+	if t.Format == "backup" {
+		r.Entries, r.Err = t.backup(ctx, s)
+		return r
+	}
+
+	if t.Notebook != "" {
+		if _, err := s.GetNotebook(ctx, t.Notebook); err != nil {
+			r.Err = err
+			return r
+		}
+		ctx = store.WithNotebook(ctx, t.Notebook)
+	}
+	entries, hidden, err := t.entries(ctx, s)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	r.Entries, r.Hidden = len(entries), hidden
+
+	f, err := os.Create(t.Output)
+	if err != nil {
+		r.Err = fmt.Errorf("create output: %w", err)
+		return r
+	}
+	defer f.Close()
+
+	switch t.Format {
+	case "json", "yaml":
+		r.Err = WriteEntries(f, t.Format, entries)
+	case "anki":
+		r.Err = WriteAnki(f, entries)
+	default:
+		doc, err := t.document(ctx, s, entries)
+		if err != nil {
+			r.Err = err
+			return r
+		}
+		switch t.Format {
+		case "epub":
+			r.Err = WriteEPUB(f, doc)
+		case "pdf":
+			r.Err = WritePDF(f, doc)
+		case "markdown":
+			r.Err = WriteMarkdown(f, doc)
+		case "org":
+			r.Err = WriteOrg(f, doc)
+		}
+	}
+	return r
+}
+
+// entries returns the target's entries, oldest first and fully loaded,
+// with how many were left out as encrypted or locked
+func (t Target) entries(ctx context.Context, s *store.Store) ([]domain.Entry, int, error) {
+	notebooks, err := s.ListNotebooks(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	encrypted := make(map[string]bool)
+	for _, nb := range notebooks {
+		encrypted[nb.Name] = nb.Encrypted
+	}
+
+	// Tags are alternatives: one filter each
+	filters := []domain.EntryFilter{{}}
+	if len(t.Tags) > 0 {
+		filters = filters[:0]
+		for _, tag := range t.Tags {
+			filters = append(filters, domain.EntryFilter{Tags: []string{tag}})
+		}
+	}
+	seen := make(map[string]bool)
+	var entries []domain.Entry
+	hidden := 0
+	for _, f := range filters {
+		f.ExcludeTags, f.Maturity, f.Scope, f.Limit = t.ExcludeTags, t.Maturity, t.Scope, math.MaxInt32
+		matched, err := s.FilterEntries(ctx, f)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, m := range matched {
+			if seen[m.ID] {
+				continue
+			}
+			seen[m.ID] = true
+			e, err := s.GetEntry(ctx, m.ID)
+			if err != nil {
+				return nil, 0, err
+			}
+			if e.Locked || (encrypted[e.Notebook] && !t.IncludeEncrypted) {
+				hidden++
+				continue
+			}
+			entries = append(entries, *e)
+		}
+	}
+
+	// Oldest first reads more naturally in a document
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].CreatedAt.Before(entries[j].CreatedAt) })
+	return entries, hidden, nil
+}
+
+// document lays out a target's entries: one section per tag of the
+// hierarchies under its tags, or a single section without tags
+func (t Target) document(ctx context.Context, s *store.Store, entries []domain.Entry) (*Document, error) {
+	doc := &Document{Title: t.Name}
+	if len(t.Tags) == 0 {
+		doc.Sections = []Section{{Title: t.Name, Entries: entries}}
+		return doc, nil
+	}
+
+	kept := make(map[string]*domain.Entry, len(entries))
+	for i := range entries {
+		kept[entries[i].ID] = &entries[i]
+	}
+	for _, tag := range t.Tags {
+		tagDoc, err := BuildTagDocument(ctx, s, tag)
+		if err != nil {
+			return nil, err
+		}
+		for _, section := range tagDoc.Sections {
+			var sectionEntries []domain.Entry
+			for _, e := range section.Entries {
+				if full, ok := kept[e.ID]; ok {
+					sectionEntries = append(sectionEntries, *full)
+					delete(kept, e.ID)
+				}
+			}
+			if len(sectionEntries) > 0 {
+				section.Entries = sectionEntries
+				doc.Sections = append(doc.Sections, section)
+			}
+		}
+	}
+	return doc, nil
+}
+
+// backup copies the database to the target's output, encrypting the copy
+// if asked, and returns how many entries it holds. It replaces the
+// previous backup.
+func (t Target) backup(ctx context.Context, s *store.Store) (int, error) {
+	var passphrase string
+	if t.Encrypt {
+		env := t.PassphraseEnv
+		if env == "" {
+			env = "KB_BACKUP_PASSPHRASE"
+		}
+		if passphrase = os.Getenv(env); passphrase == "" {
+			return 0, fmt.Errorf("encrypted backup: set %s", env)
+		}
+	}
+
+	// The copy replaces the previous backup once complete
+	tmp := t.Output + ".tmp"
+	os.Remove(tmp)
+	if err := s.Backup(ctx, tmp); err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp)
+	entries, err := sealBackup(ctx, tmp, passphrase)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp, t.Output); err != nil {
+		return 0, fmt.Errorf("save backup: %w", err)
+	}
+	return entries, nil
+}
+
+// sealBackup encrypts a database copy with a passphrase, unless it's ""
+// or the copy is encrypted already, and returns how many entries it holds.
+// EncryptDatabase overwrites the plaintext it replaces and rebuilds the
+// file, which is opened without a WAL so that no plaintext copy is left
+// beside the backup either.
+func sealBackup(ctx context.Context, path, passphrase string) (int, error) {
+	opts := store.DefaultStoreOptions()
+	opts.JournalMode = "DELETE"
+	backup, err := store.Open(path, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer backup.Close()
+	if passphrase != "" && !backup.Encrypted() {
+		if _, err := backup.EncryptDatabase(ctx, passphrase); err != nil {
+			return 0, err
+		}
+	}
+	stats, err := backup.Stats(ctx, 0, 0)
+	if err != nil {
+		return 0, err
+	}
+	return stats.Entries, nil
+}
@@ -0,0 +1,207 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Page layout in PDF points (A5, comfortable on e-readers)
+const (
+	pdfPageWidth  = 420.0
+	pdfPageHeight = 595.0
+	pdfMargin     = 40.0
+	pdfBodySize   = 10.0
+	pdfLeading    = 1.4
+)
+
+// pdfLine is one positioned line of text
+type pdfLine struct {
+	text   string
+	size   float64
+	bold   bool
+	indent float64
+	gap    float64 // extra space above the line
+}
+
+// WritePDF renders a document as a PDF with a table of contents. Only the
+// standard Helvetica fonts are used, so characters outside Latin-1 are
+// replaced.
+func WritePDF(w io.Writer, doc *Document) error {
+	// Lay out the body first so the TOC can reference page numbers
+	var body [][]pdfLine
+	sectionPages := make([]int, len(doc.Sections))
+	for i, section := range doc.Sections {
+		var lines []pdfLine
+		size := max(pdfBodySize, 16-2*float64(section.Level))
+		lines = append(lines, wrapLine(section.Title, size, true, 0, 0)...)
+		if len(section.Entries) == 0 {
+			lines = append(lines, pdfLine{text: "No entries.", size: pdfBodySize, gap: pdfBodySize})
+		}
+		for _, e := range section.Entries {
+			lines = append(lines, pdfLine{text: e.CreatedAt.Format("January 2, 2006"), size: pdfBodySize - 2, bold: true, gap: pdfBodySize})
+			for _, para := range paragraphs(e.Content) {
+				lines = append(lines, wrapLine(para, pdfBodySize, false, 0, pdfBodySize/2)...)
+			}
+		}
+
+		// Top-level sections start on a new page
+		if section.Level <= 1 || len(body) == 0 {
+			body = append(body, nil)
+		}
+		sectionPages[i] = len(body) - 1
+		body = paginate(body, lines)
+	}
+
+	// The TOC length doesn't depend on page numbers, so lay it out once
+	// to count pages, then again with the final numbers
+	tocLines := func(offset int) []pdfLine {
+		lines := wrapLine(doc.Title, 20, true, 0, 0)
+		lines = append(lines, pdfLine{text: "Contents", size: 14, bold: true, gap: 14})
+		for i, section := range doc.Sections {
+			label := fmt.Sprintf("%s  (%d)  ....  %d", section.Title, len(section.Entries), sectionPages[i]+offset+1)
+			lines = append(lines, pdfLine{text: label, size: pdfBodySize, indent: 12 * float64(section.Level), gap: 2})
+		}
+		return lines
+	}
+	tocCount := len(paginate([][]pdfLine{nil}, tocLines(0)))
+	pages := append(paginate([][]pdfLine{nil}, tocLines(tocCount)), body...)
+
+	return writePDFPages(w, doc.Title, pages)
+}
+
+// wrapLine breaks text into lines that fit the page width
+func wrapLine(text string, size float64, bold bool, indent, gap float64) []pdfLine {
+	maxWidth := pdfPageWidth - 2*pdfMargin - indent
+	var lines []pdfLine
+	var current string
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if current != "" {
+			candidate = current + " " + word
+		}
+		if current != "" && textWidth(candidate, size) > maxWidth {
+			lines = append(lines, pdfLine{text: current, size: size, bold: bold, indent: indent})
+			current = word
+			continue
+		}
+		current = candidate
+	}
+	if current != "" {
+		lines = append(lines, pdfLine{text: current, size: size, bold: bold, indent: indent})
+	}
+	if len(lines) > 0 {
+		lines[0].gap = gap
+	}
+	return lines
+}
+
+// textWidth approximates Helvetica's average glyph width
+func textWidth(text string, size float64) float64 {
+	return float64(len([]rune(text))) * size * 0.5
+}
+
+// paginate appends lines to the last page, starting new pages as they fill up
+func paginate(pages [][]pdfLine, lines []pdfLine) [][]pdfLine {
+	used := 0.0
+	for _, l := range pages[len(pages)-1] {
+		used += l.gap + l.size*pdfLeading
+	}
+	for _, l := range lines {
+		height := l.gap + l.size*pdfLeading
+		if used+height > pdfPageHeight-2*pdfMargin && used > 0 {
+			pages = append(pages, nil)
+			used = 0
+			l.gap = 0
+			height = l.size * pdfLeading
+		}
+		pages[len(pages)-1] = append(pages[len(pages)-1], l)
+		used += height
+	}
+	return pages
+}
+
+// writePDFPages serializes laid-out pages into a PDF file
+func writePDFPages(w io.Writer, title string, pages [][]pdfLine) error {
+	var buf bytes.Buffer
+	var offsets []int
+
+	obj := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	// Fixed objects: 1 catalog, 2 page tree, 3-4 fonts, 5 info; pages follow
+	const firstPage = 6
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	obj(fmt.Sprintf("<< /Title %s /Producer (kb) >>", pdfString(title)))
+
+	for i, page := range pages {
+		var content strings.Builder
+		y := pdfPageHeight - pdfMargin
+		for _, l := range page {
+			y -= l.gap + l.size*pdfLeading
+			font := "F1"
+			if l.bold {
+				font = "F2"
+			}
+			fmt.Fprintf(&content, "BT /%s %.1f Tf %.1f %.1f Td %s Tj ET\n", font, l.size, pdfMargin+l.indent, y, pdfString(l.text))
+		}
+		// Page number footer
+		fmt.Fprintf(&content, "BT /F1 8 Tf %.1f %.1f Td (%d) Tj ET\n", pdfPageWidth/2, pdfMargin/2, i+1)
+
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, firstPage+2*i+1))
+		stream := strings.TrimSuffix(content.String(), "\n")
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("write pdf: %w", err)
+	}
+	return nil
+}
+
+// pdfString encodes text as a Latin-1 PDF literal string
+func pdfString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('(')
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case r == '‘' || r == '’':
+			sb.WriteByte('\'')
+		case r == '“' || r == '”':
+			sb.WriteByte('"')
+		case r == '–' || r == '—':
+			sb.WriteByte('-')
+		case r >= 0x20 && r < 0x7f:
+			sb.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&sb, "\\%03o", r)
+		default:
+			sb.WriteByte('?')
+		}
+	}
+	sb.WriteByte(')')
+	return sb.String()
+}
@@ -0,0 +1,237 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/pbaille/kb/internal/domain"
+	"gopkg.in/yaml.v3"
+)
+
+// EntryFormats are the text formats entries render to, for kb show and
+// kb list
+var EntryFormats = []string{"json", "yaml", "markdown", "org"}
+
+// WriteEntry renders one entry in one of EntryFormats
+func WriteEntry(w io.Writer, format string, e *domain.Entry) error {
+	switch format {
+	case "json", "yaml":
+		return writeData(w, format, e)
+	case "markdown":
+		return writeMarkdownEntry(w, e, 1)
+	case "org":
+		return writeOrgEntry(w, e, 1)
+	}
+	return unknownFormat(format)
+}
+
+// WriteEntries renders entries in one of EntryFormats: an array in JSON
+// and YAML, one heading per entry in Markdown and Org
+func WriteEntries(w io.Writer, format string, entries []domain.Entry) error {
+	switch format {
+	case "json", "yaml":
+		if entries == nil {
+			entries = []domain.Entry{}
+		}
+		return writeData(w, format, entries)
+	case "markdown", "org":
+		for i := range entries {
+			if i > 0 && format == "markdown" {
+				fmt.Fprintln(w)
+			}
+			if err := WriteEntry(w, format, &entries[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return unknownFormat(format)
+}
+
+func unknownFormat(format string) error {
+	return fmt.Errorf("unknown format %q (use %s)", format, strings.Join(EntryFormats, ", "))
+}
+
+// writeData writes v as JSON or YAML. YAML is converted from the JSON
+// encoding, so both use the same field names and order.
+func writeData(w io.Writer, format string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	if format == "json" {
+		_, err := fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return fmt.Errorf("convert to yaml: %w", err)
+	}
+	blockStyle(&node)
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return fmt.Errorf("write yaml: %w", err)
+	}
+	return enc.Close()
+}
+
+// blockStyle drops the flow style and quotes JSON parses into, letting
+// the encoder pick the usual YAML layout
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, child := range n.Content {
+		blockStyle(child)
+	}
+}
+
+// WriteMarkdown renders a document as Markdown: sections and entries as
+// nested headings
+func WriteMarkdown(w io.Writer, doc *Document) error {
+	fmt.Fprintf(w, "# %s\n", doc.Title)
+	for _, section := range doc.Sections {
+		level := min(section.Level+2, 6)
+		fmt.Fprintf(w, "\n%s %s\n", strings.Repeat("#", level), section.Title)
+		for i := range section.Entries {
+			fmt.Fprintln(w)
+			if err := writeMarkdownEntry(w, &section.Entries[i], min(level+1, 6)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteOrg renders a document as an Org file: sections and entries as
+// nested headlines
+func WriteOrg(w io.Writer, doc *Document) error {
+	fmt.Fprintf(w, "#+TITLE: %s\n", doc.Title)
+	for _, section := range doc.Sections {
+		fmt.Fprintf(w, "\n%s %s\n", strings.Repeat("*", section.Level+1), section.Title)
+		for i := range section.Entries {
+			if err := writeOrgEntry(w, &section.Entries[i], section.Level+2); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writeMarkdownEntry(w io.Writer, e *domain.Entry, level int) error {
+	fmt.Fprintf(w, "%s %s\n\n", strings.Repeat("#", level), oneLine(e.DisplayTitle()))
+	fmt.Fprintf(w, "- ID: `%s`\n", e.ID)
+	fmt.Fprintf(w, "- Created: %s\n", e.CreatedAt.Format("2006-01-02 15:04"))
+	if e.Source.URL != "" {
+		fmt.Fprintf(w, "- Source: <%s>\n", e.Source.URL)
+	} else {
+		fmt.Fprintf(w, "- Source: %s\n", e.Source.Type)
+	}
+	if e.Source.Author != "" {
+		fmt.Fprintf(w, "- Author: %s\n", e.Source.Author)
+	}
+	fmt.Fprintf(w, "- Stage: %s\n", e.Maturity)
+	if len(e.Tags) > 0 {
+		names := make([]string, len(e.Tags))
+		for i, t := range e.Tags {
+			names[i] = "#" + t.Name
+		}
+		fmt.Fprintf(w, "- Tags: %s\n", strings.Join(names, " "))
+	}
+	sections := domain.ParseSections(e.Content)
+	if len(sections) == 0 {
+		_, err := fmt.Fprintf(w, "\n%s\n", strings.TrimSpace(e.Content))
+		return err
+	}
+	for _, section := range sections {
+		if section.Heading != "" {
+			fmt.Fprintf(w, "\n%s %s\n", strings.Repeat("#", min(level+1, 6)), section.Heading)
+		}
+		if _, err := fmt.Fprintf(w, "\n%s\n", section.Text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orgTagChars are the characters Org allows in tags
+var orgTagChars = regexp.MustCompile(`[^\pL\pN_@#%]`)
+
+func writeOrgEntry(w io.Writer, e *domain.Entry, level int) error {
+	headline := strings.Repeat("*", level) + " " + oneLine(e.DisplayTitle())
+	if len(e.Tags) > 0 {
+		names := make([]string, len(e.Tags))
+		for i, t := range e.Tags {
+			names[i] = orgTagChars.ReplaceAllString(t.Name, "_")
+		}
+		headline += " :" + strings.Join(names, ":") + ":"
+	}
+	fmt.Fprintln(w, headline)
+
+	fmt.Fprintln(w, ":PROPERTIES:")
+	fmt.Fprintf(w, ":ID:       %s\n", e.ID)
+	fmt.Fprintf(w, ":CREATED:  [%s]\n", e.CreatedAt.Format("2006-01-02 Mon 15:04"))
+	if e.Source.URL != "" {
+		fmt.Fprintf(w, ":SOURCE:   %s\n", e.Source.URL)
+	} else {
+		fmt.Fprintf(w, ":SOURCE:   %s\n", e.Source.Type)
+	}
+	if e.Source.Author != "" {
+		fmt.Fprintf(w, ":AUTHOR:   %s\n", e.Source.Author)
+	}
+	fmt.Fprintf(w, ":STAGE:    %s\n", e.Maturity)
+	fmt.Fprintln(w, ":END:")
+
+	sections := domain.ParseSections(e.Content)
+	if len(sections) == 0 {
+		_, err := fmt.Fprintf(w, "\n%s\n", orgBody(e.Content))
+		return err
+	}
+	for _, section := range sections {
+		if section.Heading != "" {
+			fmt.Fprintf(w, "%s %s\n", strings.Repeat("*", level+1), section.Heading)
+		}
+		body := section.Text
+		if section.Kind == domain.SectionHighlights {
+			body = orgQuotes(body)
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", orgBody(body)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orgBody escapes text for an Org entry body: a line starting with a star
+// would read as a headline
+func orgBody(text string) string {
+	var body strings.Builder
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		if strings.HasPrefix(line, "*") {
+			body.WriteString(" ")
+		}
+		body.WriteString(line + "\n")
+	}
+	return body.String()
+}
+
+// orgQuotes turns Markdown blockquotes into Org quote blocks
+func orgQuotes(text string) string {
+	var out []string
+	for _, quote := range strings.Split(text, "\n\n") {
+		lines := strings.Split(quote, "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimPrefix(strings.TrimPrefix(line, ">"), " ")
+		}
+		out = append(out, "#+BEGIN_QUOTE\n"+strings.Join(lines, "\n")+"\n#+END_QUOTE")
+	}
+	return strings.Join(out, "\n")
+}
+
+// oneLine collapses whitespace so text fits on a heading line
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
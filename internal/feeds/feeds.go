@@ -0,0 +1,305 @@
+package feeds
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// Feed is a parsed RSS or Atom feed
+type Feed struct {
+	Title string
+	// URL is the feed's own URL, which differs from the requested one when
+	// a web page pointed to it
+	URL   string
+	Items []Item
+}
+
+// Item is one feed entry. Content may be HTML.
+type Item struct {
+	GUID      string
+	Title     string
+	Link      string
+	Author    string
+	Published *time.Time
+	Content   string
+}
+
+// dateLayouts are the date formats seen in RSS and Atom feeds
+var dateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02",
+}
+
+// Fetch retrieves and parses a feed. A web page URL is followed to the
+// feed it advertises.
+func Fetch(ctx context.Context, rawURL string) (*Feed, error) {
+	data, finalURL, err := get(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	feed, err := Parse(data)
+	if err == nil {
+		feed.URL = finalURL
+		return feed, nil
+	}
+
+	// Maybe a web page advertising its feed
+	alt := discover(data, finalURL)
+	if alt == "" {
+		return nil, err
+	}
+	if data, finalURL, err = get(ctx, alt); err != nil {
+		return nil, err
+	}
+	if feed, err = Parse(data); err != nil {
+		return nil, err
+	}
+	feed.URL = finalURL
+	return feed, nil
+}
+
+func get(ctx context.Context, rawURL string) ([]byte, string, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("User-Agent", "kb/1.0 (knowledge-base)")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("fetch: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 10*1024*1024))
+	if err != nil {
+		return nil, "", fmt.Errorf("read body: %w", err)
+	}
+	return data, resp.Request.URL.String(), nil
+}
+
+type xmlLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Text string `xml:",chardata"`
+}
+
+type rssItem struct {
+	GUID        string    `xml:"guid"`
+	Title       string    `xml:"title"`
+	Links       []xmlLink `xml:"link"`
+	Author      string    `xml:"author"`
+	Creator     string    `xml:"creator"`
+	PubDate     string    `xml:"pubDate"`
+	Date        string    `xml:"date"`
+	Description string    `xml:"description"`
+	Encoded     string    `xml:"encoded"`
+	About       string    `xml:"about,attr"`
+}
+
+type atomEntry struct {
+	ID        string    `xml:"id"`
+	Title     string    `xml:"title"`
+	Links     []xmlLink `xml:"link"`
+	Author    string    `xml:"author>name"`
+	Published string    `xml:"published"`
+	Updated   string    `xml:"updated"`
+	Summary   string    `xml:"summary"`
+	Content   string    `xml:"content"`
+}
+
+// document covers RSS 2.0 (<rss><channel>), RSS 1.0 (<rdf:RDF>, items
+// beside the channel) and Atom (<feed>)
+type document struct {
+	XMLName xml.Name
+	Channel struct {
+		Title string    `xml:"title"`
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	Items   []rssItem   `xml:"item"`
+	Title   string      `xml:"title"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// Parse reads an RSS 2.0, RSS 1.0 or Atom document
+func Parse(data []byte) (*Feed, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	dec.CharsetReader = charsetReader
+
+	var doc document
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parse feed: %w", err)
+	}
+
+	feed := &Feed{}
+	switch strings.ToLower(doc.XMLName.Local) {
+	case "rss", "rdf":
+		feed.Title = strings.TrimSpace(doc.Channel.Title)
+		for _, it := range append(doc.Channel.Items, doc.Items...) {
+			feed.Items = append(feed.Items, it.item())
+		}
+	case "feed":
+		feed.Title = strings.TrimSpace(doc.Title)
+		for _, e := range doc.Entries {
+			feed.Items = append(feed.Items, e.item())
+		}
+	default:
+		return nil, fmt.Errorf("not a feed: <%s> document", doc.XMLName.Local)
+	}
+	return feed, nil
+}
+
+func (it rssItem) item() Item {
+	item := Item{
+		Title:   strings.TrimSpace(it.Title),
+		Author:  strings.TrimSpace(firstNonEmpty(it.Creator, it.Author)),
+		Content: strings.TrimSpace(firstNonEmpty(it.Encoded, it.Description)),
+	}
+	for _, l := range it.Links {
+		if link := strings.TrimSpace(firstNonEmpty(l.Text, l.Href)); link != "" {
+			item.Link = link
+			break
+		}
+	}
+	item.Published = parseDate(firstNonEmpty(it.PubDate, it.Date))
+	item.GUID = itemGUID(firstNonEmpty(it.GUID, it.About), item)
+	return item
+}
+
+func (e atomEntry) item() Item {
+	item := Item{
+		Title:   strings.TrimSpace(e.Title),
+		Author:  strings.TrimSpace(e.Author),
+		Content: strings.TrimSpace(firstNonEmpty(e.Content, e.Summary)),
+	}
+	for _, l := range e.Links {
+		if l.Rel == "" || l.Rel == "alternate" {
+			item.Link = strings.TrimSpace(l.Href)
+			break
+		}
+	}
+	item.Published = parseDate(firstNonEmpty(e.Published, e.Updated))
+	item.GUID = itemGUID(e.ID, item)
+	return item
+}
+
+// itemGUID falls back to the link, then the title and date, for feeds
+// whose items have no identifier
+func itemGUID(guid string, item Item) string {
+	if guid = strings.TrimSpace(guid); guid != "" {
+		return guid
+	}
+	if item.Link != "" {
+		return item.Link
+	}
+	if item.Published != nil {
+		return item.Title + "@" + item.Published.UTC().Format(time.RFC3339)
+	}
+	return item.Title
+}
+
+func parseDate(v string) *time.Time {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return nil
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, v); err == nil {
+			return &t
+		}
+	}
+	return nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// charsetReader decodes the legacy charsets common in old feeds
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "utf-8", "utf8", "us-ascii", "ascii":
+		return input, nil
+	case "iso-8859-1", "latin1", "latin-1", "windows-1252":
+		data, err := io.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return strings.NewReader(string(runes)), nil
+	}
+	return nil, fmt.Errorf("unsupported charset: %s", charset)
+}
+
+// discover returns the feed URL advertised by an HTML page, if any
+func discover(data []byte, pageURL string) string {
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return ""
+	}
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return ""
+	}
+
+	var found string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if found != "" {
+			return
+		}
+		if n.Type == html.ElementNode && n.Data == "link" {
+			var rel, typ, href string
+			for _, a := range n.Attr {
+				switch a.Key {
+				case "rel":
+					rel = strings.ToLower(a.Val)
+				case "type":
+					typ = strings.ToLower(a.Val)
+				case "href":
+					href = a.Val
+				}
+			}
+			if rel == "alternate" && (typ == "application/rss+xml" || typ == "application/atom+xml") && href != "" {
+				if u, err := base.Parse(href); err == nil {
+					found = u.String()
+				}
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return found
+}
@@ -0,0 +1,67 @@
+package fetcher
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// trackingParams are query parameters that don't change the linked page
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"ref":     true,
+	"ref_src": true,
+	"igshid":  true,
+	"si":      true,
+}
+
+// CanonicalURL normalizes a URL so links to the same article from different
+// feeds and newsletters compare equal: scheme and host are lowercased, http
+// made https (sites serve both, and links mix them), "www.", default ports
+// and the fragment are dropped, tracking parameters removed, the remaining
+// query sorted and any trailing slash trimmed.
+func CanonicalURL(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" {
+		return strings.TrimSpace(rawURL)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	if u.Scheme == "http" {
+		u.Host = strings.TrimSuffix(u.Host, ":80")
+		u.Scheme = "https"
+	}
+	if u.Scheme == "https" {
+		u.Host = strings.TrimSuffix(u.Host, ":443")
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+	u.User = nil
+
+	q := u.Query()
+	for key := range q {
+		if trackingParams[strings.ToLower(key)] || strings.HasPrefix(strings.ToLower(key), "utm_") {
+			q.Del(key)
+		}
+	}
+	keys := make([]string, 0, len(q))
+	for key := range q {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, key := range keys {
+		for _, v := range q[key] {
+			parts = append(parts, url.QueryEscape(key)+"="+url.QueryEscape(v))
+		}
+	}
+	u.RawQuery = strings.Join(parts, "&")
+
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawPath = ""
+	return u.String()
+}
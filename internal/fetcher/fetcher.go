@@ -1,6 +1,8 @@
 package fetcher
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -8,55 +10,135 @@ import (
 	"strings"
 	"time"
 
+	"github.com/pbaille/kb/internal/domain"
 	"golang.org/x/net/html"
 )
 
-// Fetch retrieves URL content and extracts readable text
-func Fetch(rawURL string) (string, error) {
+// maxTextLength bounds the extracted text kept for an entry
+const maxTextLength = 10 * 1024
+
+// FetchResult is the readable text of a page along with its display metadata
+type FetchResult struct {
+	Title       string
+	Text        string
+	Description string
+	Author      string
+	PublishedAt *time.Time
+	// CanonicalURL is the page's declared canonical URL, or the final URL
+	// after redirects
+	CanonicalURL string
+	// Pages is the page count of PDF documents
+	Pages int
+	// Truncated is set when pages or text were left out
+	Truncated bool
+}
+
+// Capture returns the page as a URL capture, to lay out in sections
+func (r *FetchResult) Capture() *domain.URLCapture {
+	return &domain.URLCapture{
+		URL:         CanonicalURL(r.CanonicalURL),
+		Author:      r.Author,
+		PublishedAt: r.PublishedAt,
+		Description: r.Description,
+		Text:        r.Text,
+	}
+}
+
+// Fetch retrieves URL content and extracts readable text and metadata
+func Fetch(ctx context.Context, rawURL string) (*FetchResult, error) {
+	return FetchWithOptions(ctx, rawURL, DefaultOptions())
+}
+
+// FetchWithOptions is Fetch with control over how much text is extracted.
+// HTML pages, PDF documents and YouTube videos are supported.
+func FetchWithOptions(ctx context.Context, rawURL string, opts Options) (*FetchResult, error) {
 	// Validate URL
 	u, err := url.Parse(rawURL)
 	if err != nil {
-		return "", fmt.Errorf("invalid URL: %w", err)
+		return nil, fmt.Errorf("invalid URL: %w", err)
 	}
 	if u.Scheme == "" {
 		u.Scheme = "https"
 	}
 	if u.Scheme != "http" && u.Scheme != "https" {
-		return "", fmt.Errorf("unsupported scheme: %s", u.Scheme)
+		return nil, fmt.Errorf("unsupported scheme: %s", u.Scheme)
 	}
 
 	// Fetch with timeout
 	client := &http.Client{Timeout: 30 * time.Second}
-	req, err := http.NewRequest("GET", u.String(), nil)
+
+	// Videos are saved as their transcript
+	if id, ok := YouTubeVideoID(u.String()); ok {
+		return fetchYouTube(ctx, client, id, opts)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
 	if err != nil {
-		return "", fmt.Errorf("create request: %w", err)
+		return nil, fmt.Errorf("create request: %w", err)
 	}
 	req.Header.Set("User-Agent", "kb/1.0 (knowledge-base)")
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("fetch: %w", err)
+		return nil, fmt.Errorf("fetch: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+	}
+
+	contentType := strings.ToLower(resp.Header.Get("Content-Type"))
+	pdfExpected := strings.Contains(contentType, "application/pdf") ||
+		strings.HasSuffix(strings.ToLower(resp.Request.URL.Path), ".pdf")
+
+	// Read body with size limit (5MB for pages, more for PDFs)
+	limit := int64(5 * 1024 * 1024)
+	if pdfExpected {
+		limit = maxPDFSize
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit))
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+
+	if IsPDF(body) {
+		result, err := ExtractPDF(body, opts)
+		if err != nil {
+			return nil, err
+		}
+		result.CanonicalURL = resp.Request.URL.String()
+		return result, nil
 	}
 
-	// Read body with size limit (5MB)
-	limited := io.LimitReader(resp.Body, 5*1024*1024)
-	body, err := io.ReadAll(limited)
+	doc, err := html.Parse(bytes.NewReader(body))
 	if err != nil {
-		return "", fmt.Errorf("read body: %w", err)
+		return nil, fmt.Errorf("parse html: %w", err)
 	}
 
-	// Extract text from HTML
-	text := extractText(string(body))
+	// Metadata first: article extraction prunes the tree
+	result := extractMetadata(doc, resp.Request.URL)
+
+	// Prefer the article body, falling back to all page text
+	text := extractArticle(doc)
+	if text == "" {
+		text = extractText(doc)
+	}
 	if text == "" {
-		return "", fmt.Errorf("no text content found")
+		return nil, fmt.Errorf("no text content found")
 	}
 
-	return text, nil
+	maxChars := opts.MaxChars
+	if maxChars <= 0 {
+		maxChars = maxTextLength
+	}
+	if len(text) > maxChars {
+		text = text[:maxChars] + "..."
+		result.Truncated = true
+	}
+
+	result.Text = text
+	return result, nil
 }
 
 // IsURL checks if a string looks like a URL
@@ -67,13 +149,36 @@ func IsURL(s string) bool {
 		strings.HasPrefix(s, "www.")
 }
 
-// extractText parses HTML and returns readable text content
-func extractText(htmlContent string) string {
-	doc, err := html.Parse(strings.NewReader(htmlContent))
+// HTMLText returns the readable text of an HTML fragment, such as a feed
+// item's content or a clipped selection, one paragraph per block
+func HTMLText(fragment string) string {
+	doc, err := html.Parse(strings.NewReader(fragment))
 	if err != nil {
 		return ""
 	}
+	return strings.Join(blockText(doc), "\n\n")
+}
 
+// ArticleText returns the readable text of an HTML document, such as a
+// newsletter, extracted like fetched pages: the article when one stands
+// out, else all its text
+func ArticleText(page string) string {
+	doc, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		return ""
+	}
+	text := extractArticle(doc)
+	if text == "" {
+		text = extractText(doc)
+	}
+	if len(text) > maxTextLength {
+		text = text[:maxTextLength] + "..."
+	}
+	return text
+}
+
+// extractText returns the readable text content of a parsed page
+func extractText(doc *html.Node) string {
 	var sb strings.Builder
 	var extract func(*html.Node)
 
@@ -81,7 +186,7 @@ func extractText(htmlContent string) string {
 	skipTags := map[string]bool{
 		"script": true, "style": true, "nav": true,
 		"header": true, "footer": true, "aside": true,
-		"noscript": true, "iframe": true,
+		"noscript": true, "iframe": true, "title": true,
 	}
 
 	extract = func(n *html.Node) {
@@ -116,10 +221,5 @@ func extractText(htmlContent string) string {
 	result := sb.String()
 	result = strings.Join(strings.Fields(result), " ")
 
-	// Truncate if too long (keep first 10KB of text)
-	if len(result) > 10*1024 {
-		result = result[:10*1024] + "..."
-	}
-
 	return strings.TrimSpace(result)
 }
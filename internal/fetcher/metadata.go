@@ -0,0 +1,126 @@
+package fetcher
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// publishedLayouts are the date formats seen in publish-time meta tags
+var publishedLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+// extractMetadata reads title, description, author, publish date and
+// canonical URL from a page's head, preferring OpenGraph and article tags
+func extractMetadata(doc *html.Node, pageURL *url.URL) *FetchResult {
+	meta := make(map[string]string)
+	var title, canonical, timeAttr string
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "title":
+				if title == "" && n.FirstChild != nil {
+					title = n.FirstChild.Data
+				}
+			case "meta":
+				key := strings.ToLower(attr(n, "property"))
+				if key == "" {
+					key = strings.ToLower(attr(n, "name"))
+				}
+				if key == "" {
+					key = strings.ToLower(attr(n, "itemprop"))
+				}
+				// Keep the first occurrence of each key
+				if _, ok := meta[key]; key != "" && !ok {
+					meta[key] = strings.TrimSpace(attr(n, "content"))
+				}
+			case "link":
+				if canonical == "" && strings.EqualFold(attr(n, "rel"), "canonical") {
+					canonical = attr(n, "href")
+				}
+			case "time":
+				if timeAttr == "" {
+					timeAttr = attr(n, "datetime")
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	result := &FetchResult{
+		Title:       firstNonEmpty(meta["og:title"], meta["twitter:title"], title),
+		Description: firstNonEmpty(meta["og:description"], meta["description"], meta["twitter:description"]),
+		Author:      firstNonEmpty(meta["author"], meta["article:author"], meta["twitter:creator"]),
+	}
+	result.Title = strings.Join(strings.Fields(result.Title), " ")
+
+	// article:author is often a profile URL rather than a name
+	if strings.HasPrefix(result.Author, "http") {
+		result.Author = ""
+	}
+
+	for _, v := range []string{meta["article:published_time"], meta["datepublished"], meta["date"], meta["pubdate"], timeAttr} {
+		if t, ok := parsePublished(v); ok {
+			result.PublishedAt = &t
+			break
+		}
+	}
+
+	result.CanonicalURL = pageURL.String()
+	for _, ref := range []string{canonical, meta["og:url"]} {
+		if ref == "" {
+			continue
+		}
+		if u, err := pageURL.Parse(ref); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+			result.CanonicalURL = u.String()
+			break
+		}
+	}
+
+	return result
+}
+
+func parsePublished(v string) (time.Time, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range publishedLayouts {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
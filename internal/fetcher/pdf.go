@@ -0,0 +1,124 @@
+package fetcher
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// maxPDFSize bounds how much of a PDF response is downloaded
+const maxPDFSize = 25 * 1024 * 1024
+
+// Options controls how much text is extracted from a fetched document
+type Options struct {
+	// MaxPages limits how many PDF pages are read (0 means all)
+	MaxPages int
+	// MaxChars limits the extracted text length (0 means the default)
+	MaxChars int
+}
+
+// DefaultOptions reads up to 50 PDF pages and keeps the default text length
+func DefaultOptions() Options {
+	return Options{MaxPages: 50, MaxChars: maxTextLength}
+}
+
+// IsPDF reports whether data looks like a PDF document
+func IsPDF(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("%PDF-"))
+}
+
+// ExtractPDF extracts the text and document info of a PDF
+func ExtractPDF(data []byte, opts Options) (result *FetchResult, err error) {
+	// The parser panics on some malformed files
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, fmt.Errorf("parse pdf: %v", r)
+		}
+	}()
+
+	r, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("parse pdf: %w", err)
+	}
+
+	info := r.Trailer().Key("Info")
+	result = &FetchResult{
+		Title:  strings.TrimSpace(info.Key("Title").Text()),
+		Author: strings.TrimSpace(info.Key("Author").Text()),
+		Pages:  r.NumPage(),
+	}
+	if t, ok := parsePDFDate(info.Key("CreationDate").Text()); ok {
+		result.PublishedAt = &t
+	}
+
+	maxChars := opts.MaxChars
+	if maxChars <= 0 {
+		maxChars = maxTextLength
+	}
+	pages := result.Pages
+	if opts.MaxPages > 0 && pages > opts.MaxPages {
+		pages = opts.MaxPages
+		result.Truncated = true
+	}
+
+	var sb strings.Builder
+	fonts := make(map[string]*pdf.Font)
+	for i := 1; i <= pages; i++ {
+		p := r.Page(i)
+		if p.V.IsNull() {
+			continue
+		}
+		for _, name := range p.Fonts() {
+			if _, ok := fonts[name]; !ok {
+				f := p.Font(name)
+				fonts[name] = &f
+			}
+		}
+		text, err := p.GetPlainText(fonts)
+		if err != nil {
+			continue
+		}
+		if text = strings.TrimSpace(text); text != "" {
+			sb.WriteString(text)
+			sb.WriteString("\n\n")
+		}
+		if sb.Len() >= maxChars {
+			result.Truncated = result.Truncated || i < result.Pages
+			break
+		}
+	}
+
+	text := strings.TrimSpace(sb.String())
+	if len(text) > maxChars {
+		text = text[:maxChars] + "..."
+		result.Truncated = true
+	}
+	if text == "" {
+		return nil, fmt.Errorf("no text found in pdf (scanned document?)")
+	}
+	result.Text = text
+	return result, nil
+}
+
+// parsePDFDate parses PDF dates like "D:20240301120000+01'00'"
+func parsePDFDate(s string) (t time.Time, ok bool) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "D:")
+	if len(s) < 8 {
+		return time.Time{}, false
+	}
+	s = strings.ReplaceAll(s, "'", "")
+	for _, layout := range []string{"20060102150405Z0700", "20060102150405Z", "20060102150405", "20060102"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+		if len(s) > len(layout) {
+			if t, err := time.Parse(layout, s[:len(layout)]); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
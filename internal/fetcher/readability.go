@@ -0,0 +1,263 @@
+package fetcher
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Readability-style extraction, after Arc90: paragraphs score their
+// ancestors by text length and comma count, class/id names nudge scores
+// up or down, link-heavy blocks are penalized, and the best candidate plus
+// related siblings form the article.
+
+var (
+	unlikelyCandidates = regexp.MustCompile(`(?i)banner|breadcrumbs|combx|comment|community|cookie|disqus|extra|footer|header|menu|modal|nav|newsletter|popup|promo|related|remark|replies|rss|share|shoutbox|sidebar|skyscraper|social|sponsor|subscribe|ad-break|agegate|pagination|pager`)
+	maybeCandidate     = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+	positiveNames      = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|post|text|blog|story`)
+	negativeNames      = regexp.MustCompile(`(?i)hidden|banner|combx|comment|com-|contact|foot|footer|footnote|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget`)
+)
+
+// minArticleLength is the shortest extraction trusted over the plain-text fallback
+const minArticleLength = 250
+
+// scoredTags are the elements whose text contributes to ancestor scores
+var scoredTags = map[string]bool{"p": true, "pre": true, "td": true, "blockquote": true, "section": true, "h2": true, "h3": true}
+
+// extractArticle returns the main article text of a page, or "" if no
+// convincing candidate is found
+func extractArticle(doc *html.Node) string {
+	body := findElement(doc, "body")
+	if body == nil {
+		return ""
+	}
+	pruneUnlikely(body)
+
+	scores := make(map[*html.Node]float64)
+	var candidates []*html.Node
+	addScore := func(n *html.Node, score float64) {
+		if n == nil || n.Type != html.ElementNode {
+			return
+		}
+		if _, ok := scores[n]; !ok {
+			scores[n] = initialScore(n)
+			candidates = append(candidates, n)
+		}
+		scores[n] += score
+	}
+
+	walkElements(body, func(n *html.Node) {
+		if !scoredTags[n.Data] {
+			return
+		}
+		text := innerText(n)
+		if len(text) < 25 {
+			return
+		}
+		score := 1 + float64(strings.Count(text, ",")) + min(float64(len(text))/100, 3)
+		addScore(n.Parent, score)
+		if n.Parent != nil {
+			addScore(n.Parent.Parent, score/2)
+		}
+	})
+
+	var top *html.Node
+	for _, c := range candidates {
+		scores[c] *= 1 - linkDensity(c)
+		if top == nil || scores[c] > scores[top] {
+			top = c
+		}
+	}
+	if top == nil {
+		return ""
+	}
+
+	// Siblings that score well or read like prose belong to the article too
+	threshold := max(10, scores[top]*0.2)
+	var parts []string
+	nodes := []*html.Node{top}
+	if top.Parent != nil {
+		nodes = nil
+		for sib := top.Parent.FirstChild; sib != nil; sib = sib.NextSibling {
+			if sib.Type != html.ElementNode {
+				continue
+			}
+			include := sib == top
+			if score, ok := scores[sib]; ok && score >= threshold {
+				include = true
+			}
+			if sib.Data == "p" {
+				text := innerText(sib)
+				if len(text) > 80 && linkDensity(sib) < 0.25 {
+					include = true
+				}
+			}
+			if include {
+				nodes = append(nodes, sib)
+			}
+		}
+	}
+	for _, n := range nodes {
+		parts = append(parts, blockText(n)...)
+	}
+
+	article := strings.Join(parts, "\n\n")
+	if len(article) < minArticleLength {
+		return ""
+	}
+	return article
+}
+
+// pruneUnlikely removes elements whose class or id marks them as boilerplate
+func pruneUnlikely(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.ElementNode {
+			names := attr(c, "class") + " " + attr(c, "id")
+			switch {
+			case skipElement(c):
+				n.RemoveChild(c)
+			case c.Data != "body" && c.Data != "article" && c.Data != "main" &&
+				unlikelyCandidates.MatchString(names) && !maybeCandidate.MatchString(names):
+				n.RemoveChild(c)
+			default:
+				pruneUnlikely(c)
+			}
+		}
+		c = next
+	}
+}
+
+func skipElement(n *html.Node) bool {
+	switch n.Data {
+	case "script", "style", "noscript", "iframe", "nav", "aside", "footer", "form", "button", "svg", "title":
+		return true
+	}
+	return false
+}
+
+func initialScore(n *html.Node) float64 {
+	var score float64
+	switch n.Data {
+	case "article":
+		score = 10
+	case "div", "main":
+		score = 5
+	case "pre", "td", "blockquote":
+		score = 3
+	case "address", "ol", "ul", "dl", "dd", "dt", "li", "form":
+		score = -3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		score = -5
+	}
+
+	names := attr(n, "class") + " " + attr(n, "id")
+	if strings.TrimSpace(names) != "" {
+		if negativeNames.MatchString(names) {
+			score -= 25
+		}
+		if positiveNames.MatchString(names) {
+			score += 25
+		}
+	}
+	return score
+}
+
+// linkDensity is the fraction of a node's text that sits inside links
+func linkDensity(n *html.Node) float64 {
+	total := len(innerText(n))
+	if total == 0 {
+		return 0
+	}
+	links := 0
+	walkElements(n, func(c *html.Node) {
+		if c.Data == "a" {
+			links += len(innerText(c))
+		}
+	})
+	return min(float64(links)/float64(total), 1)
+}
+
+// blockText returns the text of a node split into paragraphs
+func blockText(n *html.Node) []string {
+	var parts []string
+	var sb strings.Builder
+	flush := func() {
+		if text := strings.Join(strings.Fields(sb.String()), " "); text != "" {
+			parts = append(parts, text)
+		}
+		sb.Reset()
+	}
+
+	var walk func(*html.Node)
+	walk = func(c *html.Node) {
+		if c.Type == html.TextNode {
+			sb.WriteString(c.Data)
+			sb.WriteString(" ")
+			return
+		}
+		if c.Type == html.ElementNode && skipElement(c) {
+			return
+		}
+		block := c.Type == html.ElementNode && isBlock(c.Data)
+		if block {
+			flush()
+		}
+		for gc := c.FirstChild; gc != nil; gc = gc.NextSibling {
+			walk(gc)
+		}
+		if block {
+			flush()
+		}
+	}
+	walk(n)
+	flush()
+	return parts
+}
+
+func isBlock(tag string) bool {
+	switch tag {
+	case "p", "div", "section", "article", "main", "pre", "blockquote", "li", "ul", "ol",
+		"h1", "h2", "h3", "h4", "h5", "h6", "table", "tr", "br", "figure", "figcaption":
+		return true
+	}
+	return false
+}
+
+func innerText(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(c *html.Node) {
+		if c.Type == html.TextNode {
+			sb.WriteString(c.Data)
+			sb.WriteString(" ")
+		}
+		for gc := c.FirstChild; gc != nil; gc = gc.NextSibling {
+			walk(gc)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
+
+func walkElements(n *html.Node, fn func(*html.Node)) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode {
+			fn(c)
+			walkElements(c, fn)
+		}
+	}
+}
+
+func findElement(n *html.Node, tag string) *html.Node {
+	if n.Type == html.ElementNode && n.Data == tag {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// youtubeBase is where video pages and transcripts are fetched from
+const youtubeBase = "https://www.youtube.com"
+
+var youtubeIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+
+// YouTubeVideoID returns the video ID of a YouTube watch, short or embed URL
+func YouTubeVideoID(rawURL string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", false
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	host = strings.TrimPrefix(host, "m.")
+
+	var id string
+	switch host {
+	case "youtu.be":
+		id = strings.Trim(u.Path, "/")
+	case "youtube.com", "music.youtube.com":
+		if u.Path == "/watch" {
+			id = u.Query().Get("v")
+		} else {
+			for _, prefix := range []string{"/shorts/", "/embed/", "/live/", "/v/"} {
+				if strings.HasPrefix(u.Path, prefix) {
+					id = strings.Trim(strings.TrimPrefix(u.Path, prefix), "/")
+				}
+			}
+		}
+	}
+	if !youtubeIDPattern.MatchString(id) {
+		return "", false
+	}
+	return id, true
+}
+
+// playerResponse is the part of a watch page's player data we use
+type playerResponse struct {
+	VideoDetails struct {
+		Title            string `json:"title"`
+		Author           string `json:"author"`
+		ShortDescription string `json:"shortDescription"`
+	} `json:"videoDetails"`
+	Microformat struct {
+		Renderer struct {
+			PublishDate string `json:"publishDate"`
+		} `json:"playerMicroformatRenderer"`
+	} `json:"microformat"`
+	Captions struct {
+		Renderer struct {
+			Tracks []captionTrack `json:"captionTracks"`
+		} `json:"playerCaptionsTracklistRenderer"`
+	} `json:"captions"`
+}
+
+type captionTrack struct {
+	BaseURL      string `json:"baseUrl"`
+	LanguageCode string `json:"languageCode"`
+	Kind         string `json:"kind"` // "asr" for auto-generated
+}
+
+// fetchYouTube stores a video's transcript as the text, with the video
+// title and channel as metadata. Videos without captions fall back to
+// their description.
+func fetchYouTube(ctx context.Context, client *http.Client, id string, opts Options) (*FetchResult, error) {
+	watchURL := youtubeBase + "/watch?v=" + id
+	page, err := get(ctx, client, watchURL)
+	if err != nil {
+		return nil, err
+	}
+
+	player, err := parsePlayerResponse(page)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &FetchResult{
+		Title:        player.VideoDetails.Title,
+		Author:       player.VideoDetails.Author,
+		Description:  player.VideoDetails.ShortDescription,
+		CanonicalURL: watchURL,
+	}
+	if t, ok := parsePublished(player.Microformat.Renderer.PublishDate); ok {
+		result.PublishedAt = &t
+	}
+
+	var text string
+	if track := pickCaptionTrack(player.Captions.Renderer.Tracks); track != nil {
+		data, err := get(ctx, client, track.BaseURL+"&fmt=json3")
+		if err != nil {
+			return nil, fmt.Errorf("fetch transcript: %w", err)
+		}
+		if text, err = parseTranscript(data); err != nil {
+			return nil, err
+		}
+	}
+	if text == "" {
+		text = strings.TrimSpace(result.Description)
+	}
+	if text == "" {
+		return nil, fmt.Errorf("no transcript available for this video")
+	}
+
+	maxChars := opts.MaxChars
+	if maxChars <= 0 {
+		maxChars = maxTextLength
+	}
+	if len(text) > maxChars {
+		text = text[:maxChars] + "..."
+		result.Truncated = true
+	}
+	result.Text = text
+	return result, nil
+}
+
+// parsePlayerResponse decodes the ytInitialPlayerResponse object embedded
+// in a watch page
+func parsePlayerResponse(page []byte) (*playerResponse, error) {
+	marker := []byte("ytInitialPlayerResponse = ")
+	i := bytes.Index(page, marker)
+	if i < 0 {
+		return nil, fmt.Errorf("no player data in video page")
+	}
+
+	// The decoder stops at the end of the object, ignoring the script after it
+	var player playerResponse
+	if err := json.NewDecoder(bytes.NewReader(page[i+len(marker):])).Decode(&player); err != nil {
+		return nil, fmt.Errorf("parse player data: %w", err)
+	}
+	return &player, nil
+}
+
+// pickCaptionTrack prefers English captions, and manual ones over
+// auto-generated
+func pickCaptionTrack(tracks []captionTrack) *captionTrack {
+	var best *captionTrack
+	bestScore := -1
+	for i, t := range tracks {
+		score := 0
+		if strings.HasPrefix(t.LanguageCode, "en") {
+			score += 2
+		}
+		if t.Kind != "asr" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = &tracks[i], score
+		}
+	}
+	return best
+}
+
+// parseTranscript joins the caption events of a json3 transcript, starting
+// a new paragraph after each pause of two seconds or more
+func parseTranscript(data []byte) (string, error) {
+	var transcript struct {
+		Events []struct {
+			StartMs    int64 `json:"tStartMs"`
+			DurationMs int64 `json:"dDurationMs"`
+			Segs       []struct {
+				Text string `json:"utf8"`
+			} `json:"segs"`
+		} `json:"events"`
+	}
+	if err := json.Unmarshal(data, &transcript); err != nil {
+		return "", fmt.Errorf("parse transcript: %w", err)
+	}
+
+	var paragraphs []string
+	var current strings.Builder
+	var lastEnd int64
+	for _, ev := range transcript.Events {
+		var line strings.Builder
+		for _, seg := range ev.Segs {
+			line.WriteString(seg.Text)
+		}
+		text := strings.Join(strings.Fields(line.String()), " ")
+		if text == "" {
+			continue
+		}
+		if current.Len() > 0 && ev.StartMs-lastEnd >= 2000 {
+			paragraphs = append(paragraphs, current.String())
+			current.Reset()
+		}
+		if current.Len() > 0 {
+			current.WriteString(" ")
+		}
+		current.WriteString(text)
+		lastEnd = ev.StartMs + ev.DurationMs
+	}
+	if current.Len() > 0 {
+		paragraphs = append(paragraphs, current.String())
+	}
+	return strings.Join(paragraphs, "\n\n"), nil
+}
+
+func get(ctx context.Context, client *http.Client, rawURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("User-Agent", "kb/1.0 (knowledge-base)")
+	req.Header.Set("Accept-Language", "en")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 5*1024*1024))
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+	return body, nil
+}
@@ -0,0 +1,441 @@
+package gitsync
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+	"gopkg.in/yaml.v3"
+)
+
+// Repository directories: one Markdown file per entry, named by its ID,
+// one YAML file per tag, named by its ID, and one per link, at
+// links/<from>/<to>.yaml
+const (
+	entriesDir = "entries"
+	tagsDir    = "tags"
+	linksDir   = "links"
+)
+
+// recordDirs are the directories holding records
+var recordDirs = []string{entriesDir, tagsDir, linksDir}
+
+// Repo is a git repository mirroring a kb database as Markdown files
+type Repo struct {
+	dir string
+}
+
+// Open returns the repository at dir, creating it if needed
+func Open(dir string) (*Repo, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("resolve repository path: %w", err)
+	}
+	for _, d := range recordDirs {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0o755); err != nil {
+			return nil, fmt.Errorf("create repository: %w", err)
+		}
+	}
+	r := &Repo{dir: dir}
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		if _, err := r.git("init", "--quiet"); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Dir is the repository's absolute path
+func (r *Repo) Dir() string {
+	return r.dir
+}
+
+// Head returns the current commit, "" before the first one
+func (r *Repo) Head() (string, error) {
+	out, err := r.git("rev-parse", "--verify", "--quiet", "HEAD")
+	if err != nil {
+		return "", nil
+	}
+	return out, nil
+}
+
+// Changes returns the record files changed since a commit, committed or
+// not, as sync changes: every file if since is "", tombstones for those
+// removed. Changes are stamped with the updated_at of their frontmatter,
+// or when the file was saved if it was edited in place.
+func (r *Repo) Changes(since string) ([]domain.SyncChange, error) {
+	edited := make(map[string]bool)
+	if since != "" {
+		out, err := r.git(append([]string{"diff", "--name-only", "HEAD", "--"}, recordDirs...)...)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range lines(out) {
+			edited[path] = true
+		}
+	}
+	if _, err := r.git(append([]string{"add", "--all", "--"}, recordDirs...)...); err != nil {
+		return nil, err
+	}
+
+	var out string
+	var err error
+	if since == "" {
+		out, err = r.git(append([]string{"ls-files", "--"}, recordDirs...)...)
+	} else {
+		out, err = r.git(append([]string{"diff", "--cached", "--name-status", "--no-renames", since, "--"}, recordDirs...)...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []domain.SyncChange
+	for _, line := range lines(out) {
+		status, path := "A", line
+		if fields := strings.SplitN(line, "\t", 2); len(fields) == 2 {
+			status, path = fields[0], fields[1]
+		}
+		kind, id, ok := recordAt(path)
+		if !ok {
+			continue
+		}
+		if status == "D" {
+			changes = append(changes, domain.SyncChange{Kind: kind, ID: id, ChangedAt: time.Now(), Deleted: true})
+			continue
+		}
+
+		file := filepath.Join(r.dir, path)
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read %s file: %w", kind, err)
+		}
+		var c domain.SyncChange
+		switch kind {
+		case domain.SyncKindTag:
+			c, err = unmarshalTag(data)
+		case domain.SyncKindLink:
+			c, err = unmarshalLink(data)
+		default:
+			c, err = Unmarshal(data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if c.ID != id {
+			return nil, fmt.Errorf("%s: id %q doesn't match the file name", path, c.ID)
+		}
+		if edited[path] {
+			if info, err := os.Stat(file); err == nil && info.ModTime().After(c.ChangedAt) {
+				c.ChangedAt = info.ModTime()
+			}
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+// recordAt returns the kind and ID of the record a repository path holds
+func recordAt(path string) (kind, id string, ok bool) {
+	dir, name := filepath.Split(filepath.ToSlash(path))
+	switch strings.TrimSuffix(dir, "/") {
+	case entriesDir:
+		id, ok = strings.CutSuffix(name, ".md")
+		return domain.SyncKindEntry, id, ok
+	case tagsDir:
+		id, ok = strings.CutSuffix(name, ".yaml")
+		return domain.SyncKindTag, id, ok
+	}
+	rest, ok := strings.CutPrefix(path, linksDir+"/")
+	if !ok {
+		return "", "", false
+	}
+	id, ok = strings.CutSuffix(rest, ".yaml")
+	return domain.SyncKindLink, id, ok && strings.Count(id, "/") == 1
+}
+
+// Write saves a change to its record's file, removing it for a tombstone
+func (r *Repo) Write(c domain.SyncChange) error {
+	var path string
+	var gone bool
+	var marshal func(domain.SyncChange) ([]byte, error)
+	switch c.Kind {
+	case domain.SyncKindTag:
+		path, gone, marshal = filepath.Join(r.dir, tagsDir, c.ID+".yaml"), c.Tag == nil, marshalTag
+	case domain.SyncKindLink:
+		path, gone, marshal = filepath.Join(r.dir, linksDir, filepath.FromSlash(c.ID)+".yaml"), c.Link == nil, marshalLink
+	default:
+		path, gone, marshal = filepath.Join(r.dir, entriesDir, c.ID+".md"), c.Entry == nil, Marshal
+	}
+	if c.Deleted || gone {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove record file: %w", err)
+		}
+		return nil
+	}
+	data, err := marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("write record file: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("write record file: %w", err)
+	}
+	return nil
+}
+
+// Commit commits every change to the record files, returning the new
+// head. With nothing to commit, the head is unchanged.
+func (r *Repo) Commit(message string) (string, error) {
+	if _, err := r.git(append([]string{"add", "--all", "--"}, recordDirs...)...); err != nil {
+		return "", err
+	}
+	if _, err := r.git("diff", "--cached", "--quiet"); err != nil {
+		if _, err := r.git("commit", "--quiet", "-m", message); err != nil {
+			return "", err
+		}
+	}
+	return r.Head()
+}
+
+// git runs a git command in the repository, returning its trimmed output.
+// Commits are authored as kb where git has no identity configured.
+func (r *Repo) git(args ...string) (string, error) {
+	if args[0] == "commit" {
+		if name, _ := exec.Command("git", "-C", r.dir, "config", "user.email").Output(); len(name) == 0 {
+			args = append([]string{"-c", "user.name=kb", "-c", "user.email=kb@localhost"}, args...)
+		}
+	}
+	cmd := exec.Command("git", append([]string{"-C", r.dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func lines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// frontmatter is the YAML header of an entry file. Tags with a parent are
+// written as parent/name; how sure the classifier was of them isn't kept,
+// and links are files of their own.
+type frontmatter struct {
+	ID         string     `yaml:"id"`
+	Title      string     `yaml:"title,omitempty"`
+	Source     string     `yaml:"source"`
+	URL        string     `yaml:"url,omitempty"`
+	Author     string     `yaml:"author,omitempty"`
+	FetchedAt  *time.Time `yaml:"fetched_at,omitempty"`
+	Maturity   string     `yaml:"maturity"`
+	Notebook   string     `yaml:"notebook,omitempty"`
+	Tags       []string   `yaml:"tags,omitempty"`
+	CreatedAt  time.Time  `yaml:"created_at"`
+	UpdatedAt  time.Time  `yaml:"updated_at"`
+	ExpiresAt  *time.Time `yaml:"expires_at,omitempty"`
+	ArchivedAt *time.Time `yaml:"archived_at,omitempty"`
+	DeletedAt  *time.Time `yaml:"deleted_at,omitempty"`
+}
+
+// Marshal renders an entry as Markdown with a YAML frontmatter
+func Marshal(c domain.SyncChange) ([]byte, error) {
+	e := c.Entry
+	fm := frontmatter{
+		ID:         c.ID,
+		Title:      e.Source.Title,
+		Source:     e.Source.Type,
+		URL:        e.Source.URL,
+		Author:     e.Source.Author,
+		FetchedAt:  utc(e.Source.FetchedAt),
+		Maturity:   e.Maturity,
+		Notebook:   e.Notebook,
+		CreatedAt:  e.CreatedAt.UTC(),
+		UpdatedAt:  c.ChangedAt.UTC(),
+		ExpiresAt:  utc(e.ExpiresAt),
+		ArchivedAt: utc(e.ArchivedAt),
+		DeletedAt:  utc(e.DeletedAt),
+	}
+	for _, t := range e.Tags {
+		if t.Parent != "" {
+			fm.Tags = append(fm.Tags, t.Parent+"/"+t.Name)
+		} else {
+			fm.Tags = append(fm.Tags, t.Name)
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("---\n")
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(fm); err != nil {
+		return nil, fmt.Errorf("marshal frontmatter: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("marshal frontmatter: %w", err)
+	}
+	buf.WriteString("---\n\n")
+	buf.WriteString(e.Content)
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+// Unmarshal parses an entry file written by Marshal, maybe edited since
+func Unmarshal(data []byte) (domain.SyncChange, error) {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	rest, ok := strings.CutPrefix(text, "---\n")
+	if !ok {
+		return domain.SyncChange{}, fmt.Errorf("missing frontmatter")
+	}
+	header, body, ok := strings.Cut(rest, "\n---\n")
+	if !ok {
+		return domain.SyncChange{}, fmt.Errorf("unterminated frontmatter")
+	}
+	var fm frontmatter
+	if err := yaml.Unmarshal([]byte(header), &fm); err != nil {
+		return domain.SyncChange{}, fmt.Errorf("parse frontmatter: %w", err)
+	}
+	if fm.ID == "" {
+		return domain.SyncChange{}, fmt.Errorf("frontmatter has no id")
+	}
+	body = strings.TrimPrefix(body, "\n")
+	body = strings.TrimSuffix(body, "\n")
+
+	e := &domain.SyncEntry{
+		Content:    body,
+		Source:     domain.Source{Type: fm.Source, URL: fm.URL, Title: fm.Title, Author: fm.Author, FetchedAt: fm.FetchedAt},
+		CreatedAt:  fm.CreatedAt,
+		Maturity:   fm.Maturity,
+		Notebook:   fm.Notebook,
+		ExpiresAt:  fm.ExpiresAt,
+		ArchivedAt: fm.ArchivedAt,
+		DeletedAt:  fm.DeletedAt,
+	}
+	if e.Source.Type == "" {
+		e.Source.Type = domain.SourceNote
+	}
+	if e.Maturity == "" {
+		e.Maturity = domain.MaturityLevels[0]
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	for _, tag := range fm.Tags {
+		t := domain.SyncEntryTag{Name: tag, Confidence: 1}
+		if i := strings.LastIndex(tag, "/"); i > 0 {
+			t.Parent, t.Name = tag[:i], tag[i+1:]
+		}
+		e.Tags = append(e.Tags, t)
+	}
+
+	return domain.SyncChange{Kind: domain.SyncKindEntry, ID: fm.ID, ChangedAt: changedAt(fm.UpdatedAt, e.CreatedAt), Entry: e}, nil
+}
+
+// tagFile is the content of a tag file. Parent names the parent tag, of
+// ID parent_id.
+type tagFile struct {
+	ID          string    `yaml:"id"`
+	Name        string    `yaml:"name"`
+	Parent      string    `yaml:"parent,omitempty"`
+	ParentID    string    `yaml:"parent_id,omitempty"`
+	Description string    `yaml:"description,omitempty"`
+	Color       string    `yaml:"color,omitempty"`
+	CreatedAt   time.Time `yaml:"created_at"`
+	UpdatedAt   time.Time `yaml:"updated_at"`
+}
+
+func marshalTag(c domain.SyncChange) ([]byte, error) {
+	t := c.Tag
+	return marshalYAML(tagFile{
+		ID: c.ID, Name: t.Name, Parent: t.Parent, ParentID: t.ParentID, Description: t.Description, Color: t.Color,
+		CreatedAt: t.CreatedAt.UTC(), UpdatedAt: c.ChangedAt.UTC(),
+	})
+}
+
+func unmarshalTag(data []byte) (domain.SyncChange, error) {
+	var f tagFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return domain.SyncChange{}, fmt.Errorf("parse tag: %w", err)
+	}
+	if f.ID == "" || f.Name == "" {
+		return domain.SyncChange{}, fmt.Errorf("tag has no id or name")
+	}
+	if f.Parent == "" {
+		// A parent edited away by name goes with its ID
+		f.ParentID = ""
+	}
+	t := &domain.SyncTag{Name: f.Name, ParentID: f.ParentID, Parent: f.Parent, Description: f.Description, Color: f.Color, CreatedAt: f.CreatedAt}
+	return domain.SyncChange{Kind: domain.SyncKindTag, ID: f.ID, ChangedAt: changedAt(f.UpdatedAt, f.CreatedAt), Tag: t}, nil
+}
+
+// linkFile is the content of a link file
+type linkFile struct {
+	From      string    `yaml:"from"`
+	To        string    `yaml:"to"`
+	Kind      string    `yaml:"kind"`
+	CreatedAt time.Time `yaml:"created_at"`
+	UpdatedAt time.Time `yaml:"updated_at"`
+}
+
+func marshalLink(c domain.SyncChange) ([]byte, error) {
+	l := c.Link
+	return marshalYAML(linkFile{From: l.FromID, To: l.ToID, Kind: l.Kind, CreatedAt: l.CreatedAt.UTC(), UpdatedAt: c.ChangedAt.UTC()})
+}
+
+func unmarshalLink(data []byte) (domain.SyncChange, error) {
+	var f linkFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return domain.SyncChange{}, fmt.Errorf("parse link: %w", err)
+	}
+	if f.From == "" || f.To == "" {
+		return domain.SyncChange{}, fmt.Errorf("link has no from or to")
+	}
+	if f.Kind == "" {
+		f.Kind = domain.LinkRelates
+	}
+	l := &domain.SyncLink{FromID: f.From, ToID: f.To, Kind: f.Kind, CreatedAt: f.CreatedAt}
+	return domain.SyncChange{Kind: domain.SyncKindLink, ID: domain.SyncLinkID(f.From, f.To), ChangedAt: changedAt(f.UpdatedAt, f.CreatedAt), Link: l}, nil
+}
+
+func marshalYAML(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return nil, fmt.Errorf("marshal record: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("marshal record: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// changedAt stamps a record with when it was updated, or else created
+func changedAt(updated, created time.Time) time.Time {
+	if updated.IsZero() {
+		return created
+	}
+	return updated
+}
+
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
@@ -0,0 +1,281 @@
+// Package journal is a write-ahead log of incoming captures. A capture is
+// appended before it is processed, then marked once stored as an entry and
+// once fully processed, so that captures interrupted by a failure or a
+// crash can be replayed. A capture whose replays keep failing is moved to
+// a quarantine file instead of blocking the next ones. The API server, the
+// Telegram bot and feed syncs each write their own journal.
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// Capture is content received for ingestion, with what is needed to
+// process it again
+type Capture struct {
+	ID         string        `json:"id"`
+	At         time.Time     `json:"at"`
+	Content    string        `json:"content"`
+	Source     domain.Source `json:"source"`
+	NoClassify bool          `json:"no_classify,omitempty"`
+	Notebook   string        `json:"notebook,omitempty"`
+	// User is the ID of the user the capture belongs to, "" for the owner
+	User string `json:"user,omitempty"`
+	// Via and URL record where a URL was seen, as a source occurrence
+	Via string `json:"via,omitempty"`
+	URL string `json:"url,omitempty"`
+}
+
+// Pending is a capture that wasn't fully processed; EntryID is set when
+// it was already stored. Attempts counts the replays started for it.
+type Pending struct {
+	Capture
+	EntryID  string
+	Attempts int
+}
+
+// MaxAttempts is how many replays of a capture can fail before it's
+// quarantined
+const MaxAttempts = 3
+
+// Record operations
+const (
+	opCapture = "capture"
+	opStored  = "stored"
+	opAttempt = "attempt"
+	opDone    = "done"
+)
+
+// record is one line of the journal
+type record struct {
+	Op      string    `json:"op"`
+	ID      string    `json:"id"`
+	At      time.Time `json:"at"`
+	Capture *Capture  `json:"capture,omitempty"`
+	EntryID string    `json:"entry_id,omitempty"`
+	// Error is why a quarantined capture failed
+	Error string `json:"error,omitempty"`
+}
+
+// Journal appends records to a JSON lines file
+type Journal struct {
+	path string
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+// ForDir returns the path of the API server's journal in a database's
+// directory (see store.Store.Dir)
+func ForDir(dir string) string {
+	return filepath.Join(dir, "journal.jsonl")
+}
+
+// ForSource returns the path of the journal of another capture path
+// (e.g. "telegram", "feeds") in a database's directory. A journal is
+// written by one process at a time.
+func ForSource(dir, name string) string {
+	return filepath.Join(dir, "journal-"+name+".jsonl")
+}
+
+// quarantinePath is where the captures of the journal at path that kept
+// failing are moved
+func quarantinePath(path string) string {
+	return strings.TrimSuffix(path, ".jsonl") + ".quarantine.jsonl"
+}
+
+// Open opens the journal at path, creating it if needed
+func Open(path string) (*Journal, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("open journal: %w", err)
+	}
+	return &Journal{path: path, f: f}, nil
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.f.Close()
+}
+
+// Append records a capture before it is processed, assigning its ID
+func (j *Journal) Append(c *Capture) error {
+	c.ID = uuid.New().String()
+	c.At = time.Now()
+	return j.write(record{Op: opCapture, ID: c.ID, Capture: c})
+}
+
+// Stored records that a capture was saved as an entry
+func (j *Journal) Stored(id, entryID string) error {
+	return j.write(record{Op: opStored, ID: id, EntryID: entryID})
+}
+
+// Attempt records that a replay of a capture is starting
+func (j *Journal) Attempt(id string) error {
+	return j.write(record{Op: opAttempt, ID: id})
+}
+
+// Quarantine moves a capture that kept failing out of the journal, to
+// the quarantine file beside it, with why it failed. It's no longer
+// pending but can still be recovered by hand.
+func (j *Journal) Quarantine(p Pending, reason string) error {
+	line, err := json.Marshal(record{Op: opCapture, ID: p.ID, At: time.Now(), Capture: &p.Capture, EntryID: p.EntryID, Error: reason})
+	if err != nil {
+		return fmt.Errorf("marshal journal record: %w", err)
+	}
+	f, err := os.OpenFile(quarantinePath(j.path), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("quarantine capture: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("quarantine capture: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("quarantine capture: %w", err)
+	}
+	return j.Done(p.ID)
+}
+
+// Done records that a capture was fully processed
+func (j *Journal) Done(id string) error {
+	return j.write(record{Op: opDone, ID: id})
+}
+
+// write appends a record and syncs it to disk
+func (j *Journal) write(r record) error {
+	if r.At.IsZero() {
+		r.At = time.Now()
+	}
+	line, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("marshal journal record: %w", err)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write journal: %w", err)
+	}
+	if err := j.f.Sync(); err != nil {
+		return fmt.Errorf("sync journal: %w", err)
+	}
+	return nil
+}
+
+// Pending returns the captures not marked done, oldest first. A line torn
+// by a crash mid-write is skipped.
+func (j *Journal) Pending() ([]Pending, error) {
+	f, err := os.Open(j.path)
+	if err != nil {
+		return nil, fmt.Errorf("read journal: %w", err)
+	}
+	defer f.Close()
+
+	var order []string
+	pending := make(map[string]*Pending)
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var r record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+		switch r.Op {
+		case opCapture:
+			if r.Capture != nil {
+				pending[r.ID] = &Pending{Capture: *r.Capture}
+				order = append(order, r.ID)
+			}
+		case opStored:
+			if p, ok := pending[r.ID]; ok {
+				p.EntryID = r.EntryID
+			}
+		case opAttempt:
+			if p, ok := pending[r.ID]; ok {
+				p.Attempts++
+			}
+		case opDone:
+			delete(pending, r.ID)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read journal: %w", err)
+	}
+
+	var result []Pending
+	for _, id := range order {
+		if p, ok := pending[id]; ok {
+			result = append(result, *p)
+		}
+	}
+	return result, nil
+}
+
+// Compact rewrites the journal with only the pending captures
+func (j *Journal) Compact() error {
+	pending, err := j.Pending()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), ".journal-*")
+	if err != nil {
+		return fmt.Errorf("compact journal: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	enc := json.NewEncoder(tmp)
+	for _, p := range pending {
+		c := p.Capture
+		if err := enc.Encode(record{Op: opCapture, ID: c.ID, At: c.At, Capture: &c}); err != nil {
+			tmp.Close()
+			return fmt.Errorf("compact journal: %w", err)
+		}
+		if p.EntryID != "" {
+			if err := enc.Encode(record{Op: opStored, ID: c.ID, At: c.At, EntryID: p.EntryID}); err != nil {
+				tmp.Close()
+				return fmt.Errorf("compact journal: %w", err)
+			}
+		}
+		for range p.Attempts {
+			if err := enc.Encode(record{Op: opAttempt, ID: c.ID, At: c.At}); err != nil {
+				tmp.Close()
+				return fmt.Errorf("compact journal: %w", err)
+			}
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("compact journal: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("compact journal: %w", err)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := os.Rename(tmp.Name(), j.path); err != nil {
+		return fmt.Errorf("compact journal: %w", err)
+	}
+	f, err := os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("open journal: %w", err)
+	}
+	j.f.Close()
+	j.f = f
+	return nil
+}
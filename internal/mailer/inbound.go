@@ -0,0 +1,143 @@
+package mailer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+// maxPartSize bounds how much of each body part is read
+const maxPartSize = 5 * 1024 * 1024
+
+// forwardPrefix matches the reply and forward markers of subjects
+var forwardPrefix = regexp.MustCompile(`(?i)^\s*((fwd?|tr|wg|re|aw)\s*:\s*)+`)
+
+// InboundEmail is an email received to be saved, with its plain text
+// and HTML bodies as found
+type InboundEmail struct {
+	From      string
+	Subject   string
+	MessageID string
+	Date      time.Time
+	Text      string
+	HTML      string
+}
+
+// Title returns the subject without reply and forward markers ("Fwd:")
+func (m *InboundEmail) Title() string {
+	return strings.TrimSpace(forwardPrefix.ReplaceAllString(m.Subject, ""))
+}
+
+// Sender returns the display name of the sender, or their address
+func (m *InboundEmail) Sender() string {
+	addr, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return strings.TrimSpace(m.From)
+	}
+	if addr.Name != "" {
+		return addr.Name
+	}
+	return addr.Address
+}
+
+var headerDecoder = &mime.WordDecoder{CharsetReader: charset.NewReaderLabel}
+
+// DecodeHeader decodes the encoded words ("=?utf-8?q?...?=") of a header
+// value, leaving it as is when they are malformed
+func DecodeHeader(v string) string {
+	decoded, err := headerDecoder.DecodeHeader(v)
+	if err != nil {
+		return v
+	}
+	return decoded
+}
+
+// ParseMessage reads a raw MIME email, keeping the first plain text and
+// HTML bodies of its parts. Attachments are left out.
+func ParseMessage(r io.Reader) (*InboundEmail, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("read message: %w", err)
+	}
+	m := &InboundEmail{
+		From:      DecodeHeader(msg.Header.Get("From")),
+		Subject:   DecodeHeader(msg.Header.Get("Subject")),
+		MessageID: strings.Trim(msg.Header.Get("Message-Id"), "<> "),
+	}
+	if date, err := msg.Header.Date(); err == nil {
+		m.Date = date
+	}
+	if err := m.readPart(msg.Header, msg.Body); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// header is what readPart needs of message and part headers
+type header interface {
+	Get(key string) string
+}
+
+func (m *InboundEmail) readPart(h header, body io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+	if strings.HasPrefix(strings.ToLower(h.Get("Content-Disposition")), "attachment") {
+		return nil
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("read part: %w", err)
+			}
+			if err := m.readPart(part.Header, part); err != nil {
+				return err
+			}
+		}
+	}
+	if mediaType != "text/plain" && mediaType != "text/html" {
+		return nil
+	}
+	if (mediaType == "text/plain" && m.Text != "") || (mediaType == "text/html" && m.HTML != "") {
+		return nil
+	}
+
+	switch strings.ToLower(h.Get("Content-Transfer-Encoding")) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	if cs := params["charset"]; cs != "" && !strings.EqualFold(cs, "utf-8") && !strings.EqualFold(cs, "us-ascii") {
+		if body, err = charset.NewReaderLabel(cs, body); err != nil {
+			return fmt.Errorf("decode %s part: %w", cs, err)
+		}
+	}
+	data, err := io.ReadAll(io.LimitReader(body, maxPartSize))
+	if err != nil {
+		return fmt.Errorf("read %s part: %w", mediaType, err)
+	}
+
+	if mediaType == "text/html" {
+		m.HTML = string(data)
+	} else {
+		m.Text = strings.ReplaceAll(string(data), "\r\n", "\n")
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config holds SMTP settings
+type Config struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// FromEnv reads SMTP settings from KB_SMTP_* environment variables
+func FromEnv() (*Config, error) {
+	cfg := &Config{
+		Host:     os.Getenv("KB_SMTP_HOST"),
+		Port:     os.Getenv("KB_SMTP_PORT"),
+		Username: os.Getenv("KB_SMTP_USER"),
+		Password: os.Getenv("KB_SMTP_PASSWORD"),
+		From:     os.Getenv("KB_SMTP_FROM"),
+	}
+	if to := os.Getenv("KB_SMTP_TO"); to != "" {
+		for _, addr := range strings.Split(to, ",") {
+			cfg.To = append(cfg.To, strings.TrimSpace(addr))
+		}
+	}
+
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("KB_SMTP_HOST environment variable not set")
+	}
+	if len(cfg.To) == 0 {
+		return nil, fmt.Errorf("KB_SMTP_TO environment variable not set")
+	}
+	if cfg.Port == "" {
+		cfg.Port = "587"
+	}
+	if cfg.From == "" {
+		cfg.From = cfg.Username
+	}
+	if cfg.From == "" {
+		return nil, fmt.Errorf("KB_SMTP_FROM environment variable not set")
+	}
+
+	return cfg, nil
+}
+
+// SendHTML sends an HTML email to the configured recipients
+func (c *Config) SendHTML(subject, body string) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", c.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(c.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(body)
+
+	var auth smtp.Auth
+	if c.Username != "" {
+		auth = smtp.PlainAuth("", c.Username, c.Password, c.Host)
+	}
+
+	addr := net.JoinHostPort(c.Host, c.Port)
+	if err := smtp.SendMail(addr, auth, c.From, c.To, msg.Bytes()); err != nil {
+		return fmt.Errorf("send mail: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+// Package mcp serves the knowledge base to Model Context Protocol clients,
+// such as Claude Desktop, as tools over stdio: JSON-RPC 2.0 messages, one
+// per line.
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"slices"
+
+	"github.com/pbaille/kb/internal/store"
+)
+
+// protocolVersions are the MCP revisions served, latest last
+var protocolVersions = []string{"2024-11-05", "2025-03-26", "2025-06-18"}
+
+// maxMessage bounds the size of one message, an add_entry of a long
+// article included
+const maxMessage = 16 << 20
+
+// JSON-RPC error codes
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+// Server answers MCP requests with the tools of a store
+type Server struct {
+	store *store.Store
+	tools []tool
+}
+
+// New creates a Server for a store
+func New(s *store.Store) *Server {
+	srv := &Server{store: s}
+	srv.tools = srv.registerTools()
+	return srv
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+// Serve answers the requests read from r on w, one at a time, until r is
+// closed or ctx is done. Notifications are not answered.
+func (srv *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxMessage)
+	enc := json.NewEncoder(w)
+
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var req request
+		if err := json.Unmarshal(line, &req); err != nil {
+			resp := response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{codeParseError, "parse error: " + err.Error()}}
+			if err := enc.Encode(resp); err != nil {
+				return fmt.Errorf("write response: %w", err)
+			}
+			continue
+		}
+		if len(req.ID) == 0 {
+			// Notifications, like notifications/initialized, need no answer
+			continue
+		}
+
+		resp := response{JSONRPC: "2.0", ID: req.ID}
+		result, err := srv.handle(ctx, &req)
+		if err != nil {
+			rerr, ok := err.(*rpcError)
+			if !ok {
+				rerr = &rpcError{codeInvalidParams, err.Error()}
+			}
+			resp.Error = rerr
+		} else {
+			resp.Result = result
+		}
+		if err := enc.Encode(resp); err != nil {
+			return fmt.Errorf("write response: %w", err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read request: %w", err)
+	}
+	return nil
+}
+
+func (srv *Server) handle(ctx context.Context, req *request) (interface{}, error) {
+	if req.JSONRPC != "2.0" {
+		return nil, &rpcError{codeInvalidRequest, "jsonrpc must be 2.0"}
+	}
+	switch req.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(req.Params, &params)
+		version := protocolVersions[len(protocolVersions)-1]
+		if slices.Contains(protocolVersions, params.ProtocolVersion) {
+			version = params.ProtocolVersion
+		}
+		return map[string]interface{}{
+			"protocolVersion": version,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]string{"name": "kb", "version": buildVersion()},
+			"instructions":    "kb is the user's personal knowledge base of notes, saved articles and links. Search it before answering from memory, and add entries when asked to remember something.",
+		}, nil
+	case "ping":
+		return map[string]interface{}{}, nil
+	case "tools/list":
+		return map[string]interface{}{"tools": srv.tools}, nil
+	case "tools/call":
+		var params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &rpcError{codeInvalidParams, "invalid params: " + err.Error()}
+		}
+		return srv.callTool(ctx, params.Name, params.Arguments)
+	}
+	return nil, &rpcError{codeMethodNotFound, "method not found: " + req.Method}
+}
+
+// buildVersion returns the version kb was built as, when built from a
+// module version
+func buildVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
@@ -0,0 +1,307 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/embedding"
+	"github.com/pbaille/kb/internal/pipeline"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// snippetLength is how much of an entry's content listings show
+const snippetLength = 300
+
+// tool is an MCP tool: its description and input JSON Schema are listed
+// to clients, which call it with arguments matching the schema
+type tool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+	call        func(ctx context.Context, args json.RawMessage) (interface{}, error)
+}
+
+// object is the JSON Schema of an object with the given properties
+func object(properties map[string]interface{}, required ...string) map[string]interface{} {
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func property(typ, description string) map[string]interface{} {
+	return map[string]interface{}{"type": typ, "description": description}
+}
+
+func (srv *Server) registerTools() []tool {
+	return []tool{
+		{
+			Name:        "search",
+			Description: "Search the knowledge base for entries matching a query, newest first. Returns IDs, titles, tags and snippets; use get_entry for the full content.",
+			InputSchema: object(map[string]interface{}{
+				"query": property("string", `words and "phrases" to look for, combined with OR, NOT and parentheses, and filters: tag:name, before:2024-06-01, after:30d, source:url`),
+				"limit": property("integer", "maximum number of entries (default 10)"),
+			}, "query"),
+			call: srv.search,
+		},
+		{
+			Name:        "add_entry",
+			Description: "Save a note or passage to the knowledge base. It is tagged automatically and [[wiki-links]] to other entries' titles become links.",
+			InputSchema: object(map[string]interface{}{
+				"content":     property("string", "the text to save, Markdown"),
+				"title":       property("string", "optional title"),
+				"url":         property("string", "optional URL the content comes from"),
+				"no_classify": property("boolean", "skip automatic tagging"),
+			}, "content"),
+			call: srv.addEntry,
+		},
+		{
+			Name:        "get_entry",
+			Description: "Get an entry with its full content, tags and links, by ID or ID prefix.",
+			InputSchema: object(map[string]interface{}{
+				"id": property("string", "entry ID or prefix"),
+			}, "id"),
+			call: srv.getEntry,
+		},
+		{
+			Name:        "list_tags",
+			Description: "List the tags of the knowledge base, with their parent tags and how many entries have them.",
+			InputSchema: object(map[string]interface{}{}),
+			call:        srv.listTags,
+		},
+		{
+			Name:        "find_similar",
+			Description: "Find the entries closest in meaning to an entry (by ID) or to a text, by embedding similarity.",
+			InputSchema: object(map[string]interface{}{
+				"id":    property("string", "entry ID or prefix to find entries like"),
+				"text":  property("string", "text to find entries like, instead of an entry"),
+				"limit": property("integer", "maximum number of entries (default 5)"),
+			}),
+			call: srv.findSimilar,
+		},
+	}
+}
+
+// callTool runs a tool. Failures of the tool itself are reported in the
+// result, for the model to see, rather than as protocol errors.
+func (srv *Server) callTool(ctx context.Context, name string, args json.RawMessage) (interface{}, error) {
+	for _, t := range srv.tools {
+		if t.Name != name {
+			continue
+		}
+		if len(args) == 0 {
+			args = json.RawMessage("{}")
+		}
+		result, err := t.call(ctx, args)
+		if err != nil {
+			return toolResult(err.Error(), true), nil
+		}
+		text, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("marshal result: %w", err)
+		}
+		return toolResult(string(text), false), nil
+	}
+	return nil, &rpcError{codeInvalidParams, "unknown tool: " + name}
+}
+
+func toolResult(text string, isError bool) map[string]interface{} {
+	return map[string]interface{}{
+		"content": []map[string]string{{"type": "text", "text": text}},
+		"isError": isError,
+	}
+}
+
+// entrySummary is an entry as listed by search and find_similar
+type entrySummary struct {
+	ID         string    `json:"id"`
+	Title      string    `json:"title"`
+	URL        string    `json:"url,omitempty"`
+	Tags       []string  `json:"tags,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	Snippet    string    `json:"snippet"`
+	Similarity float64   `json:"similarity,omitempty"`
+}
+
+func (srv *Server) summarize(ctx context.Context, e *domain.Entry) entrySummary {
+	sum := entrySummary{ID: e.ID, Title: e.DisplayTitle(), URL: e.Source.URL, CreatedAt: e.CreatedAt, Snippet: snippet(e.Content)}
+	if tags, err := srv.store.GetEntryTags(ctx, e.ID); err == nil {
+		for _, t := range tags {
+			sum.Tags = append(sum.Tags, t.Name)
+		}
+	}
+	return sum
+}
+
+func snippet(content string) string {
+	content = strings.Join(strings.Fields(content), " ")
+	if r := []rune(content); len(r) > snippetLength {
+		return string(r[:snippetLength-3]) + "..."
+	}
+	return content
+}
+
+func (srv *Server) search(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		Query string `json:"query"`
+		Limit int    `json:"limit"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil || strings.TrimSpace(args.Query) == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+	if args.Limit <= 0 {
+		args.Limit = 10
+	}
+
+	entries, err := srv.store.SearchEntries(ctx, args.Query, domain.ScopeActive, false)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]entrySummary, 0, min(len(entries), args.Limit))
+	for i := range entries[:min(len(entries), args.Limit)] {
+		results = append(results, srv.summarize(ctx, &entries[i]))
+	}
+	return results, nil
+}
+
+func (srv *Server) getEntry(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil || args.ID == "" {
+		return nil, fmt.Errorf("id is required")
+	}
+	id, err := srv.resolve(ctx, args.ID)
+	if err != nil {
+		return nil, err
+	}
+	return srv.store.GetEntry(ctx, id)
+}
+
+// resolve finds the full ID of an entry from an ID prefix
+func (srv *Server) resolve(ctx context.Context, prefix string) (string, error) {
+	id, err := srv.store.ResolveID(ctx, prefix)
+	if errors.Is(err, store.ErrEntryNotFound) {
+		return "", fmt.Errorf("entry not found: %s", prefix)
+	}
+	return id, err
+}
+
+func (srv *Server) listTags(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+	tags, err := srv.store.ListTags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := srv.store.TagCounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(tags))
+	for _, t := range tags {
+		names[t.ID] = t.Name
+	}
+
+	type tagInfo struct {
+		Name        string `json:"name"`
+		Parent      string `json:"parent,omitempty"`
+		Description string `json:"description,omitempty"`
+		Entries     int    `json:"entries"`
+	}
+	result := make([]tagInfo, 0, len(tags))
+	for _, t := range tags {
+		info := tagInfo{Name: t.Name, Description: t.Description, Entries: counts[t.Name]}
+		if t.ParentID != nil {
+			info.Parent = names[*t.ParentID]
+		}
+		result = append(result, info)
+	}
+	return result, nil
+}
+
+func (srv *Server) findSimilar(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		ID    string `json:"id"`
+		Text  string `json:"text"`
+		Limit int    `json:"limit"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil || (args.ID == "") == (args.Text == "") {
+		return nil, fmt.Errorf("give either id or text")
+	}
+	if args.Limit <= 0 {
+		args.Limit = 5
+	}
+
+	var vector []float64
+	var exclude string
+	if args.ID != "" {
+		id, err := srv.resolve(ctx, args.ID)
+		if err != nil {
+			return nil, err
+		}
+		if vector, err = srv.store.GetEmbedding(ctx, id); err != nil {
+			return nil, err
+		}
+		if vector == nil {
+			return nil, fmt.Errorf("entry %s has no embedding yet (kb embed computes missing ones)", id)
+		}
+		exclude = id
+	} else {
+		embSvc, err := embedding.New()
+		if err != nil {
+			return nil, err
+		}
+		if vector, err = embSvc.Embed(ctx, args.Text); err != nil {
+			return nil, err
+		}
+	}
+
+	similar, err := srv.store.FindSimilar(ctx, vector, args.Limit, exclude)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]entrySummary, 0, len(similar))
+	for _, sim := range similar {
+		sum := srv.summarize(ctx, &sim.Entry)
+		sum.Similarity = sim.Similarity
+		if sim.Snippet != "" {
+			sum.Snippet = snippet(sim.Snippet)
+		}
+		results = append(results, sum)
+	}
+	return results, nil
+}
+
+func (srv *Server) addEntry(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		Content    string `json:"content"`
+		Title      string `json:"title"`
+		URL        string `json:"url"`
+		NoClassify bool   `json:"no_classify"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil || strings.TrimSpace(args.Content) == "" {
+		return nil, fmt.Errorf("content is required")
+	}
+
+	source := domain.Source{Type: domain.SourceNote, Title: args.Title}
+	if args.URL != "" {
+		source.Type, source.URL = domain.SourceURL, args.URL
+	}
+	entry, err := srv.store.AddEntryWithSource(ctx, args.Content, source)
+	if err != nil {
+		return nil, err
+	}
+
+	// The entry is saved; later steps that fail are reported alongside it
+	res := pipeline.Process(ctx, srv.store, entry, entry.Content, pipeline.ProcessOptions{NoClassify: args.NoClassify})
+	return map[string]interface{}{
+		"entry":            res.Entry,
+		"unresolved_links": res.UnresolvedLinks,
+		"problems":         res.Problems,
+	}, nil
+}
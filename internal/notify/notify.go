@@ -0,0 +1,111 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// webhookTimeout bounds how long a webhook can take to answer
+const webhookTimeout = 10 * time.Second
+
+// Config says where notifications are sent: to a webhook, as desktop
+// notifications, or both
+type Config struct {
+	WebhookURL string
+	Desktop    bool
+}
+
+// FromEnv reads the notification settings: KB_NOTIFY_WEBHOOK, a URL
+// notifications are POSTed to as JSON, and KB_NOTIFY_DESKTOP, set to
+// show desktop notifications
+func FromEnv() (*Config, error) {
+	cfg := &Config{
+		WebhookURL: os.Getenv("KB_NOTIFY_WEBHOOK"),
+		Desktop:    os.Getenv("KB_NOTIFY_DESKTOP") != "",
+	}
+	if cfg.WebhookURL == "" && !cfg.Desktop {
+		return nil, fmt.Errorf("neither KB_NOTIFY_WEBHOOK nor KB_NOTIFY_DESKTOP environment variable set")
+	}
+	if cfg.WebhookURL != "" {
+		if u, err := url.Parse(cfg.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("invalid KB_NOTIFY_WEBHOOK URL %q", cfg.WebhookURL)
+		}
+	}
+	return cfg, nil
+}
+
+// Notification is a message about something in the knowledge base
+type Notification struct {
+	// Event names what happened, e.g. "reminder"
+	Event string `json:"event"`
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	// Data is what the event is about, only sent to the webhook
+	Data interface{} `json:"data,omitempty"`
+}
+
+// Send delivers a notification everywhere configured
+func (c *Config) Send(ctx context.Context, n Notification) error {
+	var errs []error
+	if c.WebhookURL != "" {
+		errs = append(errs, c.post(ctx, n))
+	}
+	if c.Desktop {
+		errs = append(errs, desktop(ctx, n))
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Config) post(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("marshal notification: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook: HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// desktop shows a notification with notify-send on Linux and the BSDs,
+// or AppleScript on macOS
+func desktop(ctx context.Context, n Notification) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", strconv.Quote(n.Body), strconv.Quote(n.Title))
+		cmd = exec.CommandContext(ctx, "osascript", "-e", script)
+	case "windows":
+		return fmt.Errorf("desktop notifications aren't supported on Windows")
+	default:
+		cmd = exec.CommandContext(ctx, "notify-send", "--app-name=kb", n.Title, n.Body)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("desktop notification: %w: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
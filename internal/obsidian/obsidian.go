@@ -0,0 +1,207 @@
+package obsidian
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Note is a Markdown note of an Obsidian vault
+type Note struct {
+	// Path is relative to the vault, with slashes
+	Path  string
+	Title string
+	// Content is the note without its frontmatter
+	Content string
+	// Tags are from the frontmatter and #tags in the text, lowercased,
+	// nested ones as a/b
+	Tags []string
+	// Links are the targets of its [[wiki-links]] to notes, as written
+	Links   []string
+	Aliases []string
+	// Folders are the directories the note is in, outermost first
+	Folders []string
+}
+
+var (
+	inlineTag = regexp.MustCompile(`(?:^|\s)#([\p{L}\p{N}_/-]*[\p{L}_/-][\p{L}\p{N}_/-]*)`)
+	wikiLink  = regexp.MustCompile(`!?\[\[([^\]|#^]+)(?:[#^][^\]|]*)?(?:\|[^\]]*)?\]\]`)
+	codeFence = regexp.MustCompile("(?ms)^```.*?^```")
+	codeSpan  = regexp.MustCompile("`[^`\n]*`")
+	fileExt   = regexp.MustCompile(`^\.[A-Za-z0-9]{1,5}$`)
+)
+
+// ReadVault reads the Markdown notes of a vault, leaving out hidden
+// directories such as .obsidian and .trash
+func ReadVault(dir string) ([]Note, error) {
+	var notes []Note
+	err := filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if file != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.EqualFold(filepath.Ext(file), ".md") {
+			return nil
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("read note: %w", err)
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		note, err := ParseNote(filepath.ToSlash(rel), string(data))
+		if err != nil {
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+		notes = append(notes, note)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read vault: %w", err)
+	}
+	return notes, nil
+}
+
+// ParseNote parses a note's frontmatter, tags and links
+func ParseNote(rel, text string) (Note, error) {
+	note := Note{Path: rel, Title: strings.TrimSuffix(path.Base(rel), path.Ext(rel))}
+	if dir := path.Dir(rel); dir != "." {
+		note.Folders = strings.Split(dir, "/")
+	}
+
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	body := text
+	if rest, ok := strings.CutPrefix(text, "---\n"); ok {
+		if header, after, ok := strings.Cut(rest, "\n---"); ok {
+			var fm map[string]interface{}
+			if err := yaml.Unmarshal([]byte(header), &fm); err != nil {
+				return Note{}, fmt.Errorf("parse frontmatter: %w", err)
+			}
+			note.Tags = append(note.Tags, stringList(fm["tags"])...)
+			note.Tags = append(note.Tags, stringList(fm["tag"])...)
+			note.Aliases = append(stringList(fm["aliases"]), stringList(fm["alias"])...)
+			if title, ok := fm["title"].(string); ok && title != "" {
+				note.Title = title
+			}
+			if i := strings.Index(after, "\n"); i >= 0 {
+				body = strings.TrimLeft(after[i+1:], "\n")
+			} else {
+				body = ""
+			}
+		}
+	}
+	note.Content = strings.TrimSpace(body)
+
+	// Tags and links in code are examples, not metadata
+	prose := codeSpan.ReplaceAllString(codeFence.ReplaceAllString(body, ""), "")
+	for _, m := range inlineTag.FindAllStringSubmatch(prose, -1) {
+		note.Tags = append(note.Tags, m[1])
+	}
+	note.Tags = normalizeTags(note.Tags)
+
+	seen := make(map[string]bool)
+	for _, m := range wikiLink.FindAllStringSubmatch(prose, -1) {
+		target := strings.TrimSpace(m[1])
+		// Embedded images and other files aren't notes
+		if ext := path.Ext(target); fileExt.MatchString(ext) && !strings.EqualFold(ext, ".md") {
+			continue
+		}
+		if target != "" && !seen[strings.ToLower(target)] {
+			seen[strings.ToLower(target)] = true
+			note.Links = append(note.Links, target)
+		}
+	}
+	return note, nil
+}
+
+// stringList reads a frontmatter value holding a list, or a string of
+// comma or space separated items
+func stringList(v interface{}) []string {
+	var items []string
+	switch v := v.(type) {
+	case string:
+		items = strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' })
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				items = append(items, s)
+			}
+		}
+	}
+	return items
+}
+
+// normalizeTags lowercases tags, drops their # and empty segments, and
+// removes duplicates, keeping their order
+func normalizeTags(tags []string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		var segments []string
+		for _, segment := range strings.Split(strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#")), "/") {
+			if segment != "" {
+				segments = append(segments, segment)
+			}
+		}
+		tag = strings.Join(segments, "/")
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			out = append(out, tag)
+		}
+	}
+	return out
+}
+
+// Resolver finds the notes wiki-links point to, like Obsidian: by path
+// from the vault root, else by title or alias, case insensitively
+type Resolver struct {
+	byPath  map[string]string
+	byTitle map[string]string
+}
+
+// NewResolver indexes notes, to be resolved to the keys given with them
+func NewResolver(notes []Note, keys []string) *Resolver {
+	r := &Resolver{byPath: make(map[string]string), byTitle: make(map[string]string)}
+	// Shorter paths first, so that a title shared by several notes
+	// resolves to the one closest to the root, as Obsidian does
+	order := make([]int, len(notes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return len(notes[order[a]].Path) < len(notes[order[b]].Path) })
+	for _, i := range order {
+		n := notes[i]
+		r.byPath[strings.ToLower(strings.TrimSuffix(n.Path, path.Ext(n.Path)))] = keys[i]
+		for _, name := range append([]string{strings.TrimSuffix(path.Base(n.Path), path.Ext(n.Path)), n.Title}, n.Aliases...) {
+			name = strings.ToLower(name)
+			if _, ok := r.byTitle[name]; !ok {
+				r.byTitle[name] = keys[i]
+			}
+		}
+	}
+	return r
+}
+
+// Resolve returns the key of the note a link target names
+func (r *Resolver) Resolve(target string) (string, bool) {
+	target = strings.ToLower(strings.TrimSuffix(target, ".md"))
+	if key, ok := r.byPath[strings.TrimPrefix(target, "/")]; ok {
+		return key, true
+	}
+	key, ok := r.byTitle[target]
+	return key, ok
+}
@@ -0,0 +1,197 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/journal"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// journalLeaseTTL is how long a crashed process keeps others from
+// opening the journal it wrote
+const journalLeaseTTL = time.Minute
+
+// OpenJournal opens the journal of a capture path other than the API
+// server (see journal.ForSource) and replays what a previous run left
+// pending. A journal is written by one process at a time: while another
+// holds it, OpenJournal returns a nil journal, and captures aren't
+// journaled. Capture under the returned context: it's cancelled, with
+// store.ErrLeaseLost as its cause, if another process takes the journal
+// over. Call close once done capturing.
+func OpenJournal(ctx context.Context, s *store.Store, source string, logger *slog.Logger) (j *journal.Journal, held context.Context, close func(), err error) {
+	host, _ := os.Hostname()
+	owner := fmt.Sprintf("%s:%d", host, os.Getpid())
+	held, release, acquired, err := s.HoldLease(ctx, "journal-"+source, owner, journalLeaseTTL)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if !acquired {
+		logger.Warn("journal in use by another process, captures won't be journaled", "journal", source)
+		return nil, ctx, func() {}, nil
+	}
+
+	j, err = journal.Open(journal.ForSource(s.Dir(), source))
+	if err != nil {
+		release()
+		return nil, nil, nil, err
+	}
+	close = func() {
+		release()
+		j.Close()
+	}
+	if err := Replay(held, s, j, logger); err != nil {
+		close()
+		return nil, nil, nil, err
+	}
+	return j, held, close, nil
+}
+
+// Journals reports whether captures to a notebook ("" for none) are
+// journaled. Captures to an encrypted database or notebook aren't: the
+// journal would keep their content in the clear.
+func Journals(ctx context.Context, s *store.Store, notebook string) (bool, error) {
+	if s.Encrypted() {
+		return false, nil
+	}
+	if notebook == "" {
+		return true, nil
+	}
+	nb, err := s.GetNotebook(ctx, notebook)
+	if err != nil {
+		return false, err
+	}
+	return nb.KeyFrom == "", nil
+}
+
+// Ingest journals a capture in j, then stores it and processes it. A
+// capture whose processing fails or is interrupted stays pending, for
+// Replay to finish. Captures without a notebook go to the one ctx works
+// in; captures to an encrypted database or notebook, or with a nil j,
+// aren't journaled. Nothing is captured once ctx is done: the journal may
+// be another process's by then (see OpenJournal).
+func Ingest(ctx context.Context, s *store.Store, j *journal.Journal, c journal.Capture, opts ProcessOptions) (*Result, error) {
+	if ctx.Err() != nil {
+		return nil, context.Cause(ctx)
+	}
+	c.User = store.UserID(ctx)
+	if c.Notebook == "" {
+		c.Notebook = s.Notebook(ctx)
+	}
+	if j != nil {
+		journaled, err := Journals(ctx, s, c.Notebook)
+		if err != nil {
+			return nil, err
+		}
+		if !journaled {
+			j = nil
+		}
+	}
+	if j != nil {
+		if err := j.Append(&c); err != nil {
+			return nil, err
+		}
+	}
+	return Complete(ctx, s, j, c, "", opts)
+}
+
+// StoreCapture saves a capture as an entry, marks it stored in j (nil when
+// it isn't journaled) and records where its URL was seen. Once the entry
+// is saved, failures are only reported as problems: the capture is safe.
+func StoreCapture(ctx context.Context, s *store.Store, j *journal.Journal, c journal.Capture) (*domain.Entry, []string, error) {
+	entry, err := s.AddEntryToNotebook(ctx, c.Notebook, c.Content, c.Source)
+	if err != nil {
+		return nil, nil, err
+	}
+	if j != nil {
+		if err := j.Stored(c.ID, entry.ID); err != nil {
+			slog.Warn("journal capture", "capture", c.ID, "err", err)
+		}
+	}
+	var problems []string
+	if c.URL != "" {
+		if _, err := s.AddSourceOccurrence(ctx, entry.ID, c.Via, c.URL); err != nil {
+			problems = append(problems, "sighting not recorded: "+err.Error())
+		}
+	}
+	return entry, problems, nil
+}
+
+// Complete stores a capture unless it already was (as entryID), then
+// processes it and marks it done in j (nil when it isn't journaled). A
+// capture cut short by ctx is left pending.
+func Complete(ctx context.Context, s *store.Store, j *journal.Journal, c journal.Capture, entryID string, opts ProcessOptions) (*Result, error) {
+	var entry *domain.Entry
+	var problems []string
+	var err error
+	if entryID != "" {
+		if entry, err = s.GetEntry(ctx, entryID); err != nil {
+			return nil, err
+		}
+	} else if entry, problems, err = StoreCapture(ctx, s, j, c); err != nil {
+		return nil, err
+	}
+
+	opts.NoClassify = opts.NoClassify || c.NoClassify
+	res := Process(ctx, s, entry, c.Content, opts)
+	res.Problems = append(problems, res.Problems...)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if j != nil {
+		if err := j.Done(c.ID); err != nil {
+			slog.Warn("journal capture", "capture", c.ID, "err", err)
+		}
+	}
+	return res, nil
+}
+
+// Replay finishes the captures a previous run journaled but didn't
+// complete, as their user and in their notebook, then compacts the
+// journal. A capture failing again is logged and left for the next
+// replay; after journal.MaxAttempts replays, it's quarantined instead.
+func Replay(ctx context.Context, s *store.Store, j *journal.Journal, logger *slog.Logger) error {
+	pending, err := j.Pending()
+	if err != nil {
+		return err
+	}
+	for _, p := range pending {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		ctx := store.WithNotebook(store.WithUser(ctx, p.User), p.Notebook)
+		if p.EntryID != "" {
+			if _, err := s.GetEntry(ctx, p.EntryID); err != nil {
+				// Stored, then deleted since
+				j.Done(p.ID)
+				continue
+			}
+		}
+		if p.Attempts >= journal.MaxAttempts {
+			reason := fmt.Sprintf("failed %d replays", p.Attempts)
+			if err := j.Quarantine(p, reason); err != nil {
+				return err
+			}
+			logger.Warn("quarantined capture", "capture", p.ID, "entry", p.EntryID, "captured_at", p.At, "reason", reason)
+			continue
+		}
+
+		if err := j.Attempt(p.ID); err != nil {
+			return err
+		}
+		res, err := Complete(ctx, s, j, p.Capture, p.EntryID, ProcessOptions{})
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			logger.Warn("replay capture", "capture", p.ID, "attempt", p.Attempts+1, "err", err)
+			continue
+		}
+		logger.Info("replayed capture", "capture", p.ID, "entry", res.Entry.ID, "captured_at", p.At)
+	}
+	return j.Compact()
+}
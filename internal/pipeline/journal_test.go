@@ -0,0 +1,170 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pbaille/kb/internal/journal"
+	"github.com/pbaille/kb/internal/store"
+)
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func newTestStore(t *testing.T) *store.Store {
+	t.Helper()
+	// Processing embeds entries when it can: not in tests
+	t.Setenv("VOYAGE_API_KEY", "")
+	s, err := store.Open(filepath.Join(t.TempDir(), "kb.db"), store.StoreOptions{})
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestReplay(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	j, err := journal.Open(journal.ForSource(s.Dir(), "test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	u, err := s.AddUser(ctx, "alice", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A crash left one capture unstored, one stored but not processed,
+	// and one of alice's unstored
+	unstored := journal.Capture{Content: "never stored", NoClassify: true}
+	stored := journal.Capture{Content: "stored only", NoClassify: true}
+	users := journal.Capture{Content: "alice's", NoClassify: true, User: u.ID}
+	for _, c := range []*journal.Capture{&unstored, &stored, &users} {
+		if err := j.Append(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entry, err := s.AddEntry(ctx, stored.Content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Stored(stored.ID, entry.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Replay(ctx, s, j, discard); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := j.Pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("%d captures still pending after replay", len(pending))
+	}
+
+	// Each capture is stored once, as its user
+	owners, err := s.ListEntries(ctx, "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var contents []string
+	for _, e := range owners {
+		contents = append(contents, e.Content)
+	}
+	if len(owners) != 2 || !containsAll(contents, "never stored", "stored only") {
+		t.Errorf("owner's entries after replay = %q, want the two owner captures once each", contents)
+	}
+	alices, err := s.ListEntries(store.WithUser(ctx, u.ID), "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alices) != 1 || alices[0].Content != "alice's" {
+		t.Errorf("alice's entries after replay = %d, want her capture", len(alices))
+	}
+
+	// Nothing is left to replay again
+	if err := Replay(ctx, s, j, discard); err != nil {
+		t.Fatal(err)
+	}
+	if again, err := s.ListEntries(ctx, "", 0, 0); err != nil || len(again) != len(owners) {
+		t.Errorf("entries after a second replay = %d, %v, want %d", len(again), err, len(owners))
+	}
+}
+
+func TestOpenJournal(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	// No journal while another process holds it
+	if ok, err := s.AcquireLease(ctx, "journal-test", "other:1", time.Minute); err != nil || !ok {
+		t.Fatalf("AcquireLease = %v, %v", ok, err)
+	}
+	j, held, closeJournal, err := OpenJournal(ctx, s, "test", discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j != nil || held != ctx {
+		t.Error("OpenJournal returned a journal another process holds")
+	}
+	closeJournal()
+
+	// Once it's released, captures are journaled
+	if err := s.ReleaseLease(ctx, "journal-test", "other:1"); err != nil {
+		t.Fatal(err)
+	}
+	j, held, closeJournal, err = OpenJournal(ctx, s, "test", discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j == nil {
+		t.Fatal("OpenJournal returned no journal on a free lease")
+	}
+	defer closeJournal()
+	res, err := Ingest(held, s, j, journal.Capture{Content: "journaled", NoClassify: true}, ProcessOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending, err := j.Pending(); err != nil || len(pending) != 0 {
+		t.Errorf("pending after Ingest = %d, %v, want none", len(pending), err)
+	}
+	if _, err := s.GetEntry(ctx, res.Entry.ID); err != nil {
+		t.Errorf("ingested entry: %v", err)
+	}
+	if ok, err := s.AcquireLease(ctx, "journal-test", "other:1", time.Minute); err != nil || ok {
+		t.Errorf("another process took the journal while held: %v, %v", ok, err)
+	}
+}
+
+func TestIngestLeaseLost(t *testing.T) {
+	s := newTestStore(t)
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(store.ErrLeaseLost)
+
+	_, err := Ingest(ctx, s, nil, journal.Capture{Content: "too late", NoClassify: true}, ProcessOptions{})
+	if !errors.Is(err, store.ErrLeaseLost) {
+		t.Fatalf("Ingest after the lease was lost: %v, want ErrLeaseLost", err)
+	}
+	if entries, err := s.ListEntries(context.Background(), "", 0, 0); err != nil || len(entries) != 0 {
+		t.Errorf("entries = %d, %v, want none stored", len(entries), err)
+	}
+}
+
+func containsAll(values []string, want ...string) bool {
+	seen := make(map[string]bool)
+	for _, v := range values {
+		seen[v] = true
+	}
+	for _, w := range want {
+		if !seen[w] {
+			return false
+		}
+	}
+	return true
+}
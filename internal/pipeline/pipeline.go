@@ -0,0 +1,227 @@
+// Package pipeline processes captured entries: Process classifies them,
+// runs the rules and embeds them the same way for every capture path.
+// Entries and their passages are embedded together, in batches of up to
+// the embedding service's limit with a bounded number of requests at
+// once, so importing hundreds of documents takes a few requests rather
+// than one or two per entry.
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/embedding"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// Options configures how a Pipeline batches its requests
+type Options struct {
+	// BatchSize is the most texts sent in one request, up to
+	// embedding.MaxBatchSize
+	BatchSize int
+	// Workers is the most requests running at once
+	Workers int
+	// Progress, if set, is called with the number of entries saved so far
+	// each time one is, one call at a time
+	Progress func(saved int)
+}
+
+// DefaultOptions returns options filling batches to the service's limit
+func DefaultOptions() Options {
+	return Options{BatchSize: embedding.MaxBatchSize, Workers: 4}
+}
+
+// Pipeline embeds the entries added to it and saves their embeddings.
+// Add entries from one goroutine, then Wait for them to be saved.
+type Pipeline struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	store  *store.Store
+	embSvc *embedding.Service
+	opts   Options
+
+	// queue holds the texts not sent yet, less than a batch
+	queue   []text
+	workers chan struct{}
+	wg      sync.WaitGroup
+
+	mu    sync.Mutex
+	saved int
+	err   error
+}
+
+// entry is an entry being embedded; pending counts its texts not embedded
+// yet
+type entry struct {
+	id           string
+	vector       []float64
+	chunks       []domain.Chunk
+	passagesOnly bool
+	pending      int
+}
+
+// text is the content of an entry, or one of its passages (chunk >= 0)
+type text struct {
+	entry *entry
+	chunk int
+	value string
+}
+
+// New creates a Pipeline saving to s the embeddings embSvc computes.
+// Canceling ctx stops it.
+func New(ctx context.Context, s *store.Store, embSvc *embedding.Service, opts Options) *Pipeline {
+	if opts.BatchSize < 1 || opts.BatchSize > embedding.MaxBatchSize {
+		opts.BatchSize = embedding.MaxBatchSize
+	}
+	opts.Workers = max(opts.Workers, 1)
+	ctx, cancel := context.WithCancel(ctx)
+	return &Pipeline{
+		ctx:     ctx,
+		cancel:  cancel,
+		store:   s,
+		embSvc:  embSvc,
+		opts:    opts,
+		workers: make(chan struct{}, opts.Workers),
+	}
+}
+
+// Embed computes and saves the embeddings of an entry and its passages,
+// in one request unless it has more passages than a batch holds, and
+// returns the entry's
+func Embed(ctx context.Context, s *store.Store, embSvc *embedding.Service, entryID, content string) ([]float64, error) {
+	p := New(ctx, s, embSvc, DefaultOptions())
+	e := p.add(entryID, content, false)
+	if _, err := p.Wait(); err != nil {
+		return nil, err
+	}
+	return e.vector, nil
+}
+
+// Add queues an entry to embed, with its passages when it's long,
+// sending a batch when one is full. It waits for a worker to take it when
+// all are busy.
+func (p *Pipeline) Add(entryID, content string) {
+	p.add(entryID, content, false)
+}
+
+// AddPassages queues the passages of an entry already embedded as a whole
+func (p *Pipeline) AddPassages(entryID, content string) {
+	p.add(entryID, content, true)
+}
+
+func (p *Pipeline) add(entryID, content string, passagesOnly bool) *entry {
+	e := &entry{id: entryID, chunks: embedding.Chunk(content), passagesOnly: passagesOnly}
+	e.pending = len(e.chunks)
+	if !passagesOnly {
+		e.pending++
+		p.queue = append(p.queue, text{entry: e, chunk: -1, value: content})
+	}
+	for i, c := range e.chunks {
+		p.queue = append(p.queue, text{entry: e, chunk: i, value: content[c.Start:c.End]})
+	}
+	for len(p.queue) >= p.opts.BatchSize {
+		p.send(p.queue[:p.opts.BatchSize])
+		p.queue = append([]text(nil), p.queue[p.opts.BatchSize:]...)
+	}
+	return e
+}
+
+// Wait sends the texts left, waits for every entry added to be saved and
+// returns how many were. Embedding stops at the first error, returned.
+func (p *Pipeline) Wait() (int, error) {
+	if len(p.queue) > 0 {
+		p.send(p.queue)
+		p.queue = nil
+	}
+	p.wg.Wait()
+	p.cancel()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.saved, p.err
+}
+
+// send embeds a batch in a worker, once one is free
+func (p *Pipeline) send(batch []text) {
+	select {
+	case p.workers <- struct{}{}:
+	case <-p.ctx.Done():
+		p.fail(p.ctx.Err())
+		return
+	}
+	p.wg.Add(1)
+	go func() {
+		defer func() {
+			<-p.workers
+			p.wg.Done()
+		}()
+
+		values := make([]string, len(batch))
+		for i, t := range batch {
+			values[i] = t.value
+		}
+		vectors, err := p.embSvc.EmbedBatch(p.ctx, values)
+		if err == nil && len(vectors) != len(batch) {
+			err = fmt.Errorf("got %d vectors for %d texts", len(vectors), len(batch))
+		}
+		if err != nil {
+			p.fail(fmt.Errorf("embed batch: %w", err))
+			return
+		}
+		for i, t := range batch {
+			if p.embedded(t, vectors[i]) {
+				if err := p.save(t.entry); err != nil {
+					p.fail(err)
+					return
+				}
+			}
+		}
+	}()
+}
+
+// embedded records the vector of a text, reporting whether it was the
+// last of its entry
+func (p *Pipeline) embedded(t text, vector []float64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if t.chunk < 0 {
+		t.entry.vector = vector
+	} else {
+		t.entry.chunks[t.chunk].Vector = vector
+	}
+	t.entry.pending--
+	return t.entry.pending == 0
+}
+
+// save stores the embeddings of an entry, replacing the passages it had
+// (none, for an entry short enough to be embedded whole)
+func (p *Pipeline) save(e *entry) error {
+	if !e.passagesOnly {
+		if err := p.store.SaveEmbedding(p.ctx, e.id, e.vector, p.embSvc.Model()); err != nil {
+			return err
+		}
+	}
+	if err := p.store.SaveChunks(p.ctx, e.id, e.chunks, p.embSvc.Model()); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.saved++
+	if p.opts.Progress != nil {
+		p.opts.Progress(p.saved)
+	}
+	return nil
+}
+
+// fail records the first error and stops the requests still to come
+func (p *Pipeline) fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err == nil {
+		p.err = err
+		p.cancel()
+	}
+}
@@ -0,0 +1,172 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pbaille/kb/internal/classifier"
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/embedding"
+	"github.com/pbaille/kb/internal/rules"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// ProcessOptions configures Process
+type ProcessOptions struct {
+	// NoClassify skips the pre-taggers and the classifier
+	NoClassify bool
+	// Similar is how many similar entries to look up once the entry is
+	// embedded, 0 for none
+	Similar int
+}
+
+// Result is what processing an entry did
+type Result struct {
+	// Entry is the entry as processing left it, with its tags
+	Entry *domain.Entry
+	// UnresolvedLinks are the [[wiki-links]] no entry matches
+	UnresolvedLinks []string
+	// Classification is nil when classification was skipped or failed
+	// without a tag
+	Classification *Classification
+	Rules          []rules.Result
+	Similar        []store.SimilarEntry
+	// Problems describe the steps that failed, e.g. "embedding skipped:
+	// ..."
+	Problems []string
+}
+
+// Classification is what Classify did to an entry
+type Classification struct {
+	// Tags are the calibrated suggestions linked to the entry
+	Tags []classifier.TagSuggestion
+	// Title is the generated title, set when the entry needed one
+	Title string
+	// Warnings are the tags that couldn't be created or linked
+	Warnings []string
+}
+
+// Process runs a newly stored entry, whose content (in the clear) is
+// content, through the steps every capture path shares, whichever way it
+// was captured (kb add, the API, the bot, feeds, the TUI, MCP): its
+// [[wiki-links]] are linked, it's classified unless disabled, run through
+// the rules and embedded. Only storing a capture can fail; steps that go
+// wrong afterwards are reported in the result.
+func Process(ctx context.Context, s *store.Store, entry *domain.Entry, content string, opts ProcessOptions) *Result {
+	res := &Result{Entry: entry}
+	unresolved, err := s.LinkWikiLinks(ctx, entry.ID, content)
+	if err != nil {
+		res.Problems = append(res.Problems, "wiki-links skipped: "+err.Error())
+	}
+	res.UnresolvedLinks = unresolved
+
+	if !opts.NoClassify {
+		c, err := Classify(ctx, s, entry.ID, content)
+		res.Classification = c
+		if err != nil {
+			res.Problems = append(res.Problems, "classification skipped: "+err.Error())
+		}
+		if c != nil {
+			res.Problems = append(res.Problems, c.Warnings...)
+		}
+	}
+
+	// Rules run after classification so tag conditions see the new tags
+	results, err := rules.New(s).Apply(ctx, entry.ID)
+	if err != nil {
+		res.Problems = append(res.Problems, "rules failed: "+err.Error())
+	}
+	res.Rules = results
+
+	if embSvc, err := embedding.New(); err == nil {
+		vector, err := Embed(ctx, s, embSvc, entry.ID, content)
+		if err != nil {
+			res.Problems = append(res.Problems, "embedding skipped: "+err.Error())
+		} else if opts.Similar > 0 {
+			res.Similar, _ = s.FindSimilar(ctx, vector, opts.Similar, entry.ID)
+		}
+	}
+
+	if refreshed, err := s.GetEntry(ctx, entry.ID); err == nil {
+		res.Entry = refreshed
+	}
+	return res
+}
+
+// Classify tags an entry with the pre-taggers and the classifier, links
+// the suggested tags (creating them and their parents as needed) and
+// titles the entry if it needs one. A failed classifier call still links
+// the pre-tagger tags, returning them with the error.
+func Classify(ctx context.Context, s *store.Store, entryID, content string) (*Classification, error) {
+	result, err := Suggest(ctx, s, content)
+	if result == nil {
+		return nil, err
+	}
+
+	c := &Classification{}
+	c.Tags, c.Warnings = ApplyTags(ctx, s, entryID, result.Tags)
+	if titled, titleErr := s.TitleEntry(ctx, entryID, result.Title); titleErr != nil {
+		c.Warnings = append(c.Warnings, "title skipped: "+titleErr.Error())
+	} else if titled {
+		c.Title = strings.TrimSpace(result.Title)
+	}
+	return c, err
+}
+
+// ApplyTags links suggested tags to an entry, creating them and their
+// parents as needed. It returns the tags it linked, and warnings about
+// those it couldn't.
+func ApplyTags(ctx context.Context, s *store.Store, entryID string, suggestions []classifier.TagSuggestion) ([]classifier.TagSuggestion, []string) {
+	var linked []classifier.TagSuggestion
+	var warnings []string
+	for _, suggestion := range suggestions {
+		var parentID *string
+		if suggestion.Parent != "" {
+			parent, err := s.GetOrCreateTag(ctx, suggestion.Parent, nil)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("couldn't create parent tag %s: %v", suggestion.Parent, err))
+			} else {
+				parentID = &parent.ID
+			}
+		}
+		tag, err := s.GetOrCreateTag(ctx, suggestion.Name, parentID)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("couldn't create tag %s: %v", suggestion.Name, err))
+			continue
+		}
+		if err := s.LinkEntryTag(ctx, entryID, tag.ID, suggestion.Confidence); err != nil {
+			warnings = append(warnings, fmt.Sprintf("couldn't link tag %s: %v", suggestion.Name, err))
+			continue
+		}
+		linked = append(linked, suggestion)
+	}
+	return linked, warnings
+}
+
+// Suggest runs the pre-taggers and the classifier on content, with
+// confidences scaled by how often each tag was kept in the past, saving
+// nothing. A failed classifier call still returns the pre-tagger tags,
+// with the error.
+func Suggest(ctx context.Context, s *store.Store, content string) (*classifier.ClassifyResult, error) {
+	taggers, err := s.ListPreTaggers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pre-taggers still apply without an API key
+	clf, err := classifier.New()
+	if err != nil && len(taggers) == 0 {
+		return nil, err
+	}
+
+	existingTags, _ := s.ClassifierTags(ctx)
+
+	result, err := classifier.ClassifyWithPreTags(ctx, clf, content, existingTags, taggers)
+	if result == nil {
+		return nil, err
+	}
+	factors, _ := s.CalibrationFactors(ctx)
+	result.Tags = classifier.Calibrate(result.Tags, factors)
+	return result, err
+}
@@ -0,0 +1,181 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type token struct {
+	// kind is "(", ")", "-" for a negation, an operator or a term
+	kind string
+	text string
+	// field and value are those of terms
+	field, value string
+}
+
+const kindTerm = "term"
+
+// lex splits a query into tokens
+func lex(input string) ([]token, error) {
+	var tokens []token
+	rs := []rune(input)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			tokens = append(tokens, token{kind: string(r), text: string(r)})
+			i++
+		case r == '-' && i+1 < len(rs) && !unicode.IsSpace(rs[i+1]) && rs[i+1] != ')':
+			tokens = append(tokens, token{kind: "-", text: "-"})
+			i++
+		case r == '"':
+			value, next, err := quoted(rs, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: kindTerm, text: string(rs[i:next]), value: value})
+			i = next
+		default:
+			start := i
+			for i < len(rs) && !unicode.IsSpace(rs[i]) && rs[i] != '(' && rs[i] != ')' && rs[i] != '"' {
+				i++
+			}
+			word := string(rs[start:i])
+			if word == "AND" || word == "OR" || word == "NOT" {
+				tokens = append(tokens, token{kind: word, text: word})
+				continue
+			}
+
+			t := token{kind: kindTerm, text: word, value: word}
+			if field, value, ok := strings.Cut(word, ":"); ok && fields[strings.ToLower(field)] {
+				t.field, t.value = strings.ToLower(field), value
+				// tag:"machine learning"
+				if value == "" && i < len(rs) && rs[i] == '"' {
+					quotedValue, next, err := quoted(rs, i)
+					if err != nil {
+						return nil, err
+					}
+					t.text, t.value, i = string(rs[start:next]), quotedValue, next
+				}
+				if t.value == "" {
+					return nil, fmt.Errorf("%w: %s: needs a value", ErrSyntax, t.field)
+				}
+			}
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens, nil
+}
+
+// quoted reads the phrase in quotes starting at rs[start], returning it and
+// the position after the closing quote
+func quoted(rs []rune, start int) (string, int, error) {
+	for end := start + 1; end < len(rs); end++ {
+		if rs[end] == '"' {
+			phrase := strings.TrimSpace(string(rs[start+1 : end]))
+			if phrase == "" {
+				return "", 0, fmt.Errorf("%w: empty quotes", ErrSyntax)
+			}
+			return phrase, end + 1, nil
+		}
+	}
+	return "", 0, fmt.Errorf("%w: unclosed quote", ErrSyntax)
+}
+
+// parser reads tokens by precedence: or > and > not > terms and groups
+type parser struct {
+	tokens []token
+	pos    int
+	now    time.Time
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos].kind
+	}
+	return ""
+}
+
+func (p *parser) or() (*node, error) {
+	return p.list(opOr, "OR", p.and)
+}
+
+func (p *parser) and() (*node, error) {
+	return p.list(opAnd, "AND", p.not)
+}
+
+// list reads operands separated by an operator; AND may be left out
+func (p *parser) list(op, keyword string, operand func() (*node, error)) (*node, error) {
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	n := &node{op: op, children: []*node{first}}
+	for {
+		switch next := p.peek(); {
+		case next == keyword:
+			p.pos++
+		case op == opAnd && next != "" && next != ")" && next != "OR":
+		default:
+			if len(n.children) == 1 {
+				return first, nil
+			}
+			return n, nil
+		}
+		c, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		n.children = append(n.children, c)
+	}
+}
+
+func (p *parser) not() (*node, error) {
+	if next := p.peek(); next == "NOT" || next == "-" {
+		p.pos++
+		c, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return &node{op: opNot, children: []*node{c}}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (*node, error) {
+	if p.pos == len(p.tokens) {
+		return nil, fmt.Errorf("%w: unexpected end", ErrSyntax)
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	switch t.kind {
+	case "(":
+		n, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("%w: unclosed parenthesis", ErrSyntax)
+		}
+		p.pos++
+		return n, nil
+	case kindTerm:
+		n := &node{op: opTerm, field: t.field, value: t.value}
+		if t.field == FieldBefore || t.field == FieldAfter {
+			at, err := ParseDate(t.value, p.now, t.field == FieldAfter)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrSyntax, err)
+			}
+			n.at = at
+		}
+		if t.field == FieldSource {
+			n.value = strings.ToLower(n.value)
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("%w: unexpected %q", ErrSyntax, t.text)
+}
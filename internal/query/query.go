@@ -0,0 +1,243 @@
+// Package query parses search queries into SQL conditions on entries.
+//
+// A query is words and "quoted phrases" an entry must all contain, in its
+// content or title, combined with OR, NOT (or a leading -) and parentheses:
+//
+//	golang (channels OR "worker pool") -tutorial
+//
+// and filters on its fields:
+//
+//	tag:golang          tagged golang, or a tag under it (a name, alias or path)
+//	before:2024-06-01   created before that day; after: from the day after
+//	after:30d           created in the last 30 days (d, w, or a Go duration)
+//	source:url          from a URL; note, file, clip or email likewise,
+//	source:example.com  from a URL containing the text
+//
+// AND is implied between terms; NOT binds tighter than AND, AND than OR.
+// Operators are upper case: "and", "or" and "not" are words.
+package query
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// ErrSyntax is returned for queries that can't be parsed
+var ErrSyntax = errors.New("invalid query")
+
+// Fields filtering entries
+const (
+	FieldTag    = "tag"
+	FieldBefore = "before"
+	FieldAfter  = "after"
+	FieldSource = "source"
+)
+
+var fields = map[string]bool{FieldTag: true, FieldBefore: true, FieldAfter: true, FieldSource: true}
+
+// likeEscaper escapes the wildcards of a LIKE pattern, for ESCAPE '\'
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// Query is a parsed search query
+type Query struct {
+	root *node
+}
+
+// Kinds of nodes
+const (
+	opAnd  = "and"
+	opOr   = "or"
+	opNot  = "not"
+	opTerm = "term"
+)
+
+type node struct {
+	op       string
+	children []*node
+	// field is "" for text terms
+	field string
+	value string
+	// at is the time of before: and after: terms
+	at time.Time
+}
+
+// Parse parses a query, reading relative dates from now
+func Parse(input string, now time.Time) (*Query, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%w: nothing to search for", ErrSyntax)
+	}
+	p := &parser{tokens: tokens, now: now}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrSyntax, p.tokens[p.pos].text)
+	}
+	return &Query{root: root}, nil
+}
+
+// SQLOptions adapts the conditions of a query to the database
+type SQLOptions struct {
+	// Text is the condition of entries containing a word or a phrase
+	Text func(text string) (string, []interface{})
+	// Tag is the condition of entries tagged with a tag or a tag under it
+	Tag func(ref string) (string, []interface{})
+	// Opaque, if set, is the condition of entries whose text can't be
+	// matched in the database, such as encrypted ones: their text terms
+	// are unknown, so they're returned to be checked with Match
+	Opaque     string
+	OpaqueArgs []interface{}
+}
+
+// SQL returns the condition on entries, aliased e, the query stands for,
+// with its arguments
+func (q *Query) SQL(opts SQLOptions) (string, []interface{}) {
+	var args []interface{}
+	var build func(n *node) string
+	build = func(n *node) string {
+		switch n.op {
+		case opAnd, opOr:
+			parts := make([]string, len(n.children))
+			for i, c := range n.children {
+				parts[i] = build(c)
+			}
+			return "(" + strings.Join(parts, " "+strings.ToUpper(n.op)+" ") + ")"
+		case opNot:
+			return "(NOT " + build(n.children[0]) + ")"
+		}
+
+		switch n.field {
+		case FieldTag:
+			cond, condArgs := opts.Tag(n.value)
+			args = append(args, condArgs...)
+			return cond
+		case FieldBefore:
+			args = append(args, n.at.UTC())
+			return "julianday(e.created_at) < julianday(?)"
+		case FieldAfter:
+			args = append(args, n.at.UTC())
+			return "julianday(e.created_at) >= julianday(?)"
+		case FieldSource:
+			if slices.Contains(domain.SourceTypes, n.value) {
+				args = append(args, n.value)
+				return "e.source_type = ?"
+			}
+			args = append(args, "%"+likeEscaper.Replace(n.value)+"%")
+			return `lower(e.source_url) LIKE ? ESCAPE '\'`
+		}
+
+		cond, condArgs := opts.Text(n.value)
+		if opts.Opaque == "" {
+			args = append(args, condArgs...)
+			return cond
+		}
+		args = append(append(args, opts.OpaqueArgs...), condArgs...)
+		return "(CASE WHEN " + opts.Opaque + " THEN NULL ELSE " + cond + " END)"
+	}
+
+	cond := build(q.root)
+	if opts.Opaque != "" {
+		// Unknown is kept, for Match to decide
+		cond = "(" + cond + ") IS NOT FALSE"
+	}
+	return cond, args
+}
+
+// Match reports whether a loaded entry, with its tags and their paths,
+// matches the query
+func (q *Query) Match(e *domain.Entry) bool {
+	var match func(n *node) bool
+	match = func(n *node) bool {
+		switch n.op {
+		case opAnd:
+			for _, c := range n.children {
+				if !match(c) {
+					return false
+				}
+			}
+			return true
+		case opOr:
+			for _, c := range n.children {
+				if match(c) {
+					return true
+				}
+			}
+			return false
+		case opNot:
+			return !match(n.children[0])
+		}
+
+		switch n.field {
+		case FieldTag:
+			for _, t := range e.Tags {
+				if underTag(t, n.value) {
+					return true
+				}
+			}
+			return false
+		case FieldBefore:
+			return e.CreatedAt.Before(n.at)
+		case FieldAfter:
+			return !e.CreatedAt.Before(n.at)
+		case FieldSource:
+			if slices.Contains(domain.SourceTypes, n.value) {
+				return e.Source.Type == n.value
+			}
+			return containsFold(e.Source.URL, n.value)
+		}
+		return containsFold(e.Content, n.value) || containsFold(e.Source.Title, n.value)
+	}
+	return match(q.root)
+}
+
+// underTag reports whether a tag is the tag ref names, by name or path, or
+// one under it
+func underTag(t domain.Tag, ref string) bool {
+	path := t.Path
+	if path == "" {
+		path = t.Name
+	}
+	if strings.EqualFold(t.Name, ref) {
+		return true
+	}
+	path, ref = "/"+strings.ToLower(path)+"/", "/"+strings.ToLower(strings.Trim(ref, "/"))+"/"
+	return strings.Contains(path, ref)
+}
+
+func containsFold(text, sub string) bool {
+	return strings.Contains(strings.ToLower(text), strings.ToLower(sub))
+}
+
+// ParseDate reads a time to compare creation times to: the start of a
+// day, "2024-06-01", or its end with end set, or how long ago, "30d", "2w"
+// or a Go duration, "12h"
+func ParseDate(value string, now time.Time, end bool) (time.Time, error) {
+	if day, err := time.ParseInLocation("2006-01-02", value, now.Location()); err == nil {
+		if end {
+			day = day.AddDate(0, 0, 1)
+		}
+		return day, nil
+	}
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(value, suffix); ok {
+			if v, err := strconv.Atoi(n); err == nil && v > 0 {
+				return now.Add(-time.Duration(v) * unit), nil
+			}
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q (e.g. 2024-06-01, 30d, 2w)", value)
+}
@@ -0,0 +1,194 @@
+package query
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+var now = time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+
+// testSQL renders text terms as t(?) and tag terms as g(?)
+var testSQL = SQLOptions{
+	Text: func(text string) (string, []interface{}) { return "t(?)", []interface{}{text} },
+	Tag:  func(ref string) (string, []interface{}) { return "g(?)", []interface{}{ref} },
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query string
+		sql   string
+		args  []interface{}
+	}{
+		{"golang", "t(?)", []interface{}{"golang"}},
+		{"golang channels", "(t(?) AND t(?))", []interface{}{"golang", "channels"}},
+		{"golang AND channels", "(t(?) AND t(?))", []interface{}{"golang", "channels"}},
+		{"a-b", "t(?)", []interface{}{"a-b"}},
+		{"and or not", "(t(?) AND t(?) AND t(?))", []interface{}{"and", "or", "not"}},
+		{`"worker pool"`, "t(?)", []interface{}{"worker pool"}},
+		{
+			`golang (channels OR "worker pool") -tutorial`,
+			"(t(?) AND (t(?) OR t(?)) AND (NOT t(?)))",
+			[]interface{}{"golang", "channels", "worker pool", "tutorial"},
+		},
+		// NOT binds tighter than AND, AND than OR
+		{"a OR b c", "(t(?) OR (t(?) AND t(?)))", []interface{}{"a", "b", "c"}},
+		{"NOT a b", "((NOT t(?)) AND t(?))", []interface{}{"a", "b"}},
+		{"NOT NOT a", "(NOT (NOT t(?)))", []interface{}{"a"}},
+		{"(a OR b) c", "((t(?) OR t(?)) AND t(?))", []interface{}{"a", "b", "c"}},
+		{"tag:golang", "g(?)", []interface{}{"golang"}},
+		{"TAG:golang", "g(?)", []interface{}{"golang"}},
+		{`tag:"machine learning"`, "g(?)", []interface{}{"machine learning"}},
+		{"-tag:draft", "(NOT g(?))", []interface{}{"draft"}},
+		{"source:url", "e.source_type = ?", []interface{}{"url"}},
+		{"source:Example.com", `lower(e.source_url) LIKE ? ESCAPE '\'`, []interface{}{"%example.com%"}},
+		{"source:a_b%c", `lower(e.source_url) LIKE ? ESCAPE '\'`, []interface{}{`%a\_b\%c%`}},
+		{"before:2024-06-01", "julianday(e.created_at) < julianday(?)", []interface{}{time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)}},
+		// after: a day starts from the day after
+		{"after:2024-06-01", "julianday(e.created_at) >= julianday(?)", []interface{}{time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)}},
+		{"after:30d", "julianday(e.created_at) >= julianday(?)", []interface{}{now.AddDate(0, 0, -30)}},
+		{"after:2w", "julianday(e.created_at) >= julianday(?)", []interface{}{now.AddDate(0, 0, -14)}},
+		{"after:12h", "julianday(e.created_at) >= julianday(?)", []interface{}{now.Add(-12 * time.Hour)}},
+		// Not a field: a word with a colon
+		{"note:this", "t(?)", []interface{}{"note:this"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := Parse(tt.query, now)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			sql, args := q.SQL(testSQL)
+			if sql != tt.sql {
+				t.Errorf("SQL = %s, want %s", sql, tt.sql)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args = %v, want %v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"   ",
+		"(a",
+		"a)",
+		"()",
+		"a OR",
+		"NOT",
+		"tag:",
+		`"unclosed`,
+		"before:yesterday",
+		"after:-3d",
+	}
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			if _, err := Parse(input, now); !errors.Is(err, ErrSyntax) {
+				t.Errorf("Parse(%q) error = %v, want ErrSyntax", input, err)
+			}
+		})
+	}
+}
+
+func TestSQLOpaque(t *testing.T) {
+	q, err := Parse("a -tag:b", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := testSQL
+	opts.Opaque, opts.OpaqueArgs = "o(?)", []interface{}{"x"}
+	sql, args := q.SQL(opts)
+	want := "(((CASE WHEN o(?) THEN NULL ELSE t(?) END) AND (NOT g(?)))) IS NOT FALSE"
+	if sql != want {
+		t.Errorf("SQL = %s, want %s", sql, want)
+	}
+	if wantArgs := []interface{}{"x", "a", "b"}; !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("args = %v, want %v", args, wantArgs)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	entry := &domain.Entry{
+		Content:   "Worker pools in Go use channels",
+		CreatedAt: time.Date(2024, 6, 15, 10, 0, 0, 0, time.UTC),
+		Source:    domain.Source{Type: domain.SourceURL, URL: "https://go.dev/blog/pipelines", Title: "Pipelines"},
+		Tags:      []domain.Tag{{Name: "concurrency", Path: "programming/golang/concurrency"}},
+	}
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"channels", true},
+		{"CHANNELS", true},
+		{"pipelines", true},
+		{"rust", false},
+		{`"worker pools"`, true},
+		{`"pools worker"`, false},
+		{"channels rust", false},
+		{"channels OR rust", true},
+		{"-rust", true},
+		{"NOT channels", false},
+		{"tag:concurrency", true},
+		{"tag:golang", true},
+		{"tag:programming/golang", true},
+		{"tag:lang", false},
+		{"tag:rust", false},
+		{"source:url", true},
+		{"source:note", false},
+		{"source:go.dev", true},
+		{"source:go_dev", false},
+		{"before:2024-06-15", false},
+		{"before:2024-06-16", true},
+		{"after:2024-06-14", true},
+		{"after:2024-06-15", false},
+		{"after:30d", true},
+		{"after:7d", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := Parse(tt.query, now)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if got := q.Match(entry); got != tt.want {
+				t.Errorf("Match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		value string
+		end   bool
+		want  time.Time
+	}{
+		{"2024-06-01", false, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"2024-06-01", true, time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)},
+		{"30d", false, now.AddDate(0, 0, -30)},
+		{"30d", true, now.AddDate(0, 0, -30)},
+		{"2w", false, now.AddDate(0, 0, -14)},
+		{"90m", false, now.Add(-90 * time.Minute)},
+	}
+	for _, tt := range tests {
+		got, err := ParseDate(tt.value, now, tt.end)
+		if err != nil {
+			t.Errorf("ParseDate(%q, %v): %v", tt.value, tt.end, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("ParseDate(%q, %v) = %v, want %v", tt.value, tt.end, got, tt.want)
+		}
+	}
+
+	for _, value := range []string{"", "0d", "-1w", "yesterday", "2024-13-01"} {
+		if _, err := ParseDate(value, now, false); err == nil {
+			t.Errorf("ParseDate(%q) succeeded, want an error", value)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package rules
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/store"
+	"gopkg.in/yaml.v3"
+)
+
+// Conditions and actions are written "kind:argument", e.g. "tag:invoice",
+// "domain:arxiv.org", "remind:30d" or "webhook:https://example.com/hook".
+
+// Condition kinds
+const (
+	WhenTag      = "tag"      // entry has the tag
+	WhenDomain   = "domain"   // source URL is on the domain or a subdomain
+	WhenSource   = "source"   // source type (note, url, file, clip)
+	WhenContains = "contains" // content contains the text (case-insensitive)
+)
+
+// Action kinds
+const (
+	DoTag     = "tag"     // add a tag
+	DoRemind  = "remind"  // remind of the entry after a delay
+	DoWebhook = "webhook" // POST the entry as JSON to a URL, in the background
+)
+
+// maxPasses bounds rule chaining (a tag action triggering tag conditions)
+const maxPasses = 3
+
+// webhookTimeout bounds how long a webhook is waited for
+const webhookTimeout = 10 * time.Second
+
+// webhooks tracks the webhooks being sent
+var webhooks sync.WaitGroup
+
+// WaitWebhooks waits for the webhooks rules are still sending, each given
+// up on after webhookTimeout. Commands that exit once done call it first.
+func WaitWebhooks() {
+	webhooks.Wait()
+}
+
+// ParseCondition validates a condition and splits it into kind and argument
+func ParseCondition(cond string) (kind, arg string, err error) {
+	kind, arg, ok := strings.Cut(strings.TrimSpace(cond), ":")
+	arg = strings.TrimSpace(arg)
+	if !ok || arg == "" {
+		return "", "", fmt.Errorf("invalid condition %q (expected kind:argument)", cond)
+	}
+	switch kind {
+	case WhenTag, WhenDomain, WhenSource, WhenContains:
+		return kind, arg, nil
+	}
+	return "", "", fmt.Errorf("unknown condition %q (use tag, domain, source or contains)", kind)
+}
+
+// ParseAction validates an action and splits it into kind and argument
+func ParseAction(action string) (kind, arg string, err error) {
+	kind, arg, ok := strings.Cut(strings.TrimSpace(action), ":")
+	arg = strings.TrimSpace(arg)
+	if !ok || arg == "" {
+		return "", "", fmt.Errorf("invalid action %q (expected kind:argument)", action)
+	}
+	switch kind {
+	case DoTag:
+		return kind, arg, nil
+	case DoRemind:
+		if _, err := ParseDelay(arg); err != nil {
+			return "", "", err
+		}
+		return kind, arg, nil
+	case DoWebhook:
+		if u, err := url.Parse(arg); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return "", "", fmt.Errorf("invalid webhook URL %q", arg)
+		}
+		return kind, arg, nil
+	}
+	return "", "", fmt.Errorf("unknown action %q (use tag, remind or webhook)", kind)
+}
+
+// ParseDelay parses a delay like "30d", "2w" or any Go duration ("12h")
+func ParseDelay(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			if v, err := strconv.Atoi(n); err == nil && v > 0 {
+				return time.Duration(v) * unit, nil
+			}
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid delay %q (e.g. 30d, 2w, 12h)", s)
+	}
+	return d, nil
+}
+
+// Matches reports whether an entry satisfies a condition
+func Matches(cond string, e *domain.Entry) bool {
+	kind, arg, err := ParseCondition(cond)
+	if err != nil {
+		return false
+	}
+	switch kind {
+	case WhenTag:
+		for _, t := range e.Tags {
+			if strings.EqualFold(t.Name, arg) {
+				return true
+			}
+		}
+	case WhenDomain:
+		u, err := url.Parse(e.Source.URL)
+		if err != nil || u.Hostname() == "" {
+			return false
+		}
+		host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+		arg = strings.ToLower(arg)
+		return host == arg || strings.HasSuffix(host, "."+arg)
+	case WhenSource:
+		return e.Source.Type == arg
+	case WhenContains:
+		return strings.Contains(strings.ToLower(e.Content), strings.ToLower(arg))
+	}
+	return false
+}
+
+// fileRule is a rule in a YAML rules file
+type fileRule struct {
+	Name     string   `yaml:"name"`
+	When     string   `yaml:"when"`
+	Then     []string `yaml:"then"`
+	Disabled bool     `yaml:"disabled,omitempty"`
+}
+
+// ParseFile reads the rules of a YAML rules file: a list of rules, each
+// with a name, a when condition, a list of then actions, and disabled set
+// to keep it from firing
+func ParseFile(data []byte) ([]domain.Rule, error) {
+	var file []fileRule
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse rules: %w", err)
+	}
+	seen := make(map[string]bool)
+	rules := make([]domain.Rule, 0, len(file))
+	for i, f := range file {
+		name := strings.TrimSpace(f.Name)
+		if name == "" {
+			return nil, fmt.Errorf("rule %d has no name", i+1)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("rule %s is defined twice", name)
+		}
+		seen[name] = true
+		if _, _, err := ParseCondition(f.When); err != nil {
+			return nil, fmt.Errorf("rule %s: %w", name, err)
+		}
+		if len(f.Then) == 0 {
+			return nil, fmt.Errorf("rule %s has no actions", name)
+		}
+		for _, action := range f.Then {
+			if _, _, err := ParseAction(action); err != nil {
+				return nil, fmt.Errorf("rule %s: %w", name, err)
+			}
+		}
+		rules = append(rules, domain.Rule{Name: name, Condition: strings.TrimSpace(f.When), Actions: f.Then, Enabled: !f.Disabled})
+	}
+	return rules, nil
+}
+
+// Result describes one action run by a rule
+type Result struct {
+	Rule   string
+	Action string
+	Err    error
+}
+
+// Engine evaluates rules against entries and runs their actions
+type Engine struct {
+	store *store.Store
+}
+
+// New creates an Engine backed by the store's rules
+func New(s *store.Store) *Engine {
+	return &Engine{store: s}
+}
+
+// Apply runs every enabled rule matching the entry. Rules fire at most once
+// per entry; tags added by one rule can trigger others. Webhooks are sent
+// in the background: their failures are logged, not returned.
+func (en *Engine) Apply(ctx context.Context, entryID string) ([]Result, error) {
+	all, err := en.store.ListRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	done := make(map[string]bool)
+	for pass := 0; pass < maxPasses; pass++ {
+		entry, err := en.store.GetEntry(ctx, entryID)
+		if err != nil {
+			return results, err
+		}
+
+		tagged := false
+		for _, r := range all {
+			if !r.Enabled || done[r.ID] || !Matches(r.Condition, entry) {
+				continue
+			}
+			done[r.ID] = true
+
+			first, err := en.store.RecordRuleFiring(ctx, r.ID, entryID)
+			if err != nil {
+				return results, err
+			}
+			if !first {
+				continue
+			}
+
+			for _, action := range r.Actions {
+				kind, _, _ := ParseAction(action)
+				err := en.run(ctx, r.Name, action, entry)
+				results = append(results, Result{Rule: r.Name, Action: action, Err: err})
+				if kind == DoTag && err == nil {
+					tagged = true
+				}
+			}
+		}
+
+		if !tagged {
+			break
+		}
+	}
+	return results, nil
+}
+
+func (en *Engine) run(ctx context.Context, rule, action string, e *domain.Entry) error {
+	kind, arg, err := ParseAction(action)
+	if err != nil {
+		return err
+	}
+
+	switch kind {
+	case DoTag:
+		tag, err := en.store.GetOrCreateTag(ctx, arg, nil)
+		if err != nil {
+			return err
+		}
+		return en.store.LinkEntryTag(ctx, e.ID, tag.ID, 1.0)
+
+	case DoRemind:
+		// A reminder, leaving the entry's review schedule alone. One due
+		// sooner is kept.
+		delay, _ := ParseDelay(arg)
+		at := time.Now().Add(delay)
+		existing, err := en.store.GetReminder(ctx, e.ID)
+		if err != nil {
+			return err
+		}
+		if existing != nil && existing.NotifiedAt == nil && existing.RemindAt.Before(at) {
+			return nil
+		}
+		_, err = en.store.SetReminder(ctx, e.ID, at, "rule "+rule)
+		return err
+
+	case DoWebhook:
+		body, err := json.Marshal(map[string]interface{}{"entry": e})
+		if err != nil {
+			return fmt.Errorf("marshal webhook: %w", err)
+		}
+		webhooks.Add(1)
+		go func() {
+			defer webhooks.Done()
+			if err := postWebhook(arg, body); err != nil {
+				slog.Warn("rule webhook failed", "rule", rule, "entry", e.ID, "url", arg, "err", err)
+			}
+		}()
+	}
+	return nil
+}
+
+// postWebhook posts a webhook's body, giving up after webhookTimeout. It
+// doesn't depend on the context of the ingestion, which may end first.
+func postWebhook(hookURL string, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook: HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
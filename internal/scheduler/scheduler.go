@@ -0,0 +1,182 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// tickInterval is how often the scheduler checks for due jobs
+const tickInterval = time.Minute
+
+// Job is a periodic task run by the scheduler
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Jitter   time.Duration
+	Run      func(ctx context.Context) error
+
+	// Exclusive jobs are write-heavy and also require the store-wide
+	// writer lease, so only one daemon runs them at a time
+	Exclusive bool
+}
+
+// writerLeaseTTL bounds how long a crashed daemon can block exclusive jobs
+const writerLeaseTTL = 5 * time.Minute
+
+// Schedule describes when a job last ran and when it will run next
+type Schedule struct {
+	Job     string          `json:"job"`
+	State   domain.JobState `json:"state"`
+	NextRun time.Time       `json:"next_run"`
+}
+
+// Scheduler runs registered jobs, persisting their state in the store
+type Scheduler struct {
+	store *store.Store
+	owner string
+	jobs  []Job
+}
+
+// New creates a Scheduler whose leases are held under a host/pid identity
+func New(s *store.Store) *Scheduler {
+	host, _ := os.Hostname()
+	return &Scheduler{
+		store: s,
+		owner: fmt.Sprintf("%s:%d", host, os.Getpid()),
+	}
+}
+
+// Register adds a job to the scheduler
+func (sc *Scheduler) Register(job Job) {
+	sc.jobs = append(sc.jobs, job)
+}
+
+// Jobs returns the registered jobs
+func (sc *Scheduler) Jobs() []Job {
+	return sc.jobs
+}
+
+// Schedules returns the persisted state and next run time of every job
+func (sc *Scheduler) Schedules(ctx context.Context) ([]Schedule, error) {
+	var schedules []Schedule
+	for _, job := range sc.jobs {
+		state, err := sc.store.GetJobState(ctx, job.Name)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, Schedule{
+			Job:     job.Name,
+			State:   *state,
+			NextRun: NextRun(job, state.LastRunAt),
+		})
+	}
+	return schedules, nil
+}
+
+// Run checks for due jobs every tick until ctx is cancelled
+func (sc *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	for {
+		sc.runDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunJob runs a single job now, honoring the singleton lease
+func (sc *Scheduler) RunJob(ctx context.Context, job Job) (bool, error) {
+	return sc.run(ctx, job, time.Time{})
+}
+
+// run runs a job under its singleton lease. With a non-zero dueAt, the
+// job only runs if it's still due then once the lease is held: another
+// daemon may have run it since its state was read.
+func (sc *Scheduler) run(ctx context.Context, job Job, dueAt time.Time) (bool, error) {
+	// Hold the lease for at least one interval so a crashed run doesn't block forever
+	ttl := job.Interval
+	if ttl < time.Hour {
+		ttl = time.Hour
+	}
+	acquired, err := sc.store.AcquireJobLock(ctx, job.Name, sc.owner, ttl)
+	if err != nil || !acquired {
+		return false, err
+	}
+	// Bookkeeping outlives a cancelled run, so the lock isn't left held
+	cleanup := context.WithoutCancel(ctx)
+	defer sc.store.ReleaseJobLock(cleanup, job.Name, sc.owner)
+
+	if !dueAt.IsZero() {
+		state, err := sc.store.GetJobState(ctx, job.Name)
+		if err != nil {
+			return false, err
+		}
+		if NextRun(job, state.LastRunAt).After(dueAt) {
+			return false, nil
+		}
+	}
+
+	if job.Exclusive {
+		// The job stops writing if another daemon takes the lease
+		held, release, acquired, err := sc.store.HoldLease(ctx, store.WriterLease, sc.owner, writerLeaseTTL)
+		if err != nil || !acquired {
+			return false, err
+		}
+		defer release()
+		ctx = held
+	}
+
+	runErr := job.Run(ctx)
+	if cause := context.Cause(ctx); runErr != nil && errors.Is(cause, store.ErrLeaseLost) {
+		runErr = fmt.Errorf("writer %w", cause)
+	}
+	if err := sc.store.RecordJobRun(cleanup, job.Name, time.Now(), runErr); err != nil {
+		return true, err
+	}
+	return true, runErr
+}
+
+func (sc *Scheduler) runDue(ctx context.Context) {
+	now := time.Now()
+	for _, job := range sc.jobs {
+		// Re-read state each time: another daemon may have just run the job
+		state, err := sc.store.GetJobState(ctx, job.Name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "scheduler: %s: %v\n", job.Name, err)
+			continue
+		}
+		if NextRun(job, state.LastRunAt).After(now) {
+			continue
+		}
+		if _, err := sc.run(ctx, job, now); err != nil {
+			fmt.Fprintf(os.Stderr, "scheduler: %s: %v\n", job.Name, err)
+		}
+	}
+}
+
+// NextRun computes when a job is next due. Jitter is derived from the job
+// name and last run, so every daemon computes the same next run time.
+func NextRun(job Job, lastRun *time.Time) time.Time {
+	if lastRun == nil {
+		return time.Time{}
+	}
+	next := lastRun.Add(job.Interval)
+	if job.Jitter > 0 {
+		h := fnv.New64a()
+		h.Write([]byte(job.Name))
+		h.Write([]byte(lastRun.UTC().Format(time.RFC3339Nano)))
+		next = next.Add(time.Duration(h.Sum64() % uint64(job.Jitter)))
+	}
+	return next
+}
@@ -0,0 +1,131 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pbaille/kb/internal/store"
+)
+
+func newTestStore(t *testing.T) *store.Store {
+	t.Helper()
+	s, err := store.Open(filepath.Join(t.TempDir(), "kb.db"), store.StoreOptions{})
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// countingJob returns a job counting its runs in runs
+func countingJob(runs *int) Job {
+	return Job{Name: "poll", Interval: time.Hour, Run: func(ctx context.Context) error {
+		*runs++
+		return nil
+	}}
+}
+
+func TestRunRechecksDueUnderLock(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	var runs int
+	job := countingJob(&runs)
+	first, second := New(s), New(s)
+	second.owner = "other:1"
+
+	// Both daemons see the job due; the first runs it before the second
+	// gets the lock
+	due := time.Now()
+	if ran, err := first.run(ctx, job, due); err != nil || !ran {
+		t.Fatalf("first run = %v, %v, want a run", ran, err)
+	}
+	if ran, err := second.run(ctx, job, due); err != nil || ran {
+		t.Errorf("second run = %v, %v, want no run", ran, err)
+	}
+	if runs != 1 {
+		t.Errorf("job ran %d times, want 1", runs)
+	}
+
+	// Run by hand, it runs whether due or not
+	if ran, err := second.RunJob(ctx, job); err != nil || !ran {
+		t.Errorf("RunJob = %v, %v, want a run", ran, err)
+	}
+	if runs != 2 {
+		t.Errorf("job ran %d times, want 2", runs)
+	}
+}
+
+func TestRunJobLocked(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	var runs int
+	job := countingJob(&runs)
+	if ok, err := s.AcquireJobLock(ctx, job.Name, "other:1", time.Hour); err != nil || !ok {
+		t.Fatalf("AcquireJobLock = %v, %v", ok, err)
+	}
+
+	if ran, err := New(s).RunJob(ctx, job); err != nil || ran {
+		t.Errorf("RunJob while locked = %v, %v, want no run", ran, err)
+	}
+	if runs != 0 {
+		t.Errorf("job ran %d times, want 0", runs)
+	}
+}
+
+func TestRunJobRecordsState(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	failure := errors.New("feed down")
+	job := Job{Name: "poll", Interval: time.Hour, Run: func(ctx context.Context) error { return failure }}
+
+	sc := New(s)
+	if ran, err := sc.RunJob(ctx, job); !ran || !errors.Is(err, failure) {
+		t.Fatalf("RunJob = %v, %v, want a failed run", ran, err)
+	}
+	state, err := s.GetJobState(ctx, job.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.LastRunAt == nil || state.LastError != failure.Error() {
+		t.Errorf("state = %+v, want a run with error %q", state, failure)
+	}
+	if state.LockOwner != "" {
+		t.Errorf("lock still held by %s", state.LockOwner)
+	}
+}
+
+func TestNextRun(t *testing.T) {
+	last := time.Date(2026, 10, 15, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		job  Job
+		last *time.Time
+	}{
+		{"never run", Job{Name: "a", Interval: time.Hour}, nil},
+		{"no jitter", Job{Name: "a", Interval: time.Hour}, &last},
+		{"jitter", Job{Name: "a", Interval: time.Hour, Jitter: 10 * time.Minute}, &last},
+		{"other job", Job{Name: "b", Interval: time.Hour, Jitter: 10 * time.Minute}, &last},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := NextRun(tt.job, tt.last)
+			if tt.last == nil {
+				if !next.IsZero() {
+					t.Errorf("NextRun = %v, want due now", next)
+				}
+				return
+			}
+			earliest := tt.last.Add(tt.job.Interval)
+			if next.Before(earliest) || !next.Before(earliest.Add(tt.job.Jitter+1)) {
+				t.Errorf("NextRun = %v, want within %v of %v", next, tt.job.Jitter, earliest)
+			}
+			// Every daemon computes the same time
+			if again := NextRun(tt.job, tt.last); !again.Equal(next) {
+				t.Errorf("NextRun = %v then %v", next, again)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+// Package secret encrypts text with keys derived from passphrases:
+// argon2id for the key, AES-256-GCM for the text.
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// ErrWrongKey is returned when a ciphertext doesn't open with a key,
+// typically because the passphrase was wrong
+var ErrWrongKey = errors.New("wrong passphrase or corrupted data")
+
+// check is sealed with a new key so a passphrase can be verified later
+// without decrypting real data
+const check = "kb"
+
+// NewSalt returns a random salt for DeriveKey
+func NewSalt() ([]byte, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("generate salt: %w", err)
+	}
+	return salt, nil
+}
+
+// DeriveKey turns a passphrase into a 256-bit key
+func DeriveKey(passphrase string, salt []byte) []byte {
+	return argon2.IDKey([]byte(passphrase), salt, 1, 64*1024, 4, 32)
+}
+
+// Seal encrypts plaintext; the random nonce is prepended to the result
+func Seal(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Open decrypts what Seal returned
+func Open(key, sealed []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrWrongKey
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrWrongKey
+	}
+	return plaintext, nil
+}
+
+// Check returns a value to keep with a key's salt, for Verify
+func Check(key []byte) ([]byte, error) {
+	return Seal(key, []byte(check))
+}
+
+// Verify reports whether key is the one a Check value was made with
+func Verify(key, checkValue []byte) bool {
+	plaintext, err := Open(key, checkValue)
+	return err == nil && string(plaintext) == check
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("create gcm: %w", err)
+	}
+	return gcm, nil
+}
@@ -0,0 +1,59 @@
+package srs
+
+import (
+	"math"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// DefaultEase is the starting ease factor of a new review item
+const DefaultEase = 2.5
+
+// minEase keeps intervals from collapsing on repeatedly hard items
+const minEase = 1.3
+
+// MaxGrade is the best recall grade (SM-2 grades range 0-5)
+const MaxGrade = 5
+
+// NewReview returns the initial review state for an entry
+func NewReview(entryID string) domain.Review {
+	return domain.Review{EntryID: entryID, Ease: DefaultEase}
+}
+
+// Grade applies an SM-2 recall grade (0-5) to a review state and returns
+// the updated state with its next due date
+func Grade(r domain.Review, grade int, now time.Time) domain.Review {
+	if grade < 0 {
+		grade = 0
+	}
+	if grade > MaxGrade {
+		grade = MaxGrade
+	}
+
+	if grade >= 3 {
+		switch r.Repetitions {
+		case 0:
+			r.IntervalDays = 1
+		case 1:
+			r.IntervalDays = 6
+		default:
+			r.IntervalDays = int(math.Round(float64(r.IntervalDays) * r.Ease))
+		}
+		r.Repetitions++
+	} else {
+		// Failed recall: start over but keep the (lowered) ease
+		r.Repetitions = 0
+		r.IntervalDays = 1
+	}
+
+	q := float64(MaxGrade - grade)
+	r.Ease += 0.1 - q*(0.08+q*0.02)
+	if r.Ease < minEase {
+		r.Ease = minEase
+	}
+
+	r.LastReviewedAt = &now
+	r.NextDue = now.AddDate(0, 0, r.IntervalDays)
+	return r
+}
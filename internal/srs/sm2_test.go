@@ -0,0 +1,60 @@
+package srs
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+func TestGrade(t *testing.T) {
+	now := time.Date(2026, 10, 15, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		review   domain.Review
+		grade    int
+		interval int
+		reps     int
+		ease     float64
+	}{
+		{"first recall", NewReview("e"), 4, 1, 1, 2.5},
+		{"second recall", domain.Review{Ease: 2.5, Repetitions: 1, IntervalDays: 1}, 4, 6, 2, 2.5},
+		{"third recall", domain.Review{Ease: 2.5, Repetitions: 2, IntervalDays: 6}, 4, 15, 3, 2.5},
+		{"perfect recall", domain.Review{Ease: 2.5, Repetitions: 2, IntervalDays: 6}, 5, 15, 3, 2.6},
+		{"hard recall", domain.Review{Ease: 2.5, Repetitions: 2, IntervalDays: 6}, 3, 15, 3, 2.36},
+		{"rounded interval", domain.Review{Ease: 1.7, Repetitions: 3, IntervalDays: 5}, 4, 9, 4, 1.7},
+		{"failed recall", domain.Review{Ease: 2.5, Repetitions: 4, IntervalDays: 40}, 2, 1, 0, 2.18},
+		{"blackout", domain.Review{Ease: 2.5, Repetitions: 4, IntervalDays: 40}, 0, 1, 0, 1.7},
+		{"ease floor", domain.Review{Ease: 1.4, Repetitions: 1, IntervalDays: 1}, 0, 1, 0, 1.3},
+		{"grade above 5", domain.Review{Ease: 2.5, Repetitions: 2, IntervalDays: 6}, 9, 15, 3, 2.6},
+		{"grade below 0", domain.Review{Ease: 2.5, Repetitions: 4, IntervalDays: 40}, -3, 1, 0, 1.7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Grade(tt.review, tt.grade, now)
+			if got.IntervalDays != tt.interval {
+				t.Errorf("IntervalDays = %d, want %d", got.IntervalDays, tt.interval)
+			}
+			if got.Repetitions != tt.reps {
+				t.Errorf("Repetitions = %d, want %d", got.Repetitions, tt.reps)
+			}
+			if math.Abs(got.Ease-tt.ease) > 1e-9 {
+				t.Errorf("Ease = %v, want %v", got.Ease, tt.ease)
+			}
+			if want := now.AddDate(0, 0, tt.interval); !got.NextDue.Equal(want) {
+				t.Errorf("NextDue = %v, want %v", got.NextDue, want)
+			}
+			if got.LastReviewedAt == nil || !got.LastReviewedAt.Equal(now) {
+				t.Errorf("LastReviewedAt = %v, want %v", got.LastReviewedAt, now)
+			}
+		})
+	}
+}
+
+func TestNewReview(t *testing.T) {
+	r := NewReview("e")
+	if r.EntryID != "e" || r.Ease != DefaultEase || r.Repetitions != 0 || r.IntervalDays != 0 {
+		t.Errorf("NewReview = %+v", r)
+	}
+}
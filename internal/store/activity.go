@@ -0,0 +1,89 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// TagActivity returns, for every tag in use, its number of entries, the
+// views of those entries since the given time and the last time any of
+// them was viewed. Tags with the most entries come first.
+func (s *Store) TagActivity(ctx context.Context, since time.Time) ([]domain.TagActivity, error) {
+	visible, args := s.visibleCondition(ctx, "e.")
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT t.name,
+		       COUNT(DISTINCT et.entry_id),
+		       (SELECT COUNT(*) FROM entry_views v
+		        JOIN entry_tags vt ON vt.entry_id = v.entry_id
+		        WHERE vt.tag_id = t.id AND julianday(v.viewed_at) >= julianday(?)),
+		       (SELECT CAST(strftime('%s', MAX(v.viewed_at)) AS INTEGER) FROM entry_views v
+		        JOIN entry_tags vt ON vt.entry_id = v.entry_id
+		        WHERE vt.tag_id = t.id)
+		FROM tags t
+		JOIN entry_tags et ON et.tag_id = t.id
+		JOIN entries e ON e.id = et.entry_id AND e.expires_at IS NULL AND e.deleted_at IS NULL AND `+visible+`
+		GROUP BY t.id
+		ORDER BY COUNT(DISTINCT et.entry_id) DESC, t.name
+	`, append([]interface{}{since.UTC()}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("tag activity: %w", err)
+	}
+	defer rows.Close()
+
+	var activity []domain.TagActivity
+	for rows.Next() {
+		var a domain.TagActivity
+		var lastViewed *int64
+		if err := rows.Scan(&a.Tag, &a.Entries, &a.Views, &lastViewed); err != nil {
+			return nil, fmt.Errorf("scan tag activity: %w", err)
+		}
+		if lastViewed != nil {
+			t := time.Unix(*lastViewed, 0)
+			a.LastViewedAt = &t
+		}
+		activity = append(activity, a)
+	}
+	return activity, rows.Err()
+}
+
+// NeglectedTags returns tags with at least minEntries entries, none of
+// which were viewed since the given time, biggest first
+func (s *Store) NeglectedTags(ctx context.Context, since time.Time, minEntries, limit int) ([]domain.TagActivity, error) {
+	activity, err := s.TagActivity(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+
+	var neglected []domain.TagActivity
+	for _, a := range activity {
+		if a.Entries >= minEntries && a.Views == 0 {
+			neglected = append(neglected, a)
+			if len(neglected) == limit {
+				break
+			}
+		}
+	}
+	return neglected, nil
+}
+
+// StaleEntriesUnderTag is GetSuggestions restricted to a tag and its
+// descendants
+func (s *Store) StaleEntriesUnderTag(ctx context.Context, tag string, limit int) ([]domain.Entry, error) {
+	visible, args := s.visibleCondition(ctx, "e.")
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT e.id, e.content, e.created_at, e.last_viewed_at, e.source_type, e.source_url, e.title, e.author, e.fetched_at, e.expires_at, e.maturity
+		FROM entries e
+		WHERE e.expires_at IS NULL AND e.archived_at IS NULL AND e.deleted_at IS NULL AND `+tagTreeCondition+` AND `+visible+`
+		ORDER BY e.last_viewed_at ASC NULLS FIRST, e.created_at DESC
+		LIMIT ?
+	`, append(append([]interface{}{s.tagRef(ctx, tag)}, args...), limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("stale entries under tag: %w", err)
+	}
+	defer rows.Close()
+
+	return s.scanEntries(rows)
+}
@@ -0,0 +1,67 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// AddAttachment records a stored blob as an attachment of an entry
+func (s *Store) AddAttachment(ctx context.Context, entryID, sha256, filename, mimeType string, size int64) (*domain.Attachment, error) {
+	a := domain.Attachment{
+		ID:        uuid.New().String(),
+		EntryID:   entryID,
+		SHA256:    sha256,
+		Filename:  filename,
+		MIMEType:  mimeType,
+		Size:      size,
+		CreatedAt: time.Now(),
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO attachments (id, entry_id, sha256, filename, mime_type, size, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		a.ID, a.EntryID, a.SHA256, a.Filename, a.MIMEType, a.Size, a.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("insert attachment: %w", err)
+	}
+	return &a, nil
+}
+
+// GetAttachment retrieves an attachment by ID
+func (s *Store) GetAttachment(ctx context.Context, id string) (*domain.Attachment, error) {
+	var a domain.Attachment
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, entry_id, sha256, filename, mime_type, size, created_at FROM attachments WHERE id = ?",
+		id,
+	).Scan(&a.ID, &a.EntryID, &a.SHA256, &a.Filename, &a.MIMEType, &a.Size, &a.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("get attachment: %w", err)
+	}
+	return &a, nil
+}
+
+// ListAttachments returns the attachments of an entry, oldest first
+func (s *Store) ListAttachments(ctx context.Context, entryID string) ([]domain.Attachment, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT id, entry_id, sha256, filename, mime_type, size, created_at FROM attachments WHERE entry_id = ? ORDER BY created_at",
+		entryID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list attachments: %w", err)
+	}
+	defer rows.Close()
+
+	var attachments []domain.Attachment
+	for rows.Next() {
+		var a domain.Attachment
+		if err := rows.Scan(&a.ID, &a.EntryID, &a.SHA256, &a.Filename, &a.MIMEType, &a.Size, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan attachment: %w", err)
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, nil
+}
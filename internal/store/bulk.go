@@ -0,0 +1,126 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// TagAssignment links a tag to an entry; the tag is created under Parent
+// when it doesn't exist yet
+type TagAssignment struct {
+	EntryID string
+	Tag     string
+	Parent  string
+}
+
+// ContentHash identifies an entry's content: the hex SHA-256 of its text
+func ContentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// ContentHashes maps the content hash of every entry visible to ctx to
+// its ID, leaving out entries of locked notebooks
+func (s *Store) ContentHashes(ctx context.Context) (map[string]string, error) {
+	visible, args := s.visibleCondition(ctx, "")
+	rows, err := s.db.QueryContext(ctx, "SELECT id, content FROM entries WHERE "+visible, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list contents: %w", err)
+	}
+	defer rows.Close()
+
+	hashes := make(map[string]string)
+	for rows.Next() {
+		var e domain.Entry
+		if err := rows.Scan(&e.ID, &e.Content); err != nil {
+			return nil, fmt.Errorf("scan content: %w", err)
+		}
+		if s.openContent(&e); !e.Locked {
+			hashes[ContentHash(e.Content)] = e.ID
+		}
+	}
+	return hashes, rows.Err()
+}
+
+// BulkTag applies tag assignments in a single transaction, so either all
+// of them are applied or none is. Tags are linked as human labels, like
+// kb tag add. It returns how many links were new.
+func (s *Store) BulkTag(ctx context.Context, assignments []TagAssignment) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	linked := 0
+	for _, a := range assignments {
+		var parentID *string
+		if a.Parent != "" {
+			parent, err := getOrCreateTagTx(ctx, tx, a.Parent, nil)
+			if err != nil {
+				return 0, err
+			}
+			parentID = &parent
+		}
+		tagID, err := getOrCreateTagTx(ctx, tx, a.Tag, parentID)
+		if err != nil {
+			return 0, err
+		}
+
+		res, err := tx.ExecContext(ctx,
+			"INSERT INTO entry_tags (entry_id, tag_id, confidence, origin) VALUES (?, ?, 1.0, ?) ON CONFLICT DO NOTHING",
+			a.EntryID, tagID, domain.OriginHuman,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("link %s to %s: %w", a.Tag, a.EntryID, err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+		linked++
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO tag_feedback (entry_id, tag_id, verdict, created_at) VALUES (?, ?, 'added', ?)",
+			a.EntryID, tagID, now,
+		); err != nil {
+			return 0, fmt.Errorf("record feedback: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	return linked, nil
+}
+
+// getOrCreateTagTx is GetOrCreateTag within a transaction, returning the ID
+func getOrCreateTagTx(ctx context.Context, tx *sql.Tx, name string, parentID *string) (string, error) {
+	var tag domain.Tag
+	query, args := tagNamed(ctx, name)
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&tag.ID, &tag.Name, &tag.ParentID, &tag.Description, &tag.Color, &tag.CreatedAt)
+	if err == nil {
+		return tag.ID, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", fmt.Errorf("find tag: %w", err)
+	}
+
+	if normalized := domain.NormalizeTagName(name); normalized != "" {
+		name = normalized
+	}
+	id := uuid.New().String()
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO tags (id, name, parent_id, created_at, user_id) VALUES (?, ?, ?, ?, ?)",
+		id, name, parentID, time.Now(), nullString(UserID(ctx)),
+	); err != nil {
+		return "", fmt.Errorf("insert tag: %w", err)
+	}
+	return id, nil
+}
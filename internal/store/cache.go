@@ -0,0 +1,117 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// CacheStat summarizes the cached results of one kind
+type CacheStat struct {
+	Kind string `json:"kind"`
+	// Entries is how many results are cached, each once a miss
+	Entries int `json:"entries"`
+	Hits    int `json:"hits"`
+}
+
+// HitRate is the share of lookups answered from the cache
+func (c CacheStat) HitRate() float64 {
+	if c.Hits+c.Entries == 0 {
+		return 0
+	}
+	return float64(c.Hits) / float64(c.Hits+c.Entries)
+}
+
+// CacheGet returns a cached result and counts the hit (implements
+// cache.Store)
+func (s *Store) CacheGet(ctx context.Context, kind, model, hash string) ([]byte, bool, error) {
+	var value []byte
+	err := s.db.QueryRowContext(ctx,
+		"SELECT value FROM api_cache WHERE kind = ? AND model = ? AND content_hash = ?", kind, model, hash,
+	).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("get cached result: %w", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx,
+		"UPDATE api_cache SET hits = hits + 1, last_hit_at = ? WHERE kind = ? AND model = ? AND content_hash = ?",
+		time.Now(), kind, model, hash,
+	); err != nil {
+		return nil, false, fmt.Errorf("count cache hit: %w", err)
+	}
+	return value, true, nil
+}
+
+// CachePut stores a result, replacing any previous one (implements
+// cache.Store)
+func (s *Store) CachePut(ctx context.Context, kind, model, hash string, value []byte) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO api_cache (kind, model, content_hash, value, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (kind, model, content_hash) DO UPDATE SET value = excluded.value, created_at = excluded.created_at
+	`, kind, model, hash, value, time.Now())
+	if err != nil {
+		return fmt.Errorf("cache result: %w", err)
+	}
+	return nil
+}
+
+// PruneCache evicts the cached results not used for longer than maxAge,
+// then the least recently used of each kind beyond maxEntries. It returns
+// how many results were evicted.
+func (s *Store) PruneCache(ctx context.Context, maxAge time.Duration, maxEntries int) (int, error) {
+	result, err := s.db.ExecContext(ctx,
+		"DELETE FROM api_cache WHERE julianday(COALESCE(last_hit_at, created_at)) <= julianday(?)", time.Now().Add(-maxAge).UTC(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("prune cache: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	evicted := int(n)
+
+	stats, err := s.CacheStats(ctx)
+	if err != nil {
+		return evicted, err
+	}
+	for _, st := range stats {
+		if st.Entries <= maxEntries {
+			continue
+		}
+		// Results used last before the oldest of those kept go
+		result, err := s.db.ExecContext(ctx, `
+			DELETE FROM api_cache WHERE kind = ? AND julianday(COALESCE(last_hit_at, created_at)) < (
+				SELECT julianday(COALESCE(last_hit_at, created_at)) FROM api_cache WHERE kind = ? ORDER BY 1 DESC LIMIT 1 OFFSET ?
+			)
+		`, st.Kind, st.Kind, maxEntries-1)
+		if err != nil {
+			return evicted, fmt.Errorf("prune cache: %w", err)
+		}
+		n, _ := result.RowsAffected()
+		evicted += int(n)
+	}
+	return evicted, nil
+}
+
+// CacheStats summarizes the cache by kind
+func (s *Store) CacheStats(ctx context.Context) ([]CacheStat, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT kind, COUNT(*), COALESCE(SUM(hits), 0) FROM api_cache GROUP BY kind ORDER BY kind",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cache stats: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []CacheStat
+	for rows.Next() {
+		var c CacheStat
+		if err := rows.Scan(&c.Kind, &c.Entries, &c.Hits); err != nil {
+			return nil, fmt.Errorf("scan cache stat: %w", err)
+		}
+		stats = append(stats, c)
+	}
+	return stats, rows.Err()
+}
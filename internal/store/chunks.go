@@ -0,0 +1,109 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// SaveChunks stores the embeddings of an entry's passages, replacing the
+// ones it had. No chunks removes them, as for entries short enough to be
+// embedded whole.
+func (s *Store) SaveChunks(ctx context.Context, entryID string, chunks []domain.Chunk, model string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM chunks WHERE entry_id = ?", entryID); err != nil {
+		return fmt.Errorf("clear chunks: %w", err)
+	}
+	now := time.Now()
+	for i, c := range chunks {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO chunks (entry_id, position, start_offset, end_offset, vector, model, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			entryID, i, c.Start, c.End, vectorToBlob(c.Vector), model, now,
+		); err != nil {
+			return fmt.Errorf("save chunk: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	// The index picks the new ones up at the next search
+	s.dropChunks(entryID)
+	return nil
+}
+
+// ListEntriesWithoutChunks returns the entries with an embedding but no
+// chunks, leaving out the trash. Most are short enough not to need any.
+func (s *Store) ListEntriesWithoutChunks(ctx context.Context) ([]domain.Entry, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT e.id, e.content, e.created_at, e.last_viewed_at,
+		       e.source_type, e.source_url, e.title, e.author, e.fetched_at, e.expires_at, e.maturity
+		FROM entries e
+		JOIN embeddings em ON e.id = em.entry_id
+		WHERE e.deleted_at IS NULL AND e.id NOT IN (SELECT entry_id FROM chunks)
+		ORDER BY e.created_at ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("list entries without chunks: %w", err)
+	}
+	defer rows.Close()
+
+	return s.scanEntries(rows)
+}
+
+// chunkMatch is the passage of an entry closest to a vector
+type chunkMatch struct {
+	similarity float64
+	start, end int
+}
+
+// bestChunks returns, for each entry with chunks, its passage closest to
+// vector
+func (s *Store) bestChunks(ctx context.Context, vector []float64) (map[string]chunkMatch, error) {
+	visible, args := s.visibleCondition(ctx, "e.")
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT c.entry_id, c.start_offset, c.end_offset, c.vector
+		FROM chunks c
+		JOIN entries e ON e.id = c.entry_id
+		WHERE e.deleted_at IS NULL AND `+visible, args...)
+	if err != nil {
+		return nil, fmt.Errorf("find similar chunks: %w", err)
+	}
+	defer rows.Close()
+
+	best := make(map[string]chunkMatch)
+	for rows.Next() {
+		var id string
+		var m chunkMatch
+		var blob []byte
+		if err := rows.Scan(&id, &m.start, &m.end, &blob); err != nil {
+			return nil, fmt.Errorf("scan chunk: %w", err)
+		}
+		m.similarity = cosineSimilarity(vector, blobToVector(blob))
+		if prev, ok := best[id]; !ok || m.similarity > prev.similarity {
+			best[id] = m
+		}
+	}
+	return best, rows.Err()
+}
+
+// passage returns a chunk's text, or "" when the content changed since it
+// was embedded so the offsets no longer fit
+func passage(content string, start, end int) string {
+	if start < 0 || end > len(content) || start >= end {
+		return ""
+	}
+	text := content[start:end]
+	if !utf8.ValidString(text) {
+		return ""
+	}
+	return strings.TrimSpace(text)
+}
@@ -0,0 +1,226 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// ErrCollectionNotFound is returned when no collection has a given name
+var ErrCollectionNotFound = errors.New("collection not found")
+
+// CreateCollection creates an empty collection
+func (s *Store) CreateCollection(ctx context.Context, c *domain.Collection) error {
+	if err := domain.CheckCollectionName(c.Name); err != nil {
+		return err
+	}
+	c.CreatedAt = time.Now()
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO collections (name, description, created_at) VALUES (?, ?, ?)",
+		c.Name, c.Description, c.CreatedAt,
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			return fmt.Errorf("collection %s already exists", c.Name)
+		}
+		return fmt.Errorf("insert collection: %w", err)
+	}
+	return nil
+}
+
+// GetCollection returns a collection by name
+func (s *Store) GetCollection(ctx context.Context, name string) (*domain.Collection, error) {
+	var c domain.Collection
+	err := s.db.QueryRowContext(ctx, `
+		SELECT c.name, c.description, c.created_at,
+		       (SELECT COUNT(*) FROM collection_entries ce WHERE ce.collection = c.name)
+		FROM collections c
+		WHERE c.name = ?
+	`, name).Scan(&c.Name, &c.Description, &c.CreatedAt, &c.Entries)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", ErrCollectionNotFound, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get collection: %w", err)
+	}
+	return &c, nil
+}
+
+// ListCollections returns all collections by name, with their entry
+// counts
+func (s *Store) ListCollections(ctx context.Context) ([]domain.Collection, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT c.name, c.description, c.created_at,
+		       (SELECT COUNT(*) FROM collection_entries ce WHERE ce.collection = c.name)
+		FROM collections c
+		ORDER BY c.name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("list collections: %w", err)
+	}
+	defer rows.Close()
+
+	var collections []domain.Collection
+	for rows.Next() {
+		var c domain.Collection
+		if err := rows.Scan(&c.Name, &c.Description, &c.CreatedAt, &c.Entries); err != nil {
+			return nil, fmt.Errorf("scan collection: %w", err)
+		}
+		collections = append(collections, c)
+	}
+	return collections, rows.Err()
+}
+
+// DeleteCollection removes a collection; its entries are kept
+func (s *Store) DeleteCollection(ctx context.Context, name string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM collections WHERE name = ?", name)
+	if err != nil {
+		return fmt.Errorf("delete collection: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %s", ErrCollectionNotFound, name)
+	}
+	return nil
+}
+
+// CollectionEntries returns a collection's entries in order, leaving out
+// those in the trash
+func (s *Store) CollectionEntries(ctx context.Context, name string) ([]domain.Entry, error) {
+	visible, args := s.visibleCondition(ctx, "e.")
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT e.id, e.content, e.created_at, e.last_viewed_at, e.source_type, e.source_url, e.title, e.author, e.fetched_at, e.expires_at, e.maturity
+		FROM entries e
+		JOIN collection_entries ce ON ce.entry_id = e.id
+		WHERE ce.collection = ? AND e.deleted_at IS NULL AND `+visible+`
+		ORDER BY ce.position
+	`, append([]interface{}{name}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("list collection entries: %w", err)
+	}
+	defer rows.Close()
+
+	return s.scanEntries(rows)
+}
+
+// AddToCollection puts entries in a collection, in the order given, from
+// a position (1 for the top, 0 for the end). Entries already in it move
+// there.
+func (s *Store) AddToCollection(ctx context.Context, name string, ids []string, position int) error {
+	return s.placeInCollection(ctx, name, ids, position, false)
+}
+
+// ReorderCollection moves entries of a collection, in the order given,
+// to a position (1 for the top, 0 for the end)
+func (s *Store) ReorderCollection(ctx context.Context, name string, ids []string, position int) error {
+	return s.placeInCollection(ctx, name, ids, position, true)
+}
+
+// RemoveFromCollection takes entries out of a collection
+func (s *Store) RemoveFromCollection(ctx context.Context, name string, ids []string) error {
+	order, err := s.collectionOrder(ctx, name)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if !slices.Contains(order, id) {
+			return fmt.Errorf("entry %s isn't in %s", id, name)
+		}
+	}
+	return s.writeCollectionOrder(ctx, name, slices.DeleteFunc(order, func(id string) bool { return slices.Contains(ids, id) }))
+}
+
+func (s *Store) placeInCollection(ctx context.Context, name string, ids []string, position int, existing bool) error {
+	if position < 0 {
+		return fmt.Errorf("invalid position %d", position)
+	}
+	order, err := s.collectionOrder(ctx, name)
+	if err != nil {
+		return err
+	}
+	for i, id := range ids {
+		if slices.Contains(ids[:i], id) {
+			return fmt.Errorf("entry %s appears twice", id)
+		}
+		if !existing {
+			if _, err := s.GetEntry(ctx, id); err != nil {
+				return fmt.Errorf("%w: %s", ErrEntryNotFound, id)
+			}
+		} else if !slices.Contains(order, id) {
+			return fmt.Errorf("entry %s isn't in %s", id, name)
+		}
+	}
+
+	rest := slices.DeleteFunc(order, func(id string) bool { return slices.Contains(ids, id) })
+	at := len(rest)
+	if position > 0 {
+		at = min(position-1, len(rest))
+	}
+	return s.writeCollectionOrder(ctx, name, slices.Insert(rest, at, ids...))
+}
+
+// collectionOrder returns the IDs of a collection's entries in order
+func (s *Store) collectionOrder(ctx context.Context, name string) ([]string, error) {
+	if _, err := s.GetCollection(ctx, name); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT entry_id FROM collection_entries WHERE collection = ? ORDER BY position", name,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list collection entries: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan collection entry: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// writeCollectionOrder replaces a collection's entries, numbering their
+// positions from 1. Entries staying in keep when they were added.
+func (s *Store) writeCollectionOrder(ctx context.Context, name string, ids []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	args := []interface{}{name}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	query := "DELETE FROM collection_entries WHERE collection = ?"
+	if len(ids) > 0 {
+		query += " AND entry_id NOT IN (" + placeholders + ")"
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("remove collection entries: %w", err)
+	}
+
+	now := time.Now()
+	for i, id := range ids {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO collection_entries (collection, entry_id, position, added_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT (collection, entry_id) DO UPDATE SET position = excluded.position
+		`, name, id, i+1, now); err != nil {
+			return fmt.Errorf("place collection entry: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// FeedbackDataset returns the entries whose tags count as reviewed (the
+// user viewed or corrected them), labeled with accepted and rejected tags
+func (s *Store) FeedbackDataset(ctx context.Context) ([]domain.LabeledEntry, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT e.id, e.content, e.created_at, e.last_viewed_at,
+		       e.source_type, e.source_url, e.title, e.author, e.fetched_at, e.expires_at, e.maturity
+		FROM entries e
+		WHERE e.deleted_at IS NULL
+		  AND (e.last_viewed_at IS NOT NULL OR e.id IN (SELECT entry_id FROM tag_feedback))
+		ORDER BY e.created_at
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("feedback dataset: %w", err)
+	}
+	entries, err := s.scanEntries(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := s.ListTags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(tags))
+	for _, t := range tags {
+		names[t.ID] = t.Name
+	}
+	parentOf := make(map[string]string, len(tags))
+	for _, t := range tags {
+		if t.ParentID != nil {
+			parentOf[t.ID] = names[*t.ParentID]
+		}
+	}
+
+	var dataset []domain.LabeledEntry
+	for _, e := range entries {
+		accepted, err := s.labels(ctx, `
+			SELECT tag_id, origin FROM entry_tags WHERE entry_id = ?
+		`, e.ID)
+		if err != nil {
+			return nil, err
+		}
+		// A tag rejected then added back again is accepted
+		rejected, err := s.labels(ctx, `
+			SELECT DISTINCT tag_id, '' FROM tag_feedback
+			WHERE entry_id = ? AND verdict = 'removed'
+			  AND tag_id NOT IN (SELECT tag_id FROM entry_tags WHERE entry_id = ?)
+		`, e.ID, e.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(accepted) == 0 && len(rejected) == 0 {
+			continue
+		}
+
+		ex := domain.LabeledEntry{Content: e.Content, Source: e.Source, Accepted: []domain.TagLabel{}}
+		for _, l := range accepted {
+			ex.Accepted = append(ex.Accepted, domain.TagLabel{Name: names[l.tagID], Parent: parentOf[l.tagID], Origin: l.origin})
+		}
+		for _, l := range rejected {
+			ex.Rejected = append(ex.Rejected, domain.TagLabel{Name: names[l.tagID], Parent: parentOf[l.tagID]})
+		}
+		dataset = append(dataset, ex)
+	}
+	return dataset, nil
+}
+
+type label struct {
+	tagID  string
+	origin string
+}
+
+func (s *Store) labels(ctx context.Context, query string, args ...interface{}) ([]label, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("get labels: %w", err)
+	}
+	defer rows.Close()
+
+	var labels []label
+	for rows.Next() {
+		var l label
+		if err := rows.Scan(&l.tagID, &l.origin); err != nil {
+			return nil, fmt.Errorf("scan label: %w", err)
+		}
+		labels = append(labels, l)
+	}
+	return labels, nil
+}
+
+// ImportLabeledEntry adds a dataset example, or merges its labels into the
+// entry with the same URL or content. Accepted tags are linked with their
+// origin and rejections recorded as feedback, so the entry counts as
+// reviewed for calibration. It reports whether a new entry was created.
+func (s *Store) ImportLabeledEntry(ctx context.Context, ex domain.LabeledEntry) (string, bool, error) {
+	id, err := s.findImported(ctx, ex)
+	if err != nil {
+		return "", false, err
+	}
+	created := id == ""
+	if created {
+		entry, err := s.AddEntryWithSource(ctx, ex.Content, ex.Source)
+		if err != nil {
+			return "", false, err
+		}
+		id = entry.ID
+	}
+
+	now := time.Now()
+	for _, l := range ex.Accepted {
+		tag, err := s.importTag(ctx, l)
+		if err != nil {
+			return "", false, err
+		}
+		origin := l.Origin
+		if origin != domain.OriginAuto {
+			origin = domain.OriginHuman
+		}
+		if _, err := s.db.ExecContext(ctx,
+			"INSERT INTO entry_tags (entry_id, tag_id, confidence, origin) VALUES (?, ?, 1.0, ?) ON CONFLICT DO NOTHING",
+			id, tag.ID, origin,
+		); err != nil {
+			return "", false, fmt.Errorf("link entry tag: %w", err)
+		}
+		if origin == domain.OriginHuman {
+			if err := s.addImportedFeedback(ctx, id, tag.ID, "added", now); err != nil {
+				return "", false, err
+			}
+		}
+	}
+	for _, l := range ex.Rejected {
+		tag, err := s.importTag(ctx, l)
+		if err != nil {
+			return "", false, err
+		}
+		if err := s.addImportedFeedback(ctx, id, tag.ID, "removed", now); err != nil {
+			return "", false, err
+		}
+	}
+
+	if _, err := s.db.ExecContext(ctx,
+		"UPDATE entries SET last_viewed_at = ? WHERE id = ? AND last_viewed_at IS NULL", now, id,
+	); err != nil {
+		return "", false, fmt.Errorf("mark viewed: %w", err)
+	}
+	return id, created, nil
+}
+
+// addImportedFeedback records a verdict unless the entry already has it
+func (s *Store) addImportedFeedback(ctx context.Context, entryID, tagID, verdict string, at time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO tag_feedback (entry_id, tag_id, verdict, created_at)
+		SELECT ?, ?, ?, ?
+		WHERE NOT EXISTS (
+			SELECT 1 FROM tag_feedback WHERE entry_id = ? AND tag_id = ? AND verdict = ?
+		)
+	`, entryID, tagID, verdict, at, entryID, tagID, verdict)
+	if err != nil {
+		return fmt.Errorf("record feedback: %w", err)
+	}
+	return nil
+}
+
+// findImported returns the ID of an entry matching the example, if any
+func (s *Store) findImported(ctx context.Context, ex domain.LabeledEntry) (string, error) {
+	if ex.Source.URL != "" {
+		entry, err := s.FindEntryByURL(ctx, ex.Source.URL)
+		if err != nil {
+			return "", err
+		}
+		if entry != nil {
+			return entry.ID, nil
+		}
+	}
+
+	var id string
+	err := s.db.QueryRowContext(ctx, "SELECT id FROM entries WHERE content = ? LIMIT 1", ex.Content).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("find entry by content: %w", err)
+	}
+	return id, nil
+}
+
+// importTag returns the labeled tag, creating it and its parent if needed
+func (s *Store) importTag(ctx context.Context, l domain.TagLabel) (*domain.Tag, error) {
+	var parentID *string
+	if l.Parent != "" {
+		parent, err := s.GetOrCreateTag(ctx, l.Parent, nil)
+		if err != nil {
+			return nil, err
+		}
+		parentID = &parent.ID
+	}
+	return s.GetOrCreateTag(ctx, l.Name, parentID)
+}
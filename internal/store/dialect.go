@@ -0,0 +1,63 @@
+package store
+
+// Backends a Store can run on, as Backend returns them
+const (
+	BackendSQLite   = "sqlite"
+	BackendPostgres = "postgres"
+)
+
+// dialect is what differs between the databases a Store runs on. Store
+// methods write their statements once, in SQL both run; on Postgres the
+// connection only numbers placeholders (see toPostgres), and the few
+// statements that differ come from here.
+type dialect struct {
+	// name is the backend, BackendSQLite or BackendPostgres
+	name string
+	// migrations is the directory of the embedded migrations
+	migrations string
+	// size measures the database in bytes, and freeSize the space in it
+	// Compact reclaims
+	size, freeSize string
+	// compact and optimize are what Compact and Optimize run
+	compact, optimize string
+	// snapshots is set when the database can be copied to a file, for
+	// Snapshot and Backup
+	snapshots bool
+}
+
+var sqliteDialect = dialect{
+	name:       BackendSQLite,
+	migrations: "migrations",
+	size:       "SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()",
+	freeSize:   "SELECT freelist_count * page_size FROM pragma_freelist_count(), pragma_page_size()",
+	compact:    "VACUUM",
+	optimize:   "PRAGMA optimize",
+	snapshots:  true,
+}
+
+// Postgres reuses the space of deleted rows once vacuumed, so there's no
+// free space to report
+var postgresDialect = dialect{
+	name:       BackendPostgres,
+	migrations: "migrations/postgres",
+	size:       "SELECT pg_database_size(current_database())",
+	freeSize:   "SELECT 0",
+	compact:    "VACUUM FULL",
+	optimize:   "ANALYZE",
+}
+
+// textMatch returns the condition of entries (columns prefixed with
+// prefix) matching search text, in their content and, if title is set,
+// their title, with its arguments. SQLite matches the text anywhere, case
+// insensitively; Postgres matches its words with full-text search, over
+// titles and content alike.
+func (d dialect) textMatch(prefix, text string, title bool) (string, []interface{}) {
+	if d.name == BackendPostgres {
+		return prefix + "search @@ websearch_to_tsquery('simple', ?)", []interface{}{text}
+	}
+	pattern := "%" + text + "%"
+	if title {
+		return "(" + prefix + "content LIKE ? OR " + prefix + "title LIKE ?)", []interface{}{pattern, pattern}
+	}
+	return prefix + "content LIKE ?", []interface{}{pattern}
+}
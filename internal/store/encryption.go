@@ -0,0 +1,216 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pbaille/kb/internal/secret"
+)
+
+// ErrDatabaseLocked is returned when writing to an encrypted database
+// whose key isn't unlocked
+var ErrDatabaseLocked = errors.New("database is locked")
+
+// Settings holding the database key's salt and check value, base64
+const (
+	keySaltSetting  = "encryption.key_salt"
+	keyCheckSetting = "encryption.key_check"
+)
+
+// databaseKey is the name the database key is kept under, with the
+// notebook keys: content it encrypts is stored as encryptedPrefix, ':'
+// and the base64 ciphertext
+const databaseKey = ""
+
+// Encrypted reports whether the database encrypts entry content
+func (s *Store) Encrypted() bool {
+	return s.encrypted
+}
+
+// loadEncrypted reads whether the database has a key
+func (s *Store) loadEncrypted(ctx context.Context) error {
+	salt, err := s.GetSetting(ctx, keySaltSetting)
+	if err != nil {
+		return err
+	}
+	s.encrypted = salt != ""
+	return nil
+}
+
+// EncryptDatabase gives the database a key derived from a passphrase,
+// then encrypts the content of every entry and past version not already
+// encrypted by a notebook. It returns how many entries it encrypted.
+// The plaintext the encrypted content replaces is overwritten in the
+// database file and its WAL, then the file is rebuilt, so no copy of it
+// survives in free pages.
+func (s *Store) EncryptDatabase(ctx context.Context, passphrase string) (int, error) {
+	if s.encrypted {
+		return 0, fmt.Errorf("database is already encrypted")
+	}
+	if passphrase == "" {
+		return 0, fmt.Errorf("empty passphrase")
+	}
+	salt, err := secret.NewSalt()
+	if err != nil {
+		return 0, err
+	}
+	key := secret.DeriveKey(passphrase, salt)
+	check, err := secret.Check(key)
+	if err != nil {
+		return 0, err
+	}
+
+	// secure_delete only applies to the connection setting it
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("connect: %w", err)
+	}
+	defer conn.Close()
+	if s.dialect.name == BackendSQLite {
+		if _, err := conn.ExecContext(ctx, "PRAGMA secure_delete = ON"); err != nil {
+			return 0, fmt.Errorf("enable secure delete: %w", err)
+		}
+		defer conn.ExecContext(context.Background(), "PRAGMA secure_delete = OFF")
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	for name, value := range map[string][]byte{keySaltSetting: salt, keyCheckSetting: check} {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO settings (key, value) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value", name, base64.StdEncoding.EncodeToString(value),
+		); err != nil {
+			return 0, fmt.Errorf("save database key: %w", err)
+		}
+	}
+	n, err := sealColumn(ctx, tx, key, "SELECT id, content FROM entries", "UPDATE entries SET content = ? WHERE id = ?")
+	if err != nil {
+		return 0, err
+	}
+	if _, err := sealColumn(ctx, tx, key,
+		"SELECT entry_id || ':' || revision, content FROM entry_versions",
+		"UPDATE entry_versions SET content = ? WHERE entry_id || ':' || revision = ?",
+	); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+
+	s.encrypted = true
+	s.setKey(databaseKey, key)
+	if err := s.purgeFreed(ctx, conn); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// purgeFreed rids the database of the old row versions an update left
+// behind: on SQLite, it moves the WAL into the database file and empties
+// it, then rebuilds the file without its free pages (and empties the WAL
+// the rebuild wrote to); on Postgres, it rewrites the tables
+func (s *Store) purgeFreed(ctx context.Context, conn *sql.Conn) error {
+	statements := []string{s.dialect.compact}
+	if s.dialect.name == BackendSQLite {
+		checkpoint := "PRAGMA wal_checkpoint(TRUNCATE)"
+		statements = []string{checkpoint, s.dialect.compact, checkpoint}
+	}
+	for _, statement := range statements {
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("purge plaintext (%s): %w", statement, err)
+		}
+	}
+	return nil
+}
+
+// UnlockDatabase derives the database key from its passphrase and keeps
+// it in this store
+func (s *Store) UnlockDatabase(ctx context.Context, passphrase string) error {
+	if !s.encrypted {
+		return fmt.Errorf("database isn't encrypted")
+	}
+	salt, err := s.keySetting(ctx, keySaltSetting)
+	if err != nil {
+		return err
+	}
+	check, err := s.keySetting(ctx, keyCheckSetting)
+	if err != nil {
+		return err
+	}
+	key := secret.DeriveKey(passphrase, salt)
+	if !secret.Verify(key, check) {
+		return fmt.Errorf("unlock database: %w", secret.ErrWrongKey)
+	}
+	s.setKey(databaseKey, key)
+	return nil
+}
+
+func (s *Store) keySetting(ctx context.Context, name string) ([]byte, error) {
+	value, err := s.GetSetting(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %w", name, err)
+	}
+	return decoded, nil
+}
+
+// sealColumn encrypts with the database key the plaintext values a query
+// returns as (id, content) rows, writing them back with update, and
+// returns how many it encrypted
+func sealColumn(ctx context.Context, tx *sql.Tx, key []byte, query, update string) (int, error) {
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("read content: %w", err)
+	}
+	plaintexts := make(map[string]string)
+	for rows.Next() {
+		var id, content string
+		if err := rows.Scan(&id, &content); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan content: %w", err)
+		}
+		if !strings.HasPrefix(content, encryptedPrefix) {
+			plaintexts[id] = content
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for id, content := range plaintexts {
+		sealed, err := sealWith(key, databaseKey, content)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx, update, sealed, id); err != nil {
+			return 0, fmt.Errorf("encrypt content: %w", err)
+		}
+	}
+	return len(plaintexts), nil
+}
+
+// sealWith encrypts content with a key, stored under its name
+func sealWith(key []byte, name, content string) (string, error) {
+	sealed, err := secret.Seal(key, []byte(content))
+	if err != nil {
+		return "", fmt.Errorf("encrypt content: %w", err)
+	}
+	return encryptedPrefix + name + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// containsFold reports whether text contains query, ignoring case, for
+// text searches that can't run in SQL on encrypted content
+func containsFold(text, query string) bool {
+	return strings.Contains(strings.ToLower(text), strings.ToLower(query))
+}
@@ -0,0 +1,191 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// MinCalibrationSamples is how much feedback a tag needs before its
+// measured precision is trusted
+const MinCalibrationSamples = 5
+
+// TagByHuman links a tag to an entry on behalf of the user, recording the
+// correction when the classifier had missed it
+func (s *Store) TagByHuman(ctx context.Context, entryID, tagID string) error {
+	var origin string
+	err := s.db.QueryRowContext(ctx,
+		"SELECT origin FROM entry_tags WHERE entry_id = ? AND tag_id = ?", entryID, tagID,
+	).Scan(&origin)
+	if err == nil {
+		// Already tagged; nothing was missed
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return fmt.Errorf("get entry tag: %w", err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO entry_tags (entry_id, tag_id, confidence, origin) VALUES (?, ?, 1.0, ?)",
+		entryID, tagID, domain.OriginHuman,
+	); err != nil {
+		return fmt.Errorf("link entry tag: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO tag_feedback (entry_id, tag_id, verdict, created_at) VALUES (?, ?, 'added', ?)",
+		entryID, tagID, time.Now(),
+	); err != nil {
+		return fmt.Errorf("record feedback: %w", err)
+	}
+	return tx.Commit()
+}
+
+// UntagByHuman removes a tag from an entry on behalf of the user, recording
+// the rejection when the tag had been assigned automatically
+func (s *Store) UntagByHuman(ctx context.Context, entryID, tagID string) error {
+	var origin string
+	var confidence float64
+	err := s.db.QueryRowContext(ctx,
+		"SELECT origin, confidence FROM entry_tags WHERE entry_id = ? AND tag_id = ?", entryID, tagID,
+	).Scan(&origin, &confidence)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("entry doesn't have this tag")
+	}
+	if err != nil {
+		return fmt.Errorf("get entry tag: %w", err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM entry_tags WHERE entry_id = ? AND tag_id = ?", entryID, tagID); err != nil {
+		return fmt.Errorf("unlink entry tag: %w", err)
+	}
+	if origin == domain.OriginAuto {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO tag_feedback (entry_id, tag_id, verdict, confidence, created_at) VALUES (?, ?, 'removed', ?, ?)",
+			entryID, tagID, confidence, time.Now(),
+		); err != nil {
+			return fmt.Errorf("record feedback: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// RecomputeTagCalibration measures each tag's precision from feedback.
+// Auto assignments count as kept once the user has viewed or corrected the
+// entry without removing them. Precision is Laplace-smoothed.
+func (s *Store) RecomputeTagCalibration(ctx context.Context) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM tag_calibration"); err != nil {
+		return 0, fmt.Errorf("clear calibration: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO tag_calibration (tag_id, kept, removed, added, precision, updated_at)
+		SELECT t.id, k.n, r.n, a.n, (k.n + 1.0) / (k.n + r.n + 2.0), ?
+		FROM tags t
+		JOIN (
+			SELECT t2.id AS tag_id, COUNT(et.entry_id) AS n
+			FROM tags t2
+			LEFT JOIN entry_tags et ON et.tag_id = t2.id AND et.origin = 'auto'
+				AND et.entry_id IN (
+					SELECT id FROM entries WHERE last_viewed_at IS NOT NULL
+					UNION SELECT entry_id FROM tag_feedback
+				)
+			GROUP BY t2.id
+		) k ON k.tag_id = t.id
+		JOIN (
+			SELECT t2.id AS tag_id, COUNT(f.entry_id) AS n
+			FROM tags t2 LEFT JOIN tag_feedback f ON f.tag_id = t2.id AND f.verdict = 'removed'
+			GROUP BY t2.id
+		) r ON r.tag_id = t.id
+		JOIN (
+			SELECT t2.id AS tag_id, COUNT(f.entry_id) AS n
+			FROM tags t2 LEFT JOIN tag_feedback f ON f.tag_id = t2.id AND f.verdict = 'added'
+			GROUP BY t2.id
+		) a ON a.tag_id = t.id
+		WHERE k.n + r.n + a.n > 0
+	`, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("compute calibration: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+
+	n, _ := result.RowsAffected()
+	return int(n), nil
+}
+
+// TagQuality returns the last computed calibration of the tags of the
+// user ctx acts as, least precise first
+func (s *Store) TagQuality(ctx context.Context) ([]domain.TagQuality, error) {
+	ofUser, args := userCondition(ctx, "t.")
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT t.name, c.kept, c.removed, c.added, c.precision, c.updated_at
+		FROM tag_calibration c
+		JOIN tags t ON t.id = c.tag_id
+		WHERE `+ofUser+`
+		ORDER BY c.precision ASC, c.removed DESC, t.name
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("tag quality: %w", err)
+	}
+	defer rows.Close()
+
+	var quality []domain.TagQuality
+	for rows.Next() {
+		var q domain.TagQuality
+		if err := rows.Scan(&q.Tag, &q.Kept, &q.Removed, &q.Added, &q.Precision, &q.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan tag quality: %w", err)
+		}
+		quality = append(quality, q)
+	}
+	return quality, nil
+}
+
+// CalibrationFactors returns the measured precision of the tags of the
+// user ctx acts as with enough feedback, by tag name, for scaling
+// classifier confidences
+func (s *Store) CalibrationFactors(ctx context.Context) (map[string]float64, error) {
+	ofUser, args := userCondition(ctx, "t.")
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT t.name, c.precision
+		FROM tag_calibration c
+		JOIN tags t ON t.id = c.tag_id
+		WHERE c.kept + c.removed >= ? AND `+ofUser+`
+	`, append([]interface{}{MinCalibrationSamples}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("calibration factors: %w", err)
+	}
+	defer rows.Close()
+
+	factors := make(map[string]float64)
+	for rows.Next() {
+		var name string
+		var precision float64
+		if err := rows.Scan(&name, &precision); err != nil {
+			return nil, fmt.Errorf("scan calibration: %w", err)
+		}
+		factors[name] = precision
+	}
+	return factors, nil
+}
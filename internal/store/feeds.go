@@ -0,0 +1,105 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// AddFeed subscribes to a feed
+func (s *Store) AddFeed(ctx context.Context, url, title string) (*domain.Feed, error) {
+	f := domain.Feed{
+		ID:        uuid.New().String(),
+		URL:       url,
+		Title:     title,
+		CreatedAt: time.Now(),
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO feeds (id, url, title, created_at) VALUES (?, ?, ?, ?)",
+		f.ID, f.URL, f.Title, f.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("insert feed: %w", err)
+	}
+	return &f, nil
+}
+
+// ListFeeds returns all feed subscriptions in creation order
+func (s *Store) ListFeeds(ctx context.Context) ([]domain.Feed, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, url, title, last_polled_at, last_error, created_at FROM feeds ORDER BY created_at")
+	if err != nil {
+		return nil, fmt.Errorf("list feeds: %w", err)
+	}
+	defer rows.Close()
+
+	var feeds []domain.Feed
+	for rows.Next() {
+		var f domain.Feed
+		if err := rows.Scan(&f.ID, &f.URL, &f.Title, &f.LastPolledAt, &f.LastError, &f.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan feed: %w", err)
+		}
+		feeds = append(feeds, f)
+	}
+	return feeds, nil
+}
+
+// DeleteFeed unsubscribes from a feed by ID prefix or URL. Entries ingested
+// from it are kept.
+func (s *Store) DeleteFeed(ctx context.Context, ref string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM feeds WHERE id LIKE lower(?) || '%' OR url = ?", ref, ref)
+	if err != nil {
+		return fmt.Errorf("delete feed: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("feed not found: %s", ref)
+	}
+	return nil
+}
+
+// RecordFeedPoll stores the time and outcome of a feed poll, updating the
+// title the feed currently declares
+func (s *Store) RecordFeedPoll(ctx context.Context, id, title string, at time.Time, pollErr error) error {
+	msg := ""
+	if pollErr != nil {
+		msg = pollErr.Error()
+	}
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE feeds SET title = COALESCE(NULLIF(?, ''), title), last_polled_at = ?, last_error = ? WHERE id = ?",
+		title, at, msg, id,
+	)
+	if err != nil {
+		return fmt.Errorf("record feed poll: %w", err)
+	}
+	return nil
+}
+
+// HasFeedItem reports whether a feed item was already seen
+func (s *Store) HasFeedItem(ctx context.Context, feedID, guid string) (bool, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM feed_items WHERE feed_id = ? AND guid = ?", feedID, guid).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("find feed item: %w", err)
+	}
+	return n > 0, nil
+}
+
+// AddFeedItem marks a feed item as seen, with the entry it was saved as
+// (empty if it was skipped)
+func (s *Store) AddFeedItem(ctx context.Context, feedID, guid, entryID string) error {
+	var entry *string
+	if entryID != "" {
+		entry = &entryID
+	}
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO feed_items (feed_id, guid, entry_id, seen_at) VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING",
+		feedID, guid, entry, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("add feed item: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// defaultFilterLimit caps filtered results when the filter sets no limit
+const defaultFilterLimit = 50
+
+// tagTreeCondition matches entries carrying a tag, by id, name or alias
+// (see Store.tagRef), or one of its descendants
+const tagTreeCondition = `e.id IN (
+	WITH RECURSIVE tree(id) AS (
+		SELECT t.id FROM tags t LEFT JOIN tag_aliases a ON a.tag_id = t.id WHERE ? IN (t.id, t.name, a.alias)
+		UNION
+		SELECT t.id FROM tags t JOIN tree ON t.parent_id = tree.id
+	)
+	SELECT entry_id FROM entry_tags WHERE tag_id IN (SELECT id FROM tree)
+)`
+
+// tagCondition matches entries carrying a tag, by id, name or alias, but
+// not its descendants
+const tagCondition = `e.id IN (
+	SELECT et.entry_id FROM entry_tags et
+	JOIN tags t ON t.id = et.tag_id
+	LEFT JOIN tag_aliases a ON a.tag_id = t.id
+	WHERE ? IN (t.id, t.name, a.alias)
+)`
+
+// notebookTreeCondition matches entries in a notebook or one of its
+// sub-notebooks
+const notebookTreeCondition = `e.notebook IN (
+	WITH RECURSIVE tree(name) AS (
+		SELECT name FROM notebooks WHERE name = ?
+		UNION ALL
+		SELECT n.name FROM notebooks n JOIN tree ON n.parent = tree.name
+	)
+	SELECT name FROM tree
+)`
+
+// FilterEntries returns the entries matching a filter, newest first
+func (s *Store) FilterEntries(ctx context.Context, f domain.EntryFilter) ([]domain.Entry, error) {
+	where := []string{"1 = 1"}
+	var args []interface{}
+
+	if f.Text != "" {
+		// Encrypted content is matched once decrypted
+		match, matchArgs := s.dialect.textMatch("e.", f.Text, true)
+		where = append(where, "("+match+" OR e.content LIKE ?)")
+		args = append(append(args, matchArgs...), encryptedPrefix+"%")
+	}
+	for _, tag := range f.Tags {
+		where = append(where, tagTreeCondition)
+		args = append(args, s.tagRef(ctx, tag))
+	}
+	for _, tag := range f.ExcludeTags {
+		where = append(where, "NOT "+tagTreeCondition)
+		args = append(args, s.tagRef(ctx, tag))
+	}
+	if f.Notebook != "" {
+		where = append(where, notebookTreeCondition)
+		args = append(args, f.Notebook)
+	}
+	if f.SourceType != "" {
+		where = append(where, "e.source_type = ?")
+		args = append(args, f.SourceType)
+	}
+	if f.Maturity != "" {
+		if !slices.Contains(domain.MaturityLevels, f.Maturity) {
+			return nil, fmt.Errorf("unknown maturity: %s", f.Maturity)
+		}
+		where = append(where, "e.maturity = ?")
+		args = append(args, f.Maturity)
+	}
+	for _, bound := range []struct {
+		date, op string
+	}{{f.CreatedAfter, ">="}, {f.CreatedBefore, "<"}} {
+		if bound.date == "" {
+			continue
+		}
+		day, err := time.ParseInLocation("2006-01-02", bound.date, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %q (want YYYY-MM-DD)", bound.date)
+		}
+		where = append(where, "julianday(e.created_at) "+bound.op+" julianday(?)")
+		args = append(args, day.UTC())
+	}
+	if f.Viewed != nil {
+		if *f.Viewed {
+			where = append(where, "e.last_viewed_at IS NOT NULL")
+		} else {
+			where = append(where, "e.last_viewed_at IS NULL")
+		}
+	}
+	if f.Reviewed != nil {
+		reviewed := "EXISTS (SELECT 1 FROM review_log rl WHERE rl.entry_id = e.id)"
+		if !*f.Reviewed {
+			reviewed = "NOT " + reviewed
+		}
+		where = append(where, reviewed)
+	}
+	if !f.Scratch {
+		where = append(where, "e.expires_at IS NULL")
+	}
+	inScope, err := scopeCondition(f.Scope, "e.")
+	if err != nil {
+		return nil, err
+	}
+	visible, notebookArgs := s.visibleCondition(ctx, "e.")
+	where = append(where, inScope, visible)
+	args = append(args, notebookArgs...)
+
+	limit := f.Limit
+	if limit <= 0 {
+		limit = defaultFilterLimit
+	}
+	// Text filters match encrypted entries once decrypted, reading rows
+	// until they have enough
+	page := ""
+	if f.Text == "" {
+		page = "LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT e.id, e.content, e.created_at, e.last_viewed_at,
+		       e.source_type, e.source_url, e.title, e.author, e.fetched_at, e.expires_at, e.maturity
+		FROM entries e
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY e.created_at DESC
+		`+page, args...)
+	if err != nil {
+		return nil, fmt.Errorf("filter entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []domain.Entry
+	for rows.Next() && len(entries) < limit {
+		var e domain.Entry
+		if err := rows.Scan(entryFields(&e)...); err != nil {
+			return nil, fmt.Errorf("scan entry: %w", err)
+		}
+		encrypted := strings.HasPrefix(e.Content, encryptedPrefix)
+		s.openContent(&e)
+		if encrypted && f.Text != "" && !containsFold(e.Content, f.Text) && !containsFold(e.Source.Title, f.Text) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
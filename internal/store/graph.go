@@ -0,0 +1,157 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// DefaultGraphSimilarity is how alike two entries' embeddings must be for
+// the graph to connect them
+const DefaultGraphSimilarity = 0.85
+
+// Graph returns the network of active entries and their tags: tag and
+// parent tag edges, links between entries, and similar edges between
+// entries whose embeddings are at least minSimilarity alike (none when
+// minSimilarity is 0 or less). Only entries of the notebook ctx works in
+// are included.
+func (s *Store) Graph(ctx context.Context, minSimilarity float64) (*domain.Graph, error) {
+	entries, err := s.ListEntries(ctx, domain.ScopeActive, -1, 0)
+	if err != nil {
+		return nil, err
+	}
+	g := &domain.Graph{Nodes: []domain.GraphNode{}, Edges: []domain.GraphEdge{}}
+	included := make(map[string]bool, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		included[e.ID] = true
+		g.Nodes = append(g.Nodes, domain.GraphNode{ID: e.ID, Kind: domain.NodeEntry, Label: e.DisplayTitle()})
+	}
+
+	if err := s.graphTags(ctx, g, included); err != nil {
+		return nil, err
+	}
+	if err := s.graphLinks(ctx, g, included); err != nil {
+		return nil, err
+	}
+	if minSimilarity > 0 {
+		if err := s.graphSimilar(ctx, g, included, minSimilarity); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// graphTags adds the tags of the included entries to g, with the tags
+// above them
+func (s *Store) graphTags(ctx context.Context, g *domain.Graph, included map[string]bool) error {
+	tags, err := s.ListTags(ctx)
+	if err != nil {
+		return err
+	}
+	byID := make(map[string]domain.Tag, len(tags))
+	for _, t := range tags {
+		byID[t.ID] = t
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT et.entry_id, et.tag_id, COALESCE(et.confidence, 1)
+		FROM entry_tags et
+		JOIN tags t ON t.id = et.tag_id
+		ORDER BY t.name
+	`)
+	if err != nil {
+		return fmt.Errorf("graph tags: %w", err)
+	}
+	defer rows.Close()
+
+	added := make(map[string]bool)
+	var addTag func(t domain.Tag)
+	addTag = func(t domain.Tag) {
+		if added[t.ID] {
+			return
+		}
+		added[t.ID] = true
+		g.Nodes = append(g.Nodes, domain.GraphNode{ID: domain.TagNodeID(t.Name), Kind: domain.NodeTag, Label: t.Name})
+		if t.ParentID == nil {
+			return
+		}
+		if parent, ok := byID[*t.ParentID]; ok {
+			addTag(parent)
+			g.Edges = append(g.Edges, domain.GraphEdge{Source: domain.TagNodeID(t.Name), Target: domain.TagNodeID(parent.Name), Kind: domain.EdgeParent})
+		}
+	}
+	for rows.Next() {
+		var entryID, tagID string
+		var confidence float64
+		if err := rows.Scan(&entryID, &tagID, &confidence); err != nil {
+			return fmt.Errorf("scan entry tag: %w", err)
+		}
+		t, ok := byID[tagID]
+		if !ok || !included[entryID] {
+			continue
+		}
+		addTag(t)
+		g.Edges = append(g.Edges, domain.GraphEdge{Source: entryID, Target: domain.TagNodeID(t.Name), Kind: domain.EdgeTagged, Weight: confidence})
+	}
+	return rows.Err()
+}
+
+// graphLinks adds the links between included entries to g
+func (s *Store) graphLinks(ctx context.Context, g *domain.Graph, included map[string]bool) error {
+	rows, err := s.db.QueryContext(ctx, "SELECT from_id, to_id, kind FROM entry_links ORDER BY created_at")
+	if err != nil {
+		return fmt.Errorf("graph links: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e domain.GraphEdge
+		if err := rows.Scan(&e.Source, &e.Target, &e.Kind); err != nil {
+			return fmt.Errorf("scan link: %w", err)
+		}
+		if included[e.Source] && included[e.Target] {
+			g.Edges = append(g.Edges, e)
+		}
+	}
+	return rows.Err()
+}
+
+// graphSimilar adds an edge between each pair of included entries at
+// least minSimilarity alike
+func (s *Store) graphSimilar(ctx context.Context, g *domain.Graph, included map[string]bool, minSimilarity float64) error {
+	rows, err := s.db.QueryContext(ctx, "SELECT entry_id, vector FROM embeddings ORDER BY entry_id")
+	if err != nil {
+		return fmt.Errorf("graph embeddings: %w", err)
+	}
+	type embedded struct {
+		id     string
+		vector []float64
+	}
+	var vectors []embedded
+	for rows.Next() {
+		var id string
+		var blob []byte
+		if err := rows.Scan(&id, &blob); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan embedding: %w", err)
+		}
+		if included[id] {
+			vectors = append(vectors, embedded{id, blobToVector(blob)})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i, a := range vectors {
+		for _, b := range vectors[i+1:] {
+			if sim := cosineSimilarity(a.vector, b.vector); sim >= minSimilarity {
+				g.Edges = append(g.Edges, domain.GraphEdge{Source: a.id, Target: b.id, Kind: domain.EdgeSimilar, Weight: sim})
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// jobLease is the lease name guarding a single job
+func jobLease(name string) string {
+	return "job:" + name
+}
+
+// GetJobState returns the persisted state of a job (zero state if never run)
+func (s *Store) GetJobState(ctx context.Context, name string) (*domain.JobState, error) {
+	js := domain.JobState{Name: name}
+	var lastError sql.NullString
+	err := s.db.QueryRowContext(ctx,
+		"SELECT last_run_at, last_error FROM jobs WHERE name = ?",
+		name,
+	).Scan(&js.LastRunAt, &lastError)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("get job state: %w", err)
+	}
+	js.LastError = lastError.String
+
+	lease, err := s.GetLease(ctx, jobLease(name))
+	if err != nil {
+		return nil, err
+	}
+	if lease != nil {
+		js.LockOwner = lease.Owner
+		js.LockExpiresAt = &lease.ExpiresAt
+	}
+	return &js, nil
+}
+
+// RecordJobRun persists the completion time and error (if any) of a job run
+func (s *Store) RecordJobRun(ctx context.Context, name string, at time.Time, runErr error) error {
+	var errMsg *string
+	if runErr != nil {
+		msg := runErr.Error()
+		errMsg = &msg
+	}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO jobs (name, last_run_at, last_error) VALUES (?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET last_run_at = excluded.last_run_at, last_error = excluded.last_error
+	`, name, at, errMsg)
+	if err != nil {
+		return fmt.Errorf("record job run: %w", err)
+	}
+	return nil
+}
+
+// AcquireJobLock takes the singleton lease on a job for owner until ttl elapses.
+// It returns false if another owner holds an unexpired lease.
+func (s *Store) AcquireJobLock(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	return s.AcquireLease(ctx, jobLease(name), owner, ttl)
+}
+
+// ReleaseJobLock drops the lease on a job if owner still holds it
+func (s *Store) ReleaseJobLock(ctx context.Context, name, owner string) error {
+	return s.ReleaseLease(ctx, jobLease(name), owner)
+}
+
+// Optimize runs the query planner maintenance of the database
+func (s *Store) Optimize(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, s.dialect.optimize); err != nil {
+		return fmt.Errorf("optimize: %w", err)
+	}
+	return nil
+}
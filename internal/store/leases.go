@@ -0,0 +1,165 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// WriterLease is the lease held while running write-heavy jobs, so that
+// daemons on machines sharing a synced database don't write concurrently
+const WriterLease = "writer"
+
+// AcquireLease takes (or renews) a named lease for owner until ttl elapses.
+// It returns false if another owner holds an unexpired lease.
+func (s *Store) AcquireLease(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var holder string
+	var acquiredAt, expiresAt time.Time
+	err = tx.QueryRowContext(ctx,
+		"SELECT owner, acquired_at, expires_at FROM leases WHERE name = ?",
+		name,
+	).Scan(&holder, &acquiredAt, &expiresAt)
+	if err != nil && err != sql.ErrNoRows {
+		return false, fmt.Errorf("read lease: %w", err)
+	}
+
+	now := time.Now()
+	if err == nil && holder != owner && expiresAt.After(now) {
+		return false, nil
+	}
+	if err != nil || holder != owner {
+		acquiredAt = now
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO leases (name, owner, acquired_at, expires_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET owner = excluded.owner, acquired_at = excluded.acquired_at, expires_at = excluded.expires_at
+	`, name, owner, acquiredAt, now.Add(ttl))
+	if err != nil {
+		return false, fmt.Errorf("write lease: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("commit lease: %w", err)
+	}
+	return true, nil
+}
+
+// ErrLeaseLost is the cause of the cancellation of a held lease's context
+// once another owner took the lease
+var ErrLeaseLost = errors.New("lease lost to another owner")
+
+// HoldLease acquires a lease and keeps renewing it, every third of ttl,
+// until the returned release function is called. It returns false if
+// another owner holds the lease. The returned context, derived from ctx,
+// is cancelled with ErrLeaseLost as its cause if the lease is lost: a
+// renewal finds another owner, or renewals fail for ttl. Work done under
+// the lease must stop then.
+func (s *Store) HoldLease(ctx context.Context, name, owner string, ttl time.Duration) (context.Context, func(), bool, error) {
+	acquired, err := s.AcquireLease(ctx, name, owner, ttl)
+	if err != nil || !acquired {
+		return nil, nil, false, err
+	}
+
+	held, cancel := context.WithCancelCause(ctx)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		renewed := time.Now()
+		for {
+			select {
+			case <-held.Done():
+				return
+			case <-ticker.C:
+				acquired, err := s.AcquireLease(held, name, owner, ttl)
+				switch {
+				case err != nil && held.Err() != nil:
+					return
+				case err != nil:
+					slog.Warn("renew lease", "lease", name, "err", err)
+					if time.Since(renewed) < ttl {
+						continue
+					}
+				case acquired:
+					renewed = time.Now()
+					continue
+				}
+				slog.Warn("lease lost", "lease", name, "owner", owner)
+				cancel(ErrLeaseLost)
+				return
+			}
+		}
+	}()
+
+	release := func() {
+		cancel(context.Canceled)
+		<-stopped
+		s.ReleaseLease(context.WithoutCancel(ctx), name, owner)
+	}
+	return held, release, true, nil
+}
+
+// ReleaseLease drops a lease if owner still holds it
+func (s *Store) ReleaseLease(ctx context.Context, name, owner string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM leases WHERE name = ? AND owner = ?", name, owner)
+	if err != nil {
+		return fmt.Errorf("release lease: %w", err)
+	}
+	return nil
+}
+
+// GetLease returns the unexpired lease with the given name, or nil
+func (s *Store) GetLease(ctx context.Context, name string) (*domain.Lease, error) {
+	var l domain.Lease
+	err := s.db.QueryRowContext(ctx,
+		"SELECT name, owner, acquired_at, expires_at FROM leases WHERE name = ?",
+		name,
+	).Scan(&l.Name, &l.Owner, &l.AcquiredAt, &l.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get lease: %w", err)
+	}
+	if !l.ExpiresAt.After(time.Now()) {
+		return nil, nil
+	}
+	return &l, nil
+}
+
+// ListLeases returns all unexpired leases
+func (s *Store) ListLeases(ctx context.Context) ([]domain.Lease, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT name, owner, acquired_at, expires_at FROM leases ORDER BY name",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list leases: %w", err)
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	var leases []domain.Lease
+	for rows.Next() {
+		var l domain.Lease
+		if err := rows.Scan(&l.Name, &l.Owner, &l.AcquiredAt, &l.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("scan lease: %w", err)
+		}
+		if l.ExpiresAt.After(now) {
+			leases = append(leases, l)
+		}
+	}
+	return leases, nil
+}
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAcquireLease(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		owner string
+		ttl   time.Duration
+		want  bool
+	}{
+		{"first owner", "a", time.Hour, true},
+		{"renewal", "a", time.Hour, true},
+		{"other owner", "b", time.Hour, false},
+		{"expired lease", "a", -time.Second, true},
+		{"other owner after expiry", "b", time.Hour, true},
+	}
+	for _, tt := range tests {
+		got, err := s.AcquireLease(ctx, "job", tt.owner, tt.ttl)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: acquired = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHoldLease(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	const ttl = 90 * time.Millisecond
+
+	held, release, acquired, err := s.HoldLease(ctx, WriterLease, "a", ttl)
+	if err != nil || !acquired {
+		t.Fatalf("HoldLease = %v, %v", acquired, err)
+	}
+	if _, _, acquired, err := s.HoldLease(ctx, WriterLease, "b", ttl); err != nil || acquired {
+		t.Errorf("HoldLease by another owner = %v, %v, want false", acquired, err)
+	}
+
+	// Renewals keep the lease past its ttl
+	time.Sleep(2 * ttl)
+	if lease, err := s.GetLease(ctx, WriterLease); err != nil || lease == nil || lease.Owner != "a" {
+		t.Fatalf("GetLease = %+v, %v, want held by a", lease, err)
+	}
+	if held.Err() != nil {
+		t.Fatalf("held context done: %v", context.Cause(held))
+	}
+
+	release()
+	if lease, err := s.GetLease(ctx, WriterLease); err != nil || lease != nil {
+		t.Errorf("GetLease after release = %+v, %v, want none", lease, err)
+	}
+	if cause := context.Cause(held); errors.Is(cause, ErrLeaseLost) || held.Err() == nil {
+		t.Errorf("held context after release: %v, want cancelled", cause)
+	}
+}
+
+func TestHoldLeaseLost(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	const ttl = 90 * time.Millisecond
+
+	held, release, acquired, err := s.HoldLease(ctx, WriterLease, "a", ttl)
+	if err != nil || !acquired {
+		t.Fatalf("HoldLease = %v, %v", acquired, err)
+	}
+
+	// Another process takes the lease over, as after a stall of this one
+	if _, err := s.db.ExecContext(ctx, "UPDATE leases SET owner = ?, expires_at = ? WHERE name = ?", "b", time.Now().Add(time.Hour), WriterLease); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-held.Done():
+	case <-time.After(10 * ttl):
+		t.Fatal("held context not cancelled once the lease was lost")
+	}
+	if cause := context.Cause(held); !errors.Is(cause, ErrLeaseLost) {
+		t.Errorf("cause = %v, want ErrLeaseLost", cause)
+	}
+
+	// Releasing a lost lease leaves the new owner's alone
+	release()
+	if lease, err := s.GetLease(ctx, WriterLease); err != nil || lease == nil || lease.Owner != "b" {
+		t.Errorf("GetLease = %+v, %v, want held by b", lease, err)
+	}
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// LinkEntries links an entry to another as related. Linking an already
+// linked pair, in either direction, does nothing.
+func (s *Store) LinkEntries(ctx context.Context, fromID, toID string) error {
+	if fromID == toID {
+		return fmt.Errorf("cannot link an entry to itself")
+	}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO entry_links (from_id, to_id, created_at)
+		SELECT ?, ?, ?
+		WHERE NOT EXISTS (SELECT 1 FROM entry_links WHERE from_id = ? AND to_id = ?)
+		ON CONFLICT DO NOTHING
+	`, fromID, toID, time.Now(), toID, fromID)
+	if err != nil {
+		return fmt.Errorf("link entries: %w", err)
+	}
+	return nil
+}
+
+// SetEntryLink links an entry to another with a kind of link, replacing
+// any link between them, in either direction
+func (s *Store) SetEntryLink(ctx context.Context, fromID, toID, kind string) error {
+	if fromID == toID {
+		return fmt.Errorf("cannot link an entry to itself")
+	}
+	if err := domain.CheckLinkKind(kind); err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		"DELETE FROM entry_links WHERE (from_id = ? AND to_id = ?) OR (from_id = ? AND to_id = ?)",
+		fromID, toID, toID, fromID,
+	); err != nil {
+		return fmt.Errorf("unlink entries: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO entry_links (from_id, to_id, kind, created_at) VALUES (?, ?, ?, ?)",
+		fromID, toID, kind, time.Now(),
+	); err != nil {
+		return fmt.Errorf("link entries: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// UnlinkEntries removes the link between two entries, in either direction
+func (s *Store) UnlinkEntries(ctx context.Context, id, otherID string) error {
+	result, err := s.db.ExecContext(ctx,
+		"DELETE FROM entry_links WHERE (from_id = ? AND to_id = ?) OR (from_id = ? AND to_id = ?)",
+		id, otherID, otherID, id,
+	)
+	if err != nil {
+		return fmt.Errorf("unlink entries: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%s and %s aren't linked", id, otherID)
+	}
+	return nil
+}
+
+// ListEntryLinks returns the links from an entry and its backlinks, the
+// links to it, oldest first, leaving out entries in the trash
+func (s *Store) ListEntryLinks(ctx context.Context, id string) (links, backlinks []domain.EntryLink, err error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT e.id, e.content, e.created_at, e.last_viewed_at,
+		       e.source_type, e.source_url, e.title, e.author, e.fetched_at, e.expires_at, e.maturity,
+		       l.kind, l.to_id = e.id, l.created_at
+		FROM entry_links l
+		JOIN entries e ON e.id = CASE WHEN l.from_id = ? THEN l.to_id ELSE l.from_id END
+		WHERE (l.from_id = ? OR l.to_id = ?) AND e.deleted_at IS NULL
+		ORDER BY l.created_at
+	`, id, id, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list entry links: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e domain.Entry
+		var kind string
+		var outgoing bool
+		var linkedAt time.Time
+		if err := rows.Scan(append(entryFields(&e), &kind, &outgoing, &linkedAt)...); err != nil {
+			return nil, nil, fmt.Errorf("scan entry link: %w", err)
+		}
+		s.openContent(&e)
+		link := domain.EntryLink{EntryID: e.ID, Title: e.DisplayTitle(), Kind: kind, CreatedAt: linkedAt}
+		if outgoing {
+			links = append(links, link)
+		} else {
+			backlinks = append(backlinks, link)
+		}
+	}
+	return links, backlinks, rows.Err()
+}
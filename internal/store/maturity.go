@@ -0,0 +1,124 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// SetMaturity moves an entry to another maturity level, provided the
+// transition is allowed, and logs the change
+func (s *Store) SetMaturity(ctx context.Context, id, to string) error {
+	var from string
+	if err := s.db.QueryRowContext(ctx, "SELECT maturity FROM entries WHERE id = ?", id).Scan(&from); err != nil {
+		return fmt.Errorf("entry not found")
+	}
+	if from == to {
+		return fmt.Errorf("entry is already %s", to)
+	}
+	if !domain.CanTransition(from, to) {
+		return fmt.Errorf("cannot move a %s note to %s", from, to)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "UPDATE entries SET maturity = ? WHERE id = ?", to, id); err != nil {
+		return fmt.Errorf("set maturity: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO maturity_log (entry_id, from_maturity, to_maturity, changed_at) VALUES (?, ?, ?, ?)",
+		id, from, to, time.Now(),
+	); err != nil {
+		return fmt.Errorf("log maturity change: %w", err)
+	}
+	return tx.Commit()
+}
+
+// ListEntriesByMaturity returns the active entries at a maturity level,
+// newest first
+func (s *Store) ListEntriesByMaturity(ctx context.Context, maturity string, limit, offset int) ([]domain.Entry, error) {
+	visible, args := s.visibleCondition(ctx, "")
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT id, content, created_at, last_viewed_at, source_type, source_url, title, author, fetched_at, expires_at, maturity FROM entries WHERE maturity = ? AND archived_at IS NULL AND deleted_at IS NULL AND "+visible+" ORDER BY created_at DESC LIMIT ? OFFSET ?",
+		append(append([]interface{}{maturity}, args...), limit, offset)...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list entries by maturity: %w", err)
+	}
+	defer rows.Close()
+
+	return s.scanEntries(rows)
+}
+
+// MaturityCounts returns the number of permanent entries at each maturity level
+func (s *Store) MaturityCounts(ctx context.Context) (map[string]int, error) {
+	ofUser, args := userCondition(ctx, "")
+	rows, err := s.db.QueryContext(ctx, "SELECT maturity, COUNT(*) FROM entries WHERE expires_at IS NULL AND deleted_at IS NULL AND "+ofUser+" GROUP BY maturity", args...)
+	if err != nil {
+		return nil, fmt.Errorf("maturity counts: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var maturity string
+		var n int
+		if err := rows.Scan(&maturity, &n); err != nil {
+			return nil, fmt.Errorf("scan maturity count: %w", err)
+		}
+		counts[maturity] = n
+	}
+	return counts, rows.Err()
+}
+
+// CountPromotionsSince counts the entries promoted to each level since the
+// given time. Demotions are not counted.
+func (s *Store) CountPromotionsSince(ctx context.Context, since time.Time) (map[string]int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT to_maturity, COUNT(DISTINCT entry_id)
+		FROM maturity_log
+		WHERE julianday(changed_at) >= julianday(?) AND from_maturity != ?
+		GROUP BY to_maturity
+	`, since.UTC(), domain.MaturityEvergreen)
+	if err != nil {
+		return nil, fmt.Errorf("count promotions: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var maturity string
+		var n int
+		if err := rows.Scan(&maturity, &n); err != nil {
+			return nil, fmt.Errorf("scan promotion count: %w", err)
+		}
+		counts[maturity] = n
+	}
+	return counts, rows.Err()
+}
+
+// StaleFleetingEntries returns permanent fleeting notes older than the
+// given age, oldest first: candidates for refinement or deletion
+func (s *Store) StaleFleetingEntries(ctx context.Context, olderThan time.Duration, limit int) ([]domain.Entry, error) {
+	ofUser, args := userCondition(ctx, "")
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, content, created_at, last_viewed_at, source_type, source_url, title, author, fetched_at, expires_at, maturity
+		FROM entries
+		WHERE maturity = ? AND expires_at IS NULL AND archived_at IS NULL AND deleted_at IS NULL
+		  AND julianday(created_at) < julianday(?) AND `+ofUser+`
+		ORDER BY created_at
+		LIMIT ?
+	`, append(append([]interface{}{domain.MaturityFleeting, time.Now().Add(-olderThan).UTC()}, args...), limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("stale fleeting entries: %w", err)
+	}
+	defer rows.Close()
+
+	return s.scanEntries(rows)
+}
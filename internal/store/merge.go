@@ -0,0 +1,377 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// MergeEntries merges entries into a target, for duplicate captures: the
+// contents are joined after the target's, tags are unioned and everything
+// hanging off the merged entries (attachments, occurrences, views,
+// reviews, links, workflow states, collections, shares...) moves to the
+// target. Their past versions and last contents become versions of the
+// target, before the merge. The merged entries are then deleted; their
+// creation times and URLs are kept in the target's merge history. The
+// embedding is only carried over when the target has none, and passage
+// embeddings are moved to where the passages end up, so callers should
+// embed the merged content again.
+func (s *Store) MergeEntries(ctx context.Context, targetID string, ids []string) (*domain.Entry, error) {
+	target, sources, err := s.mergeSet(ctx, targetID, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	contents := []string{strings.TrimSpace(target.Content)}
+	parts := []mergedPart{{lead: leadingSpace(target.Content), length: len(contents[0])}}
+	at := len(contents[0])
+	maturity := target.Maturity
+	lastViewed := target.LastViewedAt
+	for _, src := range sources {
+		contents = append(contents, strings.TrimSpace(src.Content))
+		at += len(domain.MergeSeparator)
+		parts = append(parts, mergedPart{at: at, lead: leadingSpace(src.Content), length: len(contents[len(contents)-1])})
+		at += parts[len(parts)-1].length
+		if slices.Index(domain.MaturityLevels, src.Maturity) > slices.Index(domain.MaturityLevels, maturity) {
+			maturity = src.Maturity
+		}
+		if src.LastViewedAt != nil && (lastViewed == nil || src.LastViewedAt.After(*lastViewed)) {
+			lastViewed = src.LastViewedAt
+		}
+	}
+
+	content, err := s.sealContent(ctx, target.Notebook, strings.Join(contents, domain.MergeSeparator))
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if err := saveVersion(ctx, tx, targetID); err != nil {
+		return nil, err
+	}
+	if err := moveChunks(ctx, tx, targetID, targetID, parts[0]); err != nil {
+		return nil, err
+	}
+	revision := target.Revision
+	for i, src := range sources {
+		if err := unionTags(ctx, tx, src.ID, targetID); err != nil {
+			return nil, err
+		}
+		if err := moveEntryRows(ctx, tx, src.ID, targetID, ids); err != nil {
+			return nil, err
+		}
+		if err := moveChunks(ctx, tx, src.ID, targetID, parts[i+1]); err != nil {
+			return nil, err
+		}
+		moved, err := moveVersions(ctx, tx, src.ID, targetID, revision)
+		if err != nil {
+			return nil, err
+		}
+		revision += moved
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO entry_merges (entry_id, merged_id, title, source_url, canonical_url, created_at, merged_at) SELECT ?, ?, ?, ?, canonical_url, ?, ? FROM entries WHERE id = ?",
+			targetID, src.ID, src.Source.Title, src.Source.URL, src.CreatedAt, now, src.ID,
+		); err != nil {
+			return nil, fmt.Errorf("record merge: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM entries WHERE id = ?", src.ID); err != nil {
+			return nil, fmt.Errorf("delete merged entry: %w", err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE entries SET content = ?, maturity = ?, last_viewed_at = ?, revision = ?, updated_at = ? WHERE id = ?",
+		content, maturity, lastViewed, revision+1, now, targetID,
+	); err != nil {
+		return nil, fmt.Errorf("update merged entry: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return s.GetEntry(ctx, targetID)
+}
+
+// LinkDuplicates is the gentle alternative to MergeEntries: the entries
+// are kept, linked to the target, and all end up with the union of their
+// tags
+func (s *Store) LinkDuplicates(ctx context.Context, targetID string, ids []string) (*domain.Entry, error) {
+	if _, _, err := s.mergeSet(ctx, targetID, ids); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, id := range ids {
+		if err := unionTags(ctx, tx, id, targetID); err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now()
+	for _, id := range ids {
+		if err := unionTags(ctx, tx, targetID, id); err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO entry_links (from_id, to_id, created_at)
+			SELECT ?, ?, ?
+			WHERE NOT EXISTS (SELECT 1 FROM entry_links WHERE from_id = ? AND to_id = ?)
+			ON CONFLICT DO NOTHING
+		`, targetID, id, now, id, targetID); err != nil {
+			return nil, fmt.Errorf("link entries: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return s.GetEntry(ctx, targetID)
+}
+
+// ListMergedEntries returns the entries merged into an entry, oldest
+// first
+func (s *Store) ListMergedEntries(ctx context.Context, id string) ([]domain.MergedEntry, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT merged_id, title, source_url, created_at, merged_at FROM entry_merges WHERE entry_id = ? ORDER BY created_at", id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list merged entries: %w", err)
+	}
+	defer rows.Close()
+
+	var merged []domain.MergedEntry
+	for rows.Next() {
+		var m domain.MergedEntry
+		var title, url sql.NullString
+		if err := rows.Scan(&m.ID, &title, &url, &m.CreatedAt, &m.MergedAt); err != nil {
+			return nil, fmt.Errorf("scan merged entry: %w", err)
+		}
+		m.Title, m.URL = title.String, url.String
+		merged = append(merged, m)
+	}
+	return merged, rows.Err()
+}
+
+// mergeSet loads the target and the entries to merge into it, checking
+// they are distinct, exist and are readable in the same notebook
+func (s *Store) mergeSet(ctx context.Context, targetID string, ids []string) (*domain.Entry, []*domain.Entry, error) {
+	if len(ids) == 0 {
+		return nil, nil, fmt.Errorf("nothing to merge")
+	}
+	target, err := s.GetEntry(ctx, targetID)
+	if err != nil {
+		return nil, nil, ErrEntryNotFound
+	}
+	if target.Locked {
+		return nil, nil, fmt.Errorf("%w: %s", ErrNotebookLocked, target.Notebook)
+	}
+	var sources []*domain.Entry
+	for i, id := range ids {
+		if id == targetID || slices.Contains(ids[:i], id) {
+			return nil, nil, fmt.Errorf("entry %s appears twice", id)
+		}
+		src, err := s.GetEntry(ctx, id)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %s", ErrEntryNotFound, id)
+		}
+		if src.Notebook != target.Notebook {
+			return nil, nil, fmt.Errorf("entry %s is in another notebook", id)
+		}
+		if src.Locked {
+			return nil, nil, fmt.Errorf("%w: %s", ErrNotebookLocked, src.Notebook)
+		}
+		sources = append(sources, src)
+	}
+	return target, sources, nil
+}
+
+// unionTags gives an entry the tags of another. A tag both have keeps the
+// higher confidence, and counts as human-assigned if either assignment was.
+func unionTags(ctx context.Context, tx *sql.Tx, fromID, toID string) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO entry_tags (entry_id, tag_id, confidence, origin)
+		SELECT ?, tag_id, confidence, origin FROM entry_tags WHERE entry_id = ?
+		ON CONFLICT (entry_id, tag_id) DO UPDATE SET
+			confidence = CASE WHEN excluded.confidence > entry_tags.confidence THEN excluded.confidence ELSE entry_tags.confidence END,
+			origin = CASE WHEN excluded.origin = 'human' THEN 'human' ELSE entry_tags.origin END
+	`, toID, fromID)
+	if err != nil {
+		return fmt.Errorf("union tags: %w", err)
+	}
+	return nil
+}
+
+// moveEntryRows repoints what refers to an entry being merged to the
+// target. Rows the target already has an equivalent of are left to be
+// deleted with the merged entry; links between entries of the merge
+// would become self-links and are dropped.
+func moveEntryRows(ctx context.Context, tx *sql.Tx, fromID, toID string, merging []string) error {
+	statements := []string{
+		"UPDATE attachments SET entry_id = ?1 WHERE entry_id = ?2",
+		"UPDATE source_occurrences SET entry_id = ?1 WHERE entry_id = ?2",
+		"UPDATE entry_views SET entry_id = ?1 WHERE entry_id = ?2",
+		"UPDATE review_log SET entry_id = ?1 WHERE entry_id = ?2",
+		"UPDATE maturity_log SET entry_id = ?1 WHERE entry_id = ?2",
+		"UPDATE workflow_log SET entry_id = ?1 WHERE entry_id = ?2",
+		"UPDATE tag_feedback SET entry_id = ?1 WHERE entry_id = ?2",
+		"UPDATE feed_items SET entry_id = ?1 WHERE entry_id = ?2",
+		"UPDATE entry_merges SET entry_id = ?1 WHERE entry_id = ?2",
+		`INSERT INTO reviews (entry_id, ease, interval_days, repetitions, next_due, last_reviewed_at)
+			SELECT ?1, ease, interval_days, repetitions, next_due, last_reviewed_at FROM reviews WHERE entry_id = ?2
+			ON CONFLICT DO NOTHING`,
+		"INSERT INTO rule_firings (rule_id, entry_id, fired_at) SELECT rule_id, ?1, fired_at FROM rule_firings WHERE entry_id = ?2 ON CONFLICT DO NOTHING",
+		`INSERT INTO entry_workflows (entry_id, workflow, state, updated_at)
+			SELECT ?1, workflow, state, updated_at FROM entry_workflows WHERE entry_id = ?2
+			ON CONFLICT DO NOTHING`,
+		`INSERT INTO embeddings (entry_id, vector, model, created_at)
+			SELECT ?1, vector, model, created_at FROM embeddings WHERE entry_id = ?2
+			ON CONFLICT DO NOTHING`,
+		`INSERT INTO reminders (entry_id, remind_at, note, notified_at, created_at)
+			SELECT ?1, remind_at, note, notified_at, created_at FROM reminders WHERE entry_id = ?2
+			ON CONFLICT DO NOTHING`,
+		"UPDATE shares SET entry_id = ?1 WHERE entry_id = ?2",
+		`INSERT INTO collection_entries (collection, entry_id, position, added_at)
+			SELECT collection, ?1, position, added_at FROM collection_entries WHERE entry_id = ?2
+			ON CONFLICT DO NOTHING`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt, toID, fromID); err != nil {
+			return fmt.Errorf("move merged rows: %w", err)
+		}
+	}
+
+	others := make([]interface{}, 0, len(merging)+1)
+	others = append(others, toID)
+	for _, id := range merging {
+		others = append(others, id)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(others)), ", ")
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO entry_links (from_id, to_id, kind, created_at)
+		SELECT ?, l.to_id, l.kind, l.created_at FROM entry_links l
+		WHERE l.from_id = ? AND l.to_id NOT IN (`+placeholders+`)
+		AND NOT EXISTS (SELECT 1 FROM entry_links r WHERE r.from_id = l.to_id AND r.to_id = ?)
+		ON CONFLICT DO NOTHING
+	`, append(append([]interface{}{toID, fromID}, others...), toID)...); err != nil {
+		return fmt.Errorf("move links: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO entry_links (from_id, to_id, kind, created_at)
+		SELECT l.from_id, ?, l.kind, l.created_at FROM entry_links l
+		WHERE l.to_id = ? AND l.from_id NOT IN (`+placeholders+`)
+		AND NOT EXISTS (SELECT 1 FROM entry_links r WHERE r.from_id = ? AND r.to_id = l.from_id)
+		ON CONFLICT DO NOTHING
+	`, append(append([]interface{}{toID, fromID}, others...), toID)...); err != nil {
+		return fmt.Errorf("move links: %w", err)
+	}
+	return nil
+}
+
+// moveVersions makes the past versions of an entry being merged, and its
+// current content, versions of the target after revision, oldest first.
+// It returns how many were moved.
+func moveVersions(ctx context.Context, tx *sql.Tx, fromID, toID string, revision int) (int, error) {
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO entry_versions (entry_id, revision, content, title, created_at)
+		SELECT ?, ? + ROW_NUMBER() OVER (ORDER BY v.revision), v.content, v.title, v.created_at FROM (
+			SELECT ev.revision, ev.content, ev.title, ev.created_at FROM entry_versions ev
+			JOIN entries e ON e.id = ev.entry_id
+			WHERE ev.entry_id = ? AND ev.revision < e.revision
+			UNION ALL
+			SELECT revision, content, title, COALESCE(updated_at, created_at) FROM entries WHERE id = ?
+		) v
+	`, toID, revision, fromID, fromID)
+	if err != nil {
+		return 0, fmt.Errorf("move merged versions: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("move merged versions: %w", err)
+	}
+	return int(n), nil
+}
+
+// mergedPart is where the content of an entry ends up in merged content:
+// its trimmed text, of length bytes, starts at byte at, after lead bytes
+// of leading space were trimmed
+type mergedPart struct {
+	at, lead, length int
+}
+
+// leadingSpace is how many bytes TrimSpace removes from the start of s
+func leadingSpace(s string) int {
+	return len(s) - len(strings.TrimLeftFunc(s, unicode.IsSpace))
+}
+
+// moveChunks moves the passage embeddings of an entry being merged (or of
+// the target itself) to the target, after those it has, with their
+// offsets moved to where the passages are in the merged content
+func moveChunks(ctx context.Context, tx *sql.Tx, fromID, toID string, part mergedPart) error {
+	rows, err := tx.QueryContext(ctx,
+		"SELECT start_offset, end_offset, vector, model, created_at FROM chunks WHERE entry_id = ? ORDER BY position", fromID,
+	)
+	if err != nil {
+		return fmt.Errorf("list merged chunks: %w", err)
+	}
+	type chunk struct {
+		start, end int
+		vector     []byte
+		model      string
+		createdAt  time.Time
+	}
+	var chunks []chunk
+	for rows.Next() {
+		var c chunk
+		if err := rows.Scan(&c.start, &c.end, &c.vector, &c.model, &c.createdAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan merged chunk: %w", err)
+		}
+		chunks = append(chunks, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("list merged chunks: %w", err)
+	}
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM chunks WHERE entry_id = ?", fromID); err != nil {
+		return fmt.Errorf("move merged chunks: %w", err)
+	}
+	var position int
+	if err := tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(position) + 1, 0) FROM chunks WHERE entry_id = ?", toID).Scan(&position); err != nil {
+		return fmt.Errorf("move merged chunks: %w", err)
+	}
+	offset := func(o int) int {
+		return part.at + min(max(o-part.lead, 0), part.length)
+	}
+	for _, c := range chunks {
+		start, end := offset(c.start), offset(c.end)
+		if end <= start {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO chunks (entry_id, position, start_offset, end_offset, vector, model, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			toID, position, start, end, c.vector, c.model, c.createdAt,
+		); err != nil {
+			return fmt.Errorf("move merged chunks: %w", err)
+		}
+		position++
+	}
+	return nil
+}
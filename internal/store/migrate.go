@@ -0,0 +1,233 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql migrations/postgres/*.sql
+var migrationFiles embed.FS
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+	sql       string
+}
+
+// loadMigrations reads the embedded migration files (NNNN_name.sql) of a
+// directory in version order
+func loadMigrations(dir string) ([]Migration, error) {
+	files, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+
+	var migrations []Migration
+	seen := make(map[int]string)
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		base := strings.TrimSuffix(f.Name(), ".sql")
+		prefix, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("invalid migration file name: %s", f.Name())
+		}
+		if other, dup := seen[version]; dup {
+			return nil, fmt.Errorf("duplicate migration version %d: %s and %s", version, other, f.Name())
+		}
+		seen[version] = f.Name()
+
+		body, err := migrationFiles.ReadFile(path.Join(dir, f.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read migration %s: %w", f.Name(), err)
+		}
+		migrations = append(migrations, Migration{Version: version, Name: name, sql: string(body)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// migrate applies pending migrations, each in its own transaction
+func migrate(db *sql.DB, d dialect) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create migrations table: %w", err)
+	}
+
+	migrations, err := loadMigrations(d.migrations)
+	if err != nil {
+		return err
+	}
+
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		apply := applyMigration
+		if d.name == BackendPostgres {
+			apply = applyPostgresMigration
+		}
+		if err := apply(db, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyMigration applies a migration with foreign keys off, so it can
+// rebuild tables other tables reference, checking them before commit
+func applyMigration(db *sql.DB, m Migration) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("begin migration %d: %w", m.Version, err)
+	}
+	defer conn.Close()
+
+	// The pragma is a no-op inside a transaction
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		return fmt.Errorf("begin migration %d: %w", m.Version, err)
+	}
+	defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin migration %d: %w", m.Version, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(m.sql); err != nil {
+		return fmt.Errorf("apply migration %d_%s: %w", m.Version, m.Name, err)
+	}
+	var table string
+	err = tx.QueryRow("PRAGMA foreign_key_check").Scan(&table, new(interface{}), new(interface{}), new(interface{}))
+	if err == nil {
+		return fmt.Errorf("apply migration %d_%s: foreign key violated in %s", m.Version, m.Name, table)
+	}
+	if err != sql.ErrNoRows {
+		return fmt.Errorf("check migration %d: %w", m.Version, err)
+	}
+	_, err = tx.Exec(
+		"INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+		m.Version, m.Name, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("record migration %d: %w", m.Version, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit migration %d: %w", m.Version, err)
+	}
+	return nil
+}
+
+// applyPostgresMigration applies a migration in a transaction, which
+// Postgres checks foreign keys of itself. Concurrent processes wait for
+// each other, the later one skipping what the first applied.
+func applyPostgresMigration(db *sql.DB, m Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin migration %d: %w", m.Version, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('kb schema_migrations'))"); err != nil {
+		return fmt.Errorf("begin migration %d: %w", m.Version, err)
+	}
+	var done bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = ?)", m.Version).Scan(&done); err != nil {
+		return fmt.Errorf("check migration %d: %w", m.Version, err)
+	}
+	if done {
+		return nil
+	}
+
+	if _, err := tx.Exec(m.sql); err != nil {
+		return fmt.Errorf("apply migration %d_%s: %w", m.Version, m.Name, err)
+	}
+	_, err = tx.Exec(
+		"INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+		m.Version, m.Name, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("record migration %d: %w", m.Version, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit migration %d: %w", m.Version, err)
+	}
+	return nil
+}
+
+func appliedMigrations(db *sql.DB) (map[int]time.Time, error) {
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("read applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, fmt.Errorf("scan migration: %w", err)
+		}
+		applied[version] = at
+	}
+	return applied, nil
+}
+
+// MigrationStatus returns every known migration with its applied time (nil if pending)
+func (s *Store) MigrationStatus(ctx context.Context) ([]Migration, error) {
+	migrations, err := loadMigrations(s.dialect.migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := appliedMigrations(s.db.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range migrations {
+		if at, ok := applied[migrations[i].Version]; ok {
+			migrations[i].AppliedAt = &at
+		}
+	}
+	return migrations, nil
+}
+
+// SchemaVersion returns the highest applied migration version
+func (s *Store) SchemaVersion(ctx context.Context) (int, error) {
+	var version sql.NullInt64
+	if err := s.db.QueryRowContext(ctx, "SELECT MAX(version) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, fmt.Errorf("schema version: %w", err)
+	}
+	return int(version.Int64), nil
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMigrationFiles(t *testing.T) {
+	last := map[string]int{}
+	for _, d := range []dialect{sqliteDialect, postgresDialect} {
+		migrations, err := loadMigrations(d.migrations)
+		if err != nil {
+			t.Fatalf("%s migrations: %v", d.name, err)
+		}
+		for i := 1; i < len(migrations); i++ {
+			if migrations[i].Version <= migrations[i-1].Version {
+				t.Errorf("%s migration %d follows %d", d.name, migrations[i].Version, migrations[i-1].Version)
+			}
+		}
+		last[d.name] = migrations[len(migrations)-1].Version
+	}
+	// Both schemas move in step
+	if last[BackendSQLite] != last[BackendPostgres] {
+		t.Errorf("latest migrations: sqlite %d, postgres %d, want the same", last[BackendSQLite], last[BackendPostgres])
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kb.db")
+	s, err := Open(path, StoreOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	migrations, err := s.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range migrations {
+		if m.AppliedAt == nil {
+			t.Errorf("migration %d_%s pending on a new database", m.Version, m.Name)
+		}
+	}
+	version, err := s.SchemaVersion(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest := migrations[len(migrations)-1].Version; version != latest {
+		t.Errorf("SchemaVersion = %d, want %d", version, latest)
+	}
+	s.Close()
+
+	// Opening the database again applies nothing again
+	s, err = Open(path, StoreOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	again, err := s.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range again {
+		if m.AppliedAt == nil || !m.AppliedAt.Equal(*migrations[i].AppliedAt) {
+			t.Errorf("migration %d applied at %v, then %v", m.Version, migrations[i].AppliedAt, m.AppliedAt)
+		}
+	}
+}
+
+// TestMigrateUpgrade upgrades a database left at an older schema, with
+// entries in it
+func TestMigrateUpgrade(t *testing.T) {
+	const oldVersion = 20
+	path := filepath.Join(t.TempDir(), "kb.db")
+	db, err := sql.Open("sqlite3", StoreOptions{}.dsn(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY, name TEXT NOT NULL, applied_at TIMESTAMP NOT NULL)"); err != nil {
+		t.Fatal(err)
+	}
+	migrations, err := loadMigrations(sqliteDialect.migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range migrations {
+		if m.Version > oldVersion {
+			break
+		}
+		if err := applyMigration(db, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec("INSERT INTO entries (id, content, created_at) VALUES ('old', 'written before the upgrade', ?)", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	s, err := Open(path, StoreOptions{})
+	if err != nil {
+		t.Fatalf("upgrade from version %d: %v", oldVersion, err)
+	}
+	defer s.Close()
+	ctx := context.Background()
+	if version, err := s.SchemaVersion(ctx); err != nil || version != migrations[len(migrations)-1].Version {
+		t.Errorf("SchemaVersion after upgrade = %d, %v", version, err)
+	}
+	entry, err := s.GetEntry(ctx, "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Content != "written before the upgrade" || entry.Revision != 1 {
+		t.Errorf("upgraded entry = %q at revision %d", entry.Content, entry.Revision)
+	}
+	// It syncs like entries written since
+	changes, _, _, err := s.SyncChanges(ctx, 0, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].ID != "old" {
+		t.Errorf("sync changes after upgrade = %+v, want the old entry", changes)
+	}
+}
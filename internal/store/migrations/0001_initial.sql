@@ -0,0 +1,91 @@
+-- Initial schema (tables may predate versioned migrations, hence IF NOT EXISTS)
+
+-- Entries: the captured content
+CREATE TABLE IF NOT EXISTS entries (
+    id TEXT PRIMARY KEY,
+    content TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_viewed_at TIMESTAMP
+);
+
+-- Tags: emergent from classification
+CREATE TABLE IF NOT EXISTS tags (
+    id TEXT PRIMARY KEY,
+    name TEXT UNIQUE NOT NULL,
+    parent_id TEXT REFERENCES tags(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Entry-Tag relations (many-to-many)
+CREATE TABLE IF NOT EXISTS entry_tags (
+    entry_id TEXT REFERENCES entries(id) ON DELETE CASCADE,
+    tag_id TEXT REFERENCES tags(id) ON DELETE CASCADE,
+    confidence REAL DEFAULT 1.0,
+    PRIMARY KEY (entry_id, tag_id)
+);
+
+-- Index for faster tag lookups
+CREATE INDEX IF NOT EXISTS idx_entry_tags_entry ON entry_tags(entry_id);
+CREATE INDEX IF NOT EXISTS idx_entry_tags_tag ON entry_tags(tag_id);
+CREATE INDEX IF NOT EXISTS idx_tags_parent ON tags(parent_id);
+
+-- Embeddings for similarity search
+CREATE TABLE IF NOT EXISTS embeddings (
+    entry_id TEXT PRIMARY KEY REFERENCES entries(id) ON DELETE CASCADE,
+    vector BLOB NOT NULL,
+    model TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Scheduled job state
+CREATE TABLE IF NOT EXISTS jobs (
+    name TEXT PRIMARY KEY,
+    last_run_at TIMESTAMP,
+    last_error TEXT
+);
+
+-- Advisory leases coordinating daemons sharing this database
+CREATE TABLE IF NOT EXISTS leases (
+    name TEXT PRIMARY KEY,
+    owner TEXT NOT NULL,
+    acquired_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+-- Spaced repetition state (SM-2) per entry
+CREATE TABLE IF NOT EXISTS reviews (
+    entry_id TEXT PRIMARY KEY REFERENCES entries(id) ON DELETE CASCADE,
+    ease REAL NOT NULL DEFAULT 2.5,
+    interval_days INTEGER NOT NULL DEFAULT 0,
+    repetitions INTEGER NOT NULL DEFAULT 0,
+    next_due TIMESTAMP NOT NULL,
+    last_reviewed_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_reviews_next_due ON reviews(next_due);
+
+-- Review history, one row per graded review
+CREATE TABLE IF NOT EXISTS review_log (
+    entry_id TEXT REFERENCES entries(id) ON DELETE CASCADE,
+    grade INTEGER NOT NULL,
+    reviewed_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_review_log_reviewed_at ON review_log(reviewed_at);
+
+-- External API usage (tokens per call) for cost reporting
+CREATE TABLE IF NOT EXISTS api_usage (
+    service TEXT NOT NULL,
+    model TEXT NOT NULL,
+    input_tokens INTEGER NOT NULL DEFAULT 0,
+    output_tokens INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_usage_created_at ON api_usage(created_at);
+
+-- Key/value settings
+CREATE TABLE IF NOT EXISTS settings (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+);
@@ -0,0 +1,13 @@
+-- Files attached to entries; content lives in the blob store, keyed by SHA-256
+CREATE TABLE attachments (
+    id TEXT PRIMARY KEY,
+    entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    sha256 TEXT NOT NULL,
+    filename TEXT NOT NULL,
+    mime_type TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_attachments_entry ON attachments(entry_id);
+CREATE INDEX idx_attachments_sha256 ON attachments(sha256);
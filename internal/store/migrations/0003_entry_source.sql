@@ -0,0 +1,16 @@
+-- Structured source metadata, so entries can be listed by title
+ALTER TABLE entries ADD COLUMN source_type TEXT NOT NULL DEFAULT 'note';
+ALTER TABLE entries ADD COLUMN source_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE entries ADD COLUMN title TEXT NOT NULL DEFAULT '';
+ALTER TABLE entries ADD COLUMN author TEXT NOT NULL DEFAULT '';
+ALTER TABLE entries ADD COLUMN fetched_at TIMESTAMP;
+
+-- Entries fetched from URLs used to start with "[Source: <url>]"; move the
+-- URL into its column and drop the prefix
+UPDATE entries
+SET source_type = 'url',
+    source_url = substr(content, 10, instr(content, ']') - 10),
+    content = ltrim(substr(content, instr(content, ']') + 1), char(10))
+WHERE content LIKE '[Source: %]%';
+
+CREATE INDEX idx_entries_source_url ON entries(source_url) WHERE source_url != '';
@@ -0,0 +1,11 @@
+-- Every place a URL entry was seen (feeds, newsletters, manual adds), so
+-- links to the same article collapse into one entry
+CREATE TABLE source_occurrences (
+    id TEXT PRIMARY KEY,
+    entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    via TEXT NOT NULL,
+    url TEXT NOT NULL,
+    seen_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_source_occurrences_entry ON source_occurrences(entry_id);
@@ -0,0 +1,18 @@
+-- Automation rules: when an entry matches a condition, run actions
+CREATE TABLE rules (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    condition TEXT NOT NULL,
+    actions TEXT NOT NULL, -- one action per line
+    enabled INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP NOT NULL
+);
+
+-- Each rule fires at most once per entry, so re-running rules (e.g. after
+-- reclassification) doesn't repeat webhooks or reminders
+CREATE TABLE rule_firings (
+    rule_id TEXT NOT NULL REFERENCES rules(id) ON DELETE CASCADE,
+    entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    fired_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (rule_id, entry_id)
+);
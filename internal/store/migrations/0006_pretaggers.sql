@@ -0,0 +1,9 @@
+-- Deterministic regex/keyword taggers applied before the LLM classifier
+CREATE TABLE pretaggers (
+    id TEXT PRIMARY KEY,
+    pattern TEXT NOT NULL,
+    tag TEXT NOT NULL,
+    parent TEXT NOT NULL DEFAULT '',
+    skip_llm INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,23 @@
+-- Who assigned a tag: the classifier (and pre-taggers/rules) or a human
+ALTER TABLE entry_tags ADD COLUMN origin TEXT NOT NULL DEFAULT 'auto';
+
+-- Human corrections of tag assignments
+CREATE TABLE tag_feedback (
+    entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    tag_id TEXT NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    verdict TEXT NOT NULL, -- 'removed' (auto tag rejected) or 'added' (tag missed)
+    confidence REAL, -- confidence of the rejected assignment
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_tag_feedback_tag ON tag_feedback(tag_id);
+
+-- Per-tag precision of automatic assignments, recomputed periodically
+CREATE TABLE tag_calibration (
+    tag_id TEXT PRIMARY KEY REFERENCES tags(id) ON DELETE CASCADE,
+    kept INTEGER NOT NULL,
+    removed INTEGER NOT NULL,
+    added INTEGER NOT NULL,
+    precision REAL NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
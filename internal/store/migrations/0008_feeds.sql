@@ -0,0 +1,19 @@
+-- RSS/Atom feed subscriptions, polled periodically
+CREATE TABLE feeds (
+    id TEXT PRIMARY KEY,
+    url TEXT NOT NULL UNIQUE,
+    title TEXT NOT NULL DEFAULT '',
+    last_polled_at TIMESTAMP,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL
+);
+
+-- Items already seen in each feed, by GUID, so polls only ingest new ones.
+-- entry_id is NULL for items skipped when subscribing.
+CREATE TABLE feed_items (
+    feed_id TEXT NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+    guid TEXT NOT NULL,
+    entry_id TEXT REFERENCES entries(id) ON DELETE SET NULL,
+    seen_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (feed_id, guid)
+);
@@ -0,0 +1,4 @@
+-- Entry revisions for conflict-safe editing: an update must name the
+-- revision it was based on
+ALTER TABLE entries ADD COLUMN revision INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE entries ADD COLUMN updated_at TIMESTAMP;
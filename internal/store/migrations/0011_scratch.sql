@@ -0,0 +1,4 @@
+-- Scratch entries expire unless kept; NULL for permanent entries
+ALTER TABLE entries ADD COLUMN expires_at TIMESTAMP;
+
+CREATE INDEX idx_entries_expires_at ON entries(expires_at) WHERE expires_at IS NOT NULL;
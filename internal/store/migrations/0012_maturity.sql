@@ -0,0 +1,17 @@
+-- Notes mature from fleeting to literature to evergreen as they are refined
+ALTER TABLE entries ADD COLUMN maturity TEXT NOT NULL DEFAULT 'fleeting';
+
+-- Captured sources are notes about something read
+UPDATE entries SET maturity = 'literature' WHERE source_type IN ('url', 'file', 'clip');
+
+CREATE INDEX idx_entries_maturity ON entries(maturity);
+
+-- Every maturity change, for promotion stats
+CREATE TABLE maturity_log (
+    entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    from_maturity TEXT NOT NULL,
+    to_maturity TEXT NOT NULL,
+    changed_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_maturity_log_changed_at ON maturity_log(changed_at);
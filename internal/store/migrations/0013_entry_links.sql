@@ -0,0 +1,9 @@
+-- Links between related entries; a link is shown from both ends
+CREATE TABLE entry_links (
+    from_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    to_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (from_id, to_id)
+);
+
+CREATE INDEX idx_entry_links_to ON entry_links(to_id);
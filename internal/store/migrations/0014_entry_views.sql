@@ -0,0 +1,12 @@
+-- Every time an entry is shown, for per-tag attention analytics
+CREATE TABLE entry_views (
+    entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    viewed_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_entry_views_entry ON entry_views(entry_id);
+CREATE INDEX idx_entry_views_viewed_at ON entry_views(viewed_at);
+
+-- The last view is all that was known before
+INSERT INTO entry_views (entry_id, viewed_at)
+SELECT id, last_viewed_at FROM entries WHERE last_viewed_at IS NOT NULL;
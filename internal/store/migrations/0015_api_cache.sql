@@ -0,0 +1,12 @@
+-- Classification and embedding results by content hash, reused when the
+-- same content is processed again
+CREATE TABLE api_cache (
+    kind TEXT NOT NULL,
+    model TEXT NOT NULL,
+    content_hash TEXT NOT NULL,
+    value BLOB NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    hits INTEGER NOT NULL DEFAULT 0,
+    last_hit_at TIMESTAMP,
+    PRIMARY KEY (kind, model, content_hash)
+);
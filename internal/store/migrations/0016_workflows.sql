@@ -0,0 +1,30 @@
+-- User-defined pipelines of states, e.g. idea → drafted → published.
+-- states and transitions are JSON.
+CREATE TABLE workflows (
+    name TEXT PRIMARY KEY,
+    states TEXT NOT NULL,
+    transitions TEXT,
+    created_at TIMESTAMP NOT NULL
+);
+
+-- Each entry's current state in the workflows it was started in
+CREATE TABLE entry_workflows (
+    entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    workflow TEXT NOT NULL REFERENCES workflows(name) ON DELETE CASCADE,
+    state TEXT NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (entry_id, workflow)
+);
+
+CREATE INDEX idx_entry_workflows_state ON entry_workflows(workflow, state);
+
+-- Every state change, like maturity_log
+CREATE TABLE workflow_log (
+    entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    workflow TEXT NOT NULL REFERENCES workflows(name) ON DELETE CASCADE,
+    from_state TEXT,
+    to_state TEXT NOT NULL,
+    changed_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_workflow_log_changed_at ON workflow_log(changed_at);
@@ -0,0 +1,14 @@
+-- Entries merged into another one. The merged entry is deleted; its
+-- creation time and URL are kept here, so the history survives and the
+-- URL still finds the entry it went into.
+CREATE TABLE entry_merges (
+    entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    merged_id TEXT NOT NULL,
+    title TEXT,
+    source_url TEXT,
+    created_at TIMESTAMP NOT NULL,
+    merged_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_entry_merges_entry ON entry_merges(entry_id);
+CREATE INDEX idx_entry_merges_url ON entry_merges(source_url);
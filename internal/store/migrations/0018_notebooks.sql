@@ -0,0 +1,17 @@
+-- Notebooks group entries and nest. A notebook with a key (the salt for
+-- deriving it from a passphrase, and a check value to verify the
+-- passphrase) stores its entries' content encrypted, as do its
+-- sub-notebooks without a key of their own.
+CREATE TABLE notebooks (
+    name TEXT PRIMARY KEY,
+    parent TEXT REFERENCES notebooks(name),
+    key_salt BLOB,
+    key_check BLOB,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_notebooks_parent ON notebooks(parent);
+
+ALTER TABLE entries ADD COLUMN notebook TEXT REFERENCES notebooks(name);
+
+CREATE INDEX idx_entries_notebook ON entries(notebook);
@@ -0,0 +1,6 @@
+-- Archived entries are kept but left out of lists and searches; deleted
+-- entries wait in the trash until purged
+ALTER TABLE entries ADD COLUMN archived_at TIMESTAMP;
+ALTER TABLE entries ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE INDEX idx_entries_deleted_at ON entries(deleted_at);
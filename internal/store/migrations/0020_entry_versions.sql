@@ -0,0 +1,11 @@
+-- Past versions of entries: the content and title an entry had at each
+-- revision, saved when an edit replaces them. The current version stays
+-- in entries.
+CREATE TABLE entry_versions (
+    entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    title TEXT,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (entry_id, revision)
+);
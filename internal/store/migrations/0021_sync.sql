@@ -0,0 +1,72 @@
+-- Sync: one row per entry, bumped to the next seq whenever the entry, its
+-- tags or its links change, and kept as a tombstone when the entry is
+-- purged. changed_at orders concurrent changes (last writer wins);
+-- origin is the peer a change was received from, NULL for local changes.
+CREATE TABLE sync_changes (
+    entry_id TEXT PRIMARY KEY,
+    seq INTEGER NOT NULL,
+    changed_at TIMESTAMP NOT NULL,
+    deleted INTEGER NOT NULL DEFAULT 0,
+    origin TEXT
+);
+
+CREATE UNIQUE INDEX idx_sync_changes_seq ON sync_changes(seq);
+
+INSERT INTO sync_changes (entry_id, seq, changed_at)
+SELECT id, ROW_NUMBER() OVER (ORDER BY COALESCE(updated_at, created_at), id), COALESCE(updated_at, created_at)
+FROM entries;
+
+CREATE TRIGGER sync_entry_insert AFTER INSERT ON entries BEGIN
+    INSERT OR REPLACE INTO sync_changes (entry_id, seq, changed_at)
+    VALUES (NEW.id, (SELECT COALESCE(MAX(seq), 0) + 1 FROM sync_changes), strftime('%Y-%m-%d %H:%M:%f', 'now'));
+END;
+
+-- Views (last_viewed_at) and revision bookkeeping aren't synced
+CREATE TRIGGER sync_entry_update AFTER UPDATE OF content, title, source_type, source_url, author, fetched_at,
+    expires_at, maturity, notebook, archived_at, deleted_at ON entries BEGIN
+    INSERT OR REPLACE INTO sync_changes (entry_id, seq, changed_at)
+    VALUES (NEW.id, (SELECT COALESCE(MAX(seq), 0) + 1 FROM sync_changes), strftime('%Y-%m-%d %H:%M:%f', 'now'));
+END;
+
+CREATE TRIGGER sync_entry_delete AFTER DELETE ON entries BEGIN
+    INSERT OR REPLACE INTO sync_changes (entry_id, seq, changed_at, deleted)
+    VALUES (OLD.id, (SELECT COALESCE(MAX(seq), 0) + 1 FROM sync_changes), strftime('%Y-%m-%d %H:%M:%f', 'now'), 1);
+END;
+
+CREATE TRIGGER sync_tag_insert AFTER INSERT ON entry_tags BEGIN
+    INSERT OR REPLACE INTO sync_changes (entry_id, seq, changed_at)
+    VALUES (NEW.entry_id, (SELECT COALESCE(MAX(seq), 0) + 1 FROM sync_changes), strftime('%Y-%m-%d %H:%M:%f', 'now'));
+END;
+
+CREATE TRIGGER sync_tag_delete AFTER DELETE ON entry_tags
+WHEN EXISTS (SELECT 1 FROM entries WHERE id = OLD.entry_id) BEGIN
+    INSERT OR REPLACE INTO sync_changes (entry_id, seq, changed_at)
+    VALUES (OLD.entry_id, (SELECT COALESCE(MAX(seq), 0) + 1 FROM sync_changes), strftime('%Y-%m-%d %H:%M:%f', 'now'));
+END;
+
+CREATE TRIGGER sync_link_insert AFTER INSERT ON entry_links BEGIN
+    INSERT OR REPLACE INTO sync_changes (entry_id, seq, changed_at)
+    VALUES (NEW.from_id, (SELECT COALESCE(MAX(seq), 0) + 1 FROM sync_changes), strftime('%Y-%m-%d %H:%M:%f', 'now'));
+END;
+
+CREATE TRIGGER sync_link_delete AFTER DELETE ON entry_links
+WHEN EXISTS (SELECT 1 FROM entries WHERE id = OLD.from_id) BEGIN
+    INSERT OR REPLACE INTO sync_changes (entry_id, seq, changed_at)
+    VALUES (OLD.from_id, (SELECT COALESCE(MAX(seq), 0) + 1 FROM sync_changes), strftime('%Y-%m-%d %H:%M:%f', 'now'));
+END;
+
+-- Concurrent changes resolved by sync: the version that lost is kept
+CREATE TABLE sync_conflicts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    entry_id TEXT NOT NULL,
+    peer TEXT NOT NULL,
+    kept TEXT NOT NULL,
+    kept_changed_at TIMESTAMP NOT NULL,
+    lost_changed_at TIMESTAMP NOT NULL,
+    lost_deleted INTEGER NOT NULL DEFAULT 0,
+    lost_title TEXT NOT NULL DEFAULT '',
+    lost_content TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_sync_conflicts_created_at ON sync_conflicts(created_at);
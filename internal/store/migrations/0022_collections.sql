@@ -0,0 +1,17 @@
+-- Curated, ordered lists of entries, e.g. reading lists or course outlines,
+-- ordered by position
+CREATE TABLE collections (
+    name TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE collection_entries (
+    collection TEXT NOT NULL REFERENCES collections(name) ON DELETE CASCADE,
+    entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    added_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (collection, entry_id)
+);
+
+CREATE INDEX idx_collection_entries_entry ON collection_entries(entry_id);
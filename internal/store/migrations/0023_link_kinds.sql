@@ -0,0 +1,3 @@
+-- What a link says about the entries it joins: relates (the default),
+-- contradicts or expands, read from from_id to to_id
+ALTER TABLE entry_links ADD COLUMN kind TEXT NOT NULL DEFAULT 'relates';
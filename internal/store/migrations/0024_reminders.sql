@@ -0,0 +1,11 @@
+-- Follow-ups on entries: one reminder per entry, due at remind_at.
+-- notified_at is set once kb serve has sent its notification.
+CREATE TABLE reminders (
+    entry_id TEXT PRIMARY KEY REFERENCES entries(id) ON DELETE CASCADE,
+    remind_at TIMESTAMP NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    notified_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_reminders_remind_at ON reminders(remind_at);
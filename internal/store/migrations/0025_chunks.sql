@@ -0,0 +1,13 @@
+-- Embeddings of the passages of long entries, so semantic search can match
+-- a passage a whole-entry embedding dilutes. Passages are byte offsets into
+-- the entry content, which may be encrypted.
+CREATE TABLE chunks (
+    entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    start_offset INTEGER NOT NULL,
+    end_offset INTEGER NOT NULL,
+    vector BLOB NOT NULL,
+    model TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (entry_id, position)
+);
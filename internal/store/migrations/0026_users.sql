@@ -0,0 +1,35 @@
+-- Users of a shared server. Entries and tags with a user belong to that
+-- user alone; those without one belong to the database owner, as do API
+-- tokens without a user.
+CREATE TABLE users (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    admin BOOLEAN NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    disabled_at TIMESTAMP
+);
+
+ALTER TABLE api_tokens ADD COLUMN user_id TEXT REFERENCES users(id);
+
+ALTER TABLE entries ADD COLUMN user_id TEXT REFERENCES users(id);
+
+CREATE INDEX idx_entries_user ON entries(user_id);
+
+-- Tag names are unique per user: tags is rebuilt without its UNIQUE (name)
+CREATE TABLE tags_new (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    parent_id TEXT REFERENCES tags(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    user_id TEXT REFERENCES users(id)
+);
+
+INSERT INTO tags_new (id, name, parent_id, created_at)
+SELECT id, name, parent_id, created_at FROM tags;
+
+DROP TABLE tags;
+
+ALTER TABLE tags_new RENAME TO tags;
+
+CREATE UNIQUE INDEX idx_tags_user_name ON tags(COALESCE(user_id, ''), name);
+CREATE INDEX idx_tags_parent ON tags(parent_id);
@@ -0,0 +1,15 @@
+-- Read-only public links to an entry, or to the entries of a tag, served
+-- by kb serve at /s/<token>. The token is the share ID signed with the
+-- share.key setting; deleting a share revokes its link.
+CREATE TABLE shares (
+    id TEXT PRIMARY KEY,
+    entry_id TEXT REFERENCES entries(id) ON DELETE CASCADE,
+    tag_id TEXT REFERENCES tags(id) ON DELETE CASCADE,
+    user_id TEXT REFERENCES users(id),
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP,
+    CHECK ((entry_id IS NULL) != (tag_id IS NULL))
+);
+
+CREATE INDEX idx_shares_entry ON shares(entry_id);
+CREATE INDEX idx_shares_tag ON shares(tag_id);
@@ -0,0 +1,3 @@
+-- The vector index picks up the embeddings saved since it was last synced
+CREATE INDEX idx_embeddings_created ON embeddings(created_at);
+CREATE INDEX idx_chunks_created ON chunks(created_at);
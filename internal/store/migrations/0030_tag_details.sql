@@ -0,0 +1,4 @@
+-- What a tag is for, shown to the classifier so it picks tags by meaning
+-- rather than name alone, and a color for interfaces to show it in
+ALTER TABLE tags ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE tags ADD COLUMN color TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,57 @@
+-- Tags and links between entries sync as records of their own, so that
+-- renaming, moving or deleting a tag, and linking entries, propagate
+-- without rewriting the entries concerned. entry_id is the ID of the
+-- record changed: the entry's, the tag's, or from_id/to_id for a link.
+-- The owner's tags are synced, not those of users.
+ALTER TABLE sync_changes ADD COLUMN kind TEXT NOT NULL DEFAULT 'entry';
+
+DROP TRIGGER sync_link_insert;
+DROP TRIGGER sync_link_delete;
+
+-- How sure the classifier was of an entry's tags is part of the entry
+CREATE TRIGGER sync_tag_update AFTER UPDATE OF confidence, origin ON entry_tags BEGIN
+    INSERT OR REPLACE INTO sync_changes (entry_id, seq, changed_at)
+    VALUES (NEW.entry_id, (SELECT COALESCE(MAX(seq), 0) + 1 FROM sync_changes), strftime('%Y-%m-%d %H:%M:%f', 'now'));
+END;
+
+CREATE TRIGGER sync_tag_record_insert AFTER INSERT ON tags WHEN NEW.user_id IS NULL BEGIN
+    INSERT OR REPLACE INTO sync_changes (entry_id, kind, seq, changed_at)
+    VALUES (NEW.id, 'tag', (SELECT COALESCE(MAX(seq), 0) + 1 FROM sync_changes), strftime('%Y-%m-%d %H:%M:%f', 'now'));
+END;
+
+CREATE TRIGGER sync_tag_record_update AFTER UPDATE OF name, parent_id, description, color ON tags
+WHEN NEW.user_id IS NULL BEGIN
+    INSERT OR REPLACE INTO sync_changes (entry_id, kind, seq, changed_at)
+    VALUES (NEW.id, 'tag', (SELECT COALESCE(MAX(seq), 0) + 1 FROM sync_changes), strftime('%Y-%m-%d %H:%M:%f', 'now'));
+END;
+
+CREATE TRIGGER sync_tag_record_delete AFTER DELETE ON tags WHEN OLD.user_id IS NULL BEGIN
+    INSERT OR REPLACE INTO sync_changes (entry_id, kind, seq, changed_at, deleted)
+    VALUES (OLD.id, 'tag', (SELECT COALESCE(MAX(seq), 0) + 1 FROM sync_changes), strftime('%Y-%m-%d %H:%M:%f', 'now'), 1);
+END;
+
+CREATE TRIGGER sync_link_insert AFTER INSERT ON entry_links BEGIN
+    INSERT OR REPLACE INTO sync_changes (entry_id, kind, seq, changed_at)
+    VALUES (NEW.from_id || '/' || NEW.to_id, 'link', (SELECT COALESCE(MAX(seq), 0) + 1 FROM sync_changes), strftime('%Y-%m-%d %H:%M:%f', 'now'));
+END;
+
+CREATE TRIGGER sync_link_update AFTER UPDATE OF kind ON entry_links BEGIN
+    INSERT OR REPLACE INTO sync_changes (entry_id, kind, seq, changed_at)
+    VALUES (NEW.from_id || '/' || NEW.to_id, 'link', (SELECT COALESCE(MAX(seq), 0) + 1 FROM sync_changes), strftime('%Y-%m-%d %H:%M:%f', 'now'));
+END;
+
+-- Links going with a purged entry go with its tombstone
+CREATE TRIGGER sync_link_delete AFTER DELETE ON entry_links
+WHEN EXISTS (SELECT 1 FROM entries WHERE id = OLD.from_id) AND EXISTS (SELECT 1 FROM entries WHERE id = OLD.to_id) BEGIN
+    INSERT OR REPLACE INTO sync_changes (entry_id, kind, seq, changed_at, deleted)
+    VALUES (OLD.from_id || '/' || OLD.to_id, 'link', (SELECT COALESCE(MAX(seq), 0) + 1 FROM sync_changes), strftime('%Y-%m-%d %H:%M:%f', 'now'), 1);
+END;
+
+INSERT INTO sync_changes (entry_id, kind, seq, changed_at)
+SELECT t.id, 'tag', last.seq + ROW_NUMBER() OVER (ORDER BY t.created_at, t.id), t.created_at
+FROM tags t, (SELECT COALESCE(MAX(seq), 0) AS seq FROM sync_changes) last
+WHERE t.user_id IS NULL;
+
+INSERT INTO sync_changes (entry_id, kind, seq, changed_at)
+SELECT l.from_id || '/' || l.to_id, 'link', last.seq + ROW_NUMBER() OVER (ORDER BY l.created_at, l.from_id, l.to_id), l.created_at
+FROM entry_links l, (SELECT COALESCE(MAX(seq), 0) AS seq FROM sync_changes) last;
@@ -0,0 +1,18 @@
+-- source_url keeps the URL as captured; canonical_url is its normalized
+-- form (see fetcher.CanonicalURL), which finds the entry again from
+-- another link to the same page. URLs stored so far were canonical
+-- already, save for the http to https rule added since.
+ALTER TABLE entries ADD COLUMN canonical_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE entry_merges ADD COLUMN canonical_url TEXT;
+
+UPDATE entries SET canonical_url = CASE
+    WHEN source_url LIKE 'http://%' THEN 'https://' || substr(source_url, 8)
+    ELSE source_url
+END;
+UPDATE entry_merges SET canonical_url = CASE
+    WHEN source_url LIKE 'http://%' THEN 'https://' || substr(source_url, 8)
+    ELSE source_url
+END;
+
+CREATE INDEX idx_entries_canonical_url ON entries(canonical_url) WHERE canonical_url != '';
+CREATE INDEX idx_entry_merges_canonical_url ON entry_merges(canonical_url);
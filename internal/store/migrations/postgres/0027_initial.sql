@@ -0,0 +1,448 @@
+-- The Postgres schema, as the SQLite migrations up to 0027 leave it. From
+-- here on, every migration needs a Postgres version in this directory,
+-- with the same number, as well as its SQLite one.
+--
+-- Timestamps are TIMESTAMPTZ and flags BOOLEAN. Entries get a tsvector of
+-- their title and content for full-text search. The SQLite functions the
+-- store queries use (julianday, strftime, instr) are defined at the end.
+
+CREATE TABLE users (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    admin BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL,
+    disabled_at TIMESTAMPTZ
+);
+
+CREATE TABLE notebooks (
+    name TEXT PRIMARY KEY,
+    parent TEXT REFERENCES notebooks(name),
+    key_salt BYTEA,
+    key_check BYTEA,
+    created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX idx_notebooks_parent ON notebooks(parent);
+
+CREATE TABLE entries (
+    id TEXT PRIMARY KEY,
+    content TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    last_viewed_at TIMESTAMPTZ,
+    source_type TEXT NOT NULL DEFAULT 'note',
+    source_url TEXT NOT NULL DEFAULT '',
+    title TEXT NOT NULL DEFAULT '',
+    author TEXT NOT NULL DEFAULT '',
+    fetched_at TIMESTAMPTZ,
+    revision INTEGER NOT NULL DEFAULT 1,
+    updated_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ,
+    maturity TEXT NOT NULL DEFAULT 'fleeting',
+    notebook TEXT REFERENCES notebooks(name),
+    archived_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    user_id TEXT REFERENCES users(id),
+    search TSVECTOR GENERATED ALWAYS AS (to_tsvector('simple', title || ' ' || content)) STORED
+);
+CREATE INDEX idx_entries_source_url ON entries(source_url) WHERE source_url != '';
+CREATE INDEX idx_entries_expires_at ON entries(expires_at) WHERE expires_at IS NOT NULL;
+CREATE INDEX idx_entries_maturity ON entries(maturity);
+CREATE INDEX idx_entries_notebook ON entries(notebook);
+CREATE INDEX idx_entries_deleted_at ON entries(deleted_at);
+CREATE INDEX idx_entries_user ON entries(user_id);
+CREATE INDEX idx_entries_search ON entries USING GIN (search);
+
+CREATE TABLE tags (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    parent_id TEXT REFERENCES tags(id),
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    user_id TEXT REFERENCES users(id)
+);
+CREATE UNIQUE INDEX idx_tags_user_name ON tags(COALESCE(user_id, ''), name);
+CREATE INDEX idx_tags_parent ON tags(parent_id);
+
+CREATE TABLE entry_tags (
+    entry_id TEXT REFERENCES entries(id) ON DELETE CASCADE,
+    tag_id TEXT REFERENCES tags(id) ON DELETE CASCADE,
+    confidence DOUBLE PRECISION DEFAULT 1.0,
+    origin TEXT NOT NULL DEFAULT 'auto',
+    PRIMARY KEY (entry_id, tag_id)
+);
+CREATE INDEX idx_entry_tags_entry ON entry_tags(entry_id);
+CREATE INDEX idx_entry_tags_tag ON entry_tags(tag_id);
+
+CREATE TABLE embeddings (
+    entry_id TEXT PRIMARY KEY REFERENCES entries(id) ON DELETE CASCADE,
+    vector BYTEA NOT NULL,
+    model TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE chunks (
+    entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    start_offset INTEGER NOT NULL,
+    end_offset INTEGER NOT NULL,
+    vector BYTEA NOT NULL,
+    model TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (entry_id, position)
+);
+
+CREATE TABLE jobs (
+    name TEXT PRIMARY KEY,
+    last_run_at TIMESTAMPTZ,
+    last_error TEXT
+);
+
+CREATE TABLE leases (
+    name TEXT PRIMARY KEY,
+    owner TEXT NOT NULL,
+    acquired_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE reviews (
+    entry_id TEXT PRIMARY KEY REFERENCES entries(id) ON DELETE CASCADE,
+    ease DOUBLE PRECISION NOT NULL DEFAULT 2.5,
+    interval_days INTEGER NOT NULL DEFAULT 0,
+    repetitions INTEGER NOT NULL DEFAULT 0,
+    next_due TIMESTAMPTZ NOT NULL,
+    last_reviewed_at TIMESTAMPTZ
+);
+CREATE INDEX idx_reviews_next_due ON reviews(next_due);
+
+CREATE TABLE review_log (
+    entry_id TEXT REFERENCES entries(id) ON DELETE CASCADE,
+    grade INTEGER NOT NULL,
+    reviewed_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX idx_review_log_reviewed_at ON review_log(reviewed_at);
+
+CREATE TABLE api_usage (
+    service TEXT NOT NULL,
+    model TEXT NOT NULL,
+    input_tokens BIGINT NOT NULL DEFAULT 0,
+    output_tokens BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX idx_api_usage_created_at ON api_usage(created_at);
+
+CREATE TABLE settings (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+);
+
+CREATE TABLE attachments (
+    id TEXT PRIMARY KEY,
+    entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    sha256 TEXT NOT NULL,
+    filename TEXT NOT NULL,
+    mime_type TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX idx_attachments_entry ON attachments(entry_id);
+CREATE INDEX idx_attachments_sha256 ON attachments(sha256);
+
+CREATE TABLE source_occurrences (
+    id TEXT PRIMARY KEY,
+    entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    via TEXT NOT NULL,
+    url TEXT NOT NULL,
+    seen_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX idx_source_occurrences_entry ON source_occurrences(entry_id);
+
+CREATE TABLE rules (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    condition TEXT NOT NULL,
+    actions TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE rule_firings (
+    rule_id TEXT NOT NULL REFERENCES rules(id) ON DELETE CASCADE,
+    entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    fired_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (rule_id, entry_id)
+);
+
+CREATE TABLE pretaggers (
+    id TEXT PRIMARY KEY,
+    pattern TEXT NOT NULL,
+    tag TEXT NOT NULL,
+    parent TEXT NOT NULL DEFAULT '',
+    skip_llm BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE tag_feedback (
+    entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    tag_id TEXT NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    verdict TEXT NOT NULL,
+    confidence DOUBLE PRECISION,
+    created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX idx_tag_feedback_tag ON tag_feedback(tag_id);
+
+CREATE TABLE tag_calibration (
+    tag_id TEXT PRIMARY KEY REFERENCES tags(id) ON DELETE CASCADE,
+    kept INTEGER NOT NULL,
+    removed INTEGER NOT NULL,
+    added INTEGER NOT NULL,
+    precision DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE feeds (
+    id TEXT PRIMARY KEY,
+    url TEXT NOT NULL UNIQUE,
+    title TEXT NOT NULL DEFAULT '',
+    last_polled_at TIMESTAMPTZ,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE feed_items (
+    feed_id TEXT NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+    guid TEXT NOT NULL,
+    entry_id TEXT REFERENCES entries(id) ON DELETE SET NULL,
+    seen_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (feed_id, guid)
+);
+
+CREATE TABLE api_tokens (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    hash TEXT NOT NULL UNIQUE,
+    scope TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    user_id TEXT REFERENCES users(id)
+);
+
+CREATE TABLE maturity_log (
+    entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    from_maturity TEXT NOT NULL,
+    to_maturity TEXT NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX idx_maturity_log_changed_at ON maturity_log(changed_at);
+
+CREATE TABLE entry_links (
+    from_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    to_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL,
+    kind TEXT NOT NULL DEFAULT 'relates',
+    PRIMARY KEY (from_id, to_id)
+);
+CREATE INDEX idx_entry_links_to ON entry_links(to_id);
+
+CREATE TABLE entry_views (
+    entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    viewed_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX idx_entry_views_entry ON entry_views(entry_id);
+CREATE INDEX idx_entry_views_viewed_at ON entry_views(viewed_at);
+
+CREATE TABLE api_cache (
+    kind TEXT NOT NULL,
+    model TEXT NOT NULL,
+    content_hash TEXT NOT NULL,
+    value BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    hits INTEGER NOT NULL DEFAULT 0,
+    last_hit_at TIMESTAMPTZ,
+    PRIMARY KEY (kind, model, content_hash)
+);
+
+CREATE TABLE workflows (
+    name TEXT PRIMARY KEY,
+    states TEXT NOT NULL,
+    transitions TEXT,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE entry_workflows (
+    entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    workflow TEXT NOT NULL REFERENCES workflows(name) ON DELETE CASCADE,
+    state TEXT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (entry_id, workflow)
+);
+CREATE INDEX idx_entry_workflows_state ON entry_workflows(workflow, state);
+
+CREATE TABLE workflow_log (
+    entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    workflow TEXT NOT NULL REFERENCES workflows(name) ON DELETE CASCADE,
+    from_state TEXT,
+    to_state TEXT NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX idx_workflow_log_changed_at ON workflow_log(changed_at);
+
+CREATE TABLE entry_merges (
+    entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    merged_id TEXT NOT NULL,
+    title TEXT,
+    source_url TEXT,
+    created_at TIMESTAMPTZ NOT NULL,
+    merged_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX idx_entry_merges_entry ON entry_merges(entry_id);
+CREATE INDEX idx_entry_merges_url ON entry_merges(source_url);
+
+CREATE TABLE entry_versions (
+    entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    title TEXT,
+    created_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (entry_id, revision)
+);
+
+CREATE TABLE sync_changes (
+    entry_id TEXT PRIMARY KEY,
+    seq INTEGER NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL,
+    deleted BOOLEAN NOT NULL DEFAULT FALSE,
+    origin TEXT
+);
+CREATE UNIQUE INDEX idx_sync_changes_seq ON sync_changes(seq);
+
+CREATE TABLE sync_conflicts (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    entry_id TEXT NOT NULL,
+    peer TEXT NOT NULL,
+    kept TEXT NOT NULL,
+    kept_changed_at TIMESTAMPTZ NOT NULL,
+    lost_changed_at TIMESTAMPTZ NOT NULL,
+    lost_deleted BOOLEAN NOT NULL DEFAULT FALSE,
+    lost_title TEXT NOT NULL DEFAULT '',
+    lost_content TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX idx_sync_conflicts_created_at ON sync_conflicts(created_at);
+
+CREATE TABLE collections (
+    name TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE collection_entries (
+    collection TEXT NOT NULL REFERENCES collections(name) ON DELETE CASCADE,
+    entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    added_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (collection, entry_id)
+);
+CREATE INDEX idx_collection_entries_entry ON collection_entries(entry_id);
+
+CREATE TABLE reminders (
+    entry_id TEXT PRIMARY KEY REFERENCES entries(id) ON DELETE CASCADE,
+    remind_at TIMESTAMPTZ NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    notified_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX idx_reminders_remind_at ON reminders(remind_at);
+
+CREATE TABLE shares (
+    id TEXT PRIMARY KEY,
+    entry_id TEXT REFERENCES entries(id) ON DELETE CASCADE,
+    tag_id TEXT REFERENCES tags(id) ON DELETE CASCADE,
+    user_id TEXT REFERENCES users(id),
+    created_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ,
+    CHECK ((entry_id IS NULL) != (tag_id IS NULL))
+);
+CREATE INDEX idx_shares_entry ON shares(entry_id);
+CREATE INDEX idx_shares_tag ON shares(tag_id);
+
+-- Sync changes, as the SQLite triggers of 0021 record them: every change
+-- to an entry, its tags or its outgoing links takes the next sequence
+-- number. Tag and link removals cascading from deleting the entry are
+-- left to the entry's own change.
+CREATE FUNCTION record_sync_change(entry TEXT, gone BOOLEAN) RETURNS VOID AS $$
+    INSERT INTO sync_changes (entry_id, seq, changed_at, deleted, origin)
+    VALUES (entry, (SELECT COALESCE(MAX(seq), 0) + 1 FROM sync_changes), now(), gone, NULL)
+    ON CONFLICT (entry_id) DO UPDATE
+    SET seq = EXCLUDED.seq, changed_at = EXCLUDED.changed_at, deleted = EXCLUDED.deleted, origin = NULL
+$$ LANGUAGE SQL;
+
+CREATE FUNCTION sync_entry_change() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM record_sync_change(OLD.id, TRUE);
+    ELSE
+        PERFORM record_sync_change(NEW.id, FALSE);
+    END IF;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE FUNCTION sync_tag_change() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        PERFORM record_sync_change(NEW.entry_id, FALSE);
+    ELSIF EXISTS (SELECT 1 FROM entries WHERE id = OLD.entry_id) THEN
+        PERFORM record_sync_change(OLD.entry_id, FALSE);
+    END IF;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE FUNCTION sync_link_change() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        PERFORM record_sync_change(NEW.from_id, FALSE);
+    ELSIF EXISTS (SELECT 1 FROM entries WHERE id = OLD.from_id) THEN
+        PERFORM record_sync_change(OLD.from_id, FALSE);
+    END IF;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER sync_entry_insert AFTER INSERT ON entries
+    FOR EACH ROW EXECUTE FUNCTION sync_entry_change();
+CREATE TRIGGER sync_entry_update AFTER UPDATE OF content, title, source_type, source_url, author, fetched_at,
+    expires_at, maturity, notebook, archived_at, deleted_at ON entries
+    FOR EACH ROW EXECUTE FUNCTION sync_entry_change();
+CREATE TRIGGER sync_entry_delete AFTER DELETE ON entries
+    FOR EACH ROW EXECUTE FUNCTION sync_entry_change();
+CREATE TRIGGER sync_tag_insert AFTER INSERT ON entry_tags
+    FOR EACH ROW EXECUTE FUNCTION sync_tag_change();
+CREATE TRIGGER sync_tag_delete AFTER DELETE ON entry_tags
+    FOR EACH ROW EXECUTE FUNCTION sync_tag_change();
+CREATE TRIGGER sync_link_insert AFTER INSERT ON entry_links
+    FOR EACH ROW EXECUTE FUNCTION sync_link_change();
+CREATE TRIGGER sync_link_delete AFTER DELETE ON entry_links
+    FOR EACH ROW EXECUTE FUNCTION sync_link_change();
+
+-- SQLite functions the store queries use
+CREATE FUNCTION julianday(t TIMESTAMPTZ) RETURNS DOUBLE PRECISION AS $$
+    SELECT extract(epoch FROM t)::DOUBLE PRECISION / 86400 + 2440587.5
+$$ LANGUAGE SQL IMMUTABLE;
+
+-- Only the formats the store uses, in UTC as SQLite formats them
+CREATE FUNCTION strftime(format TEXT, t TIMESTAMPTZ) RETURNS TEXT AS $$
+    SELECT CASE format
+        WHEN '%s' THEN floor(extract(epoch FROM t))::BIGINT::TEXT
+        WHEN '%Y-%m-%d' THEN to_char(t AT TIME ZONE 'UTC', 'YYYY-MM-DD')
+        WHEN '%Y-%m-%dT%H:00' THEN to_char(t AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:00')
+        WHEN '%Y-%m' THEN to_char(t AT TIME ZONE 'UTC', 'YYYY-MM')
+        -- %W counts weeks from the year's first Monday, from 00
+        WHEN '%Y-W%W' THEN to_char(t AT TIME ZONE 'UTC', 'YYYY') || '-W' || lpad(
+            ((extract(doy FROM t AT TIME ZONE 'UTC')::INTEGER - 1 + 7
+              - (extract(dow FROM t AT TIME ZONE 'UTC')::INTEGER + 6) % 7) / 7)::TEXT, 2, '0')
+    END
+$$ LANGUAGE SQL IMMUTABLE;
+
+CREATE FUNCTION instr(haystack TEXT, needle TEXT) RETURNS INTEGER AS $$
+    SELECT strpos(haystack, needle)
+$$ LANGUAGE SQL IMMUTABLE;
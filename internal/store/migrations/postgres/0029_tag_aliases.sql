@@ -0,0 +1,10 @@
+-- Other names of tags ("golang" for "go"): tagging with an alias tags
+-- with its tag instead. Aliases are unique per user, like tag names.
+CREATE TABLE tag_aliases (
+    alias TEXT NOT NULL,
+    tag_id TEXT NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    user_id TEXT REFERENCES users(id),
+    created_at TIMESTAMPTZ NOT NULL
+);
+CREATE UNIQUE INDEX idx_tag_aliases_user_alias ON tag_aliases(COALESCE(user_id, ''), alias);
+CREATE INDEX idx_tag_aliases_tag ON tag_aliases(tag_id);
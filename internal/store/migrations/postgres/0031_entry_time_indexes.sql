@@ -0,0 +1,4 @@
+-- Entry lists range over and order by creation and view times, compared
+-- through julianday as in SQLite
+CREATE INDEX idx_entries_created_at ON entries(julianday(created_at));
+CREATE INDEX idx_entries_last_viewed_at ON entries(julianday(last_viewed_at));
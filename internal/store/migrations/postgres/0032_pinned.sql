@@ -0,0 +1,5 @@
+-- Pinned entries are listed apart, above the others, to keep reference
+-- notes at hand
+ALTER TABLE entries ADD COLUMN pinned_at TIMESTAMPTZ;
+
+CREATE INDEX idx_entries_pinned_at ON entries(pinned_at) WHERE pinned_at IS NOT NULL;
@@ -0,0 +1,8 @@
+-- Entries captured from URLs wait in a reading queue until marked read.
+-- Articles never opened join it.
+ALTER TABLE entries ADD COLUMN unread_since TIMESTAMPTZ;
+
+UPDATE entries SET unread_since = created_at
+WHERE source_type = 'url' AND last_viewed_at IS NULL AND deleted_at IS NULL;
+
+CREATE INDEX idx_entries_unread_since ON entries(unread_since) WHERE unread_since IS NOT NULL;
@@ -0,0 +1,55 @@
+-- Tags and links between entries sync as records of their own, as in the
+-- SQLite migration 0034. entry_id is the ID of the record changed: the
+-- entry's, the tag's, or from_id/to_id for a link.
+ALTER TABLE sync_changes ADD COLUMN kind TEXT NOT NULL DEFAULT 'entry';
+
+CREATE FUNCTION record_sync_record(record TEXT, record_kind TEXT, gone BOOLEAN) RETURNS VOID AS $$
+    INSERT INTO sync_changes (entry_id, kind, seq, changed_at, deleted, origin)
+    VALUES (record, record_kind, (SELECT COALESCE(MAX(seq), 0) + 1 FROM sync_changes), now(), gone, NULL)
+    ON CONFLICT (entry_id) DO UPDATE
+    SET kind = EXCLUDED.kind, seq = EXCLUDED.seq, changed_at = EXCLUDED.changed_at, deleted = EXCLUDED.deleted, origin = NULL
+$$ LANGUAGE SQL;
+
+CREATE OR REPLACE FUNCTION sync_link_change() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP <> 'DELETE' THEN
+        PERFORM record_sync_record(NEW.from_id || '/' || NEW.to_id, 'link', FALSE);
+    ELSIF EXISTS (SELECT 1 FROM entries WHERE id = OLD.from_id) AND EXISTS (SELECT 1 FROM entries WHERE id = OLD.to_id) THEN
+        PERFORM record_sync_record(OLD.from_id || '/' || OLD.to_id, 'link', TRUE);
+    END IF;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE FUNCTION sync_tag_record_change() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        IF OLD.user_id IS NULL THEN
+            PERFORM record_sync_record(OLD.id, 'tag', TRUE);
+        END IF;
+    ELSIF NEW.user_id IS NULL THEN
+        PERFORM record_sync_record(NEW.id, 'tag', FALSE);
+    END IF;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER sync_tag_update AFTER UPDATE OF confidence, origin ON entry_tags
+    FOR EACH ROW EXECUTE FUNCTION sync_tag_change();
+CREATE TRIGGER sync_link_update AFTER UPDATE OF kind ON entry_links
+    FOR EACH ROW EXECUTE FUNCTION sync_link_change();
+CREATE TRIGGER sync_tag_record_insert AFTER INSERT ON tags
+    FOR EACH ROW EXECUTE FUNCTION sync_tag_record_change();
+CREATE TRIGGER sync_tag_record_update AFTER UPDATE OF name, parent_id, description, color ON tags
+    FOR EACH ROW EXECUTE FUNCTION sync_tag_record_change();
+CREATE TRIGGER sync_tag_record_delete AFTER DELETE ON tags
+    FOR EACH ROW EXECUTE FUNCTION sync_tag_record_change();
+
+INSERT INTO sync_changes (entry_id, kind, seq, changed_at)
+SELECT t.id, 'tag', last.seq + ROW_NUMBER() OVER (ORDER BY t.created_at, t.id), t.created_at
+FROM tags t, (SELECT COALESCE(MAX(seq), 0) AS seq FROM sync_changes) last
+WHERE t.user_id IS NULL;
+
+INSERT INTO sync_changes (entry_id, kind, seq, changed_at)
+SELECT l.from_id || '/' || l.to_id, 'link', last.seq + ROW_NUMBER() OVER (ORDER BY l.created_at, l.from_id, l.to_id), l.created_at
+FROM entry_links l, (SELECT COALESCE(MAX(seq), 0) AS seq FROM sync_changes) last;
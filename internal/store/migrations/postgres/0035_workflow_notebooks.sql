@@ -0,0 +1,4 @@
+-- A workflow can be for the entries of one notebook and its
+-- sub-notebooks, e.g. idea → drafted → published for a writing notebook.
+-- Without a notebook, it's for every entry.
+ALTER TABLE workflows ADD COLUMN notebook TEXT REFERENCES notebooks(name) ON DELETE CASCADE;
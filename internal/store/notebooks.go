@@ -0,0 +1,411 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/secret"
+)
+
+// ErrNotebookNotFound is returned when no notebook has a given name
+var ErrNotebookNotFound = errors.New("notebook not found")
+
+// ErrNotebookLocked is returned when writing to an encrypted notebook
+// whose key isn't unlocked
+var ErrNotebookLocked = errors.New("notebook is locked")
+
+// encryptedPrefix marks encrypted content, stored as the prefix, the name
+// of the notebook holding the key, ':' and the base64 ciphertext
+const encryptedPrefix = "kb:encrypted:v1:"
+
+// AddNotebook creates a notebook, under its parent if it has one. With a
+// passphrase, the notebook gets its own key, unlocked in this store.
+func (s *Store) AddNotebook(ctx context.Context, nb *domain.Notebook, passphrase string) error {
+	if err := domain.CheckNotebookName(nb.Name); err != nil {
+		return err
+	}
+	if nb.Parent != "" {
+		if _, err := s.GetNotebook(ctx, nb.Parent); err != nil {
+			return err
+		}
+	}
+
+	var salt, check []byte
+	var key []byte
+	if passphrase != "" {
+		var err error
+		if salt, err = secret.NewSalt(); err != nil {
+			return err
+		}
+		key = secret.DeriveKey(passphrase, salt)
+		if check, err = secret.Check(key); err != nil {
+			return err
+		}
+	}
+
+	nb.CreatedAt = time.Now()
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO notebooks (name, parent, key_salt, key_check, created_at) VALUES (?, ?, ?, ?, ?)",
+		nb.Name, nullString(nb.Parent), salt, check, nb.CreatedAt,
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			return fmt.Errorf("notebook %s already exists", nb.Name)
+		}
+		return fmt.Errorf("insert notebook: %w", err)
+	}
+	if key != nil {
+		s.setKey(nb.Name, key)
+	}
+	nb.Encrypted = key != nil
+	return nil
+}
+
+// GetNotebook returns a notebook by name
+func (s *Store) GetNotebook(ctx context.Context, name string) (*domain.Notebook, error) {
+	notebooks, err := s.ListNotebooks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range notebooks {
+		if notebooks[i].Name == name {
+			return &notebooks[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNotebookNotFound, name)
+}
+
+// ListNotebooks returns all notebooks by name, with their entry counts
+// and where their key comes from
+func (s *Store) ListNotebooks(ctx context.Context) ([]domain.Notebook, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT n.name, n.parent, n.key_salt IS NOT NULL, n.created_at,
+		       (SELECT COUNT(*) FROM entries e WHERE e.notebook = n.name)
+		FROM notebooks n
+		ORDER BY n.name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("list notebooks: %w", err)
+	}
+	defer rows.Close()
+
+	var notebooks []domain.Notebook
+	parents := make(map[string]string)
+	encrypted := make(map[string]bool)
+	for rows.Next() {
+		var nb domain.Notebook
+		var parent sql.NullString
+		if err := rows.Scan(&nb.Name, &parent, &nb.Encrypted, &nb.CreatedAt, &nb.Entries); err != nil {
+			return nil, fmt.Errorf("scan notebook: %w", err)
+		}
+		nb.Parent = parent.String
+		parents[nb.Name] = nb.Parent
+		encrypted[nb.Name] = nb.Encrypted
+		notebooks = append(notebooks, nb)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range notebooks {
+		nb := &notebooks[i]
+		for name := nb.Name; name != ""; name = parents[name] {
+			if encrypted[name] {
+				nb.KeyFrom = name
+				break
+			}
+		}
+		if nb.KeyFrom != "" {
+			_, unlocked := s.key(nb.KeyFrom)
+			nb.Locked = !unlocked
+		}
+	}
+	return notebooks, nil
+}
+
+// DeleteNotebook removes a notebook with no entries and no sub-notebooks
+func (s *Store) DeleteNotebook(ctx context.Context, name string) error {
+	nb, err := s.GetNotebook(ctx, name)
+	if err != nil {
+		return err
+	}
+	if nb.Entries > 0 {
+		return fmt.Errorf("notebook %s still has %d entries", name, nb.Entries)
+	}
+	var children int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM notebooks WHERE parent = ?", name).Scan(&children); err != nil {
+		return fmt.Errorf("count sub-notebooks: %w", err)
+	}
+	if children > 0 {
+		return fmt.Errorf("notebook %s still has %d sub-notebooks", name, children)
+	}
+
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM notebooks WHERE name = ?", name); err != nil {
+		return fmt.Errorf("delete notebook: %w", err)
+	}
+	if current, err := s.CurrentNotebook(ctx); err == nil && current == name {
+		s.UseNotebook(ctx, "")
+	}
+	s.LockNotebook(name)
+	return nil
+}
+
+// UnlockNotebook derives an encrypted notebook's key from its passphrase
+// and keeps it in this store, for reading and writing its entries
+func (s *Store) UnlockNotebook(ctx context.Context, name, passphrase string) error {
+	var salt, check []byte
+	err := s.db.QueryRowContext(ctx, "SELECT key_salt, key_check FROM notebooks WHERE name = ?", name).Scan(&salt, &check)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: %s", ErrNotebookNotFound, name)
+	}
+	if err != nil {
+		return fmt.Errorf("get notebook key: %w", err)
+	}
+	if salt == nil {
+		return fmt.Errorf("notebook %s has no key of its own", name)
+	}
+
+	key := secret.DeriveKey(passphrase, salt)
+	if !secret.Verify(key, check) {
+		return fmt.Errorf("unlock %s: %w", name, secret.ErrWrongKey)
+	}
+	s.setKey(name, key)
+	return nil
+}
+
+// UnlockNotebooks tries a passphrase on every locked notebook with a key
+// of its own, returning those it unlocked
+func (s *Store) UnlockNotebooks(ctx context.Context, passphrase string) ([]string, error) {
+	notebooks, err := s.ListNotebooks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var unlocked []string
+	for _, nb := range notebooks {
+		if !nb.Encrypted || !nb.Locked {
+			continue
+		}
+		if err := s.UnlockNotebook(ctx, nb.Name, passphrase); err == nil {
+			unlocked = append(unlocked, nb.Name)
+		} else if !errors.Is(err, secret.ErrWrongKey) {
+			return unlocked, err
+		}
+	}
+	return unlocked, nil
+}
+
+// LockNotebook forgets a notebook's key
+func (s *Store) LockNotebook(name string) {
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+	delete(s.keys, name)
+}
+
+// SetEntryNotebook moves an entry to a notebook, or out of any with an
+// empty name, encrypting or decrypting its content and past versions as
+// needed
+func (s *Store) SetEntryNotebook(ctx context.Context, id, notebook string) (*domain.Entry, error) {
+	entry, err := s.GetEntry(ctx, id)
+	if err != nil {
+		return nil, ErrEntryNotFound
+	}
+	if entry.Locked {
+		return nil, fmt.Errorf("%w: %s", ErrNotebookLocked, entry.Notebook)
+	}
+	content, err := s.sealContent(ctx, notebook, entry.Content)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := s.resealVersions(ctx, id, notebook)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE entries SET content = ?, notebook = ? WHERE id = ?", content, nullString(notebook), id,
+	); err != nil {
+		return nil, fmt.Errorf("set entry notebook: %w", err)
+	}
+	for revision, content := range versions {
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE entry_versions SET content = ? WHERE entry_id = ? AND revision = ?", content, id, revision,
+		); err != nil {
+			return nil, fmt.Errorf("update entry version: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return s.GetEntry(ctx, id)
+}
+
+// entryNotebook returns the notebook an entry is in, "" for none
+func (s *Store) entryNotebook(ctx context.Context, id string) (string, error) {
+	var notebook sql.NullString
+	err := s.db.QueryRowContext(ctx, "SELECT notebook FROM entries WHERE id = ?", id).Scan(&notebook)
+	if err == sql.ErrNoRows {
+		return "", ErrEntryNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("get entry notebook: %w", err)
+	}
+	return notebook.String, nil
+}
+
+// sealContent returns content as stored in a notebook: encrypted with the
+// notebook's key if it has one, else with the database key if the
+// database is encrypted, else as is. notebook is the one the entry is or
+// goes in, "" for none: AddEntryToNotebook resolves the context's first.
+func (s *Store) sealContent(ctx context.Context, notebook, content string) (string, error) {
+	keyFrom := databaseKey
+	if notebook != "" {
+		nb, err := s.GetNotebook(ctx, notebook)
+		if err != nil {
+			return "", err
+		}
+		keyFrom = nb.KeyFrom
+	}
+	if keyFrom == databaseKey && !s.encrypted {
+		return content, nil
+	}
+	key, ok := s.key(keyFrom)
+	switch {
+	case !ok && keyFrom == databaseKey:
+		return "", ErrDatabaseLocked
+	case !ok:
+		return "", fmt.Errorf("%w: %s", ErrNotebookLocked, keyFrom)
+	}
+	return sealWith(key, keyFrom, content)
+}
+
+// openContent decrypts an entry's content read from the database. Without
+// the key, the entry is marked locked and its content left empty, and its
+// title too: it's stored in plaintext, but shown only once unlocked.
+func (s *Store) openContent(e *domain.Entry) {
+	var ok bool
+	e.Content, ok = s.openText(e.Content)
+	e.Locked = !ok
+	if e.Locked {
+		e.Source.Title = ""
+	}
+}
+
+// openText decrypts content as stored, returning false and no content
+// when it is encrypted with a key that isn't unlocked
+func (s *Store) openText(stored string) (string, bool) {
+	rest, ok := strings.CutPrefix(stored, encryptedPrefix)
+	if !ok {
+		return stored, true
+	}
+
+	notebook, data, _ := strings.Cut(rest, ":")
+	key, ok := s.key(notebook)
+	if !ok {
+		return "", false
+	}
+	sealed, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", false
+	}
+	plaintext, err := secret.Open(key, sealed)
+	if err != nil {
+		return "", false
+	}
+	return string(plaintext), true
+}
+
+func (s *Store) key(notebook string) ([]byte, bool) {
+	s.keysMu.RLock()
+	defer s.keysMu.RUnlock()
+	key, ok := s.keys[notebook]
+	return key, ok
+}
+
+func (s *Store) setKey(notebook string, key []byte) {
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+	s.keys[notebook] = key
+}
+
+// nullString stores empty strings as NULL
+func nullString(v string) sql.NullString {
+	return sql.NullString{String: v, Valid: v != ""}
+}
+
+// currentNotebookSetting is the setting holding the notebook chosen with
+// UseNotebook
+const currentNotebookSetting = "notebook.current"
+
+// CurrentNotebook returns the notebook chosen with UseNotebook, "" for
+// none
+func (s *Store) CurrentNotebook(ctx context.Context) (string, error) {
+	return s.GetSetting(ctx, currentNotebookSetting)
+}
+
+// UseNotebook saves the notebook commands work in by default, or clears
+// it with an empty name
+func (s *Store) UseNotebook(ctx context.Context, name string) error {
+	if name == "" {
+		return s.DeleteSetting(ctx, currentNotebookSetting)
+	}
+	if _, err := s.GetNotebook(ctx, name); err != nil {
+		return err
+	}
+	return s.SetSetting(ctx, currentNotebookSetting, name)
+}
+
+// notebookKey is the context key of the notebook store calls work in
+type notebookKey struct{}
+
+// WithNotebook makes the store calls made with ctx work in a notebook,
+// overriding the one set with SetNotebook
+func WithNotebook(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, notebookKey{}, name)
+}
+
+// SetNotebook sets the notebook store calls work in when their context
+// names none: lists, searches and statistics only cover its entries and
+// those of its sub-notebooks, and entries are added to it. It's set
+// before the store is shared.
+func (s *Store) SetNotebook(name string) {
+	s.notebook = name
+}
+
+// Notebook returns the notebook store calls made with ctx work in, ""
+// for the whole database
+func (s *Store) Notebook(ctx context.Context) string {
+	if name, ok := ctx.Value(notebookKey{}).(string); ok {
+		return name
+	}
+	return s.notebook
+}
+
+// visibleCondition returns the SQL condition, and its arguments, keeping
+// the entries visible to ctx: those of the user it acts as, in the
+// notebook it works in or its sub-notebooks, on columns prefixed with
+// prefix (e.g. "e.")
+func (s *Store) visibleCondition(ctx context.Context, prefix string) (string, []interface{}) {
+	ofUser, args := userCondition(ctx, prefix)
+	name := s.Notebook(ctx)
+	if name == "" {
+		return ofUser, args
+	}
+	return ofUser + " AND " + prefix + `notebook IN (
+		WITH RECURSIVE tree(name) AS (
+			SELECT CAST(? AS TEXT) UNION SELECT n.name FROM notebooks n JOIN tree ON n.parent = tree.name
+		)
+		SELECT name FROM tree
+	)`, append(args, name)
+}
@@ -0,0 +1,97 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/fetcher"
+)
+
+// FindEntryByURL returns the oldest entry captured from one of the given
+// URLs (e.g. a link and the page's declared URL), or whose canonical URL
+// is one of theirs, or nil if none. An entry merged into another is found
+// as the one it went into.
+func (s *Store) FindEntryByURL(ctx context.Context, urls ...string) (*domain.Entry, error) {
+	if len(urls) == 0 {
+		return nil, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(urls)), ", ")
+	var raw, canonical []interface{}
+	for _, u := range urls {
+		raw = append(raw, u)
+		canonical = append(canonical, fetcher.CanonicalURL(u))
+	}
+	matches := "(source_url IN (" + placeholders + ") OR canonical_url IN (" + placeholders + "))"
+	args := append(raw, canonical...)
+
+	var id string
+	ofUser, userArgs := userCondition(ctx, "")
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id FROM entries WHERE deleted_at IS NULL AND ("+matches+" OR id IN (SELECT entry_id FROM entry_merges WHERE "+matches+")) AND "+ofUser+" ORDER BY created_at LIMIT 1",
+		append(append(args, args...), userArgs...)...,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find entry by url: %w", err)
+	}
+	return s.GetEntry(ctx, id)
+}
+
+// canonicalURL is the URL an entry of a source is found by: the page's
+// declared one if known, else the captured link, made canonical
+func canonicalURL(src domain.Source) string {
+	if src.CanonicalURL != "" {
+		return fetcher.CanonicalURL(src.CanonicalURL)
+	}
+	return fetcher.CanonicalURL(src.URL)
+}
+
+// AddSourceOccurrence records that an entry's URL was seen via a source
+// (a feed, a newsletter, a manual add)
+func (s *Store) AddSourceOccurrence(ctx context.Context, entryID, via, url string) (*domain.SourceOccurrence, error) {
+	o := domain.SourceOccurrence{
+		ID:      uuid.New().String(),
+		EntryID: entryID,
+		Via:     via,
+		URL:     url,
+		SeenAt:  time.Now(),
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO source_occurrences (id, entry_id, via, url, seen_at) VALUES (?, ?, ?, ?, ?)",
+		o.ID, o.EntryID, o.Via, o.URL, o.SeenAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("insert source occurrence: %w", err)
+	}
+	return &o, nil
+}
+
+// ListSourceOccurrences returns where an entry was seen, oldest first
+func (s *Store) ListSourceOccurrences(ctx context.Context, entryID string) ([]domain.SourceOccurrence, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT id, entry_id, via, url, seen_at FROM source_occurrences WHERE entry_id = ? ORDER BY seen_at",
+		entryID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list source occurrences: %w", err)
+	}
+	defer rows.Close()
+
+	var occurrences []domain.SourceOccurrence
+	for rows.Next() {
+		var o domain.SourceOccurrence
+		if err := rows.Scan(&o.ID, &o.EntryID, &o.Via, &o.URL, &o.SeenAt); err != nil {
+			return nil, fmt.Errorf("scan source occurrence: %w", err)
+		}
+		occurrences = append(occurrences, o)
+	}
+	return occurrences, nil
+}
@@ -0,0 +1,66 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// PinEntry pins an entry, keeping when it was first pinned if it already is
+func (s *Store) PinEntry(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE entries SET pinned_at = COALESCE(pinned_at, ?) WHERE id = ? AND deleted_at IS NULL", time.Now(), id,
+	)
+	if err != nil {
+		return fmt.Errorf("pin entry: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return s.stateError(ctx, id)
+	}
+	return nil
+}
+
+// UnpinEntry unpins an entry; unpinned entries are left as they are
+func (s *Store) UnpinEntry(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE entries SET pinned_at = NULL WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("unpin entry: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrEntryNotFound
+	}
+	return nil
+}
+
+// PinnedEntries returns the active pinned entries of the notebook ctx works
+// in, the most recently pinned first
+func (s *Store) PinnedEntries(ctx context.Context) ([]domain.Entry, error) {
+	inScope, err := scopeCondition(domain.ScopeActive, "")
+	if err != nil {
+		return nil, err
+	}
+	visible, args := s.visibleCondition(ctx, "")
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, content, created_at, last_viewed_at, source_type, source_url, title, author, fetched_at, expires_at, maturity, pinned_at
+		FROM entries
+		WHERE pinned_at IS NOT NULL AND `+inScope+` AND `+visible+`
+		ORDER BY pinned_at DESC
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list pinned entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []domain.Entry
+	for rows.Next() {
+		var e domain.Entry
+		if err := rows.Scan(append(entryFields(&e), &e.PinnedAt)...); err != nil {
+			return nil, fmt.Errorf("scan pinned entry: %w", err)
+		}
+		s.openContent(&e)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,153 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// IsPostgres reports whether a database location is a Postgres connection
+// URL rather than the path of a SQLite file
+func IsPostgres(location string) bool {
+	return strings.HasPrefix(location, "postgres://") || strings.HasPrefix(location, "postgresql://")
+}
+
+// openPostgres connects to a Postgres database, whose connections number
+// placeholders as Postgres wants them (see toPostgres)
+func openPostgres(dsn string, opts StoreOptions) (*sql.DB, error) {
+	config, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("parse database url: %w", err)
+	}
+	db := sql.OpenDB(pgConnector{stdlib.GetConnector(*config)})
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connect to database: %w", err)
+	}
+	return db, nil
+}
+
+// redactURL hides the password of a connection URL, to show it
+func redactURL(dsn string) string {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "postgres"
+	}
+	return u.Redacted()
+}
+
+// pgConnector opens pgx connections that number placeholders
+type pgConnector struct {
+	driver.Connector
+}
+
+func (c pgConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &pgConn{conn.(*stdlib.Conn)}, nil
+}
+
+// pgConn is a pgx connection taking ? placeholders
+type pgConn struct {
+	*stdlib.Conn
+}
+
+func (c *pgConn) Prepare(query string) (driver.Stmt, error) {
+	return c.Conn.Prepare(toPostgres(query))
+}
+
+func (c *pgConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.Conn.PrepareContext(ctx, toPostgres(query))
+}
+
+func (c *pgConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.Conn.ExecContext(ctx, toPostgres(query), args)
+}
+
+func (c *pgConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.Conn.QueryContext(ctx, toPostgres(query), args)
+}
+
+// translated caches toPostgres, as the same statements run over and over
+var translated sync.Map
+
+// toPostgres numbers the placeholders of a statement as Postgres wants
+// them: ? and ?N become $N. Quoted strings and comments are left alone.
+// Statements are otherwise written in SQL both databases run: upserts with
+// ON CONFLICT, case-insensitive matches with lower(), and the functions
+// SQLite has built in that Postgres hasn't (julianday, strftime, instr)
+// are created by the Postgres migrations.
+func toPostgres(query string) string {
+	if q, ok := translated.Load(query); ok {
+		return q.(string)
+	}
+
+	var out strings.Builder
+	params := 0
+	code := func(s string) {
+		for {
+			i := strings.IndexByte(s, '?')
+			if i < 0 {
+				out.WriteString(s)
+				return
+			}
+			out.WriteString(s[:i])
+			s = s[i+1:]
+			digits := len(s) - len(strings.TrimLeft(s, "0123456789"))
+			n := params + 1
+			if digits > 0 {
+				n, _ = strconv.Atoi(s[:digits])
+				s = s[digits:]
+			}
+			params = max(params, n)
+			out.WriteString("$" + strconv.Itoa(n))
+		}
+	}
+	q := query
+	for len(q) > 0 {
+		start, end := quoted(q)
+		code(q[:start])
+		out.WriteString(q[start:end])
+		q = q[end:]
+	}
+
+	result := out.String()
+	translated.Store(query, result)
+	return result
+}
+
+// quoted returns the bounds of the first quoted string, quoted name,
+// dollar-quoted body or comment in a statement, or its end if none
+func quoted(q string) (int, int) {
+	for i := 0; i < len(q); i++ {
+		var closing string
+		switch {
+		case q[i] == '\'' || q[i] == '"':
+			closing = q[i : i+1]
+		case strings.HasPrefix(q[i:], "$$"):
+			closing = "$$"
+		case strings.HasPrefix(q[i:], "--"):
+			closing = "\n"
+		default:
+			continue
+		}
+		rest := q[i+len(closing):]
+		j := strings.Index(rest, closing)
+		if j < 0 {
+			return i, len(q)
+		}
+		return i, len(q) - len(rest) + j + len(closing)
+	}
+	return len(q), len(q)
+}
@@ -0,0 +1,28 @@
+package store
+
+import "testing"
+
+func TestToPostgres(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT id FROM entries WHERE id = ? AND user_id = ?", "SELECT id FROM entries WHERE id = $1 AND user_id = $2"},
+		{"UPDATE reviews SET entry_id = ?1 WHERE entry_id = ?2", "UPDATE reviews SET entry_id = $1 WHERE entry_id = $2"},
+		{"SELECT ?2, ?1, ?2", "SELECT $2, $1, $2"},
+		// Numbered and plain placeholders follow on as in SQLite
+		{"SELECT ?2, ?", "SELECT $2, $3"},
+		// Quoted strings and comments are left alone
+		{"SELECT '?' || ?, \"a?\" FROM t -- why?\nWHERE x = ?", "SELECT '?' || $1, \"a?\" FROM t -- why?\nWHERE x = $2"},
+		{"CREATE FUNCTION f() RETURNS TEXT AS $$ SELECT '?' $$ LANGUAGE SQL", "CREATE FUNCTION f() RETURNS TEXT AS $$ SELECT '?' $$ LANGUAGE SQL"},
+		{
+			"INSERT INTO settings (key, value) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value",
+			"INSERT INTO settings (key, value) VALUES ($1, $2) ON CONFLICT (key) DO UPDATE SET value = excluded.value",
+		},
+	}
+	for _, tt := range tests {
+		if got := toPostgres(tt.query); got != tt.want {
+			t.Errorf("toPostgres(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// AddPreTagger stores a new pre-tagger
+func (s *Store) AddPreTagger(ctx context.Context, pattern, tag, parent string, skipLLM bool) (*domain.PreTagger, error) {
+	p := domain.PreTagger{
+		ID:        uuid.New().String(),
+		Pattern:   pattern,
+		Tag:       tag,
+		Parent:    parent,
+		SkipLLM:   skipLLM,
+		CreatedAt: time.Now(),
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO pretaggers (id, pattern, tag, parent, skip_llm, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		p.ID, p.Pattern, p.Tag, p.Parent, p.SkipLLM, p.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("insert pretagger: %w", err)
+	}
+	return &p, nil
+}
+
+// ListPreTaggers returns all pre-taggers in creation order
+func (s *Store) ListPreTaggers(ctx context.Context) ([]domain.PreTagger, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, pattern, tag, parent, skip_llm, created_at FROM pretaggers ORDER BY created_at")
+	if err != nil {
+		return nil, fmt.Errorf("list pretaggers: %w", err)
+	}
+	defer rows.Close()
+
+	var taggers []domain.PreTagger
+	for rows.Next() {
+		var p domain.PreTagger
+		if err := rows.Scan(&p.ID, &p.Pattern, &p.Tag, &p.Parent, &p.SkipLLM, &p.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan pretagger: %w", err)
+		}
+		taggers = append(taggers, p)
+	}
+	return taggers, nil
+}
+
+// DeletePreTagger removes a pre-tagger by ID or ID prefix
+func (s *Store) DeletePreTagger(ctx context.Context, idPrefix string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM pretaggers WHERE id LIKE lower(?) || '%'", idPrefix)
+	if err != nil {
+		return fmt.Errorf("delete pretagger: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("pretagger not found: %s", idPrefix)
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// TagPlacement is a tag, under a parent tag ("" for none), with how
+// confident the classifier is that it applies
+type TagPlacement struct {
+	Name       string
+	Parent     string
+	Confidence float64
+}
+
+// Reclassification replaces the tags of entries
+type Reclassification struct {
+	// Taxonomy places tags under their parents: tags it puts elsewhere
+	// than where they are are moved, missing ones are created. Nil leaves
+	// the tag tree as it is.
+	Taxonomy []TagPlacement
+	// Tags are the tags to give each entry, by entry ID, replacing those
+	// it has
+	Tags map[string][]TagPlacement
+}
+
+// Reclassify applies a reclassification in one transaction: nothing is
+// changed if any step fails. Tags the entries lost, and parents the
+// taxonomy moved tags from, are retired if no entry nor tag uses them
+// anymore, with their parents left empty in turn; other unused tags and
+// the taxonomy's are left alone. It returns the names of the tags retired.
+func (s *Store) Reclassify(ctx context.Context, r Reclassification) ([]string, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Place the taxonomy's tags first, so entries are linked to the tags
+	// where the taxonomy wants them. Tags the entries lose and parents
+	// tags move from may be left unused; the taxonomy's tags are kept.
+	retiring, kept := make(map[string]bool), make(map[string]bool)
+	for _, t := range r.Taxonomy {
+		tag, err := txTag(ctx, tx, t.Name, nil)
+		if err != nil {
+			return nil, err
+		}
+		kept[tag.ID] = true
+	}
+	for _, t := range r.Taxonomy {
+		previous, err := txPlaceTag(ctx, tx, t.Name, t.Parent)
+		if err != nil {
+			return nil, err
+		}
+		if previous != nil {
+			retiring[*previous] = true
+		}
+	}
+
+	for entryID, tags := range r.Tags {
+		previous, err := txEntryTagIDs(ctx, tx, entryID)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range previous {
+			retiring[id] = true
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM entry_tags WHERE entry_id = ?", entryID); err != nil {
+			return nil, fmt.Errorf("unlink entry tags: %w", err)
+		}
+		for _, t := range tags {
+			var parentID *string
+			if t.Parent != "" {
+				parent, err := txTag(ctx, tx, t.Parent, nil)
+				if err != nil {
+					return nil, err
+				}
+				parentID = &parent.ID
+			}
+			tag, err := txTag(ctx, tx, t.Name, parentID)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := tx.ExecContext(ctx,
+				"INSERT INTO entry_tags (entry_id, tag_id, confidence, origin) VALUES (?, ?, ?, 'auto') ON CONFLICT (entry_id, tag_id) DO UPDATE SET confidence = excluded.confidence, origin = excluded.origin",
+				entryID, tag.ID, t.Confidence,
+			); err != nil {
+				return nil, fmt.Errorf("link entry tag: %w", err)
+			}
+		}
+	}
+
+	retired, err := txRetireTags(ctx, tx, retiring, kept)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return retired, nil
+}
+
+// txTag finds a tag by name or alias, or creates it under parentID
+func txTag(ctx context.Context, tx *sql.Tx, name string, parentID *string) (*domain.Tag, error) {
+	var tag domain.Tag
+	query, args := tagNamed(ctx, name)
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&tag.ID, &tag.Name, &tag.ParentID, &tag.Description, &tag.Color, &tag.CreatedAt)
+	if err == nil {
+		return &tag, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("find tag: %w", err)
+	}
+
+	tag = domain.Tag{ID: uuid.New().String(), Name: name, ParentID: parentID, CreatedAt: time.Now()}
+	if normalized := domain.NormalizeTagName(name); normalized != "" {
+		tag.Name = normalized
+	}
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO tags (id, name, parent_id, created_at, user_id) VALUES (?, ?, ?, ?, ?)",
+		tag.ID, tag.Name, parentID, tag.CreatedAt, nullString(UserID(ctx)),
+	); err != nil {
+		return nil, fmt.Errorf("insert tag: %w", err)
+	}
+	return &tag, nil
+}
+
+// txPlaceTag moves a tag under a parent ("" to make it a root tag),
+// creating the parent if needed. It returns the parent the tag was moved
+// from, nil if it had none or didn't move.
+func txPlaceTag(ctx context.Context, tx *sql.Tx, name, parent string) (*string, error) {
+	tag, err := txTag(ctx, tx, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	var parentID *string
+	if parent != "" {
+		p, err := txTag(ctx, tx, parent, nil)
+		if err != nil {
+			return nil, err
+		}
+		if under, err := tagUnder(ctx, tx, p.ID, tag.ID); err != nil {
+			return nil, err
+		} else if under {
+			return nil, fmt.Errorf("%w: %s is under %s", ErrTagCycle, p.Name, tag.Name)
+		}
+		parentID = &p.ID
+	}
+	if (parentID == nil) == (tag.ParentID == nil) && (parentID == nil || *parentID == *tag.ParentID) {
+		return nil, nil
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE tags SET parent_id = ? WHERE id = ?", parentID, tag.ID); err != nil {
+		return nil, fmt.Errorf("set tag parent: %w", err)
+	}
+	return tag.ParentID, nil
+}
+
+// txEntryTagIDs returns the IDs of the tags linked to an entry
+func txEntryTagIDs(ctx context.Context, tx *sql.Tx, entryID string) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT tag_id FROM entry_tags WHERE entry_id = ?", entryID)
+	if err != nil {
+		return nil, fmt.Errorf("list entry tags: %w", err)
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan entry tag: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// txRetireTags deletes the tags among candidates that have no entries and
+// no child tags, then their parents left so in turn, except those kept. It
+// returns the names of the tags deleted.
+func txRetireTags(ctx context.Context, tx *sql.Tx, candidates, kept map[string]bool) ([]string, error) {
+	var retired []string
+	for len(candidates) > 0 {
+		next := make(map[string]bool)
+		for id := range candidates {
+			if kept[id] {
+				continue
+			}
+			var name string
+			var parentID *string
+			err := tx.QueryRowContext(ctx, `
+				SELECT name, parent_id FROM tags
+				WHERE id = ?
+				AND NOT EXISTS (SELECT 1 FROM entry_tags WHERE tag_id = tags.id)
+				AND NOT EXISTS (SELECT 1 FROM tags c WHERE c.parent_id = tags.id)
+			`, id).Scan(&name, &parentID)
+			if err == sql.ErrNoRows {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("find unused tag: %w", err)
+			}
+			if _, err := tx.ExecContext(ctx, "DELETE FROM tags WHERE id = ?", id); err != nil {
+				return nil, fmt.Errorf("delete tag: %w", err)
+			}
+			retired = append(retired, name)
+			if parentID != nil {
+				next[*parentID] = true
+			}
+		}
+		candidates = next
+	}
+	return retired, nil
+}
@@ -0,0 +1,105 @@
+package store
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReclassify(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	programming, err := s.GetOrCreateTag(ctx, "programming", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golang, err := s.GetOrCreateTag(ctx, "go", &programming.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := s.GetOrCreateTag(ctx, "old", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetOrCreateTag(ctx, "unused", nil); err != nil {
+		t.Fatal(err)
+	}
+	kept, err := s.AddEntry(ctx, "channels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	retagged, err := s.AddEntry(ctx, "goroutines")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, tag := range map[string]string{kept.ID: golang.ID, retagged.ID: old.ID} {
+		if err := s.LinkEntryTag(ctx, id, tag, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	retired, err := s.Reclassify(ctx, Reclassification{
+		Taxonomy: []TagPlacement{{Name: "go", Parent: "languages"}},
+		Tags:     map[string][]TagPlacement{retagged.ID: {{Name: "go", Confidence: 0.9}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The tags left unused are retired, the others left alone
+	slices.Sort(retired)
+	if want := []string{"old", "programming"}; !reflect.DeepEqual(retired, want) {
+		t.Errorf("retired = %v, want %v", retired, want)
+	}
+	if tagNames(t, s) != "go languages unused" {
+		t.Errorf("tags = %s, want go languages unused", tagNames(t, s))
+	}
+	languages, err := s.GetTagByName(ctx, "languages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved, err := s.GetTagByName(ctx, "go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved.ParentID == nil || *moved.ParentID != languages.ID {
+		t.Errorf("go is under %v, want languages", moved.ParentID)
+	}
+	for _, id := range []string{kept.ID, retagged.ID} {
+		tags, err := s.GetEntryTags(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tags) != 1 || tags[0].ID != golang.ID {
+			t.Errorf("entry %s tags = %+v, want go", id, tags)
+		}
+	}
+
+	// A reclassification failing midway changes nothing
+	if _, err := s.Reclassify(ctx, Reclassification{
+		Taxonomy: []TagPlacement{{Name: "go", Parent: "elsewhere"}},
+		Tags:     map[string][]TagPlacement{"missing": {{Name: "go", Confidence: 1}}},
+	}); err == nil {
+		t.Fatal("Reclassify of a missing entry succeeded")
+	}
+	if tagNames(t, s) != "go languages unused" {
+		t.Errorf("tags after a failed reclassification = %s, want them unchanged", tagNames(t, s))
+	}
+}
+
+// tagNames lists the names of the owner's tags, space-separated
+func tagNames(t *testing.T, s *Store) string {
+	t.Helper()
+	tags, err := s.ListTags(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	slices.Sort(names)
+	return strings.Join(names, " ")
+}
@@ -0,0 +1,116 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// ErrReminderNotFound is returned when an entry has no reminder
+var ErrReminderNotFound = errors.New("reminder not found")
+
+// SetReminder sets when to be reminded of an entry, replacing its
+// reminder if it has one
+func (s *Store) SetReminder(ctx context.Context, entryID string, at time.Time, note string) (*domain.Reminder, error) {
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM entries WHERE id = ? AND deleted_at IS NULL)", entryID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("check entry: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrEntryNotFound, entryID)
+	}
+
+	// Timestamps are stored in UTC so due dates compare correctly as text
+	r := domain.Reminder{EntryID: entryID, RemindAt: at.UTC(), Note: note, CreatedAt: time.Now().UTC()}
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO reminders (entry_id, remind_at, note, notified_at, created_at) VALUES (?, ?, ?, NULL, ?) ON CONFLICT (entry_id) DO UPDATE SET remind_at = excluded.remind_at, note = excluded.note, notified_at = excluded.notified_at, created_at = excluded.created_at",
+		r.EntryID, r.RemindAt, r.Note, r.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("save reminder: %w", err)
+	}
+	return &r, nil
+}
+
+// GetReminder returns an entry's reminder, or nil if it has none
+func (s *Store) GetReminder(ctx context.Context, entryID string) (*domain.Reminder, error) {
+	var r domain.Reminder
+	err := s.db.QueryRowContext(ctx,
+		"SELECT entry_id, remind_at, note, notified_at, created_at FROM reminders WHERE entry_id = ?", entryID,
+	).Scan(&r.EntryID, &r.RemindAt, &r.Note, &r.NotifiedAt, &r.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get reminder: %w", err)
+	}
+	return &r, nil
+}
+
+// ClearReminder removes an entry's reminder, once followed up on
+func (s *Store) ClearReminder(ctx context.Context, entryID string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM reminders WHERE entry_id = ?", entryID)
+	if err != nil {
+		return fmt.Errorf("clear reminder: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %s", ErrReminderNotFound, entryID)
+	}
+	return nil
+}
+
+// ListReminders returns the reminders due by the given time with their
+// entries, soonest first, leaving out entries in the trash and outside
+// the notebook ctx works in
+func (s *Store) ListReminders(ctx context.Context, until time.Time) ([]domain.Reminder, error) {
+	return s.listReminders(ctx, "r.remind_at <= ?", until.UTC())
+}
+
+// UnnotifiedReminders returns the reminders due now whose notification
+// wasn't sent yet
+func (s *Store) UnnotifiedReminders(ctx context.Context) ([]domain.Reminder, error) {
+	return s.listReminders(ctx, "r.remind_at <= ? AND r.notified_at IS NULL", time.Now().UTC())
+}
+
+// MarkReminderNotified records that a reminder's notification was sent
+func (s *Store) MarkReminderNotified(ctx context.Context, entryID string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE reminders SET notified_at = ? WHERE entry_id = ?", time.Now().UTC(), entryID)
+	if err != nil {
+		return fmt.Errorf("mark reminder notified: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) listReminders(ctx context.Context, cond string, args ...interface{}) ([]domain.Reminder, error) {
+	visible, nbArgs := s.visibleCondition(ctx, "e.")
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT r.entry_id, r.remind_at, r.note, r.notified_at, r.created_at,
+		       e.id, e.content, e.created_at, e.last_viewed_at,
+		       e.source_type, e.source_url, e.title, e.author, e.fetched_at, e.expires_at, e.maturity
+		FROM reminders r
+		JOIN entries e ON e.id = r.entry_id
+		WHERE `+cond+` AND e.deleted_at IS NULL AND `+visible+`
+		ORDER BY r.remind_at
+	`, append(args, nbArgs...)...)
+	if err != nil {
+		return nil, fmt.Errorf("list reminders: %w", err)
+	}
+	defer rows.Close()
+
+	var reminders []domain.Reminder
+	for rows.Next() {
+		var r domain.Reminder
+		var e domain.Entry
+		if err := rows.Scan(append([]interface{}{&r.EntryID, &r.RemindAt, &r.Note, &r.NotifiedAt, &r.CreatedAt}, entryFields(&e)...)...); err != nil {
+			return nil, fmt.Errorf("scan reminder: %w", err)
+		}
+		s.openContent(&e)
+		r.Entry = &e
+		reminders = append(reminders, r)
+	}
+	return reminders, rows.Err()
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/srs"
+)
+
+// GetReview returns the review state of an entry, or nil if never reviewed
+func (s *Store) GetReview(ctx context.Context, entryID string) (*domain.Review, error) {
+	var r domain.Review
+	err := s.db.QueryRowContext(ctx, `
+		SELECT entry_id, ease, interval_days, repetitions, next_due, last_reviewed_at
+		FROM reviews WHERE entry_id = ?
+	`, entryID).Scan(&r.EntryID, &r.Ease, &r.IntervalDays, &r.Repetitions, &r.NextDue, &r.LastReviewedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get review: %w", err)
+	}
+	return &r, nil
+}
+
+// SaveReview stores the review state of an entry
+func (s *Store) SaveReview(ctx context.Context, r domain.Review) error {
+	// Timestamps are stored in UTC so due dates compare correctly as text
+	var lastReviewed *time.Time
+	if r.LastReviewedAt != nil {
+		t := r.LastReviewedAt.UTC()
+		lastReviewed = &t
+	}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO reviews (entry_id, ease, interval_days, repetitions, next_due, last_reviewed_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (entry_id) DO UPDATE SET ease = excluded.ease, interval_days = excluded.interval_days, repetitions = excluded.repetitions, next_due = excluded.next_due, last_reviewed_at = excluded.last_reviewed_at
+	`, r.EntryID, r.Ease, r.IntervalDays, r.Repetitions, r.NextDue.UTC(), lastReviewed)
+	if err != nil {
+		return fmt.Errorf("save review: %w", err)
+	}
+	return nil
+}
+
+// GradeReview applies a recall grade to an entry and persists the new state
+func (s *Store) GradeReview(ctx context.Context, entryID string, grade int) (*domain.Review, error) {
+	current, err := s.GetReview(ctx, entryID)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil {
+		r := srs.NewReview(entryID)
+		current = &r
+	}
+
+	now := time.Now()
+	next := srs.Grade(*current, grade, now)
+	if err := s.SaveReview(ctx, next); err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		"INSERT INTO review_log (entry_id, grade, reviewed_at) VALUES (?, ?, ?)",
+		entryID, grade, now.UTC(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("log review: %w", err)
+	}
+	return &next, nil
+}
+
+// DueReviews returns entries due for review: overdue entries first, then
+// entries that have never been reviewed. Scratch entries, which expire,
+// aren't reviewed.
+func (s *Store) DueReviews(ctx context.Context, limit int) ([]domain.Entry, error) {
+	visible, args := s.visibleCondition(ctx, "e.")
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT e.id, e.content, e.created_at, e.last_viewed_at,
+		       e.source_type, e.source_url, e.title, e.author, e.fetched_at, e.expires_at, e.maturity
+		FROM entries e
+		LEFT JOIN reviews r ON r.entry_id = e.id
+		WHERE (r.next_due IS NULL OR r.next_due <= ?) AND e.expires_at IS NULL
+		AND e.archived_at IS NULL AND e.deleted_at IS NULL AND `+visible+`
+		ORDER BY r.next_due IS NULL, r.next_due ASC, e.created_at ASC
+		LIMIT ?
+	`, append(append([]interface{}{time.Now().UTC()}, args...), limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("due reviews: %w", err)
+	}
+	defer rows.Close()
+
+	return s.scanEntries(rows)
+}
+
+// CountDueReviews returns the number of reviewed entries that are due
+// again, among those DueReviews returns
+func (s *Store) CountDueReviews(ctx context.Context) (int, error) {
+	var n int
+	visible, args := s.visibleCondition(ctx, "e.")
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM reviews r
+		JOIN entries e ON e.id = r.entry_id
+		WHERE r.next_due <= ? AND e.expires_at IS NULL
+		AND e.archived_at IS NULL AND e.deleted_at IS NULL AND `+visible,
+		append([]interface{}{time.Now().UTC()}, args...)...,
+	).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("count due reviews: %w", err)
+	}
+	return n, nil
+}
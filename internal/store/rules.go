@@ -0,0 +1,147 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// AddRule stores a new enabled rule
+func (s *Store) AddRule(ctx context.Context, name, condition string, actions []string) (*domain.Rule, error) {
+	r := domain.Rule{
+		ID:        uuid.New().String(),
+		Name:      name,
+		Condition: condition,
+		Actions:   actions,
+		Enabled:   true,
+		CreatedAt: time.Now(),
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO rules (id, name, condition, actions, enabled, created_at) VALUES (?, ?, ?, ?, TRUE, ?)",
+		r.ID, r.Name, r.Condition, strings.Join(r.Actions, "\n"), r.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("insert rule: %w", err)
+	}
+	return &r, nil
+}
+
+// SaveRules stores rules by name, replacing the condition, actions and
+// state of those that exist, and with prune deletes the rules not among
+// them. Rules keep their ID, and so the entries they fired for. It
+// returns how many rules were added, updated and deleted.
+func (s *Store) SaveRules(ctx context.Context, rules []domain.Rule, prune bool) (added, updated, deleted int, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	names := make([]interface{}, 0, len(rules))
+	for _, r := range rules {
+		names = append(names, r.Name)
+		result, err := tx.ExecContext(ctx,
+			"UPDATE rules SET condition = ?, actions = ?, enabled = ? WHERE name = ?",
+			r.Condition, strings.Join(r.Actions, "\n"), r.Enabled, r.Name,
+		)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("update rule: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			updated++
+			continue
+		}
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO rules (id, name, condition, actions, enabled, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+			uuid.New().String(), r.Name, r.Condition, strings.Join(r.Actions, "\n"), r.Enabled, time.Now(),
+		); err != nil {
+			return 0, 0, 0, fmt.Errorf("insert rule: %w", err)
+		}
+		added++
+	}
+
+	if prune {
+		query := "DELETE FROM rules"
+		if len(names) > 0 {
+			query += " WHERE name NOT IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", ") + ")"
+		}
+		result, err := tx.ExecContext(ctx, query, names...)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("delete rules: %w", err)
+		}
+		n, _ := result.RowsAffected()
+		deleted = int(n)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, 0, fmt.Errorf("commit: %w", err)
+	}
+	return added, updated, deleted, nil
+}
+
+// ListRules returns all rules in creation order
+func (s *Store) ListRules(ctx context.Context) ([]domain.Rule, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, name, condition, actions, enabled, created_at FROM rules ORDER BY created_at")
+	if err != nil {
+		return nil, fmt.Errorf("list rules: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []domain.Rule
+	for rows.Next() {
+		var r domain.Rule
+		var actions string
+		if err := rows.Scan(&r.ID, &r.Name, &r.Condition, &actions, &r.Enabled, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan rule: %w", err)
+		}
+		r.Actions = strings.Split(actions, "\n")
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// DeleteRule removes a rule by ID or name
+func (s *Store) DeleteRule(ctx context.Context, ref string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM rules WHERE id = ? OR name = ?", ref, ref)
+	if err != nil {
+		return fmt.Errorf("delete rule: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("rule not found: %s", ref)
+	}
+	return nil
+}
+
+// SetRuleEnabled enables or disables a rule by ID or name
+func (s *Store) SetRuleEnabled(ctx context.Context, ref string, enabled bool) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE rules SET enabled = ? WHERE id = ? OR name = ?", enabled, ref, ref)
+	if err != nil {
+		return fmt.Errorf("update rule: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("rule not found: %s", ref)
+	}
+	return nil
+}
+
+// RecordRuleFiring marks a rule as fired for an entry. It returns false if
+// the rule had already fired for that entry.
+func (s *Store) RecordRuleFiring(ctx context.Context, ruleID, entryID string) (bool, error) {
+	result, err := s.db.ExecContext(ctx,
+		"INSERT INTO rule_firings (rule_id, entry_id, fired_at) VALUES (?, ?, ?) ON CONFLICT DO NOTHING",
+		ruleID, entryID, time.Now(),
+	)
+	if err != nil {
+		return false, fmt.Errorf("record rule firing: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("record rule firing: %w", err)
+	}
+	return n > 0, nil
+}
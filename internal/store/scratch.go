@@ -0,0 +1,60 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// AddScratchEntry creates a note that expires after ttl unless kept
+func (s *Store) AddScratchEntry(ctx context.Context, content string, ttl time.Duration) (*domain.Entry, error) {
+	// Stored in UTC so expiry compares correctly as text
+	expires := time.Now().Add(ttl).UTC()
+	return s.addEntry(ctx, "", content, domain.Source{Type: domain.SourceNote}, &expires)
+}
+
+// ListScratchEntries returns the scratch entries, soonest to expire first
+func (s *Store) ListScratchEntries(ctx context.Context) ([]domain.Entry, error) {
+	ofUser, args := userCondition(ctx, "")
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, content, created_at, last_viewed_at, source_type, source_url, title, author, fetched_at, expires_at, maturity
+		FROM entries
+		WHERE expires_at IS NOT NULL AND deleted_at IS NULL AND `+ofUser+`
+		ORDER BY expires_at
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list scratch entries: %w", err)
+	}
+	defer rows.Close()
+
+	return s.scanEntries(rows)
+}
+
+// KeepEntry makes a scratch entry permanent
+func (s *Store) KeepEntry(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE entries SET expires_at = NULL WHERE id = ? AND expires_at IS NOT NULL", id)
+	if err != nil {
+		return fmt.Errorf("keep entry: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("not a scratch entry")
+	}
+	return nil
+}
+
+// DeleteExpiredEntries moves scratch entries past their expiry to the
+// trash, like DeleteEntry, so they can be restored until purged and the
+// deletion syncs
+func (s *Store) DeleteExpiredEntries(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE entries SET deleted_at = ? WHERE expires_at IS NOT NULL AND expires_at <= ? AND deleted_at IS NULL", now, now,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired entries: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return int(n), nil
+}
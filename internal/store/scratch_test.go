@@ -0,0 +1,77 @@
+package store
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestScratchExpiry(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	expired, err := s.AddScratchEntry(ctx, "expired", -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh, err := s.AddScratchEntry(ctx, "fresh", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The expiry is stored with the entry
+	got, err := s.GetEntry(ctx, fresh.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ExpiresAt == nil || !got.ExpiresAt.Equal(*fresh.ExpiresAt) {
+		t.Fatalf("ExpiresAt = %v, want %v", got.ExpiresAt, fresh.ExpiresAt)
+	}
+	scratch, err := s.ListScratchEntries(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids, want := entryIDs(scratch), []string{expired.ID, fresh.ID}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("scratch entries = %v, want %v", ids, want)
+	}
+
+	_, seq, _, err := s.SyncChanges(ctx, 0, "", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := s.DeleteExpiredEntries(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("DeleteExpiredEntries = %d, %v, want 1", n, err)
+	}
+
+	// Expired entries go to the trash, and the deletion syncs
+	trash, err := s.ListTrash(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := entryIDs(trash); !reflect.DeepEqual(ids, []string{expired.ID}) {
+		t.Fatalf("trash = %v, want [%s]", ids, expired.ID)
+	}
+	changes, _, _, err := s.SyncChanges(ctx, seq, "", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].ID != expired.ID || changes[0].Entry == nil || changes[0].Entry.DeletedAt == nil {
+		t.Fatalf("changes after expiry = %+v, want the expired entry deleted", changes)
+	}
+
+	// Restoring keeps the entry
+	if _, err := s.RestoreEntry(ctx, expired.ID); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.DeleteExpiredEntries(ctx); err != nil || n != 0 {
+		t.Fatalf("DeleteExpiredEntries after restore = %d, %v, want 0", n, err)
+	}
+	got, err = s.GetEntry(ctx, expired.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ExpiresAt != nil || got.DeletedAt != nil {
+		t.Errorf("restored entry expires %v, deleted %v, want neither", got.ExpiresAt, got.DeletedAt)
+	}
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// GetSetting returns a setting value, or "" if unset
+func (s *Store) GetSetting(ctx context.Context, key string) (string, error) {
+	var value string
+	err := s.db.QueryRowContext(ctx, "SELECT value FROM settings WHERE key = ?", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("get setting: %w", err)
+	}
+	return value, nil
+}
+
+// SetSetting stores a setting value
+func (s *Store) SetSetting(ctx context.Context, key, value string) error {
+	_, err := s.db.ExecContext(ctx, "INSERT INTO settings (key, value) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value", key, value)
+	if err != nil {
+		return fmt.Errorf("set setting: %w", err)
+	}
+	return nil
+}
+
+// DeleteSetting removes a setting
+func (s *Store) DeleteSetting(ctx context.Context, key string) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM settings WHERE key = ?", key); err != nil {
+		return fmt.Errorf("delete setting: %w", err)
+	}
+	return nil
+}
+
+// uiSettingsKey is the settings key of the web UI preferences of the user
+// ctx acts as
+func uiSettingsKey(ctx context.Context) string {
+	if id := UserID(ctx); id != "" {
+		return "ui.settings.user." + id
+	}
+	return "ui.settings.owner"
+}
+
+// UISettings returns the web UI preferences of the user ctx acts as, or
+// the defaults if they saved none
+func (s *Store) UISettings(ctx context.Context) (domain.UISettings, error) {
+	settings := domain.DefaultUISettings()
+	value, err := s.GetSetting(ctx, uiSettingsKey(ctx))
+	if err != nil || value == "" {
+		return settings, err
+	}
+	if err := json.Unmarshal([]byte(value), &settings); err != nil {
+		return settings, fmt.Errorf("parse ui settings: %w", err)
+	}
+	return settings, nil
+}
+
+// SaveUISettings stores the web UI preferences of the user ctx acts as
+func (s *Store) SaveUISettings(ctx context.Context, settings domain.UISettings) error {
+	value, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("marshal ui settings: %w", err)
+	}
+	return s.SetSetting(ctx, uiSettingsKey(ctx), string(value))
+}
+
+// captureTemplateKey is the settings key of the capture template
+const captureTemplateKey = "capture.template"
+
+// CaptureTemplate returns the template captured URLs are laid out with,
+// or the default if none was set
+func (s *Store) CaptureTemplate(ctx context.Context) ([]domain.TemplateSection, error) {
+	value, err := s.GetSetting(ctx, captureTemplateKey)
+	if err != nil || value == "" {
+		return domain.DefaultCaptureTemplate, err
+	}
+	var template []domain.TemplateSection
+	if err := json.Unmarshal([]byte(value), &template); err != nil {
+		return nil, fmt.Errorf("parse capture template: %w", err)
+	}
+	return template, nil
+}
+
+// SaveCaptureTemplate sets the capture template; nil restores the default
+func (s *Store) SaveCaptureTemplate(ctx context.Context, template []domain.TemplateSection) error {
+	if template == nil {
+		return s.DeleteSetting(ctx, captureTemplateKey)
+	}
+	if err := domain.CheckCaptureTemplate(template); err != nil {
+		return err
+	}
+	value, err := json.Marshal(template)
+	if err != nil {
+		return fmt.Errorf("marshal capture template: %w", err)
+	}
+	return s.SetSetting(ctx, captureTemplateKey, string(value))
+}
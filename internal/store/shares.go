@@ -0,0 +1,198 @@
+package store
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// ErrShareNotFound is returned when a share doesn't exist, or a link
+// isn't valid anymore
+var ErrShareNotFound = errors.New("share not found")
+
+// shareKeySetting is the setting holding the key share links are signed
+// with
+const shareKeySetting = "share.key"
+
+// ShareEntry creates a read-only link to an entry, valid until expiresAt
+// unless nil
+func (s *Store) ShareEntry(ctx context.Context, entryID string, expiresAt *time.Time) (*domain.Share, error) {
+	ofUser, args := userCondition(ctx, "")
+	var exists bool
+	if err := s.db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM entries WHERE id = ? AND deleted_at IS NULL AND "+ofUser+")",
+		append([]interface{}{entryID}, args...)...,
+	).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("check entry: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrEntryNotFound, entryID)
+	}
+	return s.addShare(ctx, domain.Share{EntryID: entryID, ExpiresAt: expiresAt}, "")
+}
+
+// ShareTag creates a read-only link to the entries of a tag and its
+// sub-tags, those tagged later included
+func (s *Store) ShareTag(ctx context.Context, name string, expiresAt *time.Time) (*domain.Share, error) {
+	tag, err := s.GetTagByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return s.addShare(ctx, domain.Share{Tag: tag.Name, ExpiresAt: expiresAt}, tag.ID)
+}
+
+func (s *Store) addShare(ctx context.Context, share domain.Share, tagID string) (*domain.Share, error) {
+	buf := make([]byte, 9)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("generate share ID: %w", err)
+	}
+	share.ID = base64.RawURLEncoding.EncodeToString(buf)
+	share.UserID = UserID(ctx)
+	share.CreatedAt = time.Now()
+	if share.ExpiresAt != nil {
+		at := share.ExpiresAt.UTC()
+		share.ExpiresAt = &at
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO shares (id, entry_id, tag_id, user_id, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		share.ID, nullString(share.EntryID), nullString(tagID), nullString(share.UserID), share.CreatedAt, share.ExpiresAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("insert share: %w", err)
+	}
+	if share.Token, err = s.signShare(ctx, share.ID); err != nil {
+		return nil, err
+	}
+	return &share, nil
+}
+
+// ListShares returns the shares of the user ctx acts as, expired ones
+// included, latest first
+func (s *Store) ListShares(ctx context.Context) ([]domain.Share, error) {
+	ofUser, args := userCondition(ctx, "sh.")
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT sh.id, COALESCE(sh.entry_id, ''), COALESCE(t.name, ''), COALESCE(sh.user_id, ''), sh.created_at, sh.expires_at
+		FROM shares sh
+		LEFT JOIN tags t ON t.id = sh.tag_id
+		WHERE `+ofUser+`
+		ORDER BY sh.created_at DESC
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list shares: %w", err)
+	}
+	defer rows.Close()
+
+	var shares []domain.Share
+	for rows.Next() {
+		var sh domain.Share
+		if err := rows.Scan(&sh.ID, &sh.EntryID, &sh.Tag, &sh.UserID, &sh.CreatedAt, &sh.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("scan share: %w", err)
+		}
+		shares = append(shares, sh)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range shares {
+		if shares[i].Token, err = s.signShare(ctx, shares[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return shares, nil
+}
+
+// DeleteShare revokes a share's link, by share ID or token
+func (s *Store) DeleteShare(ctx context.Context, ref string) error {
+	id, _, _ := strings.Cut(ref, ".")
+	ofUser, args := userCondition(ctx, "")
+	result, err := s.db.ExecContext(ctx, "DELETE FROM shares WHERE id = ? AND "+ofUser, append([]interface{}{id}, args...)...)
+	if err != nil {
+		return fmt.Errorf("delete share: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %s", ErrShareNotFound, ref)
+	}
+	return nil
+}
+
+// OpenShare returns the share a link token is for, whoever asks: links
+// are public. Tokens with a wrong signature, and expired or deleted
+// shares, are ErrShareNotFound.
+func (s *Store) OpenShare(ctx context.Context, token string) (*domain.Share, error) {
+	id, _, _ := strings.Cut(token, ".")
+	want, err := s.signShare(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(token), []byte(want)) {
+		return nil, ErrShareNotFound
+	}
+
+	sh := domain.Share{ID: id, Token: token}
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(sh.entry_id, ''), COALESCE(t.name, ''), COALESCE(sh.user_id, ''), sh.created_at, sh.expires_at
+		FROM shares sh
+		LEFT JOIN tags t ON t.id = sh.tag_id
+		WHERE sh.id = ?
+	`, id).Scan(&sh.EntryID, &sh.Tag, &sh.UserID, &sh.CreatedAt, &sh.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrShareNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get share: %w", err)
+	}
+	if sh.ExpiresAt != nil && !sh.ExpiresAt.After(time.Now()) {
+		return nil, ErrShareNotFound
+	}
+	return &sh, nil
+}
+
+// signShare returns the link token of a share ID: the ID and its HMAC
+func (s *Store) signShare(ctx context.Context, id string) (string, error) {
+	key, err := s.shareKey(ctx)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id))
+	return id + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16]), nil
+}
+
+// shareKey returns the key share links are signed with, generating it on
+// first use
+func (s *Store) shareKey(ctx context.Context) ([]byte, error) {
+	value, err := s.GetSetting(ctx, shareKeySetting)
+	if err != nil {
+		return nil, err
+	}
+	if value == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("generate share key: %w", err)
+		}
+		// Another process may have just generated one: keep the first
+		if _, err := s.db.ExecContext(ctx,
+			"INSERT INTO settings (key, value) VALUES (?, ?) ON CONFLICT DO NOTHING", shareKeySetting, base64.StdEncoding.EncodeToString(buf),
+		); err != nil {
+			return nil, fmt.Errorf("save share key: %w", err)
+		}
+		if value, err = s.GetSetting(ctx, shareKeySetting); err != nil {
+			return nil, err
+		}
+	}
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("read share key: %w", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestShares(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	alice := addUser(t, s, "alice", false)
+	entry, err := s.AddEntry(alice, "shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the entry's owner can share it
+	if _, err := s.ShareEntry(ctx, entry.ID, nil); !errors.Is(err, ErrEntryNotFound) {
+		t.Fatalf("ShareEntry of another user's entry: %v, want ErrEntryNotFound", err)
+	}
+	share, err := s.ShareEntry(alice, entry.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Minute)
+	expired, err := s.ShareEntry(alice, entry.ID, &past)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Links open for anyone, while valid
+	opened, err := s.OpenShare(ctx, share.Token)
+	if err != nil || opened.EntryID != entry.ID || opened.UserID != UserID(alice) {
+		t.Fatalf("OpenShare = %+v, %v, want alice's share of %s", opened, err, entry.ID)
+	}
+	for name, token := range map[string]string{
+		"expired":         expired.Token,
+		"wrong signature": share.ID + ".AAAA",
+		"unknown":         "nothing",
+	} {
+		if _, err := s.OpenShare(ctx, token); !errors.Is(err, ErrShareNotFound) {
+			t.Errorf("OpenShare of an %s link: %v, want ErrShareNotFound", name, err)
+		}
+	}
+
+	// Shares are listed and deleted by their owner only
+	if shares, err := s.ListShares(ctx); err != nil || len(shares) != 0 {
+		t.Fatalf("owner's shares = %d, %v, want none", len(shares), err)
+	}
+	if shares, err := s.ListShares(alice); err != nil || len(shares) != 2 {
+		t.Fatalf("alice's shares = %d, %v, want 2", len(shares), err)
+	}
+	if err := s.DeleteShare(ctx, share.ID); !errors.Is(err, ErrShareNotFound) {
+		t.Fatalf("DeleteShare of another user's share: %v, want ErrShareNotFound", err)
+	}
+	if err := s.DeleteShare(alice, share.Token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.OpenShare(ctx, share.Token); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("OpenShare of a deleted share: %v, want ErrShareNotFound", err)
+	}
+}
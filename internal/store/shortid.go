@@ -0,0 +1,141 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/bits"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// DefaultShortIDLength is the shortest entry ID prefix shown
+const DefaultShortIDLength = 8
+
+// ErrEntryNotFound is returned when no entry has a given ID or ID prefix
+var ErrEntryNotFound = errors.New("entry not found")
+
+// likeEscaper escapes the wildcards of a LIKE pattern, for ESCAPE '\'
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// maxCandidates is how many matches an AmbiguousIDError lists
+const maxCandidates = 5
+
+// AmbiguousIDError is returned when an ID prefix matches several entries;
+// Candidates lists some of them, abbreviated, out of Count
+type AmbiguousIDError struct {
+	Prefix     string
+	Candidates []string
+	Count      int
+}
+
+func (e *AmbiguousIDError) Error() string {
+	list := strings.Join(e.Candidates, ", ")
+	if e.Count > len(e.Candidates) {
+		list += fmt.Sprintf(" and %d more", e.Count-len(e.Candidates))
+	}
+	return fmt.Sprintf("ambiguous ID %s matches %s", e.Prefix, list)
+}
+
+// ResolveID returns the full ID of the entry whose ID starts with prefix,
+// failing with ErrEntryNotFound or an *AmbiguousIDError
+func (s *Store) ResolveID(ctx context.Context, prefix string) (string, error) {
+	if prefix == "" {
+		return "", ErrEntryNotFound
+	}
+	ofUser, args := userCondition(ctx, "")
+
+	// A full ID is never ambiguous, even if it starts another
+	var id string
+	err := s.db.QueryRowContext(ctx, "SELECT id FROM entries WHERE id = ? AND "+ofUser, append([]interface{}{prefix}, args...)...).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", fmt.Errorf("resolve id: %w", err)
+	}
+
+	args = append([]interface{}{likeEscaper.Replace(prefix)}, args...)
+	var count int
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM entries WHERE id LIKE lower(?) || '%' ESCAPE '\' AND `+ofUser, args...,
+	).Scan(&count); err != nil {
+		return "", fmt.Errorf("resolve id: %w", err)
+	}
+	if count == 0 {
+		return "", ErrEntryNotFound
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id FROM entries WHERE id LIKE lower(?) || '%' ESCAPE '\' AND `+ofUser+` ORDER BY created_at DESC LIMIT ?`, append(args, maxCandidates)...,
+	)
+	if err != nil {
+		return "", fmt.Errorf("resolve id: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return "", fmt.Errorf("scan id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("resolve id: %w", err)
+	}
+	if count == 1 {
+		return ids[0], nil
+	}
+
+	n, err := s.ShortIDLength(ctx)
+	if err != nil {
+		return "", err
+	}
+	for i, id := range ids {
+		ids[i] = domain.ShortID(id, max(n, len(prefix)+1))
+	}
+	return "", &AmbiguousIDError{Prefix: prefix, Candidates: ids, Count: count}
+}
+
+// ShortIDLength returns how many leading characters of entry IDs to show.
+// Like git's abbreviated hashes it grows with the number of entries, so
+// that a collision stays unlikely, starting from KB_ID_LENGTH if set or
+// DefaultShortIDLength, and it is always long enough to tell the current
+// entries apart.
+func (s *Store) ShortIDLength(ctx context.Context) (int, error) {
+	n := DefaultShortIDLength
+	if v := os.Getenv("KB_ID_LENGTH"); v != "" {
+		configured, err := strconv.Atoi(v)
+		if err != nil || configured < 4 {
+			return 0, fmt.Errorf("KB_ID_LENGTH must be a number of at least 4")
+		}
+		n = configured
+	}
+
+	var count int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM entries").Scan(&count); err != nil {
+		return 0, fmt.Errorf("count entries: %w", err)
+	}
+	// As git does: collisions become likely around sqrt(16^n) IDs, so
+	// n needs half the bits of the count, rounded up, in hex digits
+	n = max(n, (bits.Len(uint(count))+2)/2)
+
+	for ; ; n++ {
+		var collision int
+		err := s.db.QueryRowContext(ctx,
+			"SELECT COUNT(*) FROM (SELECT 1 FROM entries GROUP BY substr(id, 1, ?) HAVING COUNT(*) > 1) AS collisions", n,
+		).Scan(&collision)
+		if err != nil {
+			return 0, fmt.Errorf("check id collisions: %w", err)
+		}
+		if collision == 0 {
+			return n, nil
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// addEntryWithID adds an entry and gives it a chosen ID
+func addEntryWithID(t *testing.T, s *Store, ctx context.Context, id string) {
+	t.Helper()
+	e, err := s.AddEntry(ctx, "note "+id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.db.ExecContext(ctx, "UPDATE entries SET id = ? WHERE id = ?", id, e.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolveID(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	for _, id := range []string{"abc", "abcd", "abx", "a_z"} {
+		addEntryWithID(t, s, ctx, id)
+	}
+	alice := addUser(t, s, "alice", false)
+	addEntryWithID(t, s, alice, "bcd")
+
+	tests := []struct {
+		ref       string
+		want      string
+		notFound  bool
+		ambiguous bool
+	}{
+		// A full ID wins over the longer IDs it starts
+		{ref: "abc", want: "abc"},
+		{ref: "abcd", want: "abcd"},
+		{ref: "abx", want: "abx"},
+		{ref: "a_", want: "a_z"},
+		{ref: "ab", ambiguous: true},
+		{ref: "a", ambiguous: true},
+		{ref: "%", notFound: true},
+		{ref: "", notFound: true},
+		{ref: "zz", notFound: true},
+		// Other users' entries aren't found
+		{ref: "bcd", notFound: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			got, err := s.ResolveID(ctx, tt.ref)
+			var ambiguous *AmbiguousIDError
+			switch {
+			case tt.notFound && !errors.Is(err, ErrEntryNotFound):
+				t.Errorf("ResolveID error = %v, want ErrEntryNotFound", err)
+			case tt.ambiguous && !errors.As(err, &ambiguous):
+				t.Errorf("ResolveID error = %v, want ambiguous", err)
+			case got != tt.want:
+				t.Errorf("ResolveID = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
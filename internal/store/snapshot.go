@@ -0,0 +1,88 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+)
+
+// snapshotPrefix starts the names of snapshot files
+const snapshotPrefix = ".snapshot-"
+
+// Snapshot copies the database to a temporary file next to it and opens
+// the copy, for long analytics that shouldn't hold a read transaction on
+// the live database. The copy has the unlocked keys and notebook of this
+// store; closing it removes the file. Postgres databases can't be
+// snapshotted, their reads not holding up writers anyway.
+func (s *Store) Snapshot(ctx context.Context) (*Store, error) {
+	if !s.dialect.snapshots {
+		return nil, fmt.Errorf("snapshot database: not supported on %s", s.dialect.name)
+	}
+	path := filepath.Join(filepath.Dir(s.path), snapshotPrefix+uuid.New().String()+".db")
+	if _, err := s.db.ExecContext(ctx, "VACUUM INTO ?", path); err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("snapshot database: %w", err)
+	}
+
+	opts := DefaultStoreOptions()
+	opts.JournalMode = "OFF"
+	opts.SlowQuery = s.db.slowQuery
+	snap, err := Open(path, opts)
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	snap.temporary = true
+	snap.notebook = s.notebook
+	s.keysMu.RLock()
+	for name, key := range s.keys {
+		snap.keys[name] = key
+	}
+	s.keysMu.RUnlock()
+	return snap, nil
+}
+
+// Backup copies the database to a new file at path. Postgres databases
+// are backed up with pg_dump instead.
+func (s *Store) Backup(ctx context.Context, path string) error {
+	if !s.dialect.snapshots {
+		return fmt.Errorf("backup: not supported on %s, use pg_dump", s.dialect.name)
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("backup: %s already exists", path)
+	}
+	if _, err := s.db.ExecContext(ctx, "VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("backup database: %w", err)
+	}
+	return nil
+}
+
+// RemoveSnapshots deletes the snapshot files next to the database that a
+// process stopped before closing them left behind
+func (s *Store) RemoveSnapshots() error {
+	if !s.dialect.snapshots {
+		return nil
+	}
+	paths, err := filepath.Glob(filepath.Join(filepath.Dir(s.path), snapshotPrefix+"*.db"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("remove snapshot: %w", err)
+		}
+	}
+	return nil
+}
+
+// Size returns the size of the database in bytes
+func (s *Store) Size(ctx context.Context) (int64, error) {
+	var size int64
+	if err := s.db.QueryRowContext(ctx, s.dialect.size).Scan(&size); err != nil {
+		return 0, fmt.Errorf("database size: %w", err)
+	}
+	return size, nil
+}
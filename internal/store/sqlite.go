@@ -1,137 +1,774 @@
 package store
 
 import (
+	"context"
 	"database/sql"
-	_ "embed"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math"
+	"math/rand"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/query"
 )
 
-//go:embed schema.sql
-var schema string
-
 // Store handles database operations
 type Store struct {
-	db *sql.DB
+	db      timedDB
+	dialect dialect
+	// path is the database file, or the connection URL without its
+	// password; dir is where files kept beside the database go
+	path string
+	dir  string
+	// encrypted is set when the database has a key for entry content
+	encrypted bool
+	// notebook is the notebook calls work in by default, "" for none
+	notebook string
+	// temporary is set on snapshots, removed when closed
+	temporary bool
+
+	// keys are the unlocked notebook keys, by notebook
+	keysMu sync.RWMutex
+	keys   map[string][]byte
+
+	// vectors is the index FindSimilar searches, once IndexVectors built
+	// it; rebuildingVectors is set while it's rebuilt
+	vectorsMu         sync.Mutex
+	vectors           *vectorIndex
+	rebuildingVectors bool
+}
+
+// StoreOptions configures the database connection
+type StoreOptions struct {
+	// JournalMode is the SQLite journal mode; WAL lets readers and a
+	// writer (e.g. the server and the CLI) work concurrently
+	JournalMode string
+	// BusyTimeout is how long a connection waits on a locked database
+	// before failing with "database is locked"
+	BusyTimeout time.Duration
+	// ForeignKeys enables foreign key enforcement (and ON DELETE CASCADE)
+	ForeignKeys bool
+	// MaxOpenConns limits open connections (0 means unlimited)
+	MaxOpenConns int
+	// SlowQuery is the duration above which statements are logged with
+	// slog, 0 to log none
+	SlowQuery time.Duration
+	// DataDir is where the files kept beside a Postgres database go
+	// (attachments, the capture journal), ~/.kb if ""; a SQLite
+	// database keeps them in its directory
+	DataDir string
+}
+
+// DefaultStoreOptions returns options suited to concurrent CLI and server use
+func DefaultStoreOptions() StoreOptions {
+	return StoreOptions{
+		JournalMode:  "WAL",
+		BusyTimeout:  5 * time.Second,
+		ForeignKeys:  true,
+		MaxOpenConns: 4,
+	}
 }
 
-// New creates a new Store with the given database path
+// dsn builds the connection string; parameters apply to every pooled connection
+func (o StoreOptions) dsn(dbPath string) string {
+	params := url.Values{}
+	if o.JournalMode != "" {
+		params.Set("_journal_mode", o.JournalMode)
+	}
+	if o.BusyTimeout > 0 {
+		params.Set("_busy_timeout", strconv.FormatInt(o.BusyTimeout.Milliseconds(), 10))
+	}
+	if o.ForeignKeys {
+		params.Set("_foreign_keys", "on")
+	}
+	// Take the write lock up front so read-then-write transactions
+	// wait on busy_timeout instead of failing on lock upgrade
+	params.Set("_txlock", "immediate")
+	return dbPath + "?" + params.Encode()
+}
+
+// New creates a new Store with the given database path and default options
 func New(dbPath string) (*Store, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+	return Open(dbPath, DefaultStoreOptions())
+}
+
+// Open creates a new Store with the given database path, or postgres://
+// URL, and options
+func Open(dbPath string, opts StoreOptions) (*Store, error) {
+	s := &Store{dialect: sqliteDialect, path: dbPath, dir: filepath.Dir(dbPath), keys: make(map[string][]byte)}
+	var db *sql.DB
+	var err error
+	if IsPostgres(dbPath) {
+		s.dialect, s.path, s.dir = postgresDialect, redactURL(dbPath), opts.DataDir
+		if s.dir == "" {
+			home, _ := os.UserHomeDir()
+			s.dir = filepath.Join(home, ".kb")
+		}
+		db, err = openPostgres(dbPath, opts)
+	} else {
+		db, err = sql.Open("sqlite3", opts.dsn(dbPath))
+		if err == nil {
+			db.SetMaxOpenConns(opts.MaxOpenConns)
+		}
+	}
 	if err != nil {
 		return nil, fmt.Errorf("open database: %w", err)
 	}
 
-	// Initialize schema
-	if _, err := db.Exec(schema); err != nil {
+	// Bring schema up to date
+	if err := migrate(db, s.dialect); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("init schema: %w", err)
 	}
 
-	return &Store{db: db}, nil
+	s.db = timedDB{DB: db, slowQuery: opts.SlowQuery}
+	if err := s.loadEncrypted(context.Background()); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Path returns the database file path, or the URL of a Postgres database
+// without its password
+func (s *Store) Path() string {
+	return s.path
 }
 
-// Close closes the database connection
+// Dir returns the directory of the files kept beside the database:
+// attachments, the capture journal
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Backend returns the database the store runs on, BackendSQLite or
+// BackendPostgres
+func (s *Store) Backend() string {
+	return s.dialect.name
+}
+
+// Close closes the database connection, removing the file of a snapshot
 func (s *Store) Close() error {
-	return s.db.Close()
+	err := s.db.Close()
+	if s.temporary {
+		os.Remove(s.path)
+	}
+	return err
+}
+
+// AddEntry creates a new note entry and returns it
+func (s *Store) AddEntry(ctx context.Context, content string) (*domain.Entry, error) {
+	return s.AddEntryWithSource(ctx, content, domain.Source{Type: domain.SourceNote})
+}
+
+// AddEntryWithSource creates a new entry with source metadata, in the
+// notebook ctx works in, and returns it
+func (s *Store) AddEntryWithSource(ctx context.Context, content string, src domain.Source) (*domain.Entry, error) {
+	return s.AddEntryToNotebook(ctx, s.Notebook(ctx), content, src)
+}
+
+// AddEntryToNotebook creates a new entry in a notebook ("" for the one ctx
+// works in), encrypted if the notebook is
+func (s *Store) AddEntryToNotebook(ctx context.Context, notebook, content string, src domain.Source) (*domain.Entry, error) {
+	return s.addEntry(ctx, notebook, content, src, nil)
 }
 
-// AddEntry creates a new entry and returns it
-func (s *Store) AddEntry(content string) (*domain.Entry, error) {
+// addEntry creates an entry, a scratch one expiring at expiresAt unless
+// nil
+func (s *Store) addEntry(ctx context.Context, notebook, content string, src domain.Source, expiresAt *time.Time) (*domain.Entry, error) {
+	if notebook == "" {
+		notebook = s.Notebook(ctx)
+	}
+	stored, err := s.sealContent(ctx, notebook, content)
+	if err != nil {
+		return nil, err
+	}
 	id := uuid.New().String()
 	now := time.Now()
+	if src.Type == "" {
+		src.Type = domain.SourceNote
+	}
 
-	_, err := s.db.Exec(
-		"INSERT INTO entries (id, content, created_at) VALUES (?, ?, ?)",
-		id, content, now,
+	maturity := domain.DefaultMaturity(src.Type)
+	// Articles wait in the reading queue
+	var unreadSince *time.Time
+	if src.Type == domain.SourceURL {
+		unreadSince = &now
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO entries (id, content, created_at, source_type, source_url, canonical_url, title, author, fetched_at, maturity, notebook, user_id, unread_since, expires_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, stored, now, src.Type, src.URL, canonicalURL(src), src.Title, src.Author, src.FetchedAt, maturity, nullString(notebook), nullString(UserID(ctx)), unreadSince, expiresAt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("insert entry: %w", err)
 	}
 
 	return &domain.Entry{
-		ID:        id,
-		Content:   content,
-		CreatedAt: now,
+		ID:          id,
+		Content:     content,
+		Source:      src,
+		CreatedAt:   now,
+		Maturity:    maturity,
+		Notebook:    notebook,
+		UnreadSince: unreadSince,
+		ExpiresAt:   expiresAt,
 	}, nil
 }
 
-// DeleteEntry removes an entry by ID
-func (s *Store) DeleteEntry(id string) error {
-	result, err := s.db.Exec("DELETE FROM entries WHERE id = ?", id)
+// SetEntrySource replaces an entry's source metadata
+func (s *Store) SetEntrySource(ctx context.Context, id string, src domain.Source) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE entries SET source_type = ?, source_url = ?, canonical_url = ?, title = ?, author = ?, fetched_at = ? WHERE id = ?",
+		src.Type, src.URL, canonicalURL(src), src.Title, src.Author, src.FetchedAt, id,
+	)
 	if err != nil {
-		return fmt.Errorf("delete entry: %w", err)
+		return fmt.Errorf("set entry source: %w", err)
 	}
+	return nil
+}
 
-	rows, err := result.RowsAffected()
+// TitleEntry gives an entry a generated title, provided it has none and
+// its content needs one (see domain.NeedsTitle). Encrypted entries are
+// left untitled, as titles are stored in plaintext. It reports whether the
+// title was set.
+func (s *Store) TitleEntry(ctx context.Context, id, title string) (bool, error) {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return false, nil
+	}
+	var stored, current string
+	err := s.db.QueryRowContext(ctx, "SELECT content, COALESCE(title, '') FROM entries WHERE id = ?", id).Scan(&stored, &current)
+	if err == sql.ErrNoRows {
+		return false, ErrEntryNotFound
+	}
 	if err != nil {
-		return fmt.Errorf("check delete result: %w", err)
+		return false, fmt.Errorf("get entry: %w", err)
+	}
+	if current != "" || strings.HasPrefix(stored, encryptedPrefix) || !domain.NeedsTitle(stored) {
+		return false, nil
 	}
-	if rows == 0 {
-		return fmt.Errorf("entry not found")
+	if _, err := s.db.ExecContext(ctx, "UPDATE entries SET title = ? WHERE id = ? AND COALESCE(title, '') = ''", title, id); err != nil {
+		return false, fmt.Errorf("set entry title: %w", err)
 	}
+	return true, nil
+}
 
+// SetEntryCreatedAt backdates an entry, e.g. to when an imported bookmark
+// was saved
+func (s *Store) SetEntryCreatedAt(ctx context.Context, id string, at time.Time) error {
+	if _, err := s.db.ExecContext(ctx, "UPDATE entries SET created_at = ? WHERE id = ?", at, id); err != nil {
+		return fmt.Errorf("set entry created_at: %w", err)
+	}
+	return nil
+}
+
+// ErrRevisionConflict is returned when an entry was edited since the
+// revision an update was based on
+var ErrRevisionConflict = errors.New("entry was modified by someone else")
+
+// UpdateEntry replaces an entry's content and title, provided it is still
+// at the given revision, and returns the updated entry. The replaced
+// content and title are kept as a version.
+func (s *Store) UpdateEntry(ctx context.Context, id, content, title string, revision int) (*domain.Entry, error) {
+	notebook, err := s.entryNotebook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := s.sealContent(ctx, notebook, content)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := saveVersion(ctx, tx, id); err != nil {
+		return nil, err
+	}
+	result, err := tx.ExecContext(ctx,
+		"UPDATE entries SET content = ?, title = ?, revision = revision + 1, updated_at = ? WHERE id = ? AND revision = ?",
+		stored, title, time.Now(), id, revision,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("update entry: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrRevisionConflict
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return s.GetEntry(ctx, id)
+}
+
+// AppendToEntry adds time-stamped text at the end of an entry's content,
+// as a new revision
+func (s *Store) AppendToEntry(ctx context.Context, id, text string) (*domain.Entry, error) {
+	notebook, err := s.entryNotebook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if notebook != "" || s.encrypted {
+		// The content may be encrypted: append to the plaintext
+		entry, err := s.GetEntry(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if entry.Locked && notebook == "" {
+			return nil, ErrDatabaseLocked
+		}
+		if entry.Locked {
+			return nil, fmt.Errorf("%w: %s", ErrNotebookLocked, notebook)
+		}
+		return s.UpdateEntry(ctx, id, entry.Content+domain.AppendedText(text, now), entry.Source.Title, entry.Revision)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := saveVersion(ctx, tx, id); err != nil {
+		return nil, err
+	}
+	result, err := tx.ExecContext(ctx,
+		"UPDATE entries SET content = content || ?, revision = revision + 1, updated_at = ? WHERE id = ?",
+		domain.AppendedText(text, now), now, id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("append to entry: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrEntryNotFound
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return s.GetEntry(ctx, id)
+}
+
+// DeleteEntry moves an entry to the trash, from which it can be restored
+// until purged
+func (s *Store) DeleteEntry(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE entries SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL", time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("delete entry: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return s.stateError(ctx, id)
+	}
 	return nil
 }
 
 // GetEntry retrieves an entry by ID with its tags
-func (s *Store) GetEntry(id string) (*domain.Entry, error) {
+func (s *Store) GetEntry(ctx context.Context, id string) (*domain.Entry, error) {
 	var entry domain.Entry
-	err := s.db.QueryRow(
-		"SELECT id, content, created_at, last_viewed_at FROM entries WHERE id = ?",
-		id,
-	).Scan(&entry.ID, &entry.Content, &entry.CreatedAt, &entry.LastViewedAt)
+	var notebook sql.NullString
+	ofUser, args := userCondition(ctx, "")
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, content, created_at, last_viewed_at, source_type, source_url, title, author, fetched_at, expires_at, maturity, revision, updated_at, notebook, archived_at, deleted_at, pinned_at, unread_since FROM entries WHERE id = ? AND "+ofUser,
+		append([]interface{}{id}, args...)...,
+	).Scan(append(entryFields(&entry), &entry.Revision, &entry.UpdatedAt, &notebook, &entry.ArchivedAt, &entry.DeletedAt, &entry.PinnedAt, &entry.UnreadSince)...)
 	if err != nil {
 		return nil, fmt.Errorf("get entry: %w", err)
 	}
+	entry.Notebook = notebook.String
+	s.openContent(&entry)
 
 	// Get associated tags
-	tags, err := s.GetEntryTags(id)
+	tags, err := s.GetEntryTags(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 	entry.Tags = tags
 
+	attachments, err := s.ListAttachments(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	entry.Attachments = attachments
+
+	occurrences, err := s.ListSourceOccurrences(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	entry.SeenVia = occurrences
+
+	entry.Links, entry.Backlinks, err = s.ListEntryLinks(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	workflows, err := s.EntryWorkflows(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	entry.Workflows = workflows
+
+	entry.Reminder, err = s.GetReminder(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	merged, err := s.ListMergedEntries(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	entry.Merged = merged
+	entry.Sections = domain.ParseSections(entry.Content)
+
 	return &entry, nil
 }
 
-// ListEntries returns recent entries with pagination
-func (s *Store) ListEntries(limit, offset int) ([]domain.Entry, error) {
-	rows, err := s.db.Query(
-		"SELECT id, content, created_at, last_viewed_at FROM entries ORDER BY created_at DESC LIMIT ? OFFSET ?",
-		limit, offset,
-	)
+// MarkViewed records that an entry was just shown to the user
+func (s *Store) MarkViewed(ctx context.Context, id string) error {
+	now := time.Now()
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, fmt.Errorf("list entries: %w", err)
+		return fmt.Errorf("begin: %w", err)
 	}
-	defer rows.Close()
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "UPDATE entries SET last_viewed_at = ? WHERE id = ?", now, id); err != nil {
+		return fmt.Errorf("mark viewed: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO entry_views (entry_id, viewed_at) VALUES (?, ?)", id, now); err != nil {
+		return fmt.Errorf("log view: %w", err)
+	}
+	return tx.Commit()
+}
+
+// entryFields returns scan destinations matching the entry column list:
+// id, content, created_at, last_viewed_at, source_type, source_url, title,
+// author, fetched_at, expires_at, maturity
+func entryFields(e *domain.Entry) []interface{} {
+	return []interface{}{
+		&e.ID, &e.Content, &e.CreatedAt, &e.LastViewedAt,
+		&e.Source.Type, &e.Source.URL, &e.Source.Title, &e.Source.Author, &e.Source.FetchedAt,
+		&e.ExpiresAt, &e.Maturity,
+	}
+}
 
+// scanEntries reads every row of an entry query, decrypting contents
+func (s *Store) scanEntries(rows *sql.Rows) ([]domain.Entry, error) {
 	var entries []domain.Entry
 	for rows.Next() {
 		var e domain.Entry
-		if err := rows.Scan(&e.ID, &e.Content, &e.CreatedAt, &e.LastViewedAt); err != nil {
+		if err := rows.Scan(entryFields(&e)...); err != nil {
 			return nil, fmt.Errorf("scan entry: %w", err)
 		}
+		s.openContent(&e)
 		entries = append(entries, e)
 	}
+	return entries, rows.Err()
+}
+
+// ListEntries returns recent entries of a scope with pagination
+func (s *Store) ListEntries(ctx context.Context, scope string, limit, offset int) ([]domain.Entry, error) {
+	return s.ListEntriesSorted(ctx, domain.ListOptions{Scope: scope, Limit: limit, Offset: offset})
+}
+
+// ListEntriesSorted returns a page of the entries created in a time range,
+// under a tag and matching a search query if opts names them, in the order
+// opts asks for. Ranges and orders by time go through the julianday
+// indexes of migration 0031.
+func (s *Store) ListEntriesSorted(ctx context.Context, opts domain.ListOptions) ([]domain.Entry, error) {
+	inScope, err := scopeCondition(opts.Scope, "")
+	if err != nil {
+		return nil, err
+	}
+	order, err := entryOrder(opts.Sort, opts.Reverse)
+	if err != nil {
+		return nil, err
+	}
+
+	where := []string{inScope}
+	var args []interface{}
+	if opts.Maturity != "" {
+		if !slices.Contains(domain.MaturityLevels, opts.Maturity) {
+			return nil, fmt.Errorf("unknown maturity: %s", opts.Maturity)
+		}
+		where = append(where, "maturity = ?")
+		args = append(args, opts.Maturity)
+	}
+	if opts.Tag != "" {
+		if opts.DirectTag {
+			where = append(where, tagCondition)
+		} else {
+			where = append(where, tagTreeCondition)
+		}
+		args = append(args, s.tagRef(ctx, opts.Tag))
+	}
+	if !opts.Since.IsZero() {
+		where = append(where, "julianday(created_at) >= julianday(?)")
+		args = append(args, opts.Since.UTC())
+	}
+	if !opts.Until.IsZero() {
+		where = append(where, "julianday(created_at) < julianday(?)")
+		args = append(args, opts.Until.UTC())
+	}
+	if opts.Unread != nil {
+		if *opts.Unread {
+			where = append(where, "unread_since IS NOT NULL")
+		} else {
+			where = append(where, "unread_since IS NULL")
+		}
+	}
+	var q *query.Query
+	if opts.Query != "" {
+		if q, err = query.Parse(opts.Query, time.Now()); err != nil {
+			return nil, err
+		}
+		match, matchArgs := q.SQL(s.searchSQL(ctx))
+		where = append(where, match)
+		args = append(args, matchArgs...)
+		if !opts.Scratch {
+			where = append(where, "expires_at IS NULL")
+		}
+	}
+	visible, visibleArgs := s.visibleCondition(ctx, "")
+	where = append(where, visible)
+	args = append(args, visibleArgs...)
 
+	// Encrypted entries only match once decrypted: searches are paged
+	// after
+	page := ""
+	if opts.Limit != 0 && q == nil {
+		page = " LIMIT ? OFFSET ?"
+		args = append(args, opts.Limit, opts.Offset)
+	}
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT id, content, created_at, last_viewed_at, source_type, source_url, title, author, fetched_at, expires_at, maturity FROM entries e WHERE "+strings.Join(where, " AND ")+" ORDER BY "+order+page,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list entries: %w", err)
+	}
+	defer rows.Close()
+
+	if q == nil {
+		return s.scanEntries(rows)
+	}
+	entries, err := s.scanMatches(ctx, rows, q)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Offset >= len(entries) {
+		return nil, nil
+	}
+	entries = entries[opts.Offset:]
+	if opts.Limit > 0 && len(entries) > opts.Limit {
+		entries = entries[:opts.Limit]
+	}
 	return entries, nil
 }
 
+// entryOrder returns the ORDER BY clause of an entry list order
+func entryOrder(by string, reverse bool) (string, error) {
+	desc, nulls := "DESC", "NULLS LAST"
+	if reverse {
+		desc, nulls = "ASC", "NULLS FIRST"
+	}
+	switch by {
+	case "", domain.SortCreated:
+		return "julianday(created_at) " + desc, nil
+	case domain.SortViewed:
+		return "julianday(last_viewed_at) " + desc + " " + nulls + ", julianday(created_at) " + desc, nil
+	case domain.SortRandom:
+		return "RANDOM()", nil
+	}
+	return "", fmt.Errorf("unknown sort %q (use %s)", by, strings.Join(domain.EntrySorts, ", "))
+}
 
-// GetOrCreateTag finds a tag by name or creates it
-func (s *Store) GetOrCreateTag(name string, parentID *string) (*domain.Tag, error) {
+// ListEntriesSince returns entries created at or after the given time,
+// newest first, leaving out the trash and other users' entries
+func (s *Store) ListEntriesSince(ctx context.Context, since time.Time) ([]domain.Entry, error) {
+	ofUser, args := userCondition(ctx, "")
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT id, content, created_at, last_viewed_at, source_type, source_url, title, author, fetched_at, expires_at, maturity FROM entries WHERE julianday(created_at) >= julianday(?) AND deleted_at IS NULL AND "+ofUser+" ORDER BY created_at DESC",
+		append([]interface{}{since.UTC()}, args...)...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list entries since: %w", err)
+	}
+	defer rows.Close()
+
+	return s.scanEntries(rows)
+}
+
+// EntryChangesSince returns the active entries of the notebook ctx works
+// in that were created or changed at or after a time, newest first, and
+// the IDs of those since archived, trashed, purged or moved out of it.
+// Changes are read from the sync log (migration 0021): views don't count,
+// tags and links do.
+func (s *Store) EntryChangesSince(ctx context.Context, since time.Time) ([]domain.Entry, []string, error) {
+	inScope, err := scopeCondition(domain.ScopeActive, "e.")
+	if err != nil {
+		return nil, nil, err
+	}
+	visible, visibleArgs := s.visibleCondition(ctx, "e.")
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT e.id, e.content, e.created_at, e.last_viewed_at, e.source_type, e.source_url, e.title, e.author, e.fetched_at, e.expires_at, e.maturity
+		FROM entries e
+		JOIN sync_changes c ON c.kind = 'entry' AND c.entry_id = e.id
+		WHERE julianday(c.changed_at) >= julianday(?) AND `+inScope+` AND `+visible+`
+		ORDER BY e.created_at DESC
+	`, append([]interface{}{since.UTC()}, visibleArgs...)...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list changed entries: %w", err)
+	}
+	changed, err := s.scanEntries(rows)
+	rows.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Purged entries leave a tombstone only; other users' entries are
+	// left out
+	ofUser, userArgs := userCondition(ctx, "e.")
+	args := append([]interface{}{since.UTC()}, userArgs...)
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT c.entry_id
+		FROM sync_changes c
+		LEFT JOIN entries e ON e.id = c.entry_id
+		WHERE c.kind = 'entry' AND julianday(c.changed_at) >= julianday(?)
+		AND (e.id IS NULL OR (`+ofUser+` AND NOT (`+inScope+` AND `+visible+`)))
+	`, append(args, visibleArgs...)...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list removed entries: %w", err)
+	}
+	defer rows.Close()
+	var removed []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, nil, fmt.Errorf("scan removed entry: %w", err)
+		}
+		removed = append(removed, id)
+	}
+	return changed, removed, rows.Err()
+}
+
+// RandomEntry returns an active entry, with its tags, picked at random from
+// the notebook ctx works in, under a tag or its descendants unless tag is
+// empty, or nil when there is none. With byStaleness, entries are picked
+// in proportion to the days they've gone unseen, since they were last
+// viewed or created.
+func (s *Store) RandomEntry(ctx context.Context, tag string, byStaleness bool) (*domain.Entry, error) {
+	inScope, err := scopeCondition(domain.ScopeActive, "e.")
+	if err != nil {
+		return nil, err
+	}
+	where := inScope
+	var args []interface{}
+	if tag != "" {
+		where += " AND " + tagTreeCondition
+		args = append(args, s.tagRef(ctx, tag))
+	}
+	visible, visibleArgs := s.visibleCondition(ctx, "e.")
+	where += " AND " + visible
+	args = append(args, visibleArgs...)
+
+	if byStaleness {
+		return s.stalestRandomEntry(ctx, where, args)
+	}
+
+	var id string
+	err = s.db.QueryRowContext(ctx, "SELECT e.id FROM entries e WHERE "+where+" ORDER BY RANDOM() LIMIT 1", args...).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("random entry: %w", err)
+	}
+	return s.GetEntry(ctx, id)
+}
+
+// stalestRandomEntry picks one of the entries matching a condition, each
+// weighing a day more than the days since it was last seen
+func (s *Store) stalestRandomEntry(ctx context.Context, where string, args []interface{}) (*domain.Entry, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT e.id, julianday(?) - julianday(COALESCE(e.last_viewed_at, e.created_at))
+		FROM entries e
+		WHERE `+where,
+		append([]interface{}{time.Now().UTC()}, args...)...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("random entry: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	var weights []float64
+	total := 0.0
+	for rows.Next() {
+		var id string
+		var days float64
+		if err := rows.Scan(&id, &days); err != nil {
+			return nil, fmt.Errorf("scan entry: %w", err)
+		}
+		ids = append(ids, id)
+		weights = append(weights, max(days, 0)+1)
+		total += max(days, 0) + 1
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	pick := rand.Float64() * total
+	for i, w := range weights {
+		if pick -= w; pick < 0 || i == len(ids)-1 {
+			return s.GetEntry(ctx, ids[i])
+		}
+	}
+	return nil, nil
+}
+
+// GetTagByName finds a tag by name, alias or path (see ResolveTagPath)
+func (s *Store) GetTagByName(ctx context.Context, name string) (*domain.Tag, error) {
+	tag, err := s.tagNamedExactly(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if tag == nil && strings.Contains(name, "/") {
+		return s.ResolveTagPath(ctx, name)
+	}
+	if tag == nil {
+		return nil, fmt.Errorf("tag not found: %s", name)
+	}
+	return tag, nil
+}
+
+// GetOrCreateTag finds a tag by name, alias or path, or creates it with
+// the name normalized (see domain.NormalizeTagName)
+func (s *Store) GetOrCreateTag(ctx context.Context, name string, parentID *string) (*domain.Tag, error) {
 	// Try to find existing tag
 	var tag domain.Tag
-	err := s.db.QueryRow(
-		"SELECT id, name, parent_id, created_at FROM tags WHERE name = ?",
-		name,
-	).Scan(&tag.ID, &tag.Name, &tag.ParentID, &tag.CreatedAt)
+	query, args := tagNamed(ctx, name)
+	err := s.db.QueryRowContext(ctx, query, args...).Scan(&tag.ID, &tag.Name, &tag.ParentID, &tag.Description, &tag.Color, &tag.CreatedAt)
 
 	if err == nil {
 		return &tag, nil
@@ -139,14 +776,22 @@ func (s *Store) GetOrCreateTag(name string, parentID *string) (*domain.Tag, erro
 	if err != sql.ErrNoRows {
 		return nil, fmt.Errorf("find tag: %w", err)
 	}
+	if strings.Contains(name, "/") {
+		if tag, err := s.ResolveTagPath(ctx, name); err == nil {
+			return tag, nil
+		}
+	}
 
 	// Create new tag
 	id := uuid.New().String()
 	now := time.Now()
+	if normalized := domain.NormalizeTagName(name); normalized != "" {
+		name = normalized
+	}
 
-	_, err = s.db.Exec(
-		"INSERT INTO tags (id, name, parent_id, created_at) VALUES (?, ?, ?, ?)",
-		id, name, parentID, now,
+	_, err = s.db.ExecContext(ctx,
+		"INSERT INTO tags (id, name, parent_id, created_at, user_id) VALUES (?, ?, ?, ?, ?)",
+		id, name, parentID, now, nullString(UserID(ctx)),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("insert tag: %w", err)
@@ -160,10 +805,93 @@ func (s *Store) GetOrCreateTag(name string, parentID *string) (*domain.Tag, erro
 	}, nil
 }
 
+// tagColor matches the colors a tag can have
+var tagColor = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// SetTagDetails changes the description and the color of a tag, leaving
+// those given nil unchanged; an empty color removes it
+func (s *Store) SetTagDetails(ctx context.Context, name string, description, color *string) (*domain.Tag, error) {
+	tag, err := s.GetTagByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if description != nil {
+		tag.Description = strings.TrimSpace(*description)
+	}
+	if color != nil {
+		tag.Color = strings.ToLower(strings.TrimSpace(*color))
+		if tag.Color != "" && !tagColor.MatchString(tag.Color) {
+			return nil, fmt.Errorf("invalid color %q (use #rrggbb or #rgb)", *color)
+		}
+	}
+
+	if _, err := s.db.ExecContext(ctx,
+		"UPDATE tags SET description = ?, color = ? WHERE id = ?",
+		tag.Description, tag.Color, tag.ID,
+	); err != nil {
+		return nil, fmt.Errorf("update tag: %w", err)
+	}
+	return tag, nil
+}
+
+// SetTagParent moves a tag under another, or to the top of the hierarchy
+// when parent is ""
+func (s *Store) SetTagParent(ctx context.Context, name, parent string) (*domain.Tag, error) {
+	tag, err := s.GetTagByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	tag.ParentID = nil
+	if parent != "" {
+		p, err := s.GetTagByName(ctx, parent)
+		if err != nil {
+			return nil, err
+		}
+		if under, err := tagUnder(ctx, s.db, p.ID, tag.ID); err != nil {
+			return nil, err
+		} else if under {
+			return nil, fmt.Errorf("%w: %s is under %s", ErrTagCycle, p.Name, tag.Name)
+		}
+		tag.ParentID = &p.ID
+	}
+
+	if _, err := s.db.ExecContext(ctx, "UPDATE tags SET parent_id = ? WHERE id = ?", tag.ParentID, tag.ID); err != nil {
+		return nil, fmt.Errorf("set tag parent: %w", err)
+	}
+	return tag, nil
+}
+
+// ErrTagCycle is returned when moving a tag under itself or one of its
+// descendants
+var ErrTagCycle = errors.New("tag parents would go round")
+
+// rowQuerier runs a query on the database or in a transaction
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// tagUnder reports whether tag tagID is ancestorID or one of its
+// descendants, following parent links up; links already going round are
+// followed once
+func tagUnder(ctx context.Context, db rowQuerier, tagID, ancestorID string) (bool, error) {
+	var n int
+	err := db.QueryRowContext(ctx, `
+		WITH RECURSIVE up(id) AS (
+			SELECT ?
+			UNION
+			SELECT t.parent_id FROM tags t JOIN up ON t.id = up.id WHERE t.parent_id IS NOT NULL
+		)
+		SELECT COUNT(*) FROM up WHERE id = ?`, tagID, ancestorID).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("check tag parents: %w", err)
+	}
+	return n > 0, nil
+}
+
 // LinkEntryTag associates a tag with an entry
-func (s *Store) LinkEntryTag(entryID, tagID string, confidence float64) error {
-	_, err := s.db.Exec(
-		"INSERT OR REPLACE INTO entry_tags (entry_id, tag_id, confidence) VALUES (?, ?, ?)",
+func (s *Store) LinkEntryTag(ctx context.Context, entryID, tagID string, confidence float64) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO entry_tags (entry_id, tag_id, confidence, origin) VALUES (?, ?, ?, 'auto') ON CONFLICT (entry_id, tag_id) DO UPDATE SET confidence = excluded.confidence, origin = excluded.origin",
 		entryID, tagID, confidence,
 	)
 	if err != nil {
@@ -172,14 +900,54 @@ func (s *Store) LinkEntryTag(entryID, tagID string, confidence float64) error {
 	return nil
 }
 
-// GetEntryTags returns all tags for an entry
-func (s *Store) GetEntryTags(entryID string) ([]domain.Tag, error) {
-	rows, err := s.db.Query(`
-		SELECT t.id, t.name, t.parent_id, t.created_at
+// TagCounts returns the number of entries linked to each tag, by name
+func (s *Store) TagCounts(ctx context.Context) (map[string]int, error) {
+	ofUser, args := userCondition(ctx, "t.")
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT t.name, COUNT(et.entry_id)
+		FROM tags t
+		LEFT JOIN entry_tags et ON t.id = et.tag_id
+		WHERE `+ofUser+`
+		GROUP BY t.id
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("tag counts: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var name string
+		var n int
+		if err := rows.Scan(&name, &n); err != nil {
+			return nil, fmt.Errorf("scan tag count: %w", err)
+		}
+		counts[name] = n
+	}
+	return counts, nil
+}
+
+// GetEntryTags returns all tags for an entry, with their paths
+func (s *Store) GetEntryTags(ctx context.Context, entryID string) ([]domain.Tag, error) {
+	// up climbs from each tag to its root, prefixing the path with the
+	// names met; tags whose parents go round keep their name
+	rows, err := s.db.QueryContext(ctx, `
+		WITH RECURSIVE up(tag_id, parent_id, path, depth) AS (
+			SELECT t.id, t.parent_id, t.name, 0
+			FROM tags t JOIN entry_tags et ON t.id = et.tag_id
+			WHERE et.entry_id = ?
+			UNION ALL
+			SELECT up.tag_id, p.parent_id, p.name || '/' || up.path, up.depth + 1
+			FROM up JOIN tags p ON p.id = up.parent_id
+			WHERE up.depth < ?
+		)
+		SELECT t.id, t.name, t.parent_id, t.description, t.color, t.created_at, COALESCE(MAX(up.path), t.name)
 		FROM tags t
 		JOIN entry_tags et ON t.id = et.tag_id
+		LEFT JOIN up ON up.tag_id = t.id AND up.parent_id IS NULL
 		WHERE et.entry_id = ?
-	`, entryID)
+		GROUP BY t.id, t.name, t.parent_id, t.description, t.color, t.created_at
+	`, entryID, domain.MaxTagDepth, entryID)
 	if err != nil {
 		return nil, fmt.Errorf("get entry tags: %w", err)
 	}
@@ -188,7 +956,7 @@ func (s *Store) GetEntryTags(entryID string) ([]domain.Tag, error) {
 	var tags []domain.Tag
 	for rows.Next() {
 		var t domain.Tag
-		if err := rows.Scan(&t.ID, &t.Name, &t.ParentID, &t.CreatedAt); err != nil {
+		if err := rows.Scan(&t.ID, &t.Name, &t.ParentID, &t.Description, &t.Color, &t.CreatedAt, &t.Path); err != nil {
 			return nil, fmt.Errorf("scan tag: %w", err)
 		}
 		tags = append(tags, t)
@@ -197,10 +965,12 @@ func (s *Store) GetEntryTags(entryID string) ([]domain.Tag, error) {
 	return tags, nil
 }
 
-// ListTags returns all tags
-func (s *Store) ListTags() ([]domain.Tag, error) {
-	rows, err := s.db.Query(
-		"SELECT id, name, parent_id, created_at FROM tags ORDER BY name",
+// ListTags returns all tags of the user ctx acts as
+func (s *Store) ListTags(ctx context.Context) ([]domain.Tag, error) {
+	ofUser, args := userCondition(ctx, "")
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT id, name, parent_id, description, color, created_at FROM tags WHERE "+ofUser+" ORDER BY name",
+		args...,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("list tags: %w", err)
@@ -210,7 +980,7 @@ func (s *Store) ListTags() ([]domain.Tag, error) {
 	var tags []domain.Tag
 	for rows.Next() {
 		var t domain.Tag
-		if err := rows.Scan(&t.ID, &t.Name, &t.ParentID, &t.CreatedAt); err != nil {
+		if err := rows.Scan(&t.ID, &t.Name, &t.ParentID, &t.Description, &t.Color, &t.CreatedAt); err != nil {
 			return nil, fmt.Errorf("scan tag: %w", err)
 		}
 		tags = append(tags, t)
@@ -219,131 +989,158 @@ func (s *Store) ListTags() ([]domain.Tag, error) {
 	return tags, nil
 }
 
-// GetEntriesByTag returns entries with a specific tag (including child tags)
-func (s *Store) GetEntriesByTag(tagID string, includeChildren bool) ([]domain.Entry, error) {
+// GetEntriesByTag returns active entries with a specific tag, by id, name,
+// alias or path (including child tags)
+func (s *Store) GetEntriesByTag(ctx context.Context, tagID string, includeChildren bool) ([]domain.Entry, error) {
+	tagID = s.tagRef(ctx, tagID)
+	visible, args := s.visibleCondition(ctx, "e.")
 	var query string
 	if includeChildren {
 		// Recursive CTE to get tag and all descendants
 		query = `
 			WITH RECURSIVE tag_tree AS (
-				SELECT id FROM tags WHERE id = ? OR name = ?
-				UNION ALL
+				SELECT t.id FROM tags t LEFT JOIN tag_aliases a ON a.tag_id = t.id WHERE t.id = ? OR ? IN (t.name, a.alias)
+				UNION
 				SELECT t.id FROM tags t JOIN tag_tree tt ON t.parent_id = tt.id
 			)
-			SELECT DISTINCT e.id, e.content, e.created_at, e.last_viewed_at
+			SELECT DISTINCT e.id, e.content, e.created_at, e.last_viewed_at,
+		       e.source_type, e.source_url, e.title, e.author, e.fetched_at, e.expires_at, e.maturity
 			FROM entries e
 			JOIN entry_tags et ON e.id = et.entry_id
 			JOIN tag_tree tt ON et.tag_id = tt.id
+			WHERE e.archived_at IS NULL AND e.deleted_at IS NULL AND ` + visible + `
 			ORDER BY e.created_at DESC
 		`
 	} else {
 		query = `
-			SELECT e.id, e.content, e.created_at, e.last_viewed_at
+			SELECT e.id, e.content, e.created_at, e.last_viewed_at,
+		       e.source_type, e.source_url, e.title, e.author, e.fetched_at, e.expires_at, e.maturity
 			FROM entries e
 			JOIN entry_tags et ON e.id = et.entry_id
-			WHERE et.tag_id = ? OR et.tag_id IN (SELECT id FROM tags WHERE name = ?)
+			WHERE (et.tag_id = ? OR et.tag_id IN (SELECT t.id FROM tags t LEFT JOIN tag_aliases a ON a.tag_id = t.id WHERE ? IN (t.name, a.alias)))
+			AND e.archived_at IS NULL AND e.deleted_at IS NULL AND ` + visible + `
 			ORDER BY e.created_at DESC
 		`
 	}
 
-	rows, err := s.db.Query(query, tagID, tagID)
+	rows, err := s.db.QueryContext(ctx, query, append([]interface{}{tagID, tagID}, args...)...)
 	if err != nil {
 		return nil, fmt.Errorf("get entries by tag: %w", err)
 	}
 	defer rows.Close()
 
-	var entries []domain.Entry
-	for rows.Next() {
-		var e domain.Entry
-		if err := rows.Scan(&e.ID, &e.Content, &e.CreatedAt, &e.LastViewedAt); err != nil {
-			return nil, fmt.Errorf("scan entry: %w", err)
-		}
-		entries = append(entries, e)
-	}
-	return entries, nil
+	return s.scanEntries(rows)
 }
 
 // FindSimilarByTags finds entries sharing tags with the given entry, excluding the entry itself
-func (s *Store) FindSimilarByTags(entryID string, limit int) ([]domain.Entry, error) {
-	rows, err := s.db.Query(`
-		SELECT DISTINCT e.id, e.content, e.created_at, e.last_viewed_at
+func (s *Store) FindSimilarByTags(ctx context.Context, entryID string, limit int) ([]domain.Entry, error) {
+	visible, args := s.visibleCondition(ctx, "e.")
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT DISTINCT e.id, e.content, e.created_at, e.last_viewed_at,
+		       e.source_type, e.source_url, e.title, e.author, e.fetched_at, e.expires_at, e.maturity
 		FROM entries e
 		JOIN entry_tags et ON e.id = et.entry_id
 		WHERE et.tag_id IN (
 			SELECT tag_id FROM entry_tags WHERE entry_id = ?
 		)
-		AND e.id != ?
+		AND e.id != ? AND e.expires_at IS NULL AND e.deleted_at IS NULL AND `+visible+`
 		ORDER BY e.last_viewed_at ASC NULLS FIRST, e.created_at DESC
 		LIMIT ?
-	`, entryID, entryID, limit)
+	`, append(append([]interface{}{entryID, entryID}, args...), limit)...)
 	if err != nil {
 		return nil, fmt.Errorf("find similar: %w", err)
 	}
 	defer rows.Close()
 
-	var entries []domain.Entry
-	for rows.Next() {
-		var e domain.Entry
-		if err := rows.Scan(&e.ID, &e.Content, &e.CreatedAt, &e.LastViewedAt); err != nil {
-			return nil, fmt.Errorf("scan entry: %w", err)
-		}
-		entries = append(entries, e)
-	}
-	return entries, nil
+	return s.scanEntries(rows)
 }
 
-// GetSuggestions returns entries the user hasn't viewed recently
-func (s *Store) GetSuggestions(limit int) ([]domain.Entry, error) {
-	rows, err := s.db.Query(`
-		SELECT id, content, created_at, last_viewed_at
+// GetSuggestions returns entries the user hasn't viewed recently, leaving
+// out scratch, archived and deleted entries
+func (s *Store) GetSuggestions(ctx context.Context, limit int) ([]domain.Entry, error) {
+	visible, args := s.visibleCondition(ctx, "")
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, content, created_at, last_viewed_at, source_type, source_url, title, author, fetched_at, expires_at, maturity
 		FROM entries
+		WHERE expires_at IS NULL AND archived_at IS NULL AND deleted_at IS NULL AND `+visible+`
 		ORDER BY last_viewed_at ASC NULLS FIRST, created_at DESC
 		LIMIT ?
-	`, limit)
+	`, append(args, limit)...)
 	if err != nil {
 		return nil, fmt.Errorf("get suggestions: %w", err)
 	}
 	defer rows.Close()
 
-	var entries []domain.Entry
-	for rows.Next() {
-		var e domain.Entry
-		if err := rows.Scan(&e.ID, &e.Content, &e.CreatedAt, &e.LastViewedAt); err != nil {
-			return nil, fmt.Errorf("scan entry: %w", err)
-		}
-		entries = append(entries, e)
-	}
-	return entries, nil
+	return s.scanEntries(rows)
 }
 
-// SearchEntries performs a simple text search
-func (s *Store) SearchEntries(query string) ([]domain.Entry, error) {
-	rows, err := s.db.Query(
-		"SELECT id, content, created_at, last_viewed_at FROM entries WHERE content LIKE ? ORDER BY created_at DESC",
-		"%"+query+"%",
-	)
-	if err != nil {
-		return nil, fmt.Errorf("search entries: %w", err)
+// SearchEntries returns the entries of a scope matching a query (see
+// package query), newest first; words are matched by full-text search on
+// Postgres. Scratch entries only match when includeScratch is set.
+// Encrypted entries are matched once decrypted, if their key is unlocked.
+func (s *Store) SearchEntries(ctx context.Context, input, scope string, includeScratch bool) ([]domain.Entry, error) {
+	return s.ListEntriesSorted(ctx, domain.ListOptions{Query: input, Scope: scope, Scratch: includeScratch})
+}
+
+// searchSQL renders the terms of a search query as conditions on entries
+// e. Encrypted content is left for scanMatches to match once decrypted.
+func (s *Store) searchSQL(ctx context.Context) query.SQLOptions {
+	return query.SQLOptions{
+		Text: func(text string) (string, []interface{}) {
+			return s.dialect.textMatch("e.", text, true)
+		},
+		Tag: func(ref string) (string, []interface{}) {
+			return tagTreeCondition, []interface{}{s.tagRef(ctx, ref)}
+		},
+		Opaque:     "e.content LIKE ?",
+		OpaqueArgs: []interface{}{encryptedPrefix + "%"},
 	}
-	defer rows.Close()
+}
 
+// scanMatches scans the entries a search query selected, keeping the
+// encrypted ones only if they match once decrypted
+func (s *Store) scanMatches(ctx context.Context, rows *sql.Rows, q *query.Query) ([]domain.Entry, error) {
 	var entries []domain.Entry
+	var encrypted []bool
 	for rows.Next() {
 		var e domain.Entry
-		if err := rows.Scan(&e.ID, &e.Content, &e.CreatedAt, &e.LastViewedAt); err != nil {
+		if err := rows.Scan(entryFields(&e)...); err != nil {
 			return nil, fmt.Errorf("scan entry: %w", err)
 		}
+		encrypted = append(encrypted, strings.HasPrefix(e.Content, encryptedPrefix))
+		s.openContent(&e)
 		entries = append(entries, e)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("search entries: %w", err)
+	}
+	rows.Close()
 
-	return entries, nil
+	matched := entries[:0]
+	for i, e := range entries {
+		if encrypted[i] {
+			if e.Locked {
+				continue
+			}
+			var err error
+			if e.Tags, err = s.GetEntryTags(ctx, e.ID); err != nil {
+				return nil, err
+			}
+			if !q.Match(&e) {
+				continue
+			}
+			e.Tags = nil
+		}
+		matched = append(matched, e)
+	}
+	return matched, nil
 }
 
 // SaveEmbedding stores an embedding vector for an entry
-func (s *Store) SaveEmbedding(entryID string, vector []float64, model string) error {
+func (s *Store) SaveEmbedding(ctx context.Context, entryID string, vector []float64, model string) error {
 	blob := vectorToBlob(vector)
-	_, err := s.db.Exec(
-		"INSERT OR REPLACE INTO embeddings (entry_id, vector, model, created_at) VALUES (?, ?, ?, ?)",
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO embeddings (entry_id, vector, model, created_at) VALUES (?, ?, ?, ?) ON CONFLICT (entry_id) DO UPDATE SET vector = excluded.vector, model = excluded.model, created_at = excluded.created_at",
 		entryID, blob, model, time.Now(),
 	)
 	if err != nil {
@@ -352,20 +1149,113 @@ func (s *Store) SaveEmbedding(entryID string, vector []float64, model string) er
 	return nil
 }
 
+// GetEmbedding returns an entry's stored embedding, or nil if it has none
+func (s *Store) GetEmbedding(ctx context.Context, entryID string) ([]float64, error) {
+	var blob []byte
+	err := s.db.QueryRowContext(ctx, "SELECT vector FROM embeddings WHERE entry_id = ?", entryID).Scan(&blob)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get embedding: %w", err)
+	}
+	return blobToVector(blob), nil
+}
+
+// ListEntriesWithoutEmbedding returns all entries that have no embedding
+// yet, leaving out the trash
+func (s *Store) ListEntriesWithoutEmbedding(ctx context.Context) ([]domain.Entry, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT e.id, e.content, e.created_at, e.last_viewed_at,
+		       e.source_type, e.source_url, e.title, e.author, e.fetched_at, e.expires_at, e.maturity
+		FROM entries e
+		LEFT JOIN embeddings em ON e.id = em.entry_id
+		WHERE em.entry_id IS NULL AND e.deleted_at IS NULL
+		ORDER BY e.created_at ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("list entries without embedding: %w", err)
+	}
+	defer rows.Close()
+
+	return s.scanEntries(rows)
+}
+
 // SimilarEntry represents an entry with a similarity score
 type SimilarEntry struct {
 	Entry      domain.Entry `json:"entry"`
 	Similarity float64      `json:"similarity"`
+	// Snippet is the passage of a long entry that matched best, when it
+	// matched better than the entry as a whole
+	Snippet string `json:"snippet,omitempty"`
+}
+
+// FindSimilar returns entries most similar to the given vector. Long
+// entries rank by their closest passage when it is closer than the
+// whole entry.
+func (s *Store) FindSimilar(ctx context.Context, vector []float64, limit int, excludeID string) ([]SimilarEntry, error) {
+	x, err := s.vectorIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Past a share of the index, comparing the vector to every embedding
+	// costs less than searching it
+	for k := max(4*limit, 50); x != nil && k <= x.entries.Len()/2; k *= 4 {
+		similarity, chunks, more := x.search(vector, k)
+		ids := make([]string, 0, len(similarity)+len(chunks))
+		for id := range similarity {
+			ids = append(ids, id)
+		}
+		for id := range chunks {
+			if _, ok := similarity[id]; !ok {
+				ids = append(ids, id)
+			}
+		}
+
+		var results []SimilarEntry
+		for len(ids) > 0 {
+			batch := ids[:min(len(ids), 500)]
+			ids = ids[len(batch):]
+			args := make([]interface{}, len(batch))
+			for i, id := range batch {
+				args[i] = id
+			}
+			found, err := s.similarEntries(ctx, vector, excludeID, chunks,
+				"e.id IN ("+strings.TrimSuffix(strings.Repeat("?, ", len(batch)), ", ")+")", args...)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, found...)
+		}
+		// The entries nearest may not be visible here: look further
+		if len(results) >= limit || !more {
+			return topSimilar(results, limit), nil
+		}
+	}
+
+	chunks, err := s.bestChunks(ctx, vector)
+	if err != nil {
+		return nil, err
+	}
+	results, err := s.similarEntries(ctx, vector, excludeID, chunks, "TRUE")
+	if err != nil {
+		return nil, err
+	}
+	return topSimilar(results, limit), nil
 }
 
-// FindSimilar returns entries most similar to the given vector
-func (s *Store) FindSimilar(vector []float64, limit int, excludeID string) ([]SimilarEntry, error) {
-	rows, err := s.db.Query(`
-		SELECT e.id, e.content, e.created_at, em.vector
+// similarEntries returns the entries with an embedding matching cond, with
+// their similarity to vector: that of their embedding, or of their passage
+// in chunks when closer
+func (s *Store) similarEntries(ctx context.Context, vector []float64, excludeID string, chunks map[string]chunkMatch, cond string, condArgs ...interface{}) ([]SimilarEntry, error) {
+	visible, args := s.visibleCondition(ctx, "e.")
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT e.id, e.content, e.created_at, e.last_viewed_at,
+		       e.source_type, e.source_url, e.title, e.author, e.fetched_at, e.expires_at, e.maturity, em.vector
 		FROM entries e
 		JOIN embeddings em ON e.id = em.entry_id
-		WHERE e.id != ?
-	`, excludeID)
+		WHERE e.id != ? AND e.expires_at IS NULL AND e.deleted_at IS NULL AND `+cond+` AND `+visible+`
+	`, append(append([]interface{}{excludeID}, condArgs...), args...)...)
 	if err != nil {
 		return nil, fmt.Errorf("find similar: %w", err)
 	}
@@ -375,30 +1265,30 @@ func (s *Store) FindSimilar(vector []float64, limit int, excludeID string) ([]Si
 	for rows.Next() {
 		var e domain.Entry
 		var blob []byte
-		if err := rows.Scan(&e.ID, &e.Content, &e.CreatedAt, &blob); err != nil {
+		if err := rows.Scan(append(entryFields(&e), &blob)...); err != nil {
 			return nil, fmt.Errorf("scan similar: %w", err)
 		}
+		s.openContent(&e)
 
 		storedVec := blobToVector(blob)
-		sim := cosineSimilarity(vector, storedVec)
-
-		results = append(results, SimilarEntry{Entry: e, Similarity: sim})
-	}
-
-	// Sort by similarity descending
-	for i := 0; i < len(results)-1; i++ {
-		for j := i + 1; j < len(results); j++ {
-			if results[j].Similarity > results[i].Similarity {
-				results[i], results[j] = results[j], results[i]
+		result := SimilarEntry{Entry: e, Similarity: cosineSimilarity(vector, storedVec)}
+		if m, ok := chunks[e.ID]; ok && m.similarity > result.Similarity {
+			if snippet := passage(e.Content, m.start, m.end); snippet != "" {
+				result.Similarity, result.Snippet = m.similarity, snippet
 			}
 		}
+		results = append(results, result)
 	}
+	return results, rows.Err()
+}
 
+// topSimilar returns the limit most similar results, most similar first
+func topSimilar(results []SimilarEntry, limit int) []SimilarEntry {
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Similarity > results[j].Similarity })
 	if len(results) > limit {
 		results = results[:limit]
 	}
-
-	return results, nil
+	return results
 }
 
 func vectorToBlob(v []float64) []byte {
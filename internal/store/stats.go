@@ -0,0 +1,281 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// timeSeriesMetrics maps metric names to the table and timestamp column counted
+var timeSeriesMetrics = map[string][2]string{
+	"entries_created":    {"entries", "created_at"},
+	"tags_created":       {"tags", "created_at"},
+	"embeddings_created": {"embeddings", "created_at"},
+	"reviews":            {"review_log", "reviewed_at"},
+	"promotions":         {"maturity_log", "changed_at"},
+	"views":              {"entry_views", "viewed_at"},
+}
+
+// timeSeriesIntervals maps interval names to strftime bucket formats (UTC)
+var timeSeriesIntervals = map[string]string{
+	"hour":  "%Y-%m-%dT%H:00",
+	"day":   "%Y-%m-%d",
+	"week":  "%Y-W%W",
+	"month": "%Y-%m",
+}
+
+// TimeSeries counts metric events per interval bucket since the given
+// time, of the tags of the user ctx acts as and the entries visible to it
+func (s *Store) TimeSeries(ctx context.Context, metric, interval string, since time.Time) ([]domain.TimePoint, error) {
+	source, ok := timeSeriesMetrics[metric]
+	if !ok {
+		return nil, fmt.Errorf("unknown metric: %s", metric)
+	}
+	format, ok := timeSeriesIntervals[interval]
+	if !ok {
+		return nil, fmt.Errorf("unknown interval: %s", interval)
+	}
+
+	var owned string
+	var args []interface{}
+	switch source[0] {
+	case "entries":
+		owned, args = s.visibleCondition(ctx, "")
+	case "tags":
+		owned, args = userCondition(ctx, "")
+	default:
+		var visible string
+		visible, args = s.visibleCondition(ctx, "")
+		owned = "entry_id IN (SELECT id FROM entries WHERE " + visible + ")"
+	}
+
+	// Table and column names come from the fixed maps above, never from input
+	query := fmt.Sprintf(`
+		SELECT strftime('%s', %s) AS bucket, COUNT(*)
+		FROM %s
+		WHERE %s IS NOT NULL AND julianday(%s) >= julianday(?) AND %s
+		GROUP BY bucket
+		ORDER BY bucket
+	`, format, source[1], source[0], source[1], source[1], owned)
+
+	rows, err := s.db.QueryContext(ctx, query, append([]interface{}{since.UTC().Format(time.RFC3339)}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("time series: %w", err)
+	}
+	defer rows.Close()
+
+	var points []domain.TimePoint
+	for rows.Next() {
+		var p domain.TimePoint
+		if err := rows.Scan(&p.Bucket, &p.Count); err != nil {
+			return nil, fmt.Errorf("scan time point: %w", err)
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+// Stats is an overview of the knowledge base. Counts are of permanent
+// entries out of the trash; scratch entries are only counted in Scratch,
+// and entries in the trash in Trash.
+type Stats struct {
+	// Notebook, when set, is the notebook the entry counts are limited
+	// to, with its sub-notebooks
+	Notebook string `json:"notebook,omitempty"`
+	Entries  int    `json:"entries"`
+	Scratch  int    `json:"scratch"`
+	Archived int    `json:"archived"`
+	Trash    int    `json:"trash"`
+	// Embedded and Classified count entries with an embedding and with at
+	// least one tag
+	Embedded   int `json:"embedded"`
+	Classified int `json:"classified"`
+	// DBSize is the size of the database in bytes
+	DBSize int64 `json:"db_size"`
+	// Tags are in tree order, each parent before its children
+	Tags           []TagStat              `json:"tags"`
+	EntriesPerWeek []domain.TimePoint     `json:"entries_per_week"`
+	Maturity       map[string]int         `json:"maturity"`
+	Workflows      []domain.WorkflowCount `json:"workflows"`
+	MostViewed     []ViewedEntry          `json:"most_viewed"`
+	LeastViewed    []ViewedEntry          `json:"least_viewed"`
+	Cache          []CacheStat            `json:"cache"`
+}
+
+// TagStat counts the entries under a tag
+type TagStat struct {
+	Tag    string `json:"tag"`
+	Parent string `json:"parent,omitempty"`
+	Depth  int    `json:"depth"`
+	// Entries are tagged with the tag itself; Total also counts entries
+	// tagged with any descendant, once each
+	Entries int `json:"entries"`
+	Total   int `json:"total"`
+}
+
+// ViewedEntry is an entry with its number of views
+type ViewedEntry struct {
+	Entry domain.Entry `json:"entry"`
+	Views int          `json:"views"`
+}
+
+// Coverage is the share of entries counted by n
+func (st *Stats) Coverage(n int) float64 {
+	if st.Entries == 0 {
+		return 0
+	}
+	return float64(n) / float64(st.Entries)
+}
+
+// Stats gathers the overview, with the entries added in each of the last
+// weeks and the top most and least viewed entries
+func (s *Store) Stats(ctx context.Context, weeks, top int) (*Stats, error) {
+	st := &Stats{Notebook: s.Notebook(ctx)}
+
+	visible, args := s.visibleCondition(ctx, "")
+	err := s.db.QueryRowContext(ctx, `
+		SELECT
+			COUNT(*) FILTER (WHERE expires_at IS NULL AND deleted_at IS NULL),
+			COUNT(*) FILTER (WHERE expires_at IS NOT NULL AND deleted_at IS NULL),
+			COUNT(*) FILTER (WHERE expires_at IS NULL AND deleted_at IS NULL AND archived_at IS NOT NULL),
+			COUNT(*) FILTER (WHERE deleted_at IS NOT NULL),
+			COUNT(*) FILTER (WHERE expires_at IS NULL AND deleted_at IS NULL AND id IN (SELECT entry_id FROM embeddings)),
+			COUNT(*) FILTER (WHERE expires_at IS NULL AND deleted_at IS NULL AND id IN (SELECT entry_id FROM entry_tags))
+		FROM entries
+		WHERE `+visible+`
+	`, args...).Scan(&st.Entries, &st.Scratch, &st.Archived, &st.Trash, &st.Embedded, &st.Classified)
+	if err != nil {
+		return nil, fmt.Errorf("count entries: %w", err)
+	}
+
+	if st.DBSize, err = s.Size(ctx); err != nil {
+		return nil, err
+	}
+
+	if st.Tags, err = s.tagStats(ctx); err != nil {
+		return nil, err
+	}
+	if st.EntriesPerWeek, err = s.TimeSeries(ctx, "entries_created", "week", time.Now().AddDate(0, 0, -7*weeks)); err != nil {
+		return nil, err
+	}
+	if st.Maturity, err = s.MaturityCounts(ctx); err != nil {
+		return nil, err
+	}
+	if st.Workflows, err = s.WorkflowCounts(ctx); err != nil {
+		return nil, err
+	}
+	if st.MostViewed, err = s.viewedEntries(ctx, "DESC", top); err != nil {
+		return nil, err
+	}
+	if st.LeastViewed, err = s.viewedEntries(ctx, "ASC", top); err != nil {
+		return nil, err
+	}
+	if st.Cache, err = s.CacheStats(ctx); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// tagStats counts the permanent entries under each tag, rolling them up
+// the hierarchy
+func (s *Store) tagStats(ctx context.Context) ([]TagStat, error) {
+	tags, err := s.ListTags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]domain.Tag, len(tags))
+	children := make(map[string][]domain.Tag)
+	for _, t := range tags {
+		byID[t.ID] = t
+	}
+	var roots []domain.Tag
+	for _, t := range tags {
+		if t.ParentID != nil && byID[*t.ParentID].ID != "" {
+			children[*t.ParentID] = append(children[*t.ParentID], t)
+		} else {
+			roots = append(roots, t)
+		}
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT et.entry_id, et.tag_id
+		FROM entry_tags et
+		JOIN entries e ON e.id = et.entry_id AND e.expires_at IS NULL AND e.deleted_at IS NULL
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("tag stats: %w", err)
+	}
+	defer rows.Close()
+
+	direct := make(map[string]int)
+	under := make(map[string]map[string]bool)
+	for rows.Next() {
+		var entryID, tagID string
+		if err := rows.Scan(&entryID, &tagID); err != nil {
+			return nil, fmt.Errorf("scan entry tag: %w", err)
+		}
+		direct[tagID]++
+		// Walk up to the root; seen guards against parent cycles
+		seen := make(map[string]bool)
+		for id := tagID; id != "" && !seen[id]; {
+			seen[id] = true
+			if under[id] == nil {
+				under[id] = make(map[string]bool)
+			}
+			under[id][entryID] = true
+			t := byID[id]
+			if t.ParentID == nil {
+				break
+			}
+			id = *t.ParentID
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var stats []TagStat
+	var walk func(t domain.Tag, parent string, depth int)
+	walk = func(t domain.Tag, parent string, depth int) {
+		stats = append(stats, TagStat{Tag: t.Name, Parent: parent, Depth: depth, Entries: direct[t.ID], Total: len(under[t.ID])})
+		for _, c := range children[t.ID] {
+			walk(c, t.Name, depth+1)
+		}
+	}
+	for _, t := range roots {
+		walk(t, "", 0)
+	}
+	return stats, nil
+}
+
+// viewedEntries returns the permanent entries with the most (order DESC)
+// or fewest (ASC) views, older entries first among equals
+func (s *Store) viewedEntries(ctx context.Context, order string, limit int) ([]ViewedEntry, error) {
+	// order is one of two constants, never input
+	visible, args := s.visibleCondition(ctx, "e.")
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT e.id, e.content, e.created_at, e.last_viewed_at, e.source_type, e.source_url, e.title, e.author, e.fetched_at, e.expires_at, e.maturity,
+		       (SELECT COUNT(*) FROM entry_views v WHERE v.entry_id = e.id) AS views
+		FROM entries e
+		WHERE e.expires_at IS NULL AND e.deleted_at IS NULL AND %s
+		ORDER BY views %s, e.created_at
+		LIMIT ?
+	`, visible, order), append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("viewed entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []ViewedEntry
+	for rows.Next() {
+		var v ViewedEntry
+		if err := rows.Scan(append(entryFields(&v.Entry), &v.Views)...); err != nil {
+			return nil, fmt.Errorf("scan viewed entry: %w", err)
+		}
+		s.openContent(&v.Entry)
+		entries = append(entries, v)
+	}
+	return entries, rows.Err()
+}
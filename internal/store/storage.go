@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// Storage is what the database holds, in bytes. Content and version
+// sizes are as stored, encrypted or not.
+type Storage struct {
+	DBSize int64 `json:"db_size"`
+	// FreeSize is space inside the database file left by deleted data,
+	// reclaimed by Compact (0 on Postgres)
+	FreeSize       int64 `json:"free_size"`
+	ContentSize    int64 `json:"content_size"`
+	VersionsSize   int64 `json:"versions_size"`
+	EmbeddingsSize int64 `json:"embeddings_size"`
+	// AttachmentsSize counts each attached file once, however many
+	// entries it's attached to
+	AttachmentsSize int64 `json:"attachments_size"`
+	// Trash and TrashSize are the entries in the trash and the size of
+	// their content, versions and attachments
+	Trash     int   `json:"trash"`
+	TrashSize int64 `json:"trash_size"`
+	// Largest are the entries taking the most space, largest first
+	Largest []EntrySize `json:"largest"`
+}
+
+// EntrySize is the space an entry takes
+type EntrySize struct {
+	Entry           domain.Entry `json:"entry"`
+	ContentSize     int64        `json:"content_size"`
+	VersionsSize    int64        `json:"versions_size"`
+	AttachmentsSize int64        `json:"attachments_size"`
+}
+
+// Total is the space the entry takes, all told
+func (e EntrySize) Total() int64 {
+	return e.ContentSize + e.VersionsSize + e.AttachmentsSize
+}
+
+// entrySizes selects the id and sizes of entries
+const entrySizes = `
+	SELECT e.id, length(e.content) AS content_size,
+	       COALESCE((SELECT SUM(length(v.content)) FROM entry_versions v WHERE v.entry_id = e.id), 0) AS versions_size,
+	       COALESCE((SELECT SUM(a.size) FROM attachments a WHERE a.entry_id = e.id), 0) AS attachments_size
+	FROM entries e`
+
+// Storage measures the database and lists the top largest entries, the
+// trash included
+func (s *Store) Storage(ctx context.Context, top int) (*Storage, error) {
+	st := &Storage{}
+	var err error
+	if st.DBSize, err = s.Size(ctx); err != nil {
+		return nil, err
+	}
+	if err := s.db.QueryRowContext(ctx, s.dialect.freeSize).Scan(&st.FreeSize); err != nil {
+		return nil, fmt.Errorf("database free space: %w", err)
+	}
+	if err := s.db.QueryRowContext(ctx, `
+		SELECT
+			(SELECT COALESCE(SUM(length(content)), 0) FROM entries),
+			(SELECT COALESCE(SUM(length(content)), 0) FROM entry_versions),
+			(SELECT COALESCE(SUM(length(vector)), 0) FROM embeddings) + (SELECT COALESCE(SUM(length(vector)), 0) FROM chunks),
+			(SELECT COALESCE(SUM(size), 0) FROM (SELECT MAX(size) AS size FROM attachments GROUP BY sha256) AS a)
+	`).Scan(&st.ContentSize, &st.VersionsSize, &st.EmbeddingsSize, &st.AttachmentsSize); err != nil {
+		return nil, fmt.Errorf("measure content: %w", err)
+	}
+
+	if err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*), COALESCE(SUM(content_size + versions_size + attachments_size), 0)
+		FROM (`+entrySizes+` WHERE e.deleted_at IS NOT NULL) AS trash
+	`).Scan(&st.Trash, &st.TrashSize); err != nil {
+		return nil, fmt.Errorf("measure trash: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, entrySizes+`
+		ORDER BY content_size + versions_size + attachments_size DESC
+		LIMIT ?
+	`, top)
+	if err != nil {
+		return nil, fmt.Errorf("largest entries: %w", err)
+	}
+	var sizes []EntrySize
+	for rows.Next() {
+		var es EntrySize
+		if err := rows.Scan(&es.Entry.ID, &es.ContentSize, &es.VersionsSize, &es.AttachmentsSize); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan entry size: %w", err)
+		}
+		sizes = append(sizes, es)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, es := range sizes {
+		entry, err := s.GetEntry(ctx, es.Entry.ID)
+		if err != nil {
+			return nil, err
+		}
+		es.Entry = *entry
+		st.Largest = append(st.Largest, es)
+	}
+	return st, nil
+}
+
+// Compact rebuilds the database file, reclaiming its free space. It
+// needs as much free disk as the database takes, and blocks writers
+// while it runs.
+func (s *Store) Compact(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, s.dialect.compact); err != nil {
+		return fmt.Errorf("compact database: %w", err)
+	}
+	return nil
+}
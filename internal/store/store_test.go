@@ -0,0 +1,79 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// newTestStore opens a fresh database in a temporary directory, closed
+// when the test ends. With KB_TEST_POSTGRES set to a postgres:// URL, it
+// opens a fresh schema of that database instead.
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	location := filepath.Join(t.TempDir(), "kb.db")
+	if dsn := os.Getenv("KB_TEST_POSTGRES"); dsn != "" {
+		location = testSchema(t, dsn)
+	}
+	opts := DefaultStoreOptions()
+	opts.DataDir = t.TempDir()
+	s, err := Open(location, opts)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// testSchema creates a schema in a Postgres database, dropped when the
+// test ends, and returns the URL of the database working in it
+func testSchema(t *testing.T, dsn string) string {
+	t.Helper()
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatalf("open postgres: %v", err)
+	}
+	schema := fmt.Sprintf("kb_test_%d", time.Now().UnixNano())
+	if _, err := db.Exec("CREATE SCHEMA " + schema); err != nil {
+		db.Close()
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DROP SCHEMA " + schema + " CASCADE")
+		db.Close()
+	})
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatalf("parse KB_TEST_POSTGRES: %v", err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// addUser creates a user and returns a context acting as them
+func addUser(t *testing.T, s *Store, name string, admin bool) context.Context {
+	t.Helper()
+	u, err := s.AddUser(context.Background(), name, admin)
+	if err != nil {
+		t.Fatalf("add user %s: %v", name, err)
+	}
+	return WithUser(context.Background(), u.ID)
+}
+
+func entryIDs(entries []domain.Entry) []string {
+	ids := make([]string, len(entries))
+	for i, e := range entries {
+		ids[i] = e.ID
+	}
+	return ids
+}
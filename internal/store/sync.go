@@ -0,0 +1,609 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// deviceSetting holds the ID this database syncs under
+const deviceSetting = "sync.device_id"
+
+// SyncResult is what applying a peer's changes did
+type SyncResult struct {
+	// Applied are the IDs of the records changed or deleted
+	Applied   []string `json:"applied"`
+	Conflicts int      `json:"conflicts"`
+}
+
+// DeviceID returns the ID this database syncs under, created on first use
+func (s *Store) DeviceID(ctx context.Context) (string, error) {
+	id, err := s.GetSetting(ctx, deviceSetting)
+	if err != nil || id != "" {
+		return id, err
+	}
+	id = uuid.New().String()
+	if err := s.SetSetting(ctx, deviceSetting, id); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// SyncCursor returns the last seq exchanged with a peer in a direction
+// ("pulled" on the peer, "pushed" from here), 0 if none
+func (s *Store) SyncCursor(ctx context.Context, peer, direction string) (int64, error) {
+	value, err := s.GetSetting(ctx, syncCursorSetting(peer, direction))
+	if err != nil || value == "" {
+		return 0, err
+	}
+	seq, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse sync cursor: %w", err)
+	}
+	return seq, nil
+}
+
+// SetSyncCursor records the last seq exchanged with a peer in a direction
+func (s *Store) SetSyncCursor(ctx context.Context, peer, direction string, seq int64) error {
+	return s.SetSetting(ctx, syncCursorSetting(peer, direction), strconv.FormatInt(seq, 10))
+}
+
+func syncCursorSetting(peer, direction string) string {
+	return "sync." + peer + "." + direction
+}
+
+// SyncChanges returns up to limit changes after a seq, leaving out those
+// received from exclude, with the seq to continue from and whether more
+// are waiting, even when none of this page's was kept. Entries encrypted by a notebook or the database aren't
+// synced, nor links to them: they're skipped, though the seq moves past
+// them. Only the database owner's entries and tags are synced, not those
+// of users.
+func (s *Store) SyncChanges(ctx context.Context, after int64, exclude string, limit int) ([]domain.SyncChange, int64, bool, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT c.seq, c.kind, c.entry_id, c.changed_at, c.deleted, e.id IS NOT NULL,
+		       COALESCE(e.content, ''), e.created_at, COALESCE(e.source_type, ''),
+		       COALESCE(e.source_url, ''), COALESCE(e.title, ''), COALESCE(e.author, ''), e.fetched_at,
+		       COALESCE(e.maturity, ''), COALESCE(e.notebook, ''), e.expires_at, e.archived_at, e.deleted_at
+		FROM sync_changes c
+		LEFT JOIN entries e ON c.kind = 'entry' AND e.id = c.entry_id
+		WHERE c.seq > ? AND (c.origin IS NULL OR c.origin != ?) AND e.user_id IS NULL
+		ORDER BY c.seq
+		LIMIT ?
+	`, after, exclude, limit+1)
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("list sync changes: %w", err)
+	}
+
+	// Pages are counted in changes read, skipped ones included: a page
+	// can hold fewer than limit changes with more waiting
+	var changes []domain.SyncChange
+	cursor, more, read := after, false, 0
+	for rows.Next() {
+		if read == limit {
+			more = true
+			break
+		}
+		read++
+		var c domain.SyncChange
+		var found bool
+		var e domain.SyncEntry
+		var createdAt *time.Time
+		if err := rows.Scan(&c.Seq, &c.Kind, &c.ID, &c.ChangedAt, &c.Deleted, &found,
+			&e.Content, &createdAt, &e.Source.Type, &e.Source.URL, &e.Source.Title, &e.Source.Author, &e.Source.FetchedAt,
+			&e.Maturity, &e.Notebook, &e.ExpiresAt, &e.ArchivedAt, &e.DeletedAt,
+		); err != nil {
+			rows.Close()
+			return nil, 0, false, fmt.Errorf("scan sync change: %w", err)
+		}
+		cursor = c.Seq
+		switch {
+		case c.Kind != domain.SyncKindEntry:
+		case c.Deleted || !found:
+			c.Deleted = true
+		case strings.HasPrefix(e.Content, encryptedPrefix):
+			continue
+		default:
+			e.CreatedAt = *createdAt
+			c.Entry = &e
+		}
+		changes = append(changes, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, 0, false, err
+	}
+
+	// Tags and links are read once the changes are, keeping those found
+	kept := changes[:0]
+	for _, c := range changes {
+		var err error
+		switch {
+		case c.Kind == domain.SyncKindEntry && c.Entry != nil:
+			err = s.loadSyncTags(ctx, c.ID, c.Entry)
+		case c.Kind == domain.SyncKindTag && !c.Deleted:
+			if c.Tag, err = s.loadSyncTag(ctx, c.ID); err == nil && c.Tag == nil {
+				c.Deleted = true
+			}
+		case c.Kind == domain.SyncKindLink && !c.Deleted:
+			if c.Link, err = s.loadSyncLink(ctx, c.ID); err == nil && c.Link == nil {
+				continue
+			}
+		}
+		if err != nil {
+			return nil, 0, false, err
+		}
+		kept = append(kept, c)
+	}
+	return kept, cursor, more, nil
+}
+
+// loadSyncTags fills in an entry's synced tags
+func (s *Store) loadSyncTags(ctx context.Context, id string, e *domain.SyncEntry) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT t.id, t.name, COALESCE(p.name, ''), COALESCE(et.confidence, 1.0), et.origin
+		FROM entry_tags et
+		JOIN tags t ON t.id = et.tag_id
+		LEFT JOIN tags p ON p.id = t.parent_id
+		WHERE et.entry_id = ?
+		ORDER BY t.name
+	`, id)
+	if err != nil {
+		return fmt.Errorf("list sync tags: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t domain.SyncEntryTag
+		if err := rows.Scan(&t.TagID, &t.Name, &t.Parent, &t.Confidence, &t.Origin); err != nil {
+			return fmt.Errorf("scan sync tag: %w", err)
+		}
+		e.Tags = append(e.Tags, t)
+	}
+	return rows.Err()
+}
+
+// loadSyncTag returns the synced state of one of the owner's tags, nil if
+// there's no such tag
+func (s *Store) loadSyncTag(ctx context.Context, id string) (*domain.SyncTag, error) {
+	var t domain.SyncTag
+	err := s.db.QueryRowContext(ctx, `
+		SELECT t.name, COALESCE(t.parent_id, ''), COALESCE(p.name, ''), t.description, t.color, t.created_at
+		FROM tags t
+		LEFT JOIN tags p ON p.id = t.parent_id
+		WHERE t.id = ? AND t.user_id IS NULL
+	`, id).Scan(&t.Name, &t.ParentID, &t.Parent, &t.Description, &t.Color, &t.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get sync tag: %w", err)
+	}
+	return &t, nil
+}
+
+// loadSyncLink returns the synced state of a link, nil if there's no such
+// link or it joins entries that aren't synced
+func (s *Store) loadSyncLink(ctx context.Context, id string) (*domain.SyncLink, error) {
+	from, to, _ := strings.Cut(id, "/")
+	var l domain.SyncLink
+	err := s.db.QueryRowContext(ctx, `
+		SELECT l.from_id, l.to_id, l.kind, l.created_at
+		FROM entry_links l
+		JOIN entries f ON f.id = l.from_id
+		JOIN entries t ON t.id = l.to_id
+		WHERE l.from_id = ? AND l.to_id = ?
+		AND f.user_id IS NULL AND t.user_id IS NULL
+		AND f.content NOT LIKE ? AND t.content NOT LIKE ?
+	`, from, to, encryptedPrefix+"%", encryptedPrefix+"%").Scan(&l.FromID, &l.ToID, &l.Kind, &l.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get sync link: %w", err)
+	}
+	return &l, nil
+}
+
+// localChange is a record's sync row and, for an entry, its stored
+// state, read before applying a peer's change to it
+type localChange struct {
+	seq       int64
+	changedAt time.Time
+	deleted   bool
+	origin    sql.NullString
+	exists    bool
+	title     string
+	content   string
+}
+
+// ApplySyncChanges applies changes received from a peer. since is the
+// last seq of ours the peer had seen: a record changed here after it, and
+// not by that peer, changed on both sides, and the latest change wins.
+// For entries, the other is logged as a conflict. Tags are applied first
+// and links last, so that the entries and tags they refer to are in.
+// Applied changes are marked as coming from the peer, so they aren't
+// sent back to it.
+func (s *Store) ApplySyncChanges(ctx context.Context, peer string, since int64, changes []domain.SyncChange) (*SyncResult, error) {
+	// Content is encrypted for its notebook, and missing notebooks
+	// created, before the transaction
+	stored := make(map[string]string)
+	for _, c := range changes {
+		if syncKind(c) != domain.SyncKindEntry || c.Deleted || c.Entry == nil {
+			continue
+		}
+		if c.Entry.Notebook != "" {
+			if _, err := s.GetNotebook(ctx, c.Entry.Notebook); errors.Is(err, ErrNotebookNotFound) {
+				if err := s.AddNotebook(ctx, &domain.Notebook{Name: c.Entry.Notebook}, ""); err != nil {
+					return nil, err
+				}
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		content, err := s.sealContent(ctx, c.Entry.Notebook, c.Entry.Content)
+		if err != nil {
+			return nil, err
+		}
+		stored[c.ID] = content
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	ordered := make([]domain.SyncChange, 0, len(changes))
+	for _, kind := range []string{domain.SyncKindTag, domain.SyncKindEntry, domain.SyncKindLink} {
+		for _, c := range changes {
+			if syncKind(c) == kind {
+				ordered = append(ordered, c)
+			}
+		}
+	}
+
+	result := &SyncResult{}
+	var applied []domain.SyncChange
+	now := time.Now()
+	for _, c := range ordered {
+		kind := syncKind(c)
+		local, err := readLocalChange(ctx, tx, c.ID)
+		if err != nil {
+			return nil, err
+		}
+		if local != nil && local.changedAt.Equal(c.ChangedAt) {
+			continue
+		}
+
+		concurrent := local != nil && local.seq > since && local.origin.String != peer
+		if concurrent && kind != domain.SyncKindEntry {
+			if !c.ChangedAt.After(local.changedAt) {
+				continue
+			}
+		} else if concurrent {
+			conflict := domain.SyncConflict{EntryID: c.ID, Peer: peer, CreatedAt: now}
+			if c.ChangedAt.After(local.changedAt) {
+				conflict.Kept = domain.ConflictKeptRemote
+				conflict.KeptChangedAt, conflict.LostChangedAt = c.ChangedAt, local.changedAt
+				conflict.LostDeleted = local.deleted || !local.exists
+				conflict.LostTitle, conflict.LostContent = local.title, local.content
+			} else {
+				conflict.Kept = domain.ConflictKeptLocal
+				conflict.KeptChangedAt, conflict.LostChangedAt = local.changedAt, c.ChangedAt
+				conflict.LostDeleted = c.Deleted
+				if c.Entry != nil {
+					conflict.LostTitle, conflict.LostContent = c.Entry.Source.Title, stored[c.ID]
+				}
+			}
+			if err := insertSyncConflict(ctx, tx, conflict); err != nil {
+				return nil, err
+			}
+			result.Conflicts++
+			if conflict.Kept == domain.ConflictKeptLocal {
+				continue
+			}
+		}
+
+		switch {
+		case kind == domain.SyncKindTag && (c.Deleted || c.Tag == nil):
+			err = deleteSyncTag(ctx, tx, c.ID)
+		case kind == domain.SyncKindTag:
+			err = applySyncTag(ctx, tx, c.ID, c.Tag, now)
+		case kind == domain.SyncKindLink:
+			err = applySyncLink(ctx, tx, c.ID, c.Deleted, c.Link)
+		case c.Deleted || c.Entry == nil:
+			if _, err = tx.ExecContext(ctx, "DELETE FROM entries WHERE id = ?", c.ID); err != nil {
+				err = fmt.Errorf("purge entry: %w", err)
+			}
+		default:
+			err = applySyncEntry(ctx, tx, c.ID, local != nil && local.exists, c.Entry, stored[c.ID], now)
+		}
+		if err != nil {
+			return nil, err
+		}
+		result.Applied = append(result.Applied, c.ID)
+		applied = append(applied, c)
+	}
+
+	for _, c := range applied {
+		kind := syncKind(c)
+		deleted := c.Deleted || (kind == domain.SyncKindEntry && c.Entry == nil) || (kind == domain.SyncKindTag && c.Tag == nil)
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO sync_changes (entry_id, kind, seq, changed_at, deleted, origin)
+			VALUES (?, ?, (SELECT COALESCE(MAX(seq), 0) + 1 FROM sync_changes), ?, ?, ?)
+			ON CONFLICT (entry_id) DO UPDATE SET kind = excluded.kind, seq = excluded.seq, changed_at = excluded.changed_at, deleted = excluded.deleted, origin = excluded.origin
+		`, c.ID, kind, c.ChangedAt, deleted, peer); err != nil {
+			return nil, fmt.Errorf("record sync change: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return result, nil
+}
+
+// syncKind is what a change is about, an entry when unset
+func syncKind(c domain.SyncChange) string {
+	if c.Kind == "" {
+		return domain.SyncKindEntry
+	}
+	return c.Kind
+}
+
+func readLocalChange(ctx context.Context, tx *sql.Tx, id string) (*localChange, error) {
+	var local localChange
+	err := tx.QueryRowContext(ctx, `
+		SELECT c.seq, c.changed_at, c.deleted, c.origin, e.id IS NOT NULL, COALESCE(e.title, ''), COALESCE(e.content, '')
+		FROM sync_changes c
+		LEFT JOIN entries e ON e.id = c.entry_id
+		WHERE c.entry_id = ?
+	`, id).Scan(&local.seq, &local.changedAt, &local.deleted, &local.origin, &local.exists, &local.title, &local.content)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get sync change: %w", err)
+	}
+	return &local, nil
+}
+
+// applySyncEntry writes an entry's synced state and tags. An edit of its
+// content or title makes a new revision, keeping the replaced version.
+func applySyncEntry(ctx context.Context, tx *sql.Tx, id string, exists bool, e *domain.SyncEntry, content string, now time.Time) error {
+	if exists {
+		var edited bool
+		if err := tx.QueryRowContext(ctx,
+			"SELECT content != ? OR title != ? FROM entries WHERE id = ?", content, e.Source.Title, id,
+		).Scan(&edited); err != nil {
+			return fmt.Errorf("get entry: %w", err)
+		}
+		if edited {
+			if err := saveVersion(ctx, tx, id); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE entries SET content = ?, source_type = ?, source_url = ?,
+			       canonical_url = CASE WHEN source_url = ? THEN canonical_url ELSE ? END, title = ?, author = ?, fetched_at = ?,
+			       maturity = ?, notebook = ?, expires_at = ?, archived_at = ?, deleted_at = ?,
+			       revision = revision + CASE WHEN ? THEN 1 ELSE 0 END,
+			       updated_at = CASE WHEN ? THEN ? ELSE updated_at END
+			WHERE id = ?
+		`, content, e.Source.Type, e.Source.URL, e.Source.URL, canonicalURL(e.Source), e.Source.Title, e.Source.Author, e.Source.FetchedAt,
+			e.Maturity, nullString(e.Notebook), e.ExpiresAt, e.ArchivedAt, e.DeletedAt,
+			edited, edited, now, id,
+		); err != nil {
+			return fmt.Errorf("update entry: %w", err)
+		}
+	} else if _, err := tx.ExecContext(ctx, `
+		INSERT INTO entries (id, content, created_at, source_type, source_url, canonical_url, title, author, fetched_at,
+		                     maturity, notebook, expires_at, archived_at, deleted_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, id, content, e.CreatedAt, e.Source.Type, e.Source.URL, canonicalURL(e.Source), e.Source.Title, e.Source.Author, e.Source.FetchedAt,
+		e.Maturity, nullString(e.Notebook), e.ExpiresAt, e.ArchivedAt, e.DeletedAt,
+	); err != nil {
+		return fmt.Errorf("insert entry: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM entry_tags WHERE entry_id = ?", id); err != nil {
+		return fmt.Errorf("clear entry tags: %w", err)
+	}
+	for _, t := range e.Tags {
+		tagID := t.TagID
+		if tagID != "" {
+			if err := ensureSyncTag(ctx, tx, tagID, t.Name, t.Parent, now); err != nil {
+				return err
+			}
+		} else {
+			var parentID *string
+			if t.Parent != "" {
+				pid, err := getOrCreateTagTx(ctx, tx, t.Parent, nil)
+				if err != nil {
+					return err
+				}
+				parentID = &pid
+			}
+			var err error
+			if tagID, err = getOrCreateTagTx(ctx, tx, t.Name, parentID); err != nil {
+				return err
+			}
+		}
+		origin := t.Origin
+		if origin == "" {
+			origin = domain.OriginAuto
+		}
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO entry_tags (entry_id, tag_id, confidence, origin) VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING", id, tagID, t.Confidence, origin,
+		); err != nil {
+			return fmt.Errorf("link entry tag: %w", err)
+		}
+	}
+	return nil
+}
+
+// ensureSyncTag makes sure the owner has a tag of a peer's ID. A tag of
+// the same name created here in the meantime is merged into it; a missing
+// one is created, under a parent of the given name ("" for none).
+func ensureSyncTag(ctx context.Context, tx *sql.Tx, id, name, parent string, now time.Time) error {
+	var n int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM tags WHERE id = ?", id).Scan(&n); err != nil {
+		return fmt.Errorf("get tag: %w", err)
+	}
+	if n > 0 {
+		return nil
+	}
+	var parentID *string
+	if parent != "" {
+		pid, err := getOrCreateTagTx(ctx, tx, parent, nil)
+		if err != nil {
+			return err
+		}
+		parentID = &pid
+	}
+	// Named by its ID until the tag holding its name is merged into it
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO tags (id, name, parent_id, created_at, user_id) VALUES (?, ?, ?, ?, NULL)", id, id, parentID, now,
+	); err != nil {
+		return fmt.Errorf("insert tag: %w", err)
+	}
+	return nameSyncTag(ctx, tx, id, name)
+}
+
+// nameSyncTag renames one of the owner's tags, merging into it the tag
+// that had the name here
+func nameSyncTag(ctx context.Context, tx *sql.Tx, id, name string) error {
+	var other string
+	err := tx.QueryRowContext(ctx, "SELECT id FROM tags WHERE name = ? AND user_id IS NULL AND id != ?", name, id).Scan(&other)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("find tag: %w", err)
+	}
+	if err == nil {
+		if _, err := mergeTagTx(ctx, tx, other, id); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE tags SET name = ? WHERE id = ? AND name != ?", name, id, name); err != nil {
+		return fmt.Errorf("rename tag: %w", err)
+	}
+	return nil
+}
+
+// applySyncTag writes a tag's synced state. A parent that would make
+// tags go round is left out.
+func applySyncTag(ctx context.Context, tx *sql.Tx, id string, t *domain.SyncTag, now time.Time) error {
+	if err := ensureSyncTag(ctx, tx, id, t.Name, "", now); err != nil {
+		return err
+	}
+	if err := nameSyncTag(ctx, tx, id, t.Name); err != nil {
+		return err
+	}
+	var parentID *string
+	if t.ParentID != "" {
+		if err := ensureSyncTag(ctx, tx, t.ParentID, t.Parent, "", now); err != nil {
+			return err
+		}
+		under, err := tagUnder(ctx, tx, t.ParentID, id)
+		if err != nil {
+			return err
+		}
+		if !under {
+			parentID = &t.ParentID
+		}
+	}
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE tags SET parent_id = ?, description = ?, color = ? WHERE id = ?", parentID, t.Description, t.Color, id,
+	); err != nil {
+		return fmt.Errorf("update tag: %w", err)
+	}
+	return nil
+}
+
+// deleteSyncTag deletes one of the owner's tags, its children moving up
+// to its parent
+func deleteSyncTag(ctx context.Context, tx *sql.Tx, id string) error {
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE tags SET parent_id = (SELECT parent_id FROM tags WHERE id = ?) WHERE parent_id = ?", id, id,
+	); err != nil {
+		return fmt.Errorf("move child tags: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM tags WHERE id = ? AND user_id IS NULL", id); err != nil {
+		return fmt.Errorf("delete tag: %w", err)
+	}
+	return nil
+}
+
+// applySyncLink writes or deletes a link, leaving out links to entries
+// missing here
+func applySyncLink(ctx context.Context, tx *sql.Tx, id string, deleted bool, l *domain.SyncLink) error {
+	if deleted || l == nil {
+		from, to, _ := strings.Cut(id, "/")
+		if _, err := tx.ExecContext(ctx, "DELETE FROM entry_links WHERE from_id = ? AND to_id = ?", from, to); err != nil {
+			return fmt.Errorf("unlink entries: %w", err)
+		}
+		return nil
+	}
+	kind := l.Kind
+	if kind == "" {
+		kind = domain.LinkRelates
+	}
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE entry_links SET kind = ? WHERE from_id = ? AND to_id = ? AND kind != ?", kind, l.FromID, l.ToID, kind,
+	); err != nil {
+		return fmt.Errorf("link entries: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO entry_links (from_id, to_id, kind, created_at)
+		SELECT f.id, t.id, ?, ? FROM entries f, entries t WHERE f.id = ? AND t.id = ?
+		ON CONFLICT DO NOTHING
+	`, kind, l.CreatedAt, l.FromID, l.ToID); err != nil {
+		return fmt.Errorf("link entries: %w", err)
+	}
+	return nil
+}
+
+func insertSyncConflict(ctx context.Context, tx *sql.Tx, c domain.SyncConflict) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO sync_conflicts (entry_id, peer, kept, kept_changed_at, lost_changed_at, lost_deleted, lost_title, lost_content, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, c.EntryID, c.Peer, c.Kept, c.KeptChangedAt, c.LostChangedAt, c.LostDeleted, c.LostTitle, c.LostContent, c.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert sync conflict: %w", err)
+	}
+	return nil
+}
+
+// SyncConflicts returns the latest conflicts resolved by sync, newest
+// first. Lost content encrypted with a key that isn't unlocked is left
+// empty.
+func (s *Store) SyncConflicts(ctx context.Context, limit int) ([]domain.SyncConflict, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, entry_id, peer, kept, kept_changed_at, lost_changed_at, lost_deleted, lost_title, lost_content, created_at
+		FROM sync_conflicts
+		ORDER BY id DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list sync conflicts: %w", err)
+	}
+	defer rows.Close()
+
+	var conflicts []domain.SyncConflict
+	for rows.Next() {
+		var c domain.SyncConflict
+		if err := rows.Scan(&c.ID, &c.EntryID, &c.Peer, &c.Kept, &c.KeptChangedAt, &c.LostChangedAt,
+			&c.LostDeleted, &c.LostTitle, &c.LostContent, &c.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan sync conflict: %w", err)
+		}
+		c.LostContent, _ = s.openText(c.LostContent)
+		conflicts = append(conflicts, c)
+	}
+	return conflicts, rows.Err()
+}
@@ -0,0 +1,133 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// pageSyncChanges reads every change after a seq, limit at a time, and
+// returns the IDs of the entries changed
+func pageSyncChanges(t *testing.T, s *Store, after int64, exclude string, limit int) []string {
+	t.Helper()
+	var ids []string
+	for pages := 0; ; pages++ {
+		if pages > 100 {
+			t.Fatal("SyncChanges keeps returning more")
+		}
+		changes, cursor, more, err := s.SyncChanges(context.Background(), after, exclude, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) > limit {
+			t.Fatalf("page of %d changes, limit %d", len(changes), limit)
+		}
+		if cursor < after {
+			t.Fatalf("cursor went back from %d to %d", after, cursor)
+		}
+		for _, c := range changes {
+			if c.Kind == domain.SyncKindEntry {
+				ids = append(ids, c.ID)
+			}
+		}
+		after = cursor
+		if !more {
+			return ids
+		}
+	}
+}
+
+func TestSyncChangesPaging(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	// Plain entries among entries encrypted by a notebook, which aren't
+	// synced
+	var want []string
+	for i := 0; i < 9; i++ {
+		e, err := s.AddEntry(ctx, "note")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i%3 == 1 {
+			if _, err := s.db.ExecContext(ctx, "UPDATE entries SET content = ? WHERE id = ?", encryptedPrefix+"sealed", e.ID); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want = append(want, e.ID)
+	}
+
+	for _, limit := range []int{1, 2, 3, 4, 100} {
+		got := pageSyncChanges(t, s, 0, "", limit)
+		slices.Sort(got)
+		got = slices.Compact(got)
+		sorted := slices.Sorted(slices.Values(want))
+		if !slices.Equal(got, sorted) {
+			t.Errorf("limit %d: synced %v, want %v", limit, got, sorted)
+		}
+	}
+}
+
+func TestSyncRoundTrip(t *testing.T) {
+	a, b := newTestStore(t), newTestStore(t)
+	ctx := context.Background()
+	owner, err := a.AddEntry(ctx, "shared note")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := addUser(t, a, "alice", false)
+	if _, err := a.AddEntry(alice, "alice's note"); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, _, more, err := a.SyncChanges(ctx, 0, "", 100)
+	if err != nil || more {
+		t.Fatalf("SyncChanges = %v, %v", more, err)
+	}
+	for _, c := range changes {
+		if c.Kind == domain.SyncKindEntry && c.ID != owner.ID {
+			t.Errorf("synced %s, only the owner's entries are", c.ID)
+		}
+	}
+	result, err := b.ApplySyncChanges(ctx, "a", 0, changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(result.Applied, owner.ID) {
+		t.Errorf("Applied = %v, want %s", result.Applied, owner.ID)
+	}
+	got, err := b.GetEntry(ctx, owner.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Content != "shared note" {
+		t.Errorf("synced content = %q", got.Content)
+	}
+
+	// Changes received from a peer aren't sent back to it
+	if ids := pageSyncChanges(t, b, 0, "a", 10); len(ids) != 0 {
+		t.Errorf("changes sent back to their origin: %v", ids)
+	}
+	if ids := pageSyncChanges(t, b, 0, "c", 10); !slices.Contains(ids, owner.ID) {
+		t.Errorf("changes for another peer = %v, want %s", ids, owner.ID)
+	}
+
+	// Deletions travel as tombstones
+	if err := a.DeleteEntry(ctx, owner.ID); err != nil {
+		t.Fatal(err)
+	}
+	after := changes[len(changes)-1].Seq
+	changes, _, _, err = a.SyncChanges(ctx, after, "", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.ApplySyncChanges(ctx, "a", 0, changes); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := b.GetEntry(ctx, owner.ID); err != nil || got.DeletedAt == nil {
+		t.Errorf("GetEntry after a synced delete = %+v, %v, want deleted", got, err)
+	}
+}
@@ -0,0 +1,205 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// ErrTagAliasNotFound is returned when removing a name that isn't an alias
+var ErrTagAliasNotFound = errors.New("tag alias not found")
+
+// tagNamed is the query of the tag of ctx's user a name designates, with
+// its arguments: the tag with that name, else with that name normalized,
+// else the tag it's an alias of
+func tagNamed(ctx context.Context, name string) (string, []interface{}) {
+	normalized := domain.NormalizeTagName(name)
+	ofUser, args := userCondition(ctx, "t.")
+	return `
+		SELECT t.id, t.name, t.parent_id, t.description, t.color, t.created_at
+		FROM tags t
+		LEFT JOIN tag_aliases a ON a.tag_id = t.id AND a.alias = ?
+		WHERE (t.name IN (?, ?) OR a.alias IS NOT NULL) AND ` + ofUser + `
+		ORDER BY CASE WHEN t.name = ? THEN 0 WHEN t.name = ? THEN 1 ELSE 2 END
+		LIMIT 1`,
+		append(append([]interface{}{normalized, name, normalized}, args...), name, normalized)
+}
+
+// AddTagAlias makes alias another name of a tag, normalized. A tag already
+// named alias is merged into the tag: its entries, children, feedback and
+// aliases move over, and it's deleted. Returns the alias and how many
+// entries were retagged.
+func (s *Store) AddTagAlias(ctx context.Context, tagName, alias string) (*domain.TagAlias, int, error) {
+	tag, err := s.GetTagByName(ctx, tagName)
+	if err != nil {
+		return nil, 0, err
+	}
+	a := domain.TagAlias{Alias: domain.NormalizeTagName(alias), TagID: tag.ID, Tag: tag.Name, CreatedAt: time.Now()}
+	if a.Alias == "" {
+		return nil, 0, fmt.Errorf("invalid alias %q", alias)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	var otherID string
+	var retagged int64
+	ofUser, args := userCondition(ctx, "")
+	err = tx.QueryRowContext(ctx, "SELECT id FROM tags WHERE name = ? AND "+ofUser, append([]interface{}{a.Alias}, args...)...).Scan(&otherID)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return nil, 0, fmt.Errorf("find tag: %w", err)
+	case otherID == tag.ID:
+		return nil, 0, fmt.Errorf("%s is the tag's own name", a.Alias)
+	default:
+		if retagged, err = mergeTagTx(ctx, tx, otherID, tag.ID); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	var existing string
+	aliasOfUser, _ := userCondition(ctx, "a.")
+	err = tx.QueryRowContext(ctx,
+		"SELECT t.name FROM tag_aliases a JOIN tags t ON t.id = a.tag_id WHERE a.alias = ? AND "+aliasOfUser,
+		append([]interface{}{a.Alias}, args...)...,
+	).Scan(&existing)
+	if err == nil {
+		return nil, 0, fmt.Errorf("%s is already an alias of %s", a.Alias, existing)
+	}
+	if err != sql.ErrNoRows {
+		return nil, 0, fmt.Errorf("find alias: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO tag_aliases (alias, tag_id, user_id, created_at) VALUES (?, ?, ?, ?)",
+		a.Alias, a.TagID, nullString(UserID(ctx)), a.CreatedAt,
+	); err != nil {
+		return nil, 0, fmt.Errorf("insert tag alias: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, 0, fmt.Errorf("commit: %w", err)
+	}
+	return &a, int(retagged), nil
+}
+
+// mergeTagTx moves what refers to tag from over to tag to and deletes
+// from, its name becoming an alias; returns how many entries were
+// retagged
+func mergeTagTx(ctx context.Context, tx *sql.Tx, from, to string) (int64, error) {
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO entry_tags (entry_id, tag_id, confidence, origin)
+		SELECT entry_id, ?, confidence, origin FROM entry_tags WHERE tag_id = ?
+		ON CONFLICT DO NOTHING`, to, from)
+	if err != nil {
+		return 0, fmt.Errorf("retag entries: %w", err)
+	}
+	retagged, _ := result.RowsAffected()
+
+	// A descendant of the merged tag takes its place in the hierarchy,
+	// rather than end up under its own children
+	if under, err := tagUnder(ctx, tx, to, from); err != nil {
+		return 0, err
+	} else if under {
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE tags SET parent_id = (SELECT parent_id FROM tags WHERE id = ?) WHERE id = ?", from, to,
+		); err != nil {
+			return 0, fmt.Errorf("merge tag: %w", err)
+		}
+	}
+	for _, stmt := range []string{
+		"UPDATE tags SET parent_id = ? WHERE parent_id = ?",
+		"UPDATE tag_aliases SET tag_id = ? WHERE tag_id = ?",
+		"UPDATE tag_feedback SET tag_id = ? WHERE tag_id = ?",
+		"UPDATE shares SET tag_id = ? WHERE tag_id = ?",
+	} {
+		if _, err := tx.ExecContext(ctx, stmt, to, from); err != nil {
+			return 0, fmt.Errorf("merge tag: %w", err)
+		}
+	}
+	// Its entry tags and calibration go with it
+	if _, err := tx.ExecContext(ctx, "DELETE FROM tags WHERE id = ?", from); err != nil {
+		return 0, fmt.Errorf("delete tag: %w", err)
+	}
+	return retagged, nil
+}
+
+// ListTagAliases returns the aliases of the tags of ctx's user, by alias
+func (s *Store) ListTagAliases(ctx context.Context) ([]domain.TagAlias, error) {
+	ofUser, args := userCondition(ctx, "t.")
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT a.alias, a.tag_id, t.name, a.created_at
+		FROM tag_aliases a
+		JOIN tags t ON t.id = a.tag_id
+		WHERE `+ofUser+`
+		ORDER BY a.alias`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list tag aliases: %w", err)
+	}
+	defer rows.Close()
+
+	var aliases []domain.TagAlias
+	for rows.Next() {
+		var a domain.TagAlias
+		if err := rows.Scan(&a.Alias, &a.TagID, &a.Tag, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan tag alias: %w", err)
+		}
+		aliases = append(aliases, a)
+	}
+	return aliases, rows.Err()
+}
+
+// RemoveTagAlias stops alias from naming its tag
+func (s *Store) RemoveTagAlias(ctx context.Context, alias string) error {
+	ofUser, args := userCondition(ctx, "")
+	result, err := s.db.ExecContext(ctx,
+		"DELETE FROM tag_aliases WHERE alias = ? AND "+ofUser,
+		append([]interface{}{domain.NormalizeTagName(alias)}, args...)...,
+	)
+	if err != nil {
+		return fmt.Errorf("remove tag alias: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %s", ErrTagAliasNotFound, alias)
+	}
+	return nil
+}
+
+// ClassifierTags returns the names of the existing tags to show the
+// classifier, each with its aliases, so it answers with the tag rather
+// than one of its other names, and its description, so it knows what the
+// tag is for: "go (aliases: golang, go-lang): the Go language"
+func (s *Store) ClassifierTags(ctx context.Context) ([]string, error) {
+	tags, err := s.ListTags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	aliases, err := s.ListTagAliases(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byTag := make(map[string][]string)
+	for _, a := range aliases {
+		byTag[a.TagID] = append(byTag[a.TagID], a.Alias)
+	}
+
+	names := make([]string, len(tags))
+	for i, t := range tags {
+		names[i] = t.Name
+		if len(byTag[t.ID]) > 0 {
+			names[i] += " (aliases: " + strings.Join(byTag[t.ID], ", ") + ")"
+		}
+		if t.Description != "" {
+			names[i] += ": " + strings.Join(strings.Fields(t.Description), " ")
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,176 @@
+package store
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// AuditTags looks for problems in the tags of ctx's user: names a few
+// edits apart, tags on a single entry, parent links going round and
+// parents that no longer exist. Given embeddings of the tags' names and
+// descriptions, by tag id, tags with embeddings at least minSimilarity
+// alike are reported as duplicates too.
+func (s *Store) AuditTags(ctx context.Context, vectors map[string][]float64, minSimilarity float64) (*domain.TagAudit, error) {
+	tags, err := s.ListTags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := s.TagCounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	audit := &domain.TagAudit{
+		Duplicates: []domain.TagDuplicate{},
+		SingleUse:  []string{},
+		Cycles:     [][]string{},
+		Orphans:    []string{},
+	}
+	byID := make(map[string]domain.Tag, len(tags))
+	for _, t := range tags {
+		byID[t.ID] = t
+	}
+
+	for i, a := range tags {
+		if counts[a.Name] == 1 {
+			audit.SingleUse = append(audit.SingleUse, a.Name)
+		}
+		if a.ParentID != nil {
+			if _, ok := byID[*a.ParentID]; !ok {
+				audit.Orphans = append(audit.Orphans, a.Name)
+			}
+		}
+
+		for _, b := range tags[i+1:] {
+			d := domain.TagDuplicate{Tag: a.Name, Duplicate: b.Name, TagEntries: counts[a.Name], DuplicateEntries: counts[b.Name]}
+			if namesAlike(a.Name, b.Name) {
+				d.Reason = domain.DuplicateName
+			} else if va, vb := vectors[a.ID], vectors[b.ID]; va != nil && vb != nil {
+				if d.Similarity = cosineSimilarity(va, vb); d.Similarity < minSimilarity {
+					continue
+				}
+				d.Reason = domain.DuplicateMeaning
+			} else {
+				continue
+			}
+			// Keep the tag on more entries, else the parent
+			if d.DuplicateEntries > d.TagEntries || (d.DuplicateEntries == d.TagEntries && a.ParentID != nil && *a.ParentID == b.ID) {
+				d.Tag, d.Duplicate = d.Duplicate, d.Tag
+				d.TagEntries, d.DuplicateEntries = d.DuplicateEntries, d.TagEntries
+			}
+			audit.Duplicates = append(audit.Duplicates, d)
+		}
+	}
+	sort.SliceStable(audit.Duplicates, func(i, j int) bool {
+		if audit.Duplicates[i].Reason != audit.Duplicates[j].Reason {
+			return audit.Duplicates[i].Reason == domain.DuplicateName
+		}
+		return audit.Duplicates[i].Similarity > audit.Duplicates[j].Similarity
+	})
+
+	audit.Cycles = tagCycles(tags, byID)
+	return audit, nil
+}
+
+// tagCycles returns the loops in the parent links of tags, each once,
+// starting from its first tag by name
+func tagCycles(tags []domain.Tag, byID map[string]domain.Tag) [][]string {
+	cycles := [][]string{}
+	// done marks the tags whose ancestors were walked already
+	done := make(map[string]bool, len(tags))
+	for _, t := range tags {
+		var path []domain.Tag
+		onPath := make(map[string]int)
+		for cur, ok := t, true; ok && !done[cur.ID]; {
+			if i, seen := onPath[cur.ID]; seen {
+				cycles = append(cycles, cycleNames(path[i:]))
+				break
+			}
+			onPath[cur.ID] = len(path)
+			path = append(path, cur)
+			if cur.ParentID == nil {
+				break
+			}
+			cur, ok = byID[*cur.ParentID]
+		}
+		for _, p := range path {
+			done[p.ID] = true
+		}
+	}
+	return cycles
+}
+
+// cycleNames returns the names of the tags of a loop, from the first by
+// name, each followed by its parent
+func cycleNames(loop []domain.Tag) []string {
+	first := 0
+	for i, t := range loop {
+		if t.Name < loop[first].Name {
+			first = i
+		}
+	}
+	names := make([]string, len(loop))
+	for i := range loop {
+		names[i] = loop[(first+i)%len(loop)].Name
+	}
+	return names
+}
+
+// namesAlike reports whether two tag names are the same once normalized,
+// or a typo or a plural apart: one edit for names of 4 to 7 letters, two
+// from 8
+func namesAlike(a, b string) bool {
+	a, b = domain.NormalizeTagName(a), domain.NormalizeTagName(b)
+	if a == b {
+		return true
+	}
+	n := min(len([]rune(a)), len([]rune(b)))
+	maxEdits := 0
+	switch {
+	case n >= 8:
+		maxEdits = 2
+	case n >= 4:
+		maxEdits = 1
+	}
+	return maxEdits > 0 && editDistance(a, b, maxEdits) <= maxEdits
+}
+
+// editDistance returns the Levenshtein distance between a and b, or
+// limit+1 when it's over limit
+func editDistance(a, b string, limit int) int {
+	ra, rb := []rune(a), []rune(b)
+	if abs(len(ra)-len(rb)) > limit {
+		return limit + 1
+	}
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		best := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			best = min(best, cur[j])
+		}
+		if best > limit {
+			return limit + 1
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// ResolveTagPath finds a tag by its path from one of its ancestors, the
+// names of the tags down to it joined by "/": "programming/golang/concurrency"
+// is the tag concurrency under golang under programming. Each step may be
+// an alias, and names with a "/" of their own are matched whole first.
+func (s *Store) ResolveTagPath(ctx context.Context, path string) (*domain.Tag, error) {
+	steps := strings.Split(strings.Trim(path, "/"), "/")
+	tag, err := s.resolveTagSteps(ctx, nil, steps)
+	if err != nil {
+		return nil, err
+	}
+	if tag == nil {
+		return nil, fmt.Errorf("tag not found: %s", path)
+	}
+	return tag, nil
+}
+
+// resolveTagSteps finds the tag steps lead to from parent, any tag for a
+// nil parent, trying the longest names first; nil if there's none
+func (s *Store) resolveTagSteps(ctx context.Context, parent *domain.Tag, steps []string) (*domain.Tag, error) {
+	if len(steps) == 0 {
+		return parent, nil
+	}
+	for i := len(steps); i >= 1; i-- {
+		name := strings.Join(steps[:i], "/")
+		var candidates []domain.Tag
+		if parent == nil {
+			tag, err := s.tagNamedExactly(ctx, name)
+			if err != nil {
+				return nil, err
+			}
+			if tag != nil {
+				candidates = append(candidates, *tag)
+			}
+		} else {
+			children, err := s.childTagsNamed(ctx, parent.ID, name)
+			if err != nil {
+				return nil, err
+			}
+			candidates = children
+		}
+		for c := range candidates {
+			tag, err := s.resolveTagSteps(ctx, &candidates[c], steps[i:])
+			if err != nil || tag != nil {
+				return tag, err
+			}
+		}
+	}
+	return nil, nil
+}
+
+// tagNamedExactly finds a tag of ctx's user by name or alias, nil if there's
+// none
+func (s *Store) tagNamedExactly(ctx context.Context, name string) (*domain.Tag, error) {
+	var tag domain.Tag
+	query, args := tagNamed(ctx, name)
+	err := s.db.QueryRowContext(ctx, query, args...).Scan(&tag.ID, &tag.Name, &tag.ParentID, &tag.Description, &tag.Color, &tag.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find tag: %w", err)
+	}
+	return &tag, nil
+}
+
+// childTagsNamed returns the children of a tag with a name, or an alias
+func (s *Store) childTagsNamed(ctx context.Context, parentID, name string) ([]domain.Tag, error) {
+	normalized := domain.NormalizeTagName(name)
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT DISTINCT t.id, t.name, t.parent_id, t.description, t.color, t.created_at
+		FROM tags t
+		LEFT JOIN tag_aliases a ON a.tag_id = t.id
+		WHERE t.parent_id = ? AND (t.name IN (?, ?) OR a.alias = ?)`,
+		parentID, name, normalized, normalized)
+	if err != nil {
+		return nil, fmt.Errorf("find child tags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []domain.Tag
+	for rows.Next() {
+		var t domain.Tag
+		if err := rows.Scan(&t.ID, &t.Name, &t.ParentID, &t.Description, &t.Color, &t.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan tag: %w", err)
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// tagRef is what tag conditions match a tag reference by: the id of the
+// tag a path leads to, else the reference as given, a name or an alias
+func (s *Store) tagRef(ctx context.Context, ref string) string {
+	if !strings.Contains(ref, "/") {
+		return ref
+	}
+	if tag, err := s.tagNamedExactly(ctx, ref); err == nil && tag != nil {
+		return ref
+	}
+	if tag, err := s.ResolveTagPath(ctx, ref); err == nil {
+		return tag.ID
+	}
+	return ref
+}
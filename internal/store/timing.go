@@ -0,0 +1,183 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/pbaille/kb/internal/metrics"
+)
+
+var (
+	queryDuration = metrics.NewHistogram(
+		"kb_db_query_duration_seconds", "SQLite statement duration, by statement kind",
+		metrics.DefaultBuckets, "op",
+	)
+	methodDuration = metrics.NewHistogram(
+		"kb_store_query_duration_seconds", "SQLite statement duration, by store method",
+		metrics.DefaultBuckets, "method",
+	)
+	methodQueries = metrics.NewCounter(
+		"kb_store_queries_total", "SQLite statements run, by store method and outcome",
+		"method", "outcome",
+	)
+	slowQueries = metrics.NewCounter(
+		"kb_store_slow_queries_total", "SQLite statements slower than the slow query threshold, by store method",
+		"method",
+	)
+)
+
+// QueryStat sums up the statements a store method ran in this process
+type QueryStat struct {
+	Method string        `json:"method"`
+	Calls  int           `json:"calls"`
+	Errors int           `json:"errors"`
+	Slow   int           `json:"slow"`
+	Total  time.Duration `json:"total_ns"`
+	Max    time.Duration `json:"max_ns"`
+}
+
+var (
+	queryStatsMu sync.Mutex
+	queryStats   = map[string]*QueryStat{}
+)
+
+// QueryStats returns the statements run in this process per store method,
+// the most time spent first
+func QueryStats() []QueryStat {
+	queryStatsMu.Lock()
+	defer queryStatsMu.Unlock()
+	stats := make([]QueryStat, 0, len(queryStats))
+	for _, st := range queryStats {
+		stats = append(stats, *st)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Total != stats[j].Total {
+			return stats[i].Total > stats[j].Total
+		}
+		return stats[i].Method < stats[j].Method
+	})
+	return stats
+}
+
+// timedDB records how long statements take and whether they fail, by
+// statement kind and by the store method running them, and logs those
+// slower than slowQuery. For queries returning rows, the time until the
+// first row is ready is measured, not the iteration. Statements run in a
+// transaction aren't recorded.
+type timedDB struct {
+	*sql.DB
+	// slowQuery is the duration above which statements are logged, 0 to
+	// log none
+	slowQuery time.Duration
+}
+
+func (db timedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	res, err := db.DB.ExecContext(ctx, query, args...)
+	db.record(start, query, err)
+	return res, err
+}
+
+func (db timedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	db.record(start, query, err)
+	return rows, err
+}
+
+func (db timedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	start := time.Now()
+	row := db.DB.QueryRowContext(ctx, query, args...)
+	db.record(start, query, row.Err())
+	return row
+}
+
+// record updates the metrics and query stats for a statement
+func (db timedDB) record(start time.Time, query string, err error) {
+	elapsed := time.Since(start)
+	method := storeMethod()
+	queryDuration.Observe(elapsed.Seconds(), statementKind(query))
+	methodDuration.Observe(elapsed.Seconds(), method)
+	methodQueries.Inc(method, metrics.Outcome(err))
+	slow := db.slowQuery > 0 && elapsed >= db.slowQuery
+	if slow {
+		slowQueries.Inc(method)
+		slog.Warn("slow query", "method", method, "duration", elapsed.Round(time.Microsecond), "query", compactQuery(query))
+	}
+
+	queryStatsMu.Lock()
+	defer queryStatsMu.Unlock()
+	st, ok := queryStats[method]
+	if !ok {
+		st = &QueryStat{Method: method}
+		queryStats[method] = st
+	}
+	st.Calls++
+	st.Total += elapsed
+	st.Max = max(st.Max, elapsed)
+	if err != nil {
+		st.Errors++
+	}
+	if slow {
+		st.Slow++
+	}
+}
+
+// storePackage prefixes the names of this package's functions
+const storePackage = "github.com/pbaille/kb/internal/store."
+
+// storeMethod names the store method running a statement: the closest
+// exported Store method up the stack, else the closest function of this
+// package
+func storeMethod() string {
+	pcs := make([]uintptr, 24)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(4, pcs)])
+	fallback := "other"
+	for {
+		frame, more := frames.Next()
+		name, ok := strings.CutPrefix(frame.Function, storePackage)
+		if ok {
+			method, isMethod := strings.CutPrefix(name, "(*Store).")
+			method, _, _ = strings.Cut(method, ".")
+			if isMethod && method != "" && unicode.IsUpper(rune(method[0])) {
+				return method
+			}
+			if fallback == "other" {
+				fallback = method
+			}
+		}
+		if !more {
+			return fallback
+		}
+	}
+}
+
+// compactQuery collapses a statement's whitespace and shortens it for logs
+func compactQuery(query string) string {
+	query = strings.Join(strings.Fields(query), " ")
+	if len(query) > 300 {
+		query = query[:300] + "…"
+	}
+	return query
+}
+
+// statementKind is the lowercased leading keyword of a statement, such as
+// "select" or "insert"
+func statementKind(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "other"
+	}
+	switch kind := strings.ToLower(fields[0]); kind {
+	case "select", "insert", "update", "delete", "with":
+		return kind
+	}
+	return "other"
+}
@@ -0,0 +1,189 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// tokenPrefix makes kb tokens recognizable, e.g. by secret scanners
+const tokenPrefix = "kb_"
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIToken generates a new token acting as a user ("" for the
+// database owner) and stores its hash. The returned secret can't be
+// recovered later.
+func (s *Store) CreateAPIToken(ctx context.Context, name, scope, userID string) (string, *domain.APIToken, error) {
+	if scope != domain.ScopeRead && scope != domain.ScopeWrite {
+		return "", nil, fmt.Errorf("unknown scope %q (use read or write)", scope)
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, fmt.Errorf("generate token: %w", err)
+	}
+	secret := tokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+
+	t := domain.APIToken{
+		ID:        uuid.New().String(),
+		Name:      name,
+		Scope:     scope,
+		CreatedAt: time.Now(),
+		UserID:    userID,
+	}
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO api_tokens (id, name, hash, scope, created_at, user_id) VALUES (?, ?, ?, ?, ?, ?)",
+		t.ID, t.Name, hashToken(secret), t.Scope, t.CreatedAt, nullString(userID),
+	)
+	if err != nil {
+		return "", nil, fmt.Errorf("insert token: %w", err)
+	}
+	return secret, &t, nil
+}
+
+// AuthenticateToken returns the active token matching a secret, recording
+// its use, or nil if there is none or its user is disabled
+func (s *Store) AuthenticateToken(ctx context.Context, secret string) (*domain.APIToken, error) {
+	var t domain.APIToken
+	var userID sql.NullString
+	err := s.db.QueryRowContext(ctx, `
+		SELECT t.id, t.name, t.scope, t.created_at, t.last_used_at, t.revoked_at, t.user_id
+		FROM api_tokens t
+		LEFT JOIN users u ON u.id = t.user_id
+		WHERE t.hash = ? AND t.revoked_at IS NULL AND u.disabled_at IS NULL
+	`, hashToken(secret)).Scan(&t.ID, &t.Name, &t.Scope, &t.CreatedAt, &t.LastUsedAt, &t.RevokedAt, &userID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("authenticate token: %w", err)
+	}
+	t.UserID = userID.String
+
+	if _, err := s.db.ExecContext(ctx, "UPDATE api_tokens SET last_used_at = ? WHERE id = ?", time.Now(), t.ID); err != nil {
+		return nil, fmt.Errorf("record token use: %w", err)
+	}
+	return &t, nil
+}
+
+// ListAPITokens returns all tokens, revoked ones included, oldest first
+func (s *Store) ListAPITokens(ctx context.Context) ([]domain.APIToken, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, name, scope, created_at, last_used_at, revoked_at, COALESCE(user_id, '') FROM api_tokens ORDER BY created_at")
+	if err != nil {
+		return nil, fmt.Errorf("list tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []domain.APIToken
+	for rows.Next() {
+		var t domain.APIToken
+		if err := rows.Scan(&t.ID, &t.Name, &t.Scope, &t.CreatedAt, &t.LastUsedAt, &t.RevokedAt, &t.UserID); err != nil {
+			return nil, fmt.Errorf("scan token: %w", err)
+		}
+		tokens = append(tokens, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// CountActiveTokens returns the number of tokens that aren't revoked
+func (s *Store) CountActiveTokens(ctx context.Context) (int, error) {
+	var n int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM api_tokens WHERE revoked_at IS NULL").Scan(&n); err != nil {
+		return 0, fmt.Errorf("count tokens: %w", err)
+	}
+	return n, nil
+}
+
+// TokensIssued reports whether any token was ever created, revoked ones
+// included: once one was, the API never opens up again
+func (s *Store) TokensIssued(ctx context.Context) (bool, error) {
+	var n int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM api_tokens").Scan(&n); err != nil {
+		return false, fmt.Errorf("count tokens: %w", err)
+	}
+	return n > 0, nil
+}
+
+// RevokeAPIToken revokes an active token by ID, name or ID prefix (see
+// resolveToken)
+func (s *Store) RevokeAPIToken(ctx context.Context, ref string) error {
+	id, err := s.resolveToken(ctx, ref)
+	if err != nil {
+		return err
+	}
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE api_tokens SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", time.Now(), id,
+	)
+	if err != nil {
+		return fmt.Errorf("revoke token: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("active token not found: %s", ref)
+	}
+	return nil
+}
+
+// resolveToken returns the ID of the one active token ref names: by ID,
+// else by name, else by ID prefix. A name or prefix shared by several
+// tokens fails with an *AmbiguousIDError.
+func (s *Store) resolveToken(ctx context.Context, ref string) (string, error) {
+	if ref == "" {
+		return "", fmt.Errorf("no token given")
+	}
+	for _, match := range []struct {
+		cond string
+		arg  string
+	}{
+		{"id = ?", ref},
+		{"name = ?", ref},
+		{`id LIKE lower(?) || '%' ESCAPE '\'`, likeEscaper.Replace(ref)},
+	} {
+		rows, err := s.db.QueryContext(ctx,
+			"SELECT id FROM api_tokens WHERE "+match.cond+" AND revoked_at IS NULL ORDER BY created_at", match.arg,
+		)
+		if err != nil {
+			return "", fmt.Errorf("resolve token: %w", err)
+		}
+		var ids []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return "", fmt.Errorf("scan token: %w", err)
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return "", fmt.Errorf("resolve token: %w", err)
+		}
+
+		switch len(ids) {
+		case 0:
+			continue
+		case 1:
+			return ids[0], nil
+		}
+		candidates := make([]string, 0, maxCandidates)
+		for _, id := range ids[:min(len(ids), maxCandidates)] {
+			candidates = append(candidates, domain.ShortID(id, DefaultShortIDLength))
+		}
+		return "", &AmbiguousIDError{Prefix: ref, Candidates: candidates, Count: len(ids)}
+	}
+	return "", fmt.Errorf("active token not found: %s", ref)
+}
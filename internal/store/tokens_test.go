@@ -0,0 +1,113 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// addToken inserts a token with a chosen ID
+func addToken(t *testing.T, s *Store, id, name string) {
+	t.Helper()
+	_, err := s.db.ExecContext(context.Background(),
+		"INSERT INTO api_tokens (id, name, hash, scope, created_at) VALUES (?, ?, ?, ?, ?)",
+		id, name, hashToken(id), domain.ScopeWrite, time.Now(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolveToken(t *testing.T) {
+	s := newTestStore(t)
+	addToken(t, s, "aa11", "laptop")
+	addToken(t, s, "aa22", "phone")
+	addToken(t, s, "a_x9", "ci")
+	addToken(t, s, "bb", "ci")
+	addToken(t, s, "bbc", "bb")
+
+	tests := []struct {
+		ref       string
+		want      string
+		ambiguous bool
+	}{
+		{ref: "aa11", want: "aa11"},
+		{ref: "laptop", want: "aa11"},
+		{ref: "aa2", want: "aa22"},
+		// An exact ID wins over a name and a longer ID it prefixes
+		{ref: "bb", want: "bb"},
+		// Wildcards are literal
+		{ref: "a_", want: "a_x9"},
+		{ref: "%"},
+		{ref: "_"},
+		{ref: ""},
+		{ref: "zz"},
+		{ref: "aa", ambiguous: true},
+		{ref: "a", ambiguous: true},
+		{ref: "ci", ambiguous: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			got, err := s.resolveToken(context.Background(), tt.ref)
+			var ambiguous *AmbiguousIDError
+			if errors.As(err, &ambiguous) != tt.ambiguous {
+				t.Fatalf("resolveToken error = %v, want ambiguous %v", err, tt.ambiguous)
+			}
+			if got != tt.want {
+				t.Errorf("resolveToken = %q, %v, want %q", got, err, tt.want)
+			}
+			if tt.want == "" && err == nil {
+				t.Error("resolveToken succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestRevokeAPIToken(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	laptop, _, err := s.CreateAPIToken(ctx, "laptop", domain.ScopeWrite, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	phone, _, err := s.CreateAPIToken(ctx, "phone", domain.ScopeRead, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ref := range []string{"", "%", "_"} {
+		if err := s.RevokeAPIToken(ctx, ref); err == nil {
+			t.Errorf("RevokeAPIToken(%q) succeeded", ref)
+		}
+	}
+	if err := s.RevokeAPIToken(ctx, "laptop"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RevokeAPIToken(ctx, "laptop"); err == nil {
+		t.Error("revoking a revoked token succeeded")
+	}
+
+	if token, err := s.AuthenticateToken(ctx, laptop); err != nil || token != nil {
+		t.Errorf("AuthenticateToken(revoked) = %v, %v, want nil", token, err)
+	}
+	if token, err := s.AuthenticateToken(ctx, phone); err != nil || token == nil || token.Name != "phone" {
+		t.Errorf("AuthenticateToken(active) = %v, %v, want phone", token, err)
+	}
+
+	tokens, err := s.ListAPITokens(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 2 || tokens[0].RevokedAt == nil || tokens[1].RevokedAt != nil {
+		t.Errorf("ListAPITokens = %+v, want laptop revoked and phone active", tokens)
+	}
+	if n, err := s.CountActiveTokens(ctx); err != nil || n != 1 {
+		t.Errorf("CountActiveTokens = %d, %v, want 1", n, err)
+	}
+	if issued, err := s.TokensIssued(ctx); err != nil || !issued {
+		t.Errorf("TokensIssued = %v, %v, want true", issued, err)
+	}
+}
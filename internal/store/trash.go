@@ -0,0 +1,138 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// scopeCondition returns the SQL condition selecting the entries of a
+// scope, on columns prefixed with prefix (e.g. "e."); an empty scope is
+// active
+func scopeCondition(scope, prefix string) (string, error) {
+	switch scope {
+	case "", domain.ScopeActive:
+		return prefix + "archived_at IS NULL AND " + prefix + "deleted_at IS NULL", nil
+	case domain.ScopeArchived:
+		return prefix + "archived_at IS NOT NULL AND " + prefix + "deleted_at IS NULL", nil
+	case domain.ScopeTrash:
+		return prefix + "deleted_at IS NOT NULL", nil
+	case domain.ScopeAll:
+		return "1 = 1", nil
+	}
+	return "", fmt.Errorf("unknown scope %q (use %s)", scope, strings.Join(domain.Scopes, ", "))
+}
+
+// CheckScope validates an entry scope; empty means active
+func CheckScope(scope string) error {
+	_, err := scopeCondition(scope, "")
+	return err
+}
+
+// ArchiveEntry moves an entry out of lists and searches, keeping it
+func (s *Store) ArchiveEntry(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE entries SET archived_at = ? WHERE id = ? AND archived_at IS NULL AND deleted_at IS NULL", time.Now(), id,
+	)
+	if err != nil {
+		return fmt.Errorf("archive entry: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return s.stateError(ctx, id)
+	}
+	return nil
+}
+
+// RestoreEntry takes an entry out of the trash or, if it isn't in the
+// trash, out of the archive. An archived entry that was deleted goes back
+// to the archive. A scratch entry taken out of the trash is kept, so it
+// doesn't expire again.
+func (s *Store) RestoreEntry(ctx context.Context, id string) (string, error) {
+	result, err := s.db.ExecContext(ctx, "UPDATE entries SET deleted_at = NULL, expires_at = NULL WHERE id = ? AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		return "", fmt.Errorf("restore entry: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		return domain.ScopeTrash, nil
+	}
+	result, err = s.db.ExecContext(ctx, "UPDATE entries SET archived_at = NULL WHERE id = ? AND archived_at IS NOT NULL", id)
+	if err != nil {
+		return "", fmt.Errorf("restore entry: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		return domain.ScopeArchived, nil
+	}
+	if _, err := s.entryNotebook(ctx, id); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("entry is neither archived nor in the trash")
+}
+
+// ListTrash returns the entries in the trash, most recently deleted first,
+// with their deletion time
+func (s *Store) ListTrash(ctx context.Context) ([]domain.Entry, error) {
+	ofUser, args := userCondition(ctx, "")
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, content, created_at, last_viewed_at, source_type, source_url, title, author, fetched_at, expires_at, maturity, deleted_at
+		FROM entries
+		WHERE deleted_at IS NOT NULL AND `+ofUser+`
+		ORDER BY deleted_at DESC
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list trash: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []domain.Entry
+	for rows.Next() {
+		var e domain.Entry
+		if err := rows.Scan(append(entryFields(&e), &e.DeletedAt)...); err != nil {
+			return nil, fmt.Errorf("scan trashed entry: %w", err)
+		}
+		s.openContent(&e)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// PurgeEntry deletes an entry for good, whether or not it is in the trash
+func (s *Store) PurgeEntry(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM entries WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("purge entry: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrEntryNotFound
+	}
+	return nil
+}
+
+// PurgeTrash deletes for good the entries in the trash for longer than
+// olderThan, all of them with 0
+func (s *Store) PurgeTrash(ctx context.Context, olderThan time.Duration) (int, error) {
+	result, err := s.db.ExecContext(ctx,
+		"DELETE FROM entries WHERE deleted_at IS NOT NULL AND julianday(deleted_at) <= julianday(?)", time.Now().Add(-olderThan).UTC(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("purge trash: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return int(n), nil
+}
+
+// stateError explains why an entry couldn't be archived or deleted
+func (s *Store) stateError(ctx context.Context, id string) error {
+	entry, err := s.GetEntry(ctx, id)
+	switch {
+	case err != nil:
+		return ErrEntryNotFound
+	case entry.DeletedAt != nil:
+		return fmt.Errorf("entry is in the trash")
+	case entry.ArchivedAt != nil:
+		return fmt.Errorf("entry is already archived")
+	}
+	return fmt.Errorf("entry is unchanged")
+}
@@ -0,0 +1,34 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// MarkRead takes an entry out of the reading queue
+func (s *Store) MarkRead(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE entries SET unread_since = NULL WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("mark read: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrEntryNotFound
+	}
+	return nil
+}
+
+// MarkUnread puts an entry in the reading queue, keeping its place if it
+// is already there
+func (s *Store) MarkUnread(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE entries SET unread_since = COALESCE(unread_since, ?) WHERE id = ?", time.Now(), id,
+	)
+	if err != nil {
+		return fmt.Errorf("mark unread: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrEntryNotFound
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pbaille/kb/internal/usage"
+)
+
+// ModelUsage is the aggregated usage of one model over a period
+type ModelUsage struct {
+	Service      string  `json:"service"`
+	Model        string  `json:"model"`
+	Calls        int     `json:"calls"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	Cost         float64 `json:"cost"`
+}
+
+// RecordUsage stores an API usage event (implements usage.Sink). It takes
+// no context: usage is recorded even when the call that incurred it is
+// cancelled afterwards.
+func (s *Store) RecordUsage(e usage.Event) error {
+	_, err := s.db.ExecContext(context.Background(),
+		"INSERT INTO api_usage (service, model, input_tokens, output_tokens, created_at) VALUES (?, ?, ?, ?, ?)",
+		e.Service, e.Model, e.InputTokens, e.OutputTokens, e.At.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("record usage: %w", err)
+	}
+	return nil
+}
+
+// UsageSince aggregates API usage per model since the given time
+func (s *Store) UsageSince(ctx context.Context, since time.Time) ([]ModelUsage, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT service, model, COUNT(*), SUM(input_tokens), SUM(output_tokens)
+		FROM api_usage
+		WHERE created_at >= ?
+		GROUP BY service, model
+		ORDER BY service, model
+	`, since.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("usage since: %w", err)
+	}
+	defer rows.Close()
+
+	var result []ModelUsage
+	for rows.Next() {
+		var u ModelUsage
+		if err := rows.Scan(&u.Service, &u.Model, &u.Calls, &u.InputTokens, &u.OutputTokens); err != nil {
+			return nil, fmt.Errorf("scan usage: %w", err)
+		}
+		u.Cost = usage.Cost(u.Model, u.InputTokens, u.OutputTokens)
+		result = append(result, u)
+	}
+	return result, nil
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// ErrUserNotFound is returned when no user has a given name
+var ErrUserNotFound = errors.New("user not found")
+
+// userKey is the context key of the user store calls act as
+type userKey struct{}
+
+// WithUser makes the store calls made with ctx act as a user, by ID: they
+// only see and create that user's entries and tags. Without a user, calls
+// act as the database owner, whose entries and tags have no user.
+func WithUser(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userKey{}, userID)
+}
+
+// UserID returns the ID of the user store calls made with ctx act as, ""
+// for the database owner
+func UserID(ctx context.Context) string {
+	id, _ := ctx.Value(userKey{}).(string)
+	return id
+}
+
+// userCondition returns the SQL condition, and its argument, keeping the
+// rows of the user ctx acts as, on columns prefixed with prefix (e.g.
+// "e.")
+func userCondition(ctx context.Context, prefix string) (string, []interface{}) {
+	id := UserID(ctx)
+	if id == "" {
+		return prefix + "user_id IS NULL", nil
+	}
+	return prefix + "user_id = ?", []interface{}{id}
+}
+
+// AddUser creates a user
+func (s *Store) AddUser(ctx context.Context, name string, admin bool) (*domain.User, error) {
+	if err := domain.CheckUserName(name); err != nil {
+		return nil, err
+	}
+	u := domain.User{ID: uuid.New().String(), Name: name, Admin: admin, CreatedAt: time.Now()}
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO users (id, name, admin, created_at) VALUES (?, ?, ?, ?)",
+		u.ID, u.Name, u.Admin, u.CreatedAt,
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			return nil, fmt.Errorf("user %s already exists", name)
+		}
+		return nil, fmt.Errorf("insert user: %w", err)
+	}
+	return &u, nil
+}
+
+// GetUser returns a user by name or ID
+func (s *Store) GetUser(ctx context.Context, ref string) (*domain.User, error) {
+	var u domain.User
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, name, admin, created_at, disabled_at FROM users WHERE name = ? OR id = ?", ref, ref,
+	).Scan(&u.ID, &u.Name, &u.Admin, &u.CreatedAt, &u.DisabledAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", ErrUserNotFound, ref)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+	return &u, nil
+}
+
+// ListUsers returns all users, disabled ones included, by name
+func (s *Store) ListUsers(ctx context.Context) ([]domain.User, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, name, admin, created_at, disabled_at FROM users ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []domain.User
+	for rows.Next() {
+		var u domain.User
+		if err := rows.Scan(&u.ID, &u.Name, &u.Admin, &u.CreatedAt, &u.DisabledAt); err != nil {
+			return nil, fmt.Errorf("scan user: %w", err)
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// DisableUser takes away a user's access, revoking their tokens. Their
+// entries and tags are kept.
+func (s *Store) DisableUser(ctx context.Context, ref string) error {
+	u, err := s.GetUser(ctx, ref)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET disabled_at = ? WHERE id = ? AND disabled_at IS NULL", now, u.ID); err != nil {
+		return fmt.Errorf("disable user: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE api_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", now, u.ID); err != nil {
+		return fmt.Errorf("revoke tokens: %w", err)
+	}
+	return tx.Commit()
+}
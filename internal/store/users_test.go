@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+func TestUserIsolation(t *testing.T) {
+	s := newTestStore(t)
+	owner := context.Background()
+	alice := addUser(t, s, "alice", false)
+	bob := addUser(t, s, "bob", false)
+
+	mine, err := s.AddEntry(owner, "owner note")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hers, err := s.AddEntry(alice, "alice note")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		visible []string
+	}{
+		{"owner", owner, []string{mine.ID}},
+		{"alice", alice, []string{hers.ID}},
+		{"bob", bob, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := s.ListEntries(tt.ctx, domain.ScopeActive, 10, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := entryIDs(entries); !slices.Equal(got, tt.visible) {
+				t.Errorf("ListEntries = %v, want %v", got, tt.visible)
+			}
+			for _, id := range []string{mine.ID, hers.ID} {
+				_, err := s.GetEntry(tt.ctx, id)
+				if want := slices.Contains(tt.visible, id); (err == nil) != want {
+					t.Errorf("GetEntry(%s) error = %v, want visible %v", id, err, want)
+				}
+				_, err = s.ResolveID(tt.ctx, id[:8])
+				if want := slices.Contains(tt.visible, id); (err == nil) != want {
+					t.Errorf("ResolveID(%s) error = %v, want visible %v", id[:8], err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestUISettingsPerUser(t *testing.T) {
+	s := newTestStore(t)
+	owner := context.Background()
+	alice := addUser(t, s, "alice", false)
+	bob := addUser(t, s, "bob", false)
+
+	light := domain.DefaultUISettings()
+	light.Theme = "light"
+	if err := s.SaveUISettings(alice, light); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		theme string
+	}{
+		{"alice", alice, "light"},
+		{"bob", bob, domain.DefaultUISettings().Theme},
+		{"owner", owner, domain.DefaultUISettings().Theme},
+	}
+	for _, tt := range tests {
+		got, err := s.UISettings(tt.ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Theme != tt.theme {
+			t.Errorf("%s: theme = %s, want %s", tt.name, got.Theme, tt.theme)
+		}
+	}
+}
+
+func TestDisableUserRevokesTokens(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	u, err := s.AddUser(ctx, "carol", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, _, err := s.CreateAPIToken(ctx, "laptop", domain.ScopeWrite, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token, err := s.AuthenticateToken(ctx, secret); err != nil || token == nil || token.UserID != u.ID {
+		t.Fatalf("AuthenticateToken = %v, %v, want carol's token", token, err)
+	}
+
+	if err := s.DisableUser(ctx, "carol"); err != nil {
+		t.Fatal(err)
+	}
+	if token, err := s.AuthenticateToken(ctx, secret); err != nil || token != nil {
+		t.Errorf("AuthenticateToken after DisableUser = %v, %v, want nil", token, err)
+	}
+	if _, err := s.AddUser(ctx, "carol", false); err == nil {
+		t.Error("AddUser with a taken name succeeded")
+	}
+}
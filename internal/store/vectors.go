@@ -0,0 +1,247 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pbaille/kb/internal/vecindex"
+)
+
+// vectorIndex holds the embeddings of entries and of their passages in
+// graphs FindSimilar searches, instead of comparing the vector to them all
+type vectorIndex struct {
+	entries *vecindex.Index
+	// chunks are keyed by entry id and position (see chunkKey)
+	chunks *vecindex.Index
+
+	mu sync.RWMutex
+	// spans are the offsets of the passages in chunks, by key
+	spans map[string][2]int
+	// chunkCounts is how many passages of each entry are in chunks
+	chunkCounts map[string]int
+	// saved is when the embedding, or the passages, of each entry were
+	// saved, as indexed
+	saved, chunksSaved map[string]time.Time
+	// synced is the latest of those times: embeddings saved later, by this
+	// process or another, are indexed before a search
+	synced time.Time
+}
+
+// syncMargin is how far before the latest embedding indexed a search
+// looks for new ones, to catch those saved by a transaction that committed
+// after a later one
+const syncMargin = time.Minute
+
+// staleIndex is the share of replaced vectors past which the index is
+// rebuilt
+const staleIndex = 0.5
+
+func newVectorIndex() *vectorIndex {
+	return &vectorIndex{
+		entries:     vecindex.New(),
+		chunks:      vecindex.New(),
+		spans:       make(map[string][2]int),
+		chunkCounts: make(map[string]int),
+		saved:       make(map[string]time.Time),
+		chunksSaved: make(map[string]time.Time),
+	}
+}
+
+func chunkKey(entryID string, position int) string {
+	return entryID + "#" + strconv.Itoa(position)
+}
+
+// IndexVectors builds the index FindSimilar searches, so it stays fast
+// with tens of thousands of embeddings; long-running processes build it
+// in the background, others don't bother. Until it's built FindSimilar
+// compares the vector to every embedding. The index then follows the
+// embeddings saved by this process and others, and is rebuilt once mostly
+// made of replaced vectors.
+func (s *Store) IndexVectors(ctx context.Context) error {
+	x := newVectorIndex()
+	if err := x.update(ctx, s.db); err != nil {
+		return err
+	}
+	s.vectorsMu.Lock()
+	s.vectors = x
+	s.vectorsMu.Unlock()
+	return nil
+}
+
+// vectorIndex returns the index of the store, brought up to date, or nil
+// if it wasn't built
+func (s *Store) vectorIndex(ctx context.Context) (*vectorIndex, error) {
+	s.vectorsMu.Lock()
+	x := s.vectors
+	s.vectorsMu.Unlock()
+	if x == nil {
+		return nil, nil
+	}
+	if err := x.update(ctx, s.db); err != nil {
+		return nil, err
+	}
+
+	if x.entries.Stale() > staleIndex || x.chunks.Stale() > staleIndex {
+		s.vectorsMu.Lock()
+		rebuild := !s.rebuildingVectors
+		s.rebuildingVectors = true
+		s.vectorsMu.Unlock()
+		if rebuild {
+			go func() {
+				if err := s.IndexVectors(context.Background()); err != nil {
+					slog.Warn("rebuild vector index", "err", err)
+				}
+				s.vectorsMu.Lock()
+				s.rebuildingVectors = false
+				s.vectorsMu.Unlock()
+			}()
+		}
+	}
+	return x, nil
+}
+
+// dropChunks takes the passages of an entry out of the index, as they're
+// replaced
+func (s *Store) dropChunks(entryID string) {
+	s.vectorsMu.Lock()
+	x := s.vectors
+	s.vectorsMu.Unlock()
+	if x == nil {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.dropChunks(entryID)
+}
+
+type indexedVector struct {
+	entryID    string
+	position   int
+	start, end int
+	blob       []byte
+	savedAt    time.Time
+}
+
+// update indexes the embeddings and passages saved since the index was
+// last synced. A new embedding of an entry drops its passages, which are
+// saved after it.
+func (x *vectorIndex) update(ctx context.Context, db timedDB) error {
+	x.mu.RLock()
+	since := x.synced.Add(-syncMargin)
+	if x.synced.IsZero() {
+		since = time.Time{}
+	}
+	x.mu.RUnlock()
+
+	var embeddings, chunks []indexedVector
+	rows, err := db.QueryContext(ctx, "SELECT entry_id, vector, created_at FROM embeddings WHERE created_at > ? ORDER BY created_at", since)
+	if err != nil {
+		return fmt.Errorf("index embeddings: %w", err)
+	}
+	for rows.Next() {
+		var v indexedVector
+		if err := rows.Scan(&v.entryID, &v.blob, &v.savedAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan embedding: %w", err)
+		}
+		embeddings = append(embeddings, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("index embeddings: %w", err)
+	}
+
+	rows, err = db.QueryContext(ctx, "SELECT entry_id, position, start_offset, end_offset, vector, created_at FROM chunks WHERE created_at > ? ORDER BY entry_id, position", since)
+	if err != nil {
+		return fmt.Errorf("index chunks: %w", err)
+	}
+	for rows.Next() {
+		var v indexedVector
+		if err := rows.Scan(&v.entryID, &v.position, &v.start, &v.end, &v.blob, &v.savedAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan chunk: %w", err)
+		}
+		chunks = append(chunks, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("index chunks: %w", err)
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for _, v := range embeddings {
+		if prev, ok := x.saved[v.entryID]; ok && prev.Equal(v.savedAt) {
+			continue
+		}
+		x.entries.Add(v.entryID, blobToVector(v.blob))
+		x.dropChunks(v.entryID)
+		x.saved[v.entryID] = v.savedAt
+		if v.savedAt.After(x.synced) {
+			x.synced = v.savedAt
+		}
+	}
+	for i, v := range chunks {
+		if prev, ok := x.chunksSaved[v.entryID]; ok && prev.Equal(v.savedAt) {
+			continue
+		}
+		if i == 0 || chunks[i-1].entryID != v.entryID {
+			x.dropChunks(v.entryID)
+		}
+		key := chunkKey(v.entryID, v.position)
+		x.chunks.Add(key, blobToVector(v.blob))
+		x.spans[key] = [2]int{v.start, v.end}
+		x.chunkCounts[v.entryID] = max(x.chunkCounts[v.entryID], v.position+1)
+		if i == len(chunks)-1 || chunks[i+1].entryID != v.entryID {
+			x.chunksSaved[v.entryID] = v.savedAt
+		}
+		if v.savedAt.After(x.synced) {
+			x.synced = v.savedAt
+		}
+	}
+	return nil
+}
+
+// dropChunks takes the passages of an entry out of the index; x.mu must
+// be held
+func (x *vectorIndex) dropChunks(entryID string) {
+	for i := 0; i < x.chunkCounts[entryID]; i++ {
+		key := chunkKey(entryID, i)
+		x.chunks.Remove(key)
+		delete(x.spans, key)
+	}
+	delete(x.chunkCounts, entryID)
+	delete(x.chunksSaved, entryID)
+}
+
+// search returns the entries and the passages nearest to vector, up to k
+// of each, with the best passage of each entry, and whether there may be
+// more
+func (x *vectorIndex) search(vector []float64, k int) (map[string]float64, map[string]chunkMatch, bool) {
+	entryHits := x.entries.Search(vector, k)
+	chunkHits := x.chunks.Search(vector, k)
+
+	entries := make(map[string]float64, len(entryHits))
+	for _, h := range entryHits {
+		entries[h.Key] = h.Similarity
+	}
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	chunks := make(map[string]chunkMatch)
+	for _, h := range chunkHits {
+		span, ok := x.spans[h.Key]
+		if !ok {
+			continue
+		}
+		id, _, _ := strings.Cut(h.Key, "#")
+		if prev, ok := chunks[id]; !ok || h.Similarity > prev.similarity {
+			chunks[id] = chunkMatch{similarity: h.Similarity, start: span[0], end: span[1]}
+		}
+	}
+	return entries, chunks, len(entryHits) == k || len(chunkHits) == k
+}
@@ -0,0 +1,163 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// ErrVersionNotFound is returned when an entry has no version at a
+// revision
+var ErrVersionNotFound = errors.New("version not found")
+
+// ListEntryVersions returns every version of an entry, newest first,
+// starting with the current one. Versions are only kept from the first
+// edit made after they were introduced.
+func (s *Store) ListEntryVersions(ctx context.Context, id string) ([]domain.EntryVersion, error) {
+	entry, err := s.GetEntry(ctx, id)
+	if err != nil {
+		return nil, ErrEntryNotFound
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT revision, content, title, created_at FROM entry_versions WHERE entry_id = ? AND revision < ? ORDER BY revision DESC",
+		id, entry.Revision,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list entry versions: %w", err)
+	}
+	defer rows.Close()
+
+	versions := []domain.EntryVersion{currentVersion(entry)}
+	for rows.Next() {
+		v, err := s.scanVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, *v)
+	}
+	return versions, rows.Err()
+}
+
+// GetEntryVersion returns an entry's version at a revision, which may be
+// the current one
+func (s *Store) GetEntryVersion(ctx context.Context, id string, revision int) (*domain.EntryVersion, error) {
+	entry, err := s.GetEntry(ctx, id)
+	if err != nil {
+		return nil, ErrEntryNotFound
+	}
+	if revision == entry.Revision {
+		v := currentVersion(entry)
+		return &v, nil
+	}
+
+	row := s.db.QueryRowContext(ctx,
+		"SELECT revision, content, title, created_at FROM entry_versions WHERE entry_id = ? AND revision = ? AND revision < ?",
+		id, revision, entry.Revision,
+	)
+	v, err := s.scanVersion(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: revision %d", ErrVersionNotFound, revision)
+	}
+	return v, err
+}
+
+// RevertEntry makes an entry's content and title those of a past
+// revision. The revert is itself a new revision, so it can be undone.
+func (s *Store) RevertEntry(ctx context.Context, id string, revision int) (*domain.Entry, error) {
+	entry, err := s.GetEntry(ctx, id)
+	if err != nil {
+		return nil, ErrEntryNotFound
+	}
+	if revision == entry.Revision {
+		return nil, fmt.Errorf("entry is already at revision %d", revision)
+	}
+	v, err := s.GetEntryVersion(ctx, id, revision)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Locked || v.Locked {
+		return nil, fmt.Errorf("%w: %s", ErrNotebookLocked, entry.Notebook)
+	}
+	return s.UpdateEntry(ctx, id, v.Content, v.Title, entry.Revision)
+}
+
+// saveVersion keeps an entry's current content and title as the version
+// of its current revision, before an edit replaces them
+func saveVersion(ctx context.Context, tx *sql.Tx, id string) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO entry_versions (entry_id, revision, content, title, created_at)
+		SELECT id, revision, content, title, COALESCE(updated_at, created_at) FROM entries WHERE id = ?
+		ON CONFLICT DO NOTHING
+	`, id)
+	if err != nil {
+		return fmt.Errorf("save entry version: %w", err)
+	}
+	return nil
+}
+
+// resealVersions returns an entry's past versions encrypted for the
+// notebook it moves to, by revision, so that its history is no more
+// readable than its content
+func (s *Store) resealVersions(ctx context.Context, id, notebook string) (map[int]string, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT revision, content FROM entry_versions WHERE entry_id = ?", id)
+	if err != nil {
+		return nil, fmt.Errorf("list entry versions: %w", err)
+	}
+	defer rows.Close()
+
+	sealed := make(map[int]string)
+	for rows.Next() {
+		var revision int
+		var content string
+		if err := rows.Scan(&revision, &content); err != nil {
+			return nil, fmt.Errorf("scan entry version: %w", err)
+		}
+		plaintext, ok := s.openText(content)
+		if !ok {
+			return nil, fmt.Errorf("%w: history of %s", ErrNotebookLocked, id)
+		}
+		if sealed[revision], err = s.sealContent(ctx, notebook, plaintext); err != nil {
+			return nil, err
+		}
+	}
+	return sealed, rows.Err()
+}
+
+// currentVersion is an entry's current revision as a version
+func currentVersion(e *domain.Entry) domain.EntryVersion {
+	v := domain.EntryVersion{
+		Revision:  e.Revision,
+		Title:     e.Source.Title,
+		Content:   e.Content,
+		Locked:    e.Locked,
+		CreatedAt: e.CreatedAt,
+	}
+	if e.UpdatedAt != nil {
+		v.CreatedAt = *e.UpdatedAt
+	}
+	return v
+}
+
+// scanVersion scans a version row, decrypting its content
+func (s *Store) scanVersion(row interface{ Scan(...interface{}) error }) (*domain.EntryVersion, error) {
+	var v domain.EntryVersion
+	var title sql.NullString
+	if err := row.Scan(&v.Revision, &v.Content, &title, &v.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("scan entry version: %w", err)
+	}
+	v.Title = title.String
+	var ok bool
+	v.Content, ok = s.openText(v.Content)
+	v.Locked = !ok
+	if v.Locked {
+		v.Title = ""
+	}
+	return &v, nil
+}
@@ -0,0 +1,149 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// idPrefix matches wiki-link targets that may be an entry ID prefix
+var idPrefix = regexp.MustCompile(`^[0-9a-f]{8}[0-9a-f-]*$`)
+
+// LinkWikiLinks links an entry to the entries named by the [[wiki-links]]
+// in its content, and returns the targets no entry matches. Existing links
+// are kept as they are.
+func (s *Store) LinkWikiLinks(ctx context.Context, id, content string) ([]string, error) {
+	var unresolved []string
+	for _, target := range domain.WikiLinks(content) {
+		to, err := s.ResolveWikiLink(ctx, target)
+		if err != nil {
+			return nil, err
+		}
+		if to == "" {
+			unresolved = append(unresolved, target)
+			continue
+		}
+		if to == id {
+			continue
+		}
+		if err := s.LinkEntries(ctx, id, to); err != nil {
+			return nil, err
+		}
+	}
+	return unresolved, nil
+}
+
+// ResolveWikiLink returns the entry a wiki-link target names, "" if none:
+// the oldest one with it as title, else as first line (maybe as a Markdown
+// heading), case insensitively, else the entry with it as ID prefix.
+// Entries in the trash, or outside the notebook ctx works in, aren't
+// linked to.
+func (s *Store) ResolveWikiLink(ctx context.Context, target string) (string, error) {
+	visible, nbArgs := s.visibleCondition(ctx, "")
+	const space = " \t\r\n"
+	firstLine := `(lower(ltrim(content, ?)) = lower(?) OR substr(lower(ltrim(content, ?)), 1, length(CAST(? AS TEXT)) + 1) = lower(?) || ?)`
+	lookups := []struct {
+		cond string
+		args []interface{}
+	}{
+		{"lower(title) = lower(?)", []interface{}{target}},
+		{firstLine, []interface{}{space, target, space, target, target, "\n"}},
+		{firstLine, []interface{}{space, "# " + target, space, "# " + target, "# " + target, "\n"}},
+	}
+	for _, l := range lookups {
+		var id string
+		err := s.db.QueryRowContext(ctx, `
+			SELECT id FROM entries
+			WHERE deleted_at IS NULL AND `+l.cond+` AND `+visible+`
+			ORDER BY created_at
+			LIMIT 1
+		`, append(l.args, nbArgs...)...).Scan(&id)
+		if err == nil {
+			return id, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("resolve wiki-link: %w", err)
+		}
+	}
+
+	if idPrefix.MatchString(target) {
+		id, err := s.ResolveID(ctx, target)
+		if err == nil {
+			return id, nil
+		}
+		var ambiguous *AmbiguousIDError
+		if !errors.Is(err, ErrEntryNotFound) && !errors.As(err, &ambiguous) {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// UnresolvedLink is a wiki-link target no entry matches
+type UnresolvedLink struct {
+	Target string `json:"target"`
+	// Entries are the IDs of the entries linking to it, oldest first
+	Entries []string `json:"entries"`
+}
+
+// UnresolvedWikiLinks returns the wiki-link targets no entry matches, most
+// linked first. Entries whose content is encrypted aren't searched.
+func (s *Store) UnresolvedWikiLinks(ctx context.Context) ([]UnresolvedLink, error) {
+	visible, args := s.visibleCondition(ctx, "")
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, content FROM entries
+		WHERE deleted_at IS NULL AND instr(content, '[[') > 0 AND `+visible+`
+		ORDER BY created_at
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list wiki-links: %w", err)
+	}
+	type linking struct{ id, content string }
+	var entries []linking
+	for rows.Next() {
+		var e linking
+		if err := rows.Scan(&e.id, &e.content); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var links []UnresolvedLink
+	index := make(map[string]int) // lowercased target -> position in links, -1 if resolved
+	for _, e := range entries {
+		for _, target := range domain.WikiLinks(e.content) {
+			key := strings.ToLower(target)
+			i, seen := index[key]
+			if !seen {
+				id, err := s.ResolveWikiLink(ctx, target)
+				if err != nil {
+					return nil, err
+				}
+				i = -1
+				if id == "" {
+					i = len(links)
+					links = append(links, UnresolvedLink{Target: target})
+				}
+				index[key] = i
+			}
+			if i >= 0 {
+				links[i].Entries = append(links[i].Entries, e.id)
+			}
+		}
+	}
+	sort.SliceStable(links, func(i, j int) bool {
+		return len(links[i].Entries) > len(links[j].Entries)
+	})
+	return links, nil
+}
@@ -0,0 +1,329 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+)
+
+// ErrWorkflowNotFound is returned when no workflow has a given name
+var ErrWorkflowNotFound = errors.New("workflow not found")
+
+// ErrWorkflowNotebook is returned when an entry is put in a workflow for
+// a notebook it isn't in
+var ErrWorkflowNotebook = errors.New("entry is not in the workflow's notebook")
+
+// TransitionError is returned when an entry can't move to a workflow
+// state from the one it is in
+type TransitionError struct {
+	Workflow string
+	From, To string
+	// Allowed are the states reachable from From
+	Allowed []string
+}
+
+func (e *TransitionError) Error() string {
+	if e.From == e.To {
+		return fmt.Sprintf("entry is already %s in %s", e.To, e.Workflow)
+	}
+	msg := fmt.Sprintf("cannot move from %s to %s in %s", e.From, e.To, e.Workflow)
+	if len(e.Allowed) > 0 {
+		msg += " (allowed: " + strings.Join(e.Allowed, ", ") + ")"
+	}
+	return msg
+}
+
+// AddWorkflow defines a new workflow
+func (s *Store) AddWorkflow(ctx context.Context, w *domain.Workflow) error {
+	if err := w.Validate(); err != nil {
+		return err
+	}
+	if w.Notebook != "" {
+		if _, err := s.GetNotebook(ctx, w.Notebook); err != nil {
+			return err
+		}
+	}
+	states, err := json.Marshal(w.States)
+	if err != nil {
+		return fmt.Errorf("marshal states: %w", err)
+	}
+	var transitions sql.NullString
+	if w.Transitions != nil {
+		b, err := json.Marshal(w.Transitions)
+		if err != nil {
+			return fmt.Errorf("marshal transitions: %w", err)
+		}
+		transitions = sql.NullString{String: string(b), Valid: true}
+	}
+
+	if w.CreatedAt.IsZero() {
+		w.CreatedAt = time.Now()
+	}
+	_, err = s.db.ExecContext(ctx,
+		"INSERT INTO workflows (name, states, transitions, notebook, created_at) VALUES (?, ?, ?, ?, ?)",
+		w.Name, string(states), transitions, nullString(w.Notebook), w.CreatedAt,
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			return fmt.Errorf("workflow %s already exists", w.Name)
+		}
+		return fmt.Errorf("insert workflow: %w", err)
+	}
+	return nil
+}
+
+// GetWorkflow returns a workflow by name
+func (s *Store) GetWorkflow(ctx context.Context, name string) (*domain.Workflow, error) {
+	w, err := scanWorkflow(s.db.QueryRowContext(ctx,
+		"SELECT name, states, transitions, COALESCE(notebook, ''), created_at FROM workflows WHERE name = ?", name,
+	))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", ErrWorkflowNotFound, name)
+	}
+	return w, err
+}
+
+// ListWorkflows returns by name the workflows for the entries ctx works
+// with: in a notebook, those for every entry, for the notebook, for the
+// notebooks it's in and for its sub-notebooks
+func (s *Store) ListWorkflows(ctx context.Context) ([]domain.Workflow, error) {
+	query := "SELECT name, states, transitions, COALESCE(notebook, ''), created_at FROM workflows"
+	var args []interface{}
+	if name := s.Notebook(ctx); name != "" {
+		query += ` WHERE notebook IS NULL OR notebook IN (
+			WITH RECURSIVE up(name) AS (
+				SELECT CAST(? AS TEXT) UNION SELECT n.parent FROM notebooks n JOIN up ON n.name = up.name WHERE n.parent IS NOT NULL
+			)
+			SELECT name FROM up
+		) OR notebook IN (
+			WITH RECURSIVE down(name) AS (
+				SELECT CAST(? AS TEXT) UNION SELECT n.name FROM notebooks n JOIN down ON n.parent = down.name
+			)
+			SELECT name FROM down
+		)`
+		args = append(args, name, name)
+	}
+	rows, err := s.db.QueryContext(ctx, query+" ORDER BY name", args...)
+	if err != nil {
+		return nil, fmt.Errorf("list workflows: %w", err)
+	}
+	defer rows.Close()
+
+	var workflows []domain.Workflow
+	for rows.Next() {
+		w, err := scanWorkflow(rows)
+		if err != nil {
+			return nil, err
+		}
+		workflows = append(workflows, *w)
+	}
+	return workflows, rows.Err()
+}
+
+// DeleteWorkflow removes a workflow and every entry's state in it
+func (s *Store) DeleteWorkflow(ctx context.Context, name string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM workflows WHERE name = ?", name)
+	if err != nil {
+		return fmt.Errorf("delete workflow: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %s", ErrWorkflowNotFound, name)
+	}
+	return nil
+}
+
+func scanWorkflow(row interface{ Scan(...interface{}) error }) (*domain.Workflow, error) {
+	var w domain.Workflow
+	var states string
+	var transitions sql.NullString
+	if err := row.Scan(&w.Name, &states, &transitions, &w.Notebook, &w.CreatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("scan workflow: %w", err)
+	}
+	if err := json.Unmarshal([]byte(states), &w.States); err != nil {
+		return nil, fmt.Errorf("unmarshal states of %s: %w", w.Name, err)
+	}
+	if transitions.Valid {
+		if err := json.Unmarshal([]byte(transitions.String), &w.Transitions); err != nil {
+			return nil, fmt.Errorf("unmarshal transitions of %s: %w", w.Name, err)
+		}
+	}
+	return &w, nil
+}
+
+// SetWorkflowState moves an entry to a state of a workflow, logging the
+// change. An entry not yet in the workflow can only enter it at its
+// initial state; after that, only the workflow's transitions are allowed.
+// A workflow for a notebook only takes the entries of the notebook and
+// its sub-notebooks.
+func (s *Store) SetWorkflowState(ctx context.Context, entryID, workflow, to string) error {
+	w, err := s.GetWorkflow(ctx, workflow)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(w.States, to) {
+		return fmt.Errorf("%s has no state %s (states: %s)", w.Name, to, strings.Join(w.States, ", "))
+	}
+	if w.Notebook != "" {
+		in, err := s.entryInNotebook(ctx, entryID, w.Notebook)
+		if err != nil {
+			return err
+		}
+		if !in {
+			return fmt.Errorf("%w: %s is for notebook %s", ErrWorkflowNotebook, w.Name, w.Notebook)
+		}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	var from sql.NullString
+	err = tx.QueryRowContext(ctx,
+		"SELECT state FROM entry_workflows WHERE entry_id = ? AND workflow = ?", entryID, w.Name,
+	).Scan(&from)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("get workflow state: %w", err)
+	}
+
+	switch {
+	case !from.Valid && to != w.Initial():
+		return fmt.Errorf("entries start %s at %s", w.Name, w.Initial())
+	case from.Valid && (from.String == to || !w.CanTransition(from.String, to)):
+		return &TransitionError{Workflow: w.Name, From: from.String, To: to, Allowed: w.Next(from.String)}
+	}
+
+	now := time.Now()
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO entry_workflows (entry_id, workflow, state, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (entry_id, workflow) DO UPDATE SET state = excluded.state, updated_at = excluded.updated_at
+	`, entryID, w.Name, to, now); err != nil {
+		if strings.Contains(strings.ToUpper(err.Error()), "FOREIGN KEY") {
+			return ErrEntryNotFound
+		}
+		return fmt.Errorf("set workflow state: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO workflow_log (entry_id, workflow, from_state, to_state, changed_at) VALUES (?, ?, ?, ?, ?)",
+		entryID, w.Name, from, to, now,
+	); err != nil {
+		return fmt.Errorf("log workflow change: %w", err)
+	}
+	return tx.Commit()
+}
+
+// entryInNotebook reports whether an entry is in a notebook or one of its
+// sub-notebooks
+func (s *Store) entryInNotebook(ctx context.Context, entryID, notebook string) (bool, error) {
+	var in bool
+	err := s.db.QueryRowContext(ctx, `
+		WITH RECURSIVE tree(name) AS (
+			SELECT CAST(? AS TEXT) UNION SELECT n.name FROM notebooks n JOIN tree ON n.parent = tree.name
+		)
+		SELECT EXISTS (SELECT 1 FROM entries WHERE id = ? AND notebook IN (SELECT name FROM tree))
+	`, notebook, entryID).Scan(&in)
+	if err != nil {
+		return false, fmt.Errorf("check entry notebook: %w", err)
+	}
+	return in, nil
+}
+
+// LeaveWorkflow takes an entry out of a workflow
+func (s *Store) LeaveWorkflow(ctx context.Context, entryID, workflow string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM entry_workflows WHERE entry_id = ? AND workflow = ?", entryID, workflow)
+	if err != nil {
+		return fmt.Errorf("leave workflow: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("entry is not in %s", workflow)
+	}
+	return nil
+}
+
+// EntryWorkflows returns an entry's state in each workflow it is in
+func (s *Store) EntryWorkflows(ctx context.Context, entryID string) ([]domain.EntryState, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT workflow, state, updated_at FROM entry_workflows WHERE entry_id = ? ORDER BY workflow", entryID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("entry workflows: %w", err)
+	}
+	defer rows.Close()
+
+	var states []domain.EntryState
+	for rows.Next() {
+		var st domain.EntryState
+		if err := rows.Scan(&st.Workflow, &st.State, &st.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan entry workflow: %w", err)
+		}
+		states = append(states, st)
+	}
+	return states, rows.Err()
+}
+
+// ListEntriesInState returns the entries at a state of a workflow, most
+// recently moved first
+func (s *Store) ListEntriesInState(ctx context.Context, workflow, state string, limit, offset int) ([]domain.Entry, error) {
+	visible, args := s.visibleCondition(ctx, "e.")
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT e.id, e.content, e.created_at, e.last_viewed_at, e.source_type, e.source_url, e.title, e.author, e.fetched_at, e.expires_at, e.maturity
+		FROM entries e
+		JOIN entry_workflows w ON w.entry_id = e.id
+		WHERE w.workflow = ? AND w.state = ? AND e.deleted_at IS NULL AND `+visible+`
+		ORDER BY w.updated_at DESC
+		LIMIT ? OFFSET ?
+	`, append(append([]interface{}{workflow, state}, args...), limit, offset)...)
+	if err != nil {
+		return nil, fmt.Errorf("list entries in state: %w", err)
+	}
+	defer rows.Close()
+
+	return s.scanEntries(rows)
+}
+
+// WorkflowCounts returns the number of entries in every state of every
+// workflow, in workflow and state order, empty states included
+func (s *Store) WorkflowCounts(ctx context.Context) ([]domain.WorkflowCount, error) {
+	workflows, err := s.ListWorkflows(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, "SELECT workflow, state, COUNT(*) FROM entry_workflows GROUP BY workflow, state")
+	if err != nil {
+		return nil, fmt.Errorf("workflow counts: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[[2]string]int)
+	for rows.Next() {
+		var workflow, state string
+		var n int
+		if err := rows.Scan(&workflow, &state, &n); err != nil {
+			return nil, fmt.Errorf("scan workflow count: %w", err)
+		}
+		counts[[2]string{workflow, state}] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var result []domain.WorkflowCount
+	for _, w := range workflows {
+		for _, state := range w.States {
+			result = append(result, domain.WorkflowCount{Workflow: w.Name, State: state, Entries: counts[[2]string{w.Name, state}]})
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,259 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/journal"
+	"github.com/pbaille/kb/internal/pipeline"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// searchResults is how many entries /search and /recent list
+const searchResults = 5
+
+// titleLength is how much of a title listings show
+const titleLength = 60
+
+// retryDelay is how long to wait after a failed poll
+const retryDelay = 5 * time.Second
+
+const help = `Send me a note or a link and I'll save it to your knowledge base: links are fetched, notes are tagged.
+
+/search <text> - entries containing a text
+/recent - the latest entries
+/random [tag] - an entry picked at random, under a tag if given
+/show <id> - an entry in full`
+
+// Bot answers the messages of allowed users with a store
+type Bot struct {
+	client *Client
+	store  *store.Store
+	// allowed are the user IDs and usernames the bot answers
+	allowed []string
+	logger  *slog.Logger
+	// journal logs captures while the bot runs
+	journal *journal.Journal
+}
+
+// New creates a Bot answering the users allowed, by numeric ID or
+// username. With none allowed, it only tells users their ID.
+func New(client *Client, s *store.Store, allowed []string, logger *slog.Logger) *Bot {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	normalized := make([]string, len(allowed))
+	for i, a := range allowed {
+		normalized[i] = strings.ToLower(strings.TrimPrefix(a, "@"))
+	}
+	return &Bot{client: client, store: s, allowed: normalized, logger: logger}
+}
+
+// Run polls for messages and answers them one at a time until ctx is
+// done, first finishing the captures a previous run left pending. Failed
+// polls are retried; an invalid token fails at once, and so does losing
+// the journal to another bot.
+func (b *Bot) Run(ctx context.Context) error {
+	me, err := b.client.GetMe(ctx)
+	if err != nil {
+		return fmt.Errorf("check token: %w", err)
+	}
+	// Another bot taking the journal over stops this one
+	j, ctx, closeJournal, err := pipeline.OpenJournal(ctx, b.store, via, b.logger)
+	if err != nil {
+		return err
+	}
+	defer closeJournal()
+	b.journal = j
+	b.logger.Info("telegram bot started", "username", me.Username)
+
+	var offset int64
+	for {
+		updates, err := b.client.GetUpdates(ctx, offset)
+		if ctx.Err() != nil {
+			return stopped(ctx)
+		}
+		if err != nil {
+			b.logger.Warn("telegram poll failed", "error", err)
+			select {
+			case <-ctx.Done():
+				return stopped(ctx)
+			case <-time.After(retryDelay):
+			}
+			continue
+		}
+		for _, u := range updates {
+			offset = u.ID + 1
+			if u.Message != nil {
+				b.answer(ctx, u.Message)
+			}
+		}
+	}
+}
+
+// stopped is what Run returns once ctx is done: nil, unless another
+// process took the journal over
+func stopped(ctx context.Context) error {
+	if cause := context.Cause(ctx); errors.Is(cause, store.ErrLeaseLost) {
+		return fmt.Errorf("journal %w", cause)
+	}
+	return nil
+}
+
+// answer replies to a message, logging failures to reply
+func (b *Bot) answer(ctx context.Context, m *Message) {
+	reply := b.handle(ctx, m)
+	if reply == "" {
+		return
+	}
+	if err := b.client.SendMessage(ctx, m.Chat.ID, m.ID, reply); err != nil {
+		b.logger.Warn("telegram reply failed", "chat", m.Chat.ID, "error", err)
+	}
+}
+
+// handle returns the reply to a message: the result of a command, or of
+// saving the message
+func (b *Bot) handle(ctx context.Context, m *Message) string {
+	if m.From == nil {
+		return ""
+	}
+	if !b.allows(m.From) {
+		b.logger.Warn("telegram message from unknown user", "user", m.From.ID, "username", m.From.Username)
+		return fmt.Sprintf("You're not allowed to use this bot. Your user ID is %d: start kb bot telegram with --allow %d to let you in.", m.From.ID, m.From.ID)
+	}
+
+	text := strings.TrimSpace(m.Text)
+	if text == "" {
+		text = strings.TrimSpace(m.Caption)
+	}
+	if text == "" {
+		return "I can only save text and links for now."
+	}
+
+	if strings.HasPrefix(text, "/") {
+		command, arg, _ := strings.Cut(text, " ")
+		// Commands in groups are addressed as /search@botname
+		command, _, _ = strings.Cut(command, "@")
+		return b.command(ctx, strings.ToLower(command), strings.TrimSpace(arg))
+	}
+
+	reply, err := capture(ctx, b.store, b.journal, text)
+	if err != nil {
+		b.logger.Error("telegram capture failed", "error", err)
+		return "Couldn't save that: " + err.Error()
+	}
+	return reply
+}
+
+func (b *Bot) allows(u *User) bool {
+	return slices.Contains(b.allowed, strconv.FormatInt(u.ID, 10)) ||
+		(u.Username != "" && slices.Contains(b.allowed, strings.ToLower(u.Username)))
+}
+
+func (b *Bot) command(ctx context.Context, command, arg string) string {
+	switch command {
+	case "/start", "/help":
+		return help
+	case "/search":
+		if arg == "" {
+			return "Usage: /search <query>, e.g. /search golang tag:notes after:30d"
+		}
+		entries, err := b.store.SearchEntries(ctx, arg, domain.ScopeActive, false)
+		if err != nil {
+			return "Search failed: " + err.Error()
+		}
+		if len(entries) == 0 {
+			return "Nothing found for " + arg
+		}
+		return listing(entries, shortIDLength(ctx, b.store))
+	case "/recent":
+		entries, err := b.store.ListEntries(ctx, domain.ScopeActive, searchResults, 0)
+		if err != nil {
+			return "Listing failed: " + err.Error()
+		}
+		if len(entries) == 0 {
+			return "The knowledge base is empty."
+		}
+		return listing(entries, shortIDLength(ctx, b.store))
+	case "/random":
+		entry, err := b.store.RandomEntry(ctx, arg, false)
+		if err != nil {
+			return "Couldn't pick an entry: " + err.Error()
+		}
+		if entry == nil && arg != "" {
+			return "No entries under " + arg
+		}
+		if entry == nil {
+			return "The knowledge base is empty."
+		}
+		return b.show(ctx, entry.ID)
+	case "/show":
+		if arg == "" {
+			return "Usage: /show <id>"
+		}
+		id, err := b.store.ResolveID(ctx, arg)
+		if err != nil {
+			return "No entry " + arg
+		}
+		return b.show(ctx, id)
+	}
+	return "Unknown command " + command + "\n\n" + help
+}
+
+// show formats an entry in full, marking it viewed
+func (b *Bot) show(ctx context.Context, id string) string {
+	entry, err := b.store.GetEntry(ctx, id)
+	if err != nil {
+		return "Couldn't read the entry: " + err.Error()
+	}
+	b.store.MarkViewed(ctx, id)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s\n", entry.DisplayTitle())
+	if entry.Source.URL != "" {
+		fmt.Fprintf(&sb, "%s\n", entry.Source.URL)
+	}
+	fmt.Fprintf(&sb, "%s · %s", shortID(ctx, b.store, entry.ID), entry.CreatedAt.Format("2006-01-02"))
+	if tags := tagNames(entry.Tags); tags != "" {
+		fmt.Fprintf(&sb, " · %s", tags)
+	}
+	fmt.Fprintf(&sb, "\n\n%s", entry.Content)
+	return sb.String()
+}
+
+// listing formats the first entries of a result, one per line with IDs
+// abbreviated to idLength, with the number left out
+func listing(entries []domain.Entry, idLength int) string {
+	var sb strings.Builder
+	for _, e := range entries[:min(len(entries), searchResults)] {
+		fmt.Fprintf(&sb, "%s  %s\n", domain.ShortID(e.ID, idLength), shorten(e.DisplayTitle(), titleLength))
+	}
+	if more := len(entries) - searchResults; more > 0 {
+		fmt.Fprintf(&sb, "…and %d more\n", more)
+	}
+	sb.WriteString("\n/show <id> for the full entry")
+	return sb.String()
+}
+
+// shorten cuts s to n runes
+func shorten(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
+
+func tagNames(tags []domain.Tag) string {
+	names := make([]string, len(tags))
+	for i, t := range tags {
+		names[i] = t.Name
+	}
+	return strings.Join(names, ", ")
+}
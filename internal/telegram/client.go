@@ -0,0 +1,152 @@
+// Package telegram runs a Telegram bot over the knowledge base: messages
+// sent to it become entries, and commands search and browse the store.
+// It talks to the Bot API by long polling, so no public URL is needed.
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultAPIURL is the Bot API of telegram.org
+const DefaultAPIURL = "https://api.telegram.org"
+
+// pollTimeout is how long a getUpdates call waits for messages
+const pollTimeout = 50 * time.Second
+
+// maxMessage is the longest text a message can hold, in UTF-16 units;
+// counting runes stays under it for most texts
+const maxMessage = 4096
+
+// Client calls the Bot API as a bot
+type Client struct {
+	token   string
+	baseURL string
+	http    *http.Client
+}
+
+// NewClient creates a Client for a bot token, on the Bot API at baseURL
+// (DefaultAPIURL, or a self-hosted Bot API server)
+func NewClient(token, baseURL string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultAPIURL
+	}
+	return &Client{token: token, baseURL: baseURL, http: &http.Client{Timeout: pollTimeout + 10*time.Second}}
+}
+
+// Update is an incoming update; only messages are handled
+type Update struct {
+	ID      int64    `json:"update_id"`
+	Message *Message `json:"message"`
+}
+
+// Message is a message sent to the bot
+type Message struct {
+	ID      int64  `json:"message_id"`
+	From    *User  `json:"from"`
+	Chat    Chat   `json:"chat"`
+	Text    string `json:"text"`
+	Caption string `json:"caption"`
+}
+
+// User is the sender of a message, or the bot itself
+type User struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+// Chat is the conversation a message belongs to
+type Chat struct {
+	ID int64 `json:"id"`
+}
+
+// apiResponse is the envelope of every Bot API response
+type apiResponse struct {
+	OK          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result"`
+	Description string          `json:"description"`
+}
+
+// call invokes a Bot API method with JSON parameters, decoding its result
+// into out
+func (c *Client) call(ctx context.Context, method string, params, out interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("marshal %s: %w", method, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/bot"+c.token+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		// The URL holds the token: keep it out of the error
+		if uerr, ok := err.(*url.Error); ok {
+			err = uerr.Err
+		}
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	var r apiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return fmt.Errorf("%s: HTTP %d: %w", method, resp.StatusCode, err)
+	}
+	if !r.OK {
+		return fmt.Errorf("%s: %s", method, r.Description)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(r.Result, out); err != nil {
+		return fmt.Errorf("decode %s: %w", method, err)
+	}
+	return nil
+}
+
+// GetMe returns the bot's account, checking the token
+func (c *Client) GetMe(ctx context.Context) (*User, error) {
+	var me User
+	if err := c.call(ctx, "getMe", struct{}{}, &me); err != nil {
+		return nil, err
+	}
+	return &me, nil
+}
+
+// GetUpdates waits for the updates after offset, up to pollTimeout
+func (c *Client) GetUpdates(ctx context.Context, offset int64) ([]Update, error) {
+	params := map[string]interface{}{
+		"offset":          offset,
+		"timeout":         int(pollTimeout.Seconds()),
+		"allowed_updates": []string{"message"},
+	}
+	var updates []Update
+	if err := c.call(ctx, "getUpdates", params, &updates); err != nil {
+		return nil, err
+	}
+	return updates, nil
+}
+
+// SendMessage sends a plain text reply to a message, cut to the length a
+// message can hold
+func (c *Client) SendMessage(ctx context.Context, chatID, replyTo int64, text string) error {
+	if r := []rune(text); len(r) > maxMessage {
+		text = string(r[:maxMessage-3]) + "..."
+	}
+	params := map[string]interface{}{
+		"chat_id":                  chatID,
+		"text":                     text,
+		"disable_web_page_preview": true,
+	}
+	if replyTo != 0 {
+		params["reply_to_message_id"] = replyTo
+	}
+	return c.call(ctx, "sendMessage", params, nil)
+}
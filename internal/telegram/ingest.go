@@ -0,0 +1,91 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/fetcher"
+	"github.com/pbaille/kb/internal/journal"
+	"github.com/pbaille/kb/internal/pipeline"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// via records where URLs sent to the bot were seen
+const via = "telegram"
+
+// capture saves a message the way kb add does: a lone URL is fetched
+// (once), other text is saved as a note; either is classified, run
+// through the rules and embedded. Captures are journaled in j (when not
+// nil), for an interrupted one to be finished when the bot next starts. It
+// returns the reply describing the entry. Only saving can fail; later
+// steps that go wrong are mentioned.
+func capture(ctx context.Context, s *store.Store, j *journal.Journal, text string) (string, error) {
+	content, source := text, domain.Source{Type: domain.SourceNote}
+	isURL := fetcher.IsURL(text) && !strings.ContainsAny(text, " \n")
+	if isURL {
+		existing, err := s.FindEntryByURL(ctx, text)
+		if err != nil {
+			return "", err
+		}
+		if existing != nil {
+			if _, err := s.AddSourceOccurrence(ctx, existing.ID, via, text); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Already saved: %s (%s)", existing.DisplayTitle(), shortID(ctx, s, existing.ID)), nil
+		}
+
+		page, err := fetcher.Fetch(ctx, text)
+		if err != nil {
+			return "", fmt.Errorf("fetch URL: %w", err)
+		}
+		template, err := s.CaptureTemplate(ctx)
+		if err != nil {
+			return "", err
+		}
+		now := time.Now()
+		content = page.Capture().Render(template)
+		source = domain.Source{
+			Type:         domain.SourceURL,
+			URL:          text,
+			CanonicalURL: page.CanonicalURL,
+			Title:        page.Title,
+			Author:       page.Author,
+			FetchedAt:    &now,
+		}
+	}
+
+	c := journal.Capture{Content: content, Source: source}
+	if isURL {
+		c.Via, c.URL = via, text
+	}
+	res, err := pipeline.Ingest(ctx, s, j, c, pipeline.ProcessOptions{})
+	if err != nil {
+		return "", err
+	}
+	entry := res.Entry
+	reply := fmt.Sprintf("Saved: %s (%s)", entry.DisplayTitle(), shortID(ctx, s, entry.ID))
+	if tags := tagNames(entry.Tags); tags != "" {
+		reply += "\nTags: " + tags
+	}
+	if len(res.Problems) > 0 {
+		reply += "\n(" + strings.Join(res.Problems, "; ") + ")"
+	}
+	return reply, nil
+}
+
+// shortID abbreviates an entry ID the way the CLI shows it
+func shortID(ctx context.Context, s *store.Store, id string) string {
+	return domain.ShortID(id, shortIDLength(ctx, s))
+}
+
+// shortIDLength is how long the CLI shows entry IDs
+func shortIDLength(ctx context.Context, s *store.Store) int {
+	n, err := s.ShortIDLength(ctx)
+	if err != nil {
+		return store.DefaultShortIDLength
+	}
+	return n
+}
@@ -0,0 +1,28 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/pipeline"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// ingest adds a note the way kb add does: classified, run through the
+// rules and embedded. Only saving can fail; later steps that go wrong are
+// summarized in the returned note, since printing would garble the screen.
+func ingest(ctx context.Context, s *store.Store, content string) (*domain.Entry, string, error) {
+	entry, err := s.AddEntry(ctx, content)
+	if err != nil {
+		return nil, "", err
+	}
+
+	res := pipeline.Process(ctx, s, entry, content, pipeline.ProcessOptions{})
+	problems := res.Problems
+	if len(res.UnresolvedLinks) > 0 {
+		problems = append(problems, fmt.Sprintf("%d unresolved links", len(res.UnresolvedLinks)))
+	}
+	return res.Entry, strings.Join(problems, "; "), nil
+}
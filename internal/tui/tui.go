@@ -0,0 +1,760 @@
+// Package tui is a terminal interface to the knowledge base: the tag tree,
+// the entry list and the selected entry side by side, with keys to search,
+// add, edit, tag and delete entries
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/pbaille/kb/internal/domain"
+	"github.com/pbaille/kb/internal/store"
+)
+
+// Run shows the TUI until the user quits
+func Run(ctx context.Context, s *store.Store) error {
+	m := newModel(ctx, s)
+	if err := m.reload(); err != nil {
+		return err
+	}
+	_, err := tea.NewProgram(m, tea.WithAltScreen(), tea.WithContext(ctx)).Run()
+	return err
+}
+
+// entryLimit caps the entries listed at once
+const entryLimit = 500
+
+// tagPaneWidth is the width of the tag tree, borders included
+const tagPaneWidth = 26
+
+type pane int
+
+const (
+	paneTags pane = iota
+	paneEntries
+	paneEntry
+)
+
+type mode int
+
+const (
+	modeBrowse mode = iota
+	modeSearch
+	modeAdd
+	modeEdit
+	modeTag
+	modeDelete
+)
+
+const helpLine = "tab pane · j/k move · enter open · / search · a add · e edit · t tag · d delete · r reload · q quit"
+
+var (
+	borderStyle   = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("240"))
+	focusedStyle  = borderStyle.BorderForeground(lipgloss.Color("62"))
+	selectedStyle = lipgloss.NewStyle().Reverse(true)
+	dimStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("244"))
+	titleStyle    = lipgloss.NewStyle().Bold(true)
+	errorStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("203"))
+)
+
+// tagRow is one line of the flattened tag tree; the first row, with no
+// name, stands for all entries
+type tagRow struct {
+	name  string
+	depth int
+}
+
+type model struct {
+	ctx   context.Context
+	store *store.Store
+
+	width, height int
+	focus         pane
+	mode          mode
+
+	tags     []tagRow
+	tagIdx   int
+	entries  []domain.Entry
+	entryIdx int
+	entry    *domain.Entry // the selected entry, with tags and links
+	query    string
+	idLen    int
+
+	search textinput.Model
+	prompt textinput.Model
+	editor textarea.Model
+	view   viewport.Model
+
+	status string
+	failed bool
+}
+
+// addedMsg reports a finished background add
+type addedMsg struct {
+	entry *domain.Entry
+	note  string
+	err   error
+}
+
+func newModel(ctx context.Context, s *store.Store) *model {
+	search := textinput.New()
+	search.Prompt = "/ "
+	search.Placeholder = "search entries"
+
+	prompt := textinput.New()
+	prompt.Prompt = "tags: "
+	prompt.Placeholder = "name to add, -name to remove"
+
+	editor := textarea.New()
+	editor.ShowLineNumbers = false
+	editor.CharLimit = 0
+
+	return &model{
+		ctx:    ctx,
+		store:  s,
+		focus:  paneEntries,
+		search: search,
+		prompt: prompt,
+		editor: editor,
+		view:   viewport.New(0, 0),
+	}
+}
+
+func (m *model) Init() tea.Cmd {
+	return nil
+}
+
+// Loading
+
+func (m *model) loadTags() error {
+	tags, err := m.store.ListTags(m.ctx)
+	if err != nil {
+		return err
+	}
+
+	// Tags in a parent cycle are listed at the top, each once
+	roots, children, cyclic := domain.TagTree(tags)
+	roots = append(roots, cyclic...)
+
+	rows := []tagRow{{}}
+	listed := make(map[string]bool)
+	var walk func(ts []domain.Tag, depth int)
+	walk = func(ts []domain.Tag, depth int) {
+		sort.Slice(ts, func(i, j int) bool { return ts[i].Name < ts[j].Name })
+		for _, t := range ts {
+			if listed[t.ID] || depth > domain.MaxTagDepth {
+				continue
+			}
+			listed[t.ID] = true
+			rows = append(rows, tagRow{name: t.Name, depth: depth})
+			walk(children[t.ID], depth+1)
+		}
+	}
+	walk(roots, 0)
+
+	// Keep the selected tag selected when the tree changes
+	selected := m.selectedTag()
+	m.tags, m.tagIdx = rows, 0
+	for i, row := range rows {
+		if row.name == selected {
+			m.tagIdx = i
+		}
+	}
+	return nil
+}
+
+func (m *model) selectedTag() string {
+	if m.tagIdx < len(m.tags) {
+		return m.tags[m.tagIdx].name
+	}
+	return ""
+}
+
+// loadEntries lists the entries under the selected tag matching the
+// search, keeping the selected entry when it is still listed
+func (m *model) loadEntries() error {
+	filter := domain.EntryFilter{Text: m.query, Limit: entryLimit}
+	if tag := m.selectedTag(); tag != "" {
+		filter.Tags = []string{tag}
+	}
+	entries, err := m.store.FilterEntries(m.ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	var selected string
+	if m.entry != nil {
+		selected = m.entry.ID
+	}
+	m.entries, m.entryIdx = entries, 0
+	for i, e := range entries {
+		if e.ID == selected {
+			m.entryIdx = i
+		}
+	}
+	return m.loadEntry()
+}
+
+// loadEntry loads the selected entry into the entry pane
+func (m *model) loadEntry() error {
+	if len(m.entries) == 0 {
+		m.entry = nil
+		m.view.SetContent(dimStyle.Render("No entries."))
+		return nil
+	}
+	entry, err := m.store.GetEntry(m.ctx, m.entries[m.entryIdx].ID)
+	if err != nil {
+		return err
+	}
+	m.entry = entry
+	m.view.SetContent(m.renderEntry())
+	m.view.GotoTop()
+	return nil
+}
+
+func (m *model) reload() error {
+	n, err := m.store.ShortIDLength(m.ctx)
+	if err != nil {
+		return err
+	}
+	m.idLen = n
+	if err := m.loadTags(); err != nil {
+		return err
+	}
+	return m.loadEntries()
+}
+
+// Updating
+
+func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.resize()
+		return m, nil
+
+	case addedMsg:
+		if msg.err != nil {
+			m.setError(msg.err)
+			return m, nil
+		}
+		m.entry = msg.entry
+		m.setStatus("Added " + m.short(msg.entry.ID) + tagSummary(msg.entry))
+		if msg.note != "" {
+			m.setStatus(m.status + " (" + msg.note + ")")
+		}
+		if err := m.reload(); err != nil {
+			m.setError(err)
+		}
+		return m, nil
+
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			return m, tea.Quit
+		}
+		switch m.mode {
+		case modeSearch:
+			return m.updateSearch(msg)
+		case modeAdd, modeEdit:
+			return m.updateEditor(msg)
+		case modeTag:
+			return m.updateTagPrompt(msg)
+		case modeDelete:
+			return m.updateDelete(msg)
+		}
+		return m.updateBrowse(msg)
+	}
+
+	// Cursor blinks and other ticks go to whatever has focus
+	var cmd tea.Cmd
+	switch m.mode {
+	case modeSearch:
+		m.search, cmd = m.search.Update(msg)
+	case modeTag:
+		m.prompt, cmd = m.prompt.Update(msg)
+	case modeAdd, modeEdit:
+		m.editor, cmd = m.editor.Update(msg)
+	}
+	return m, cmd
+}
+
+func (m *model) updateBrowse(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.status = ""
+	var err error
+
+	switch msg.String() {
+	case "q":
+		return m, tea.Quit
+	case "tab", "l", "right":
+		m.focus = (m.focus + 1) % 3
+	case "shift+tab", "h", "left":
+		m.focus = (m.focus + 2) % 3
+	case "j", "down":
+		err = m.move(1)
+	case "k", "up":
+		err = m.move(-1)
+	case "g", "home":
+		err = m.move(-len(m.tags) - len(m.entries))
+	case "G", "end":
+		err = m.move(len(m.tags) + len(m.entries))
+	case "enter":
+		err = m.open()
+	case "esc":
+		if m.query != "" {
+			m.query = ""
+			m.search.SetValue("")
+			err = m.loadEntries()
+		}
+	case "/":
+		m.mode = modeSearch
+		m.search.SetValue(m.query)
+		return m, m.search.Focus()
+	case "a":
+		m.mode = modeAdd
+		m.editor.SetValue("")
+		return m, m.editor.Focus()
+	case "e":
+		if m.entry == nil {
+			return m, nil
+		}
+		m.mode = modeEdit
+		m.editor.SetValue(m.entry.Content)
+		return m, m.editor.Focus()
+	case "t":
+		if m.entry == nil {
+			return m, nil
+		}
+		m.mode = modeTag
+		m.prompt.SetValue("")
+		return m, m.prompt.Focus()
+	case "d":
+		if m.entry != nil {
+			m.mode = modeDelete
+		}
+	case "r":
+		err = m.reload()
+	default:
+		if m.focus == paneEntry {
+			var cmd tea.Cmd
+			m.view, cmd = m.view.Update(msg)
+			return m, cmd
+		}
+	}
+
+	if err != nil {
+		m.setError(err)
+	}
+	return m, nil
+}
+
+// move moves the cursor of the focused pane by delta rows
+func (m *model) move(delta int) error {
+	switch m.focus {
+	case paneTags:
+		idx := clamp(m.tagIdx+delta, len(m.tags))
+		if idx == m.tagIdx {
+			return nil
+		}
+		m.tagIdx = idx
+		m.entry = nil
+		return m.loadEntries()
+	case paneEntries:
+		idx := clamp(m.entryIdx+delta, len(m.entries))
+		if idx == m.entryIdx {
+			return nil
+		}
+		m.entryIdx = idx
+		return m.loadEntry()
+	default:
+		if delta > 0 {
+			m.view.ScrollDown(delta)
+		} else {
+			m.view.ScrollUp(-delta)
+		}
+	}
+	return nil
+}
+
+// open moves focus right; opening an entry counts as viewing it
+func (m *model) open() error {
+	switch m.focus {
+	case paneTags:
+		m.focus = paneEntries
+	case paneEntries:
+		if m.entry == nil {
+			return nil
+		}
+		m.focus = paneEntry
+		return m.store.MarkViewed(m.ctx, m.entry.ID)
+	}
+	return nil
+}
+
+func (m *model) updateSearch(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		m.mode = modeBrowse
+		m.search.Blur()
+		m.focus = paneEntries
+		return m, nil
+	case "esc":
+		m.mode = modeBrowse
+		m.search.Blur()
+		m.search.SetValue("")
+	}
+
+	var cmd tea.Cmd
+	if m.mode == modeSearch {
+		m.search, cmd = m.search.Update(msg)
+	}
+	// Search as you type
+	if query := strings.TrimSpace(m.search.Value()); query != m.query {
+		m.query = query
+		if err := m.loadEntries(); err != nil {
+			m.setError(err)
+		}
+	}
+	return m, cmd
+}
+
+func (m *model) updateEditor(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.mode = modeBrowse
+		m.editor.Blur()
+		return m, nil
+	case "ctrl+s":
+		content := strings.TrimSpace(m.editor.Value())
+		if content == "" {
+			return m, nil
+		}
+		adding := m.mode == modeAdd
+		m.mode = modeBrowse
+		m.editor.Blur()
+		if adding {
+			m.setStatus("Adding and classifying...")
+			ctx, s := m.ctx, m.store
+			return m, func() tea.Msg {
+				entry, note, err := ingest(ctx, s, content)
+				return addedMsg{entry: entry, note: note, err: err}
+			}
+		}
+		m.save(content)
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.editor, cmd = m.editor.Update(msg)
+	return m, cmd
+}
+
+// save stores an edit of the selected entry, unless it changed meanwhile
+func (m *model) save(content string) {
+	entry, err := m.store.UpdateEntry(m.ctx, m.entry.ID, content, m.entry.Source.Title, m.entry.Revision)
+	if errors.Is(err, store.ErrRevisionConflict) {
+		m.setError(fmt.Errorf("entry changed elsewhere since it was loaded; reload with r and edit again"))
+		return
+	}
+	if err != nil {
+		m.setError(err)
+		return
+	}
+	status := "Saved " + m.short(m.entry.ID)
+	if unresolved, err := m.store.LinkWikiLinks(m.ctx, entry.ID, entry.Content); err == nil && len(unresolved) > 0 {
+		status += fmt.Sprintf(" (%d unresolved links)", len(unresolved))
+	}
+	m.setStatus(status)
+	if err := m.loadEntries(); err != nil {
+		m.setError(err)
+	}
+}
+
+func (m *model) updateTagPrompt(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.mode = modeBrowse
+		m.prompt.Blur()
+		return m, nil
+	case "enter":
+		m.mode = modeBrowse
+		m.prompt.Blur()
+		if err := m.retag(strings.Fields(m.prompt.Value())); err != nil {
+			m.setError(err)
+		}
+		if err := m.reload(); err != nil {
+			m.setError(err)
+		}
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.prompt, cmd = m.prompt.Update(msg)
+	return m, cmd
+}
+
+// retag applies tag corrections to the selected entry: plain names are
+// added and -names removed, recorded as feedback like kb tag add/rm
+func (m *model) retag(names []string) error {
+	var changes []string
+	for _, name := range names {
+		if removed, ok := strings.CutPrefix(name, "-"); ok {
+			tag, err := m.store.GetTagByName(m.ctx, removed)
+			if err != nil {
+				return err
+			}
+			if err := m.store.UntagByHuman(m.ctx, m.entry.ID, tag.ID); err != nil {
+				return fmt.Errorf("%s: %w", removed, err)
+			}
+			changes = append(changes, name)
+			continue
+		}
+		name = strings.TrimPrefix(name, "+")
+		tag, err := m.store.GetOrCreateTag(m.ctx, name, nil)
+		if err != nil {
+			return err
+		}
+		if err := m.store.TagByHuman(m.ctx, m.entry.ID, tag.ID); err != nil {
+			return err
+		}
+		changes = append(changes, "+"+name)
+	}
+	if len(changes) > 0 {
+		m.setStatus("Tags: " + strings.Join(changes, " "))
+	}
+	return nil
+}
+
+func (m *model) updateDelete(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.mode = modeBrowse
+	if msg.String() != "y" {
+		m.setStatus("Kept")
+		return m, nil
+	}
+	id := m.entry.ID
+	if err := m.store.DeleteEntry(m.ctx, id); err != nil {
+		m.setError(err)
+		return m, nil
+	}
+	m.entry = nil
+	m.setStatus("Moved " + m.short(id) + " to the trash (kb restore brings it back)")
+	if err := m.reload(); err != nil {
+		m.setError(err)
+	}
+	return m, nil
+}
+
+func (m *model) setStatus(s string) {
+	m.status, m.failed = s, false
+}
+
+func (m *model) setError(err error) {
+	m.status, m.failed = err.Error(), true
+}
+
+// Rendering
+
+// resize fits the panes to the terminal: the tag tree has a fixed width,
+// the entry list and entry share the rest
+func (m *model) resize() {
+	w, h := m.entryPaneSize()
+	m.view.Width, m.view.Height = w, h
+	m.editor.SetWidth(w)
+	m.editor.SetHeight(h - 1)
+	m.search.Width = m.width - 4
+	m.prompt.Width = m.width - 10
+	if m.entry != nil {
+		m.view.SetContent(m.renderEntry())
+	}
+}
+
+// paneHeight is the inner height of every pane, leaving a line for the
+// status or input
+func (m *model) paneHeight() int {
+	return max(m.height-3, 1)
+}
+
+func (m *model) listPaneWidth() int {
+	return max((m.width-tagPaneWidth)*2/5, 10)
+}
+
+func (m *model) entryPaneSize() (int, int) {
+	return max(m.width-tagPaneWidth-m.listPaneWidth()-2, 10), m.paneHeight()
+}
+
+func (m *model) View() string {
+	if m.width == 0 {
+		return ""
+	}
+	h := m.paneHeight()
+
+	tagLines := make([]string, len(m.tags))
+	for i, row := range m.tags {
+		name := row.name
+		if name == "" {
+			name = "All entries"
+		}
+		tagLines[i] = strings.Repeat("  ", row.depth) + name
+	}
+
+	entryLines := make([]string, len(m.entries))
+	for i, e := range m.entries {
+		entryLines[i] = e.CreatedAt.Format("01-02") + " " + strings.ReplaceAll(e.DisplayTitle(), "\t", " ")
+	}
+
+	var right string
+	if m.mode == modeAdd || m.mode == modeEdit {
+		heading := "New entry"
+		if m.mode == modeEdit {
+			heading = "Editing " + m.short(m.entry.ID)
+		}
+		right = titleStyle.Render(heading) + dimStyle.Render("  ctrl+s save · esc cancel") + "\n" + m.editor.View()
+	} else {
+		right = m.view.View()
+	}
+	w, _ := m.entryPaneSize()
+
+	panes := lipgloss.JoinHorizontal(lipgloss.Top,
+		m.frame(paneTags, tagPaneWidth-2, h, renderRows(tagLines, m.tagIdx, tagPaneWidth-2, h)),
+		m.frame(paneEntries, m.listPaneWidth()-2, h, renderRows(entryLines, m.entryIdx, m.listPaneWidth()-2, h)),
+		m.frame(paneEntry, w, h, right),
+	)
+	return panes + "\n" + m.bottomLine()
+}
+
+func (m *model) frame(p pane, w, h int, content string) string {
+	style := borderStyle
+	if p == m.focus || (p == paneEntry && (m.mode == modeAdd || m.mode == modeEdit)) {
+		style = focusedStyle
+	}
+	return style.Width(w).Height(h).MaxHeight(h + 2).Render(content)
+}
+
+// bottomLine shows the active input or confirmation, else the status or help
+func (m *model) bottomLine() string {
+	switch m.mode {
+	case modeSearch:
+		return m.search.View()
+	case modeTag:
+		return m.prompt.View()
+	case modeDelete:
+		return fmt.Sprintf("Move %s %q to the trash? [y/N]", m.short(m.entry.ID), truncate(m.entry.DisplayTitle(), 40))
+	}
+
+	// Truncate before styling, so escape codes aren't cut
+	text, style := helpLine, dimStyle
+	if m.status != "" {
+		text, style = m.status, lipgloss.NewStyle()
+		if m.failed {
+			style = errorStyle
+		}
+	}
+	var prefix string
+	if m.query != "" {
+		prefix = fmt.Sprintf("[/%s: %d] ", m.query, len(m.entries))
+	}
+	return dimStyle.Render(prefix) + style.Render(truncate(text, max(m.width-len([]rune(prefix)), 1)))
+}
+
+// renderRows renders a list scrolled to keep the selected row visible
+func renderRows(lines []string, selected, width, height int) string {
+	offset := max(selected-height+1, 0)
+	end := min(offset+height, len(lines))
+
+	var sb strings.Builder
+	for i := offset; i < end; i++ {
+		line := truncate(lines[i], width)
+		if i == selected {
+			line = selectedStyle.Render(line + strings.Repeat(" ", max(width-len([]rune(line)), 0)))
+		}
+		sb.WriteString(line)
+		if i < end-1 {
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+func (m *model) renderEntry() string {
+	e := m.entry
+	w, _ := m.entryPaneSize()
+	var sb strings.Builder
+
+	sb.WriteString(titleStyle.Render(e.DisplayTitle()) + "\n")
+	meta := []string{m.short(e.ID), e.CreatedAt.Format("2006-01-02 15:04"), e.Source.Type, e.Maturity}
+	if e.ExpiresAt != nil {
+		meta = append(meta, "scratch")
+	}
+	sb.WriteString(dimStyle.Render(strings.Join(meta, " · ")) + "\n")
+	if e.Source.URL != "" {
+		sb.WriteString(dimStyle.Render(e.Source.URL) + "\n")
+	}
+	if len(e.Tags) > 0 {
+		names := make([]string, len(e.Tags))
+		for i, t := range e.Tags {
+			names[i] = "#" + t.Name
+		}
+		sb.WriteString(strings.Join(names, " ") + "\n")
+	}
+
+	sb.WriteString("\n" + lipgloss.NewStyle().Width(w).Render(e.Content) + "\n")
+
+	if len(e.Links) > 0 {
+		sb.WriteString("\n" + titleStyle.Render("Links") + "\n")
+		for _, l := range e.Links {
+			verb := domain.LinkVerb(l.Kind, false) + " "
+			sb.WriteString(verb + m.short(l.EntryID) + "  " + truncate(l.Title, w-10-len(verb)) + "\n")
+		}
+	}
+	if len(e.Backlinks) > 0 {
+		sb.WriteString("\n" + titleStyle.Render("Backlinks") + "\n")
+		for _, l := range e.Backlinks {
+			verb := domain.LinkVerb(l.Kind, true) + " "
+			sb.WriteString(verb + m.short(l.EntryID) + "  " + truncate(l.Title, w-10-len(verb)) + "\n")
+		}
+	}
+	if len(e.Attachments) > 0 {
+		sb.WriteString("\n" + titleStyle.Render("Attachments") + "\n")
+		for _, a := range e.Attachments {
+			sb.WriteString(a.Filename + "\n")
+		}
+	}
+	return sb.String()
+}
+
+func tagSummary(e *domain.Entry) string {
+	if len(e.Tags) == 0 {
+		return ""
+	}
+	names := make([]string, len(e.Tags))
+	for i, t := range e.Tags {
+		names[i] = t.Name
+	}
+	return " — " + strings.Join(names, ", ")
+}
+
+func (m *model) short(id string) string {
+	return domain.ShortID(id, m.idLen)
+}
+
+func clamp(i, n int) int {
+	return max(min(i, n-1), 0)
+}
+
+func truncate(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	if max <= 3 {
+		return string(r[:max])
+	}
+	return string(r[:max-3]) + "..."
+}
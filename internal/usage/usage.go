@@ -0,0 +1,50 @@
+package usage
+
+import "time"
+
+// Event records the tokens consumed by one external API call
+type Event struct {
+	Service      string    `json:"service"`
+	Model        string    `json:"model"`
+	InputTokens  int       `json:"input_tokens"`
+	OutputTokens int       `json:"output_tokens"`
+	At           time.Time `json:"at"`
+}
+
+// Sink persists usage events
+type Sink interface {
+	RecordUsage(Event) error
+}
+
+var sink Sink
+
+// SetSink sets where usage events are recorded (nil disables recording)
+func SetSink(s Sink) {
+	sink = s
+}
+
+// Record reports a usage event to the configured sink, if any
+func Record(e Event) {
+	if sink == nil {
+		return
+	}
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+	sink.RecordUsage(e)
+}
+
+// pricing is USD per million input and output tokens
+var pricing = map[string][2]float64{
+	"claude-sonnet-4-20250514": {3, 15},
+	"voyage-3-lite":            {0.02, 0},
+}
+
+// Cost estimates the USD cost of a number of tokens for a model
+func Cost(model string, inputTokens, outputTokens int) float64 {
+	p, ok := pricing[model]
+	if !ok {
+		return 0
+	}
+	return (float64(inputTokens)*p[0] + float64(outputTokens)*p[1]) / 1e6
+}
@@ -0,0 +1,326 @@
+// Package vecindex finds the vectors nearest to a query, by cosine
+// similarity, in a HNSW graph (Hierarchical Navigable Small World, Malkov
+// & Yashunin): a search visits a few hundred vectors instead of them all,
+// at the cost of missing some of the nearest now and then.
+package vecindex
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+// Graph parameters: links per vector (twice as many on the bottom layer),
+// and how many candidates an insertion and a search keep
+const (
+	maxLinks       = 16
+	efConstruction = 64
+	efSearch       = 64
+)
+
+// Result is a vector found, by key, with its similarity to the query
+type Result struct {
+	Key        string
+	Similarity float64
+}
+
+// Index is a HNSW graph of vectors by key, safe for concurrent use.
+// Adding a key again replaces its vector.
+type Index struct {
+	mu    sync.RWMutex
+	nodes []node
+	// keys maps keys to their current node; replaced and removed nodes
+	// stay in the graph, to route searches, but aren't returned
+	keys     map[string]int32
+	entry    int32
+	maxLevel int
+	rng      *rand.Rand
+	// seen marks the nodes an insertion visited, with the insertion's
+	// number, to skip clearing it each time
+	seen  []uint32
+	round uint32
+}
+
+type node struct {
+	key     string
+	vector  []float32
+	links   [][]int32
+	removed bool
+}
+
+// New creates an empty Index
+func New() *Index {
+	return &Index{keys: make(map[string]int32), entry: -1, rng: rand.New(rand.NewSource(1))}
+}
+
+// Len returns the number of keys in the index
+func (x *Index) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.keys)
+}
+
+// Stale returns the share of the graph's nodes that were replaced or
+// removed; past a half or so, rebuilding the index pays off
+func (x *Index) Stale() float64 {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	if len(x.nodes) == 0 {
+		return 0
+	}
+	return 1 - float64(len(x.keys))/float64(len(x.nodes))
+}
+
+// Add inserts the vector of a key, replacing the one it had. Zero
+// vectors are left out, as they're similar to nothing.
+func (x *Index) Add(key string, vector []float64) {
+	v := normalize(vector)
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(key)
+	if v == nil {
+		return
+	}
+
+	id := int32(len(x.nodes))
+	level := int(math.Floor(-math.Log(1-x.rng.Float64()) / math.Log(maxLinks)))
+	x.nodes = append(x.nodes, node{key: key, vector: v, links: make([][]int32, level+1)})
+	x.keys[key] = id
+	if x.entry < 0 {
+		x.entry, x.maxLevel = id, level
+		return
+	}
+
+	ep := x.entry
+	for l := x.maxLevel; l > level; l-- {
+		ep = x.greedy(v, ep, l)
+	}
+	for l := min(level, x.maxLevel); l >= 0; l-- {
+		x.round++
+		found := x.searchLayer(v, ep, efConstruction, l, x.visitOnce)
+		neighbors := closest(found, linkLimit(l))
+		x.nodes[id].links[l] = neighbors
+		for _, n := range neighbors {
+			x.link(n, id, l)
+		}
+		ep = found[0].id
+	}
+	if level > x.maxLevel {
+		x.entry, x.maxLevel = id, level
+	}
+}
+
+// Remove takes a key out of the index
+func (x *Index) Remove(key string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(key)
+}
+
+func (x *Index) remove(key string) {
+	if id, ok := x.keys[key]; ok {
+		x.nodes[id].removed = true
+		delete(x.keys, key)
+	}
+}
+
+// Search returns up to k keys whose vectors are the most similar to
+// vector, most similar first
+func (x *Index) Search(vector []float64, k int) []Result {
+	v := normalize(vector)
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	if v == nil || x.entry < 0 || k <= 0 {
+		return nil
+	}
+
+	ep := x.entry
+	for l := x.maxLevel; l > 0; l-- {
+		ep = x.greedy(v, ep, l)
+	}
+	// Removed nodes take room among the candidates: look further to
+	// still find k
+	ef := max(efSearch, k+k*(len(x.nodes)-len(x.keys))/max(len(x.nodes), 1))
+	visited := make(map[int32]bool, ef*maxLinks)
+	found := x.searchLayer(v, ep, ef, 0, func(n int32) bool {
+		if visited[n] {
+			return false
+		}
+		visited[n] = true
+		return true
+	})
+
+	results := make([]Result, 0, k)
+	for _, c := range found {
+		if x.nodes[c.id].removed {
+			continue
+		}
+		results = append(results, Result{Key: x.nodes[c.id].key, Similarity: 1 - c.dist})
+		if len(results) == k {
+			break
+		}
+	}
+	return results
+}
+
+// link adds a link from node n to node to on layer l, dropping the
+// farthest of n's links when it has too many
+func (x *Index) link(n, to int32, l int) {
+	links := append(x.nodes[n].links[l], to)
+	if len(links) > linkLimit(l) {
+		candidates := make([]candidate, len(links))
+		for i, m := range links {
+			candidates[i] = candidate{m, x.distance(x.nodes[n].vector, m)}
+		}
+		sortCandidates(candidates)
+		links = closest(candidates, linkLimit(l))
+	}
+	x.nodes[n].links[l] = links
+}
+
+// greedy walks layer l from ep to the node closest to v
+func (x *Index) greedy(v []float32, ep int32, l int) int32 {
+	best := x.distance(v, ep)
+	for changed := true; changed; {
+		changed = false
+		for _, n := range x.nodes[ep].links[l] {
+			if d := x.distance(v, n); d < best {
+				ep, best, changed = n, d, true
+			}
+		}
+	}
+	return ep
+}
+
+// visitOnce reports whether an insertion visits node n for the first time
+func (x *Index) visitOnce(n int32) bool {
+	if len(x.seen) < len(x.nodes) {
+		x.seen = append(x.seen, make([]uint32, len(x.nodes)-len(x.seen))...)
+	}
+	if x.seen[n] == x.round {
+		return false
+	}
+	x.seen[n] = x.round
+	return true
+}
+
+// searchLayer returns the ef nodes of layer l closest to v found from
+// ep, closest first; first tells whether a node wasn't visited yet
+func (x *Index) searchLayer(v []float32, ep int32, ef, l int, first func(int32) bool) []candidate {
+	first(ep)
+	start := candidate{ep, x.distance(v, ep)}
+	toVisit := &minHeap{start}
+	found := &maxHeap{start}
+
+	for toVisit.Len() > 0 {
+		c := heap.Pop(toVisit).(candidate)
+		if c.dist > (*found)[0].dist && found.Len() >= ef {
+			break
+		}
+		for _, n := range x.nodes[c.id].links[l] {
+			if !first(n) {
+				continue
+			}
+			d := x.distance(v, n)
+			if found.Len() < ef || d < (*found)[0].dist {
+				heap.Push(toVisit, candidate{n, d})
+				heap.Push(found, candidate{n, d})
+				if found.Len() > ef {
+					heap.Pop(found)
+				}
+			}
+		}
+	}
+
+	result := []candidate(*found)
+	sortCandidates(result)
+	return result
+}
+
+// distance is 1 - the cosine similarity of v and node n; vectors of
+// another dimension, from another model, are as far as can be
+func (x *Index) distance(v []float32, n int32) float64 {
+	if len(x.nodes[n].vector) != len(v) {
+		return 2
+	}
+	var dot float32
+	for i, f := range x.nodes[n].vector {
+		dot += f * v[i]
+	}
+	return 1 - float64(dot)
+}
+
+// linkLimit is how many links a node keeps on layer l
+func linkLimit(l int) int {
+	if l == 0 {
+		return 2 * maxLinks
+	}
+	return maxLinks
+}
+
+// normalize returns v scaled to length 1, so that dot products are cosine
+// similarities, or nil for a zero vector
+func normalize(v []float64) []float32 {
+	var norm float64
+	for _, f := range v {
+		norm += f * f
+	}
+	if norm == 0 {
+		return nil
+	}
+	norm = math.Sqrt(norm)
+	out := make([]float32, len(v))
+	for i, f := range v {
+		out[i] = float32(f / norm)
+	}
+	return out
+}
+
+type candidate struct {
+	id   int32
+	dist float64
+}
+
+// closest returns the ids of the first n candidates, sorted closest first
+func closest(sorted []candidate, n int) []int32 {
+	ids := make([]int32, 0, min(n, len(sorted)))
+	for _, c := range sorted[:min(n, len(sorted))] {
+		ids = append(ids, c.id)
+	}
+	return ids
+}
+
+func sortCandidates(c []candidate) {
+	sort.Slice(c, func(i, j int) bool { return c[i].dist < c[j].dist })
+}
+
+type minHeap []candidate
+
+func (h minHeap) Len() int            { return len(h) }
+func (h minHeap) Less(i, j int) bool  { return h[i].dist < h[j].dist }
+func (h minHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *minHeap) Push(v interface{}) { *h = append(*h, v.(candidate)) }
+
+func (h *minHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// maxHeap keeps the farthest candidate on top
+type maxHeap []candidate
+
+func (h maxHeap) Len() int            { return len(h) }
+func (h maxHeap) Less(i, j int) bool  { return h[i].dist > h[j].dist }
+func (h maxHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *maxHeap) Push(v interface{}) { *h = append(*h, v.(candidate)) }
+
+func (h *maxHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
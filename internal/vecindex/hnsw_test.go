@@ -0,0 +1,160 @@
+package vecindex
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func randomVectors(rng *rand.Rand, n, dim int) [][]float64 {
+	vectors := make([][]float64, n)
+	for i := range vectors {
+		vectors[i] = make([]float64, dim)
+		for j := range vectors[i] {
+			vectors[i][j] = rng.NormFloat64()
+		}
+	}
+	return vectors
+}
+
+func cosine(a, b []float64) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+// nearest returns the keys of the k vectors most similar to v, by brute force
+func nearest(vectors map[string][]float64, v []float64, k int) []string {
+	keys := make([]string, 0, len(vectors))
+	for key := range vectors {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return cosine(vectors[keys[i]], v) > cosine(vectors[keys[j]], v)
+	})
+	return keys[:min(k, len(keys))]
+}
+
+// recall returns the share of the brute force k nearest the index finds,
+// over queries
+func recall(t *testing.T, x *Index, vectors map[string][]float64, queries [][]float64, k int) float64 {
+	t.Helper()
+	var found, total int
+	for _, q := range queries {
+		results := x.Search(q, k)
+		for i := 1; i < len(results); i++ {
+			if results[i].Similarity > results[i-1].Similarity+1e-6 {
+				t.Fatalf("results out of order: %v", results)
+			}
+		}
+		got := make(map[string]bool, len(results))
+		for _, r := range results {
+			if _, ok := vectors[r.Key]; !ok {
+				t.Fatalf("Search returned %q, not in the index", r.Key)
+			}
+			got[r.Key] = true
+		}
+		for _, key := range nearest(vectors, q, k) {
+			total++
+			if got[key] {
+				found++
+			}
+		}
+	}
+	return float64(found) / float64(total)
+}
+
+func TestSearchRecall(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	x := New()
+	vectors := make(map[string][]float64)
+	for i, v := range randomVectors(rng, 2000, 32) {
+		key := fmt.Sprintf("v%d", i)
+		vectors[key] = v
+		x.Add(key, v)
+	}
+	if x.Len() != len(vectors) {
+		t.Fatalf("Len = %d, want %d", x.Len(), len(vectors))
+	}
+
+	if r := recall(t, x, vectors, randomVectors(rng, 100, 32), 10); r < 0.9 {
+		t.Errorf("recall@10 = %.3f, want at least 0.9", r)
+	}
+}
+
+func TestReplaceAndRemove(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	x := New()
+	vectors := make(map[string][]float64)
+	for i, v := range randomVectors(rng, 1000, 16) {
+		key := fmt.Sprintf("v%d", i)
+		vectors[key] = v
+		x.Add(key, v)
+	}
+	// Replace a third of the vectors and remove another third
+	fresh := randomVectors(rng, 1000, 16)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("v%d", i)
+		switch i % 3 {
+		case 0:
+			vectors[key] = fresh[i]
+			x.Add(key, fresh[i])
+		case 1:
+			delete(vectors, key)
+			x.Remove(key)
+		}
+	}
+	if x.Len() != len(vectors) {
+		t.Fatalf("Len = %d, want %d", x.Len(), len(vectors))
+	}
+	if stale := x.Stale(); stale < 0.49 || stale > 0.51 {
+		t.Errorf("Stale = %.3f, want 0.5", stale)
+	}
+
+	if r := recall(t, x, vectors, randomVectors(rng, 100, 16), 10); r < 0.9 {
+		t.Errorf("recall@10 = %.3f, want at least 0.9", r)
+	}
+
+	// A replaced vector is found by its new value, most similar to itself
+	results := x.Search(fresh[3], 1)
+	if len(results) != 1 || results[0].Key != "v3" || math.Abs(results[0].Similarity-1) > 1e-4 {
+		t.Errorf("Search(new v3) = %v, want v3 at similarity 1", results)
+	}
+}
+
+func TestZeroVectors(t *testing.T) {
+	x := New()
+	x.Add("zero", []float64{0, 0, 0})
+	if x.Len() != 0 {
+		t.Errorf("Len = %d after adding a zero vector, want 0", x.Len())
+	}
+	if results := x.Search([]float64{1, 0, 0}, 5); len(results) != 0 {
+		t.Errorf("Search on an empty index = %v, want none", results)
+	}
+
+	x.Add("a", []float64{1, 0, 0})
+	x.Add("b", []float64{0, 1, 0})
+	// Zeroing a key's vector takes it out
+	x.Add("b", []float64{0, 0, 0})
+	if x.Len() != 1 {
+		t.Errorf("Len = %d, want 1", x.Len())
+	}
+	if results := x.Search([]float64{0, 0, 0}, 5); results != nil {
+		t.Errorf("Search(zero vector) = %v, want nil", results)
+	}
+	results := x.Search([]float64{0, 1, 0}, 5)
+	if len(results) != 1 || results[0].Key != "a" {
+		t.Errorf("Search = %v, want only a", results)
+	}
+	// Vectors of another dimension are similar to nothing
+	results = x.Search([]float64{1, 0}, 5)
+	if len(results) != 1 || results[0].Similarity != -1 {
+		t.Errorf("Search(other dimension) = %v, want a at similarity -1", results)
+	}
+}
@@ -0,0 +1,207 @@
+// Package worddiff compares two texts word by word.
+package worddiff
+
+import (
+	"slices"
+	"strings"
+)
+
+// Kind tells whether a run of words is common to both texts or only in one
+type Kind int
+
+const (
+	Equal Kind = iota
+	Removed
+	Added
+)
+
+// Chunk is a run of words of the same kind
+type Chunk struct {
+	Kind  Kind
+	Words []string
+}
+
+// Diff returns the chunks turning a into b. Line breaks are kept as "\n"
+// words so the result can be laid out like the originals.
+func Diff(a, b string) []Chunk {
+	return diff(words(a), words(b))
+}
+
+// Stats counts the words removed and added by a diff
+func Stats(chunks []Chunk) (removed, added int) {
+	for _, c := range chunks {
+		n := 0
+		for _, w := range c.Words {
+			if w != "\n" {
+				n++
+			}
+		}
+		switch c.Kind {
+		case Removed:
+			removed += n
+		case Added:
+			added += n
+		}
+	}
+	return removed, added
+}
+
+// Plain renders a diff in the style of git diff --word-diff=plain:
+// removed words as [-...-], added ones as {+...+}
+func Plain(chunks []Chunk) string {
+	var sb strings.Builder
+	for _, c := range chunks {
+		text := join(c.Words)
+		switch c.Kind {
+		case Removed:
+			text = "[-" + text + "-]"
+		case Added:
+			text = "{+" + text + "+}"
+		}
+		if sb.Len() > 0 && !strings.HasSuffix(sb.String(), "\n") && !strings.HasPrefix(text, "\n") {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(text)
+	}
+	return sb.String()
+}
+
+// join lays out words with spaces, without spaces around line breaks
+func join(words []string) string {
+	var sb strings.Builder
+	for i, w := range words {
+		if i > 0 && w != "\n" && words[i-1] != "\n" {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(w)
+	}
+	return sb.String()
+}
+
+// words splits text into words, with a "\n" word ending each non-empty line
+// but the last
+func words(text string) []string {
+	var result []string
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(result) > 0 {
+			result = append(result, "\n")
+		}
+		result = append(result, fields...)
+	}
+	return result
+}
+
+// diff trims the common prefix and suffix, then diffs the rest with
+// Myers' algorithm
+func diff(a, b []string) []Chunk {
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	var chunks []Chunk
+	add := func(kind Kind, words ...string) {
+		if len(words) == 0 {
+			return
+		}
+		if len(chunks) > 0 && chunks[len(chunks)-1].Kind == kind {
+			last := &chunks[len(chunks)-1]
+			last.Words = append(last.Words, words...)
+			return
+		}
+		chunks = append(chunks, Chunk{Kind: kind, Words: append([]string(nil), words...)})
+	}
+
+	add(Equal, a[:pre]...)
+	for _, o := range myers(a[pre:len(a)-suf], b[pre:len(b)-suf]) {
+		add(o.kind, o.word)
+	}
+	add(Equal, a[len(a)-suf:]...)
+	return chunks
+}
+
+type op struct {
+	kind Kind
+	word string
+}
+
+// myers is Myers' O(ND) algorithm. It keeps the furthest reaching paths of
+// each step, over diagonals -d..d, to walk the edit script back.
+func myers(a, b []string) []op {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		done := false
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				done = true
+				break
+			}
+		}
+		if done {
+			break
+		}
+	}
+
+	// Walk back from the end, collecting words in reverse
+	var ops []op
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[d+k-1] < v[d+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := 0
+		if d > 0 {
+			prevX = v[d+prevK]
+		}
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, op{Equal, a[x]})
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			y--
+			ops = append(ops, op{Added, b[y]})
+		} else {
+			x--
+			ops = append(ops, op{Removed, a[x]})
+		}
+	}
+
+	slices.Reverse(ops)
+	return ops
+}
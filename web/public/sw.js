@@ -0,0 +1,55 @@
+// Service worker: app shell is cache-first, API reads are network-first
+// with the last successful response served when offline. The shell's
+// paths are relative to this script, served under /ui/.
+const SHELL_CACHE = 'kb-shell-v2'
+const API_CACHE = 'kb-api-v1'
+const SHELL = ['./', './index.html', './manifest.webmanifest', './vite.svg']
+
+self.addEventListener('install', event => {
+  event.waitUntil(caches.open(SHELL_CACHE).then(cache => cache.addAll(SHELL)))
+  self.skipWaiting()
+})
+
+self.addEventListener('activate', event => {
+  event.waitUntil(
+    caches.keys().then(keys =>
+      Promise.all(keys.filter(k => k !== SHELL_CACHE && k !== API_CACHE).map(k => caches.delete(k)))
+    )
+  )
+  self.clients.claim()
+})
+
+self.addEventListener('fetch', event => {
+  const { request } = event
+  if (request.method !== 'GET') return
+
+  const url = new URL(request.url)
+  const isAPI = url.origin !== self.location.origin || url.pathname.match(/^\/(entries|tags|suggestions|changes|search|settings|reviews)/)
+
+  if (isAPI) {
+    event.respondWith(
+      fetch(request)
+        .then(res => {
+          if (res.ok) {
+            const copy = res.clone()
+            caches.open(API_CACHE).then(cache => cache.put(request, copy))
+          }
+          return res
+        })
+        .catch(() => caches.match(request))
+    )
+    return
+  }
+
+  event.respondWith(
+    caches.match(request).then(cached =>
+      cached || fetch(request).then(res => {
+        if (res.ok && url.origin === self.location.origin) {
+          const copy = res.clone()
+          caches.open(SHELL_CACHE).then(cache => cache.put(request, copy))
+        }
+        return res
+      })
+    )
+  )
+})
@@ -1,7 +1,11 @@
 import { useState, useEffect } from 'react'
 import './App.css'
+import { loadOfflineEntries, rememberEntries, syncChanges, filterOffline } from './offline'
+import { api, rememberToken } from './api'
+import EntryDetail from './EntryDetail'
+import Settings, { DEFAULT_SETTINGS, withDefaults } from './Settings'
 
-const API = 'http://localhost:8080'
+rememberToken()
 
 function App() {
   const [entries, setEntries] = useState([])
@@ -18,27 +22,58 @@ function App() {
     return saved ? JSON.parse(saved) : {}
   })
   const [expandedEntries, setExpandedEntries] = useState(new Set())
+  const [offline, setOffline] = useState(false)
+  const [semantic, setSemantic] = useState(false)
+  const [notice, setNotice] = useState(null)
+  const [openEntry, setOpenEntry] = useState(null)
+  // Preferences kept server-side (GET/PUT /settings), until loaded
+  const [settings, setSettings] = useState(DEFAULT_SETTINGS)
 
   useEffect(() => {
     fetchTags()
     fetchSuggestions()
+    fetchSettings()
+    syncChanges().catch(() => {})
   }, [])
 
   useEffect(() => {
     fetchEntries()
-  }, [search, selectedTag])
+  }, [search, selectedTag, semantic, settings.default_view])
+
+  useEffect(() => {
+    document.documentElement.dataset.theme = settings.theme
+  }, [settings.theme])
 
   async function fetchEntries() {
     try {
-      const params = new URLSearchParams()
-      if (search.trim()) params.set('q', search)
-      if (selectedTag) params.set('tag', selectedTag)
-      const url = params.toString() ? `${API}/entries?${params}` : `${API}/entries`
-      const res = await fetch(url)
-      const data = await res.json()
-      setEntries(data.entries || [])
+      const q = search.trim()
+      let list
+      if (q && semantic) {
+        const data = await api('/search?mode=semantic&q=' + encodeURIComponent(q))
+        list = (data.similar || []).map(s => ({ ...s.entry, similarity: s.similarity }))
+      } else if (!q && !selectedTag && settings.default_view === 'suggestions') {
+        const data = await api('/suggestions?limit=20')
+        list = data.suggestions || []
+      } else if (!q && !selectedTag && settings.default_view === 'due') {
+        const data = await api('/reviews/due')
+        list = data.entries || []
+      } else {
+        const params = new URLSearchParams()
+        if (q) params.set('q', q)
+        if (selectedTag) params.set('tag', selectedTag)
+        const data = await api(params.toString() ? `/entries?${params}` : '/entries')
+        list = data.entries || []
+      }
+      setEntries(list)
+      setOffline(false)
     } catch (err) {
-      setError('Failed to fetch entries')
+      const cached = filterOffline(loadOfflineEntries(), search, selectedTag)
+      if (cached.length > 0) {
+        setEntries(cached)
+        setOffline(true)
+      } else {
+        setError('Failed to fetch entries')
+      }
     }
   }
 
@@ -55,6 +90,8 @@ function App() {
   }
 
   function toggleExpand(entryId) {
+    const entry = entries.find(e => e.id === entryId)
+    if (entry) rememberEntries([entry])
     setExpandedEntries(prev => {
       const next = new Set(prev)
       if (next.has(entryId)) {
@@ -68,10 +105,28 @@ function App() {
 
   const TRUNCATE_LENGTH = 200
 
+  async function fetchSettings() {
+    try {
+      const data = await api('/settings')
+      setSettings(withDefaults(data))
+    } catch (err) {
+      console.error('Failed to fetch settings')
+    }
+  }
+
+  async function saveSettings(next) {
+    setSettings(next)
+    try {
+      const data = await api('/settings', { method: 'PUT', body: JSON.stringify(next) })
+      setSettings(withDefaults(data))
+    } catch (err) {
+      setError(err.message)
+    }
+  }
+
   async function fetchTags() {
     try {
-      const res = await fetch(`${API}/tags`)
-      const data = await res.json()
+      const data = await api('/tags')
       setTags(data.tags || [])
       setFlatTags(data.flat || [])
     } catch (err) {
@@ -81,8 +136,7 @@ function App() {
 
   async function fetchSuggestions() {
     try {
-      const res = await fetch(`${API}/suggestions?limit=5`)
-      const data = await res.json()
+      const data = await api('/suggestions?limit=5')
       setSuggestions(data.suggestions || [])
     } catch (err) {
       console.error('Failed to fetch suggestions')
@@ -96,12 +150,11 @@ function App() {
     setLoading(true)
     setError(null)
     try {
-      const res = await fetch(`${API}/entries`, {
-        method: 'POST',
-        headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ content })
-      })
-      if (!res.ok) throw new Error('Failed to add entry')
+      const data = await api('/entries', { method: 'POST', body: JSON.stringify({ content }) })
+      const added = (data.tags || []).map(t => t.name).join(', ')
+      setNotice(data.duplicate
+        ? `Already saved as ${data.entry.id.slice(0, 8)}`
+        : `Added ${data.entry.id.slice(0, 8)}${added ? ' — ' + added : ''}`)
       setContent('')
       fetchEntries()
       fetchTags()
@@ -118,8 +171,8 @@ function App() {
       return
     }
     try {
-      const res = await fetch(`${API}/entries/${id}`, { method: 'DELETE' })
-      if (!res.ok) throw new Error('Failed to delete entry')
+      await api(`/entries/${id}`, { method: 'DELETE' })
+      if (openEntry === id) setOpenEntry(null)
       fetchEntries()
       fetchSuggestions()
     } catch (err) {
@@ -193,12 +246,13 @@ function App() {
             </button>
           </form>
           {error && <p className="error">{error}</p>}
+          {notice && !error && <p className="notice">{notice}</p>}
         </section>
 
         <div className="content-grid">
           <section className="entries-section">
             <div className="entries-header">
-              <h2>Entries ({entries.length})</h2>
+              <h2>Entries ({entries.length}){offline && <small className="offline-badge"> offline</small>}</h2>
               <div className="search-controls">
                 <input
                   type="text"
@@ -207,6 +261,10 @@ function App() {
                   onChange={e => setSearch(e.target.value)}
                   placeholder="Search..."
                 />
+                <label className="semantic-toggle">
+                  <input type="checkbox" checked={semantic} onChange={e => setSemantic(e.target.checked)} />
+                  semantic
+                </label>
                 {selectedTag && (
                   <div className="active-filter">
                     <span className="tag selected">{selectedTag}</span>
@@ -224,13 +282,20 @@ function App() {
                   : entry.content
                 return (
                 <li key={entry.id} className="entry-card">
+                  {entry.source?.title && (
+                    <h3 className="entry-title">
+                      {entry.source.url
+                        ? <a href={entry.source.url} target="_blank" rel="noreferrer">{entry.source.title}</a>
+                        : entry.source.title}
+                    </h3>
+                  )}
                   <p
                     className={`entry-content ${isLong ? 'expandable' : ''}`}
                     onClick={isLong ? () => toggleExpand(entry.id) : undefined}
                   >
                     {displayContent}
                   </p>
-                  {entry.tags && entry.tags.length > 0 && (
+                  {settings.columns.includes('tags') && entry.tags && entry.tags.length > 0 && (
                     <div className="entry-tags">
                       {entry.tags.map(tag => (
                         <span
@@ -245,14 +310,19 @@ function App() {
                   )}
                   <div className="entry-footer">
                     <small className="entry-date">
-                      {new Date(entry.created_at).toLocaleString()}
+                      {entryMeta(entry, settings.columns)}
                     </small>
-                    <button
-                      className="delete-btn"
-                      onClick={() => deleteEntry(entry.id)}
-                    >
-                      Delete
-                    </button>
+                    <div className="entry-actions">
+                      <button className="delete-btn" onClick={() => setOpenEntry(entry.id)}>
+                        Related
+                      </button>
+                      <button
+                        className="delete-btn"
+                        onClick={() => deleteEntry(entry.id)}
+                      >
+                        Delete
+                      </button>
+                    </div>
                   </div>
                 </li>
               )})}
@@ -262,6 +332,10 @@ function App() {
           </section>
 
           <aside className="sidebar">
+            {openEntry && (
+              <EntryDetail id={openEntry} onOpen={setOpenEntry} onClose={() => setOpenEntry(null)} onError={setError} />
+            )}
+
             <section className="tags-section">
               <h2>Tags</h2>
               <TagTree nodes={tags} />
@@ -295,6 +369,8 @@ function App() {
                 <p className="no-suggestions">No suggestions yet</p>
               )}
             </section>
+
+            <Settings settings={settings} onChange={saveSettings} />
           </aside>
         </div>
       </main>
@@ -302,4 +378,15 @@ function App() {
   )
 }
 
+// entryMeta is the line under an entry card: the columns the settings
+// ask for, and how close a semantic match is
+function entryMeta(entry, columns) {
+  const meta = []
+  if (columns.includes('date')) meta.push(new Date(entry.created_at).toLocaleString())
+  if (columns.includes('maturity')) meta.push(entry.maturity)
+  if (columns.includes('source')) meta.push(entry.source?.url ? new URL(entry.source.url).host : entry.source?.type)
+  if (entry.similarity) meta.push(Math.round(entry.similarity * 100) + '%')
+  return meta.filter(Boolean).join(' · ')
+}
+
 export default App
@@ -0,0 +1,90 @@
+import { useState, useEffect } from 'react'
+import { api } from './api'
+
+// EntryDetail shows an entry in full, with the entries closest to it
+function EntryDetail({ id, onOpen, onClose, onError }) {
+  const [entry, setEntry] = useState(null)
+  const [related, setRelated] = useState([])
+
+  useEffect(() => {
+    let current = true
+    async function load() {
+      try {
+        const data = await api(`/entries/${id}`)
+        if (!current) return
+        setEntry(data)
+        const near = await api(`/entries/${id}/related`)
+        if (current) setRelated(near.related || [])
+      } catch (err) {
+        if (current) onError(err.message)
+      }
+    }
+    setEntry(null)
+    setRelated([])
+    load()
+    return () => { current = false }
+  }, [id])
+
+  if (!entry) return null
+  return (
+    <section className="detail-section">
+      <button className="detail-close" onClick={onClose} title="Close">×</button>
+      <h3 className="entry-title">{entryTitle(entry)}</h3>
+      <small className="entry-date">
+        {entry.id.slice(0, 8)} · {new Date(entry.created_at).toLocaleString()} · {entry.source?.url
+          ? <a href={entry.source.url} target="_blank" rel="noreferrer">{entry.source.url}</a>
+          : entry.source?.type}
+      </small>
+      <EntryBody entry={entry} />
+
+      <h2>Related</h2>
+      {related.length > 0 ? (
+        <ul className="suggestions-list">
+          {related.map(r => (
+            <li key={r.entry.id} className="suggestion-card clickable" onClick={() => onOpen(r.entry.id)}>
+              <p className="suggestion-content">{entryTitle(r.entry).slice(0, 100)}</p>
+              <small className="entry-date">{Math.round(r.similarity * 100)}%</small>
+            </li>
+          ))}
+        </ul>
+      ) : (
+        <p className="no-suggestions">Nothing related yet</p>
+      )}
+    </section>
+  )
+}
+
+// Section headings of structured captures, e.g. "## Highlights {#highlights}"
+const SECTION_HEADING = /^## .+ \{#\w+\}$/
+
+function entryTitle(entry) {
+  if (entry.source?.title) return entry.source.title
+  return entry.content.trim().split('\n').find(line => line && !SECTION_HEADING.test(line)) || ''
+}
+
+// EntryBody lays out an entry's content: structured captures get a block
+// per section, with highlights as quotes and the full text folded away
+function EntryBody({ entry }) {
+  if (!entry.sections) return <p className="entry-content">{entry.content}</p>
+  return entry.sections.map((section, i) => {
+    const text = section.kind === 'highlights'
+      ? section.text.split('\n\n').map((quote, j) => <blockquote key={j}>{quote.replace(/^> ?/gm, '')}</blockquote>)
+      : <p className="entry-content">{section.text}</p>
+    if (section.kind === 'text') {
+      return (
+        <details key={i} className="entry-section">
+          <summary>{section.heading}</summary>
+          {text}
+        </details>
+      )
+    }
+    return (
+      <section key={i} className={`entry-section ${section.kind}`}>
+        {section.heading && <h4>{section.heading}</h4>}
+        {text}
+      </section>
+    )
+  })
+}
+
+export default EntryDetail
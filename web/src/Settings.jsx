@@ -0,0 +1,59 @@
+// Settings are the user's preferences, kept server-side (GET/PUT /settings)
+export const DEFAULT_SETTINGS = { theme: 'dark', default_view: 'recent', columns: ['tags', 'date', 'maturity'] }
+
+// withDefaults fills in the settings the server left out
+export function withDefaults(settings) {
+  const merged = { ...DEFAULT_SETTINGS, ...settings }
+  if (!Array.isArray(merged.columns)) merged.columns = []
+  return merged
+}
+
+const COLUMNS = [
+  ['tags', 'tags'],
+  ['date', 'date'],
+  ['maturity', 'stage'],
+  ['source', 'source'],
+]
+
+function Settings({ settings, onChange }) {
+  function toggleColumn(column, checked) {
+    const columns = checked
+      ? [...settings.columns, column]
+      : settings.columns.filter(c => c !== column)
+    onChange({ ...settings, columns })
+  }
+
+  return (
+    <details className="settings-section">
+      <summary>Settings</summary>
+      <label>Theme
+        <select value={settings.theme} onChange={e => onChange({ ...settings, theme: e.target.value })}>
+          <option value="dark">dark</option>
+          <option value="light">light</option>
+          <option value="system">system</option>
+        </select>
+      </label>
+      <label>Default view
+        <select value={settings.default_view} onChange={e => onChange({ ...settings, default_view: e.target.value })}>
+          <option value="recent">recent entries</option>
+          <option value="suggestions">least recently viewed</option>
+          <option value="due">due for review</option>
+        </select>
+      </label>
+      <fieldset>
+        {COLUMNS.map(([column, label]) => (
+          <label key={column}>
+            <input
+              type="checkbox"
+              checked={settings.columns.includes(column)}
+              onChange={e => toggleColumn(column, e.target.checked)}
+            />
+            {' '}{label}
+          </label>
+        ))}
+      </fieldset>
+    </details>
+  )
+}
+
+export default Settings
@@ -0,0 +1,36 @@
+// API client. kb serve serves the built app, so it talks to its own
+// origin; the dev server talks to a local kb serve.
+const API = import.meta.env.DEV ? 'http://localhost:8080' : ''
+
+const TOKEN_KEY = 'kb-token'
+
+// rememberToken keeps a token given as ?token=, then drops it from the
+// address bar
+export function rememberToken() {
+  const params = new URLSearchParams(window.location.search)
+  const token = params.get('token')
+  if (!token) return
+  localStorage.setItem(TOKEN_KEY, token)
+  window.history.replaceState(null, '', window.location.pathname)
+}
+
+// api calls the API with the remembered token, asking for one when the
+// server wants it, and returns the decoded response
+export async function api(path, options = {}) {
+  const headers = { ...(options.headers || {}) }
+  const token = localStorage.getItem(TOKEN_KEY)
+  if (token) headers.Authorization = 'Bearer ' + token
+  if (options.body) headers['Content-Type'] = 'application/json'
+
+  const res = await fetch(API + path, { ...options, headers })
+  if (res.status === 401) {
+    const entered = window.prompt('API token')
+    if (entered) {
+      localStorage.setItem(TOKEN_KEY, entered.trim())
+      return api(path, options)
+    }
+  }
+  const data = await res.json().catch(() => ({}))
+  if (!res.ok) throw new Error(data.error || res.statusText)
+  return data
+}
@@ -0,0 +1,51 @@
+// Offline copy of recent entries, kept fresh via the /changes feed so the
+// app can still show them on a flaky connection.
+import { api } from './api'
+
+const ENTRIES_KEY = 'kb-offline-entries'
+const SYNC_KEY = 'kb-offline-synced-at'
+const MAX_ENTRIES = 200
+
+export function loadOfflineEntries() {
+  const saved = localStorage.getItem(ENTRIES_KEY)
+  return saved ? JSON.parse(saved) : []
+}
+
+function saveOfflineEntries(entries) {
+  const recent = [...entries]
+    .sort((a, b) => new Date(b.created_at) - new Date(a.created_at))
+    .slice(0, MAX_ENTRIES)
+  localStorage.setItem(ENTRIES_KEY, JSON.stringify(recent))
+}
+
+// rememberEntries merges entries (e.g. ones just viewed) into the offline copy
+export function rememberEntries(entries) {
+  const byId = new Map(loadOfflineEntries().map(e => [e.id, e]))
+  for (const e of entries) byId.set(e.id, e)
+  saveOfflineEntries([...byId.values()])
+}
+
+// forgetEntries drops entries (e.g. ones archived or deleted) from the
+// offline copy
+export function forgetEntries(ids) {
+  const gone = new Set(ids)
+  saveOfflineEntries(loadOfflineEntries().filter(e => !gone.has(e.id)))
+}
+
+// syncChanges pulls entries changed or removed since the last sync
+export async function syncChanges() {
+  const since = localStorage.getItem(SYNC_KEY)
+  const data = await api(since ? `/changes?since=${encodeURIComponent(since)}` : '/changes')
+  rememberEntries(data.entries || [])
+  forgetEntries(data.removed || [])
+  if (data.now) localStorage.setItem(SYNC_KEY, data.now)
+}
+
+// filterOffline applies the search/tag filters of the entries list locally
+export function filterOffline(entries, search, tag) {
+  const q = search.trim().toLowerCase()
+  return entries.filter(e =>
+    (!q || e.content.toLowerCase().includes(q)) &&
+    (!tag || (e.tags || []).some(t => t.name === tag))
+  )
+}
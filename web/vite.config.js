@@ -4,4 +4,6 @@ import react from '@vitejs/plugin-react'
 // https://vite.dev/config/
 export default defineConfig({
   plugins: [react()],
+  // kb serve serves the build (embedded by the web Go package) under /ui/
+  base: '/ui/',
 })
@@ -0,0 +1,27 @@
+// Package web holds the web UI, a React app that npm run build builds
+// into dist. The build is embedded in kb, to be served by kb serve: build
+// the UI before kb for the binary to carry it, with go generate ./web.
+package web
+
+//go:generate npm ci
+//go:generate npm run build
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed all:dist
+var dist embed.FS
+
+// Dist returns the built UI, or nil if it wasn't built before kb was
+func Dist() fs.FS {
+	sub, err := fs.Sub(dist, "dist")
+	if err != nil {
+		return nil
+	}
+	if _, err := fs.Stat(sub, "index.html"); err != nil {
+		return nil
+	}
+	return sub
+}